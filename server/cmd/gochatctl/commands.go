@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/objectstore"
+	"gochat/internal/services"
+	"gochat/internal/tasks"
+	"gochat/internal/websocket"
+)
+
+// parseFlags 解析子命令的参数
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+// readPassword 未通过参数指定密码时从标准输入读取一行，避免密码留在shell历史中
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// recordCLIAudit 记录通过命令行执行的管理操作，操作者为执行命令的系统用户
+func recordCLIAudit(ctx context.Context, entry *services.AuditEntry) {
+	operator := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		operator = current.Username
+	}
+	if entry.Detail == nil {
+		entry.Detail = make(map[string]interface{})
+	}
+	entry.Detail["operator"] = operator
+	entry.ActorType = services.AuditActorCLI
+	if err := services.NewAuditService().Record(ctx, entry); err != nil {
+		logger.GetLogger().Errorf("记录审计日志失败: action=%s, error=%v", entry.Action, err)
+	}
+}
+
+// runCreateAdmin 创建带管理后台角色的用户
+func runCreateAdmin(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	phone := fs.String("phone", "", "登录手机号")
+	nickname := fs.String("nickname", "", "昵称")
+	password := fs.String("password", "", "登录密码，为空时从标准输入读取")
+	role := fs.String("role", services.RoleAdmin, "管理后台角色：support、moderator或admin")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *phone == "" || *nickname == "" {
+		return errors.New("-phone and -nickname are required")
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	// 配置了事件总线时注册事件写入发件箱，由服务端中继发布
+	if err := services.InitEventBus(&cfg.EventBus); err != nil {
+		return err
+	}
+	defer services.CloseEventBus()
+
+	ctx := context.Background()
+	info, err := services.NewAdminService().CreateStaffUser(ctx, *phone, *nickname, pass, *role)
+	if err != nil {
+		return err
+	}
+	recordCLIAudit(ctx, &services.AuditEntry{
+		Action:     services.AuditActionCreateStaffUser,
+		TargetType: services.AuditTargetUser,
+		TargetID:   info.ID,
+		Detail:     map[string]interface{}{"role": info.Role},
+	})
+	fmt.Printf("User %d created, phone=%s, role=%s\n", info.ID, info.Phone, info.Role)
+	return nil
+}
+
+// runResetPassword 重置用户密码，强制下线并解除登录锁定
+func runResetPassword(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	userID := fs.Int64("user", 0, "用户ID")
+	phone := fs.String("phone", "", "登录手机号，未指定-user时使用")
+	password := fs.String("password", "", "新密码，为空时从标准输入读取")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if (*userID == 0) == (*phone == "") {
+		return errors.New("exactly one of -user and -phone is required")
+	}
+
+	ctx := context.Background()
+	adminService := services.NewAdminService()
+	var info *services.AdminUserInfo
+	var err error
+	if *userID > 0 {
+		info, err = adminService.GetUser(ctx, *userID)
+	} else {
+		info, err = adminService.FindUserByPhone(ctx, *phone)
+	}
+	if err != nil {
+		return err
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	if info, err = adminService.ResetPassword(ctx, info.ID, pass); err != nil {
+		return err
+	}
+	if err := services.NewLoginGuard(&cfg.Login).Unlock(ctx, info.Phone); err != nil {
+		logger.GetLogger().Warnf("解除登录锁定失败: %v", err)
+	}
+	recordCLIAudit(ctx, &services.AuditEntry{
+		Action:     services.AuditActionResetPassword,
+		TargetType: services.AuditTargetUser,
+		TargetID:   info.ID,
+	})
+	fmt.Printf("Password of user %d (%s) reset, existing sessions revoked\n", info.ID, info.Phone)
+	return nil
+}
+
+// runMigrate 执行数据库迁移，与服务启动时执行的迁移相同
+func runMigrate(cfg *config.Config, args []string) error {
+	if err := parseFlags(flag.NewFlagSet("migrate", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+	if err := database.Migrate(); err != nil {
+		return err
+	}
+	if err := database.OptimizeDatabase(database.GetDB()); err != nil {
+		logger.GetLogger().Warnf("Database optimization failed: %v", err)
+	}
+	fmt.Println("Database migration completed")
+	return nil
+}
+
+// runFileCleanup 执行一次文件清理，其他实例正在清理时跳过
+func runFileCleanup(cfg *config.Config, args []string) error {
+	if err := parseFlags(flag.NewFlagSet("file-cleanup", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+	// 孤儿文件可能保存在对象存储中
+	if err := objectstore.Init(&cfg.Storage.S3); err != nil {
+		return err
+	}
+	tasks.NewFileCleanupTask(&cfg.Upload).RunNow()
+	recordCLIAudit(context.Background(), &services.AuditEntry{
+		Action:     services.AuditActionRunJob,
+		TargetType: services.AuditTargetJob,
+		Detail:     map[string]interface{}{"job": "file_cleanup"},
+	})
+	fmt.Println("File cleanup finished, see the log above for details")
+	return nil
+}
+
+// runOnlineUsers 输出各实例最近上报的连接数，拆分部署时另外列出连接在各网关上的用户
+func runOnlineUsers(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("online-users", flag.ContinueOnError)
+	limit := fs.Int("limit", 100, "最多列出的用户数，0表示不限制")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	nodes, err := services.NewAdminStatsService(&cfg.Admin.Stats).NodeConnections(ctx)
+	if err != nil {
+		return err
+	}
+	nodeIDs := make([]int64, 0, len(nodes))
+	for nodeID := range nodes {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Slice(nodeIDs, func(i, j int) bool { return nodeIDs[i] < nodeIDs[j] })
+	total := 0
+	for _, nodeID := range nodeIDs {
+		fmt.Printf("node %d\t%d connections\n", nodeID, nodes[nodeID])
+		total += nodes[nodeID]
+	}
+	fmt.Printf("total\t%d connections on %d instances\n", total, len(nodes))
+
+	users, err := websocket.RoutedUsers(ctx, cache.GetRedisClient(), *limit)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		// 单进程部署时在线用户只保存在各实例的内存中
+		fmt.Println("No per-user presence in Redis, it is only recorded when gateways run with cluster.role=gateway")
+		return nil
+	}
+	userIDs := make([]int64, 0, len(users))
+	for userID := range users {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	fmt.Printf("\n%d users connected to gateways:\n", len(users))
+	for _, userID := range userIDs {
+		fmt.Printf("user %d\tgateways=%s\n", userID, strings.Join(users[userID], ","))
+	}
+	return nil
+}
+
+// runRecomputeUnread 修正会话的最后消息和已读位置，并删除会话列表缓存使未读数重新统计
+func runRecomputeUnread(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("recompute-unread", flag.ContinueOnError)
+	userID := fs.Int64("user", 0, "只处理该用户的会话，0表示所有用户")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	result, err := services.NewConversationService().RecomputeUnread(ctx, *userID)
+	if result != nil {
+		fmt.Printf("Checked %d conversations of %d users, repaired %d\n", result.Conversations, result.Users, result.Repaired)
+	}
+	if err != nil {
+		return err
+	}
+	recordCLIAudit(ctx, &services.AuditEntry{
+		Action:     services.AuditActionRunJob,
+		TargetType: services.AuditTargetJob,
+		Detail:     map[string]interface{}{"job": "recompute_unread", "user_id": *userID, "repaired": result.Repaired},
+	})
+	return nil
+}
+
+// runDumpConfig 输出生效的配置
+func runDumpConfig(cfg *config.Config, args []string) error {
+	if err := parseFlags(flag.NewFlagSet("dump-config", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+	data, err := config.Dump(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
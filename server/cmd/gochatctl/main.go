@@ -0,0 +1,119 @@
+// gochatctl 运维命令行工具，与服务端共用配置和内部包，直接连接数据库和Redis执行管理操作，
+// 用于部署初始化，或HTTP管理接口不可用时（服务未启动、管理员账号被锁定）在服务器上处理问题
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"gochat/internal/buildinfo"
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/idgen"
+	"gochat/internal/logger"
+)
+
+// command 子命令，needsDB/needsRedis表示执行前需要连接的依赖
+type command struct {
+	summary    string
+	needsDB    bool
+	needsRedis bool
+	run        func(cfg *config.Config, args []string) error
+}
+
+var commands = map[string]command{
+	"create-admin":     {"创建带管理后台角色的用户", true, false, runCreateAdmin},
+	"reset-password":   {"重置用户密码，强制下线并解除登录锁定", true, true, runResetPassword},
+	"migrate":          {"执行数据库迁移", true, false, runMigrate},
+	"file-cleanup":     {"按保留策略过期文件引用并清理孤儿文件", true, true, runFileCleanup},
+	"online-users":     {"查看各实例的连接数和在线用户", false, true, runOnlineUsers},
+	"recompute-unread": {"修正会话的已读位置并重新统计未读数", true, true, runRecomputeUnread},
+	"dump-config":      {"输出生效的配置，隐藏密码和密钥", false, false, runDumpConfig},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: gochatctl [-config path] <command> [flags]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-18s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(out, "  %-18s %s\n\nRun 'gochatctl <command> -h' for command flags.\n\nGlobal flags:\n", "version", "打印版本信息")
+	flag.PrintDefaults()
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run 执行子命令并返回退出码，连接在返回前关闭
+func run() int {
+	configPath := flag.String("config", config.GetConfigPath(), "配置文件路径，与服务端使用同一份配置")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		return 2
+	}
+	name, args := flag.Arg(0), flag.Args()[1:]
+	if name == "version" {
+		fmt.Println(buildinfo.Get())
+		return 0
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		return 2
+	}
+
+	cfg, err := config.Init(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	// 服务内部的日志只输出到终端，不写入服务端的日志文件
+	if err := logger.Init(cfg.Log.Dir, cfg.Log.Level, "console"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+		return 1
+	}
+
+	if cmd.needsDB {
+		// 命令写入的消息使用保留的节点号，不与运行中的服务实例生成重复的ID
+		if err := idgen.Init(idgen.CommandNodeID); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to initialize message ID generator: %v\n", err)
+			return 1
+		}
+		if err := database.Init(&cfg.Database); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+			return 1
+		}
+		defer database.Close()
+	}
+	if cmd.needsRedis {
+		cache.Configure(&cfg.Cache)
+		if err := cache.Init(&cfg.Redis); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to connect to Redis: %v\n", err)
+			return 1
+		}
+		defer cache.Close()
+	}
+
+	if err := cmd.run(cfg, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
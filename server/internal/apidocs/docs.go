@@ -0,0 +1,432 @@
+package apidocs
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// methodOrder 同一路径下各方法的显示顺序
+var methodOrder = []string{"get", "post", "put", "patch", "delete"}
+
+var (
+	pageOnce sync.Once
+	page     []byte
+	pageErr  error
+)
+
+// Page 返回由规范渲染的HTML文档页面，不依赖外部脚本和样式
+func Page() ([]byte, error) {
+	pageOnce.Do(func() {
+		var doc document
+		if pageErr = json.Unmarshal(spec, &doc); pageErr != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if pageErr = pageTemplate.Execute(&buf, buildView(&doc)); pageErr == nil {
+			page = buf.Bytes()
+		}
+	})
+	return page, pageErr
+}
+
+// document 渲染文档页面用到的规范字段
+type document struct {
+	Info struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description"`
+	} `json:"info"`
+	Servers []struct {
+		URL         string `json:"url"`
+		Description string `json:"description"`
+	} `json:"servers"`
+	Tags []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	} `json:"tags"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Parameters map[string]parameterSpec `json:"parameters"`
+		Responses  map[string]responseSpec  `json:"responses"`
+		Schemas    map[string]schemaSpec    `json:"schemas"`
+	} `json:"components"`
+}
+
+type operationSpec struct {
+	Tags        []string                `json:"tags"`
+	Summary     string                  `json:"summary"`
+	Description string                  `json:"description"`
+	Deprecated  bool                    `json:"deprecated"`
+	Security    *[]map[string][]string  `json:"security"`
+	Parameters  []parameterSpec         `json:"parameters"`
+	RequestBody *requestBodySpec        `json:"requestBody"`
+	Responses   map[string]responseSpec `json:"responses"`
+}
+
+type parameterSpec struct {
+	Ref         string      `json:"$ref"`
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Required    bool        `json:"required"`
+	Description string      `json:"description"`
+	Schema      *schemaSpec `json:"schema"`
+}
+
+type requestBodySpec struct {
+	Required bool                     `json:"required"`
+	Content  map[string]mediaTypeSpec `json:"content"`
+}
+
+type responseSpec struct {
+	Ref         string                   `json:"$ref"`
+	Description string                   `json:"description"`
+	Content     map[string]mediaTypeSpec `json:"content"`
+}
+
+type mediaTypeSpec struct {
+	Schema *schemaSpec `json:"schema"`
+}
+
+type schemaSpec struct {
+	Ref         string                 `json:"$ref"`
+	Type        string                 `json:"type"`
+	Format      string                 `json:"format"`
+	Description string                 `json:"description"`
+	Items       *schemaSpec            `json:"items"`
+	Properties  map[string]*schemaSpec `json:"properties"`
+	Required    []string               `json:"required"`
+	Enum        []interface{}          `json:"enum"`
+	AllOf       []*schemaSpec          `json:"allOf"`
+	OneOf       []*schemaSpec          `json:"oneOf"`
+}
+
+// 页面的视图数据
+type (
+	view struct {
+		Title       string
+		Version     string
+		Description string
+		Servers     []string
+		Tags        []tagView
+		Schemas     []schemaView
+	}
+	tagView struct {
+		Name        string
+		Description string
+		Operations  []operationView
+	}
+	operationView struct {
+		ID          string
+		Method      string
+		Path        string
+		Summary     string
+		Description string
+		Deprecated  bool
+		Public      bool // 不需要认证
+		Parameters  []fieldView
+		RequestBody []bodyView
+		Responses   []responseView
+	}
+	fieldView struct {
+		Name        string
+		In          string
+		Type        typeView
+		Required    bool
+		Description string
+	}
+	bodyView struct {
+		ContentType string
+		Type        typeView
+		Properties  []fieldView // 内联的对象模型
+	}
+	responseView struct {
+		Code        string
+		Description string
+		Type        typeView
+	}
+	schemaView struct {
+		Name        string
+		Description string
+		Properties  []fieldView
+	}
+	// typeView 类型说明，Ref不为空时链接到对应的模型
+	typeView struct {
+		Text string
+		Ref  string
+	}
+)
+
+func buildView(doc *document) *view {
+	v := &view{Title: doc.Info.Title, Version: doc.Info.Version, Description: doc.Info.Description}
+	for _, server := range doc.Servers {
+		v.Servers = append(v.Servers, server.URL)
+	}
+
+	byTag := make(map[string][]operationView)
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := doc.Paths[path]
+		var shared []parameterSpec
+		if raw, ok := item["parameters"]; ok {
+			json.Unmarshal(raw, &shared)
+		}
+		for _, method := range methodOrder {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op operationSpec
+			if err := json.Unmarshal(raw, &op); err != nil {
+				continue
+			}
+			tag := "Other"
+			if len(op.Tags) > 0 {
+				tag = op.Tags[0]
+			}
+			byTag[tag] = append(byTag[tag], buildOperation(doc, method, path, &op, shared))
+		}
+	}
+
+	for _, tag := range doc.Tags {
+		if ops := byTag[tag.Name]; len(ops) > 0 {
+			v.Tags = append(v.Tags, tagView{Name: tag.Name, Description: tag.Description, Operations: ops})
+			delete(byTag, tag.Name)
+		}
+	}
+	// 未在tags中声明的标签排在最后
+	rest := make([]string, 0, len(byTag))
+	for name := range byTag {
+		rest = append(rest, name)
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		v.Tags = append(v.Tags, tagView{Name: name, Operations: byTag[name]})
+	}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := doc.Components.Schemas[name]
+		v.Schemas = append(v.Schemas, schemaView{Name: name, Description: schema.Description, Properties: properties(&schema)})
+	}
+	return v
+}
+
+func buildOperation(doc *document, method, path string, op *operationSpec, shared []parameterSpec) operationView {
+	view := operationView{
+		ID:          method + "-" + strings.Trim(strings.NewReplacer("/", "-", "{", "", "}", "").Replace(path), "-"),
+		Method:      strings.ToUpper(method),
+		Path:        path,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Deprecated:  op.Deprecated,
+		Public:      op.Security != nil && len(*op.Security) == 0,
+	}
+	for _, param := range append(shared, op.Parameters...) {
+		if param.Ref != "" {
+			param = doc.Components.Parameters[refName(param.Ref)]
+		}
+		view.Parameters = append(view.Parameters, fieldView{
+			Name:        param.Name,
+			In:          param.In,
+			Type:        describe(param.Schema),
+			Required:    param.Required,
+			Description: param.Description,
+		})
+	}
+	if op.RequestBody != nil {
+		for _, contentType := range sortedKeys(op.RequestBody.Content) {
+			schema := op.RequestBody.Content[contentType].Schema
+			body := bodyView{ContentType: contentType, Type: describe(schema)}
+			if schema != nil && schema.Ref == "" {
+				body.Properties = properties(schema)
+			}
+			view.RequestBody = append(view.RequestBody, body)
+		}
+	}
+	for _, code := range sortedKeys(op.Responses) {
+		response := op.Responses[code]
+		if response.Ref != "" {
+			response = doc.Components.Responses[refName(response.Ref)]
+		}
+		rv := responseView{Code: code, Description: response.Description}
+		if media, ok := response.Content["application/json"]; ok {
+			rv.Type = describe(media.Schema)
+		}
+		view.Responses = append(view.Responses, rv)
+	}
+	return view
+}
+
+// properties 对象模型的属性列表，按名称排序；allOf中各部分的属性合并显示
+func properties(schema *schemaSpec) []fieldView {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	props := make(map[string]*schemaSpec, len(schema.Properties))
+	for name, prop := range schema.Properties {
+		props[name] = prop
+	}
+	for _, part := range schema.AllOf {
+		for name, prop := range part.Properties {
+			props[name] = prop
+		}
+		for _, name := range part.Required {
+			required[name] = true
+		}
+	}
+	fields := make([]fieldView, 0, len(props))
+	for _, name := range sortedKeys(props) {
+		prop := props[name]
+		fields = append(fields, fieldView{Name: name, Type: describe(prop), Required: required[name], Description: prop.Description})
+	}
+	return fields
+}
+
+// describe 生成类型说明，如integer (int64)、array of Message
+func describe(schema *schemaSpec) typeView {
+	switch {
+	case schema == nil:
+		return typeView{}
+	case schema.Ref != "":
+		name := refName(schema.Ref)
+		return typeView{Text: name, Ref: name}
+	case schema.Type == "array":
+		item := describe(schema.Items)
+		item.Text = "array of " + item.Text
+		return item
+	case len(schema.AllOf) > 0:
+		// 常见写法：allOf引用统一响应结构后覆盖data字段
+		for _, part := range schema.AllOf {
+			if data, ok := part.Properties["data"]; ok {
+				return describe(data)
+			}
+		}
+		return describe(schema.AllOf[0])
+	case len(schema.OneOf) > 0:
+		texts := make([]string, 0, len(schema.OneOf))
+		for _, part := range schema.OneOf {
+			texts = append(texts, describe(part).Text)
+		}
+		return typeView{Text: strings.Join(texts, " | ")}
+	}
+	text := schema.Type
+	if schema.Format != "" {
+		text += " (" + schema.Format + ")"
+	}
+	return typeView{Text: text}
+}
+
+// refName 取$ref的最后一段，如#/components/schemas/User中的User
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var pageTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{"lower": strings.ToLower}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} {{.Version}}</title>
+<style>
+body{margin:0;font:14px/1.5 -apple-system,BlinkMacSystemFont,"Segoe UI",Roboto,"PingFang SC","Microsoft YaHei",sans-serif;color:#1f2328;display:flex}
+nav{position:sticky;top:0;height:100vh;overflow:auto;width:260px;flex:none;background:#f6f8fa;border-right:1px solid #d0d7de;padding:16px;box-sizing:border-box}
+nav a{display:block;color:#1f2328;text-decoration:none;padding:2px 0}
+nav a:hover{color:#0969da}
+nav .tag{font-weight:600;margin-top:12px}
+nav .op{font-size:12px;padding-left:8px;white-space:nowrap;overflow:hidden;text-overflow:ellipsis}
+main{flex:1;min-width:0;padding:24px 40px;max-width:1100px}
+h1{margin-top:0}
+h2{border-bottom:1px solid #d0d7de;padding-bottom:6px;margin-top:40px}
+pre.intro{white-space:pre-wrap;font:inherit;background:#f6f8fa;padding:12px;border-radius:6px}
+details{border:1px solid #d0d7de;border-radius:6px;margin:8px 0}
+summary{cursor:pointer;padding:8px 12px;list-style:none}
+summary::-webkit-details-marker{display:none}
+details[open] summary{border-bottom:1px solid #d0d7de}
+.body{padding:8px 16px}
+.method{display:inline-block;width:64px;text-align:center;font-weight:600;font-size:12px;color:#fff;border-radius:4px;padding:2px 0;margin-right:8px}
+.get{background:#1f883d}.post{background:#0969da}.put{background:#9a6700}.patch{background:#8250df}.delete{background:#cf222e}
+.path{font-family:ui-monospace,SFMono-Regular,Menlo,monospace}
+.badge{font-size:11px;border:1px solid #d0d7de;border-radius:10px;padding:0 6px;margin-left:6px;color:#59636e}
+.deprecated .path{text-decoration:line-through}
+.desc{white-space:pre-wrap}
+table{border-collapse:collapse;width:100%;margin:8px 0}
+th,td{text-align:left;border-bottom:1px solid #eaeef2;padding:4px 8px;vertical-align:top}
+th{font-size:12px;color:#59636e}
+code{font-family:ui-monospace,SFMono-Regular,Menlo,monospace;font-size:13px}
+.req{color:#cf222e}
+</style>
+</head>
+<body>
+<nav>
+<a href="#top"><strong>{{.Title}}</strong></a>
+<a href="/api/v1/openapi.json">openapi.json</a>
+{{range .Tags}}<a class="tag" href="#tag-{{.Name}}">{{.Name}}</a>
+{{range .Operations}}<a class="op" href="#{{.ID}}">{{.Method}} {{.Path}}</a>
+{{end}}{{end}}<a class="tag" href="#schemas">Schemas</a>
+</nav>
+<main id="top">
+<h1>{{.Title}} <small>{{.Version}}</small></h1>
+<p>Servers: {{range $i, $s := .Servers}}{{if $i}}, {{end}}<code>{{$s}}</code>{{end}}</p>
+<pre class="intro">{{.Description}}</pre>
+{{range .Tags}}
+<h2 id="tag-{{.Name}}">{{.Name}}</h2>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+{{range .Operations}}
+<details id="{{.ID}}"{{if .Deprecated}} class="deprecated"{{end}}>
+<summary><span class="method {{.Method | lower}}">{{.Method}}</span><span class="path">{{.Path}}</span> {{.Summary}}{{if .Public}}<span class="badge">no auth</span>{{end}}{{if .Deprecated}}<span class="badge">deprecated</span>{{end}}</summary>
+<div class="body">
+{{if .Description}}<p class="desc">{{.Description}}</p>{{end}}
+{{if .Parameters}}<h4>Parameters</h4>
+<table><tr><th>Name</th><th>In</th><th>Type</th><th>Description</th></tr>
+{{range .Parameters}}<tr><td><code>{{.Name}}</code>{{if .Required}} <span class="req">*</span>{{end}}</td><td>{{.In}}</td><td>{{template "type" .Type}}</td><td class="desc">{{.Description}}</td></tr>
+{{end}}</table>{{end}}
+{{range .RequestBody}}<h4>Request body <code>{{.ContentType}}</code></h4>
+{{if .Properties}}<table><tr><th>Field</th><th>Type</th><th>Description</th></tr>
+{{range .Properties}}<tr><td><code>{{.Name}}</code>{{if .Required}} <span class="req">*</span>{{end}}</td><td>{{template "type" .Type}}</td><td class="desc">{{.Description}}</td></tr>
+{{end}}</table>{{else}}<p>{{template "type" .Type}}</p>{{end}}
+{{end}}
+<h4>Responses</h4>
+<table><tr><th>Code</th><th>Description</th><th>Schema</th></tr>
+{{range .Responses}}<tr><td><code>{{.Code}}</code></td><td class="desc">{{.Description}}</td><td>{{template "type" .Type}}</td></tr>
+{{end}}</table>
+</div>
+</details>
+{{end}}{{end}}
+<h2 id="schemas">Schemas</h2>
+{{range .Schemas}}
+<details id="schema-{{.Name}}">
+<summary><strong>{{.Name}}</strong></summary>
+<div class="body">
+{{if .Description}}<p class="desc">{{.Description}}</p>{{end}}
+<table><tr><th>Field</th><th>Type</th><th>Description</th></tr>
+{{range .Properties}}<tr><td><code>{{.Name}}</code>{{if .Required}} <span class="req">*</span>{{end}}</td><td>{{template "type" .Type}}</td><td class="desc">{{.Description}}</td></tr>
+{{end}}</table>
+</div>
+</details>
+{{end}}
+</main>
+</body>
+</html>
+{{define "type"}}{{if .Ref}}<a href="#schema-{{.Ref}}">{{.Text}}</a>{{else}}<code>{{.Text}}</code>{{end}}{{end}}`))
@@ -0,0 +1,29 @@
+// gen 把仓库根目录的api.yaml转换为JSON，写入apidocs包随程序一起编译
+// 在server目录执行 go generate ./internal/apidocs
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"gochat/internal/apidocs"
+)
+
+func main() {
+	in := flag.String("in", "../../../api.yaml", "OpenAPI YAML文件")
+	out := flag.String("out", "openapi.json", "输出的JSON文件")
+	flag.Parse()
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	spec, err := apidocs.Convert(data)
+	if err != nil {
+		log.Fatalf("%s: %v", *in, err)
+	}
+	if err := os.WriteFile(*out, spec, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,61 @@
+// Package apidocs 提供OpenAPI规范和文档页面
+// 规范以仓库根目录的api.yaml为准，构建前由go generate转换为openapi.json嵌入程序，修改api.yaml后需重新生成
+package apidocs
+
+//go:generate go run ./gen -in ../../../api.yaml -out openapi.json
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec 返回JSON格式的OpenAPI规范
+func Spec() []byte {
+	return spec
+}
+
+// Convert 把YAML格式的规范转换为缩进的JSON，非字符串的键（如响应码200）转为字符串
+func Convert(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(normalize(doc)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// normalize 把YAML解码出的map[interface{}]interface{}转为JSON可以编码的map[string]interface{}
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = normalize(value)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalize(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = normalize(value)
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,116 @@
+package apidocs
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+	"gochat/internal/services"
+)
+
+// schemaTypes 规范中的schema与接口实际返回或接收的结构体，schema的属性必须与这些结构体的JSON字段（取并集）一致
+var schemaTypes = map[string][]interface{}{
+	"User":                {services.UserInfo{}, models.User{}}, // 本人资料和其他用户的资料
+	"Message":             {services.MessageInfo{}},
+	"SearchResults":       {services.SearchResults{}},
+	"Call":                {services.CallInfo{}},
+	"ICEServers":          {services.ICEServers{}},
+	"Bot":                 {models.Bot{}},
+	"BotCredentials":      {services.BotCredentials{}},
+	"BotRequest":          {services.BotRequest{}},
+	"AdminUser":           {services.AdminUserInfo{}},
+	"AdminGroup":          {services.AdminGroupInfo{}},
+	"MaintenanceJob":      {services.MaintenanceJob{}},
+	"Report":              {models.Report{}},
+	"Conversation":        {services.ConversationInfo{}},
+	"DataExport":          {models.DataExport{}},
+	"UploadSession":       {services.UploadSession{}},
+	"Announcement":        {services.AnnouncementInfo{}},
+	"AnnouncementRequest": {services.AnnouncementRequest{}},
+	"AdminAnnouncement":   {services.AnnouncementAdminInfo{}},
+}
+
+func TestSpecUpToDate(t *testing.T) {
+	source, err := os.ReadFile("../../../api.yaml")
+	if os.IsNotExist(err) {
+		t.Skip("api.yaml not found")
+	}
+	require.NoError(t, err)
+	converted, err := Convert(source)
+	require.NoError(t, err)
+	assert.True(t, string(converted) == string(Spec()), "openapi.json is out of date, run go generate ./internal/apidocs")
+}
+
+func TestSchemasMatchStructs(t *testing.T) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+				Required   []string                   `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(Spec(), &doc))
+
+	for name, values := range schemaTypes {
+		schema, ok := doc.Components.Schemas[name]
+		if !assert.True(t, ok, "schema %s not found", name) {
+			continue
+		}
+		fields := make(map[string]bool)
+		for _, value := range values {
+			for field := range jsonFields(reflect.TypeOf(value)) {
+				fields[field] = true
+			}
+		}
+		var undocumented, unknown []string
+		for field := range fields {
+			if _, ok := schema.Properties[field]; !ok {
+				undocumented = append(undocumented, field)
+			}
+		}
+		for property := range schema.Properties {
+			if !fields[property] {
+				unknown = append(unknown, property)
+			}
+		}
+		sort.Strings(undocumented)
+		sort.Strings(unknown)
+		assert.Empty(t, undocumented, "%s: struct fields missing from the schema", name)
+		assert.Empty(t, unknown, "%s: schema properties not in the structs", name)
+		for _, property := range schema.Required {
+			assert.True(t, fields[property], "%s: required property %s not in the structs", name, property)
+		}
+	}
+}
+
+// jsonFields 结构体编码为JSON时的字段名，包括嵌入结构体的字段
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded := range jsonFields(field.Type) {
+				fields[embedded] = true
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = true
+	}
+	return fields
+}
@@ -0,0 +1,257 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+)
+
+// State 熔断器状态
+type State int
+
+const (
+	StateClosed   State = iota // 正常放行
+	StateHalfOpen              // 放行少量试探请求，全部成功后恢复
+	StateOpen                  // 熔断，请求直接失败
+)
+
+// String 状态名称
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "open"
+	}
+}
+
+// ErrOpen 熔断期间请求被拒绝，调用方应按依赖不可用处理（如跳过缓存）
+var ErrOpen = errors.New("circuit breaker is open")
+
+// 熔断器指标
+var (
+	stateGauge    = metrics.NewGaugeVec("circuit_breaker_state", "熔断器状态: 0-closed 1-half_open 2-open", "name")
+	openedTotal   = metrics.NewCounterVec("circuit_breaker_opened_total", "熔断次数", "name")
+	rejectedTotal = metrics.NewCounterVec("circuit_breaker_rejected_total", "熔断期间被拒绝的请求数", "name")
+	probeFailures = metrics.NewCounterVec("circuit_breaker_probe_failures_total", "熔断期间主动探测失败次数", "name")
+	registryMu    sync.RWMutex
+	registry      = make(map[string]*Breaker)
+)
+
+// Settings 熔断参数
+type Settings struct {
+	FailureThreshold int           // 连续失败达到该次数后熔断
+	OpenTimeout      time.Duration // 熔断持续时间，之后进入半开状态
+	HalfOpenRequests int           // 半开状态放行的试探请求数
+	ProbeInterval    time.Duration // 熔断期间主动探测的间隔，探测成功后提前进入半开状态
+}
+
+// ProbeFunc 探测依赖是否恢复，如Redis PING、数据库Ping
+type ProbeFunc func(ctx context.Context) error
+
+type probeKey struct{}
+
+// IsProbe ctx是否来自主动探测，依赖上的熔断钩子需要放行探测请求
+func IsProbe(ctx context.Context) bool {
+	probe, _ := ctx.Value(probeKey{}).(bool)
+	return probe
+}
+
+// Breaker 熔断器
+// 依赖连续出错达到阈值后熔断，期间请求直接返回ErrOpen而不是逐个等待超时；
+// 熔断open_timeout后或主动探测成功后进入半开状态，试探请求全部成功则恢复，任一失败则重新熔断
+type Breaker struct {
+	name     string
+	settings Settings
+	probe    ProbeFunc
+
+	mu         sync.Mutex
+	state      State
+	generation uint64 // 每次状态变化加一，旧状态下放行的请求结果不再计入
+	failures   int
+	openedAt   time.Time
+	inFlight   int // 半开状态下未完成的试探请求
+	successes  int // 半开状态下成功的试探请求
+	now        func() time.Time
+}
+
+// New 创建熔断器并注册到全局列表，同名熔断器会被替换
+// probe不为nil时，熔断期间每隔ProbeInterval主动探测依赖
+func New(name string, settings Settings, probe ProbeFunc) *Breaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = 5
+	}
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = 1
+	}
+	b := &Breaker{name: name, settings: settings, probe: probe, now: time.Now}
+	stateGauge.WithLabelValues(name).Set(int64(StateClosed))
+
+	registryMu.Lock()
+	registry[name] = b
+	registryMu.Unlock()
+	return b
+}
+
+// NewFromConfig 按配置创建熔断器，未启用时返回nil（nil熔断器放行所有请求），配置已在加载时校验
+func NewFromConfig(name string, cfg *config.CircuitBreakerConfig, probe ProbeFunc) *Breaker {
+	if !cfg.Enabled {
+		return nil
+	}
+	settings := Settings{
+		FailureThreshold: cfg.FailureThreshold,
+		HalfOpenRequests: cfg.HalfOpenRequests,
+	}
+	settings.OpenTimeout, _ = time.ParseDuration(cfg.OpenTimeout)
+	settings.ProbeInterval, _ = time.ParseDuration(cfg.ProbeInterval)
+	return New(name, settings, probe)
+}
+
+// States 所有熔断器的当前状态
+func States() map[string]State {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	states := make(map[string]State, len(registry))
+	for name, b := range registry {
+		states[name] = b.State()
+	}
+	return states
+}
+
+// Name 熔断器名称
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State 当前状态，熔断已到期时返回半开
+func (b *Breaker) State() State {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.settings.OpenTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// IsOpen 是否处于熔断状态（nil熔断器视为关闭）
+func (b *Breaker) IsOpen() bool {
+	return b.State() == StateOpen
+}
+
+// Allow 请求依赖前调用，熔断时返回ErrOpen；放行时返回done，请求完成后必须调用一次，failed表示依赖出错
+func (b *Breaker) Allow() (done func(failed bool), err error) {
+	if b == nil {
+		return func(bool) {}, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.settings.OpenTimeout {
+		b.setState(StateHalfOpen)
+	}
+	switch b.state {
+	case StateOpen:
+		rejectedTotal.WithLabelValues(b.name).Inc()
+		return nil, ErrOpen
+	case StateHalfOpen:
+		if b.inFlight >= b.settings.HalfOpenRequests {
+			rejectedTotal.WithLabelValues(b.name).Inc()
+			return nil, ErrOpen
+		}
+		b.inFlight++
+	}
+
+	generation := b.generation
+	var once sync.Once
+	return func(failed bool) {
+		once.Do(func() { b.record(generation, failed) })
+	}, nil
+}
+
+// record 记录请求结果
+func (b *Breaker) record(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case StateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.settings.FailureThreshold {
+			b.open()
+		}
+	case StateHalfOpen:
+		b.inFlight--
+		if failed {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenRequests {
+			b.setState(StateClosed)
+			logger.GetLogger().Infof("依赖 %s 已恢复，熔断关闭", b.name)
+		}
+	}
+}
+
+// open 进入熔断状态，调用方持有锁
+func (b *Breaker) open() {
+	b.setState(StateOpen)
+	b.openedAt = b.now()
+	openedTotal.WithLabelValues(b.name).Inc()
+	logger.GetLogger().Errorf("依赖 %s 连续出错，熔断%v", b.name, b.settings.OpenTimeout)
+	if b.probe != nil && b.settings.ProbeInterval > 0 {
+		go b.probeLoop(b.generation)
+	}
+}
+
+// setState 切换状态并重置计数，调用方持有锁
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.inFlight = 0
+	b.successes = 0
+	stateGauge.WithLabelValues(b.name).Set(int64(state))
+}
+
+// probeLoop 熔断期间定期探测依赖，探测成功后提前进入半开状态；状态变化后退出
+func (b *Breaker) probeLoop(generation uint64) {
+	ticker := time.NewTicker(b.settings.ProbeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), probeKey{}, true), b.settings.ProbeInterval)
+		err := b.probe(ctx)
+		cancel()
+
+		b.mu.Lock()
+		if b.generation != generation || b.state != StateOpen {
+			b.mu.Unlock()
+			return
+		}
+		if err == nil {
+			b.setState(StateHalfOpen)
+			b.mu.Unlock()
+			logger.GetLogger().Infof("依赖 %s 探测成功，进入半开状态", b.name)
+			return
+		}
+		b.mu.Unlock()
+		probeFailures.WithLabelValues(b.name).Inc()
+	}
+}
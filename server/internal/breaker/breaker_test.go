@@ -0,0 +1,119 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBreaker(t *testing.T, probe ProbeFunc, probeInterval time.Duration) (*Breaker, *time.Time) {
+	t.Helper()
+	b := New("test_"+t.Name(), Settings{
+		FailureThreshold: 3,
+		OpenTimeout:      10 * time.Second,
+		HalfOpenRequests: 2,
+		ProbeInterval:    probeInterval,
+	}, probe)
+	current := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return current }
+	return b, &current
+}
+
+func call(t *testing.T, b *Breaker, failed bool) {
+	t.Helper()
+	done, err := b.Allow()
+	require.NoError(t, err)
+	done(failed)
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(t, nil, 0)
+
+	call(t, b, true)
+	call(t, b, true)
+	call(t, b, false) // 成功后重新计数
+	call(t, b, true)
+	call(t, b, true)
+	assert.Equal(t, StateClosed, b.State())
+
+	call(t, b, true)
+	assert.Equal(t, StateOpen, b.State())
+	_, err := b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+}
+
+func TestBreakerHalfOpenRecovery(t *testing.T) {
+	b, now := newTestBreaker(t, nil, 0)
+	for i := 0; i < 3; i++ {
+		call(t, b, true)
+	}
+
+	*now = now.Add(10 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	first, err := b.Allow()
+	require.NoError(t, err)
+	second, err := b.Allow()
+	require.NoError(t, err)
+	// 试探请求数已满
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	first(false)
+	second(false)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b, now := newTestBreaker(t, nil, 0)
+	for i := 0; i < 3; i++ {
+		call(t, b, true)
+	}
+	*now = now.Add(10 * time.Second)
+
+	call(t, b, true)
+	assert.Equal(t, StateOpen, b.State())
+
+	// 熔断前放行的请求结果不影响新状态
+	*now = now.Add(10 * time.Second)
+	stale, err := b.Allow()
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		call(t, b, false)
+	}
+	stale(true)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerProbe(t *testing.T) {
+	var healthy atomic.Bool
+	b, _ := newTestBreaker(t, func(ctx context.Context) error {
+		assert.True(t, IsProbe(ctx))
+		if healthy.Load() {
+			return nil
+		}
+		return errors.New("down")
+	}, 10*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		call(t, b, true)
+	}
+	assert.Equal(t, StateOpen, b.State())
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return b.State() == StateHalfOpen }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, StateHalfOpen, States()[b.Name()])
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker
+	done, err := b.Allow()
+	require.NoError(t, err)
+	done(true)
+	assert.False(t, b.IsOpen())
+}
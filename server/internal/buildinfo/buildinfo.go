@@ -0,0 +1,84 @@
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"gochat/internal/metrics"
+)
+
+// 构建信息，构建时通过-ldflags设置，如：
+//
+//	go build -ldflags "-X gochat/internal/buildinfo.Version=v1.2.0 \
+//	  -X gochat/internal/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//	  -X gochat/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// 未设置Commit和BuildTime时使用go build记录的VCS信息（提交和提交时间），go run等没有VCS信息时为unknown
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// unknown 无法获取提交或构建时间时的值
+const unknown = "unknown"
+
+// Info 构建信息
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	// Modified 构建时工作区有未提交的修改，只在使用VCS信息时可知
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+var info Info
+
+// buildInfoGauge 构建信息指标，值恒为1，便于在监控中按版本区分实例
+var buildInfoGauge = metrics.NewGaugeVec("build_info", "构建信息，值恒为1", "version", "commit", "go_version")
+
+func init() {
+	info = Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+					if len(info.Commit) > 12 {
+						info.Commit = info.Commit[:12]
+					}
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true" && Commit == ""
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = unknown
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = unknown
+	}
+	buildInfoGauge.WithLabelValues(info.Version, info.Commit, info.GoVersion).Set(1)
+}
+
+// Get 返回构建信息
+func Get() Info {
+	return info
+}
+
+// String 用于启动日志，如 v1.2.0 (commit 3f2a1c9, built 2026-10-01T08:00:00Z, go1.25.1)
+func (i Info) String() string {
+	commit := i.Commit
+	if i.Modified {
+		commit += "-dirty"
+	}
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", i.Version, commit, i.BuildTime, i.GoVersion)
+}
@@ -0,0 +1,24 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	info := Get()
+	assert.Equal(t, "dev", info.Version)
+	assert.NotEmpty(t, info.Commit)
+	assert.NotEmpty(t, info.BuildTime)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+}
+
+func TestInfoString(t *testing.T) {
+	info := Info{Version: "v1.2.0", Commit: "3f2a1c9", BuildTime: "2026-10-01T08:00:00Z", GoVersion: "go1.25.1"}
+	assert.Equal(t, "v1.2.0 (commit 3f2a1c9, built 2026-10-01T08:00:00Z, go1.25.1)", info.String())
+
+	info.Modified = true
+	assert.Equal(t, "v1.2.0 (commit 3f2a1c9-dirty, built 2026-10-01T08:00:00Z, go1.25.1)", info.String())
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+
+	"gochat/internal/breaker"
+)
+
+// redisBreaker Redis熔断器，未启用时为nil
+var redisBreaker *breaker.Breaker
+
+// breakerDoneKey context中保存请求完成回调的键
+type breakerDoneKey struct{}
+
+// breakerHook 在每条Redis命令和每个管道前检查熔断器
+// 熔断期间命令直接返回breaker.ErrOpen，读缓存的调用方按未命中处理并回源数据库，写缓存的错误本来就被忽略
+type breakerHook struct {
+	breaker *breaker.Breaker
+}
+
+// newBreakerHook 创建熔断钩子
+func newBreakerHook(b *breaker.Breaker) *breakerHook {
+	return &breakerHook{breaker: b}
+}
+
+// IsCircuitOpen Redis是否处于熔断状态
+func IsCircuitOpen() bool {
+	return redisBreaker.IsOpen()
+}
+
+func (h *breakerHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.before(ctx)
+}
+
+func (h *breakerHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.after(ctx, cmd.Err())
+	return nil
+}
+
+func (h *breakerHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return h.before(ctx)
+}
+
+func (h *breakerHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if isRedisFailure(cmd.Err()) {
+			err = cmd.Err()
+			break
+		}
+	}
+	h.after(ctx, err)
+	return nil
+}
+
+// before 熔断时拒绝请求，放行时把完成回调放入context；主动探测的请求不经过熔断器
+func (h *breakerHook) before(ctx context.Context) (context.Context, error) {
+	if breaker.IsProbe(ctx) {
+		return ctx, nil
+	}
+	done, err := h.breaker.Allow()
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, breakerDoneKey{}, done), nil
+}
+
+// after 记录请求结果，被拒绝的请求context中没有回调
+func (h *breakerHook) after(ctx context.Context, err error) {
+	if done, ok := ctx.Value(breakerDoneKey{}).(func(bool)); ok {
+		done(isRedisFailure(err))
+	}
+}
+
+// isRedisFailure 是否为Redis不可用导致的错误
+// 键不存在和Redis返回的错误回复（如WRONGTYPE）说明服务正常，调用方取消请求也不计入
+func isRedisFailure(err error) bool {
+	if err == nil || err == redis.Nil || errors.Is(err, context.Canceled) || errors.Is(err, breaker.ErrOpen) {
+		return false
+	}
+	var replyErr redis.Error
+	return !errors.As(err, &replyErr)
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/breaker"
+)
+
+func TestBreakerHookFailsFastWhileRedisIsDown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer client.Close()
+	b := breaker.New("redis_test", breaker.Settings{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+		HalfOpenRequests: 1,
+		ProbeInterval:    10 * time.Millisecond,
+	}, func(ctx context.Context) error { return client.Ping(ctx).Err() })
+	client.AddHook(newBreakerHook(b))
+	ctx := context.Background()
+
+	// 键不存在和错误回复不计为故障
+	assert.Equal(t, redis.Nil, client.Get(ctx, "missing").Err())
+	require.NoError(t, client.Set(ctx, "list", "x", 0).Err())
+	assert.Error(t, client.LPush(ctx, "list", "y").Err())
+	assert.Equal(t, breaker.StateClosed, b.State())
+
+	mr.Close()
+	for i := 0; i < 2; i++ {
+		assert.Error(t, client.Get(ctx, "key").Err())
+	}
+	assert.Equal(t, breaker.StateOpen, b.State())
+	assert.ErrorIs(t, client.Get(ctx, "key").Err(), breaker.ErrOpen)
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Get(ctx, "key")
+		return nil
+	})
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+
+	// 恢复后主动探测成功，试探请求成功后关闭熔断
+	require.NoError(t, mr.Restart())
+	assert.Eventually(t, func() bool { return b.State() == breaker.StateHalfOpen }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, redis.Nil, client.Get(ctx, "key").Err())
+	assert.Equal(t, breaker.StateClosed, b.State())
+}
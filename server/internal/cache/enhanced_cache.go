@@ -37,7 +37,7 @@ const (
 
 	// 消息缓存
 	PrivateMessagesPrefix = "msg:private:"    // msg:private:123:456:1:20
-	GroupMessagesPrefix   = "msg:group:"      // msg:group:789:1:20
+	GroupMessagesPrefix   = "msg:group:"      // msg:group:789:123:1:20
 	UnreadCountPrefix     = "unread:count:"   // unread:count:123:456
 	LastMessagePrefix     = "last:msg:"       // last:msg:123:456
 
@@ -54,10 +54,10 @@ const (
 
 	// 统计缓存
 	OnlineCountPrefix     = "stats:online"    // stats:online
-	MessageStatsPrefix    = "stats:msg:"      // stats:msg:daily:20231201
+	MessageStatsPrefix    = "stats:msg:"      // stats:msg:20231201 当天（UTC）的消息数
 )
 
-// 缓存过期时间常量
+// 缓存默认过期时间，可通过配置文件的cache.families覆盖
 const (
 	UserProfileTTL       = 30 * time.Minute  // 用户资料缓存30分钟
 	UserFriendsTTL       = 15 * time.Minute  // 好友列表缓存15分钟
@@ -67,6 +67,7 @@ const (
 	OnlineStatusTTL      = 1 * time.Minute   // 在线状态缓存1分钟
 	FileInfoTTL          = 60 * time.Minute  // 文件信息缓存1小时
 	StatsTTL             = 5 * time.Minute   // 统计数据缓存5分钟
+	DailyStatsTTL        = 400 * 24 * time.Hour // 每日统计计数保留400天
 	ShortTTL             = 30 * time.Second  // 短期缓存30秒
 )
 
@@ -79,13 +80,13 @@ func (c *CacheService) CacheUserProfile(userID int64, profile *models.User) erro
 	if err != nil {
 		return err
 	}
-	return c.client.Set(c.ctx, key, data, UserProfileTTL).Err()
+	return c.set(familyUserProfile, key, data, UserTag(userID))
 }
 
 // GetUserProfile 获取缓存的用户资料
 func (c *CacheService) GetUserProfile(userID int64) (*models.User, error) {
 	key := UserProfilePrefix + strconv.FormatInt(userID, 10)
-	data, err := c.client.Get(c.ctx, key).Result()
+	data, err := c.get(familyUserProfile, key)
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil // 缓存未命中
@@ -101,13 +102,13 @@ func (c *CacheService) GetUserProfile(userID int64) (*models.User, error) {
 // CacheUserByPhone 缓存通过手机号查找的用户
 func (c *CacheService) CacheUserByPhone(phone string, userID int64) error {
 	key := UserByPhonePrefix + phone
-	return c.client.Set(c.ctx, key, userID, UserProfileTTL).Err()
+	return c.set(familyUserPhone, key, userID, UserTag(userID))
 }
 
 // GetUserByPhone 通过手机号获取用户ID
 func (c *CacheService) GetUserByPhone(phone string) (int64, error) {
 	key := UserByPhonePrefix + phone
-	result, err := c.client.Get(c.ctx, key).Result()
+	result, err := c.get(familyUserPhone, key)
 	if err != nil {
 		if err == redis.Nil {
 			return 0, nil
@@ -117,14 +118,64 @@ func (c *CacheService) GetUserByPhone(phone string) (int64, error) {
 	return strconv.ParseInt(result, 10, 64)
 }
 
-// InvalidateUserCache 删除用户相关缓存
+// CacheFriendIDs 缓存好友ID列表
+func (c *CacheService) CacheFriendIDs(userID int64, friendIDs []int64) error {
+	key := UserFriendsPrefix + strconv.FormatInt(userID, 10)
+	if friendIDs == nil {
+		friendIDs = []int64{} // 空列表也缓存，避免没有好友的用户每次都查库
+	}
+	data, err := json.Marshal(friendIDs)
+	if err != nil {
+		return err
+	}
+	return c.set(familyUserFriends, key, data)
+}
+
+// GetFriendIDs 获取缓存的好友ID列表，未命中时返回nil
+func (c *CacheService) GetFriendIDs(userID int64) ([]int64, error) {
+	key := UserFriendsPrefix + strconv.FormatInt(userID, 10)
+	data, err := c.get(familyUserFriends, key)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	friendIDs := []int64{}
+	err = json.Unmarshal([]byte(data), &friendIDs)
+	return friendIDs, err
+}
+
+// InvalidateFriendIDs 删除好友ID列表缓存
+func (c *CacheService) InvalidateFriendIDs(userIDs ...int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = UserFriendsPrefix + strconv.FormatInt(userID, 10)
+	}
+	return c.client.Del(c.ctx, keys...).Err()
+}
+
+// InvalidateUserCache 删除用户相关缓存，并通知所有实例
+// 带用户标签的键（资料、手机号索引）按标签删除，手机号变更后旧号码的索引也会被清除
 func (c *CacheService) InvalidateUserCache(userID int64, phone string) error {
+	_, err := c.InvalidateTags(UserTag(userID))
+
 	keys := []string{
 		UserProfilePrefix + strconv.FormatInt(userID, 10),
-		UserByPhonePrefix + phone,
 		UserFriendsPrefix + strconv.FormatInt(userID, 10),
 	}
-	return c.client.Del(c.ctx, keys...).Err()
+	if phone != "" {
+		keys = append(keys, UserByPhonePrefix+phone)
+	}
+	if delErr := c.client.Del(c.ctx, keys...).Err(); delErr != nil && err == nil {
+		err = delErr
+	}
+	PublishInvalidation(ScopeUser, userID)
+	return err
 }
 
 // ========== 消息相关缓存 ==========
@@ -136,13 +187,13 @@ func (c *CacheService) CachePrivateMessages(userID1, userID2 int64, page, pageSi
 	if err != nil {
 		return err
 	}
-	return c.client.Set(c.ctx, key, data, MessagesTTL).Err()
+	return c.set(familyPrivateMessages, key, data)
 }
 
 // GetPrivateMessages 获取缓存的单聊消息列表
 func (c *CacheService) GetPrivateMessages(userID1, userID2 int64, page, pageSize int, result interface{}) error {
 	key := fmt.Sprintf("%s%d:%d:%d:%d", PrivateMessagesPrefix, userID1, userID2, page, pageSize)
-	data, err := c.client.Get(c.ctx, key).Result()
+	data, err := c.get(familyPrivateMessages, key)
 	if err != nil {
 		if err == redis.Nil {
 			return nil // 缓存未命中
@@ -152,20 +203,20 @@ func (c *CacheService) GetPrivateMessages(userID1, userID2 int64, page, pageSize
 	return json.Unmarshal([]byte(data), result)
 }
 
-// CacheGroupMessages 缓存群聊消息列表
-func (c *CacheService) CacheGroupMessages(groupID int64, page, pageSize int, messages interface{}) error {
-	key := fmt.Sprintf("%s%d:%d:%d", GroupMessagesPrefix, groupID, page, pageSize)
+// CacheGroupMessages 缓存群聊消息列表（按查看者区分，用户可仅为自己删除消息）
+func (c *CacheService) CacheGroupMessages(groupID, userID int64, page, pageSize int, messages interface{}) error {
+	key := fmt.Sprintf("%s%d:%d:%d:%d", GroupMessagesPrefix, groupID, userID, page, pageSize)
 	data, err := json.Marshal(messages)
 	if err != nil {
 		return err
 	}
-	return c.client.Set(c.ctx, key, data, MessagesTTL).Err()
+	return c.set(familyGroupMessages, key, data, GroupTag(groupID))
 }
 
 // GetGroupMessages 获取缓存的群聊消息列表
-func (c *CacheService) GetGroupMessages(groupID int64, page, pageSize int, result interface{}) error {
-	key := fmt.Sprintf("%s%d:%d:%d", GroupMessagesPrefix, groupID, page, pageSize)
-	data, err := c.client.Get(c.ctx, key).Result()
+func (c *CacheService) GetGroupMessages(groupID, userID int64, page, pageSize int, result interface{}) error {
+	key := fmt.Sprintf("%s%d:%d:%d:%d", GroupMessagesPrefix, groupID, userID, page, pageSize)
+	data, err := c.get(familyGroupMessages, key)
 	if err != nil {
 		if err == redis.Nil {
 			return nil
@@ -192,7 +243,7 @@ func (c *CacheService) CacheLastMessage(userID, targetID int64, isGroup bool, me
 	if err != nil {
 		return err
 	}
-	return c.client.Set(c.ctx, key, data, MessagesTTL).Err()
+	return c.set(familyLastMessage, key, data)
 }
 
 // GetLastMessage 获取缓存的最后一条消息
@@ -207,7 +258,7 @@ func (c *CacheService) GetLastMessage(userID, targetID int64, isGroup bool) (*mo
 		key = fmt.Sprintf("%sprivate:%d:%d", LastMessagePrefix, userID, targetID)
 	}
 
-	data, err := c.client.Get(c.ctx, key).Result()
+	data, err := c.get(familyLastMessage, key)
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
@@ -222,32 +273,17 @@ func (c *CacheService) GetLastMessage(userID, targetID int64, isGroup bool) (*mo
 
 // InvalidateMessageCache 删除消息相关缓存
 func (c *CacheService) InvalidateMessageCache(userID, targetID int64, isGroup bool) error {
-	pattern := ""
 	if isGroup {
-		pattern = fmt.Sprintf("%s%d:*", GroupMessagesPrefix, targetID)
-	} else {
-		// 删除双向的私聊消息缓存
-		pattern1 := fmt.Sprintf("%s%d:%d:*", PrivateMessagesPrefix, userID, targetID)
-		pattern2 := fmt.Sprintf("%s%d:%d:*", PrivateMessagesPrefix, targetID, userID)
-
-		keys1, _ := c.client.Keys(c.ctx, pattern1).Result()
-		keys2, _ := c.client.Keys(c.ctx, pattern2).Result()
-
-		allKeys := append(keys1, keys2...)
-		if len(allKeys) > 0 {
-			c.client.Del(c.ctx, allKeys...)
-		}
-		return nil
-	}
-
-	keys, err := c.client.Keys(c.ctx, pattern).Result()
-	if err != nil {
+		_, err := c.deletePatterns(fmt.Sprintf("%s%d:*", GroupMessagesPrefix, targetID))
 		return err
 	}
-	if len(keys) > 0 {
-		return c.client.Del(c.ctx, keys...).Err()
-	}
-	return nil
+
+	// 删除双向的私聊消息缓存
+	_, err := c.deletePatterns(
+		fmt.Sprintf("%s%d:%d:*", PrivateMessagesPrefix, userID, targetID),
+		fmt.Sprintf("%s%d:%d:*", PrivateMessagesPrefix, targetID, userID),
+	)
+	return err
 }
 
 // ========== 会话相关缓存 ==========
@@ -259,13 +295,13 @@ func (c *CacheService) CacheConversationList(userID int64, page, pageSize int, c
 	if err != nil {
 		return err
 	}
-	return c.client.Set(c.ctx, key, data, ConversationTTL).Err()
+	return c.set(familyConversationList, key, data, ConversationTag(userID))
 }
 
 // GetConversationList 获取缓存的会话列表
 func (c *CacheService) GetConversationList(userID int64, page, pageSize int, result interface{}) error {
 	key := fmt.Sprintf("%s%d:%d:%d", ConversationListPrefix, userID, page, pageSize)
-	data, err := c.client.Get(c.ctx, key).Result()
+	data, err := c.get(familyConversationList, key)
 	if err != nil {
 		if err == redis.Nil {
 			return nil
@@ -275,17 +311,11 @@ func (c *CacheService) GetConversationList(userID int64, page, pageSize int, res
 	return json.Unmarshal([]byte(data), result)
 }
 
-// InvalidateConversationCache 删除会话缓存
+// InvalidateConversationCache 删除用户的所有会话列表缓存
+// 每条消息都会为每个接收者调用，按标签删除而不是SCAN
 func (c *CacheService) InvalidateConversationCache(userID int64) error {
-	pattern := fmt.Sprintf("%s%d:*", ConversationListPrefix, userID)
-	keys, err := c.client.Keys(c.ctx, pattern).Result()
-	if err != nil {
-		return err
-	}
-	if len(keys) > 0 {
-		return c.client.Del(c.ctx, keys...).Err()
-	}
-	return nil
+	_, err := c.InvalidateTags(ConversationTag(userID))
+	return err
 }
 
 // ========== 群组相关缓存 ==========
@@ -297,13 +327,13 @@ func (c *CacheService) CacheGroupInfo(groupID int64, group *models.Group) error
 	if err != nil {
 		return err
 	}
-	return c.client.Set(c.ctx, key, data, GroupInfoTTL).Err()
+	return c.set(familyGroupInfo, key, data, GroupTag(groupID))
 }
 
 // GetGroupInfo 获取缓存的群组信息
 func (c *CacheService) GetGroupInfo(groupID int64) (*models.Group, error) {
 	key := GroupInfoPrefix + strconv.FormatInt(groupID, 10)
-	data, err := c.client.Get(c.ctx, key).Result()
+	data, err := c.get(familyGroupInfo, key)
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
@@ -323,13 +353,13 @@ func (c *CacheService) CacheGroupMembers(groupID int64, members interface{}) err
 	if err != nil {
 		return err
 	}
-	return c.client.Set(c.ctx, key, data, GroupInfoTTL).Err()
+	return c.set(familyGroupMembers, key, data, GroupTag(groupID))
 }
 
 // GetGroupMembers 获取缓存的群组成员列表
 func (c *CacheService) GetGroupMembers(groupID int64, result interface{}) error {
 	key := GroupMembersPrefix + strconv.FormatInt(groupID, 10)
-	data, err := c.client.Get(c.ctx, key).Result()
+	data, err := c.get(familyGroupMembers, key)
 	if err != nil {
 		if err == redis.Nil {
 			return nil
@@ -339,13 +369,11 @@ func (c *CacheService) GetGroupMembers(groupID int64, result interface{}) error
 	return json.Unmarshal([]byte(data), result)
 }
 
-// InvalidateGroupCache 删除群组相关缓存
+// InvalidateGroupCache 删除带群组标签的所有缓存（群信息、群成员、群消息分页），并通知所有实例
 func (c *CacheService) InvalidateGroupCache(groupID int64) error {
-	keys := []string{
-		GroupInfoPrefix + strconv.FormatInt(groupID, 10),
-		GroupMembersPrefix + strconv.FormatInt(groupID, 10),
-	}
-	return c.client.Del(c.ctx, keys...).Err()
+	_, err := c.InvalidateTags(GroupTag(groupID))
+	PublishInvalidation(ScopeGroup, groupID)
+	return err
 }
 
 // ========== 在线状态缓存 ==========
@@ -360,6 +388,7 @@ func (c *CacheService) SetUserOnline(userID int64) error {
 func (c *CacheService) IsUserOnline(userID int64) (bool, error) {
 	key := UserOnlinePrefix + strconv.FormatInt(userID, 10)
 	_, err := c.client.Get(c.ctx, key).Result()
+	recordLookup(familyOnlineStatus, err)
 	if err != nil {
 		if err == redis.Nil {
 			return false, nil
@@ -378,8 +407,8 @@ func (c *CacheService) SetUserOffline(userID int64) error {
 // GetOnlineUsers 获取在线用户列表
 func (c *CacheService) GetOnlineUsers() ([]int64, error) {
 	pattern := UserOnlinePrefix + "*"
-	keys, err := c.client.Keys(c.ctx, pattern).Result()
-	if err != nil {
+	keys, err := c.scanKeys(pattern)
+	if err != nil && err != ErrScanLimitExceeded {
 		return nil, err
 	}
 
@@ -397,18 +426,22 @@ func (c *CacheService) GetOnlineUsers() ([]int64, error) {
 func (c *CacheService) GetOnlineCount() (int64, error) {
 	// 先尝试从缓存获取
 	count, err := c.client.Get(c.ctx, OnlineCountPrefix).Int64()
+	recordLookup(familyOnlineCount, err)
 	if err == nil {
 		return count, nil
 	}
 
 	// 如果缓存没有，计算并缓存
+	count = 0
 	pattern := UserOnlinePrefix + "*"
-	keys, err := c.client.Keys(c.ctx, pattern).Result()
-	if err != nil {
+	err = c.scanEach(pattern, func(keys []string) error {
+		count += int64(len(keys))
+		return nil
+	})
+	if err != nil && err != ErrScanLimitExceeded {
 		return 0, err
 	}
 
-	count = int64(len(keys))
 	// 缓存结果
 	c.client.Set(c.ctx, OnlineCountPrefix, count, ShortTTL)
 	return count, nil
@@ -416,16 +449,22 @@ func (c *CacheService) GetOnlineCount() (int64, error) {
 
 // ========== 统计缓存 ==========
 
-// IncrementMessageStats 增加消息统计
+// IncrementMessageStats 增加消息统计，date为UTC日期（20231201）
 func (c *CacheService) IncrementMessageStats(date string) error {
 	key := MessageStatsPrefix + date
-	return c.client.Incr(c.ctx, key).Err()
+	pipe := c.client.Pipeline()
+	pipe.Incr(c.ctx, key)
+	pipe.Expire(c.ctx, key, DailyStatsTTL)
+	_, err := pipe.Exec(c.ctx)
+	return err
 }
 
 // GetMessageStats 获取消息统计
 func (c *CacheService) GetMessageStats(date string) (int64, error) {
 	key := MessageStatsPrefix + date
-	return c.client.Get(c.ctx, key).Int64()
+	count, err := c.client.Get(c.ctx, key).Int64()
+	recordLookup(familyMessageStats, err)
+	return count, err
 }
 
 // ========== 通用缓存操作 ==========
@@ -442,6 +481,7 @@ func (c *CacheService) Set(key string, value interface{}, ttl time.Duration) err
 // Get 通用获取缓存
 func (c *CacheService) Get(key string, result interface{}) error {
 	data, err := c.client.Get(c.ctx, key).Result()
+	recordLookup(familyGeneric, err)
 	if err != nil {
 		return err
 	}
@@ -455,14 +495,8 @@ func (c *CacheService) Delete(keys ...string) error {
 
 // DeletePattern 按模式删除缓存
 func (c *CacheService) DeletePattern(pattern string) error {
-	keys, err := c.client.Keys(c.ctx, pattern).Result()
-	if err != nil {
-		return err
-	}
-	if len(keys) > 0 {
-		return c.client.Del(c.ctx, keys...).Err()
-	}
-	return nil
+	_, err := c.deletePatterns(pattern)
+	return err
 }
 
 // Exists 检查键是否存在
@@ -483,6 +517,9 @@ func (c *CacheService) Expire(key string, ttl time.Duration) error {
 
 // WarmupUserCache 预热用户缓存
 func (c *CacheService) WarmupUserCache(users []models.User) error {
+	if !familyEnabled(familyUserProfile) {
+		return nil
+	}
 	pipe := c.client.Pipeline()
 
 	for _, user := range users {
@@ -490,8 +527,12 @@ func (c *CacheService) WarmupUserCache(users []models.User) error {
 		phoneKey := UserByPhonePrefix + user.Phone
 
 		userData, _ := json.Marshal(user)
-		pipe.Set(c.ctx, userKey, userData, UserProfileTTL)
-		pipe.Set(c.ctx, phoneKey, user.ID, UserProfileTTL)
+		pipe.Set(c.ctx, userKey, userData, familyTTL(familyUserProfile))
+		pipe.Set(c.ctx, phoneKey, user.ID, familyTTL(familyUserPhone))
+
+		tagKey := TagPrefix + UserTag(user.ID)
+		pipe.SAdd(c.ctx, tagKey, userKey, phoneKey)
+		pipe.Expire(c.ctx, tagKey, tagSetMinTTL)
 	}
 
 	_, err := pipe.Exec(c.ctx)
@@ -501,23 +542,65 @@ func (c *CacheService) WarmupUserCache(users []models.User) error {
 	return err
 }
 
-// BatchInvalidate 批量删除缓存
-func (c *CacheService) BatchInvalidate(patterns []string) error {
-	var allKeys []string
+// WarmupFriendIDs 预热好友ID列表缓存
+func (c *CacheService) WarmupFriendIDs(friendIDs map[int64][]int64) error {
+	if !familyEnabled(familyUserFriends) || len(friendIDs) == 0 {
+		return nil
+	}
+	pipe := c.client.Pipeline()
 
-	for _, pattern := range patterns {
-		keys, err := c.client.Keys(c.ctx, pattern).Result()
-		if err != nil {
-			logger.GetLogger().Errorf("Failed to get keys for pattern %s: %v", pattern, err)
-			continue
+	for userID, ids := range friendIDs {
+		if ids == nil {
+			ids = []int64{}
 		}
-		allKeys = append(allKeys, keys...)
+		data, _ := json.Marshal(ids)
+		pipe.Set(c.ctx, UserFriendsPrefix+strconv.FormatInt(userID, 10), data, familyTTL(familyUserFriends))
 	}
 
-	if len(allKeys) > 0 {
-		return c.client.Del(c.ctx, allKeys...).Err()
+	_, err := pipe.Exec(c.ctx)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to warmup friend cache: %v", err)
+	}
+	return err
+}
+
+// WarmupGroupMembers 预热群成员列表缓存
+func (c *CacheService) WarmupGroupMembers(members map[int64][]models.GroupMember) error {
+	if !familyEnabled(familyGroupMembers) || len(members) == 0 {
+		return nil
+	}
+	pipe := c.client.Pipeline()
+
+	ttl := familyTTL(familyGroupMembers)
+	tagTTL := tagSetMinTTL
+	if ttl > tagTTL {
+		tagTTL = ttl
+	}
+	for groupID, groupMembers := range members {
+		key := GroupMembersPrefix + strconv.FormatInt(groupID, 10)
+		data, _ := json.Marshal(groupMembers)
+		pipe.Set(c.ctx, key, data, ttl)
+
+		tagKey := TagPrefix + GroupTag(groupID)
+		pipe.SAdd(c.ctx, tagKey, key)
+		pipe.Expire(c.ctx, tagKey, tagTTL)
 	}
-	return nil
+
+	_, err := pipe.Exec(c.ctx)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to warmup group member cache: %v", err)
+	}
+	return err
+}
+
+// BatchInvalidate 批量删除缓存
+func (c *CacheService) BatchInvalidate(patterns []string) error {
+	deleted, err := c.deletePatterns(patterns...)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to invalidate patterns %v: %v", patterns, err)
+	}
+	logger.GetLogger().Debugf("Batch invalidated %d keys", deleted)
+	return err
 }
 
 // GetCacheStats 获取缓存统计信息
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"gochat/internal/logger"
+)
+
+// 跨实例缓存失效总线
+// 实例使某个用户或群组的缓存失效时，通过Redis pub/sub广播失效事件，所有副本据此删除进程内的副本。
+// Redis中的缓存由所有实例共享，删除一次即可；需要广播的只有各实例的本地状态（如L1缓存）。
+// 订阅断线期间的事件会丢失，本地缓存依靠较短的TTL兜底。
+const (
+	ScopeUser  = "user"  // 用户资料变更，ID为用户ID
+	ScopeGroup = "group" // 群信息或群成员变更，ID为群组ID
+	// ScopeSession 用户被强制下线，ID为用户ID；各实例据此断开该用户的实时连接
+	ScopeSession = "session"
+	// ScopeAnnouncement 系统公告发布或撤回，ID为公告ID；各实例据此推送给本实例上在线的目标用户
+	ScopeAnnouncement = "announcement"
+
+	invalidationChannel = "cache:invalidate"
+)
+
+// InvalidationEvent 缓存失效事件
+type InvalidationEvent struct {
+	Scope  string `json:"scope"`
+	ID     string `json:"id"`
+	Origin string `json:"origin"` // 发布事件的实例，实例忽略自己发布的事件
+}
+
+// InvalidationHandler 失效事件处理函数，参数为失效对象的ID
+type InvalidationHandler func(id string)
+
+var (
+	// instanceID 当前实例的随机标识
+	instanceID = newInstanceID()
+
+	handlersMutex sync.RWMutex
+	handlers      = map[string][]InvalidationHandler{
+		ScopeUser:  {func(id string) { L1(L1UserProfile).Delete(id) }},
+		ScopeGroup: {func(id string) { L1(L1GroupMembers).Delete(id) }},
+	}
+)
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// OnInvalidate 注册失效事件处理函数，本实例和其他实例发布的事件都会触发
+func OnInvalidate(scope string, handler InvalidationHandler) {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	handlers[scope] = append(handlers[scope], handler)
+}
+
+// PublishInvalidation 在本实例执行失效处理并广播给其他实例
+func PublishInvalidation(scope string, id int64) {
+	event := InvalidationEvent{Scope: scope, ID: strconv.FormatInt(id, 10), Origin: instanceID}
+	dispatchInvalidation(event)
+
+	if RedisClient == nil {
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := RedisClient.Publish(context.Background(), invalidationChannel, payload).Err(); err != nil {
+		logger.GetLogger().Warnf("发布缓存失效事件失败: %v", err)
+	}
+}
+
+// dispatchInvalidation 调用事件对应的处理函数
+func dispatchInvalidation(event InvalidationEvent) {
+	handlersMutex.RLock()
+	scopeHandlers := handlers[event.Scope]
+	handlersMutex.RUnlock()
+
+	for _, handler := range scopeHandlers {
+		handler(event.ID)
+	}
+}
+
+// handleInvalidationMessage 处理从其他实例收到的失效事件
+func handleInvalidationMessage(payload string) {
+	var event InvalidationEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		logger.GetLogger().Warnf("无效的缓存失效事件: %s", payload)
+		return
+	}
+	if event.Origin == instanceID {
+		return
+	}
+	dispatchInvalidation(event)
+}
+
+// StartInvalidationListener 订阅其他实例发布的缓存失效事件
+func StartInvalidationListener(ctx context.Context) {
+	if RedisClient == nil {
+		return
+	}
+
+	pubsub := RedisClient.Subscribe(ctx, invalidationChannel)
+	go func() {
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				handleInvalidationMessage(msg.Payload)
+			}
+		}
+	}()
+}
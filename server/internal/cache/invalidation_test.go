@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishInvalidationClearsLocalL1(t *testing.T) {
+	L1(L1GroupMembers).Set("42", []int64{1, 2})
+	PublishInvalidation(ScopeGroup, 42)
+
+	_, ok := L1(L1GroupMembers).Get("42")
+	assert.False(t, ok)
+}
+
+func TestInvalidationFromOtherInstance(t *testing.T) {
+	L1(L1UserProfile).Set("7", "profile")
+
+	// 自己发布的事件在发布时已处理，收到回环消息时忽略
+	own, _ := json.Marshal(InvalidationEvent{Scope: ScopeUser, ID: "7", Origin: instanceID})
+	handleInvalidationMessage(string(own))
+	_, ok := L1(L1UserProfile).Get("7")
+	assert.True(t, ok)
+
+	other, _ := json.Marshal(InvalidationEvent{Scope: ScopeUser, ID: "7", Origin: "other"})
+	handleInvalidationMessage(string(other))
+	_, ok = L1(L1UserProfile).Get("7")
+	assert.False(t, ok)
+}
+
+func TestInvalidationBroadcastOverRedis(t *testing.T) {
+	mr := useTestRedisClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	StartInvalidationListener(ctx)
+	require.Eventually(t, func() bool {
+		return len(mr.PubSubChannels("")) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	L1(L1GroupMembers).Set("9", []int64{1})
+	other, _ := json.Marshal(InvalidationEvent{Scope: ScopeGroup, ID: "9", Origin: "other"})
+	mr.Publish(invalidationChannel, string(other))
+
+	assert.Eventually(t, func() bool {
+		_, ok := L1(L1GroupMembers).Get("9")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// 进程内L1缓存族
+// L1位于Redis之前，缓存每次发消息都会用到的热点数据，TTL很短，写操作通过失效总线通知所有实例删除
+const (
+	L1UserProfile  = "user_profile"  // 用户资料
+	L1GroupMembers = "group_members" // 群成员列表
+)
+
+// L1缓存参数
+const (
+	UserProfileL1TTL   = 30 * time.Second
+	UserProfileL1Size  = 10000
+	GroupMembersL1TTL  = 10 * time.Second
+	GroupMembersL1Size = 2000
+)
+
+// LocalCache 带TTL的进程内LRU缓存，并发安全
+type LocalCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	ll      *list.List               // 最近使用的在前
+	items   map[string]*list.Element // key -> *localEntry
+	now     func() time.Time
+	family  string // 缓存族，不为空时记录命中率指标
+}
+
+type localEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NewLocalCache 创建进程内LRU缓存，ttl不大于0时不缓存任何数据
+func NewLocalCache(maxSize int, ttl time.Duration) *LocalCache {
+	return &LocalCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get 获取缓存值，过期或不存在时返回false
+func (c *LocalCache) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.record(lookupMiss)
+		return nil, false
+	}
+	entry := elem.Value.(*localEntry)
+	if c.now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		c.record(lookupMiss)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	c.record(lookupHit)
+	return entry.value, true
+}
+
+func (c *LocalCache) record(result string) {
+	if c.family != "" {
+		recordResult(layerL1, c.family, result)
+	}
+}
+
+// Set 设置缓存值，超过容量时淘汰最久未使用的条目
+func (c *LocalCache) Set(key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*localEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&localEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.maxSize > 0 && c.ll.Len() > c.maxSize {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Delete 删除缓存值
+func (c *LocalCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// Purge 清空缓存
+func (c *LocalCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Len 当前条目数（含未清理的过期条目）
+func (c *LocalCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LocalCache) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*localEntry).key)
+}
+
+// L1缓存实例
+var l1Caches = map[string]*LocalCache{
+	L1UserProfile:  newFamilyCache(L1UserProfile, UserProfileL1Size, UserProfileL1TTL),
+	L1GroupMembers: newFamilyCache(L1GroupMembers, GroupMembersL1Size, GroupMembersL1TTL),
+}
+
+func newFamilyCache(family string, maxSize int, ttl time.Duration) *LocalCache {
+	c := NewLocalCache(maxSize, ttl)
+	c.family = family
+	return c
+}
+
+// L1 获取指定缓存族的进程内缓存
+func L1(family string) *LocalCache {
+	return l1Caches[family]
+}
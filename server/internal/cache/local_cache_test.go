@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLocalCache(2, time.Minute)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	// 访问a后b成为最久未使用
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	c.Set("c", 3)
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestLocalCacheExpires(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := NewLocalCache(10, 10*time.Second)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", 1)
+	now = now.Add(5 * time.Second)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	now = now.Add(6 * time.Second)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLocalCacheRecordsLookups(t *testing.T) {
+	c := newFamilyCache("test_family", 10, time.Minute)
+	hits := cacheLookups.WithLabelValues(layerL1, "test_family", lookupHit)
+	misses := cacheLookups.WithLabelValues(layerL1, "test_family", lookupMiss)
+
+	c.Get("a")
+	c.Set("a", 1)
+	c.Get("a")
+	c.Get("a")
+
+	assert.Equal(t, int64(2), hits.Value())
+	assert.Equal(t, int64(1), misses.Value())
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"gochat/internal/logger"
+)
+
+// 分布式锁
+// 基于 SET NX PX 和持有者令牌实现（Redlock的单节点形式），续期和释放都校验令牌，
+// 锁过期后被其他实例获取时，原持有者无法误删或误续期
+const LockPrefix = "lock:"
+
+var (
+	// ErrLockNotAcquired 锁已被其他实例持有
+	ErrLockNotAcquired = errors.New("cache: lock not acquired")
+	// ErrLockNotHeld 锁已过期或被其他实例持有，续期或释放失败
+	ErrLockNotHeld = errors.New("cache: lock not held")
+)
+
+var (
+	renewLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+	releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+// Lock 分布式锁
+type Lock struct {
+	client *redis.Client
+	key    string
+	token  string
+	ttl    time.Duration
+}
+
+// NewLock 创建分布式锁，ttl为锁的过期时间，持有期间需在过期前续期
+func NewLock(name string, ttl time.Duration) *Lock {
+	return NewLockWithClient(RedisClient, name, ttl)
+}
+
+// NewLockWithClient 使用指定的Redis客户端创建分布式锁（支持依赖注入）
+func NewLockWithClient(client *redis.Client, name string, ttl time.Duration) *Lock {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return &Lock{
+		client: client,
+		key:    LockPrefix + name,
+		token:  hex.EncodeToString(token),
+		ttl:    ttl,
+	}
+}
+
+// Acquire 尝试获取锁，已被持有时返回ErrLockNotAcquired
+func (l *Lock) Acquire(ctx context.Context) error {
+	ok, err := l.client.SetNX(ctx, l.key, l.token, l.ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotAcquired
+	}
+	return nil
+}
+
+// Renew 续期锁，锁已不属于当前持有者时返回ErrLockNotHeld
+func (l *Lock) Renew(ctx context.Context) error {
+	n, err := renewLockScript.Run(ctx, l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release 释放锁，锁已不属于当前持有者时返回ErrLockNotHeld
+func (l *Lock) Release(ctx context.Context) error {
+	n, err := releaseLockScript.Run(ctx, l.client, []string{l.key}, l.token).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// WithLock 持有锁执行fn，执行期间每ttl/3自动续期
+// 锁被其他实例持有时返回ErrLockNotAcquired；续期失败时取消传给fn的ctx
+func WithLock(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	return withLock(ctx, NewLock(name, ttl), fn)
+}
+
+func withLock(ctx context.Context, lock *Lock, fn func(ctx context.Context) error) error {
+	if err := lock.Acquire(ctx); err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		ticker := time.NewTicker(lock.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				if err := lock.Renew(runCtx); err != nil {
+					if runCtx.Err() != nil {
+						return
+					}
+					logger.GetLogger().Warnf("分布式锁 %s 续期失败，停止执行: %v", lock.key, err)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := fn(runCtx)
+	cancel()
+	<-renewDone
+
+	if releaseErr := lock.Release(context.Background()); releaseErr != nil && releaseErr != ErrLockNotHeld {
+		logger.GetLogger().Warnf("释放分布式锁 %s 失败: %v", lock.key, releaseErr)
+	}
+	return err
+}
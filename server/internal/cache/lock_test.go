@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useTestRedisClient(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	previous := RedisClient
+	RedisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		RedisClient.Close()
+		RedisClient = previous
+	})
+	return mr
+}
+
+func TestLockAcquireRenewRelease(t *testing.T) {
+	mr := useTestRedisClient(t)
+	ctx := context.Background()
+
+	first := NewLock("job", time.Second)
+	second := NewLock("job", time.Second)
+
+	require.NoError(t, first.Acquire(ctx))
+	assert.ErrorIs(t, second.Acquire(ctx), ErrLockNotAcquired)
+
+	// 非持有者不能续期或释放
+	assert.ErrorIs(t, second.Renew(ctx), ErrLockNotHeld)
+	assert.ErrorIs(t, second.Release(ctx), ErrLockNotHeld)
+
+	require.NoError(t, first.Renew(ctx))
+	assert.Equal(t, time.Second, mr.TTL(LockPrefix+"job"))
+
+	require.NoError(t, first.Release(ctx))
+	require.NoError(t, second.Acquire(ctx))
+}
+
+func TestLockExpiredHolderCannotRelease(t *testing.T) {
+	mr := useTestRedisClient(t)
+	ctx := context.Background()
+
+	first := NewLock("job", time.Second)
+	require.NoError(t, first.Acquire(ctx))
+	mr.FastForward(2 * time.Second)
+
+	second := NewLock("job", time.Second)
+	require.NoError(t, second.Acquire(ctx))
+	assert.ErrorIs(t, first.Release(ctx), ErrLockNotHeld)
+	assert.True(t, mr.Exists(LockPrefix+"job"))
+}
+
+func TestWithLockSkipsWhenHeld(t *testing.T) {
+	useTestRedisClient(t)
+	ctx := context.Background()
+
+	ran := false
+	err := WithLock(ctx, "job", time.Second, func(ctx context.Context) error {
+		// 执行期间其他实例无法获取锁
+		nested := WithLock(ctx, "job", time.Second, func(context.Context) error { return nil })
+		assert.ErrorIs(t, nested, ErrLockNotAcquired)
+		ran = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, ran)
+
+	// 执行完成后锁已释放
+	require.NoError(t, NewLock("job", time.Second).Acquire(ctx))
+}
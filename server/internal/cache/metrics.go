@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"github.com/go-redis/redis/v8"
+
+	"gochat/internal/metrics"
+)
+
+// 缓存读取的层级
+const (
+	layerL1    = "l1"
+	layerRedis = "redis"
+)
+
+// 缓存读取的结果
+const (
+	lookupHit   = "hit"
+	lookupMiss  = "miss"
+	lookupError = "error"
+)
+
+// 缓存键族，用于按族统计命中率
+const (
+	familyUserProfile      = "user_profile"
+	familyUserPhone        = "user_phone"
+	familyUserFriends      = "user_friends"
+	familyPrivateMessages  = "private_messages"
+	familyGroupMessages    = "group_messages"
+	familyLastMessage      = "last_message"
+	familyConversationList = "conversation_list"
+	familyGroupInfo        = "group_info"
+	familyGroupMembers     = "group_members"
+	familyOnlineStatus     = "online_status"
+	familyOnlineCount      = "online_count"
+	familyMessageStats     = "message_stats"
+	familyGeneric          = "generic"
+)
+
+// cacheLookups 缓存读取次数，按层级、键族和结果区分
+var cacheLookups = metrics.NewCounterVec("cache_lookups_total", "缓存读取次数", "layer", "family", "result")
+
+// recordLookup 根据Redis读取返回的错误记录命中、未命中或出错
+func recordLookup(family string, err error) {
+	switch {
+	case err == nil:
+		cacheLookups.WithLabelValues(layerRedis, family, lookupHit).Inc()
+	case err == redis.Nil:
+		cacheLookups.WithLabelValues(layerRedis, family, lookupMiss).Inc()
+	default:
+		cacheLookups.WithLabelValues(layerRedis, family, lookupError).Inc()
+	}
+}
+
+// recordResult 直接记录一次读取结果
+func recordResult(layer, family, result string) {
+	cacheLookups.WithLabelValues(layer, family, result).Inc()
+}
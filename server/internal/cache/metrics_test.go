@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestCacheServiceRecordsLookups(t *testing.T) {
+	c, _ := newTestCacheService(t)
+	hits := cacheLookups.WithLabelValues(layerRedis, familyGroupInfo, lookupHit)
+	misses := cacheLookups.WithLabelValues(layerRedis, familyGroupInfo, lookupMiss)
+	baseHits, baseMisses := hits.Value(), misses.Value()
+
+	group, err := c.GetGroupInfo(1)
+	require.NoError(t, err)
+	assert.Nil(t, group)
+
+	require.NoError(t, c.CacheGroupInfo(1, &models.Group{ID: 1, Name: "test"}))
+	group, err = c.GetGroupInfo(1)
+	require.NoError(t, err)
+	assert.Equal(t, "test", group.Name)
+
+	assert.Equal(t, baseHits+1, hits.Value())
+	assert.Equal(t, baseMisses+1, misses.Value())
+}
@@ -2,12 +2,12 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 
+	"gochat/internal/breaker"
 	"gochat/internal/config"
 	"gochat/internal/logger"
 )
@@ -19,23 +19,43 @@ var (
 
 // Init 初始化Redis连接
 func Init(cfg *config.RedisConfig) error {
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
 	RedisClient = redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
+		Addr:      fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Username:  cfg.Username,
+		Password:  cfg.Password,
+		DB:        cfg.DB,
+		TLSConfig: tlsConfig,
 	})
 
 	// 测试连接
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := RedisClient.Ping(ctx).Result()
+	_, err = RedisClient.Ping(ctx).Result()
 	if err != nil {
 		return fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	// Redis连续出错时熔断，避免每个请求都等待超时
+	client := RedisClient
+	redisBreaker = breaker.NewFromConfig("redis", &cfg.CircuitBreaker, func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	})
+	if redisBreaker != nil {
+		RedisClient.AddHook(newBreakerHook(redisBreaker))
+	}
+
 	// 初始化缓存服务
 	cacheService = NewCacheService(RedisClient)
+
+	// 订阅其他实例的缓存失效事件
+	StartInvalidationListener(context.Background())
+
 	logger.GetLogger().Info("Redis connection and cache service initialized successfully")
 
 	return nil
@@ -102,47 +122,6 @@ func DeleteToken(userID int64) error {
 	return RedisClient.Del(ctx, key).Err()
 }
 
-// GetUnreadCount 获取未读消息计数
-func GetUnreadCount(userID int64, convID string) (int, error) {
-	ctx := context.Background()
-	key := fmt.Sprintf("unread:%d", userID)
-
-	result, err := RedisClient.HGet(ctx, key, convID).Result()
-	if err == redis.Nil {
-		return 0, nil
-	} else if err != nil {
-		return 0, err
-	}
-
-	var count int
-	if err := json.Unmarshal([]byte(result), &count); err != nil {
-		return 0, err
-	}
-
-	return count, nil
-}
-
-// SetUnreadCount 设置未读消息计数
-func SetUnreadCount(userID int64, convID string, count int) error {
-	ctx := context.Background()
-	key := fmt.Sprintf("unread:%d", userID)
-
-	data, err := json.Marshal(count)
-	if err != nil {
-		return err
-	}
-
-	return RedisClient.HSet(ctx, key, convID, data).Err()
-}
-
-// ClearUnreadCount 清除未读消息计数
-func ClearUnreadCount(userID int64, convID string) error {
-	ctx := context.Background()
-	key := fmt.Sprintf("unread:%d", userID)
-
-	return RedisClient.HDel(ctx, key, convID).Err()
-}
-
 // Close 关闭Redis连接
 func Close() error {
 	return RedisClient.Close()
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+
+	"gochat/internal/logger"
+)
+
+// 按模式遍历键的参数
+// KEYS会阻塞Redis，所有模式匹配操作都使用基于游标的SCAN，分批UNLINK
+const (
+	scanBatchSize   = 500    // 每次SCAN的COUNT提示
+	deleteBatchSize = 500    // 每批UNLINK的键数量
+	maxScanKeys     = 100000 // 单次模式操作最多处理的键数量，防止误用宽泛模式拖垮Redis
+)
+
+// ErrScanLimitExceeded 模式匹配的键数量超过上限
+var ErrScanLimitExceeded = errors.New("cache: too many keys match pattern")
+
+// scanKeys 使用SCAN获取匹配模式的所有键，超过maxScanKeys时返回已获取的键和ErrScanLimitExceeded
+func (c *CacheService) scanKeys(pattern string) ([]string, error) {
+	var keys []string
+	err := c.scanEach(pattern, func(batch []string) error {
+		keys = append(keys, batch...)
+		return nil
+	})
+	return keys, err
+}
+
+// scanEach 使用SCAN分批遍历匹配模式的键
+func (c *CacheService) scanEach(pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	seen := 0
+	for {
+		keys, next, err := c.client.Scan(c.ctx, cursor, pattern, scanBatchSize).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if seen+len(keys) > maxScanKeys {
+				keys = keys[:maxScanKeys-seen]
+			}
+			seen += len(keys)
+			if err := fn(keys); err != nil {
+				return err
+			}
+			if seen >= maxScanKeys {
+				logger.GetLogger().Warnf("模式 %s 匹配的键超过 %d 个，已停止遍历", pattern, maxScanKeys)
+				return ErrScanLimitExceeded
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// deletePatterns 使用SCAN查找匹配任一模式的键并分批UNLINK，返回删除的键数量
+func (c *CacheService) deletePatterns(patterns ...string) (int64, error) {
+	var deleted int64
+	var firstErr error
+
+	for _, pattern := range patterns {
+		// 不含通配符时直接删除，避免无谓的SCAN
+		if !strings.ContainsAny(pattern, "*?[") {
+			n, err := c.client.Unlink(c.ctx, pattern).Result()
+			deleted += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		err := c.scanEach(pattern, func(keys []string) error {
+			for start := 0; start < len(keys); start += deleteBatchSize {
+				end := start + deleteBatchSize
+				if end > len(keys) {
+					end = len(keys)
+				}
+				n, err := c.client.Unlink(c.ctx, keys[start:end]...).Result()
+				if err != nil {
+					return err
+				}
+				deleted += n
+			}
+			return nil
+		})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return deleted, firstErr
+}
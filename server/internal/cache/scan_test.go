@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCacheService(t *testing.T) (*CacheService, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewCacheService(client), mr
+}
+
+func TestDeletePatternsUsesScan(t *testing.T) {
+	c, mr := newTestCacheService(t)
+
+	for i := 0; i < 1200; i++ {
+		mr.Set(fmt.Sprintf("%s1:2:%d:20", PrivateMessagesPrefix, i), "x")
+	}
+	mr.Set(fmt.Sprintf("%s2:1:1:20", PrivateMessagesPrefix), "x")
+	mr.Set(fmt.Sprintf("%s3:4:1:20", PrivateMessagesPrefix), "keep")
+
+	require.NoError(t, c.InvalidateMessageCache(1, 2, false))
+
+	keys := mr.Keys()
+	assert.Equal(t, []string{fmt.Sprintf("%s3:4:1:20", PrivateMessagesPrefix)}, keys)
+}
+
+func TestGetOnlineUsersAndCount(t *testing.T) {
+	c, _ := newTestCacheService(t)
+
+	for _, id := range []int64{1, 2, 3} {
+		require.NoError(t, c.SetUserOnline(id))
+	}
+
+	users, err := c.GetOnlineUsers()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{1, 2, 3}, users)
+
+	count, err := c.GetOnlineCount()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestBatchInvalidateMixedPatterns(t *testing.T) {
+	c, mr := newTestCacheService(t)
+	ctx := context.Background()
+
+	c.client.Set(ctx, GroupInfoPrefix+"7", "x", 0)
+	c.client.Set(ctx, GroupMessagesPrefix+"7:1:20", "x", 0)
+	c.client.Set(ctx, GroupMessagesPrefix+"8:1:20", "x", 0)
+
+	require.NoError(t, c.BatchInvalidate([]string{GroupInfoPrefix + "7", GroupMessagesPrefix + "7:*"}))
+	assert.Equal(t, []string{GroupMessagesPrefix + "8:1:20"}, mr.Keys())
+}
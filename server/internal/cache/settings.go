@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+)
+
+// familySetting 单个键族的运行时配置
+type familySetting struct {
+	enabled bool
+	ttl     time.Duration
+}
+
+// 缓存运行时配置，启动时由Configure根据配置文件覆盖
+var (
+	cacheEnabled   = true
+	familySettings = map[string]familySetting{
+		familyUserProfile:      {enabled: true, ttl: UserProfileTTL},
+		familyUserPhone:        {enabled: true, ttl: UserProfileTTL},
+		familyUserFriends:      {enabled: true, ttl: UserFriendsTTL},
+		familyPrivateMessages:  {enabled: true, ttl: MessagesTTL},
+		familyGroupMessages:    {enabled: true, ttl: MessagesTTL},
+		familyLastMessage:      {enabled: true, ttl: MessagesTTL},
+		familyConversationList: {enabled: true, ttl: ConversationTTL},
+		familyGroupInfo:        {enabled: true, ttl: GroupInfoTTL},
+		familyGroupMembers:     {enabled: true, ttl: GroupInfoTTL},
+	}
+)
+
+// Configure 应用缓存配置，需在Init之前调用
+func Configure(cfg *config.CacheConfig) {
+	cacheEnabled = cfg.Enabled
+
+	for family, familyCfg := range cfg.Families {
+		setting, ok := familySettings[family]
+		if !ok {
+			logger.GetLogger().Warnf("未知的缓存键族配置: %s", family)
+			continue
+		}
+		setting.enabled = familyCfg.Enabled
+		if ttl, err := time.ParseDuration(familyCfg.TTL); err == nil && ttl > 0 {
+			setting.ttl = ttl
+		} else if familyCfg.TTL != "" {
+			logger.GetLogger().Warnf("缓存键族 %s 的过期时间无效: %s，使用默认值 %v", family, familyCfg.TTL, setting.ttl)
+		}
+		familySettings[family] = setting
+	}
+
+	userProfileTTL, groupMembersTTL := UserProfileL1TTL, GroupMembersL1TTL
+	if ttl, err := time.ParseDuration(cfg.L1UserProfileTTL); err == nil {
+		userProfileTTL = ttl
+	}
+	if ttl, err := time.ParseDuration(cfg.L1GroupMembersTTL); err == nil {
+		groupMembersTTL = ttl
+	}
+	if !cfg.Enabled || !cfg.L1Enabled {
+		userProfileTTL, groupMembersTTL = 0, 0
+	}
+	l1Caches[L1UserProfile] = newFamilyCache(L1UserProfile, UserProfileL1Size, userProfileTTL)
+	l1Caches[L1GroupMembers] = newFamilyCache(L1GroupMembers, GroupMembersL1Size, groupMembersTTL)
+}
+
+// familyEnabled 键族是否启用缓存
+func familyEnabled(family string) bool {
+	if !cacheEnabled {
+		return false
+	}
+	setting, ok := familySettings[family]
+	return !ok || setting.enabled
+}
+
+// familyTTL 键族的过期时间
+func familyTTL(family string) time.Duration {
+	return familySettings[family].ttl
+}
+
+// get 读取键族中的缓存并记录命中率，键族未启用时视为未命中
+func (c *CacheService) get(family, key string) (string, error) {
+	if !familyEnabled(family) {
+		return "", redis.Nil
+	}
+	data, err := c.client.Get(c.ctx, key).Result()
+	recordLookup(family, err)
+	return data, err
+}
+
+// set 按键族的过期时间写入缓存，键族未启用时忽略
+func (c *CacheService) set(family, key string, value interface{}, tags ...string) error {
+	if !familyEnabled(family) {
+		return nil
+	}
+	return c.setWithTags(key, value, familyTTL(family), tags...)
+}
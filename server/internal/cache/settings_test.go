@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+// restoreSettings 测试结束后恢复默认缓存配置
+func restoreSettings(t *testing.T) {
+	enabled := cacheEnabled
+	settings := make(map[string]familySetting, len(familySettings))
+	for family, setting := range familySettings {
+		settings[family] = setting
+	}
+	l1 := make(map[string]*LocalCache, len(l1Caches))
+	for family, c := range l1Caches {
+		l1[family] = c
+	}
+	t.Cleanup(func() {
+		cacheEnabled = enabled
+		familySettings = settings
+		l1Caches = l1
+	})
+}
+
+func TestConfigureFamilyTTLAndDisable(t *testing.T) {
+	restoreSettings(t)
+	c, mr := newTestCacheService(t)
+
+	Configure(&config.CacheConfig{
+		Enabled: true,
+		Families: map[string]config.CacheFamilyConfig{
+			"group_info":    {Enabled: true, TTL: "2m"},
+			"group_members": {Enabled: false, TTL: "30m"},
+		},
+		L1Enabled: false,
+	})
+
+	require.NoError(t, c.CacheGroupInfo(1, &models.Group{ID: 1}))
+	assert.Equal(t, 2*time.Minute, mr.TTL(GroupInfoPrefix+"1"))
+
+	// 禁用的键族不写入也不读取
+	require.NoError(t, c.CacheGroupMembers(1, []models.GroupMember{{GroupID: 1, UserID: 2}}))
+	assert.False(t, mr.Exists(GroupMembersPrefix+"1"))
+
+	// L1关闭后不缓存
+	L1(L1UserProfile).Set("1", &models.User{ID: 1})
+	_, ok := L1(L1UserProfile).Get("1")
+	assert.False(t, ok)
+}
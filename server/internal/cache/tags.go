@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"strconv"
+	"time"
+)
+
+// 缓存标签
+// 写入缓存时可以给键打上标签（如 group:789），标签集合 tag:{tag} 记录所有带该标签的键，
+// 失效时按标签一次删除所有相关键，无需手工维护键列表或模式
+const (
+	TagPrefix = "tag:"
+
+	// tagSetMinTTL 标签集合的最短过期时间，每次登记键时续期，保证不早于其中的键过期
+	tagSetMinTTL = 60 * time.Minute
+)
+
+// GroupTag 群组标签，群信息、群成员和群消息分页都带有该标签
+func GroupTag(groupID int64) string {
+	return "group:" + strconv.FormatInt(groupID, 10)
+}
+
+// ConversationTag 会话列表标签，用户的所有会话列表缓存带有该标签
+func ConversationTag(userID int64) string {
+	return "conv:" + strconv.FormatInt(userID, 10)
+}
+
+// UserTag 用户标签，用户资料和手机号索引带有该标签
+func UserTag(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+// setWithTags 写入缓存并将键登记到各标签集合
+func (c *CacheService) setWithTags(key string, value interface{}, ttl time.Duration, tags ...string) error {
+	tagTTL := tagSetMinTTL
+	if ttl > tagTTL {
+		tagTTL = ttl
+	}
+
+	pipe := c.client.TxPipeline()
+	pipe.Set(c.ctx, key, value, ttl)
+	for _, tag := range tags {
+		tagKey := TagPrefix + tag
+		pipe.SAdd(c.ctx, tagKey, key)
+		pipe.Expire(c.ctx, tagKey, tagTTL)
+	}
+	_, err := pipe.Exec(c.ctx)
+	return err
+}
+
+// InvalidateTags 删除带有任一标签的所有缓存键，返回删除的键数量
+func (c *CacheService) InvalidateTags(tags ...string) (int64, error) {
+	var deleted int64
+	var firstErr error
+
+	for _, tag := range tags {
+		n, err := c.invalidateTag(TagPrefix + tag)
+		deleted += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return deleted, firstErr
+}
+
+// invalidateTag 使用SSCAN分批删除标签集合中的键
+// 只从集合中移除已删除的键，删除期间新登记的键保留到下次失效
+func (c *CacheService) invalidateTag(tagKey string) (int64, error) {
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := c.client.SScan(c.ctx, tagKey, cursor, "", deleteBatchSize).Result()
+		if err != nil {
+			return deleted, err
+		}
+
+		if len(keys) > 0 {
+			n, err := c.client.Unlink(c.ctx, keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+
+			members := make([]interface{}, len(keys))
+			for i, key := range keys {
+				members[i] = key
+			}
+			if err := c.client.SRem(c.ctx, tagKey, members...).Err(); err != nil {
+				return deleted, err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestInvalidateGroupCacheDropsTaggedKeys(t *testing.T) {
+	c, mr := newTestCacheService(t)
+
+	require.NoError(t, c.CacheGroupInfo(7, &models.Group{ID: 7, Name: "g"}))
+	require.NoError(t, c.CacheGroupMembers(7, []models.GroupMember{{GroupID: 7, UserID: 1}}))
+	require.NoError(t, c.CacheGroupMessages(7, 1, 1, 20, []models.Message{}))
+	require.NoError(t, c.CacheGroupMessages(7, 2, 1, 20, []models.Message{}))
+	require.NoError(t, c.CacheGroupInfo(8, &models.Group{ID: 8, Name: "other"}))
+
+	require.NoError(t, c.InvalidateGroupCache(7))
+
+	assert.ElementsMatch(t, []string{GroupInfoPrefix + "8", TagPrefix + GroupTag(8)}, mr.Keys())
+}
+
+func TestInvalidateUserCacheDropsOldPhoneIndex(t *testing.T) {
+	c, mr := newTestCacheService(t)
+
+	require.NoError(t, c.CacheUserByPhone("13800000000", 3))
+	require.NoError(t, c.CacheUserProfile(3, &models.User{ID: 3}))
+
+	// 手机号已变更，调用方只知道新号码
+	require.NoError(t, c.InvalidateUserCache(3, "13900000000"))
+
+	assert.Empty(t, mr.Keys())
+}
+
+func TestInvalidateConversationCache(t *testing.T) {
+	c, mr := newTestCacheService(t)
+
+	require.NoError(t, c.CacheConversationList(5, 0, 0, []int{1}))
+	require.NoError(t, c.CacheConversationList(5, 1, 20, []int{1}))
+	require.NoError(t, c.CacheConversationList(6, 0, 0, []int{2}))
+
+	require.NoError(t, c.InvalidateConversationCache(5))
+
+	assert.ElementsMatch(t, []string{ConversationListPrefix + "6:0:0", TagPrefix + ConversationTag(6)}, mr.Keys())
+}
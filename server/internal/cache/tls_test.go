@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+// writeTestCert 生成自签名证书和私钥并写入临时目录
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	tlsConfig, err := buildTLSConfig(&config.RedisConfig{Host: "redis.test"})
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	certFile, keyFile := writeTestCert(t)
+	tlsConfig, err = buildTLSConfig(&config.RedisConfig{
+		Host: "redis.test",
+		TLS: config.RedisTLSConfig{
+			Enabled:  true,
+			CAFile:   certFile,
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "redis.test", tlsConfig.ServerName)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+}
+
+func TestBuildTLSConfigInvalidCA(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0600))
+
+	_, err := buildTLSConfig(&config.RedisConfig{TLS: config.RedisTLSConfig{Enabled: true, CAFile: caFile}})
+	assert.Error(t, err)
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/go-redis/redis/v8"
+
 	"gochat/internal/models"
 )
 
@@ -18,12 +21,24 @@ func NewUserCache() *UserCache {
 }
 
 // GetUser 从缓存获取用户信息，如果缓存不存在则返回 nil
+// 先查进程内L1，未命中再查Redis并回填L1
 func (uc *UserCache) GetUser(userID int64) (*models.User, error) {
+	l1Key := strconv.FormatInt(userID, 10)
+	if cached, ok := L1(L1UserProfile).Get(l1Key); ok {
+		user := *cached.(*models.User)
+		return &user, nil
+	}
+
+	if !familyEnabled(familyUserProfile) {
+		return nil, redis.Nil
+	}
+
 	ctx := context.Background()
 	key := fmt.Sprintf("user:profile:%d", userID)
 
 	// 从Redis获取缓存
 	result := GetRedisClient().Get(ctx, key)
+	recordLookup(familyUserProfile, result.Err())
 	if result.Err() != nil {
 		return nil, result.Err()
 	}
@@ -35,9 +50,16 @@ func (uc *UserCache) GetUser(userID int64) (*models.User, error) {
 		return nil, err
 	}
 
+	uc.setL1(&user)
 	return &user, nil
 }
 
+// setL1 写入进程内缓存（保存副本，避免调用方修改影响缓存）
+func (uc *UserCache) setL1(user *models.User) {
+	cached := *user
+	L1(L1UserProfile).Set(strconv.FormatInt(user.ID, 10), &cached)
+}
+
 // SetUser 设置用户信息缓存
 func (uc *UserCache) SetUser(user *models.User, expiration time.Duration) error {
 	if user == nil || user.ID == 0 {
@@ -53,19 +75,28 @@ func (uc *UserCache) SetUser(user *models.User, expiration time.Duration) error
 		return err
 	}
 
-	// 存储到Redis，默认缓存5分钟
+	// 存储到Redis，默认使用user_profile键族的过期时间
+	if !familyEnabled(familyUserProfile) {
+		return nil
+	}
 	if expiration == 0 {
-		expiration = 5 * time.Minute
+		expiration = familyTTL(familyUserProfile)
 	}
 
-	return GetRedisClient().Set(ctx, key, userData, expiration).Err()
+	if err := GetRedisClient().Set(ctx, key, userData, expiration).Err(); err != nil {
+		return err
+	}
+	uc.setL1(user)
+	return nil
 }
 
-// DeleteUser 删除用户信息缓存
+// DeleteUser 删除用户信息缓存（包括所有实例的L1）
 func (uc *UserCache) DeleteUser(userID int64) error {
 	ctx := context.Background()
 	key := fmt.Sprintf("user:profile:%d", userID)
-	return GetRedisClient().Del(ctx, key).Err()
+	err := GetRedisClient().Del(ctx, key).Err()
+	PublishInvalidation(ScopeUser, userID)
+	return err
 }
 
 // GetUsers 批量获取用户信息
@@ -75,37 +106,55 @@ func (uc *UserCache) GetUsers(userIDs []int64) (map[int64]*models.User, []int64,
 	}
 
 	ctx := context.Background()
+	cached := make(map[int64]*models.User)
+	var missed []int64
+
+	// 先查进程内L1
+	remaining := make([]int64, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if value, ok := L1(L1UserProfile).Get(strconv.FormatInt(userID, 10)); ok {
+			user := *value.(*models.User)
+			cached[userID] = &user
+		} else {
+			remaining = append(remaining, userID)
+		}
+	}
+	if len(remaining) == 0 || !familyEnabled(familyUserProfile) {
+		return cached, remaining, nil
+	}
 
 	// 构建Redis键
-	keys := make([]string, len(userIDs))
-	for i, userID := range userIDs {
+	keys := make([]string, len(remaining))
+	for i, userID := range remaining {
 		keys[i] = fmt.Sprintf("user:profile:%d", userID)
 	}
 
 	// 批量获取
 	results := GetRedisClient().MGet(ctx, keys...)
 	if results.Err() != nil {
-		return nil, userIDs, results.Err()
+		cacheLookups.WithLabelValues(layerRedis, familyUserProfile, lookupError).Add(int64(len(remaining)))
+		return cached, remaining, results.Err()
 	}
 
-	cached := make(map[int64]*models.User)
-	var missed []int64
-
 	// 处理结果
 	for i, result := range results.Val() {
-		userID := userIDs[i]
+		userID := remaining[i]
 
 		if result == nil {
 			// 缓存未命中
+			recordResult(layerRedis, familyUserProfile, lookupMiss)
 			missed = append(missed, userID)
 		} else {
 			// 反序列化用户数据
 			var user models.User
 			err := json.Unmarshal([]byte(result.(string)), &user)
 			if err != nil {
+				recordResult(layerRedis, familyUserProfile, lookupError)
 				missed = append(missed, userID)
 			} else {
+				recordResult(layerRedis, familyUserProfile, lookupHit)
 				cached[userID] = &user
+				uc.setL1(&user)
 			}
 		}
 	}
@@ -122,9 +171,12 @@ func (uc *UserCache) SetUsers(users []*models.User, expiration time.Duration) er
 	ctx := context.Background()
 	pipe := GetRedisClient().Pipeline()
 
-	// 默认缓存5分钟
+	// 默认使用user_profile键族的过期时间
+	if !familyEnabled(familyUserProfile) {
+		return nil
+	}
 	if expiration == 0 {
-		expiration = 5 * time.Minute
+		expiration = familyTTL(familyUserProfile)
 	}
 
 	for _, user := range users {
@@ -139,6 +191,7 @@ func (uc *UserCache) SetUsers(users []*models.User, expiration time.Duration) er
 		}
 
 		pipe.Set(ctx, key, userData, expiration)
+		uc.setL1(user)
 	}
 
 	_, err := pipe.Exec(ctx)
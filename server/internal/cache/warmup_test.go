@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestFriendIDsCacheDistinguishesEmptyList(t *testing.T) {
+	c, _ := newTestCacheService(t)
+
+	ids, err := c.GetFriendIDs(1)
+	require.NoError(t, err)
+	assert.Nil(t, ids)
+
+	require.NoError(t, c.WarmupFriendIDs(map[int64][]int64{1: nil, 2: {3, 4}}))
+
+	ids, err = c.GetFriendIDs(1)
+	require.NoError(t, err)
+	assert.NotNil(t, ids)
+	assert.Empty(t, ids)
+
+	ids, err = c.GetFriendIDs(2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4}, ids)
+
+	require.NoError(t, c.InvalidateFriendIDs(1, 2))
+	ids, err = c.GetFriendIDs(2)
+	require.NoError(t, err)
+	assert.Nil(t, ids)
+}
+
+func TestWarmupGroupMembersIsTagged(t *testing.T) {
+	c, mr := newTestCacheService(t)
+
+	require.NoError(t, c.WarmupGroupMembers(map[int64][]models.GroupMember{
+		3: {{GroupID: 3, UserID: 1}, {GroupID: 3, UserID: 2}},
+	}))
+
+	var members []models.GroupMember
+	require.NoError(t, c.GetGroupMembers(3, &members))
+	assert.Len(t, members, 2)
+
+	require.NoError(t, c.InvalidateGroupCache(3))
+	assert.Empty(t, mr.Keys())
+}
@@ -2,22 +2,60 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/spf13/viper"
 )
 
 // Config 全局配置结构
 type Config struct {
-	Server    ServerConfig    `mapstructure:"server"`
-	Database  DatabaseConfig  `mapstructure:"database"`
-	Redis     RedisConfig     `mapstructure:"redis"`
-	JWT       JWTConfig       `mapstructure:"jwt"`
-	WebSocket WebSocketConfig `mapstructure:"websocket"`
-	CORS      CORSConfig      `mapstructure:"cors"`
-	Log       LogConfig       `mapstructure:"log"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	Redis       RedisConfig       `mapstructure:"redis"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	Archive     ArchiveConfig     `mapstructure:"archive"`
+	Outbox      OutboxConfig      `mapstructure:"outbox"`
+	Upload      UploadConfig      `mapstructure:"upload"`
+	Storage     StorageConfig     `mapstructure:"storage"`
+	JWT         JWTConfig         `mapstructure:"jwt"`
+	WebSocket   WebSocketConfig   `mapstructure:"websocket"`
+	CORS        CORSConfig        `mapstructure:"cors"`
+	Headers     SecurityHeadersConfig `mapstructure:"security_headers"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	Concurrency ConcurrencyLimitConfig `mapstructure:"concurrency_limit"`
+	Compression CompressionConfig `mapstructure:"compression"`
+	IPBan       IPBanConfig       `mapstructure:"ip_ban"`
+	Admin       AdminConfig       `mapstructure:"admin"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Debug       DebugConfig       `mapstructure:"debug"`
+	Health      HealthConfig      `mapstructure:"health"`
+	ErrorReporting ErrorReportingConfig `mapstructure:"error_reporting"`
+	Audit       AuditConfig       `mapstructure:"audit"`
+	Login       LoginProtectionConfig `mapstructure:"login_protection"`
+	LoginRisk   LoginRiskConfig   `mapstructure:"login_risk"`
+	Filter      FilterConfig      `mapstructure:"content_filter"`
+	Email       EmailConfig       `mapstructure:"email"`
+	Bots        BotsConfig        `mapstructure:"bots"`
+	Search      SearchConfig      `mapstructure:"search"`
+	TURN        TURNConfig        `mapstructure:"turn"`
+	EventBus    EventBusConfig    `mapstructure:"event_bus"`
+	Cluster     ClusterConfig     `mapstructure:"cluster"`
+	GRPC        GRPCConfig        `mapstructure:"grpc"`
+	APIDocs     APIDocsConfig     `mapstructure:"api_docs"`
+	GraphQL     GraphQLConfig     `mapstructure:"graphql"`
+	DataExport  DataExportConfig  `mapstructure:"data_export"`
+	Analytics   AnalyticsConfig   `mapstructure:"analytics"`
+	Announcements AnnouncementsConfig `mapstructure:"announcements"`
+	MessageHooks  MessageHooksConfig  `mapstructure:"message_hooks"`
+	Log         LogConfig         `mapstructure:"log"`
 }
 
 // ServerConfig 服务器配置
@@ -25,31 +63,201 @@ type ServerConfig struct {
 	Host string `mapstructure:"host"`
 	Port int    `mapstructure:"port"`
 	Mode string `mapstructure:"mode"`
+	// NodeID 消息ID生成器的节点号（0-30，31保留给一次性命令），多实例部署时每个实例必须不同；-1（默认）表示启动时从Redis租用空闲的节点号
+	NodeID int64 `mapstructure:"node_id"`
+	// RequestTimeout 接口处理超时，超时后请求的context被取消并返回503，0表示不限制
+	RequestTimeout string `mapstructure:"request_timeout"`
+	// TimeoutExcludedPaths 不限制处理时间的路径前缀（长连接、文件上传下载）
+	TimeoutExcludedPaths []string `mapstructure:"timeout_excluded_paths"`
+	// WatchConfig 监听配置文件变化并自动热加载可热加载的配置项，未开启时可发送SIGHUP手动加载
+	WatchConfig bool `mapstructure:"watch_config"`
 }
 
 // DatabaseConfig 数据库配置
 type DatabaseConfig struct {
-	Host         string `mapstructure:"host"`
-	Port         int    `mapstructure:"port"`
-	User         string `mapstructure:"user"`
-	Password     string `mapstructure:"password"`
-	DBName       string `mapstructure:"dbname"`
-	MaxIdleConns int    `mapstructure:"max_idle_conns"`
-	MaxOpenConns int    `mapstructure:"max_open_conns"`
+	Driver        string   `mapstructure:"driver"` // mysql、postgres 或 sqlite
+	Host          string   `mapstructure:"host"`
+	Port          int      `mapstructure:"port"`
+	User          string   `mapstructure:"user"`
+	Password      string   `mapstructure:"password"`
+	DBName        string   `mapstructure:"dbname"` // sqlite时为数据库文件路径
+	MaxIdleConns  int      `mapstructure:"max_idle_conns"`
+	MaxOpenConns  int      `mapstructure:"max_open_conns"`
+	SSLMode       string   `mapstructure:"sslmode"`        // 仅postgres使用
+	Replicas      []string `mapstructure:"replicas"`       // 只读副本DSN，格式与driver一致；为空时读写都走主库
+	SlowThreshold string   `mapstructure:"slow_threshold"` // 慢查询阈值，超过时记录日志，0表示关闭
+
+	StatsInterval      string `mapstructure:"stats_interval"`       // 连接池状态采样间隔
+	TableStatsInterval string `mapstructure:"table_stats_interval"` // 表行数采样间隔
+
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
 }
 
 // RedisConfig Redis配置
 type RedisConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Password string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"`
+	Host     string         `mapstructure:"host"`
+	Port     int            `mapstructure:"port"`
+	Username string         `mapstructure:"username"` // Redis 6+ ACL用户名，为空时使用default用户
+	Password string         `mapstructure:"password"`
+	DB       int            `mapstructure:"db"`
+	TLS      RedisTLSConfig `mapstructure:"tls"`
+
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+}
+
+// CircuitBreakerConfig 熔断配置：依赖连续出错后熔断，期间请求直接失败而不是逐个等待超时
+type CircuitBreakerConfig struct {
+	Enabled          bool   `mapstructure:"enabled"`
+	FailureThreshold int    `mapstructure:"failure_threshold"`  // 连续出错达到该次数后熔断
+	OpenTimeout      string `mapstructure:"open_timeout"`       // 熔断持续时间，之后放行试探请求
+	HalfOpenRequests int    `mapstructure:"half_open_requests"` // 试探请求数，全部成功后恢复
+	ProbeInterval    string `mapstructure:"probe_interval"`     // 熔断期间主动探测依赖的间隔，探测成功后提前放行试探请求
+}
+
+// RedisTLSConfig Redis TLS配置
+type RedisTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`              // 是否使用TLS连接
+	CAFile             string `mapstructure:"ca_file"`              // CA证书，为空时使用系统根证书
+	CertFile           string `mapstructure:"cert_file"`            // 客户端证书（双向TLS）
+	KeyFile            string `mapstructure:"key_file"`             // 客户端私钥（双向TLS）
+	ServerName         string `mapstructure:"server_name"`          // 校验证书的服务器名，为空时使用host
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // 跳过证书校验，仅用于测试环境
+}
+
+// CacheConfig 缓存配置
+type CacheConfig struct {
+	Enabled  bool                         `mapstructure:"enabled"`  // 总开关，关闭后所有缓存读取均视为未命中
+	Families map[string]CacheFamilyConfig `mapstructure:"families"` // 按键族配置，键为族名（如user_profile、group_members）
+
+	// 进程内L1缓存配置
+	L1Enabled         bool   `mapstructure:"l1_enabled"`           // 是否启用L1缓存
+	L1UserProfileTTL  string `mapstructure:"l1_user_profile_ttl"`  // 用户资料L1过期时间
+	L1GroupMembersTTL string `mapstructure:"l1_group_members_ttl"` // 群成员L1过期时间
+
+	// 启动预热配置
+	WarmupEnabled   bool   `mapstructure:"warmup_enabled"`    // 启动时是否预热缓存
+	WarmupWindow    string `mapstructure:"warmup_window"`     // 预热该时间段内活跃的用户和群组
+	WarmupMaxUsers  int    `mapstructure:"warmup_max_users"`  // 最多预热的用户数
+	WarmupMaxGroups int    `mapstructure:"warmup_max_groups"` // 最多预热的群组数
+	WarmupTimeout   string `mapstructure:"warmup_timeout"`    // 预热超时时间，超时后跳过剩余部分继续启动
+}
+
+// CacheFamilyConfig 单个缓存键族的配置
+type CacheFamilyConfig struct {
+	Enabled bool   `mapstructure:"enabled"` // 是否启用该键族的缓存
+	TTL     string `mapstructure:"ttl"`     // 过期时间
+}
+
+// ArchiveConfig 消息归档配置
+type ArchiveConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`          // 是否启用后台归档任务
+	RetentionMonths int    `mapstructure:"retention_months"` // 热表保留最近N个月的消息，更早的移入归档表
+	Interval        string `mapstructure:"interval"`         // 执行间隔
+	BatchSize       int    `mapstructure:"batch_size"`       // 每批移动的消息条数
+}
+
+// OutboxConfig 发件箱中继配置
+type OutboxConfig struct {
+	PollInterval string `mapstructure:"poll_interval"` // 扫描未投递事件的间隔
+	BatchSize    int    `mapstructure:"batch_size"`    // 每次扫描处理的事件数
+	MaxAttempts  int    `mapstructure:"max_attempts"`  // 最大投递次数，超过后不再重试
+	Retention    string `mapstructure:"retention"`     // 已投递事件的保留时长
+}
+
+// UploadConfig 上传配置
+type UploadConfig struct {
+	Image         ImageUploadConfig   `mapstructure:"image"`
+	File          FileUploadConfig    `mapstructure:"file"`
+	Video         VideoUploadConfig   `mapstructure:"video"`
+	PublicStatic  bool                `mapstructure:"public_static"`   // 是否保留/uploads静态目录（不校验权限，兼容旧客户端）
+	SignedURLTTL  string              `mapstructure:"signed_url_ttl"`  // 签名下载链接的有效期
+	SigningSecret string              `mapstructure:"signing_secret"`  // 下载链接签名密钥，为空时使用JWT密钥
+	Retention     map[string]int      `mapstructure:"retention"`       // 按引用类型（chat_image、message等）的保留天数，0或未配置表示永久保留
+	PublicBaseURL string              `mapstructure:"public_base_url"` // 返回给客户端的文件和头像URL前缀（CDN或反向代理地址），为空时返回相对路径
+	Quota         UploadQuotaConfig   `mapstructure:"quota"`
+	Session       UploadSessionConfig `mapstructure:"session"`
+}
+
+// UploadSessionConfig 视频和文档的分片上传会话，会话状态保存在Redis中，分片保存在dir目录（多实例部署时各实例需共享该目录）
+type UploadSessionConfig struct {
+	Dir        string `mapstructure:"dir"`          // 分片和合并时临时文件的目录，不能位于静态文件目录uploads下
+	PartSizeMB int    `mapstructure:"part_size_mb"` // 分片大小（MB），最后一个分片可以更小
+	TTL        string `mapstructure:"ttl"`          // 会话在最后一次上传分片后的有效期，过期后分片由文件清理任务删除
+}
+
+// UploadQuotaConfig 每个用户的上传配额，计数保存在Redis中由各实例共享，与请求频率限制相互独立
+// 每日配额按UTC自然日统计；同一内容（SHA256相同）在duplicate_window内最多上传duplicate_limit次
+type UploadQuotaConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	DailyCount      int    `mapstructure:"daily_count"`      // 每天最多上传的文件数，0表示不限制
+	DailyMB         int    `mapstructure:"daily_mb"`         // 每天最多上传的字节数（MB），0表示不限制
+	DuplicateLimit  int    `mapstructure:"duplicate_limit"`  // 同一内容在统计窗口内最多上传的次数，0表示不限制
+	DuplicateWindow string `mapstructure:"duplicate_window"` // 重复上传统计窗口，从第一次上传开始计算
+}
+
+// ImageUploadConfig 聊天图片压缩配置
+type ImageUploadConfig struct {
+	MaxDimension  int  `mapstructure:"max_dimension"`  // 长边超过该像素的图片缩小后重新编码，0表示不压缩
+	Quality       int  `mapstructure:"quality"`        // JPEG重新编码质量（1-100）
+	KeepOriginal  bool `mapstructure:"keep_original"`  // 压缩时是否同时保存原图
+	StripMetadata bool `mapstructure:"strip_metadata"` // 是否去除EXIF（含GPS定位）等元数据，对头像同样生效
+}
+
+// FileUploadConfig 文档上传配置
+type FileUploadConfig struct {
+	MaxSizeMB    int      `mapstructure:"max_size_mb"`   // 单个文件大小上限（MB）
+	AllowedTypes []string `mapstructure:"allowed_types"` // 允许的MIME类型（按文件内容检测）
+}
+
+// VideoUploadConfig 视频上传配置
+type VideoUploadConfig struct {
+	MaxSizeMB          int      `mapstructure:"max_size_mb"`          // 单个视频大小上限（MB）
+	MaxDuration        string   `mapstructure:"max_duration"`         // 视频时长上限
+	AllowedVideoCodecs []string `mapstructure:"allowed_video_codecs"` // 允许的视频编码（ffprobe的codec_name）
+	AllowedAudioCodecs []string `mapstructure:"allowed_audio_codecs"` // 允许的音频编码
+	FFprobePath        string   `mapstructure:"ffprobe_path"`         // ffprobe可执行文件
+	FFmpegPath         string   `mapstructure:"ffmpeg_path"`          // ffmpeg可执行文件
+	ProbeTimeout       string   `mapstructure:"probe_timeout"`        // 单次探测/截图的超时时间
+}
+
+// StorageConfig 文件存储配置
+type StorageConfig struct {
+	S3              S3Config `mapstructure:"s3"`
+	MigrateRateMB   int      `mapstructure:"migrate_rate_mb"`   // 迁移到对象存储时的上传速率上限（MB/s），0表示不限制
+	PresignedURLTTL string   `mapstructure:"presigned_url_ttl"` // 已迁移文件下载时跳转的预签名链接有效期
+}
+
+// S3Config S3兼容对象存储配置（AWS S3、MinIO等），bucket为空表示不启用
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"` // 如https://s3.amazonaws.com、http://minio:9000
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	PathStyle bool   `mapstructure:"path_style"` // 使用endpoint/bucket/key形式的地址（MinIO通常需要开启）
 }
 
 // JWTConfig JWT配置
+// 轮换密钥：先在keys中加入新密钥并部署到所有实例，再把signing_key_id切换为新密钥，
+// 等旧密钥签发的Token全部过期（expire_hours）后删除旧密钥
 type JWTConfig struct {
-	Secret      string `mapstructure:"secret"`
+	Secret      string `mapstructure:"secret"` // 不带kid的Token使用的HS256密钥
 	ExpireHours int    `mapstructure:"expire_hours"`
+	// SigningKeyID 签发新Token使用的密钥（keys中的id），为空时用secret签发不带kid的Token
+	SigningKeyID string   `mapstructure:"signing_key_id"`
+	Keys         []JWTKey `mapstructure:"keys"` // 按Token头中的kid选择验证密钥
+	// AcceptUnkeyed 是否接受不带kid的Token（用secret验证），改用keys签发且旧Token过期后可以关闭
+	AcceptUnkeyed bool `mapstructure:"accept_unkeyed_tokens"`
+}
+
+// JWTKey JWT签名密钥，每个密钥固定一种算法，Token头中的alg与之不符时拒绝
+type JWTKey struct {
+	ID             string `mapstructure:"id"`
+	Algorithm      string `mapstructure:"algorithm"`        // HS256、HS384、HS512或RS256
+	Secret         string `mapstructure:"secret"`           // HS*密钥，至少32个字符
+	SecretEnv      string `mapstructure:"secret_env"`       // 从该环境变量读取HS*密钥，secret为空时使用
+	PrivateKeyFile string `mapstructure:"private_key_file"` // RS256私钥（PEM），只有用于签发的密钥需要
+	PublicKeyFile  string `mapstructure:"public_key_file"`  // RS256公钥（PEM）
 }
 
 // WebSocketConfig WebSocket配置
@@ -59,6 +267,43 @@ type WebSocketConfig struct {
 	MaxMessageSize  int    `mapstructure:"max_message_size"`
 	PongWait        string `mapstructure:"pong_wait"`
 	WriteWait       string `mapstructure:"write_wait"`
+
+	// 压缩配置（permessage-deflate）
+	EnableCompression    bool `mapstructure:"enable_compression"`    // 是否协商启用压缩
+	CompressionLevel     int  `mapstructure:"compression_level"`     // 压缩级别: -2~9，1为最快
+	CompressionThreshold int  `mapstructure:"compression_threshold"` // 超过该字节数的消息才压缩
+
+	// 断线续传配置
+	ResumeLogSize int    `mapstructure:"resume_log_size"` // 每个用户保留的投递记录条数
+	ResumeLogTTL  string `mapstructure:"resume_log_ttl"`  // 投递记录保留时长
+
+	// 可靠投递配置
+	AckTimeout       string `mapstructure:"ack_timeout"`        // 等待客户端ACK的超时时间
+	MaxRetries       int    `mapstructure:"max_retries"`        // 未收到ACK时的最大重试次数
+	OfflineQueueSize int    `mapstructure:"offline_queue_size"` // 每个用户离线队列的最大长度
+	OfflineTTL       string `mapstructure:"offline_ttl"`        // 离线消息保留时长
+
+	// 连接数限制，0表示不限制
+	MaxConnectionsPerUser int `mapstructure:"max_connections_per_user"` // 每个用户最大同时连接数
+	MaxConnectionsPerIP   int `mapstructure:"max_connections_per_ip"`   // 每个来源IP最大同时连接数
+
+	// 慢客户端背压配置
+	SendBufferSize    int    `mapstructure:"send_buffer_size"`    // 每个连接的发送缓冲区大小（消息条数）
+	SlowClientTimeout string `mapstructure:"slow_client_timeout"` // 缓冲区持续满载超过该时长则断开连接
+	MaxDroppedFrames  int    `mapstructure:"max_dropped_frames"`  // 丢弃消息数超过该值则断开连接，0表示不限制
+
+	// 群消息扇出配置
+	FanoutWorkers   int `mapstructure:"fanout_workers"`    // 扇出worker数量
+	FanoutQueueSize int `mapstructure:"fanout_queue_size"` // 每个worker的任务队列长度
+	FanoutBatchSize int `mapstructure:"fanout_batch_size"` // 每批处理的接收者数量
+
+	// 认证配置
+	AllowQueryToken bool   `mapstructure:"allow_query_token"` // 兼容旧客户端，允许通过?token=传递Token（会出现在访问日志中）
+	AuthTimeout     string `mapstructure:"auth_timeout"`      // 未携带Token时等待首个auth消息的超时时间
+	StreamTicketTTL string `mapstructure:"stream_ticket_ttl"` // SSE连接票据有效期，票据只能使用一次
+
+	// 音视频通话配置
+	CallRingTimeout string `mapstructure:"call_ring_timeout"` // 呼叫无人接听超过该时长记为未接来电
 }
 
 // CORSConfig CORS配置
@@ -70,6 +315,369 @@ type CORSConfig struct {
 	MaxAge             int      `mapstructure:"max_age"`
 }
 
+// SecurityHeadersConfig 安全响应头配置，值为空时不发送该响应头
+type SecurityHeadersConfig struct {
+	ContentSecurityPolicy string     `mapstructure:"content_security_policy"`
+	FrameOptions          string     `mapstructure:"frame_options"` // X-Frame-Options: DENY或SAMEORIGIN
+	ReferrerPolicy        string     `mapstructure:"referrer_policy"`
+	PermissionsPolicy     string     `mapstructure:"permissions_policy"`
+	HSTS                  HSTSConfig `mapstructure:"hsts"`
+
+	Routes []SecurityHeadersRoute `mapstructure:"routes"` // 按路由覆盖，按顺序匹配第一条
+}
+
+// HSTSConfig Strict-Transport-Security配置，仅在HTTPS请求（含反向代理X-Forwarded-Proto: https）上发送
+type HSTSConfig struct {
+	Enabled           bool   `mapstructure:"enabled"`
+	MaxAge            string `mapstructure:"max_age"`
+	IncludeSubDomains bool   `mapstructure:"include_subdomains"`
+	Preload           bool   `mapstructure:"preload"`
+}
+
+// SecurityHeadersRoute 单个路由的安全响应头，未配置的字段沿用全局值，配置为off时不发送该响应头
+type SecurityHeadersRoute struct {
+	Path                  string `mapstructure:"path"` // 路由模板（如/files/:id），以*结尾时按请求路径前缀匹配
+	ContentSecurityPolicy string `mapstructure:"content_security_policy"`
+	FrameOptions          string `mapstructure:"frame_options"`
+	ReferrerPolicy        string `mapstructure:"referrer_policy"`
+	PermissionsPolicy     string `mapstructure:"permissions_policy"`
+}
+
+// RateLimitConfig 速率限制配置（令牌桶），每个客户端（登录用户或IP）在每个请求路径上单独计数
+type RateLimitConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Global  RateLimitRule `mapstructure:"global"`  // 未归入以下类别的接口
+	Auth    RateLimitRule `mapstructure:"auth"`    // 认证接口（/auth/）
+	Message RateLimitRule `mapstructure:"message"` // 消息接口（/message/）和其他POST请求
+	Upload  RateLimitRule `mapstructure:"upload"`  // 文件上传（/upload/）
+
+	Routes      []RouteRateLimit `mapstructure:"routes"`       // 按路由覆盖类别限制，按顺序匹配第一条
+	ExemptPaths []string         `mapstructure:"exempt_paths"` // 不限速的路径前缀
+	ExemptIPs   []string         `mapstructure:"exempt_ips"`   // 不限速的来源IP或网段（CIDR），如内网健康检查、压测机
+}
+
+// RateLimitRule 令牌桶参数
+type RateLimitRule struct {
+	RPS   int64 `mapstructure:"rps"`   // 每秒补充的请求数
+	Burst int64 `mapstructure:"burst"` // 突发容量
+}
+
+// RouteRateLimit 单个路由的速率限制
+type RouteRateLimit struct {
+	Method string `mapstructure:"method"` // 为空时匹配所有方法
+	Path   string `mapstructure:"path"`   // 路由模板（如/api/v1/file/:id），以*结尾时按请求路径前缀匹配
+	RPS    int64  `mapstructure:"rps"`
+	Burst  int64  `mapstructure:"burst"`
+}
+
+// ConcurrencyLimitConfig 并发请求限制：同时处理的请求数达到上限后新请求被立即拒绝，
+// 避免流量高峰时所有请求排队等待数据库连接和磁盘IO直到超时
+type ConcurrencyLimitConfig struct {
+	Enabled     bool     `mapstructure:"enabled"`
+	MaxInFlight int      `mapstructure:"max_in_flight"` // 所有接口同时处理的请求数上限，超出返回503
+	MaxUploads  int      `mapstructure:"max_uploads"`   // 上传接口同时处理的请求数上限（同时计入max_in_flight），超出返回429，0表示不单独限制
+	UploadPaths []string `mapstructure:"upload_paths"`  // 上传接口的路径前缀
+	WaitTimeout string   `mapstructure:"wait_timeout"`  // 达到上限时等待空闲名额的最长时间，0表示立即拒绝
+	ExemptPaths []string `mapstructure:"exempt_paths"`  // 不计数的路径前缀（长连接、健康检查）
+}
+
+// IPBanConfig IP封禁配置，封禁列表保存在数据库中，各实例定期重新加载
+type IPBanConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	RefreshInterval string `mapstructure:"refresh_interval"` // 重新加载封禁列表的间隔，其他实例的封禁在该间隔内生效
+	// ExemptIPs 不会被自动封禁的IP或网段（CIDR），手动封禁不受限制
+	ExemptIPs []string      `mapstructure:"exempt_ips"`
+	AutoBan   AutoBanConfig `mapstructure:"auto_ban"`
+}
+
+// AutoBanConfig 自动封禁配置：同一IP在统计窗口内的违规次数达到阈值后封禁，阈值为0表示不检测该类违规
+type AutoBanConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Window        string `mapstructure:"window"`          // 统计窗口
+	Duration      string `mapstructure:"duration"`        // 封禁时长
+	LoginFailures int    `mapstructure:"login_failures"`  // 登录失败
+	AuthFailures  int    `mapstructure:"auth_failures"`   // Token或API密钥无效（401）
+	RateLimitHits int    `mapstructure:"rate_limit_hits"` // 触发限流
+}
+
+// LoginProtectionConfig 账号登录保护配置
+// 按手机号统计登录失败次数，计数保存在Redis中由各实例共享；失败次数增加后依次要求等待、验证码，最后临时锁定账号
+type LoginProtectionConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	Window       string `mapstructure:"window"`        // 失败次数统计窗口，从第一次失败开始计算
+	DelayAfter   int    `mapstructure:"delay_after"` // 失败达到该次数后，下次尝试前需等待base_delay，之后每次失败等待时间翻倍，0表示不限制
+	BaseDelay    string `mapstructure:"base_delay"`
+	MaxDelay     string `mapstructure:"max_delay"`     // 等待时间上限
+	CaptchaAfter int    `mapstructure:"captcha_after"` // 失败达到该次数后要求验证码，0或未配置captcha.verify_url时不要求
+	LockAfter    int    `mapstructure:"lock_after"`    // 失败达到该次数后锁定账号，0表示不锁定
+	LockDuration string `mapstructure:"lock_duration"`
+	Notify       bool   `mapstructure:"notify"` // 账号被锁定、或多次失败后登录成功时通知账号所有者
+
+	Captcha CaptchaConfig `mapstructure:"captcha"`
+}
+
+// CaptchaConfig 验证码校验配置，兼容reCAPTCHA、hCaptcha和Turnstile的siteverify接口
+type CaptchaConfig struct {
+	VerifyURL string `mapstructure:"verify_url"`
+	Secret    string `mapstructure:"secret"`
+	Timeout   string `mapstructure:"timeout"` // 校验请求超时
+}
+
+// LoginRiskConfig 登录风险检测配置
+// 密码校验通过后按设备和地区评分：达到step_up_score时要求输入发给账号所有者的验证码，达到notify_score时登录后提醒账号所有者
+type LoginRiskConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	NewDeviceScore int    `mapstructure:"new_device_score"` // 该账号从未使用过的设备
+	NewRegionScore int    `mapstructure:"new_region_score"` // 该账号的设备从未出现过的地区
+	StepUpScore    int    `mapstructure:"step_up_score"`    // 达到该分数时要求验证码，0表示不要求
+	NotifyScore    int    `mapstructure:"notify_score"`     // 达到该分数时登录后提醒，0表示不提醒
+	RegionHeader   string `mapstructure:"region_header"`    // 反向代理提供的地区请求头（如CF-IPCountry），为空时按IP网段（IPv4 /16、IPv6 /32）区分
+	MaxDevices     int    `mapstructure:"max_devices"`      // 每个账号保留的设备记录数，超出时删除最久未登录的
+	CodeTTL        string `mapstructure:"code_ttl"`         // 验证码有效期，有效期内不重新发送
+	CodeAttempts   int    `mapstructure:"code_attempts"`    // 每个验证码最多可尝试的次数
+
+	CodeWebhook CodeWebhookConfig `mapstructure:"code_webhook"`
+}
+
+// EmailConfig 邮件通知配置：安全提醒、离线消息摘要和新设备登录验证码
+// 邮件通过发件箱排队，发送失败时由发件箱中继按指数退避重试
+type EmailConfig struct {
+	Enabled      bool              `mapstructure:"enabled"`
+	From         string            `mapstructure:"from"`          // 发件人，如 GoChat <no-reply@example.com>
+	TemplatesDir string            `mapstructure:"templates_dir"` // 自定义模板目录，其中的{kind}.tmpl覆盖同名的内置模板
+	SMTP         SMTPConfig        `mapstructure:"smtp"`
+	Digest       EmailDigestConfig `mapstructure:"digest"`
+}
+
+// SMTPConfig SMTP服务器配置
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"` // 为空时不认证
+	Password string `mapstructure:"password"`
+	TLS      string `mapstructure:"tls"`     // starttls-连接后升级（587端口）, tls-直接TLS连接（465端口）, none-不加密（仅限内网中继）
+	Timeout  string `mapstructure:"timeout"` // 连接和发送的超时时间
+}
+
+// EmailDigestConfig 离线消息摘要配置：定期给不在线且有未读消息的用户发送摘要
+type EmailDigestConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Interval string `mapstructure:"interval"` // 发送间隔，同一用户的未读数没有增加时不重复发送
+	MaxItems int    `mapstructure:"max_items"` // 摘要中最多列出的会话数
+}
+
+// BotsConfig 群机器人配置：群主创建的机器人通过Incoming Webhook向群里发消息，
+// 通过Outgoing Webhook把群消息推送到外部地址
+type BotsConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	MaxPerGroup    int    `mapstructure:"max_per_group"`   // 每个群最多创建的机器人数
+	WebhookTimeout string `mapstructure:"webhook_timeout"` // Outgoing Webhook的请求超时
+	// AllowPrivateNetworks 允许Outgoing Webhook访问内网和回环地址，默认禁止，防止借机器人访问内部服务
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks"`
+}
+
+// SearchConfig 全局搜索配置：backend为database时直接查询数据库（有全文索引时使用FULLTEXT），
+// 为elasticsearch时消息由发件箱异步写入索引，搜索时查询Elasticsearch
+type SearchConfig struct {
+	Backend          string              `mapstructure:"backend"`            // database 或 elasticsearch
+	ReindexBatchSize int                 `mapstructure:"reindex_batch_size"` // 重建索引时每批写入的消息数
+	Elasticsearch    ElasticsearchConfig `mapstructure:"elasticsearch"`
+}
+
+// ElasticsearchConfig Elasticsearch连接配置
+type ElasticsearchConfig struct {
+	URL      string `mapstructure:"url"`      // 如http://localhost:9200
+	Index    string `mapstructure:"index"`    // 消息索引名，不存在时启动时创建
+	Analyzer string `mapstructure:"analyzer"` // 消息内容的分词器，中文建议安装IK插件后使用ik_max_word
+	Username string `mapstructure:"username"` // 为空时不认证
+	Password string `mapstructure:"password"`
+	Timeout  string `mapstructure:"timeout"` // 请求超时
+}
+
+// TURNConfig 音视频通话使用的STUN/TURN服务器
+// TURN凭证按RFC 5766 TURN REST API的约定签发：username为"过期时间戳:用户ID"，credential为base64(HMAC-SHA1(secret, username))，
+// TURN服务器（如coturn的use-auth-secret + static-auth-secret）使用相同的secret校验，无需为每个用户创建账号
+type TURNConfig struct {
+	STUNURLs      []string `mapstructure:"stun_urls"`      // STUN地址，如stun:stun.example.com:3478
+	URLs          []string `mapstructure:"urls"`           // TURN地址，如turn:turn.example.com:3478?transport=udp、turns:turn.example.com:5349
+	Secret        string   `mapstructure:"secret"`         // 与TURN服务器共享的密钥，配置了TURN地址时必填
+	CredentialTTL string   `mapstructure:"credential_ttl"` // 凭证有效期，应覆盖一次通话的最长时长
+	MaxPerHour    int      `mapstructure:"max_per_hour"`   // 每个用户每小时最多签发的凭证数，0表示不限制
+}
+
+// EventBusConfig 领域事件总线：新消息、用户注册、建群等事件经发件箱发布到消息总线，供统计、搜索索引、推送等独立的消费者订阅
+// backend为none时不连接外部总线，事件只投递给本进程内的订阅者
+type EventBusConfig struct {
+	Backend     string      `mapstructure:"backend"`      // none、nats 或 kafka
+	TopicPrefix string      `mapstructure:"topic_prefix"` // 主题前缀，主题为 前缀.事件类型，如gochat.message.sent
+	Timeout     string      `mapstructure:"timeout"`      // 单次发布的超时时间
+	NATS        NATSConfig  `mapstructure:"nats"`
+	Kafka       KafkaConfig `mapstructure:"kafka"`
+}
+
+// NATSConfig NATS连接配置
+type NATSConfig struct {
+	URL      string `mapstructure:"url"`      // 如nats://localhost:4222，使用TLS时为tls://
+	Username string `mapstructure:"username"` // 用户名密码和Token都为空时不认证
+	Password string `mapstructure:"password"`
+	Token    string `mapstructure:"token"`
+}
+
+// KafkaConfig Kafka配置，通过Kafka REST Proxy（v2接口）发布
+type KafkaConfig struct {
+	RESTProxyURL string `mapstructure:"rest_proxy_url"` // 如http://localhost:8082
+	Username     string `mapstructure:"username"`       // 为空时不认证
+	Password     string `mapstructure:"password"`
+}
+
+// ClusterConfig 拆分部署：gateway进程只维持WebSocket连接，聊天消息的保存、确定接收者和扇出由worker进程处理，
+// 两者通过Redis通信，连接数和计算量可以分别扩容
+type ClusterConfig struct {
+	Role          string `mapstructure:"role"`           // all（默认，单进程处理全部）、gateway 或 worker
+	InboundShards int    `mapstructure:"inbound_shards"` // 转发队列的分片数，同一用户的消息落在同一分片按顺序处理，所有实例必须相同
+	ShardLease    string `mapstructure:"shard_lease"`    // worker持有一个分片的时长，到期后释放，分片在worker之间轮换
+}
+
+// GRPCConfig 内部gRPC接口：供推送、搜索、统计等内部服务调用用户、群组和消息服务，不经过对外的HTTP接口，只应在内网监听
+type GRPCConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Addr    string `mapstructure:"addr"`  // 监听地址，如:9090
+	Token   string `mapstructure:"token"` // 调用方在metadata中携带authorization: Bearer <token>，启用时必填，至少16个字符
+}
+
+// APIDocsConfig 接口文档：/api/v1/openapi.json返回OpenAPI规范，/api/v1/docs为文档页面，不需要登录
+type APIDocsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// GraphQLConfig GraphQL查询接口：POST /api/v1/graphql，需要登录，一次请求获取用户、好友、会话和消息
+type GraphQLConfig struct {
+	Enabled        bool `mapstructure:"enabled"`
+	MaxDepth       int  `mapstructure:"max_depth"`        // 查询的最大嵌套层数
+	MaxQueryLength int  `mapstructure:"max_query_length"` // 查询语句的最大长度（字节）
+	Introspection  bool `mapstructure:"introspection"`    // 是否允许内省查询（__schema、__type），客户端工具据此获取schema
+}
+
+// DataExportConfig 用户数据导出：用户申请后由后台任务生成包含个人资料、好友、群组、消息和文件信息的压缩包
+// 配置了对象存储时压缩包上传到对象存储，否则保存在dir目录（多实例部署时各实例需共享该目录）
+type DataExportConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	Dir          string `mapstructure:"dir"`           // 压缩包和生成时临时文件的目录，不能位于静态文件目录uploads下
+	Retention    string `mapstructure:"retention"`     // 压缩包保留时长，过期后删除
+	Cooldown     string `mapstructure:"cooldown"`      // 同一用户两次申请导出的最小间隔，0表示不限制
+	PollInterval string `mapstructure:"poll_interval"` // 后台任务检查待处理导出的间隔
+}
+
+// AnalyticsConfig 统计汇总：后台任务定期把每小时的消息数、每天的活跃用户和群活跃度从消息表汇总到统计表，
+// 供运营统计接口按消息类型、群排行和留存查询；多实例部署时通过分布式锁只由一个实例执行
+type AnalyticsConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	Interval     string `mapstructure:"interval"`      // 汇总间隔
+	Lookback     string `mapstructure:"lookback"`      // 每次重新汇总最近多长时间的数据，覆盖延迟写入的消息
+	BackfillDays int    `mapstructure:"backfill_days"` // 首次运行或停机后最多补算的天数
+}
+
+// AnnouncementsConfig 系统公告：管理员发布的公告通过WebSocket推送给在线的目标用户，并保存供离线用户上线后拉取；
+// 定时公告由后台任务在发布时间到达后发布，多实例部署时通过行级领取保证只发布一次
+type AnnouncementsConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	PollInterval   string `mapstructure:"poll_interval"`    // 后台任务检查到期定时公告的间隔
+	MaxTargetUsers int    `mapstructure:"max_target_users"` // 按用户ID定向时最多指定的用户数
+}
+
+// MessageHooksConfig 消息处理扩展点：部署方在代码中注册的消息钩子（保存前、保存后、推送前）的执行参数
+type MessageHooksConfig struct {
+	Timeout  string   `mapstructure:"timeout"`  // 单个钩子的执行超时，通过context传给钩子
+	Disabled []string `mapstructure:"disabled"` // 不执行的钩子名称，用于不改代码临时关闭出问题的插件
+}
+
+// CodeWebhookConfig 验证码发送网关：验证码以签名的JSON POST到url，由网关发送短信（签名格式见webhook包）
+// 未配置时验证码只推送到该账号已登录的其他设备和通知邮箱
+type CodeWebhookConfig struct {
+	URL     string `mapstructure:"url"`
+	Secret  string `mapstructure:"secret"`
+	Timeout string `mapstructure:"timeout"`
+}
+
+// AdminConfig 管理接口配置，请求需来自内网并在X-Admin-Token请求头中携带token，token为空时不开放管理接口
+type AdminConfig struct {
+	Token string           `mapstructure:"token"`
+	Stats AdminStatsConfig `mapstructure:"stats"`
+}
+
+// AdminStatsConfig 运营统计接口配置，按UTC日期统计
+type AdminStatsConfig struct {
+	MaxDays  int    `mapstructure:"max_days"`  // 单次查询的最大天数
+	CacheTTL string `mapstructure:"cache_ttl"` // 当天和总量统计的缓存时长，已结束日期的统计缓存7天
+}
+
+// MetricsConfig Prometheus指标接口配置，接口只允许内网访问
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`  // 接口路径
+	Token   string `mapstructure:"token"` // 配置后抓取请求还需携带Authorization: Bearer <token>
+}
+
+// DebugConfig 运行时诊断接口配置（net/http/pprof和expvar），用于排查goroutine泄漏、内存和CPU问题，默认关闭
+type DebugConfig struct {
+	Pprof bool `mapstructure:"pprof"`
+	// Addr 诊断接口单独监听的地址（如127.0.0.1:6060），为空时挂载到主端口的/admin/debug/下，需配置admin.token
+	Addr string `mapstructure:"addr"`
+}
+
+// HealthConfig 健康检查配置，检查数据库、Redis和上传目录
+type HealthConfig struct {
+	Timeout  string `mapstructure:"timeout"`   // 单次检查的超时时间，超时的依赖按失败处理
+	CacheTTL string `mapstructure:"cache_ttl"` // 检查结果的缓存时长，避免负载均衡频繁探测时反复访问依赖，0表示不缓存
+	// DrainDelay 收到关闭信号后/readyz先返回503，等待该时长让负载均衡摘除实例后再停止接收请求，0表示立即关闭
+	DrainDelay string `mapstructure:"drain_delay"`
+}
+
+// ErrorReportingConfig 错误上报配置，上报panic、5xx错误和后台任务失败，dsn为空时不上报
+type ErrorReportingConfig struct {
+	DSN         string  `mapstructure:"dsn"`         // Sentry兼容的DSN，如https://<key>@sentry.example.com/<project_id>
+	Environment string  `mapstructure:"environment"` // 环境名称，为空时使用server.mode
+	Release     string  `mapstructure:"release"`     // 版本号，为空时使用构建版本（buildinfo.Version）
+	SampleRate  float64 `mapstructure:"sample_rate"` // 采样率（0-1），1表示全部上报
+	Timeout     string  `mapstructure:"timeout"`     // 单次上报的超时时间
+	QueueSize   int     `mapstructure:"queue_size"`  // 待上报队列长度，队列满时丢弃新的错误
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	Retention       string `mapstructure:"retention"`        // 保留时长，超过后由清理任务删除，0表示永久保留
+	CleanupInterval string `mapstructure:"cleanup_interval"` // 清理间隔
+}
+
+// FilterConfig 敏感词过滤配置
+type FilterConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// WordsFile 词库文件，每行一个词（不区分大小写），以re:开头的行为正则表达式，#开头为注释；修改后自动重新加载
+	WordsFile      string `mapstructure:"words_file"`
+	ReloadInterval string `mapstructure:"reload_interval"` // 检查词库文件是否修改的间隔
+	MessageMode    string `mapstructure:"message_mode"`    // 文本消息的处理方式: reject-拒绝发送, mask-替换为mask_char, flag-放行并记录审计日志
+	NicknameMode   string `mapstructure:"nickname_mode"`   // 昵称的处理方式
+	MaskChar       string `mapstructure:"mask_char"`
+
+	GroupOverrides []GroupFilterOverride `mapstructure:"group_overrides"` // 按群覆盖消息的处理方式和词库
+}
+
+// GroupFilterOverride 单个群的过滤设置
+type GroupFilterOverride struct {
+	GroupID int64    `mapstructure:"group_id"`
+	Mode    string   `mapstructure:"mode"`  // 为空时沿用message_mode，off表示该群不过滤
+	Words   []string `mapstructure:"words"` // 该群额外的敏感词，格式与词库文件相同
+}
+
+// CompressionConfig 响应压缩配置（gzip/deflate）
+type CompressionConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	Level         int      `mapstructure:"level"`          // 压缩级别1-9，越大压缩率越高、CPU开销越大
+	MinSize       int      `mapstructure:"min_size"`       // 小于该字节数的响应不压缩
+	ContentTypes  []string `mapstructure:"content_types"`  // 压缩的响应类型，以*结尾时按前缀匹配（如text/*）
+	ExcludedPaths []string `mapstructure:"excluded_paths"` // 不压缩的路径前缀，如SSE推送
+}
+
 // LogConfig 日志配置
 type LogConfig struct {
 	Level  string `mapstructure:"level"`  // 日志级别: debug/info/warn/error
@@ -88,6 +696,22 @@ func Init(configPath string) (*Config, error) {
 	viper.AutomaticEnv()
 	viper.BindEnv("jwt.secret", "JWT_SECRET")
 	viper.BindEnv("database.password", "DB_PASSWORD")
+	viper.BindEnv("redis.username", "REDIS_USERNAME")
+	viper.BindEnv("redis.password", "REDIS_PASSWORD")
+	viper.BindEnv("server.node_id", "NODE_ID")
+	viper.BindEnv("upload.signing_secret", "UPLOAD_SIGNING_SECRET")
+	viper.BindEnv("storage.s3.access_key", "S3_ACCESS_KEY")
+	viper.BindEnv("storage.s3.secret_key", "S3_SECRET_KEY")
+	viper.BindEnv("login_protection.captcha.secret", "CAPTCHA_SECRET")
+	viper.BindEnv("login_risk.code_webhook.secret", "LOGIN_CODE_WEBHOOK_SECRET")
+	viper.BindEnv("metrics.token", "METRICS_TOKEN")
+	viper.BindEnv("error_reporting.dsn", "SENTRY_DSN")
+	viper.BindEnv("email.smtp.password", "SMTP_PASSWORD")
+	viper.BindEnv("turn.secret", "TURN_SECRET")
+	viper.BindEnv("event_bus.nats.password", "NATS_PASSWORD")
+	viper.BindEnv("event_bus.nats.token", "NATS_TOKEN")
+	viper.BindEnv("event_bus.kafka.password", "KAFKA_PASSWORD")
+	viper.BindEnv("grpc.token", "GRPC_TOKEN")
 
 	// 设置默认值
 	setDefaults()
@@ -104,6 +728,7 @@ func Init(configPath string) (*Config, error) {
 	if err := validateConfig(&AppConfig); err != nil {
 		return nil, err
 	}
+	current.Store(&AppConfig)
 
 	return &AppConfig, nil
 }
@@ -113,7 +738,14 @@ func setDefaults() {
 	viper.SetDefault("server.host", "0.0.0.0")
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.mode", "debug")
+	viper.SetDefault("server.node_id", -1)
+	viper.SetDefault("server.request_timeout", "10s")
+	viper.SetDefault("server.watch_config", false)
+	viper.SetDefault("server.timeout_excluded_paths", []string{
+		"/ws", "/api/v1/events", "/api/v1/upload/", "/api/v1/file/", "/files/", "/uploads/", "/admin/debug/",
+	})
 
+	viper.SetDefault("database.driver", "mysql")
 	viper.SetDefault("database.host", "localhost")
 	viper.SetDefault("database.port", 3306)
 	viper.SetDefault("database.user", "root")
@@ -121,21 +753,130 @@ func setDefaults() {
 	viper.SetDefault("database.dbname", "im_db")
 	viper.SetDefault("database.max_idle_conns", 10)
 	viper.SetDefault("database.max_open_conns", 100)
+	viper.SetDefault("database.sslmode", "disable")
+	viper.SetDefault("database.slow_threshold", "200ms")
+	viper.SetDefault("database.stats_interval", "15s")
+	viper.SetDefault("database.table_stats_interval", "5m")
+	viper.SetDefault("database.circuit_breaker.enabled", true)
+	viper.SetDefault("database.circuit_breaker.failure_threshold", 10)
+	viper.SetDefault("database.circuit_breaker.open_timeout", "10s")
+	viper.SetDefault("database.circuit_breaker.half_open_requests", 3)
+	viper.SetDefault("database.circuit_breaker.probe_interval", "2s")
 
 	viper.SetDefault("redis.host", "localhost")
 	viper.SetDefault("redis.port", 6379)
 	viper.SetDefault("redis.password", "")
 	viper.SetDefault("redis.db", 0)
+	viper.SetDefault("redis.username", "")
+	viper.SetDefault("redis.tls.enabled", false)
+	viper.SetDefault("redis.tls.insecure_skip_verify", false)
+	viper.SetDefault("redis.circuit_breaker.enabled", true)
+	viper.SetDefault("redis.circuit_breaker.failure_threshold", 5)
+	viper.SetDefault("redis.circuit_breaker.open_timeout", "30s")
+	viper.SetDefault("redis.circuit_breaker.half_open_requests", 3)
+	viper.SetDefault("redis.circuit_breaker.probe_interval", "2s")
+
+	viper.SetDefault("cache.enabled", true)
+	for family, ttl := range map[string]string{
+		"user_profile":      "30m",
+		"user_phone":        "30m",
+		"user_friends":      "15m",
+		"private_messages":  "5m",
+		"group_messages":    "5m",
+		"last_message":      "5m",
+		"conversation_list": "10m",
+		"group_info":        "30m",
+		"group_members":     "30m",
+	} {
+		viper.SetDefault("cache.families."+family+".enabled", true)
+		viper.SetDefault("cache.families."+family+".ttl", ttl)
+	}
+	viper.SetDefault("cache.l1_enabled", true)
+	viper.SetDefault("cache.l1_user_profile_ttl", "30s")
+	viper.SetDefault("cache.l1_group_members_ttl", "10s")
+	viper.SetDefault("cache.warmup_enabled", false)
+	viper.SetDefault("cache.warmup_window", "24h")
+	viper.SetDefault("cache.warmup_max_users", 5000)
+	viper.SetDefault("cache.warmup_max_groups", 500)
+	viper.SetDefault("cache.warmup_timeout", "30s")
+
+	viper.SetDefault("archive.enabled", false)
+	viper.SetDefault("archive.retention_months", 6)
+	viper.SetDefault("archive.interval", "24h")
+	viper.SetDefault("archive.batch_size", 1000)
+
+	viper.SetDefault("outbox.poll_interval", "5s")
+	viper.SetDefault("outbox.batch_size", 100)
+	viper.SetDefault("outbox.max_attempts", 10)
+	viper.SetDefault("outbox.retention", "72h")
+
+	viper.SetDefault("upload.image.max_dimension", 2048)
+	viper.SetDefault("upload.image.quality", 85)
+	viper.SetDefault("upload.image.keep_original", false)
+	viper.SetDefault("upload.image.strip_metadata", true)
+	viper.SetDefault("upload.file.max_size_mb", 20)
+	viper.SetDefault("upload.file.allowed_types", []string{
+		"application/pdf",
+		"application/zip", // docx/xlsx/pptx等Office文档同为zip格式
+		"application/x-rar-compressed",
+		"application/x-gzip",
+		"text/plain",
+	})
+	viper.SetDefault("upload.video.max_size_mb", 100)
+	viper.SetDefault("upload.video.max_duration", "5m")
+	viper.SetDefault("upload.video.allowed_video_codecs", []string{"h264", "hevc", "vp8", "vp9", "av1"})
+	viper.SetDefault("upload.video.allowed_audio_codecs", []string{"aac", "mp3", "opus", "vorbis"})
+	viper.SetDefault("upload.video.ffprobe_path", "ffprobe")
+	viper.SetDefault("upload.video.ffmpeg_path", "ffmpeg")
+	viper.SetDefault("upload.video.probe_timeout", "30s")
+	viper.SetDefault("upload.public_static", true)
+	viper.SetDefault("upload.signed_url_ttl", "10m")
+	viper.SetDefault("upload.quota.enabled", true)
+	viper.SetDefault("upload.quota.daily_count", 500)
+	viper.SetDefault("upload.quota.daily_mb", 1024)
+	viper.SetDefault("upload.quota.duplicate_limit", 20)
+	viper.SetDefault("upload.quota.duplicate_window", "1h")
+	viper.SetDefault("upload.session.dir", "./upload_sessions")
+	viper.SetDefault("upload.session.part_size_mb", 5)
+	viper.SetDefault("upload.session.ttl", "24h")
+
+	viper.SetDefault("storage.s3.endpoint", "https://s3.amazonaws.com")
+	viper.SetDefault("storage.s3.region", "us-east-1")
+	viper.SetDefault("storage.migrate_rate_mb", 20)
+	viper.SetDefault("storage.presigned_url_ttl", "10m")
 
 	// JWT密钥必须通过环境变量或配置文件设置，不提供不安全的默认值
 	// 在生产环境中必须设置 JWT_SECRET 环境变量
 	viper.SetDefault("jwt.expire_hours", 168)
+	viper.SetDefault("jwt.signing_key_id", "")
+	viper.SetDefault("jwt.accept_unkeyed_tokens", true)
 
 	viper.SetDefault("websocket.read_buffer_size", 1024)
 	viper.SetDefault("websocket.write_buffer_size", 1024)
 	viper.SetDefault("websocket.max_message_size", 10240)
 	viper.SetDefault("websocket.pong_wait", "60s")
 	viper.SetDefault("websocket.write_wait", "10s")
+	viper.SetDefault("websocket.enable_compression", true)
+	viper.SetDefault("websocket.compression_level", 1)
+	viper.SetDefault("websocket.compression_threshold", 1024) // 1KB以下的小消息不压缩
+	viper.SetDefault("websocket.resume_log_size", 500)
+	viper.SetDefault("websocket.resume_log_ttl", "24h")
+	viper.SetDefault("websocket.ack_timeout", "10s")
+	viper.SetDefault("websocket.max_retries", 3)
+	viper.SetDefault("websocket.offline_queue_size", 1000)
+	viper.SetDefault("websocket.offline_ttl", "168h")
+	viper.SetDefault("websocket.max_connections_per_user", 5)
+	viper.SetDefault("websocket.max_connections_per_ip", 50)
+	viper.SetDefault("websocket.send_buffer_size", 256)
+	viper.SetDefault("websocket.slow_client_timeout", "10s")
+	viper.SetDefault("websocket.max_dropped_frames", 100)
+	viper.SetDefault("websocket.fanout_workers", 8)
+	viper.SetDefault("websocket.fanout_queue_size", 1024)
+	viper.SetDefault("websocket.fanout_batch_size", 200)
+	viper.SetDefault("websocket.allow_query_token", true)
+	viper.SetDefault("websocket.auth_timeout", "5s")
+	viper.SetDefault("websocket.stream_ticket_ttl", "30s")
+	viper.SetDefault("websocket.call_ring_timeout", "45s")
 
 	// 生产环境应配置具体的允许域名，开发环境默认允许本地域名
 	viper.SetDefault("cors.allowed_origins", []string{"http://localhost:3000", "http://127.0.0.1:3000"})
@@ -144,6 +885,201 @@ func setDefaults() {
 	viper.SetDefault("cors.allowed_headers", []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With"})
 	viper.SetDefault("cors.max_age", 86400) // 24小时
 
+	// API只返回JSON，默认禁止加载任何资源和被嵌入；用户上传的文件可能被浏览器直接打开，只允许展示图片和音视频并放入沙箱
+	uploadCSP := "default-src 'none'; img-src 'self' data:; media-src 'self'; style-src 'unsafe-inline'; sandbox"
+	viper.SetDefault("security_headers.content_security_policy", "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'")
+	viper.SetDefault("security_headers.frame_options", "DENY")
+	viper.SetDefault("security_headers.referrer_policy", "strict-origin-when-cross-origin")
+	viper.SetDefault("security_headers.permissions_policy", "accelerometer=(), camera=(), geolocation=(), gyroscope=(), microphone=(), payment=(), usb=()")
+	viper.SetDefault("security_headers.hsts.enabled", true)
+	viper.SetDefault("security_headers.hsts.max_age", "8760h") // 一年
+	viper.SetDefault("security_headers.hsts.include_subdomains", true)
+	viper.SetDefault("security_headers.hsts.preload", true)
+	viper.SetDefault("security_headers.routes", []map[string]interface{}{
+		{"path": "/uploads/*", "content_security_policy": uploadCSP},
+		{"path": "/files/*", "content_security_policy": uploadCSP},
+		{"path": "/api/v1/file/*", "content_security_policy": uploadCSP},
+		// 文档页面只使用内联样式，不加载脚本
+		{"path": "/api/v1/docs", "content_security_policy": "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"},
+	})
+
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.global.rps", 100)
+	viper.SetDefault("rate_limit.global.burst", 200)
+	viper.SetDefault("rate_limit.auth.rps", 5) // 认证接口更严格，防止暴力破解
+	viper.SetDefault("rate_limit.auth.burst", 10)
+	viper.SetDefault("rate_limit.message.rps", 10)
+	viper.SetDefault("rate_limit.message.burst", 20)
+	viper.SetDefault("rate_limit.upload.rps", 3)
+	viper.SetDefault("rate_limit.upload.burst", 5)
+	viper.SetDefault("rate_limit.exempt_paths", []string{"/api/v1/health", "/healthz", "/readyz"})
+
+	viper.SetDefault("concurrency_limit.enabled", true)
+	viper.SetDefault("concurrency_limit.max_in_flight", 500)
+	viper.SetDefault("concurrency_limit.max_uploads", 20)
+	viper.SetDefault("concurrency_limit.upload_paths", []string{"/api/v1/upload/", "/api/v1/user/upload-avatar"})
+	viper.SetDefault("concurrency_limit.wait_timeout", "50ms") // 只吸收瞬时突发，不排队
+	viper.SetDefault("concurrency_limit.exempt_paths", []string{"/ws", "/api/v1/events", "/api/v1/health", "/healthz", "/readyz", "/debug/", "/admin/", "/metrics"})
+
+	viper.SetDefault("compression.enabled", true)
+	viper.SetDefault("compression.level", 5)
+	viper.SetDefault("compression.min_size", 1024)
+	viper.SetDefault("compression.content_types", []string{"application/json", "text/plain"})
+	viper.SetDefault("compression.excluded_paths", []string{"/api/v1/events"})
+
+	viper.SetDefault("ip_ban.enabled", true)
+	viper.SetDefault("ip_ban.refresh_interval", "30s")
+	viper.SetDefault("ip_ban.exempt_ips", []string{"127.0.0.1", "::1"})
+	viper.SetDefault("ip_ban.auto_ban.enabled", true)
+	viper.SetDefault("ip_ban.auto_ban.window", "10m")
+	viper.SetDefault("ip_ban.auto_ban.duration", "1h")
+	viper.SetDefault("ip_ban.auto_ban.login_failures", 20)
+	viper.SetDefault("ip_ban.auto_ban.auth_failures", 100)
+	viper.SetDefault("ip_ban.auto_ban.rate_limit_hits", 300)
+
+	viper.SetDefault("admin.token", "")
+	viper.SetDefault("admin.stats.max_days", 90)
+	viper.SetDefault("admin.stats.cache_ttl", "5m")
+
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("metrics.token", "")
+
+	viper.SetDefault("debug.pprof", false)
+	viper.SetDefault("debug.addr", "")
+
+	viper.SetDefault("health.timeout", "2s")
+	viper.SetDefault("health.cache_ttl", "1s")
+	viper.SetDefault("health.drain_delay", "0s")
+
+	viper.SetDefault("error_reporting.dsn", "")
+	viper.SetDefault("error_reporting.environment", "")
+	viper.SetDefault("error_reporting.release", "")
+	viper.SetDefault("error_reporting.sample_rate", 1.0)
+	viper.SetDefault("error_reporting.timeout", "5s")
+	viper.SetDefault("error_reporting.queue_size", 100)
+
+	viper.SetDefault("audit.retention", "2160h") // 90天
+	viper.SetDefault("audit.cleanup_interval", "24h")
+
+	viper.SetDefault("login_protection.enabled", true)
+	viper.SetDefault("login_protection.window", "15m")
+	viper.SetDefault("login_protection.delay_after", 3)
+	viper.SetDefault("login_protection.base_delay", "1s")
+	viper.SetDefault("login_protection.max_delay", "30s")
+	viper.SetDefault("login_protection.captcha_after", 5)
+	viper.SetDefault("login_protection.lock_after", 10)
+	viper.SetDefault("login_protection.lock_duration", "15m")
+	viper.SetDefault("login_protection.notify", true)
+	viper.SetDefault("login_protection.captcha.verify_url", "")
+	viper.SetDefault("login_protection.captcha.timeout", "5s")
+
+	viper.SetDefault("login_risk.enabled", true)
+	viper.SetDefault("login_risk.new_device_score", 50)
+	viper.SetDefault("login_risk.new_region_score", 40)
+	viper.SetDefault("login_risk.step_up_score", 80) // 新设备且新地区
+	viper.SetDefault("login_risk.notify_score", 50)  // 新设备
+	viper.SetDefault("login_risk.region_header", "")
+	viper.SetDefault("login_risk.max_devices", 20)
+	viper.SetDefault("login_risk.code_ttl", "10m")
+	viper.SetDefault("login_risk.code_attempts", 5)
+	viper.SetDefault("login_risk.code_webhook.url", "")
+	viper.SetDefault("login_risk.code_webhook.timeout", "5s")
+
+	viper.SetDefault("content_filter.enabled", false)
+	viper.SetDefault("content_filter.words_file", "./config/sensitive_words.txt")
+	viper.SetDefault("content_filter.reload_interval", "30s")
+	viper.SetDefault("content_filter.message_mode", "mask")
+	viper.SetDefault("content_filter.nickname_mode", "reject")
+	viper.SetDefault("content_filter.mask_char", "*")
+
+	viper.SetDefault("email.enabled", false)
+	viper.SetDefault("email.from", "")
+	viper.SetDefault("email.templates_dir", "")
+	viper.SetDefault("email.smtp.host", "")
+	viper.SetDefault("email.smtp.port", 587)
+	viper.SetDefault("email.smtp.username", "")
+	viper.SetDefault("email.smtp.password", "")
+	viper.SetDefault("email.smtp.tls", "starttls")
+	viper.SetDefault("email.smtp.timeout", "10s")
+	viper.SetDefault("email.digest.enabled", true)
+	viper.SetDefault("email.digest.interval", "24h")
+	viper.SetDefault("email.digest.max_items", 5)
+
+	viper.SetDefault("bots.enabled", true)
+	viper.SetDefault("bots.max_per_group", 5)
+	viper.SetDefault("bots.webhook_timeout", "5s")
+	viper.SetDefault("bots.allow_private_networks", false)
+
+	viper.SetDefault("search.backend", "database")
+	viper.SetDefault("search.reindex_batch_size", 500)
+	viper.SetDefault("search.elasticsearch.url", "http://localhost:9200")
+	viper.SetDefault("search.elasticsearch.index", "gochat_messages")
+	viper.SetDefault("search.elasticsearch.analyzer", "standard")
+	viper.SetDefault("search.elasticsearch.username", "")
+	viper.SetDefault("search.elasticsearch.password", "")
+	viper.SetDefault("search.elasticsearch.timeout", "5s")
+
+	// 音视频通话的STUN/TURN服务器，默认不配置（只能在可直连的网络间通话）
+	viper.SetDefault("turn.stun_urls", []string{})
+	viper.SetDefault("turn.urls", []string{})
+	viper.SetDefault("turn.secret", "")
+	viper.SetDefault("turn.credential_ttl", "12h")
+	viper.SetDefault("turn.max_per_hour", 30)
+
+	// 领域事件总线，默认只投递给进程内的订阅者
+	viper.SetDefault("event_bus.backend", "none")
+	viper.SetDefault("event_bus.topic_prefix", "gochat")
+	viper.SetDefault("event_bus.timeout", "5s")
+	viper.SetDefault("event_bus.nats.url", "nats://localhost:4222")
+	viper.SetDefault("event_bus.nats.username", "")
+	viper.SetDefault("event_bus.nats.password", "")
+	viper.SetDefault("event_bus.nats.token", "")
+	viper.SetDefault("event_bus.kafka.rest_proxy_url", "http://localhost:8082")
+	viper.SetDefault("event_bus.kafka.username", "")
+	viper.SetDefault("event_bus.kafka.password", "")
+
+	// 拆分部署，默认单进程处理全部
+	viper.SetDefault("cluster.role", "all")
+	viper.SetDefault("cluster.inbound_shards", 32)
+	viper.SetDefault("cluster.shard_lease", "30s")
+
+	// 内部gRPC接口，默认关闭
+	viper.SetDefault("grpc.enabled", false)
+	viper.SetDefault("grpc.addr", ":9090")
+	viper.SetDefault("grpc.token", "")
+
+	// 接口文档
+	viper.SetDefault("api_docs.enabled", true)
+
+	// GraphQL查询接口
+	viper.SetDefault("graphql.enabled", true)
+	viper.SetDefault("graphql.max_depth", 8)
+	viper.SetDefault("graphql.max_query_length", 10000)
+	viper.SetDefault("graphql.introspection", true)
+
+	// 用户数据导出
+	viper.SetDefault("data_export.enabled", true)
+	viper.SetDefault("data_export.dir", "./exports")
+	viper.SetDefault("data_export.retention", "168h")
+	viper.SetDefault("data_export.cooldown", "24h")
+	viper.SetDefault("data_export.poll_interval", "10s")
+
+	// 统计汇总
+	viper.SetDefault("analytics.enabled", true)
+	viper.SetDefault("analytics.interval", "10m")
+	viper.SetDefault("analytics.lookback", "2h")
+	viper.SetDefault("analytics.backfill_days", 30)
+
+	// 系统公告
+	viper.SetDefault("announcements.enabled", true)
+	viper.SetDefault("announcements.poll_interval", "15s")
+	viper.SetDefault("announcements.max_target_users", 10000)
+
+	// 消息钩子
+	viper.SetDefault("message_hooks.timeout", "2s")
+	viper.SetDefault("message_hooks.disabled", []string{})
+
 	viper.SetDefault("log.level", "info")
 	viper.SetDefault("log.dir", "./logs")
 	viper.SetDefault("log.output", "both") // console/file/both
@@ -170,24 +1106,707 @@ func validateConfig(cfg *Config) error {
 	   len(cfg.JWT.Secret) < 32 {
 		return fmt.Errorf("JWT secret is not secure. Please use a strong secret key with at least 32 characters")
 	}
+	if err := validateJWTKeys(&cfg.JWT); err != nil {
+		return err
+	}
 
 	// 验证服务器配置
 	if cfg.Server.Port <= 0 || cfg.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", cfg.Server.Port)
 	}
 
+	if timeout, err := time.ParseDuration(cfg.Server.RequestTimeout); err != nil || timeout < 0 {
+		return fmt.Errorf("invalid server request_timeout: %q", cfg.Server.RequestTimeout)
+	}
+
 	// 验证数据库配置
-	if cfg.Database.Host == "" {
+	switch cfg.Database.Driver {
+	case "mysql", "postgres", "sqlite":
+	default:
+		return fmt.Errorf("unsupported database driver: %s", cfg.Database.Driver)
+	}
+	if cfg.Database.Host == "" && cfg.Database.Driver != "sqlite" {
 		return fmt.Errorf("database host is required")
 	}
 	if cfg.Database.DBName == "" {
 		return fmt.Errorf("database name is required")
 	}
 
+	// 验证Redis TLS配置
+	if (cfg.Redis.TLS.CertFile == "") != (cfg.Redis.TLS.KeyFile == "") {
+		return fmt.Errorf("redis tls cert_file and key_file must be configured together")
+	}
+
+	// 验证熔断配置
+	if err := validateCircuitBreaker("redis", &cfg.Redis.CircuitBreaker); err != nil {
+		return err
+	}
+	if err := validateCircuitBreaker("database", &cfg.Database.CircuitBreaker); err != nil {
+		return err
+	}
+
 	// 验证CORS配置
 	if len(cfg.CORS.AllowedOrigins) == 0 {
 		return fmt.Errorf("at least one allowed origin must be configured for CORS")
 	}
 
+	// 验证安全响应头配置
+	if err := validateSecurityHeaders(&cfg.Headers); err != nil {
+		return err
+	}
+
+	// 验证速率限制配置
+	if err := validateRateLimit(&cfg.RateLimit); err != nil {
+		return err
+	}
+
+	// 验证并发请求限制配置
+	if err := validateConcurrencyLimit(&cfg.Concurrency); err != nil {
+		return err
+	}
+
+	// 验证上传配额配置
+	if err := validateUploadQuota(&cfg.Upload.Quota); err != nil {
+		return err
+	}
+	if err := validateUploadSession(&cfg.Upload.Session); err != nil {
+		return err
+	}
+
+	// 验证响应压缩配置
+	if cfg.Compression.Enabled && (cfg.Compression.Level < 1 || cfg.Compression.Level > 9) {
+		return fmt.Errorf("compression level must be between 1 and 9")
+	}
+
+	// 验证IP封禁配置
+	if err := validateIPBan(&cfg.IPBan); err != nil {
+		return err
+	}
+
+	// 验证指标接口配置
+	if cfg.Metrics.Enabled && (!strings.HasPrefix(cfg.Metrics.Path, "/") || strings.HasPrefix(cfg.Metrics.Path, "/api/")) {
+		return fmt.Errorf("metrics.path must start with / and must not be under /api/: %q", cfg.Metrics.Path)
+	}
+
+	// 验证诊断接口配置
+	if cfg.Debug.Pprof && cfg.Debug.Addr == "" && cfg.Admin.Token == "" {
+		return fmt.Errorf("debug.pprof requires debug.addr or admin.token")
+	}
+
+	// 验证运营统计配置
+	if cfg.Admin.Stats.MaxDays <= 0 || cfg.Admin.Stats.MaxDays > 366 {
+		return fmt.Errorf("admin.stats.max_days must be between 1 and 366")
+	}
+	if d, err := time.ParseDuration(cfg.Admin.Stats.CacheTTL); err != nil || d <= 0 {
+		return fmt.Errorf("invalid admin.stats.cache_ttl: %q", cfg.Admin.Stats.CacheTTL)
+	}
+
+	// 验证健康检查配置
+	if d, err := time.ParseDuration(cfg.Health.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid health.timeout: %q", cfg.Health.Timeout)
+	}
+	if d, err := time.ParseDuration(cfg.Health.CacheTTL); err != nil || d < 0 {
+		return fmt.Errorf("invalid health.cache_ttl: %q", cfg.Health.CacheTTL)
+	}
+	if d, err := time.ParseDuration(cfg.Health.DrainDelay); err != nil || d < 0 {
+		return fmt.Errorf("invalid health.drain_delay: %q", cfg.Health.DrainDelay)
+	}
+
+	// 验证错误上报配置
+	if cfg.ErrorReporting.DSN != "" {
+		if u, err := url.Parse(cfg.ErrorReporting.DSN); err != nil || u.User == nil || u.Host == "" {
+			return fmt.Errorf("invalid error_reporting.dsn")
+		}
+		if cfg.ErrorReporting.SampleRate < 0 || cfg.ErrorReporting.SampleRate > 1 {
+			return fmt.Errorf("error_reporting.sample_rate must be between 0 and 1")
+		}
+		if d, err := time.ParseDuration(cfg.ErrorReporting.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid error_reporting.timeout: %q", cfg.ErrorReporting.Timeout)
+		}
+		if cfg.ErrorReporting.QueueSize <= 0 {
+			return fmt.Errorf("error_reporting.queue_size must be positive")
+		}
+	}
+
+	// 验证登录保护配置
+	if err := validateLoginProtection(&cfg.Login); err != nil {
+		return err
+	}
+
+	// 验证登录风险检测配置
+	if err := validateLoginRisk(&cfg.LoginRisk); err != nil {
+		return err
+	}
+
+	// 验证敏感词过滤配置
+	if err := validateFilter(&cfg.Filter); err != nil {
+		return err
+	}
+
+	// 验证邮件通知配置
+	if err := validateEmail(&cfg.Email); err != nil {
+		return err
+	}
+
+	// 验证群机器人配置
+	if cfg.Bots.Enabled {
+		if cfg.Bots.MaxPerGroup <= 0 {
+			return fmt.Errorf("bots.max_per_group must be positive")
+		}
+		if d, err := time.ParseDuration(cfg.Bots.WebhookTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid bots.webhook_timeout: %s", cfg.Bots.WebhookTimeout)
+		}
+	}
+
+	// 验证搜索配置
+	if err := validateSearch(&cfg.Search); err != nil {
+		return err
+	}
+
+	// 验证STUN/TURN配置
+	if err := validateTURN(&cfg.TURN); err != nil {
+		return err
+	}
+
+	// 验证事件总线配置
+	if err := validateEventBus(&cfg.EventBus); err != nil {
+		return err
+	}
+
+	// 验证拆分部署配置
+	if err := validateCluster(&cfg.Cluster); err != nil {
+		return err
+	}
+
+	// 验证内部gRPC接口配置
+	if err := validateGRPC(&cfg.GRPC); err != nil {
+		return err
+	}
+
+	// 验证GraphQL查询接口配置
+	if err := validateGraphQL(&cfg.GraphQL); err != nil {
+		return err
+	}
+
+	// 验证用户数据导出配置
+	if err := validateDataExport(&cfg.DataExport); err != nil {
+		return err
+	}
+
+	// 验证统计汇总配置
+	if err := validateAnalytics(&cfg.Analytics); err != nil {
+		return err
+	}
+
+	// 验证系统公告配置
+	if err := validateAnnouncements(&cfg.Announcements); err != nil {
+		return err
+	}
+
+	// 验证消息钩子配置
+	if d, err := time.ParseDuration(cfg.MessageHooks.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid message_hooks.timeout: %s", cfg.MessageHooks.Timeout)
+	}
+
+	// 验证审计日志配置
+	if d, err := time.ParseDuration(cfg.Audit.Retention); err != nil || d < 0 {
+		return fmt.Errorf("invalid audit.retention: %s", cfg.Audit.Retention)
+	}
+	if d, err := time.ParseDuration(cfg.Audit.CleanupInterval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid audit.cleanup_interval: %s", cfg.Audit.CleanupInterval)
+	}
+
+	return nil
+}
+
+// validateSearch 验证搜索配置
+func validateSearch(cfg *SearchConfig) error {
+	switch cfg.Backend {
+	case "database":
+		return nil
+	case "elasticsearch":
+	default:
+		return fmt.Errorf("search.backend must be database or elasticsearch")
+	}
+	if cfg.ReindexBatchSize <= 0 {
+		return fmt.Errorf("search.reindex_batch_size must be positive")
+	}
+	es := cfg.Elasticsearch
+	if u, err := url.Parse(es.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid search.elasticsearch.url: %s", es.URL)
+	}
+	if es.Index == "" || es.Index != strings.ToLower(es.Index) || strings.ContainsAny(es.Index, `/\*?"<>| ,#`) {
+		return fmt.Errorf("invalid search.elasticsearch.index: %s", es.Index)
+	}
+	if es.Analyzer == "" {
+		return fmt.Errorf("search.elasticsearch.analyzer is required")
+	}
+	if d, err := time.ParseDuration(es.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid search.elasticsearch.timeout: %s", es.Timeout)
+	}
+	return nil
+}
+
+// validateTURN 验证STUN/TURN配置
+func validateTURN(cfg *TURNConfig) error {
+	for _, u := range cfg.STUNURLs {
+		if !strings.HasPrefix(u, "stun:") && !strings.HasPrefix(u, "stuns:") {
+			return fmt.Errorf("invalid turn.stun_urls entry: %s", u)
+		}
+	}
+	for _, u := range cfg.URLs {
+		if !strings.HasPrefix(u, "turn:") && !strings.HasPrefix(u, "turns:") {
+			return fmt.Errorf("invalid turn.urls entry: %s", u)
+		}
+	}
+	if len(cfg.URLs) > 0 && cfg.Secret == "" {
+		return fmt.Errorf("turn.secret is required when turn.urls is set. Please set TURN_SECRET environment variable or configure turn.secret")
+	}
+	if d, err := time.ParseDuration(cfg.CredentialTTL); err != nil || d <= 0 {
+		return fmt.Errorf("invalid turn.credential_ttl: %s", cfg.CredentialTTL)
+	}
+	if cfg.MaxPerHour < 0 {
+		return fmt.Errorf("turn.max_per_hour must not be negative")
+	}
+	return nil
+}
+
+// validateEventBus 验证事件总线配置
+func validateEventBus(cfg *EventBusConfig) error {
+	switch cfg.Backend {
+	case "none":
+		return nil
+	case "nats":
+		if u, err := url.Parse(cfg.NATS.URL); err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+			return fmt.Errorf("invalid event_bus.nats.url: %s", cfg.NATS.URL)
+		}
+	case "kafka":
+		if u, err := url.Parse(cfg.Kafka.RESTProxyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid event_bus.kafka.rest_proxy_url: %s", cfg.Kafka.RESTProxyURL)
+		}
+	default:
+		return fmt.Errorf("event_bus.backend must be none, nats or kafka")
+	}
+	if cfg.TopicPrefix == "" || strings.ContainsAny(cfg.TopicPrefix, " \t*>/") {
+		return fmt.Errorf("invalid event_bus.topic_prefix: %q", cfg.TopicPrefix)
+	}
+	if d, err := time.ParseDuration(cfg.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid event_bus.timeout: %s", cfg.Timeout)
+	}
+	return nil
+}
+
+// validateCluster 验证拆分部署配置
+func validateCluster(cfg *ClusterConfig) error {
+	switch cfg.Role {
+	case "all", "gateway", "worker":
+	default:
+		return fmt.Errorf("cluster.role must be all, gateway or worker")
+	}
+	if cfg.InboundShards < 1 || cfg.InboundShards > 1024 {
+		return fmt.Errorf("cluster.inbound_shards must be between 1 and 1024")
+	}
+	if d, err := time.ParseDuration(cfg.ShardLease); err != nil || d < time.Second {
+		return fmt.Errorf("invalid cluster.shard_lease: %s (minimum 1s)", cfg.ShardLease)
+	}
+	return nil
+}
+
+// validateGRPC 验证内部gRPC接口配置
+func validateGRPC(cfg *GRPCConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if _, port, err := net.SplitHostPort(cfg.Addr); err != nil || port == "" {
+		return fmt.Errorf("invalid grpc.addr: %s", cfg.Addr)
+	}
+	if len(cfg.Token) < 16 {
+		return fmt.Errorf("grpc.token must be at least 16 characters when grpc is enabled")
+	}
+	return nil
+}
+
+// validateGraphQL 验证GraphQL查询接口配置
+func validateGraphQL(cfg *GraphQLConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.MaxDepth <= 0 {
+		return fmt.Errorf("graphql.max_depth must be positive")
+	}
+	if cfg.MaxQueryLength <= 0 {
+		return fmt.Errorf("graphql.max_query_length must be positive")
+	}
+	return nil
+}
+
+// validateDataExport 验证用户数据导出配置，压缩包不能放在可公开访问的静态文件目录下
+func validateDataExport(cfg *DataExportConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	dir := filepath.Clean(cfg.Dir)
+	if cfg.Dir == "" || dir == "uploads" || strings.HasPrefix(dir, "uploads"+string(filepath.Separator)) {
+		return fmt.Errorf("data_export.dir must be set and outside the uploads directory: %s", cfg.Dir)
+	}
+	if d, err := time.ParseDuration(cfg.Retention); err != nil || d <= 0 {
+		return fmt.Errorf("invalid data_export.retention: %s", cfg.Retention)
+	}
+	if d, err := time.ParseDuration(cfg.Cooldown); err != nil || d < 0 {
+		return fmt.Errorf("invalid data_export.cooldown: %s", cfg.Cooldown)
+	}
+	if d, err := time.ParseDuration(cfg.PollInterval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid data_export.poll_interval: %s", cfg.PollInterval)
+	}
+	return nil
+}
+
+// validateAnalytics 验证统计汇总配置
+func validateAnalytics(cfg *AnalyticsConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if d, err := time.ParseDuration(cfg.Interval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid analytics.interval: %s", cfg.Interval)
+	}
+	if d, err := time.ParseDuration(cfg.Lookback); err != nil || d < time.Hour {
+		return fmt.Errorf("analytics.lookback must be at least 1h: %s", cfg.Lookback)
+	}
+	if cfg.BackfillDays < 1 || cfg.BackfillDays > 400 {
+		return fmt.Errorf("analytics.backfill_days must be between 1 and 400")
+	}
+	return nil
+}
+
+// validateAnnouncements 验证系统公告配置
+func validateAnnouncements(cfg *AnnouncementsConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if d, err := time.ParseDuration(cfg.PollInterval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid announcements.poll_interval: %s", cfg.PollInterval)
+	}
+	if cfg.MaxTargetUsers < 1 || cfg.MaxTargetUsers > 100000 {
+		return fmt.Errorf("announcements.max_target_users must be between 1 and 100000")
+	}
+	return nil
+}
+
+// validateJWTKeys 验证JWT密钥列表，密钥内容和密钥文件在启动时由utils.LoadJWTKeys解析
+func validateJWTKeys(cfg *JWTConfig) error {
+	ids := make(map[string]bool, len(cfg.Keys))
+	for i, key := range cfg.Keys {
+		if key.ID == "" {
+			return fmt.Errorf("jwt.keys[%d] id is required", i)
+		}
+		if ids[key.ID] {
+			return fmt.Errorf("duplicate jwt key id: %s", key.ID)
+		}
+		ids[key.ID] = true
+
+		switch key.Algorithm {
+		case "HS256", "HS384", "HS512":
+			if key.Secret == "" && key.SecretEnv == "" {
+				return fmt.Errorf("jwt key %s requires secret or secret_env", key.ID)
+			}
+		case "RS256":
+			if key.PublicKeyFile == "" {
+				return fmt.Errorf("jwt key %s requires public_key_file", key.ID)
+			}
+			if key.ID == cfg.SigningKeyID && key.PrivateKeyFile == "" {
+				return fmt.Errorf("jwt signing key %s requires private_key_file", key.ID)
+			}
+		default:
+			return fmt.Errorf("jwt key %s has unsupported algorithm %q (HS256, HS384, HS512 or RS256)", key.ID, key.Algorithm)
+		}
+	}
+	if cfg.SigningKeyID != "" && !ids[cfg.SigningKeyID] {
+		return fmt.Errorf("jwt.signing_key_id %s not found in jwt.keys", cfg.SigningKeyID)
+	}
+	if cfg.SigningKeyID == "" && !cfg.AcceptUnkeyed {
+		return fmt.Errorf("jwt.accept_unkeyed_tokens must be enabled while tokens are signed with jwt.secret")
+	}
+	return nil
+}
+
+// validateLoginRisk 验证登录风险检测配置
+func validateLoginRisk(cfg *LoginRiskConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.NewDeviceScore < 0 || cfg.NewRegionScore < 0 || cfg.StepUpScore < 0 || cfg.NotifyScore < 0 {
+		return fmt.Errorf("login_risk scores must not be negative")
+	}
+	if cfg.MaxDevices <= 0 {
+		return fmt.Errorf("login_risk.max_devices must be positive")
+	}
+	if d, err := time.ParseDuration(cfg.CodeTTL); err != nil || d <= 0 {
+		return fmt.Errorf("invalid login_risk.code_ttl: %s", cfg.CodeTTL)
+	}
+	if cfg.CodeAttempts <= 0 {
+		return fmt.Errorf("login_risk.code_attempts must be positive")
+	}
+	if cfg.CodeWebhook.URL != "" {
+		if cfg.CodeWebhook.Secret == "" {
+			return fmt.Errorf("login_risk.code_webhook.secret is required when url is set")
+		}
+		if d, err := time.ParseDuration(cfg.CodeWebhook.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid login_risk.code_webhook.timeout: %s", cfg.CodeWebhook.Timeout)
+		}
+	}
+	return nil
+}
+
+// validateEmail 验证邮件通知配置
+func validateEmail(cfg *EmailConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return fmt.Errorf("invalid email.from: %q", cfg.From)
+	}
+	if cfg.SMTP.Host == "" || cfg.SMTP.Port <= 0 || cfg.SMTP.Port > 65535 {
+		return fmt.Errorf("email.smtp.host and email.smtp.port are required")
+	}
+	if !slices.Contains([]string{"starttls", "tls", "none"}, cfg.SMTP.TLS) {
+		return fmt.Errorf("email.smtp.tls must be one of starttls, tls, none")
+	}
+	if d, err := time.ParseDuration(cfg.SMTP.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid email.smtp.timeout: %s", cfg.SMTP.Timeout)
+	}
+	if cfg.Digest.Enabled {
+		if d, err := time.ParseDuration(cfg.Digest.Interval); err != nil || d < time.Hour {
+			return fmt.Errorf("email.digest.interval must be at least 1h: %s", cfg.Digest.Interval)
+		}
+		if cfg.Digest.MaxItems <= 0 {
+			return fmt.Errorf("email.digest.max_items must be positive")
+		}
+	}
+	return nil
+}
+
+// validateUploadQuota 验证上传配额配置
+func validateUploadQuota(cfg *UploadQuotaConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.DailyCount < 0 || cfg.DailyMB < 0 || cfg.DuplicateLimit < 0 {
+		return fmt.Errorf("upload.quota limits must not be negative")
+	}
+	if cfg.DuplicateLimit > 0 {
+		if d, err := time.ParseDuration(cfg.DuplicateWindow); err != nil || d <= 0 {
+			return fmt.Errorf("invalid upload.quota.duplicate_window: %s", cfg.DuplicateWindow)
+		}
+	}
+	return nil
+}
+
+// validateUploadSession 验证分片上传配置，分片不能放在可公开访问的静态文件目录下
+func validateUploadSession(cfg *UploadSessionConfig) error {
+	dir := filepath.Clean(cfg.Dir)
+	if cfg.Dir == "" || dir == "uploads" || strings.HasPrefix(dir, "uploads"+string(filepath.Separator)) {
+		return fmt.Errorf("upload.session.dir must be set and outside the uploads directory: %s", cfg.Dir)
+	}
+	if cfg.PartSizeMB <= 0 {
+		return fmt.Errorf("upload.session.part_size_mb must be positive")
+	}
+	if d, err := time.ParseDuration(cfg.TTL); err != nil || d <= 0 {
+		return fmt.Errorf("invalid upload.session.ttl: %s", cfg.TTL)
+	}
+	return nil
+}
+
+// validateFilter 验证敏感词过滤配置
+func validateFilter(cfg *FilterConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.WordsFile == "" {
+		return fmt.Errorf("content_filter.words_file is required")
+	}
+	if d, err := time.ParseDuration(cfg.ReloadInterval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid content_filter.reload_interval: %s", cfg.ReloadInterval)
+	}
+	modes := []string{"reject", "mask", "flag"}
+	if !slices.Contains(modes, cfg.MessageMode) {
+		return fmt.Errorf("content_filter.message_mode must be one of reject, mask, flag")
+	}
+	if !slices.Contains(modes, cfg.NicknameMode) {
+		return fmt.Errorf("content_filter.nickname_mode must be one of reject, mask, flag")
+	}
+	if utf8.RuneCountInString(cfg.MaskChar) != 1 {
+		return fmt.Errorf("content_filter.mask_char must be a single character")
+	}
+	for i, override := range cfg.GroupOverrides {
+		if override.GroupID <= 0 {
+			return fmt.Errorf("content_filter.group_overrides[%d] group_id is required", i)
+		}
+		if override.Mode != "" && override.Mode != "off" && !slices.Contains(modes, override.Mode) {
+			return fmt.Errorf("content_filter.group_overrides[%d] mode must be one of off, reject, mask, flag", i)
+		}
+	}
+	return nil
+}
+
+// validateCircuitBreaker 验证熔断配置
+func validateCircuitBreaker(section string, cfg *CircuitBreakerConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.FailureThreshold <= 0 || cfg.HalfOpenRequests <= 0 {
+		return fmt.Errorf("%s.circuit_breaker failure_threshold and half_open_requests must be positive", section)
+	}
+	if d, err := time.ParseDuration(cfg.OpenTimeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid %s.circuit_breaker.open_timeout: %s", section, cfg.OpenTimeout)
+	}
+	if d, err := time.ParseDuration(cfg.ProbeInterval); err != nil || d < 0 {
+		return fmt.Errorf("invalid %s.circuit_breaker.probe_interval: %s", section, cfg.ProbeInterval)
+	}
+	return nil
+}
+
+// validateLoginProtection 验证登录保护配置
+func validateLoginProtection(cfg *LoginProtectionConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if d, err := time.ParseDuration(cfg.Window); err != nil || d <= 0 {
+		return fmt.Errorf("invalid login_protection.window: %s", cfg.Window)
+	}
+	if cfg.DelayAfter < 0 || cfg.CaptchaAfter < 0 || cfg.LockAfter < 0 {
+		return fmt.Errorf("login_protection thresholds must not be negative")
+	}
+	if cfg.DelayAfter > 0 {
+		baseDelay, err := time.ParseDuration(cfg.BaseDelay)
+		if err != nil || baseDelay <= 0 {
+			return fmt.Errorf("invalid login_protection.base_delay: %s", cfg.BaseDelay)
+		}
+		if d, err := time.ParseDuration(cfg.MaxDelay); err != nil || d < baseDelay {
+			return fmt.Errorf("login_protection.max_delay must not be less than base_delay")
+		}
+	}
+	if cfg.LockAfter > 0 {
+		if d, err := time.ParseDuration(cfg.LockDuration); err != nil || d <= 0 {
+			return fmt.Errorf("invalid login_protection.lock_duration: %s", cfg.LockDuration)
+		}
+	}
+	if cfg.CaptchaAfter > 0 && cfg.Captcha.VerifyURL != "" {
+		if cfg.Captcha.Secret == "" {
+			return fmt.Errorf("login_protection.captcha.secret is required when verify_url is set")
+		}
+		if d, err := time.ParseDuration(cfg.Captcha.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid login_protection.captcha.timeout: %s", cfg.Captcha.Timeout)
+		}
+	}
+	return nil
+}
+
+// validateIPBan 验证IP封禁配置
+func validateIPBan(cfg *IPBanConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if d, err := time.ParseDuration(cfg.RefreshInterval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid ip_ban.refresh_interval: %s", cfg.RefreshInterval)
+	}
+	for _, ip := range cfg.ExemptIPs {
+		if _, _, err := net.ParseCIDR(ip); err != nil && net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid ip_ban.exempt_ips entry: %s", ip)
+		}
+	}
+	if !cfg.AutoBan.Enabled {
+		return nil
+	}
+	if d, err := time.ParseDuration(cfg.AutoBan.Window); err != nil || d <= 0 {
+		return fmt.Errorf("invalid ip_ban.auto_ban.window: %s", cfg.AutoBan.Window)
+	}
+	if d, err := time.ParseDuration(cfg.AutoBan.Duration); err != nil || d <= 0 {
+		return fmt.Errorf("invalid ip_ban.auto_ban.duration: %s", cfg.AutoBan.Duration)
+	}
+	if cfg.AutoBan.LoginFailures < 0 || cfg.AutoBan.AuthFailures < 0 || cfg.AutoBan.RateLimitHits < 0 {
+		return fmt.Errorf("ip_ban.auto_ban thresholds must not be negative")
+	}
+	return nil
+}
+
+// validateSecurityHeaders 验证安全响应头配置
+func validateSecurityHeaders(cfg *SecurityHeadersConfig) error {
+	if err := validateHeaderValues("security_headers", cfg.ContentSecurityPolicy, cfg.FrameOptions, cfg.ReferrerPolicy, cfg.PermissionsPolicy); err != nil {
+		return err
+	}
+	if cfg.HSTS.Enabled {
+		if d, err := time.ParseDuration(cfg.HSTS.MaxAge); err != nil || d < 0 {
+			return fmt.Errorf("invalid security_headers.hsts.max_age: %s", cfg.HSTS.MaxAge)
+		}
+	}
+	for i, route := range cfg.Routes {
+		if route.Path == "" {
+			return fmt.Errorf("security_headers.routes[%d] path is required", i)
+		}
+		section := fmt.Sprintf("security_headers.routes[%d]", i)
+		if err := validateHeaderValues(section, route.ContentSecurityPolicy, route.FrameOptions, route.ReferrerPolicy, route.PermissionsPolicy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateHeaderValues 验证响应头取值：不能包含换行，X-Frame-Options只支持DENY和SAMEORIGIN（ALLOW-FROM已被浏览器废弃，改用CSP的frame-ancestors）
+func validateHeaderValues(section, csp, frameOptions, referrerPolicy, permissionsPolicy string) error {
+	for _, value := range []string{csp, frameOptions, referrerPolicy, permissionsPolicy} {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s header values must not contain line breaks", section)
+		}
+	}
+	switch strings.ToUpper(frameOptions) {
+	case "", "OFF", "DENY", "SAMEORIGIN":
+		return nil
+	}
+	return fmt.Errorf("%s.frame_options must be DENY or SAMEORIGIN", section)
+}
+
+// validateConcurrencyLimit 验证并发请求限制配置
+func validateConcurrencyLimit(cfg *ConcurrencyLimitConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.MaxInFlight <= 0 {
+		return fmt.Errorf("concurrency_limit.max_in_flight must be positive")
+	}
+	if cfg.MaxUploads < 0 || cfg.MaxUploads > cfg.MaxInFlight {
+		return fmt.Errorf("concurrency_limit.max_uploads must be between 0 and max_in_flight")
+	}
+	if d, err := time.ParseDuration(cfg.WaitTimeout); err != nil || d < 0 {
+		return fmt.Errorf("invalid concurrency_limit.wait_timeout: %s", cfg.WaitTimeout)
+	}
+	return nil
+}
+
+// validateRateLimit 验证速率限制配置
+func validateRateLimit(cfg *RateLimitConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	for _, category := range []struct {
+		name string
+		rule RateLimitRule
+	}{{"global", cfg.Global}, {"auth", cfg.Auth}, {"message", cfg.Message}, {"upload", cfg.Upload}} {
+		if category.rule.RPS <= 0 || category.rule.Burst <= 0 {
+			return fmt.Errorf("rate_limit.%s rps and burst must be positive", category.name)
+		}
+	}
+	for i, route := range cfg.Routes {
+		if route.Path == "" {
+			return fmt.Errorf("rate_limit.routes[%d] path is required", i)
+		}
+		if route.RPS <= 0 || route.Burst <= 0 {
+			return fmt.Errorf("rate_limit.routes[%d] rps and burst must be positive", i)
+		}
+	}
+	for _, ip := range cfg.ExemptIPs {
+		if _, _, err := net.ParseCIDR(ip); err != nil && net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid rate_limit.exempt_ips entry: %s", ip)
+		}
+	}
 	return nil
 }
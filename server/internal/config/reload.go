@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+var (
+	current         atomic.Pointer[Config]
+	reloadMu        sync.Mutex
+	reloadListeners []func(cfg *Config)
+)
+
+// Current 当前生效的配置，热加载后返回新配置；Init之前返回nil
+func Current() *Config {
+	return current.Load()
+}
+
+// OnReload 注册热加载回调，新配置校验通过后按注册顺序调用
+// 回调只应替换自己持有的配置（如原子指针），不能阻塞
+func OnReload(fn func(cfg *Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadListeners = append(reloadListeners, fn)
+}
+
+// Reload 重新读取配置文件，校验通过后应用可热加载的配置项：
+// log.level、rate_limit、cors、upload的image/file/video/quota（ffprobe_path和ffmpeg_path除外）
+// 其他配置项的改动不生效，以配置节名称在restartRequired中返回，需要重启；校验失败时继续使用当前配置
+func Reload() (restartRequired []string, err error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var next Config
+	if err := viper.Unmarshal(&next); err != nil {
+		return nil, err
+	}
+	if err := validateConfig(&next); err != nil {
+		return nil, err
+	}
+
+	applied := *Current()
+	applyReloadable(&applied, &next)
+	restartRequired = changedSections(&applied, &next)
+
+	current.Store(&applied)
+	for _, fn := range reloadListeners {
+		fn(&applied)
+	}
+	return restartRequired, nil
+}
+
+// applyReloadable 把next中可热加载的配置项复制到cfg
+func applyReloadable(cfg, next *Config) {
+	cfg.Log.Level = next.Log.Level
+	cfg.RateLimit = next.RateLimit
+	cfg.CORS = next.CORS
+
+	// 视频处理程序在启动时创建，可执行文件路径需要重启
+	video := next.Upload.Video
+	video.FFprobePath, video.FFmpegPath = cfg.Upload.Video.FFprobePath, cfg.Upload.Video.FFmpegPath
+	cfg.Upload.Image = next.Upload.Image
+	cfg.Upload.File = next.Upload.File
+	cfg.Upload.Video = video
+	cfg.Upload.Quota = next.Upload.Quota
+}
+
+// changedSections 比较各配置节，返回不同的配置节名称（mapstructure标签）
+func changedSections(cfg, next *Config) []string {
+	var sections []string
+	a, b := reflect.ValueOf(cfg).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			sections = append(sections, a.Type().Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return sections
+}
+
+// Watch 监听配置文件变化并自动热加载，每次加载后调用onReload报告结果
+func Watch(onReload func(restartRequired []string, err error)) {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		restartRequired, err := Reload()
+		if err != nil {
+			err = fmt.Errorf("reload %s: %w", e.Name, err)
+		}
+		onReload(restartRequired, err)
+	})
+	viper.WatchConfig()
+}
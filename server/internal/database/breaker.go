@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/breaker"
+	"gochat/internal/config"
+)
+
+// breakerDoneKey 语句实例中保存请求完成回调的键
+const breakerDoneKey = "gochat:breaker_done"
+
+// dbBreaker 数据库熔断器，未启用时为nil
+var dbBreaker *breaker.Breaker
+
+// IsCircuitOpen 数据库是否处于熔断状态
+func IsCircuitOpen() bool {
+	return dbBreaker.IsOpen()
+}
+
+// useCircuitBreaker 注册熔断回调：每条SQL执行前检查熔断器，熔断期间直接返回breaker.ErrOpen
+// 熔断期间通过Ping主库探测恢复
+func useCircuitBreaker(db *gorm.DB, cfg *config.CircuitBreakerConfig) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	dbBreaker = breaker.NewFromConfig("database", cfg, sqlDB.PingContext)
+	if dbBreaker == nil {
+		return nil
+	}
+
+	callback := db.Callback()
+	for _, register := range []func() error{
+		func() error { return callback.Create().Before("*").Register("gochat:breaker_before", breakerBefore) },
+		func() error { return callback.Create().After("*").Register("gochat:breaker_after", breakerAfter) },
+		func() error { return callback.Query().Before("*").Register("gochat:breaker_before", breakerBefore) },
+		func() error { return callback.Query().After("*").Register("gochat:breaker_after", breakerAfter) },
+		func() error { return callback.Update().Before("*").Register("gochat:breaker_before", breakerBefore) },
+		func() error { return callback.Update().After("*").Register("gochat:breaker_after", breakerAfter) },
+		func() error { return callback.Delete().Before("*").Register("gochat:breaker_before", breakerBefore) },
+		func() error { return callback.Delete().After("*").Register("gochat:breaker_after", breakerAfter) },
+		func() error { return callback.Row().Before("*").Register("gochat:breaker_before", breakerBefore) },
+		func() error { return callback.Row().After("*").Register("gochat:breaker_after", breakerAfter) },
+		func() error { return callback.Raw().Before("*").Register("gochat:breaker_before", breakerBefore) },
+		func() error { return callback.Raw().After("*").Register("gochat:breaker_after", breakerAfter) },
+	} {
+		if err := register(); err != nil {
+			return fmt.Errorf("failed to register circuit breaker callback: %w", err)
+		}
+	}
+	return nil
+}
+
+// breakerBefore 熔断时中止语句，后续回调看到错误后不再执行SQL
+func breakerBefore(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	done, err := dbBreaker.Allow()
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(breakerDoneKey, done)
+}
+
+// breakerAfter 记录语句结果，被拒绝的语句没有回调
+func breakerAfter(db *gorm.DB) {
+	if done, ok := db.InstanceGet(breakerDoneKey); ok {
+		done.(func(bool))(isDBFailure(db.Error))
+	}
+}
+
+// isDBFailure 是否为数据库不可用导致的错误
+// 记录不存在、约束冲突等数据库返回的错误说明服务正常，调用方取消请求也不计入
+func isDBFailure(err error) bool {
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
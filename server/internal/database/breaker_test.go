@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/breaker"
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+func TestCircuitBreakerRejectsQueriesWhileOpen(t *testing.T) {
+	require.NoError(t, Init(&config.DatabaseConfig{
+		Driver: DriverSQLite,
+		DBName: filepath.Join(t.TempDir(), "gochat.db"),
+		CircuitBreaker: config.CircuitBreakerConfig{
+			Enabled:          true,
+			FailureThreshold: 2,
+			OpenTimeout:      "1m",
+			HalfOpenRequests: 1,
+		},
+	}))
+	t.Cleanup(func() { Close() })
+	require.NoError(t, Migrate())
+
+	// 记录不存在不计为故障
+	var user models.User
+	assert.ErrorIs(t, DB.First(&user, 1).Error, gorm.ErrRecordNotFound)
+	assert.False(t, IsCircuitOpen())
+
+	for i := 0; i < 2; i++ {
+		done, err := dbBreaker.Allow()
+		require.NoError(t, err)
+		done(true)
+	}
+	assert.True(t, IsCircuitOpen())
+	assert.ErrorIs(t, DB.First(&user, 1).Error, breaker.ErrOpen)
+	assert.ErrorIs(t, DB.Create(&models.User{Phone: "13800000001", PasswordHash: "x", Nickname: "alice"}).Error, breaker.ErrOpen)
+	var count int64
+	assert.ErrorIs(t, DB.Raw("SELECT COUNT(*) FROM users").Scan(&count).Error, breaker.ErrOpen)
+}
+
+func TestIsDBFailure(t *testing.T) {
+	assert.False(t, isDBFailure(nil))
+	assert.False(t, isDBFailure(gorm.ErrRecordNotFound))
+	assert.False(t, isDBFailure(context.Canceled))
+	assert.False(t, isDBFailure(errors.New("UNIQUE constraint failed: users.phone")))
+	assert.True(t, isDBFailure(context.DeadlineExceeded))
+}
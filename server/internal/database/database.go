@@ -4,11 +4,10 @@ import (
 	"fmt"
 	"time"
 
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 
 	"gochat/internal/config"
+	"gochat/internal/logger"
 	"gochat/internal/models"
 )
 
@@ -16,12 +15,13 @@ var DB *gorm.DB
 
 // Init 初始化数据库连接
 func Init(cfg *config.DatabaseConfig) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+	dialector, err := openDialector(cfg)
+	if err != nil {
+		return err
+	}
 
-	var err error
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent), // 关闭SQL日志输出
+	DB, err = gorm.Open(dialector, &gorm.Config{
+		Logger: newQueryLogger(parseSlowThreshold(cfg.SlowThreshold)), // 只记录慢查询和出错的SQL
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
@@ -37,6 +37,23 @@ func Init(cfg *config.DatabaseConfig) error {
 	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
+	// 配置只读副本
+	if err := useReplicas(DB, cfg); err != nil {
+		return err
+	}
+
+	// 数据库连续出错时熔断，避免每个请求都等待超时
+	if err := useCircuitBreaker(DB, &cfg.CircuitBreaker); err != nil {
+		return err
+	}
+
+	// SQLite同一时刻只允许一个写者，使用单连接避免"database is locked"
+	// 连接不过期，保证内存库不会随连接回收而丢失
+	if Dialect(DB) == DriverSQLite {
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+	}
+
 	return nil
 }
 
@@ -47,25 +64,96 @@ func GetDB() *gorm.DB {
 
 // Migrate 执行数据库迁移
 func Migrate() error {
-	// 先禁用外键检查
-	DB.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	// 先禁用外键检查（PostgreSQL按依赖顺序建表）
+	switch Dialect(DB) {
+	case DriverMySQL:
+		DB.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	case DriverSQLite:
+		DB.Exec("PRAGMA foreign_keys = OFF")
+	}
 
-	// 执行迁移
-	err := DB.AutoMigrate(
+	// 执行迁移（表结构检查必须走主库）
+	err := Primary(DB).AutoMigrate(
 		&models.User{},
 		&models.FriendRelation{},
 		&models.Group{},
 		&models.GroupMember{},
 		&models.Message{},
+		&models.ArchivedMessage{}, // 归档消息表
+		&models.MessageDeletion{}, // 消息删除记录（仅为自己删除）
+		&models.OutboxEvent{},     // 发件箱事件
 		&models.Conversation{},
 		&models.FileStorage{},    // 新增：文件存储表
 		&models.FileReference{},  // 新增：文件引用表
+		&models.APIKey{},         // 服务集成API密钥
+		&models.IPBan{},          // IP封禁列表
+		&models.AuditLog{},       // 审计日志
+		&models.UserDevice{},     // 登录设备
+		&models.Bot{},            // 群机器人
+		&models.Report{},         // 举报
+		&models.Call{},           // 通话记录
+		&models.DataExport{},     // 用户数据导出任务
+		&models.MessageStatHourly{}, // 每小时消息数统计
+		&models.UserActivityDay{},   // 每日活跃用户
+		&models.GroupActivityDay{},  // 每日群活跃度
+		&models.Announcement{},       // 系统公告
+		&models.AnnouncementTarget{}, // 公告的定向用户
+		&models.AnnouncementRead{},   // 公告已读记录
 	)
 
 	// 重新启用外键检查
-	DB.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	switch Dialect(DB) {
+	case DriverMySQL:
+		DB.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	case DriverSQLite:
+		DB.Exec("PRAGMA foreign_keys = ON")
+	}
+
+	if err != nil {
+		return err
+	}
+	if err := migrateUnreadCount(Primary(DB)); err != nil {
+		return err
+	}
+	if err := migratePinnedAt(Primary(DB)); err != nil {
+		return err
+	}
+	ensureFullTextIndexes(Primary(DB))
+	return nil
+}
+
+// migrateUnreadCount 未读计数改为按已读位置统计后，移除旧的unread_count列
+// 旧数据无法还原每条未读消息，迁移时把已有会话标记为读到最后一条消息
+func migrateUnreadCount(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&models.Conversation{}, "unread_count") {
+		return nil
+	}
+	result := db.Exec("UPDATE conversations SET last_read_msg_id = COALESCE(last_msg_id, 0) WHERE last_read_msg_id = 0")
+	if result.Error != nil {
+		return result.Error
+	}
+	logger.GetLogger().Infof("会话未读计数已迁移为已读位置: %d 个会话", result.RowsAffected)
+
+	if migrator.HasIndex(&models.Conversation{}, "idx_conversations_unread") {
+		if err := migrator.DropIndex(&models.Conversation{}, "idx_conversations_unread"); err != nil {
+			return err
+		}
+	}
+	// 模型中已没有该字段，Migrator.DropColumn在SQLite下不会生效，直接执行DDL
+	return db.Exec("ALTER TABLE conversations DROP COLUMN unread_count").Error
+}
 
-	return err
+// migratePinnedAt 增加置顶时间前已置顶的会话以最后更新时间作为置顶时间，保持原有的排列顺序
+func migratePinnedAt(db *gorm.DB) error {
+	result := db.Exec("UPDATE conversations SET pinned_at = updated_at WHERE is_pinned = ? AND pinned_at IS NULL", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logger.GetLogger().Infof("已为置顶会话补充置顶时间: %d 个会话", result.RowsAffected)
+	}
+	return nil
 }
 
 // Close 关闭数据库连接
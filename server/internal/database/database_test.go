@@ -0,0 +1,37 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+func TestMigrateReplacesUnreadCountWithReadPointer(t *testing.T) {
+	require.NoError(t, Init(&config.DatabaseConfig{Driver: DriverSQLite, DBName: filepath.Join(t.TempDir(), "gochat.db")}))
+	t.Cleanup(func() { Close() })
+
+	// 模拟旧版本的会话表：带unread_count列，没有已读位置
+	require.NoError(t, Migrate())
+	require.NoError(t, DB.Exec("ALTER TABLE conversations ADD COLUMN unread_count integer DEFAULT 0").Error)
+	require.NoError(t, DB.Exec("CREATE INDEX idx_conversations_unread ON conversations(user_id, unread_count) WHERE unread_count > 0").Error)
+	require.NoError(t, DB.Create(&models.User{ID: 1, Phone: "13800000001", PasswordHash: "x", Nickname: "alice"}).Error)
+	require.NoError(t, DB.Create(&models.Message{ID: 42, FromUserID: 1, Content: "hi"}).Error)
+	require.NoError(t, DB.Exec("INSERT INTO conversations (user_id, type, target_id, last_msg_id, unread_count) VALUES (1, 1, 2, 42, 3), (1, 1, 3, NULL, 0)").Error)
+
+	require.NoError(t, Migrate())
+	assert.False(t, DB.Migrator().HasColumn(&models.Conversation{}, "unread_count"))
+
+	var conversations []models.Conversation
+	require.NoError(t, DB.Order("id").Find(&conversations).Error)
+	require.Len(t, conversations, 2)
+	assert.Equal(t, int64(42), conversations[0].LastReadMsgID)
+	assert.Equal(t, int64(0), conversations[1].LastReadMsgID)
+
+	// 再次迁移不受影响
+	require.NoError(t, Migrate())
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+)
+
+// 支持的数据库驱动
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// openDialector 根据配置的驱动创建GORM方言
+func openDialector(cfg *config.DatabaseConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case DriverMySQL, "":
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+		return newDialector(cfg.Driver, dsn)
+	case DriverPostgres:
+		sslMode := cfg.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+			cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, sslMode)
+		return newDialector(cfg.Driver, dsn)
+	case DriverSQLite:
+		return newDialector(cfg.Driver, sqliteDSN(cfg.DBName))
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
+	}
+}
+
+// newDialector 根据驱动和完整DSN创建GORM方言
+func newDialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case DriverMySQL, "":
+		return mysql.Open(dsn), nil
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	case DriverSQLite:
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+// sqliteDSN 构造SQLite连接串，开启外键约束并设置锁等待时间
+// ":memory:" 使用共享缓存，保证连接池中的多个连接看到同一个内存库
+func sqliteDSN(path string) string {
+	if path == ":memory:" {
+		path = "file::memory:?cache=shared"
+	}
+	if strings.Contains(path, "?") {
+		return path + "&_foreign_keys=on&_busy_timeout=5000"
+	}
+	return path + "?_foreign_keys=on&_busy_timeout=5000"
+}
+
+// Dialect 当前连接使用的数据库方言名称（mysql、postgres、sqlite）
+func Dialect(db *gorm.DB) string {
+	if db == nil || db.Dialector == nil {
+		return DriverMySQL
+	}
+	return db.Dialector.Name()
+}
+
+// IsMySQL 当前连接是否为MySQL
+func IsMySQL(db *gorm.DB) bool {
+	return Dialect(db) == DriverMySQL
+}
+
+// UnixMillisExpr 返回把时间列转换为毫秒时间戳的SQL表达式
+func UnixMillisExpr(db *gorm.DB, column string) string {
+	switch Dialect(db) {
+	case DriverPostgres:
+		return fmt.Sprintf("CAST(EXTRACT(EPOCH FROM %s) * 1000 AS BIGINT)", column)
+	case DriverSQLite:
+		return fmt.Sprintf("CAST(ROUND((julianday(%s) - 2440587.5) * 86400000) AS INTEGER)", column)
+	default:
+		return fmt.Sprintf("CAST(UNIX_TIMESTAMP(%s) * 1000 AS SIGNED)", column)
+	}
+}
+
+// DateTimeExpr 返回把时间列格式化为 "YYYY-MM-DD HH:MM:SS" 字符串的SQL表达式
+func DateTimeExpr(db *gorm.DB, column string) string {
+	switch Dialect(db) {
+	case DriverPostgres:
+		return fmt.Sprintf("TO_CHAR(%s, 'YYYY-MM-DD HH24:MI:SS')", column)
+	case DriverSQLite:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:%%M:%%S', %s)", column)
+	default:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:%%i:%%s')", column)
+	}
+}
+
+// QuoteTable 按当前方言转义表名（如MySQL保留字groups）
+func QuoteTable(db *gorm.DB, table string) string {
+	if db == nil || db.Dialector == nil {
+		return "`" + table + "`"
+	}
+	return db.Statement.Quote(table)
+}
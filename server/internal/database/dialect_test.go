@@ -0,0 +1,45 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+)
+
+func openDryRun(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	return db
+}
+
+func TestDialectExpressions(t *testing.T) {
+	my := openDryRun(t, mysql.New(mysql.Config{DSN: "u:p@tcp(localhost:3306)/db", SkipInitializeWithVersion: true}))
+	pg := openDryRun(t, postgres.Open("host=localhost user=u dbname=db sslmode=disable"))
+
+	assert.True(t, IsMySQL(my))
+	assert.False(t, IsMySQL(pg))
+
+	assert.Equal(t, "CAST(UNIX_TIMESTAMP(m.created_at) * 1000 AS SIGNED)", UnixMillisExpr(my, "m.created_at"))
+	assert.Equal(t, "CAST(EXTRACT(EPOCH FROM m.created_at) * 1000 AS BIGINT)", UnixMillisExpr(pg, "m.created_at"))
+
+	assert.Equal(t, "DATE_FORMAT(m.created_at, '%Y-%m-%d %H:%i:%s')", DateTimeExpr(my, "m.created_at"))
+	assert.Equal(t, "TO_CHAR(m.created_at, 'YYYY-MM-DD HH24:MI:SS')", DateTimeExpr(pg, "m.created_at"))
+
+	assert.Equal(t, "`groups`", QuoteTable(my, "groups"))
+	assert.Equal(t, `"groups"`, QuoteTable(pg, "groups"))
+}
+
+func TestOpenDialectorRejectsUnknownDriver(t *testing.T) {
+	_, err := openDialector(&config.DatabaseConfig{Driver: "oracle"})
+	assert.Error(t, err)
+
+	d, err := openDialector(&config.DatabaseConfig{Driver: DriverPostgres, Host: "db", Port: 5432})
+	require.NoError(t, err)
+	assert.Equal(t, DriverPostgres, d.Name())
+}
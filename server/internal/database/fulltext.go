@@ -0,0 +1,62 @@
+package database
+
+import (
+	"sync"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/logger"
+)
+
+// NgramTokenSize MySQL ngram分词长度（ngram_token_size默认值），短于该长度的关键词无法命中全文索引
+const NgramTokenSize = 2
+
+// fullTextTables 需要建立content全文索引的消息表
+var fullTextTables = []string{"messages", "messages_archive"}
+
+// fullTextIndexes 记录各表全文索引是否可用（table -> bool）
+var fullTextIndexes sync.Map
+
+// ensureFullTextIndexes 为消息表建立ngram全文索引（支持中日韩文本），仅MySQL支持
+// 建索引失败不影响启动，搜索会退回LIKE查询
+func ensureFullTextIndexes(db *gorm.DB) {
+	if !IsMySQL(db) {
+		return
+	}
+	log := logger.GetLogger()
+	for _, table := range fullTextTables {
+		if HasFullTextIndex(db, table) {
+			continue
+		}
+		sql := "CREATE FULLTEXT INDEX idx_" + table + "_content_ft ON " + table + "(content) WITH PARSER ngram"
+		if err := db.Exec(sql).Error; err != nil {
+			log.Warnf("创建%s全文索引失败，消息搜索将使用LIKE: %v", table, err)
+			continue
+		}
+		fullTextIndexes.Store(table, true)
+		log.Infof("已创建%s全文索引", table)
+	}
+}
+
+// HasFullTextIndex 表的content列是否有可用的全文索引，结果按表缓存
+func HasFullTextIndex(db *gorm.DB, table string) bool {
+	if !IsMySQL(db) {
+		return false
+	}
+	if ok, found := fullTextIndexes.Load(table); found {
+		return ok.(bool)
+	}
+
+	var count int64
+	err := db.Raw(`
+		SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = 'content' AND index_type = 'FULLTEXT'
+	`, table).Scan(&count).Error
+	if err != nil {
+		// 查询失败不缓存，下次重新检查
+		logger.GetLogger().Warnf("检查%s全文索引失败: %v", table, err)
+		return false
+	}
+	fullTextIndexes.Store(table, count > 0)
+	return count > 0
+}
@@ -67,8 +67,9 @@ func optimizeMessageIndexes(db *gorm.DB) error {
 		// 复合索引 - 用户消息按时间排序（优化分页查询）
 		"CREATE INDEX IF NOT EXISTS idx_messages_user_time ON messages(from_user_id, to_user_id, group_id, created_at DESC)",
 
-		// 未读消息查询索引
-		"CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages(to_user_id, is_read, created_at) WHERE to_user_id IS NOT NULL",
+		// 未读消息统计索引 - 按已读位置统计已读消息ID之后的消息
+		"CREATE INDEX IF NOT EXISTS idx_messages_unread_private ON messages(to_user_id, from_user_id, id)",
+		"CREATE INDEX IF NOT EXISTS idx_messages_unread_group ON messages(group_id, id) WHERE group_id IS NOT NULL",
 	}
 
 	for _, sql := range indexes {
@@ -125,9 +126,6 @@ func optimizeConversationIndexes(db *gorm.DB) error {
 		// 复合索引 - 用户会话列表查询
 		"CREATE INDEX IF NOT EXISTS idx_conversations_user_list ON conversations(user_id, type, updated_at DESC)",
 
-		// 未读消息统计索引
-		"CREATE INDEX IF NOT EXISTS idx_conversations_unread ON conversations(user_id, unread_count) WHERE unread_count > 0",
-
 		// 最后消息索引
 		"CREATE INDEX IF NOT EXISTS idx_conversations_last_msg ON conversations(last_msg_id, updated_at DESC)",
 	}
@@ -258,8 +256,11 @@ func AnalyzeDatabase(db *gorm.DB) error {
 			logger.GetLogger().Infof("Table %s: %d records", table, count)
 		}
 
-		// 更新表统计信息（MySQL）
-		sql := "ANALYZE TABLE " + table
+		// 更新表统计信息
+		sql := "ANALYZE TABLE " + QuoteTable(db, table)
+		if !IsMySQL(db) {
+			sql = "ANALYZE " + QuoteTable(db, table)
+		}
 		if err := db.Exec(sql).Error; err != nil {
 			logger.GetLogger().Warnf("Failed to analyze table %s: %v", table, err)
 		}
@@ -268,12 +269,9 @@ func AnalyzeDatabase(db *gorm.DB) error {
 	return nil
 }
 
-// GetDatabaseStats 获取数据库统计信息
-func GetDatabaseStats(db *gorm.DB) (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
-
-	// 获取表大小信息
-	rows, err := db.Raw(`
+// 表/索引统计查询，MySQL读information_schema，PostgreSQL读pg_stat系统视图，SQLite读sqlite_master
+const (
+	mysqlTableStatsSQL = `
 		SELECT
 			table_name,
 			table_rows,
@@ -283,7 +281,78 @@ func GetDatabaseStats(db *gorm.DB) (map[string]interface{}, error) {
 		FROM information_schema.tables
 		WHERE table_schema = DATABASE()
 		ORDER BY total_size DESC
-	`).Rows()
+	`
+	mysqlIndexStatsSQL = `
+		SELECT
+			table_name,
+			index_name,
+			cardinality,
+			index_type
+		FROM information_schema.statistics
+		WHERE table_schema = DATABASE()
+		AND index_name != 'PRIMARY'
+		ORDER BY table_name, cardinality DESC
+	`
+	postgresTableStatsSQL = `
+		SELECT
+			relname AS table_name,
+			n_live_tup AS table_rows,
+			pg_table_size(relid) AS data_length,
+			pg_indexes_size(relid) AS index_length,
+			pg_total_relation_size(relid) AS total_size
+		FROM pg_stat_user_tables
+		ORDER BY total_size DESC
+	`
+	postgresIndexStatsSQL = `
+		SELECT
+			s.relname AS table_name,
+			s.indexrelname AS index_name,
+			CAST(c.reltuples AS BIGINT) AS cardinality,
+			am.amname AS index_type
+		FROM pg_stat_user_indexes s
+		JOIN pg_class c ON c.oid = s.indexrelid
+		JOIN pg_am am ON am.oid = c.relam
+		WHERE s.indexrelname NOT LIKE '%_pkey'
+		ORDER BY s.relname, c.reltuples DESC
+	`
+	// SQLite没有表大小统计，只列出表和索引
+	sqliteTableStatsSQL = `
+		SELECT
+			name AS table_name,
+			0 AS table_rows,
+			0 AS data_length,
+			0 AS index_length,
+			0 AS total_size
+		FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name
+	`
+	sqliteIndexStatsSQL = `
+		SELECT
+			tbl_name AS table_name,
+			name AS index_name,
+			0 AS cardinality,
+			'btree' AS index_type
+		FROM sqlite_master
+		WHERE type = 'index' AND name NOT LIKE 'sqlite_%'
+		ORDER BY tbl_name, name
+	`
+)
+
+// GetDatabaseStats 获取数据库统计信息
+func GetDatabaseStats(db *gorm.DB) (map[string]interface{}, error) {
+	stats := make(map[string]interface{})
+
+	tableSQL, indexSQL := mysqlTableStatsSQL, mysqlIndexStatsSQL
+	switch Dialect(db) {
+	case DriverPostgres:
+		tableSQL, indexSQL = postgresTableStatsSQL, postgresIndexStatsSQL
+	case DriverSQLite:
+		tableSQL, indexSQL = sqliteTableStatsSQL, sqliteIndexStatsSQL
+	}
+
+	// 获取表大小信息
+	rows, err := db.Raw(tableSQL).Rows()
 
 	if err != nil {
 		return nil, err
@@ -312,17 +381,7 @@ func GetDatabaseStats(db *gorm.DB) (map[string]interface{}, error) {
 	stats["tables"] = tableStats
 
 	// 获取索引使用情况
-	indexRows, err := db.Raw(`
-		SELECT
-			table_name,
-			index_name,
-			cardinality,
-			index_type
-		FROM information_schema.statistics
-		WHERE table_schema = DATABASE()
-		AND index_name != 'PRIMARY'
-		ORDER BY table_name, cardinality DESC
-	`).Rows()
+	indexRows, err := db.Raw(indexSQL).Rows()
 
 	if err == nil {
 		defer indexRows.Close()
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+)
+
+// 数据库查询相关指标
+var (
+	queryDuration = metrics.NewHistogram("db_query_duration_seconds", "SQL执行耗时", nil)
+	slowQueries   = metrics.NewCounter("db_slow_queries_total", "超过慢查询阈值的SQL数")
+	queryErrors   = metrics.NewCounter("db_query_errors_total", "执行出错的SQL数（不含记录不存在）")
+)
+
+// defaultSlowThreshold 未配置或配置无效时的慢查询阈值
+const defaultSlowThreshold = 200 * time.Millisecond
+
+// queryLogger GORM日志实现：记录慢查询和出错的SQL（不含绑定参数），并统计到指标中
+// 日志带上context中的请求ID，调用方需通过 db.WithContext(ctx) 传入请求上下文
+type queryLogger struct {
+	slowThreshold time.Duration
+	level         gormlogger.LogLevel
+}
+
+// newQueryLogger 创建查询日志，slowThreshold为0时不记录慢查询
+func newQueryLogger(slowThreshold time.Duration) *queryLogger {
+	return &queryLogger{slowThreshold: slowThreshold, level: gormlogger.Warn}
+}
+
+// parseSlowThreshold 解析慢查询阈值配置，"0"表示关闭
+func parseSlowThreshold(value string) time.Duration {
+	if value == "" {
+		return defaultSlowThreshold
+	}
+	threshold, err := time.ParseDuration(value)
+	if err != nil || threshold < 0 {
+		logger.GetLogger().Warnf("慢查询阈值配置无效: %q，使用默认值 %v", value, defaultSlowThreshold)
+		return defaultSlowThreshold
+	}
+	return threshold
+}
+
+// LogMode 设置日志级别
+func (l *queryLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	clone := *l
+	clone.level = level
+	return &clone
+}
+
+// Info 输出信息日志
+func (l *queryLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Info {
+		logger.WithContext(ctx).Infof(msg, data...)
+	}
+}
+
+// Warn 输出警告日志
+func (l *queryLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		logger.WithContext(ctx).Warnf(msg, data...)
+	}
+}
+
+// Error 输出错误日志
+func (l *queryLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Error {
+		logger.WithContext(ctx).Errorf(msg, data...)
+	}
+}
+
+// Trace 每条SQL执行后调用，统计耗时并记录慢查询和出错的SQL
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	queryDuration.ObserveDuration(elapsed)
+
+	isError := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	isSlow := l.slowThreshold > 0 && elapsed > l.slowThreshold
+	if isError {
+		queryErrors.Inc()
+	}
+	if isSlow {
+		slowQueries.Inc()
+	}
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	switch {
+	case isError && l.level >= gormlogger.Error:
+		sql, rows := fc()
+		l.entry(ctx, elapsed, rows).Errorf("SQL执行失败: %v, sql: %s", err, sql)
+	case isSlow && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		l.entry(ctx, elapsed, rows).Warnf("慢查询 >= %v, sql: %s", l.slowThreshold, sql)
+	case l.level >= gormlogger.Info:
+		sql, rows := fc()
+		l.entry(ctx, elapsed, rows).Debugf("sql: %s", sql)
+	}
+}
+
+// ParamsFilter 不把绑定参数写入日志，避免泄露消息内容、手机号等数据
+func (l *queryLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+// entry 构造带耗时、影响行数和调用位置的日志条目
+func (l *queryLogger) entry(ctx context.Context, elapsed time.Duration, rows int64) *logrus.Entry {
+	fields := logrus.Fields{
+		"elapsed_ms": fmt.Sprintf("%.3f", float64(elapsed.Nanoseconds())/1e6),
+		"caller":     utils.FileWithLineNum(),
+	}
+	if rows >= 0 {
+		fields["rows"] = rows
+	}
+	return logger.WithContext(ctx).WithFields(fields)
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+func TestQueryLoggerRecordsSlowQueriesWithoutParams(t *testing.T) {
+	var buf bytes.Buffer
+	previous := logger.Log
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(&buf)
+	t.Cleanup(func() { logger.Log = previous })
+
+	// 阈值设为1ns，所有SQL都算慢查询
+	require.NoError(t, Init(&config.DatabaseConfig{
+		Driver:        DriverSQLite,
+		DBName:        filepath.Join(t.TempDir(), "gochat.db"),
+		SlowThreshold: "1ns",
+	}))
+	t.Cleanup(func() { Close() })
+	require.NoError(t, Migrate())
+
+	before := slowQueries.Value()
+	buf.Reset()
+	ctx := logger.WithRequestID(context.Background(), "req-123")
+	var users []models.User
+	require.NoError(t, DB.WithContext(ctx).Where("phone = ?", "13912345678").Find(&users).Error)
+
+	assert.Greater(t, slowQueries.Value(), before)
+	out := buf.String()
+	assert.Contains(t, out, "慢查询")
+	assert.Contains(t, out, "request_id=req-123")
+	assert.Contains(t, out, "phone = ?")
+	assert.NotContains(t, out, "13912345678")
+}
+
+func TestParseSlowThreshold(t *testing.T) {
+	assert.Equal(t, defaultSlowThreshold, parseSlowThreshold(""))
+	assert.Equal(t, defaultSlowThreshold, parseSlowThreshold("fast"))
+	assert.Equal(t, time.Duration(0), parseSlowThreshold("0"))
+	assert.Equal(t, time.Second, parseSlowThreshold("1s"))
+}
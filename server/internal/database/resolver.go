@@ -0,0 +1,46 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"gochat/internal/config"
+)
+
+// useReplicas 注册只读副本，查询自动路由到副本，写操作和事务仍走主库
+func useReplicas(db *gorm.DB, cfg *config.DatabaseConfig) error {
+	if len(cfg.Replicas) == 0 {
+		return nil
+	}
+
+	replicas := make([]gorm.Dialector, 0, len(cfg.Replicas))
+	for _, dsn := range cfg.Replicas {
+		dialector, err := newDialector(cfg.Driver, dsn)
+		if err != nil {
+			return err
+		}
+		replicas = append(replicas, dialector)
+	}
+
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	}).
+		SetMaxIdleConns(cfg.MaxIdleConns).
+		SetMaxOpenConns(cfg.MaxOpenConns).
+		SetConnMaxLifetime(time.Hour)
+
+	if err := db.Use(resolver); err != nil {
+		return fmt.Errorf("failed to register read replicas: %w", err)
+	}
+	return nil
+}
+
+// Primary 强制后续查询走主库
+// 用于写后立即读、先查后写等不能容忍副本延迟的场景
+func Primary(db *gorm.DB) *gorm.DB {
+	return db.Clauses(dbresolver.Write)
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	dir := t.TempDir()
+	replicaPath := filepath.Join(dir, "replica.db")
+
+	// 副本上只建表不写数据，用于区分查询落在哪个库
+	require.NoError(t, Init(&config.DatabaseConfig{Driver: DriverSQLite, DBName: replicaPath}))
+	require.NoError(t, Migrate())
+	require.NoError(t, Close())
+
+	require.NoError(t, Init(&config.DatabaseConfig{
+		Driver:   DriverSQLite,
+		DBName:   filepath.Join(dir, "primary.db"),
+		Replicas: []string{replicaPath},
+	}))
+	t.Cleanup(func() { Close() })
+	require.NoError(t, Migrate())
+	require.NoError(t, Migrate(), "migration must inspect the primary schema")
+
+	user := &models.User{Phone: "13800000001", PasswordHash: "x", Nickname: "alice"}
+	require.NoError(t, DB.Create(user).Error)
+
+	var count int64
+	require.NoError(t, DB.Model(&models.User{}).Count(&count).Error)
+	assert.Equal(t, int64(0), count, "reads should go to the replica")
+
+	require.NoError(t, Primary(DB).Model(&models.User{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count, "Primary should read from the primary")
+}
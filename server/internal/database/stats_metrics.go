@@ -0,0 +1,58 @@
+package database
+
+import (
+	"database/sql"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/metrics"
+)
+
+// 连接池与数据库状态指标，由后台任务定期采样
+var (
+	poolMaxOpen           = metrics.NewGauge("db_pool_max_open_connections", "连接池最大连接数")
+	poolOpen              = metrics.NewGauge("db_pool_open_connections", "当前打开的连接数（使用中+空闲）")
+	poolInUse             = metrics.NewGauge("db_pool_in_use_connections", "使用中的连接数")
+	poolIdle              = metrics.NewGauge("db_pool_idle_connections", "空闲连接数")
+	poolWaitCount         = metrics.NewGauge("db_pool_wait_count", "累计等待空闲连接的次数")
+	poolWaitDuration      = metrics.NewGauge("db_pool_wait_duration_ms", "累计等待空闲连接的时长（毫秒）")
+	poolMaxIdleClosed     = metrics.NewGauge("db_pool_max_idle_closed", "因超过最大空闲数被关闭的连接数")
+	poolMaxLifetimeClosed = metrics.NewGauge("db_pool_max_lifetime_closed", "因超过最大存活时间被关闭的连接数")
+	tableRows             = metrics.NewGaugeVec("db_table_rows", "各表行数（MySQL、PostgreSQL为统计信息中的估算值，SQLite不统计）", "table")
+)
+
+// SamplePoolStats 采样主库连接池状态并更新指标，返回本次采样结果
+func SamplePoolStats(db *gorm.DB) (sql.DBStats, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return sql.DBStats{}, err
+	}
+	stats := sqlDB.Stats()
+
+	poolMaxOpen.Set(int64(stats.MaxOpenConnections))
+	poolOpen.Set(int64(stats.OpenConnections))
+	poolInUse.Set(int64(stats.InUse))
+	poolIdle.Set(int64(stats.Idle))
+	poolWaitCount.Set(stats.WaitCount)
+	poolWaitDuration.Set(stats.WaitDuration.Milliseconds())
+	poolMaxIdleClosed.Set(stats.MaxIdleClosed)
+	poolMaxLifetimeClosed.Set(stats.MaxLifetimeClosed)
+	return stats, nil
+}
+
+// SampleTableStats 通过GetDatabaseStats采样各表行数并更新指标
+func SampleTableStats(db *gorm.DB) error {
+	stats, err := GetDatabaseStats(db)
+	if err != nil {
+		return err
+	}
+	tables, _ := stats["tables"].([]map[string]interface{})
+	for _, table := range tables {
+		name, _ := table["table_name"].(string)
+		rows, _ := table["table_rows"].(int64)
+		if name != "" {
+			tableRows.WithLabelValues(name).Set(rows)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+func TestSampleStats(t *testing.T) {
+	require.NoError(t, Init(&config.DatabaseConfig{Driver: DriverSQLite, DBName: filepath.Join(t.TempDir(), "gochat.db")}))
+	t.Cleanup(func() { Close() })
+	require.NoError(t, Migrate())
+
+	stats, err := SamplePoolStats(DB)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), poolMaxOpen.Value(), "SQLite使用单连接")
+	assert.Equal(t, int64(stats.OpenConnections), poolOpen.Value())
+
+	require.NoError(t, SampleTableStats(DB))
+	assert.Contains(t, tableRows.Snapshot(), "messages")
+}
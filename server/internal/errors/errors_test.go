@@ -173,6 +173,20 @@ func TestHTTPErrorHandling(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "INTERNAL_ERROR", response.Code)
 		assert.Equal(t, "Internal server error", response.Message)
+		assert.Empty(t, response.RequestID)
+	})
+
+	t.Run("IncludesRequestID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/test", nil)
+		c.Set("request_id", "req-123")
+
+		errors.HandleError(c, errors.NotFound("Message not found"))
+
+		var response errors.HTTPErrorResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "req-123", response.RequestID)
 	})
 
 	t.Run("HandleNilError", func(t *testing.T) {
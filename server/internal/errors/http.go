@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"gochat/internal/errreport"
 	"gochat/internal/logger"
 )
 
@@ -13,6 +14,8 @@ type HTTPErrorResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
 	Details string `json:"details,omitempty"`
+	// RequestID 请求ID，与响应头X-Request-ID相同
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // HandleError 处理错误并返回HTTP响应
@@ -36,14 +39,15 @@ func HandleError(c *gin.Context, err error) {
 
 		// 记录错误（内部错误记录为错误级别，客户端错误记录为警告级别）
 		if statusCode >= 500 {
-			logger.GetLogger().WithFields(map[string]interface{}{
+			logger.WithContext(c.Request.Context()).WithFields(map[string]interface{}{
 				"error_code": appErr.Code,
 				"cause":      appErr.Cause,
 				"path":       c.Request.URL.Path,
 				"method":     c.Request.Method,
 			}).Errorf("Internal error: %s", appErr.Message)
+			errreport.CaptureRequestError(c, err)
 		} else {
-			logger.GetLogger().WithFields(map[string]interface{}{
+			logger.WithContext(c.Request.Context()).WithFields(map[string]interface{}{
 				"error_code": appErr.Code,
 				"path":       c.Request.URL.Path,
 				"method":     c.Request.Method,
@@ -58,12 +62,14 @@ func HandleError(c *gin.Context, err error) {
 		}
 
 		// 记录原始错误详情
-		logger.GetLogger().WithFields(map[string]interface{}{
+		logger.WithContext(c.Request.Context()).WithFields(map[string]interface{}{
 			"path":   c.Request.URL.Path,
 			"method": c.Request.Method,
 		}).Errorf("Unexpected error: %v", err)
+		errreport.CaptureRequestError(c, err)
 	}
 
+	response.RequestID = c.GetString("request_id")
 	c.JSON(statusCode, response)
 }
 
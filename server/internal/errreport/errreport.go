@@ -0,0 +1,324 @@
+package errreport
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/buildinfo"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+)
+
+// 事件级别
+const (
+	LevelError = "error"
+	LevelFatal = "fatal" // panic
+)
+
+// maxFrames 每个事件最多保留的调用栈帧数
+const maxFrames = 50
+
+// reportsTotal 错误上报次数，result: sent、failed、dropped（队列已满）、sampled_out（未被采样）
+var reportsTotal = metrics.NewCounterVec("error_reports_total", "错误上报次数，result: sent、failed、dropped（队列已满）、sampled_out（未被采样）", "result")
+
+// Frame 调用栈帧，字段与Sentry的stacktrace frame一致
+type Frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// User 出错时的用户
+type User struct {
+	ID        string `json:"id,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+// Request 出错时的HTTP请求，不含查询参数和认证相关的请求头
+type Request struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Event 一次错误事件
+type Event struct {
+	ID        string // 32位十六进制
+	Timestamp time.Time
+	Level     string
+	Type      string // 错误类型，如*errors.AppError，panic时为panic
+	Message   string
+	Stack     []Frame // 从外层调用到出错位置
+	User      *User
+	Request   *Request
+	Tags      map[string]string
+}
+
+// Reporter 错误上报的后端，Report在后台goroutine中调用
+type Reporter interface {
+	Report(ctx context.Context, event *Event) error
+}
+
+// Options 上报客户端选项
+type Options struct {
+	SampleRate float64       // 采样率（0-1）
+	Timeout    time.Duration // 单次上报的超时时间
+	QueueSize  int           // 待上报队列长度
+}
+
+// Client 错误上报客户端，按采样率把事件放入队列，由后台goroutine逐个交给Reporter，上报不阻塞请求
+type Client struct {
+	reporter   Reporter
+	sampleRate float64
+	timeout    time.Duration
+	random     func() float64
+
+	mutex  sync.RWMutex
+	closed bool
+	queue  chan *Event
+	done   chan struct{}
+}
+
+// NewClient 创建上报客户端并启动后台goroutine
+func NewClient(reporter Reporter, opts Options) *Client {
+	c := &Client{
+		reporter:   reporter,
+		sampleRate: opts.SampleRate,
+		timeout:    opts.Timeout,
+		random:     rand.Float64,
+		queue:      make(chan *Event, opts.QueueSize),
+		done:       make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// run 逐个上报队列中的事件，队列关闭后退出
+func (c *Client) run() {
+	defer close(c.done)
+	for event := range c.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		err := c.reporter.Report(ctx, event)
+		cancel()
+		if err != nil {
+			reportsTotal.WithLabelValues("failed").Inc()
+			logger.GetLogger().Warnf("上报错误失败: %v", err)
+			continue
+		}
+		reportsTotal.WithLabelValues("sent").Inc()
+	}
+}
+
+// Capture 按采样率把事件放入上报队列，队列已满或客户端已关闭时丢弃；c为nil时不上报
+func (c *Client) Capture(event *Event) {
+	if c == nil {
+		return
+	}
+	if c.sampleRate < 1 && c.random() >= c.sampleRate {
+		reportsTotal.WithLabelValues("sampled_out").Inc()
+		return
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.queue <- event:
+	default:
+		reportsTotal.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Close 停止接收新事件，等待队列中的事件上报完成，最多等待timeout
+func (c *Client) Close(timeout time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.mutex.Unlock()
+
+	select {
+	case <-c.done:
+	case <-time.After(timeout):
+		logger.GetLogger().Warnf("错误上报队列在%v内未发送完，剩余%d个事件被丢弃", timeout, len(c.queue))
+	}
+}
+
+var defaultClient atomic.Pointer[Client]
+
+// Init 按配置初始化默认客户端，未配置dsn时不上报；environment为空时使用serverMode，release为空时使用构建版本
+func Init(cfg *config.ErrorReportingConfig, serverMode string) error {
+	if cfg.DSN == "" {
+		return nil
+	}
+	environment := cfg.Environment
+	if environment == "" {
+		environment = serverMode
+	}
+	release := cfg.Release
+	if release == "" {
+		release = buildinfo.Version
+	}
+	timeout, _ := time.ParseDuration(cfg.Timeout)
+	sentry, err := NewSentry(cfg.DSN, environment, release)
+	if err != nil {
+		return err
+	}
+	SetDefault(NewClient(sentry, Options{SampleRate: cfg.SampleRate, Timeout: timeout, QueueSize: cfg.QueueSize}))
+	return nil
+}
+
+// SetDefault 替换默认客户端，可接入自定义的Reporter；nil表示不上报
+func SetDefault(c *Client) {
+	defaultClient.Store(c)
+}
+
+// Close 关闭默认客户端，在进程退出前调用以发送队列中的事件
+func Close(timeout time.Duration) {
+	defaultClient.Load().Close(timeout)
+}
+
+// CaptureError 上报错误，tags附加到事件上（如后台任务名称）
+func CaptureError(ctx context.Context, err error, tags map[string]string) {
+	c := defaultClient.Load()
+	if c == nil || err == nil {
+		return
+	}
+	event := newEvent(LevelError, fmt.Sprintf("%T", err), err.Error(), 2)
+	for key, value := range tags {
+		event.Tags[key] = value
+	}
+	if requestID := logger.RequestIDFrom(ctx); requestID != "" {
+		event.Tags["request_id"] = requestID
+	}
+	c.Capture(event)
+}
+
+// CaptureRequestError 上报请求处理中的错误，附加用户、请求和请求ID
+func CaptureRequestError(c *gin.Context, err error) {
+	client := defaultClient.Load()
+	if client == nil || err == nil {
+		return
+	}
+	event := newEvent(LevelError, fmt.Sprintf("%T", err), err.Error(), 2)
+	withRequest(event, c)
+	client.Capture(event)
+}
+
+// CapturePanic 上报请求处理中recover的panic，需在recover所在的调用中使用，调用栈才包含panic的位置
+func CapturePanic(c *gin.Context, recovered interface{}) {
+	client := defaultClient.Load()
+	if client == nil {
+		return
+	}
+	typ := "panic"
+	if err, ok := recovered.(error); ok {
+		typ = fmt.Sprintf("%T", err)
+	}
+	event := newEvent(LevelFatal, typ, fmt.Sprint(recovered), 2)
+	withRequest(event, c)
+	client.Capture(event)
+}
+
+// withRequest 把请求的用户、方法、地址和请求ID附加到事件上
+func withRequest(event *Event, c *gin.Context) {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	event.Request = &Request{
+		Method:  c.Request.Method,
+		URL:     scheme + "://" + c.Request.Host + c.Request.URL.Path,
+		Headers: map[string]string{"User-Agent": c.Request.UserAgent()},
+	}
+	event.User = &User{IPAddress: c.ClientIP()}
+	if userID, ok := c.Get("user_id"); ok {
+		event.User.ID = fmt.Sprint(userID)
+	}
+	if requestID := c.GetString("request_id"); requestID != "" {
+		event.Tags["request_id"] = requestID
+	}
+	if route := c.FullPath(); route != "" {
+		event.Tags["route"] = route
+	}
+}
+
+// newEvent 创建事件并记录调用栈，skip为要跳过的调用层数（含newEvent本身），调用栈从调用Capture*的位置开始
+func newEvent(level, typ, message string, skip int) *Event {
+	return &Event{
+		ID:        logger.NewRequestID(),
+		Timestamp: time.Now(),
+		Level:     level,
+		Type:      typ,
+		Message:   message,
+		Stack:     stacktrace(skip),
+		Tags:      map[string]string{},
+	}
+}
+
+// stacktrace 当前goroutine的调用栈，跳过stacktrace之上的skip层，去掉runtime的帧，顺序为从外层调用到出错位置
+func stacktrace(skip int) []Frame {
+	pcs := make([]uintptr, maxFrames)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []Frame
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && !strings.HasPrefix(frame.Function, "runtime.") {
+			module, function := splitFunction(frame.Function)
+			stack = append(stack, Frame{
+				Function: function,
+				Module:   module,
+				Filename: shortFilename(frame.File),
+				AbsPath:  frame.File,
+				Lineno:   frame.Line,
+				InApp:    module == "main" || strings.HasPrefix(module, "gochat/"),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return stack
+}
+
+// splitFunction 把gochat/internal/services.(*MessageService).SendMessage拆分为包路径和函数名
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
+
+// shortFilename 只保留文件所在目录和文件名
+func shortFilename(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) <= 2 {
+		return path
+	}
+	return strings.Join(parts[len(parts)-2:], "/")
+}
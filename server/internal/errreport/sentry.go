@@ -0,0 +1,131 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrInvalidDSN DSN格式不正确
+var ErrInvalidDSN = errors.New("errreport: invalid dsn")
+
+// sentryClientName 上报时的客户端标识
+const sentryClientName = "gochat/1.0"
+
+// Sentry 通过Sentry的store接口上报事件，兼容Sentry和GlitchTip等实现了该接口的服务
+type Sentry struct {
+	storeURL    string
+	authHeader  string
+	environment string
+	release     string
+	serverName  string
+	httpClient  *http.Client
+}
+
+// NewSentry 按DSN（https://<key>@<host>/<project_id>）创建Sentry上报后端
+func NewSentry(dsn, environment, release string) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, ErrInvalidDSN
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	projectID := path[slash+1:]
+	if projectID == "" {
+		return nil, ErrInvalidDSN
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClientName, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	serverName, _ := os.Hostname()
+	return &Sentry{
+		storeURL:    fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:slash], projectID),
+		authHeader:  auth,
+		environment: environment,
+		release:     release,
+		serverName:  serverName,
+		httpClient:  &http.Client{},
+	}, nil
+}
+
+// sentryEvent Sentry事件格式
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Exception   sentryExceptions  `json:"exception"`
+	User        *User             `json:"user,omitempty"`
+	Request     *Request          `json:"request,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+// Report 上报事件，服务端返回非2xx（包括429限流）时返回错误
+func (s *Sentry) Report(ctx context.Context, event *Event) error {
+	exception := sentryException{Type: event.Type, Value: event.Message}
+	if len(event.Stack) > 0 {
+		exception.Stacktrace = &sentryStacktrace{Frames: event.Stack}
+	}
+	body, err := json.Marshal(sentryEvent{
+		EventID:     event.ID,
+		Timestamp:   event.Timestamp.UTC().Format(time.RFC3339Nano),
+		Level:       event.Level,
+		Platform:    "go",
+		Logger:      "gochat",
+		ServerName:  s.serverName,
+		Environment: s.environment,
+		Release:     s.release,
+		Exception:   sentryExceptions{Values: []sentryException{exception}},
+		User:        event.User,
+		Request:     event.Request,
+		Tags:        event.Tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.authHeader)
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gochat/internal/config"
+)
+
+// 事件总线类型
+const (
+	BackendNone  = "none"
+	BackendNATS  = "nats"
+	BackendKafka = "kafka"
+)
+
+// Publisher 把事件发布到外部消息总线
+// key用于Kafka分区（同一key的事件保持顺序），NATS不使用；Publish返回nil表示总线已接收该事件
+type Publisher interface {
+	Publish(ctx context.Context, topic, key string, data []byte) error
+	Close() error
+}
+
+// New 按配置创建发布器，backend为none时返回nil（事件只在进程内投递）
+func New(cfg *config.EventBusConfig) (Publisher, error) {
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	switch cfg.Backend {
+	case "", BackendNone:
+		return nil, nil
+	case BackendNATS:
+		return NewNATS(&cfg.NATS, timeout)
+	case BackendKafka:
+		return NewKafka(&cfg.Kafka, timeout)
+	default:
+		return nil, fmt.Errorf("unsupported event bus backend: %s", cfg.Backend)
+	}
+}
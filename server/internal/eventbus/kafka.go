@@ -0,0 +1,97 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gochat/internal/config"
+)
+
+// Kafka 通过Kafka REST Proxy（v2接口）发布事件，事件内容以JSON格式写入
+type Kafka struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// kafkaProduceResponse REST Proxy的发布结果，每条记录对应一个offset，失败的记录带有error
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// NewKafka 创建Kafka发布器
+func NewKafka(cfg *config.KafkaConfig, timeout time.Duration) (*Kafka, error) {
+	u, err := url.Parse(strings.TrimRight(cfg.RESTProxyURL, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid kafka rest proxy url: %q", cfg.RESTProxyURL)
+	}
+	return &Kafka{
+		baseURL:    u.String(),
+		username:   cfg.Username,
+		password:   cfg.Password,
+		httpClient: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Publish 发布一条记录到topic，key决定分区，同一key的记录保持顺序
+func (k *Kafka) Publish(ctx context.Context, topic, key string, data []byte) error {
+	if !json.Valid(data) {
+		return fmt.Errorf("kafka: event data must be JSON")
+	}
+	record := map[string]interface{}{"value": json.RawMessage(data)}
+	if key != "" {
+		record["key"] = key
+	}
+	body, err := json.Marshal(map[string]interface{}{"records": []interface{}{record}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.baseURL+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if k.username != "" {
+		req.SetBasicAuth(k.username, k.password)
+	}
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("kafka: publish to %s failed with status %d: %s", topic, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	var result kafkaProduceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("kafka: invalid response: %w", err)
+	}
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil || offset.Error != "" {
+			return fmt.Errorf("kafka: publish to %s failed: %s", topic, offset.Error)
+		}
+	}
+	return nil
+}
+
+// Close REST Proxy没有长连接，无需关闭
+func (k *Kafka) Close() error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+func newTestKafka(t *testing.T, handler http.HandlerFunc) *Kafka {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	publisher, err := NewKafka(&config.KafkaConfig{RESTProxyURL: server.URL + "/", Username: "gochat", Password: "secret"}, 5*time.Second)
+	require.NoError(t, err)
+	return publisher
+}
+
+func TestKafkaPublish(t *testing.T) {
+	var body struct {
+		Records []struct {
+			Key   string          `json:"key"`
+			Value json.RawMessage `json:"value"`
+		} `json:"records"`
+	}
+	publisher := newTestKafka(t, func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "gochat", user)
+		assert.Equal(t, "secret", pass)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/topics/gochat.message.sent", r.URL.Path)
+		assert.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":12}]}`))
+	})
+
+	require.NoError(t, publisher.Publish(context.Background(), "gochat.message.sent", "42", []byte(`{"id":1}`)))
+	require.Len(t, body.Records, 1)
+	assert.Equal(t, "42", body.Records[0].Key)
+	assert.JSONEq(t, `{"id":1}`, string(body.Records[0].Value))
+
+	assert.Error(t, publisher.Publish(context.Background(), "gochat.message.sent", "42", []byte("not json")))
+}
+
+func TestKafkaPublishErrors(t *testing.T) {
+	status := http.StatusNotFound
+	publisher := newTestKafka(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status == http.StatusNotFound {
+			w.Write([]byte(`{"error_code":40401,"message":"Topic not found."}`))
+			return
+		}
+		w.Write([]byte(`{"offsets":[{"partition":null,"offset":null,"error_code":50003,"error":"Leader not available"}]}`))
+	})
+
+	err := publisher.Publish(context.Background(), "missing", "", []byte(`{}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Topic not found.")
+
+	// 请求成功但记录写入失败
+	status = http.StatusOK
+	err = publisher.Publish(context.Background(), "gochat.user.registered", "", []byte(`{}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Leader not available")
+}
+
+func TestNewPublisher(t *testing.T) {
+	publisher, err := New(&config.EventBusConfig{Backend: BackendNone})
+	require.NoError(t, err)
+	assert.Nil(t, publisher)
+
+	publisher, err = New(&config.EventBusConfig{Backend: BackendKafka, Kafka: config.KafkaConfig{RESTProxyURL: "http://localhost:8082"}})
+	require.NoError(t, err)
+	assert.IsType(t, &Kafka{}, publisher)
+
+	_, err = New(&config.EventBusConfig{Backend: "rabbitmq"})
+	assert.Error(t, err)
+}
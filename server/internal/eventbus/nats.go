@@ -0,0 +1,196 @@
+package eventbus
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gochat/internal/config"
+)
+
+// NATS 基于NATS核心协议的发布器，只实现发布需要的INFO/CONNECT/PUB/PING/PONG
+// 连接在首次发布时建立，出错后关闭，下次发布时重新连接
+type NATS struct {
+	mutex    sync.Mutex
+	url      *url.URL
+	username string
+	password string
+	token    string
+	timeout  time.Duration
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// natsInfo 服务端INFO中用到的字段
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// NewNATS 创建NATS发布器，不会立即连接
+func NewNATS(cfg *config.NATSConfig, timeout time.Duration) (*NATS, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+		return nil, fmt.Errorf("invalid nats url: %q", cfg.URL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &NATS{
+		url:      u,
+		username: cfg.Username,
+		password: cfg.Password,
+		token:    cfg.Token,
+		timeout:  timeout,
+	}, nil
+}
+
+// Publish 发布消息到subject，PUB之后发送PING并等待PONG，收到PONG说明服务端已处理该消息
+func (n *NATS) Publish(ctx context.Context, subject, key string, data []byte) error {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("invalid nats subject: %q", subject)
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if err := n.publishLocked(ctx, subject, data); err != nil {
+		n.closeLocked()
+		return err
+	}
+	return nil
+}
+
+func (n *NATS) publishLocked(ctx context.Context, subject string, data []byte) error {
+	if n.conn == nil {
+		if err := n.connectLocked(ctx); err != nil {
+			return err
+		}
+	}
+	n.conn.SetDeadline(n.deadline(ctx))
+
+	frame := make([]byte, 0, len(subject)+len(data)+32)
+	frame = fmt.Appendf(frame, "PUB %s %d\r\n", subject, len(data))
+	frame = append(frame, data...)
+	frame = append(frame, "\r\nPING\r\n"...)
+	if _, err := n.conn.Write(frame); err != nil {
+		return err
+	}
+	return n.waitPong()
+}
+
+// connectLocked 建立连接：读取INFO，需要时升级TLS，发送CONNECT后用PING/PONG确认认证通过
+func (n *NATS) connectLocked(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: n.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.url.Host)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(n.deadline(ctx))
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		conn.Close()
+		return fmt.Errorf("nats: invalid INFO: %w", err)
+	}
+
+	if n.url.Scheme == "tls" || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: n.url.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "gochat",
+		"lang":     "go",
+		"protocol": 1,
+	}
+	if n.token != "" {
+		options["auth_token"] = n.token
+	}
+	if n.username != "" {
+		options["user"] = n.username
+		options["pass"] = n.password
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		conn.Close()
+		return err
+	}
+
+	n.conn, n.reader = conn, reader
+	return n.waitPong()
+}
+
+// waitPong 读取服务端消息直到PONG，期间响应服务端的PING，收到-ERR时返回错误
+func (n *NATS) waitPong() error {
+	for {
+		line, err := n.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats: " + strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+	}
+}
+
+// deadline 单次操作的截止时间，取超时时间和ctx截止时间中较早的一个
+func (n *NATS) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(n.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// Close 关闭连接
+func (n *NATS) Close() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.closeLocked()
+	return nil
+}
+
+func (n *NATS) closeLocked() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn, n.reader = nil, nil
+	}
+}
@@ -0,0 +1,127 @@
+package eventbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+// natsPub 假服务端收到的PUB
+type natsPub struct {
+	subject string
+	payload string
+}
+
+// newFakeNATS 启动只支持CONNECT/PUB/PING的假NATS服务端，authErr不为空时拒绝CONNECT
+func newFakeNATS(t *testing.T, authErr string) (string, <-chan map[string]interface{}, <-chan natsPub) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	connects := make(chan map[string]interface{}, 10)
+	pubs := make(chan natsPub, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeNATS(conn, authErr, connects, pubs)
+		}
+	}()
+	return "nats://" + listener.Addr().String(), connects, pubs
+}
+
+func serveFakeNATS(conn net.Conn, authErr string, connects chan<- map[string]interface{}, pubs chan<- natsPub) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	conn.Write([]byte(`INFO {"server_id":"test","version":"2.10.0","max_payload":1048576}` + "\r\n"))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			var options map[string]interface{}
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &options)
+			connects <- options
+			if authErr != "" {
+				conn.Write([]byte("-ERR '" + authErr + "'\r\n"))
+				return
+			}
+		case strings.HasPrefix(line, "PUB "):
+			fields := strings.Fields(line)
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			pubs <- natsPub{subject: fields[1], payload: string(payload[:size])}
+		case line == "PING":
+			// 先发一个服务端PING，检查客户端会回复PONG
+			conn.Write([]byte("PING\r\nPONG\r\n"))
+		}
+	}
+}
+
+func TestNATSPublish(t *testing.T) {
+	url, connects, pubs := newFakeNATS(t, "")
+	publisher, err := NewNATS(&config.NATSConfig{URL: url, Username: "gochat", Password: "secret"}, 5*time.Second)
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	ctx := context.Background()
+	require.NoError(t, publisher.Publish(ctx, "gochat.message.sent", "42", []byte(`{"id":1}`)))
+	require.NoError(t, publisher.Publish(ctx, "gochat.user.registered", "7", []byte("line1\r\nline2")))
+
+	// 两次发布复用同一连接
+	options := <-connects
+	assert.Equal(t, "gochat", options["user"])
+	assert.Equal(t, "secret", options["pass"])
+	assert.Equal(t, false, options["verbose"])
+	assert.Empty(t, connects)
+
+	assert.Equal(t, natsPub{subject: "gochat.message.sent", payload: `{"id":1}`}, <-pubs)
+	assert.Equal(t, natsPub{subject: "gochat.user.registered", payload: "line1\r\nline2"}, <-pubs)
+}
+
+func TestNATSPublishError(t *testing.T) {
+	url, connects, _ := newFakeNATS(t, "Authorization Violation")
+	publisher, err := NewNATS(&config.NATSConfig{URL: url, Token: "wrong"}, 5*time.Second)
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	err = publisher.Publish(context.Background(), "gochat.group.created", "1", []byte(`{}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Authorization Violation")
+	assert.Equal(t, "wrong", (<-connects)["auth_token"])
+
+	// 出错后关闭连接，下次发布重新连接
+	require.Error(t, publisher.Publish(context.Background(), "gochat.group.created", "1", []byte(`{}`)))
+	assert.Len(t, connects, 1)
+
+	assert.Error(t, publisher.Publish(context.Background(), "bad subject", "", nil))
+}
+
+func TestNewNATSRejectsInvalidURL(t *testing.T) {
+	_, err := NewNATS(&config.NATSConfig{URL: "http://localhost:4222"}, time.Second)
+	assert.Error(t, err)
+
+	publisher, err := NewNATS(&config.NATSConfig{URL: "nats://localhost"}, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:4222", publisher.url.Host)
+}
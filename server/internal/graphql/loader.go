@@ -0,0 +1,135 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// batchWait 批量加载器收集键的时间窗口，窗口内的加载合并为一次查询
+	batchWait = 2 * time.Millisecond
+	// maxBatch 一次批量查询的最大键数，达到后立即查询
+	maxBatch = 100
+)
+
+// loader 请求内的批量加载器：并发解析的字段各自调用Load，同一时间窗口内的键合并为一次fetch，
+// 结果在请求内缓存，同一个键只查询一次。每个请求创建新的加载器，不跨请求共享
+type loader[V any] struct {
+	fetch func(ctx context.Context, ids []int64) (map[int64]V, error)
+
+	mu      sync.Mutex
+	batches map[int64]*batch[V] // 每个键所在的批次（包括进行中的）
+	pending *batch[V]           // 正在收集键、尚未查询的批次
+}
+
+// batch 一次批量查询，done关闭后values和err可读
+type batch[V any] struct {
+	ids    []int64
+	done   chan struct{}
+	values map[int64]V
+	err    error
+}
+
+func newLoader[V any](fetch func(ctx context.Context, ids []int64) (map[int64]V, error)) *loader[V] {
+	return &loader[V]{fetch: fetch, batches: make(map[int64]*batch[V])}
+}
+
+// Load 加载单个键，等待所在批次查询完成；键不存在时返回零值
+func (l *loader[V]) Load(ctx context.Context, id int64) (V, error) {
+	b := l.schedule(ctx, []int64{id}, false)[id]
+	var zero V
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+	if b.err != nil {
+		return zero, b.err
+	}
+	return b.values[id], nil
+}
+
+// LoadMany 加载多个键，未加载过的键立即合并查询而不等待时间窗口；不存在的键不出现在结果中
+// 解析列表时先调用LoadMany，列表项的字段再调用Load时直接命中
+func (l *loader[V]) LoadMany(ctx context.Context, ids []int64) (map[int64]V, error) {
+	batches := l.schedule(ctx, ids, true)
+	values := make(map[int64]V, len(ids))
+	for _, id := range ids {
+		b := batches[id]
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if b.err != nil {
+			return nil, b.err
+		}
+		if value, ok := b.values[id]; ok {
+			values[id] = value
+		}
+	}
+	return values, nil
+}
+
+// schedule 把未加载过的键加入待查询批次，返回每个键所在的批次
+// now为true时立即查询待查询批次，否则由时间窗口结束或批次满时触发
+func (l *loader[V]) schedule(ctx context.Context, ids []int64, now bool) map[int64]*batch[V] {
+	found := make(map[int64]*batch[V], len(ids))
+	var ready []*batch[V]
+
+	l.mu.Lock()
+	for _, id := range ids {
+		if b, ok := l.batches[id]; ok {
+			found[id] = b
+			continue
+		}
+		if l.pending == nil {
+			b := &batch[V]{done: make(chan struct{})}
+			l.pending = b
+			time.AfterFunc(batchWait, func() { l.flush(ctx, b) })
+		}
+		b := l.pending
+		b.ids = append(b.ids, id)
+		l.batches[id] = b
+		found[id] = b
+		if len(b.ids) >= maxBatch {
+			l.pending = nil
+			ready = append(ready, b)
+		}
+	}
+	if now && l.pending != nil {
+		ready = append(ready, l.pending)
+		l.pending = nil
+	}
+	l.mu.Unlock()
+
+	for _, b := range ready {
+		l.run(ctx, b)
+	}
+	return found
+}
+
+// flush 时间窗口结束时查询批次，批次已因满或LoadMany被查询时跳过
+func (l *loader[V]) flush(ctx context.Context, b *batch[V]) {
+	l.mu.Lock()
+	if l.pending != b {
+		l.mu.Unlock()
+		return
+	}
+	l.pending = nil
+	l.mu.Unlock()
+	l.run(ctx, b)
+}
+
+// run 执行查询并唤醒等待的调用方，fetch panic时作为错误返回（时间窗口触发的查询不在解析字段的goroutine中）
+func (l *loader[V]) run(ctx context.Context, b *batch[V]) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.values, b.err = nil, fmt.Errorf("batch load panic: %v", r)
+		}
+		close(b.done)
+	}()
+	b.values, b.err = l.fetch(ctx, b.ids)
+}
@@ -0,0 +1,115 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFetch 返回键的两倍作为值，记录每次查询的键，键为0时视为不存在
+func countingFetch() (func(ctx context.Context, ids []int64) (map[int64]int64, error), func() [][]int64) {
+	var mu sync.Mutex
+	var calls [][]int64
+	fetch := func(ctx context.Context, ids []int64) (map[int64]int64, error) {
+		mu.Lock()
+		calls = append(calls, append([]int64(nil), ids...))
+		mu.Unlock()
+		values := make(map[int64]int64, len(ids))
+		for _, id := range ids {
+			if id != 0 {
+				values[id] = id * 2
+			}
+		}
+		return values, nil
+	}
+	return fetch, func() [][]int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+func TestLoaderBatchesConcurrentLoads(t *testing.T) {
+	fetch, calls := countingFetch()
+	l := newLoader(fetch)
+
+	var wg sync.WaitGroup
+	results := make([]int64, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := l.Load(context.Background(), int64(i%5+1))
+			assert.NoError(t, err)
+			results[i] = value
+		}(i)
+	}
+	wg.Wait()
+
+	for i, value := range results {
+		assert.Equal(t, int64(i%5+1)*2, value)
+	}
+	require.Len(t, calls(), 1)
+	assert.ElementsMatch(t, []int64{1, 2, 3, 4, 5}, calls()[0])
+
+	// 已加载的键不再查询
+	value, err := l.Load(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), value)
+	assert.Len(t, calls(), 1)
+}
+
+func TestLoaderLoadMany(t *testing.T) {
+	fetch, calls := countingFetch()
+	l := newLoader(fetch)
+
+	values, err := l.LoadMany(context.Background(), []int64{1, 0, 2, 1})
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int64{1: 2, 2: 4}, values)
+
+	values, err = l.LoadMany(context.Background(), []int64{2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int64{2: 4, 3: 6}, values)
+	assert.Equal(t, [][]int64{{1, 0, 2}, {3}}, calls())
+
+	missing, err := l.Load(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Zero(t, missing)
+}
+
+func TestLoaderSplitsLargeBatches(t *testing.T) {
+	fetch, calls := countingFetch()
+	l := newLoader(fetch)
+
+	ids := make([]int64, maxBatch+1)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+	values, err := l.LoadMany(context.Background(), ids)
+	require.NoError(t, err)
+	assert.Len(t, values, len(ids))
+	require.Len(t, calls(), 2)
+	assert.Len(t, calls()[0], maxBatch)
+	assert.Len(t, calls()[1], 1)
+}
+
+func TestLoaderErrors(t *testing.T) {
+	failed := errors.New("db down")
+	l := newLoader(func(ctx context.Context, ids []int64) (map[int64]int64, error) {
+		return nil, failed
+	})
+	_, err := l.Load(context.Background(), 1)
+	assert.ErrorIs(t, err, failed)
+	_, err = l.LoadMany(context.Background(), []int64{1, 2})
+	assert.ErrorIs(t, err, failed)
+
+	panicking := newLoader(func(ctx context.Context, ids []int64) (map[int64]int64, error) {
+		panic("boom")
+	})
+	_, err = panicking.Load(context.Background(), 1)
+	assert.EqualError(t, err, "batch load panic: boom")
+}
@@ -0,0 +1,398 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+
+	gql "github.com/graph-gophers/graphql-go"
+
+	"gochat/internal/logger"
+	"gochat/internal/models"
+	"gochat/internal/services"
+)
+
+const (
+	// maxBatchUsers users查询一次最多获取的用户数
+	maxBatchUsers = 100
+	// maxMessageLimit 一页消息的最大条数，与REST接口的page_size一致
+	maxMessageLimit = 100
+)
+
+// queryError 返回给客户端的错误，错误码放在extensions.code中
+type queryError struct {
+	code    string
+	message string
+}
+
+func (e *queryError) Error() string { return e.message }
+
+func (e *queryError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+var (
+	errForbidden = &queryError{code: "FORBIDDEN", message: "not a member of the group"}
+	errInternal  = &queryError{code: "INTERNAL", message: "internal error"}
+)
+
+func badInput(message string) error {
+	return &queryError{code: "BAD_INPUT", message: message}
+}
+
+// internalError 记录服务层错误，客户端只收到INTERNAL，不暴露数据库等内部错误信息
+func internalError(ctx context.Context, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	logger.WithContext(ctx).Errorf("graphql query failed: %v", err)
+	return errInternal
+}
+
+func parseID(id gql.ID) (int64, error) {
+	value, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil || value <= 0 {
+		return 0, badInput("invalid id: " + string(id))
+	}
+	return value, nil
+}
+
+func toID(id int64) gql.ID {
+	return gql.ID(strconv.FormatInt(id, 10))
+}
+
+// resolver 查询的根解析器
+type resolver struct{}
+
+// Me 当前登录的用户
+func (r *resolver) Me(ctx context.Context) (*userResolver, error) {
+	state := stateFrom(ctx)
+	user, err := state.users.Load(ctx, state.viewerID)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	if user == nil {
+		return nil, &queryError{code: "NOT_FOUND", message: "user not found"}
+	}
+	return &userResolver{user: user}, nil
+}
+
+// User 按ID获取用户，不存在时返回null
+func (r *resolver) User(ctx context.Context, args struct{ ID gql.ID }) (*userResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return loadUser(ctx, id)
+}
+
+// Users 批量获取用户，按传入的顺序返回，不存在的和重复的不返回
+func (r *resolver) Users(ctx context.Context, args struct{ IDs []gql.ID }) ([]*userResolver, error) {
+	if len(args.IDs) > maxBatchUsers {
+		return nil, badInput("at most " + strconv.Itoa(maxBatchUsers) + " ids")
+	}
+	ids := make([]int64, 0, len(args.IDs))
+	for _, value := range args.IDs {
+		id, err := parseID(value)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return loadUsers(ctx, ids)
+}
+
+// Friends 好友列表，好友ID走缓存，用户信息批量加载
+func (r *resolver) Friends(ctx context.Context) ([]*userResolver, error) {
+	ids, err := services.NewFriendService().GetFriendIDs(ctx, stateFrom(ctx).viewerID)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	return loadUsers(ctx, ids)
+}
+
+// Conversations 会话列表；选择了peer或group时先批量加载全部会话的对方用户或群组
+func (r *resolver) Conversations(ctx context.Context) ([]*conversationResolver, error) {
+	state := stateFrom(ctx)
+	conversations, err := services.NewConversationService().GetConversations(ctx, state.viewerID)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+
+	var peerIDs, groupIDs []int64
+	resolvers := make([]*conversationResolver, 0, len(conversations))
+	for _, conversation := range conversations {
+		if conversation.Type == models.ConversationTypePrivate {
+			peerIDs = append(peerIDs, conversation.TargetID)
+		} else {
+			groupIDs = append(groupIDs, conversation.TargetID)
+		}
+		resolvers = append(resolvers, &conversationResolver{conversation: conversation})
+	}
+	if len(peerIDs) > 0 && gql.HasSelectedField(ctx, "peer") {
+		if _, err := state.users.LoadMany(ctx, peerIDs); err != nil {
+			return nil, internalError(ctx, err)
+		}
+	}
+	if len(groupIDs) > 0 && gql.HasSelectedField(ctx, "group") {
+		if _, err := state.groups.LoadMany(ctx, groupIDs); err != nil {
+			return nil, internalError(ctx, err)
+		}
+	}
+	return resolvers, nil
+}
+
+type messagesArgs struct {
+	PeerID  *gql.ID
+	GroupID *gql.ID
+	Before  *gql.ID
+	Limit   int32
+}
+
+// Messages 单聊或群聊的历史消息，peerId和groupId必须且只能传一个
+func (r *resolver) Messages(ctx context.Context, args messagesArgs) (*messagePageResolver, error) {
+	if (args.PeerID == nil) == (args.GroupID == nil) {
+		return nil, badInput("exactly one of peerId and groupId is required")
+	}
+	if args.PeerID != nil {
+		peerID, err := parseID(*args.PeerID)
+		if err != nil {
+			return nil, err
+		}
+		return loadMessages(ctx, models.ConversationTypePrivate, peerID, args.Before, args.Limit)
+	}
+	groupID, err := parseID(*args.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	return loadMessages(ctx, models.ConversationTypeGroup, groupID, args.Before, args.Limit)
+}
+
+func loadUser(ctx context.Context, id int64) (*userResolver, error) {
+	user, err := stateFrom(ctx).users.Load(ctx, id)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	if user == nil {
+		return nil, nil
+	}
+	return &userResolver{user: user}, nil
+}
+
+func loadUsers(ctx context.Context, ids []int64) ([]*userResolver, error) {
+	users, err := stateFrom(ctx).users.LoadMany(ctx, ids)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	resolvers := make([]*userResolver, 0, len(users))
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if user, ok := users[id]; ok && !seen[id] {
+			seen[id] = true
+			resolvers = append(resolvers, &userResolver{user: user})
+		}
+	}
+	return resolvers, nil
+}
+
+// loadMessages 按游标获取会话的历史消息，群聊需要当前用户是群成员
+// 选择了发送者信息时先批量加载本页全部发送者
+func loadMessages(ctx context.Context, conversationType int, targetID int64, before *gql.ID, limit int32) (*messagePageResolver, error) {
+	if limit < 1 || limit > maxMessageLimit {
+		return nil, badInput("limit must be between 1 and " + strconv.Itoa(maxMessageLimit))
+	}
+	cursor := services.MessageCursor{Limit: int(limit)}
+	if before != nil {
+		beforeID, err := parseID(*before)
+		if err != nil {
+			return nil, err
+		}
+		cursor.BeforeID = beforeID
+	}
+
+	state := stateFrom(ctx)
+	messageService := services.NewMessageService()
+	var messages []services.MessageInfo
+	var hasMore bool
+	var err error
+	if conversationType == models.ConversationTypePrivate {
+		messages, hasMore, err = messageService.GetPrivateMessagesWithUserInfo(ctx, state.viewerID, targetID, cursor)
+	} else {
+		isMember, memberErr := services.NewGroupService().IsUserInGroup(ctx, state.viewerID, targetID)
+		if memberErr != nil {
+			return nil, internalError(ctx, memberErr)
+		}
+		if !isMember {
+			return nil, errForbidden
+		}
+		messages, hasMore, err = messageService.GetGroupMessagesWithUserInfo(ctx, targetID, state.viewerID, cursor)
+	}
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+
+	if len(messages) > 0 && gql.HasSelectedField(ctx, "items.sender") {
+		senderIDs := make([]int64, 0, len(messages))
+		for _, message := range messages {
+			senderIDs = append(senderIDs, message.FromUserID)
+		}
+		if _, err := state.users.LoadMany(ctx, senderIDs); err != nil {
+			return nil, internalError(ctx, err)
+		}
+	}
+	return &messagePageResolver{messages: messages, hasMore: hasMore}, nil
+}
+
+type userResolver struct {
+	user *models.User
+}
+
+func (r *userResolver) ID() gql.ID        { return toID(r.user.ID) }
+func (r *userResolver) Nickname() string  { return r.user.Nickname }
+func (r *userResolver) Avatar() string    { return services.PublicURL(r.user.Avatar) }
+func (r *userResolver) Gender() int32     { return int32(r.user.Gender) }
+func (r *userResolver) Signature() string { return r.user.Signature }
+func (r *userResolver) IsBot() bool       { return r.user.IsBot }
+
+type groupResolver struct {
+	group *models.Group
+}
+
+func (r *groupResolver) ID() gql.ID         { return toID(r.group.ID) }
+func (r *groupResolver) Name() string       { return r.group.Name }
+func (r *groupResolver) OwnerID() gql.ID    { return toID(r.group.OwnerID) }
+func (r *groupResolver) MemberCount() int32 { return int32(r.group.MemberCount) }
+func (r *groupResolver) CreatedAt() float64 { return float64(r.group.CreatedAt.UnixMilli()) }
+
+// Owner 群主，账号已注销时为null
+func (r *groupResolver) Owner(ctx context.Context) (*userResolver, error) {
+	return loadUser(ctx, r.group.OwnerID)
+}
+
+type conversationResolver struct {
+	conversation services.ConversationInfo
+}
+
+func (r *conversationResolver) ID() gql.ID             { return toID(r.conversation.ID) }
+func (r *conversationResolver) Type() int32            { return int32(r.conversation.Type) }
+func (r *conversationResolver) TargetID() gql.ID       { return toID(r.conversation.TargetID) }
+func (r *conversationResolver) TargetName() string     { return r.conversation.TargetName }
+func (r *conversationResolver) TargetAvatar() string   { return r.conversation.TargetAvatar }
+func (r *conversationResolver) LastMsgContent() string { return r.conversation.LastMsgContent }
+func (r *conversationResolver) LastMsgType() int32     { return int32(r.conversation.LastMsgType) }
+func (r *conversationResolver) LastMsgTime() string    { return r.conversation.LastMsgTime }
+func (r *conversationResolver) UnreadCount() int32     { return int32(r.conversation.UnreadCount) }
+func (r *conversationResolver) LastReadMsgID() gql.ID  { return toID(r.conversation.LastReadMsgID) }
+func (r *conversationResolver) IsMuted() bool          { return r.conversation.IsMuted }
+func (r *conversationResolver) IsPinned() bool         { return r.conversation.IsPinned }
+func (r *conversationResolver) PinnedAt() string       { return r.conversation.PinnedAt }
+
+// Peer 单聊的对方，群聊返回null
+func (r *conversationResolver) Peer(ctx context.Context) (*userResolver, error) {
+	if r.conversation.Type != models.ConversationTypePrivate {
+		return nil, nil
+	}
+	return loadUser(ctx, r.conversation.TargetID)
+}
+
+// Group 群聊的群组，单聊或群组已解散时返回null
+func (r *conversationResolver) Group(ctx context.Context) (*groupResolver, error) {
+	if r.conversation.Type != models.ConversationTypeGroup {
+		return nil, nil
+	}
+	group, err := stateFrom(ctx).groups.Load(ctx, r.conversation.TargetID)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	if group == nil {
+		return nil, nil
+	}
+	return &groupResolver{group: group}, nil
+}
+
+// Messages 会话的历史消息
+func (r *conversationResolver) Messages(ctx context.Context, args struct {
+	Before *gql.ID
+	Limit  int32
+}) (*messagePageResolver, error) {
+	return loadMessages(ctx, r.conversation.Type, r.conversation.TargetID, args.Before, args.Limit)
+}
+
+type messagePageResolver struct {
+	messages []services.MessageInfo
+	hasMore  bool
+}
+
+func (r *messagePageResolver) Items() []*messageResolver {
+	items := make([]*messageResolver, 0, len(r.messages))
+	for i := range r.messages {
+		items = append(items, &messageResolver{message: &r.messages[i]})
+	}
+	return items
+}
+
+func (r *messagePageResolver) HasMore() bool { return r.hasMore }
+
+// NextBefore 本页最后（最早）一条消息的ID，没有更多消息时返回null
+func (r *messagePageResolver) NextBefore() *gql.ID {
+	if !r.hasMore || len(r.messages) == 0 {
+		return nil
+	}
+	id := toID(r.messages[len(r.messages)-1].ID)
+	return &id
+}
+
+type messageResolver struct {
+	message *services.MessageInfo
+}
+
+func (r *messageResolver) ID() gql.ID         { return toID(r.message.ID) }
+func (r *messageResolver) FromUserID() gql.ID { return toID(r.message.FromUserID) }
+func (r *messageResolver) Content() string    { return r.message.Content }
+func (r *messageResolver) MsgType() int32     { return int32(r.message.MsgType) }
+func (r *messageResolver) CreatedAt() float64 { return float64(r.message.CreatedAt) }
+func (r *messageResolver) Blurhash() string   { return r.message.Blurhash }
+
+func (r *messageResolver) ToUserID() *gql.ID {
+	if r.message.ToUserID == nil {
+		return nil
+	}
+	id := toID(*r.message.ToUserID)
+	return &id
+}
+
+func (r *messageResolver) GroupID() *gql.ID {
+	if r.message.GroupID == nil {
+		return nil
+	}
+	id := toID(*r.message.GroupID)
+	return &id
+}
+
+// Thumbnails 缩略图按名称排序返回
+func (r *messageResolver) Thumbnails() []*thumbnailResolver {
+	names := make([]string, 0, len(r.message.Thumbnails))
+	for name := range r.message.Thumbnails {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	thumbnails := make([]*thumbnailResolver, 0, len(names))
+	for _, name := range names {
+		thumbnails = append(thumbnails, &thumbnailResolver{name: name, url: r.message.Thumbnails[name]})
+	}
+	return thumbnails
+}
+
+// Sender 发送者，账号已注销时为null
+func (r *messageResolver) Sender(ctx context.Context) (*userResolver, error) {
+	return loadUser(ctx, r.message.FromUserID)
+}
+
+type thumbnailResolver struct {
+	name string
+	url  string
+}
+
+func (r *thumbnailResolver) Name() string { return r.name }
+func (r *thumbnailResolver) URL() string  { return r.url }
@@ -0,0 +1,160 @@
+// Package graphql GraphQL查询接口：在现有服务之上提供用户、好友、会话和分页消息的查询，
+// 客户端一次请求获取一个页面需要的数据，只返回选择的字段，关联的用户和群组按请求批量加载
+package graphql
+
+import (
+	"context"
+
+	gql "github.com/graph-gophers/graphql-go"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+	"gochat/internal/services"
+)
+
+// schemaSDL 查询接口的schema，只提供查询，修改仍使用REST接口和WebSocket
+const schemaSDL = `
+schema {
+	query: Query
+}
+
+type Query {
+	# 当前登录的用户
+	me: User!
+	# 按ID获取用户，不存在时为null
+	user(id: ID!): User
+	# 批量获取用户（最多100个），按传入的顺序返回，不存在的用户不返回
+	users(ids: [ID!]!): [User!]!
+	# 好友列表
+	friends: [User!]!
+	# 会话列表，置顶的在前，其余按最近活动时间倒序
+	conversations: [Conversation!]!
+	# 单聊（peerId）或群聊（groupId）的历史消息，按时间倒序，before为上一页最后一条消息的ID
+	messages(peerId: ID, groupId: ID, before: ID, limit: Int = 20): MessagePage!
+}
+
+type User {
+	id: ID!
+	nickname: String!
+	avatar: String!
+	# 0-未设置 1-男 2-女
+	gender: Int!
+	signature: String!
+	isBot: Boolean!
+}
+
+type Group {
+	id: ID!
+	name: String!
+	ownerId: ID!
+	owner: User
+	memberCount: Int!
+	# 毫秒时间戳
+	createdAt: Float!
+}
+
+type Conversation {
+	id: ID!
+	# 1-单聊 2-群聊
+	type: Int!
+	targetId: ID!
+	targetName: String!
+	targetAvatar: String!
+	lastMsgContent: String!
+	lastMsgType: Int!
+	lastMsgTime: String!
+	unreadCount: Int!
+	lastReadMsgId: ID!
+	isMuted: Boolean!
+	isPinned: Boolean!
+	# 置顶时间，未置顶时为空
+	pinnedAt: String!
+	# 单聊的对方，群聊为null
+	peer: User
+	# 群聊的群组，单聊为null
+	group: Group
+	# 会话的历史消息
+	messages(before: ID, limit: Int = 20): MessagePage!
+}
+
+type Message {
+	id: ID!
+	fromUserId: ID!
+	toUserId: ID
+	groupId: ID
+	content: String!
+	msgType: Int!
+	# 毫秒时间戳
+	createdAt: Float!
+	# 图片消息的缩略图（small/medium），视频消息的封面图（poster）
+	thumbnails: [Thumbnail!]!
+	blurhash: String!
+	sender: User
+}
+
+type Thumbnail {
+	name: String!
+	url: String!
+}
+
+type MessagePage {
+	items: [Message!]!
+	hasMore: Boolean!
+	# 继续向前翻页时作为before传入，没有更多消息时为null
+	nextBefore: ID
+}
+`
+
+// Schema 可并发使用的GraphQL查询入口
+type Schema struct {
+	schema *gql.Schema
+}
+
+// NewSchema 解析schema并绑定解析器，按配置限制查询的嵌套层数和长度
+// schema是常量，解析失败说明代码有误，直接panic
+func NewSchema(cfg *config.GraphQLConfig) *Schema {
+	opts := []gql.SchemaOpt{
+		gql.MaxDepth(cfg.MaxDepth),
+		gql.MaxQueryLength(cfg.MaxQueryLength),
+		gql.Logger(panicLogger{}),
+	}
+	if !cfg.Introspection {
+		opts = append(opts, gql.DisableIntrospection())
+	}
+	return &Schema{schema: gql.MustParseSchema(schemaSDL, &resolver{}, opts...)}
+}
+
+// Execute 以viewerID的身份执行查询，每次执行使用新的批量加载器
+func (s *Schema) Execute(ctx context.Context, viewerID int64, query, operationName string, variables map[string]interface{}) *gql.Response {
+	return s.schema.Exec(withViewer(ctx, viewerID), query, operationName, variables)
+}
+
+// requestState 一次查询内共享的状态：当前用户和批量加载器
+type requestState struct {
+	viewerID int64
+	users    *loader[*models.User]
+	groups   *loader[*models.Group]
+}
+
+type stateKey struct{}
+
+func withViewer(ctx context.Context, viewerID int64) context.Context {
+	state := &requestState{
+		viewerID: viewerID,
+		users:    newLoader(services.GetUserCacheService().GetUsers),
+		groups:   newLoader(services.NewGroupService().GetGroups),
+	}
+	return context.WithValue(ctx, stateKey{}, state)
+}
+
+func stateFrom(ctx context.Context) *requestState {
+	return ctx.Value(stateKey{}).(*requestState)
+}
+
+// panicLogger 解析器panic时写入日志（带请求ID），该字段返回错误，其余字段照常返回
+type panicLogger struct{}
+
+func (panicLogger) LogPanic(ctx context.Context, value interface{}) {
+	logger.WithContext(ctx).Errorf("graphql resolver panic: %v", value)
+}
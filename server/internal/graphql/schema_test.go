@@ -0,0 +1,225 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/models"
+)
+
+var testConfig = &config.GraphQLConfig{Enabled: true, MaxDepth: 8, MaxQueryLength: 10000, Introspection: true}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	cfg := &config.DatabaseConfig{
+		Driver: database.DriverSQLite,
+		DBName: filepath.Join(t.TempDir(), "gochat.db"),
+	}
+	require.NoError(t, database.Init(cfg))
+	t.Cleanup(func() { database.Close() })
+	require.NoError(t, database.Migrate())
+
+	// 用户信息走缓存，使用内存Redis；进程内缓存按用户ID缓存，测试之间清空
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	cache.RedisClient = client
+	t.Cleanup(func() {
+		cache.RedisClient = nil
+		client.Close()
+		cache.L1(cache.L1UserProfile).Purge()
+	})
+	return database.GetDB()
+}
+
+// fixture alice和bob是好友并有单聊消息，alice、bob在同一个群，carol不在群里
+type fixture struct {
+	alice, bob, carol *models.User
+	group             *models.Group
+}
+
+func newFixture(t *testing.T, db *gorm.DB) *fixture {
+	t.Helper()
+	f := &fixture{
+		alice: &models.User{Phone: "13800000001", PasswordHash: "x", Nickname: "alice", Avatar: "alice.png"},
+		bob:   &models.User{Phone: "13800000002", PasswordHash: "x", Nickname: "bob"},
+		carol: &models.User{Phone: "13800000003", PasswordHash: "x", Nickname: "carol"},
+	}
+	require.NoError(t, db.Create([]*models.User{f.alice, f.bob, f.carol}).Error)
+	require.NoError(t, db.Create([]*models.FriendRelation{
+		{UserID: f.alice.ID, FriendID: f.bob.ID},
+		{UserID: f.bob.ID, FriendID: f.alice.ID},
+	}).Error)
+
+	f.group = &models.Group{Name: "team", OwnerID: f.bob.ID, MemberCount: 2}
+	require.NoError(t, db.Create(f.group).Error)
+	require.NoError(t, db.Create([]*models.GroupMember{
+		{GroupID: f.group.ID, UserID: f.alice.ID},
+		{GroupID: f.group.ID, UserID: f.bob.ID},
+	}).Error)
+
+	for _, content := range []string{"one", "two", "three"} {
+		require.NoError(t, db.Create(&models.Message{FromUserID: f.bob.ID, ToUserID: &f.alice.ID, Content: content, MsgType: 1}).Error)
+	}
+	groupMessage := &models.Message{FromUserID: f.bob.ID, GroupID: &f.group.ID, Content: "hello team", MsgType: 1}
+	require.NoError(t, db.Create(groupMessage).Error)
+
+	require.NoError(t, db.Create(&models.Conversation{UserID: f.alice.ID, Type: models.ConversationTypePrivate, TargetID: f.bob.ID}).Error)
+	require.NoError(t, db.Create(&models.Conversation{UserID: f.alice.ID, Type: models.ConversationTypeGroup, TargetID: f.group.ID, LastMsgID: &groupMessage.ID}).Error)
+	return f
+}
+
+// execute 执行查询，把data解码到out，返回错误列表
+func execute(t *testing.T, viewerID int64, query string, variables map[string]interface{}, out interface{}) []map[string]interface{} {
+	t.Helper()
+	resp := NewSchema(testConfig).Execute(context.Background(), viewerID, query, "", variables)
+	body, err := json.Marshal(resp)
+	require.NoError(t, err)
+	var decoded struct {
+		Data   json.RawMessage          `json:"data"`
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	if out != nil && len(decoded.Data) > 0 {
+		require.NoError(t, json.Unmarshal(decoded.Data, out))
+	}
+	return decoded.Errors
+}
+
+type testUser struct {
+	ID       string `json:"id"`
+	Nickname string `json:"nickname"`
+}
+
+type testPage struct {
+	HasMore    bool    `json:"hasMore"`
+	NextBefore *string `json:"nextBefore"`
+	Items      []struct {
+		Content string    `json:"content"`
+		Sender  *testUser `json:"sender"`
+	} `json:"items"`
+}
+
+func TestScreenQuery(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	var data struct {
+		Me            testUser   `json:"me"`
+		Friends       []testUser `json:"friends"`
+		Conversations []struct {
+			Type  int       `json:"type"`
+			Peer  *testUser `json:"peer"`
+			Group *struct {
+				Name  string   `json:"name"`
+				Owner testUser `json:"owner"`
+			} `json:"group"`
+			Messages testPage `json:"messages"`
+		} `json:"conversations"`
+	}
+	errs := execute(t, f.alice.ID, `{
+		me { id nickname }
+		friends { id nickname }
+		conversations {
+			type
+			peer { nickname }
+			group { name owner { nickname } }
+			messages(limit: 2) { hasMore nextBefore items { content sender { nickname } } }
+		}
+	}`, nil, &data)
+	require.Empty(t, errs)
+
+	assert.Equal(t, testUser{ID: toIDString(f.alice.ID), Nickname: "alice"}, data.Me)
+	assert.Equal(t, []testUser{{ID: toIDString(f.bob.ID), Nickname: "bob"}}, data.Friends)
+	require.Len(t, data.Conversations, 2)
+	for _, conversation := range data.Conversations {
+		if conversation.Type == models.ConversationTypePrivate {
+			require.NotNil(t, conversation.Peer)
+			assert.Equal(t, "bob", conversation.Peer.Nickname)
+			assert.Nil(t, conversation.Group)
+			assert.True(t, conversation.Messages.HasMore)
+			assert.NotNil(t, conversation.Messages.NextBefore)
+			require.Len(t, conversation.Messages.Items, 2)
+			assert.Equal(t, "three", conversation.Messages.Items[0].Content)
+			assert.Equal(t, "bob", conversation.Messages.Items[0].Sender.Nickname)
+		} else {
+			assert.Nil(t, conversation.Peer)
+			require.NotNil(t, conversation.Group)
+			assert.Equal(t, "team", conversation.Group.Name)
+			assert.Equal(t, "bob", conversation.Group.Owner.Nickname)
+			assert.False(t, conversation.Messages.HasMore)
+			assert.Nil(t, conversation.Messages.NextBefore)
+			require.Len(t, conversation.Messages.Items, 1)
+			assert.Equal(t, "hello team", conversation.Messages.Items[0].Content)
+		}
+	}
+}
+
+func TestMessagesPagination(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	query := `query($peer: ID!, $before: ID) {
+		messages(peerId: $peer, before: $before, limit: 2) { hasMore nextBefore items { content } }
+	}`
+	var first struct {
+		Messages testPage `json:"messages"`
+	}
+	require.Empty(t, execute(t, f.alice.ID, query, map[string]interface{}{"peer": toIDString(f.bob.ID)}, &first))
+	require.True(t, first.Messages.HasMore)
+	require.NotNil(t, first.Messages.NextBefore)
+
+	var second struct {
+		Messages testPage `json:"messages"`
+	}
+	require.Empty(t, execute(t, f.alice.ID, query, map[string]interface{}{
+		"peer":   toIDString(f.bob.ID),
+		"before": *first.Messages.NextBefore,
+	}, &second))
+	assert.False(t, second.Messages.HasMore)
+	require.Len(t, second.Messages.Items, 1)
+	assert.Equal(t, "one", second.Messages.Items[0].Content)
+}
+
+func TestQueryErrors(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	errs := execute(t, f.carol.ID, `query($group: ID!) { messages(groupId: $group) { items { content } } }`,
+		map[string]interface{}{"group": toIDString(f.group.ID)}, nil)
+	require.Len(t, errs, 1)
+	assert.Equal(t, map[string]interface{}{"code": "FORBIDDEN"}, errs[0]["extensions"])
+
+	errs = execute(t, f.alice.ID, `{ messages(peerId: "1", groupId: "1") { hasMore } }`, nil, nil)
+	require.Len(t, errs, 1)
+	assert.Equal(t, map[string]interface{}{"code": "BAD_INPUT"}, errs[0]["extensions"])
+
+	var data struct {
+		User  *testUser  `json:"user"`
+		Users []testUser `json:"users"`
+	}
+	errs = execute(t, f.alice.ID, `query($ids: [ID!]!) { user(id: "999") { id } users(ids: $ids) { nickname } }`,
+		map[string]interface{}{"ids": []interface{}{toIDString(f.carol.ID), "999", toIDString(f.bob.ID), toIDString(f.carol.ID)}}, &data)
+	require.Empty(t, errs)
+	assert.Nil(t, data.User)
+	assert.Equal(t, []testUser{{Nickname: "carol"}, {Nickname: "bob"}}, data.Users)
+
+	// 超过最大嵌套层数的查询在执行前被拒绝
+	shallow := &config.GraphQLConfig{MaxDepth: 2, MaxQueryLength: 10000}
+	resp := NewSchema(shallow).Execute(context.Background(), f.alice.ID, `{ conversations { group { owner { id } } } }`, "", nil)
+	assert.NotEmpty(t, resp.Errors)
+}
+
+func toIDString(id int64) string {
+	return string(toID(id))
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type AdminHandler struct {
+	adminService   *services.AdminService
+	groupService   *services.GroupService
+	messageService *services.MessageService
+}
+
+func NewAdminHandler(adminService *services.AdminService) *AdminHandler {
+	return &AdminHandler{
+		adminService:   adminService,
+		groupService:   services.NewGroupService(),
+		messageService: services.NewMessageService(),
+	}
+}
+
+// SuspendRequest 停用或封禁用户的请求，duration为Go时长格式，如"72h"
+type SuspendRequest struct {
+	Duration string `json:"duration"`
+	Reason   string `json:"reason" binding:"max=255"`
+}
+
+// SetRoleRequest 设置管理后台角色的请求，role为空表示收回角色
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// handleAdminError 把管理后台服务的错误转换为响应
+func handleAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.HandleNotFoundError(c, "User")
+	case errors.Is(err, services.ErrGroupNotFound):
+		utils.HandleNotFoundError(c, "Group")
+	case errors.Is(err, services.ErrMessageNotFound):
+		utils.HandleNotFoundError(c, "Message")
+	case errors.Is(err, services.ErrJobNotFound):
+		utils.HandleNotFoundError(c, "Job")
+	case errors.Is(err, services.ErrModerateStaff), errors.Is(err, services.ErrModerateSelf):
+		c.JSON(http.StatusForbidden, utils.WithRequestID(c, utils.ErrorResponse(403, err.Error())))
+	case errors.Is(err, services.ErrJobRunning):
+		c.JSON(http.StatusConflict, utils.WithRequestID(c, utils.ErrorResponse(409, err.Error())))
+	case errors.Is(err, services.ErrInvalidRole):
+		utils.HandleBadRequestError(c, err.Error())
+	default:
+		utils.HandleInternalError(c, err)
+	}
+}
+
+// actorID 当前操作的管理员用户ID，通过管理令牌访问时为0
+func actorID(c *gin.Context) int64 {
+	userID, _ := utils.GetAuthenticatedUser(c)
+	return userID
+}
+
+// SearchUsers 按关键字、角色和状态搜索用户，before_id为分页游标
+func (h *AdminHandler) SearchUsers(c *gin.Context) {
+	beforeID, err := utils.ParseInt64Query(c, "before_id")
+	if err != nil {
+		utils.HandleParseError(c, "before_id")
+		return
+	}
+	users, hasMore, err := h.adminService.SearchUsers(c.Request.Context(), services.AdminUserQuery{
+		Keyword:  c.Query("keyword"),
+		Role:     c.Query("role"),
+		Status:   c.Query("status"),
+		BeforeID: beforeID,
+		Limit:    utils.ParseIntQuery(c, "limit", 50),
+	})
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{
+		"users":    users,
+		"has_more": hasMore,
+	}))
+}
+
+// GetUser 查看用户详情
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	userID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "user ID")
+		return
+	}
+	user, err := h.adminService.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(user))
+}
+
+// SuspendUser 停用用户一段时间，期间不能登录，已登录的会话立即失效
+func (h *AdminHandler) SuspendUser(c *gin.Context) {
+	userID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "user ID")
+		return
+	}
+	var req SuspendRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 {
+		utils.HandleBadRequestError(c, "duration must be a positive duration such as 72h")
+		return
+	}
+	until := time.Now().Add(duration)
+	user, err := h.adminService.SuspendUser(c.Request.Context(), actorID(c), userID, &until, req.Reason)
+	if err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionSuspendUser,
+		TargetType: services.AuditTargetUser,
+		TargetID:   userID,
+		Detail:     map[string]interface{}{"until": until, "reason": req.Reason},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(user))
+}
+
+// BanUser 永久封禁用户，已登录的会话立即失效
+func (h *AdminHandler) BanUser(c *gin.Context) {
+	userID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "user ID")
+		return
+	}
+	var req SuspendRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	user, err := h.adminService.SuspendUser(c.Request.Context(), actorID(c), userID, nil, req.Reason)
+	if err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionBanUser,
+		TargetType: services.AuditTargetUser,
+		TargetID:   userID,
+		Detail:     map[string]interface{}{"reason": req.Reason},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(user))
+}
+
+// UnbanUser 解除停用和封禁
+func (h *AdminHandler) UnbanUser(c *gin.Context) {
+	userID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "user ID")
+		return
+	}
+	user, err := h.adminService.UnbanUser(c.Request.Context(), userID)
+	if err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionUnbanUser,
+		TargetType: services.AuditTargetUser,
+		TargetID:   userID,
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(user))
+}
+
+// ForceLogout 强制用户下线，断开所有实例上的实时连接
+func (h *AdminHandler) ForceLogout(c *gin.Context) {
+	userID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "user ID")
+		return
+	}
+	if err := h.adminService.ForceLogout(c.Request.Context(), userID); err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionForceLogout,
+		TargetType: services.AuditTargetUser,
+		TargetID:   userID,
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse("User logged out"))
+}
+
+// SetRole 分配或收回管理后台角色
+func (h *AdminHandler) SetRole(c *gin.Context) {
+	userID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "user ID")
+		return
+	}
+	var req SetRoleRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	user, err := h.adminService.SetRole(c.Request.Context(), actorID(c), userID, req.Role)
+	if err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionSetRole,
+		TargetType: services.AuditTargetUser,
+		TargetID:   userID,
+		Detail:     map[string]interface{}{"role": req.Role},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(user))
+}
+
+// GetGroup 查看群组详情，包括成员和机器人
+func (h *AdminHandler) GetGroup(c *gin.Context) {
+	groupID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "group ID")
+		return
+	}
+	group, err := h.adminService.GetGroup(c.Request.Context(), groupID)
+	if err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(group))
+}
+
+// DissolveGroup 解散群组，成员的群会话同时删除
+func (h *AdminHandler) DissolveGroup(c *gin.Context) {
+	groupID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "group ID")
+		return
+	}
+	memberIDs, err := h.groupService.DissolveGroup(c.Request.Context(), groupID)
+	if err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionDissolveGroup,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   groupID,
+		Detail:     map[string]interface{}{"member_count": len(memberIDs)},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse("Group dissolved"))
+}
+
+// TakedownMessage 下架违规消息，对所有人删除
+func (h *AdminHandler) TakedownMessage(c *gin.Context) {
+	messageID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "message ID")
+		return
+	}
+	msg, err := h.messageService.TakedownMessage(c.Request.Context(), messageID)
+	if err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionTakedown,
+		TargetType: services.AuditTargetMessage,
+		TargetID:   messageID,
+		Detail:     map[string]interface{}{"from_user_id": msg.FromUserID, "group_id": msg.GroupID, "to_user_id": msg.ToUserID},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse("Message removed"))
+}
+
+// ListJobs 列出可手动触发的维护任务
+func (h *AdminHandler) ListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.SuccessResponse(services.ListMaintenanceJobs()))
+}
+
+// RunJob 在后台执行维护任务，立即返回202
+func (h *AdminHandler) RunJob(c *gin.Context) {
+	name := c.Param("name")
+	if err := services.RunMaintenanceJob(name); err != nil {
+		handleAdminError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionRunJob,
+		TargetType: services.AuditTargetJob,
+		Detail:     map[string]interface{}{"job": name},
+	})
+	c.JSON(http.StatusAccepted, utils.SuccessResponse("Job started"))
+}
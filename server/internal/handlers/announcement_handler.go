@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type AnnouncementHandler struct {
+	announcementService *services.AnnouncementService
+}
+
+func NewAnnouncementHandler(cfg *config.AnnouncementsConfig) *AnnouncementHandler {
+	return &AnnouncementHandler{announcementService: services.NewAnnouncementService(cfg)}
+}
+
+// handleAnnouncementError 把公告服务的错误转换为响应
+func handleAnnouncementError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAnnouncementNotFound):
+		utils.HandleNotFoundError(c, "Announcement")
+	case errors.Is(err, services.ErrGroupNotFound):
+		utils.HandleNotFoundError(c, "Group")
+	case errors.Is(err, services.ErrAnnouncementCancelled):
+		c.JSON(http.StatusConflict, utils.WithRequestID(c, utils.ErrorResponse(409, err.Error())))
+	case errors.Is(err, services.ErrInvalidAudience), errors.Is(err, services.ErrInvalidSegment),
+		errors.Is(err, services.ErrTooManyTargets), errors.Is(err, services.ErrInvalidAnnouncementTime):
+		utils.HandleBadRequestError(c, err.Error())
+	default:
+		utils.HandleInternalError(c, err)
+	}
+}
+
+// CreateAnnouncement 发布公告，publish_at晚于当前时间时定时发布
+func (h *AnnouncementHandler) CreateAnnouncement(c *gin.Context) {
+	actorID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	var req services.AnnouncementRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	announcement, err := h.announcementService.Create(c.Request.Context(), actorID, &req)
+	if err != nil {
+		handleAnnouncementError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionPublishAnnouncement,
+		TargetType: services.AuditTargetAnnouncement,
+		TargetID:   announcement.ID,
+		Detail: map[string]interface{}{
+			"title":        announcement.Title,
+			"audience":     announcement.Audience,
+			"status":       announcement.Status,
+			"publish_at":   announcement.PublishAt,
+			"target_users": announcement.TargetUsers,
+		},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(announcement))
+}
+
+// ListAnnouncements 公告列表，包含已读人数，支持按状态过滤，before_id为分页游标
+func (h *AnnouncementHandler) ListAnnouncements(c *gin.Context) {
+	var q services.AnnouncementQuery
+	var err error
+	if q.BeforeID, err = utils.ParseInt64Query(c, "before_id"); err != nil {
+		utils.HandleParseError(c, "before_id")
+		return
+	}
+	q.Status = c.Query("status")
+	q.Limit = utils.ParseIntQuery(c, "limit", 50)
+
+	announcements, hasMore, err := h.announcementService.List(c.Request.Context(), q)
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{
+		"announcements": announcements,
+		"has_more":      hasMore,
+	}))
+}
+
+// CancelAnnouncement 取消定时公告，或从客户端撤回已发布的公告
+func (h *AnnouncementHandler) CancelAnnouncement(c *gin.Context) {
+	announcementID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "announcement ID")
+		return
+	}
+	announcement, err := h.announcementService.Cancel(c.Request.Context(), announcementID)
+	if err != nil {
+		handleAnnouncementError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionCancelAnnouncement,
+		TargetType: services.AuditTargetAnnouncement,
+		TargetID:   announcement.ID,
+		Detail:     map[string]interface{}{"published": announcement.PublishedAt != nil},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(announcement))
+}
+
+// GetAnnouncements 获取当前用户可见的有效公告，unread=true时只返回未读公告
+func (h *AnnouncementHandler) GetAnnouncements(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	announcements, err := h.announcementService.ListForUser(c.Request.Context(), userID, c.Query("unread") == "true")
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(announcements))
+}
+
+// MarkAnnouncementRead 标记公告为已读
+func (h *AnnouncementHandler) MarkAnnouncementRead(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	announcementID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "announcement ID")
+		return
+	}
+	if err := h.announcementService.MarkRead(c.Request.Context(), userID, announcementID); err != nil {
+		handleAnnouncementError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{"id": announcementID, "read": true}))
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/logger"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+func NewAuditHandler() *AuditHandler {
+	return &AuditHandler{auditService: services.NewAuditService()}
+}
+
+// QueryAuditLogs 查询审计日志，支持按操作者、动作、对象和时间范围过滤，before_id为分页游标
+func (h *AuditHandler) QueryAuditLogs(c *gin.Context) {
+	var q services.AuditQuery
+	var err error
+	if q.ActorID, err = utils.ParseInt64Query(c, "actor_id"); err != nil {
+		utils.HandleParseError(c, "actor_id")
+		return
+	}
+	if q.TargetID, err = utils.ParseInt64Query(c, "target_id"); err != nil {
+		utils.HandleParseError(c, "target_id")
+		return
+	}
+	if q.BeforeID, err = utils.ParseInt64Query(c, "before_id"); err != nil {
+		utils.HandleParseError(c, "before_id")
+		return
+	}
+	for name, dest := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := c.Query(name); value != "" {
+			if *dest, err = time.Parse(time.RFC3339, value); err != nil {
+				utils.HandleParseError(c, name+" (RFC3339 expected)")
+				return
+			}
+		}
+	}
+	q.Action = c.Query("action")
+	q.TargetType = c.Query("target_type")
+	q.Limit = utils.ParseIntQuery(c, "limit", 50)
+
+	logs, hasMore, err := h.auditService.Query(c.Request.Context(), q)
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action: services.AuditActionQueryAuditLogs,
+		Detail: map[string]interface{}{"query": c.Request.URL.RawQuery},
+	})
+
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{
+		"logs":     logs,
+		"has_more": hasMore,
+	}))
+}
+
+// recordAudit 记录审计日志，未指定操作者时取当前请求的认证信息；写入失败只记录日志，不影响请求结果
+func recordAudit(c *gin.Context, entry *services.AuditEntry) {
+	if entry.ActorType == "" {
+		entry.ActorType = services.AuditActorAnonymous
+		if c.GetBool("admin") {
+			entry.ActorType = services.AuditActorAdmin
+		} else if userID, ok := utils.GetAuthenticatedUser(c); ok {
+			entry.ActorID = userID
+			entry.ActorType = services.AuditActorUser
+			if keyID, ok := c.Get("api_key_id"); ok {
+				entry.ActorType = services.AuditActorAPIKey
+				if entry.Detail == nil {
+					entry.Detail = make(map[string]interface{})
+				}
+				entry.Detail["api_key_id"] = keyID
+			}
+		}
+	}
+	entry.IP = c.ClientIP()
+
+	if err := services.NewAuditService().Record(c.Request.Context(), entry); err != nil {
+		logger.WithContext(c.Request.Context()).Errorf("记录审计日志失败: action=%s, error=%v", entry.Action, err)
+	}
+}
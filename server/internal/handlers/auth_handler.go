@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
@@ -11,11 +14,13 @@ import (
 )
 
 type AuthHandler struct {
+	config      *config.Config
 	userService *services.UserService
 }
 
 func NewAuthHandler(cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
+		config:      cfg,
 		userService: services.NewUserService(cfg),
 	}
 }
@@ -28,11 +33,19 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	response, err := h.userService.Register(&req)
+	response, err := h.userService.Register(c.Request.Context(), &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, err.Error()))
 		return
 	}
+	recordAudit(c, &services.AuditEntry{
+		ActorID:    response.UserID,
+		ActorType:  services.AuditActorUser,
+		Action:     services.AuditActionRegister,
+		TargetType: services.AuditTargetUser,
+		TargetID:   response.UserID,
+		Detail:     map[string]interface{}{"phone": req.Phone, "nickname": req.Nickname},
+	})
 
 	c.JSON(http.StatusOK, utils.SuccessResponse(response))
 }
@@ -45,11 +58,43 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.userService.Login(&req)
+	req.ClientIP = c.ClientIP()
+	req.UserAgent = c.Request.UserAgent()
+	if header := h.config.LoginRisk.RegionHeader; header != "" {
+		req.Region = c.GetHeader(header)
+	}
+	response, err := h.userService.Login(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, err.Error()))
+		recordAudit(c, &services.AuditEntry{
+			Action: services.AuditActionLoginFailed,
+			Detail: map[string]interface{}{"phone": req.Phone, "error": err.Error()},
+		})
+		var throttled *services.LoginThrottledError
+		var suspended *services.AccountSuspendedError
+		switch {
+		case errors.As(err, &suspended):
+			c.JSON(http.StatusForbidden, utils.FormatResponse(403, err.Error(), gin.H{"suspended_until": suspended.Until, "reason": suspended.Reason}))
+		case errors.As(err, &throttled):
+			retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, utils.FormatResponse(429, err.Error(), gin.H{"retry_after": retryAfter, "locked": throttled.Locked}))
+		case errors.Is(err, services.ErrCaptchaRequired), errors.Is(err, services.ErrCaptchaInvalid):
+			c.JSON(http.StatusBadRequest, utils.FormatResponse(400, err.Error(), gin.H{"captcha_required": true}))
+		case errors.Is(err, services.ErrLoginCodeRequired), errors.Is(err, services.ErrLoginCodeInvalid):
+			// 验证码已发送到账号已登录的设备（和短信网关），客户端带verification_code重新登录
+			c.JSON(http.StatusUnauthorized, utils.FormatResponse(401, err.Error(), gin.H{"verification_required": true}))
+		default:
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, err.Error()))
+		}
 		return
 	}
+	recordAudit(c, &services.AuditEntry{
+		ActorID:    response.UserID,
+		ActorType:  services.AuditActorUser,
+		Action:     services.AuditActionLogin,
+		TargetType: services.AuditTargetUser,
+		TargetID:   response.UserID,
+	})
 
 	c.JSON(http.StatusOK, utils.SuccessResponse(response))
 }
@@ -62,11 +107,16 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	err := h.userService.Logout(userID.(int64))
+	err := h.userService.Logout(c.Request.Context(), userID.(int64))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to logout"))
 		return
 	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionLogout,
+		TargetType: services.AuditTargetUser,
+		TargetID:   userID.(int64),
+	})
 
 	c.JSON(http.StatusOK, utils.SuccessResponse("Logged out successfully"))
 }
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type BotHandler struct {
+	botService *services.BotService
+}
+
+func NewBotHandler(cfg *config.Config) *BotHandler {
+	return &BotHandler{botService: services.NewBotService(&cfg.Bots)}
+}
+
+// parseGroupAndBot 解析路径中的群ID和机器人ID，bot_id不存在时返回0
+func parseGroupAndBot(c *gin.Context) (groupID, botID int64, ok bool) {
+	groupID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "group ID")
+		return 0, 0, false
+	}
+	if c.Param("bot_id") == "" {
+		return groupID, 0, true
+	}
+	botID, err = utils.ParseInt64Param(c, "bot_id")
+	if err != nil {
+		utils.HandleParseError(c, "bot ID")
+		return 0, 0, false
+	}
+	return groupID, botID, true
+}
+
+// handleBotError 把机器人服务的错误转换为响应
+func handleBotError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotGroupOwner):
+		c.JSON(http.StatusForbidden, utils.WithRequestID(c, utils.ErrorResponse(403, err.Error())))
+	case errors.Is(err, services.ErrBotNotFound):
+		utils.HandleNotFoundError(c, "Bot")
+	case errors.Is(err, services.ErrBotLimitReached):
+		c.JSON(http.StatusConflict, utils.WithRequestID(c, utils.ErrorResponse(409, err.Error())))
+	default:
+		utils.HandleBadRequestError(c, err.Error())
+	}
+}
+
+// ListBots 群主查看群里的机器人
+func (h *BotHandler) ListBots(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	groupID, _, ok := parseGroupAndBot(c)
+	if !ok {
+		return
+	}
+	bots, err := h.botService.ListBots(c.Request.Context(), userID, groupID)
+	if errors.Is(err, services.ErrNotGroupOwner) {
+		handleBotError(c, err)
+		return
+	}
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(bots))
+}
+
+// CreateBot 群主创建机器人，返回的令牌和签名密钥只显示这一次
+func (h *BotHandler) CreateBot(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	groupID, _, ok := parseGroupAndBot(c)
+	if !ok {
+		return
+	}
+	var req services.BotRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	credentials, err := h.botService.CreateBot(c.Request.Context(), userID, groupID, &req)
+	if err != nil {
+		handleBotError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionCreateBot,
+		TargetType: services.AuditTargetBot,
+		TargetID:   credentials.Bot.ID,
+		Detail:     map[string]interface{}{"group_id": groupID, "name": credentials.Bot.Name, "outgoing_url": credentials.Bot.OutgoingURL},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(credentials))
+}
+
+// UpdateBot 修改机器人名称或Outgoing Webhook地址
+func (h *BotHandler) UpdateBot(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	groupID, botID, ok := parseGroupAndBot(c)
+	if !ok {
+		return
+	}
+	var req services.BotRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	credentials, err := h.botService.UpdateBot(c.Request.Context(), userID, groupID, botID, &req)
+	if err != nil {
+		handleBotError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionUpdateBot,
+		TargetType: services.AuditTargetBot,
+		TargetID:   botID,
+		Detail:     map[string]interface{}{"group_id": groupID, "name": req.Name, "outgoing_url": req.OutgoingURL},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(credentials))
+}
+
+// ResetBotCredentials 重新生成机器人的令牌和签名密钥
+func (h *BotHandler) ResetBotCredentials(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	groupID, botID, ok := parseGroupAndBot(c)
+	if !ok {
+		return
+	}
+	credentials, err := h.botService.ResetCredentials(c.Request.Context(), userID, groupID, botID)
+	if err != nil {
+		handleBotError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionResetBot,
+		TargetType: services.AuditTargetBot,
+		TargetID:   botID,
+		Detail:     map[string]interface{}{"group_id": groupID},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(credentials))
+}
+
+// DeleteBot 删除机器人
+func (h *BotHandler) DeleteBot(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	groupID, botID, ok := parseGroupAndBot(c)
+	if !ok {
+		return
+	}
+	if err := h.botService.DeleteBot(c.Request.Context(), userID, groupID, botID); err != nil {
+		handleBotError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionDeleteBot,
+		TargetType: services.AuditTargetBot,
+		TargetID:   botID,
+		Detail:     map[string]interface{}{"group_id": groupID},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse("Bot deleted"))
+}
+
+// PostIncomingWebhook Incoming Webhook：以机器人身份向群里发送文本消息，令牌即授权
+func (h *BotHandler) PostIncomingWebhook(c *gin.Context) {
+	bot, err := h.botService.Authenticate(c.Request.Context(), c.Param("token"))
+	if errors.Is(err, services.ErrInvalidBotToken) {
+		c.JSON(http.StatusUnauthorized, utils.WithRequestID(c, utils.ErrorResponse(401, "Invalid bot token")))
+		return
+	}
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	var req services.BotMessageRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	messageID, err := h.botService.PostMessage(c.Request.Context(), bot, req.Message())
+	if err != nil {
+		utils.HandleBadRequestError(c, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{"message_id": messageID}))
+}
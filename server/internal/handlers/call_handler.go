@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type CallHandler struct {
+	callService *services.CallService
+	turn        atomic.Pointer[services.TURNService] // STUN/TURN服务器配置，支持热加载
+}
+
+func NewCallHandler(cfg *config.Config) *CallHandler {
+	h := &CallHandler{callService: services.NewCallService()}
+	h.turn.Store(services.NewTURNService(&cfg.TURN))
+	config.OnReload(func(next *config.Config) {
+		h.turn.Store(services.NewTURNService(&next.TURN))
+	})
+	return h
+}
+
+// GetCallHistory 当前用户拨出和接听的通话记录，按时间倒序，before_id为分页游标
+func (h *CallHandler) GetCallHistory(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	beforeID, err := utils.ParseInt64Query(c, "before_id")
+	if err != nil {
+		utils.HandleParseError(c, "before_id")
+		return
+	}
+
+	calls, hasMore, err := h.callService.ListCalls(c.Request.Context(), userID, beforeID, utils.ParseIntQuery(c, "limit", 20))
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{
+		"calls":    calls,
+		"has_more": hasMore,
+	}))
+}
+
+// GetICEServers 获取通话使用的STUN/TURN服务器和限时TURN凭证，客户端在发起或接听通话前调用
+func (h *CallHandler) GetICEServers(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	servers, err := h.turn.Load().ICEServers(c.Request.Context(), userID)
+	var limited *services.TURNRateLimitedError
+	if errors.As(err, &limited) {
+		retryAfter := int(math.Ceil(limited.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, utils.FormatResponse(429, err.Error(), gin.H{
+			"max":         limited.Max,
+			"retry_after": retryAfter,
+		}))
+		return
+	}
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(servers))
+}
@@ -3,12 +3,14 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"gochat/internal/config"
 	"gochat/internal/services"
 	"gochat/internal/utils"
+	"gochat/internal/websocket"
 )
 
 type ConversationHandler struct {
@@ -29,7 +31,24 @@ func (h *ConversationHandler) GetConversations(c *gin.Context) {
 		return
 	}
 
-	conversations, err := h.conversationService.GetConversations(userID.(int64))
+	conversations, err := h.conversationService.GetConversations(c.Request.Context(), userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.SuccessResponse(conversations))
+}
+
+// GetArchivedConversations 获取已归档的会话列表
+func (h *ConversationHandler) GetArchivedConversations(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	conversations, err := h.conversationService.GetArchivedConversations(c.Request.Context(), userID.(int64))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, err.Error()))
 		return
@@ -53,11 +72,208 @@ func (h *ConversationHandler) ClearUnreadCount(c *gin.Context) {
 		return
 	}
 
-	err = h.conversationService.ClearUnreadCount(userID.(int64), conversationID)
+	err = h.conversationService.ClearUnreadCount(c.Request.Context(), userID.(int64), conversationID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, err.Error()))
 		return
 	}
 
+	// 同步到用户的其他设备
+	if conversation, err := h.conversationService.GetConversationByID(c.Request.Context(), conversationID, userID.(int64)); err == nil {
+		websocket.PushConversationUpdate(conversation, nil, websocket.ConversationChangedUnread)
+	}
+
 	c.JSON(http.StatusOK, utils.SuccessResponse("Unread count cleared"))
 }
+
+// MarkReadRequest 更新已读位置请求，message_id为空时已读到最新消息
+type MarkReadRequest struct {
+	MessageID int64 `json:"message_id"`
+}
+
+// MarkRead 把会话的已读位置前移到指定消息
+func (h *ConversationHandler) MarkRead(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	conversationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid conversation ID"))
+		return
+	}
+
+	var req MarkReadRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil || req.MessageID < 0 {
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid request format"))
+			return
+		}
+	}
+
+	if err := h.conversationService.MarkRead(c.Request.Context(), userID.(int64), conversationID, req.MessageID); err != nil {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "Conversation not found"))
+		return
+	}
+
+	conversation, err := h.conversationService.GetConversationByID(c.Request.Context(), conversationID, userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	// 同步到用户的其他设备
+	websocket.PushConversationUpdate(conversation, nil, websocket.ConversationChangedUnread)
+	c.JSON(http.StatusOK, utils.SuccessResponse(conversation))
+}
+
+// MuteConversationRequest 设置免打扰请求，muted为false时取消免打扰，忽略其他字段
+type MuteConversationRequest struct {
+	Muted      *bool  `json:"muted" binding:"required"`
+	Duration   string `json:"duration"`    // 免打扰时长，如8h，为空表示一直免打扰直到取消
+	HideUnread bool   `json:"hide_unread"` // 免打扰期间不显示未读数
+}
+
+// PinConversationRequest 设置置顶请求
+type PinConversationRequest struct {
+	Pinned *bool `json:"pinned" binding:"required"`
+}
+
+// MuteConversation 设置会话免打扰
+func (h *ConversationHandler) MuteConversation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	conversationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid conversation ID"))
+		return
+	}
+
+	var req MuteConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid request format"))
+		return
+	}
+	if !*req.Muted {
+		h.unmute(c, userID.(int64), conversationID)
+		return
+	}
+	var until *time.Time
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "duration must be a positive duration such as 8h"))
+			return
+		}
+		deadline := time.Now().Add(duration)
+		until = &deadline
+	}
+
+	conversation, err := h.conversationService.Mute(c.Request.Context(), userID.(int64), conversationID, until, req.HideUnread)
+	if err != nil {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "Conversation not found"))
+		return
+	}
+
+	websocket.PushConversationUpdate(conversation, nil, websocket.ConversationChangedMute)
+	c.JSON(http.StatusOK, utils.SuccessResponse(conversation))
+}
+
+// UnmuteConversation 取消会话免打扰
+func (h *ConversationHandler) UnmuteConversation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	conversationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid conversation ID"))
+		return
+	}
+
+	h.unmute(c, userID.(int64), conversationID)
+}
+
+// unmute 取消免打扰，并同步到用户的其他设备
+func (h *ConversationHandler) unmute(c *gin.Context, userID, conversationID int64) {
+	conversation, err := h.conversationService.Unmute(c.Request.Context(), userID, conversationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "Conversation not found"))
+		return
+	}
+
+	websocket.PushConversationUpdate(conversation, nil, websocket.ConversationChangedMute)
+	c.JSON(http.StatusOK, utils.SuccessResponse(conversation))
+}
+
+// PinConversation 设置会话置顶
+func (h *ConversationHandler) PinConversation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	conversationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid conversation ID"))
+		return
+	}
+
+	var req PinConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid request format"))
+		return
+	}
+
+	conversation, err := h.conversationService.SetPinned(c.Request.Context(), userID.(int64), conversationID, *req.Pinned)
+	if err != nil {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "Conversation not found"))
+		return
+	}
+
+	websocket.PushConversationUpdate(conversation, nil, websocket.ConversationChangedPin)
+	c.JSON(http.StatusOK, utils.SuccessResponse(conversation))
+}
+
+// ArchiveConversation 归档会话
+func (h *ConversationHandler) ArchiveConversation(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+// UnarchiveConversation 取消归档会话
+func (h *ConversationHandler) UnarchiveConversation(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+// setArchived 归档或取消归档会话，并同步到用户的其他设备
+func (h *ConversationHandler) setArchived(c *gin.Context, archived bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	conversationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid conversation ID"))
+		return
+	}
+
+	conversation, err := h.conversationService.SetArchived(c.Request.Context(), userID.(int64), conversationID, archived)
+	if err != nil {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "Conversation not found"))
+		return
+	}
+
+	websocket.PushConversationUpdate(conversation, nil, websocket.ConversationChangedArchive)
+	c.JSON(http.StatusOK, utils.SuccessResponse(conversation))
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/objectstore"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type DataExportHandler struct {
+	exportService *services.DataExportService
+	presignTTL    time.Duration
+}
+
+func NewDataExportHandler(cfg *config.Config) *DataExportHandler {
+	presignTTL, err := time.ParseDuration(cfg.Storage.PresignedURLTTL)
+	if err != nil || presignTTL <= 0 {
+		presignTTL = defaultSignedURLTTL
+	}
+	return &DataExportHandler{
+		exportService: services.NewDataExportService(&cfg.DataExport),
+		presignTTL:    presignTTL,
+	}
+}
+
+// handleExportError 把数据导出服务的错误转换为响应
+func handleExportError(c *gin.Context, err error) {
+	var cooldown *services.ExportCooldownError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.HandleNotFoundError(c, "Export")
+	case errors.Is(err, services.ErrExportInProgress), errors.Is(err, services.ErrExportNotReady):
+		c.JSON(http.StatusConflict, utils.WithRequestID(c, utils.ErrorResponse(409, err.Error())))
+	case errors.Is(err, services.ErrExportExpired):
+		c.JSON(http.StatusGone, utils.WithRequestID(c, utils.ErrorResponse(410, err.Error())))
+	case errors.As(err, &cooldown):
+		retryAfter := int(math.Ceil(cooldown.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, utils.FormatResponse(429, err.Error(), gin.H{
+			"retry_after": retryAfter,
+		}))
+	default:
+		utils.HandleInternalError(c, err)
+	}
+}
+
+// RequestExport 申请导出个人数据，后台生成压缩包，客户端轮询状态后下载
+func (h *DataExportHandler) RequestExport(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	export, err := h.exportService.Request(c.Request.Context(), userID)
+	if err != nil {
+		handleExportError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionDataExport,
+		TargetType: services.AuditTargetExport,
+		TargetID:   export.ID,
+	})
+	c.JSON(http.StatusAccepted, utils.SuccessResponse(export))
+}
+
+// ListExports 获取最近的导出记录
+func (h *DataExportHandler) ListExports(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	exports, err := h.exportService.List(c.Request.Context(), userID, 20)
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(exports))
+}
+
+// GetExport 获取导出状态和进度
+func (h *DataExportHandler) GetExport(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	exportID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.HandleParseError(c, "export ID")
+		return
+	}
+	export, err := h.exportService.Get(c.Request.Context(), userID, exportID)
+	if err != nil {
+		handleExportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(export))
+}
+
+// DownloadExport 下载已完成的导出压缩包，存放在对象存储时跳转到预签名链接
+func (h *DataExportHandler) DownloadExport(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	exportID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.HandleParseError(c, "export ID")
+		return
+	}
+	export, err := h.exportService.Downloadable(c.Request.Context(), userID, exportID)
+	if err != nil {
+		handleExportError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionDownloadExport,
+		TargetType: services.AuditTargetExport,
+		TargetID:   export.ID,
+	})
+
+	name := fmt.Sprintf("gochat-export-%s.zip", export.CreatedAt.Format("20060102"))
+	if export.Remote {
+		store := objectstore.Default()
+		if store == nil {
+			utils.HandleInternalError(c, errors.New("object storage is not configured"))
+			return
+		}
+		params := neturl.Values{}
+		params.Set("response-content-type", "application/zip")
+		params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		c.Header("Cache-Control", "no-cache")
+		c.Redirect(http.StatusFound, store.PresignGetURL(export.StoragePath, h.presignTTL, params))
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(export.StoragePath, name)
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/apidocs"
+	"gochat/internal/utils"
+)
+
+// GetOpenAPISpec 返回OpenAPI规范（JSON），可导入Postman等工具或用于生成客户端代码
+// 规范随程序一起构建，同一版本内容不变，允许短时间缓存
+func GetOpenAPISpec(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "application/json; charset=utf-8", apidocs.Spec())
+}
+
+// GetAPIDocs 返回由OpenAPI规范渲染的接口文档页面
+func GetAPIDocs(c *gin.Context) {
+	page, err := apidocs.Page()
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
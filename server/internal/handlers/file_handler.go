@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+	"gochat/internal/objectstore"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+// 签名链接未配置有效期或配置无效时使用的默认值
+const defaultSignedURLTTL = 10 * time.Minute
+
+type FileHandler struct {
+	config      *config.Config
+	fileService *services.FileService
+	signedTTL   time.Duration
+	presignTTL  time.Duration // 已迁移到对象存储的文件跳转的预签名链接有效期
+}
+
+func NewFileHandler(cfg *config.Config) *FileHandler {
+	ttl, err := time.ParseDuration(cfg.Upload.SignedURLTTL)
+	if err != nil || ttl <= 0 {
+		ttl = defaultSignedURLTTL
+	}
+	presignTTL, err := time.ParseDuration(cfg.Storage.PresignedURLTTL)
+	if err != nil || presignTTL <= 0 {
+		presignTTL = defaultSignedURLTTL
+	}
+	return &FileHandler{
+		config:      cfg,
+		fileService: services.NewFileService(),
+		signedTTL:   ttl,
+		presignTTL:  presignTTL,
+	}
+}
+
+// signingSecret 下载链接签名密钥，未单独配置时使用JWT密钥
+func (h *FileHandler) signingSecret() string {
+	return uploadSigningSecret(h.config)
+}
+
+// uploadSigningSecret 文件签名密钥（下载链接、秒传校验片段），未单独配置时使用JWT密钥
+func uploadSigningSecret(cfg *config.Config) string {
+	if cfg.Upload.SigningSecret != "" {
+		return cfg.Upload.SigningSecret
+	}
+	return cfg.JWT.Secret
+}
+
+// authorizedFile 查找文件并校验当前用户的访问权限，无权访问时同样返回404，不暴露文件是否存在
+func (h *FileHandler) authorizedFile(c *gin.Context) (*models.FileStorage, string, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return nil, "", false
+	}
+
+	size := c.Query("size")
+	if !services.ValidThumbnailSize(size) {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid size, must be small or medium"))
+		return nil, "", false
+	}
+
+	file, err := h.fileService.FindFile(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "File not found"))
+		return nil, "", false
+	}
+
+	allowed, err := h.fileService.CanAccessFile(c.Request.Context(), userID.(int64), file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to check file access"))
+		return nil, "", false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "File not found"))
+		return nil, "", false
+	}
+	return file, size, true
+}
+
+// Download 下载文件（需要登录），id可以是文件ID或文件哈希，size=small/medium时返回缩略图
+func (h *FileHandler) Download(c *gin.Context) {
+	file, size, ok := h.authorizedFile(c)
+	if !ok {
+		return
+	}
+
+	// 文档作为附件下载，使用原始文件名
+	var name string
+	if !services.IsInlineMedia(file.StoragePath) {
+		var err error
+		name, err = h.fileService.DownloadName(c.Request.Context(), c.GetInt64("user_id"), file)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to load file name"))
+			return
+		}
+	}
+
+	// 文件按内容哈希存储，内容不会变化；按用户鉴权，只允许浏览器私有缓存
+	c.Header("Cache-Control", "private, max-age=86400")
+	h.serveFile(c, file, size, name)
+}
+
+// ListFiles 我的文件：按时间倒序列出当前用户上传和发送的文件，可按类别（kind）和会话（peer_id/group_id）过滤
+// 游标分页，before_id传上一页的next_before_id
+func (h *FileHandler) ListFiles(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+
+	filter := services.FileListFilter{Kind: c.Query("kind"), Limit: utils.ParseIntQuery(c, "page_size", 20)}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 20
+	}
+	if !services.ValidFileKind(filter.Kind) {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid kind, must be image, voice, video, file or avatar"))
+		return
+	}
+	var err error
+	for _, param := range []struct {
+		name   string
+		target *int64
+	}{{"peer_id", &filter.PeerID}, {"group_id", &filter.GroupID}, {"before_id", &filter.BeforeID}} {
+		if *param.target, err = utils.ParseInt64Query(c, param.name); err != nil || *param.target < 0 {
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid "+param.name))
+			return
+		}
+	}
+	if filter.PeerID > 0 && filter.GroupID > 0 {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "peer_id and group_id cannot be used together"))
+		return
+	}
+
+	files, hasMore, err := h.fileService.ListUserFiles(c.Request.Context(), userID, filter)
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+
+	var nextBeforeID int64
+	if len(files) > 0 {
+		nextBeforeID = files[len(files)-1].ID
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{
+		"files": files,
+		"pagination": gin.H{
+			"page_size":      filter.Limit,
+			"has_more":       hasMore,
+			"next_before_id": nextBeforeID,
+		},
+	}))
+}
+
+// SignURL 生成短期有效的签名下载链接，供<img>等无法携带Authorization头的场景和CDN缓存使用
+func (h *FileHandler) SignURL(c *gin.Context) {
+	file, size, ok := h.authorizedFile(c)
+	if !ok {
+		return
+	}
+
+	// 文档的下载文件名因用户可见的消息而异，写入链接并纳入签名
+	var name string
+	if !services.IsInlineMedia(file.StoragePath) {
+		var err error
+		name, err = h.fileService.DownloadName(c.Request.Context(), c.GetInt64("user_id"), file)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to load file name"))
+			return
+		}
+	}
+
+	expires := time.Now().Add(h.signedTTL).Truncate(time.Second)
+	url := fmt.Sprintf("/files/%d?expires=%d&sig=%s", file.ID, expires.Unix(),
+		services.SignFileURL(h.signingSecret(), file.ID, size, name, expires))
+	if size != "" {
+		url += "&size=" + size
+	}
+	if name != "" {
+		url += "&name=" + neturl.QueryEscape(name)
+	}
+
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{
+		"url":        services.PublicURL(url),
+		"expires_at": expires.Unix(),
+	}))
+}
+
+// DownloadSigned 通过签名链接下载文件，不需要登录
+func (h *FileHandler) DownloadSigned(c *gin.Context) {
+	fileID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "File not found"))
+		return
+	}
+	expiresUnix, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusForbidden, utils.ErrorResponse(403, "Invalid or expired signature"))
+		return
+	}
+	size, name := c.Query("size"), c.Query("name")
+	expires := time.Unix(expiresUnix, 0)
+	if !services.ValidThumbnailSize(size) ||
+		!services.VerifyFileSignature(h.signingSecret(), fileID, size, name, expires, c.Query("sig")) {
+		c.JSON(http.StatusForbidden, utils.ErrorResponse(403, "Invalid or expired signature"))
+		return
+	}
+
+	file, err := h.fileService.GetFileByID(c.Request.Context(), fileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "File not found"))
+		return
+	}
+
+	// 链接本身即授权，CDN可以缓存到链接过期为止
+	maxAge := int(time.Until(expires).Seconds())
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	h.serveFile(c, file, size, name)
+}
+
+// serveFile 返回文件内容，支持Range请求（音视频拖动进度、断点续传）
+// 图片、音视频直接展示，其他文件以附件形式下载，name为空时使用存储文件名
+func (h *FileHandler) serveFile(c *gin.Context, file *models.FileStorage, size, name string) {
+	path := services.FilePath(file, size)
+	localPath := services.LocalStoragePath(file)
+	if name == "" {
+		name = filepath.Base(localPath)
+	}
+
+	// 已迁移到对象存储的原图跳转到预签名链接，由对象存储处理Range请求
+	if path == localPath && services.IsRemoteFile(file) {
+		if store := objectstore.Default(); store != nil {
+			h.redirectToObject(c, store, file, name)
+			return
+		}
+	}
+
+	// 内容不变，用哈希作为ETag，客户端可以用If-Range安全地续传
+	etag := file.Hash
+	if path != localPath {
+		etag += "-" + size
+	} else if contentType := services.ContentType(file); contentType != "" {
+		// 预先设置Content-Type，避免按系统mime.types或内容检测得到错误的类型
+		c.Header("Content-Type", contentType)
+	}
+	c.Header("ETag", `"`+etag+`"`)
+
+	if services.IsInlineMedia(file.StoragePath) {
+		c.File(path)
+		return
+	}
+	c.FileAttachment(path, name)
+}
+
+// redirectToObject 跳转到对象存储的预签名下载链接，响应头的Content-Type和Content-Disposition由链接参数指定
+func (h *FileHandler) redirectToObject(c *gin.Context, store *objectstore.Client, file *models.FileStorage, name string) {
+	params := neturl.Values{}
+	if contentType := services.ContentType(file); contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+	if !services.IsInlineMedia(file.StoragePath) {
+		params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+	// 预签名链接会过期，跳转响应不能按原文件的缓存策略缓存
+	c.Header("Cache-Control", "no-cache")
+	c.Redirect(http.StatusFound, store.PresignGetURL(services.LocalStoragePath(file), h.presignTTL, params))
+}
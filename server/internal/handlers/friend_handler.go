@@ -37,7 +37,7 @@ func (h *FriendHandler) AddFriend(c *gin.Context) {
 	}
 
 	// 调用服务层
-	if err := h.friendService.AddFriend(userID, req.FriendID); err != nil {
+	if err := h.friendService.AddFriend(c.Request.Context(), userID, req.FriendID); err != nil {
 		utils.HandleBadRequestError(c, err.Error())
 		return
 	}
@@ -61,10 +61,15 @@ func (h *FriendHandler) RemoveFriend(c *gin.Context) {
 	}
 
 	// 调用服务层
-	if err := h.friendService.RemoveFriend(userID, friendID); err != nil {
+	if err := h.friendService.RemoveFriend(c.Request.Context(), userID, friendID); err != nil {
 		utils.HandleBadRequestError(c, err.Error())
 		return
 	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionRemoveFriend,
+		TargetType: services.AuditTargetUser,
+		TargetID:   friendID,
+	})
 
 	c.JSON(http.StatusOK, utils.SuccessResponse("Friend removed successfully"))
 }
@@ -78,13 +83,13 @@ func (h *FriendHandler) GetFriends(c *gin.Context) {
 	}
 
 	// 调用服务层
-	friends, err := h.friendService.GetFriends(userID)
+	friends, err := h.friendService.GetFriends(c.Request.Context(), userID)
 	if err != nil {
 		utils.HandleInternalError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, utils.SuccessResponse(friends))
+	utils.JSONWithETag(c, friends)
 }
 
 // SearchUsers 搜索用户
@@ -108,7 +113,7 @@ func (h *FriendHandler) SearchUsers(c *gin.Context) {
 	}
 
 	// 调用服务层
-	users, err := h.friendService.SearchUsers(keyword, userID, limit)
+	users, err := h.friendService.SearchUsers(c.Request.Context(), keyword, userID, limit)
 	if err != nil {
 		utils.HandleInternalError(c, err)
 		return
@@ -117,7 +122,7 @@ func (h *FriendHandler) SearchUsers(c *gin.Context) {
 	// 为每个用户添加is_friend字段
 	result := make([]map[string]interface{}, len(users))
 	for i, user := range users {
-		isFriend := h.friendService.IsFriend(userID, user.ID)
+		isFriend := h.friendService.IsFriend(c.Request.Context(), userID, user.ID)
 		result[i] = map[string]interface{}{
 			"id":        user.ID,
 			"phone":     user.Phone,
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/graphql"
+	"gochat/internal/utils"
+)
+
+type GraphQLHandler struct {
+	schema *graphql.Schema
+}
+
+func NewGraphQLHandler(cfg *config.Config) *GraphQLHandler {
+	return &GraphQLHandler{schema: graphql.NewSchema(&cfg.GraphQL)}
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Query 执行GraphQL查询，按GraphQL规范返回data和errors（不使用统一的code/message包装），
+// 部分字段出错时其余字段照常返回
+func (h *GraphQLHandler) Query(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	var req graphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleBadRequestError(c, "query is required")
+		return
+	}
+	c.JSON(http.StatusOK, h.schema.Execute(c.Request.Context(), userID, req.Query, req.OperationName, req.Variables))
+}
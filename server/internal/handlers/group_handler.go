@@ -49,16 +49,22 @@ func (h *GroupHandler) CreateGroup(c *gin.Context) {
 	}
 
 	// 创建群组
-	group, err := h.groupService.CreateGroupWithMembers(userID.(int64), req.Name, req.MemberIDs)
+	group, err := h.groupService.CreateGroupWithMembers(c.Request.Context(), userID.(int64), req.Name, req.MemberIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to create group: "+err.Error()))
 		return
 	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionCreateGroup,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		Detail:     map[string]interface{}{"name": req.Name, "member_ids": req.MemberIDs},
+	})
 
 	// 为所有成员创建会话
 	allMemberIDs := append([]int64{userID.(int64)}, req.MemberIDs...)
 	for _, memberID := range allMemberIDs {
-		_, err := h.conversationService.CreateOrUpdateConversation(memberID, group.ID, 2)
+		_, err := h.conversationService.CreateOrUpdateConversation(c.Request.Context(), memberID, group.ID, 2)
 		if err != nil {
 			// 记录错误但不阻断流程
 			c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to create conversation: "+err.Error()))
@@ -85,7 +91,7 @@ func (h *GroupHandler) GetGroup(c *gin.Context) {
 	}
 
 	// 检查用户是否在群中
-	inGroup, err := h.groupService.IsUserInGroup(userID.(int64), groupID)
+	inGroup, err := h.groupService.IsUserInGroup(c.Request.Context(), userID.(int64), groupID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to check group membership"))
 		return
@@ -96,13 +102,14 @@ func (h *GroupHandler) GetGroup(c *gin.Context) {
 	}
 
 	// 获取群组信息
-	group, err := h.groupService.GetGroup(groupID)
+	group, err := h.groupService.GetGroup(c.Request.Context(), groupID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "Group not found"))
 		return
 	}
 
-	c.JSON(http.StatusOK, utils.SuccessResponse(group))
+	// 先校验成员身份再比较ETag，非成员不能借304探测群组内容
+	utils.JSONWithETag(c, group)
 }
 
 // GetGroupMembers 获取群成员列表
@@ -121,7 +128,7 @@ func (h *GroupHandler) GetGroupMembers(c *gin.Context) {
 	}
 
 	// 检查用户是否在群中
-	inGroup, err := h.groupService.IsUserInGroup(userID.(int64), groupID)
+	inGroup, err := h.groupService.IsUserInGroup(c.Request.Context(), userID.(int64), groupID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to check group membership"))
 		return
@@ -132,7 +139,7 @@ func (h *GroupHandler) GetGroupMembers(c *gin.Context) {
 	}
 
 	// 获取群成员详细信息（已包含is_owner字段）
-	members, err := h.groupService.GetGroupMembersWithUserInfo(groupID)
+	members, err := h.groupService.GetGroupMembersWithUserInfo(c.Request.Context(), groupID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to get group members"))
 		return
@@ -157,7 +164,7 @@ func (h *GroupHandler) AddGroupMembers(c *gin.Context) {
 	}
 
 	// 检查用户是否在群中
-	inGroup, err := h.groupService.IsUserInGroup(userID.(int64), groupID)
+	inGroup, err := h.groupService.IsUserInGroup(c.Request.Context(), userID.(int64), groupID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to check group membership"))
 		return
@@ -174,15 +181,21 @@ func (h *GroupHandler) AddGroupMembers(c *gin.Context) {
 	}
 
 	// 添加群成员
-	err = h.groupService.AddGroupMembers(groupID, req.UserIDs)
+	err = h.groupService.AddGroupMembers(c.Request.Context(), groupID, req.UserIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, err.Error()))
 		return
 	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionAddMembers,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   groupID,
+		Detail:     map[string]interface{}{"user_ids": req.UserIDs},
+	})
 
 	// 为新成员创建会话
 	for _, memberID := range req.UserIDs {
-		_, err := h.conversationService.CreateOrUpdateConversation(memberID, groupID, 2)
+		_, err := h.conversationService.CreateOrUpdateConversation(c.Request.Context(), memberID, groupID, 2)
 		if err != nil {
 			// 记录错误但不阻断流程
 			continue
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/breaker"
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/health"
+	"gochat/internal/services"
+)
+
+// HealthHandler 健康检查处理器
+type HealthHandler struct {
+	checker *health.Checker
+	ready   *health.Checker // 就绪检查，数据库或Redis不可用时不接收流量
+}
+
+// NewHealthHandler 创建健康检查处理器，检查数据库、Redis和上传目录，配置已在加载时校验
+func NewHealthHandler(cfg *config.HealthConfig) *HealthHandler {
+	timeout, _ := time.ParseDuration(cfg.Timeout)
+	cacheTTL, _ := time.ParseDuration(cfg.CacheTTL)
+	return &HealthHandler{
+		checker: health.NewChecker(timeout, cacheTTL,
+			// 数据库不可用时无法提供服务；Redis不可用时降级运行（不走缓存）；上传目录不可写只影响上传
+			health.Check{Name: "database", Critical: true, Run: health.Database(database.GetDB())},
+			health.Check{Name: "redis", Run: health.Redis(cache.GetRedisClient())},
+			health.Check{Name: "uploads", Run: health.WritableDir(services.FileStorageDir)},
+		),
+		ready: health.NewChecker(timeout, cacheTTL,
+			health.Check{Name: "database", Critical: true, Run: health.Database(database.GetDB())},
+			health.Check{Name: "redis", Critical: true, Run: health.Redis(cache.GetRedisClient())},
+		),
+	}
+}
+
+// Liveness 存活检查（/healthz），进程能处理请求即返回200，不检查依赖，避免依赖故障时实例被反复重启
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// Readiness 就绪检查（/readyz），数据库已迁移、缓存预热完成、Redis和数据库可访问且未在关闭时返回200，否则返回503和原因
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	reasons := health.PendingReasons()
+	var checks map[string]health.CheckResult
+	// 关闭期间不再检查依赖
+	if !health.IsDraining() {
+		report := h.ready.Run(c.Request.Context())
+		checks = report.Checks
+		for name, result := range report.Checks {
+			if result.Status != health.CheckUp {
+				reasons = append(reasons, name+"_unavailable")
+			}
+		}
+	}
+
+	if len(reasons) > 0 {
+		sort.Strings(reasons)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready", "reasons": reasons, "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
+
+// HealthCheck 健康检查，返回各依赖的检查结果（状态和耗时）和熔断状态
+// 数据库不可用或熔断时返回503，负载均衡可据此摘除实例；Redis或上传目录异常时服务降级运行，仍返回200
+func (h *HealthHandler) HealthCheck(c *gin.Context) {
+	report := h.checker.Run(c.Request.Context())
+
+	dependencies := gin.H{}
+	for name, state := range breaker.States() {
+		dependencies[name] = state.String()
+	}
+
+	status := report.Status
+	if database.IsCircuitOpen() {
+		status = health.StatusUnavailable
+	} else if cache.IsCircuitOpen() && status == health.StatusOK {
+		status = health.StatusDegraded
+	}
+	code := http.StatusOK
+	if status == health.StatusUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":       status,
+		"message":      "GoChat API is running",
+		"checks":       report.Checks,
+		"checked_at":   report.CheckedAt.Unix(),
+		"dependencies": dependencies,
+	})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type IPBanHandler struct {
+	banService *services.IPBanService
+}
+
+func NewIPBanHandler(banService *services.IPBanService) *IPBanHandler {
+	return &IPBanHandler{banService: banService}
+}
+
+// BanIPRequest 封禁请求
+type BanIPRequest struct {
+	IP       string `json:"ip" binding:"required"` // IP或CIDR网段
+	Reason   string `json:"reason" binding:"max=255"`
+	Duration string `json:"duration"` // 封禁时长，如24h，为空表示永久
+}
+
+// ListBans 列出未过期的封禁
+func (h *IPBanHandler) ListBans(c *gin.Context) {
+	bans, err := h.banService.ListBans(c.Request.Context())
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(bans))
+}
+
+// BanIP 手动封禁IP或网段，已封禁时更新原因和时长
+func (h *IPBanHandler) BanIP(c *gin.Context) {
+	var req BanIPRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	var ttl time.Duration
+	if req.Duration != "" {
+		parsed, err := time.ParseDuration(req.Duration)
+		if err != nil || parsed <= 0 {
+			utils.HandleBadRequestError(c, "Invalid duration")
+			return
+		}
+		ttl = parsed
+	}
+
+	ban, err := h.banService.BanIP(c.Request.Context(), req.IP, req.Reason, services.IPBanSourceManual, ttl)
+	if err != nil {
+		utils.HandleBadRequestError(c, err.Error())
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionBanIP,
+		TargetType: services.AuditTargetIPBan,
+		TargetID:   ban.ID,
+		Detail:     map[string]interface{}{"ip": ban.IP, "reason": req.Reason, "duration": req.Duration},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(ban))
+}
+
+// UnbanIP 解除封禁
+func (h *IPBanHandler) UnbanIP(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.HandleParseError(c, "ban ID")
+		return
+	}
+	err = h.banService.UnbanIP(c.Request.Context(), id)
+	if errors.Is(err, services.ErrIPBanNotFound) {
+		utils.HandleNotFoundError(c, "IP ban")
+		return
+	}
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionUnbanIP,
+		TargetType: services.AuditTargetIPBan,
+		TargetID:   id,
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse("IP unbanned"))
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -35,22 +36,14 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 	conversationTypeStr := c.Query("type") // 1-单聊, 2-群聊
 	conversationIDStr := c.Query("conversation_id")
 
-	// 分页参数
-	pageStr := c.DefaultQuery("page", "1")
-	pageSizeStr := c.DefaultQuery("page_size", "20")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
-	}
-
-	pageSize, err := strconv.Atoi(pageSizeStr)
-	if err != nil || pageSize < 1 || pageSize > 100 {
-		pageSize = 20
+	cursor, ok := parseMessageCursor(c)
+	if !ok {
+		return
 	}
 
 	var messages []services.MessageInfo
-	var total int64
+	var hasMore bool
+	var queryErr error
 
 	if targetIDStr != "" && conversationTypeStr != "" {
 		// 通过target_id和type查询
@@ -68,10 +61,10 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 
 		if conversationType == models.ConversationTypePrivate {
 			// 单聊
-			messages, total, err = h.messageService.GetPrivateMessagesWithUserInfo(userID.(int64), targetID, page, pageSize)
+			messages, hasMore, queryErr = h.messageService.GetPrivateMessagesWithUserInfo(c.Request.Context(), userID.(int64), targetID, cursor)
 		} else {
 			// 群聊
-			messages, total, err = h.messageService.GetGroupMessagesWithUserInfo(targetID, page, pageSize)
+			messages, hasMore, queryErr = h.messageService.GetGroupMessagesWithUserInfo(c.Request.Context(), targetID, userID.(int64), cursor)
 		}
 	} else if conversationIDStr != "" {
 		// 通过conversation_id查询（需要先获取会话信息）
@@ -83,7 +76,7 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 
 		// 获取会话信息
 		conversationService := services.NewConversationService()
-		conversation, err := conversationService.GetConversationByID(conversationID, userID.(int64))
+		conversation, err := conversationService.GetConversationByID(c.Request.Context(), conversationID, userID.(int64))
 		if err != nil {
 			c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "Conversation not found"))
 			return
@@ -91,31 +84,136 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 
 		if conversation.Type == models.ConversationTypePrivate {
 			// 单聊
-			messages, total, err = h.messageService.GetPrivateMessagesWithUserInfo(userID.(int64), conversation.TargetID, page, pageSize)
+			messages, hasMore, queryErr = h.messageService.GetPrivateMessagesWithUserInfo(c.Request.Context(), userID.(int64), conversation.TargetID, cursor)
 		} else {
 			// 群聊
-			messages, total, err = h.messageService.GetGroupMessagesWithUserInfo(conversation.TargetID, page, pageSize)
+			messages, hasMore, queryErr = h.messageService.GetGroupMessagesWithUserInfo(c.Request.Context(), conversation.TargetID, userID.(int64), cursor)
 		}
 	} else {
 		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Either (target_id and type) or conversation_id is required"))
 		return
 	}
 
+	if queryErr != nil {
+		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, queryErr.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.SuccessResponse(messagePage(messages, hasMore, cursor)))
+}
+
+// SearchMessages 按关键词搜索消息，可通过target_id+type限定在某个会话内，分页参数与历史消息相同
+func (h *MessageHandler) SearchMessages(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	keyword := strings.TrimSpace(c.Query("keyword"))
+	if keyword == "" {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "keyword is required"))
+		return
+	}
+	search := services.MessageSearch{Keyword: keyword}
+
+	if targetIDStr := c.Query("target_id"); targetIDStr != "" {
+		targetID, err := strconv.ParseInt(targetIDStr, 10, 64)
+		if err != nil || targetID <= 0 {
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid target_id"))
+			return
+		}
+		conversationType, err := strconv.Atoi(c.Query("type"))
+		if err != nil || (conversationType != models.ConversationTypePrivate && conversationType != models.ConversationTypeGroup) {
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid type, must be 1 or 2"))
+			return
+		}
+		search.TargetID = targetID
+		search.Type = conversationType
+	}
+
+	cursor, ok := parseMessageCursor(c)
+	if !ok {
+		return
+	}
+
+	messages, hasMore, err := h.messageService.SearchMessages(c.Request.Context(), userID.(int64), search, cursor)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, err.Error()))
 		return
 	}
 
-	// 构建响应
-	result := gin.H{
+	c.JSON(http.StatusOK, utils.SuccessResponse(messagePage(messages, hasMore, cursor)))
+}
+
+// parseMessageCursor 解析游标分页参数：before_id向前翻更早的消息，after_id拉取更新的消息，都不传时返回最新一页
+// 参数无效时直接返回400响应
+func parseMessageCursor(c *gin.Context) (services.MessageCursor, bool) {
+	pageSizeStr := c.DefaultQuery("page_size", "20")
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	cursor := services.MessageCursor{Limit: pageSize}
+	if beforeIDStr := c.Query("before_id"); beforeIDStr != "" {
+		cursor.BeforeID, err = strconv.ParseInt(beforeIDStr, 10, 64)
+		if err != nil || cursor.BeforeID < 0 {
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid before_id"))
+			return cursor, false
+		}
+	}
+	if afterIDStr := c.Query("after_id"); afterIDStr != "" {
+		cursor.AfterID, err = strconv.ParseInt(afterIDStr, 10, 64)
+		if err != nil || cursor.AfterID < 0 {
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid after_id"))
+			return cursor, false
+		}
+	}
+	if cursor.BeforeID > 0 && cursor.AfterID > 0 {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "before_id and after_id cannot be used together"))
+		return cursor, false
+	}
+	return cursor, true
+}
+
+// messagePage 构建分页响应，消息按时间倒序；next_before_id/next_after_id 分别用于继续向前/向后翻页
+func messagePage(messages []services.MessageInfo, hasMore bool, cursor services.MessageCursor) gin.H {
+	var nextBeforeID, nextAfterID int64
+	if len(messages) > 0 {
+		nextAfterID = messages[0].ID
+		nextBeforeID = messages[len(messages)-1].ID
+	}
+	return gin.H{
 		"messages": messages,
 		"pagination": gin.H{
-			"page":       page,
-			"page_size":  pageSize,
-			"total":      total,
-			"total_page": (total + int64(pageSize) - 1) / int64(pageSize),
+			"page_size":      cursor.Limit,
+			"has_more":       hasMore,
+			"next_before_id": nextBeforeID,
+			"next_after_id":  nextAfterID,
 		},
 	}
+}
+
+// DeleteMessage 删除消息，scope=me仅为自己删除（默认），scope=everyone对所有人删除（仅发送者）
+func (h *MessageHandler) DeleteMessage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid message ID"))
+		return
+	}
+
+	scope := c.DefaultQuery("scope", services.DeleteScopeMe)
+	if err := h.messageService.DeleteMessage(c.Request.Context(), userID.(int64), messageID, scope); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, err.Error()))
+		return
+	}
 
-	c.JSON(http.StatusOK, utils.SuccessResponse(result))
+	c.JSON(http.StatusOK, utils.SuccessResponse("Message deleted"))
 }
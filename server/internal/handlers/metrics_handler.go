@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+)
+
+// GetMetrics 以JSON返回所有指标的当前值（连接池、WebSocket、缓存等）
+func GetMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, metrics.Default().Snapshot())
+}
+
+// GetPrometheusMetrics 以Prometheus文本格式返回所有指标，供Prometheus抓取
+func GetPrometheusMetrics(c *gin.Context) {
+	c.Header("Content-Type", metrics.PrometheusContentType)
+	c.Status(http.StatusOK)
+	if err := metrics.Default().WritePrometheus(c.Writer); err != nil {
+		logger.GetLogger().Warnf("输出Prometheus指标失败: %v", err)
+	}
+}
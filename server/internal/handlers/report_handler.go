@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type ReportHandler struct {
+	reportService *services.ReportService
+}
+
+func NewReportHandler() *ReportHandler {
+	return &ReportHandler{reportService: services.NewReportService()}
+}
+
+// handleReportError 把举报服务的错误转换为响应
+func handleReportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrReportNotFound):
+		utils.HandleNotFoundError(c, "Report")
+	case errors.Is(err, services.ErrMessageNotFound):
+		utils.HandleNotFoundError(c, "Message")
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.HandleNotFoundError(c, "User")
+	case errors.Is(err, services.ErrReportResolved):
+		c.JSON(http.StatusConflict, utils.WithRequestID(c, utils.ErrorResponse(409, err.Error())))
+	case errors.Is(err, services.ErrModerateStaff), errors.Is(err, services.ErrModerateSelf):
+		c.JSON(http.StatusForbidden, utils.WithRequestID(c, utils.ErrorResponse(403, err.Error())))
+	default:
+		utils.HandleBadRequestError(c, err.Error())
+	}
+}
+
+// CreateReport 举报消息或用户
+func (h *ReportHandler) CreateReport(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	var req services.ReportRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	report, err := h.reportService.CreateReport(c.Request.Context(), userID, &req)
+	if err != nil {
+		handleReportError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionReport,
+		TargetType: services.AuditTargetReport,
+		TargetID:   report.ID,
+		Detail:     map[string]interface{}{"target_type": report.TargetType, "target_id": report.TargetID, "reason": report.Reason},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{
+		"id":     report.ID,
+		"status": report.Status,
+	}))
+}
+
+// ListReports 审核队列，支持按状态、对象类型和被举报用户过滤，before_id为分页游标
+func (h *ReportHandler) ListReports(c *gin.Context) {
+	var q services.ReportQuery
+	var err error
+	if q.ReportedUserID, err = utils.ParseInt64Query(c, "reported_user_id"); err != nil {
+		utils.HandleParseError(c, "reported_user_id")
+		return
+	}
+	if q.BeforeID, err = utils.ParseInt64Query(c, "before_id"); err != nil {
+		utils.HandleParseError(c, "before_id")
+		return
+	}
+	q.Status = c.Query("status")
+	q.TargetType = c.Query("target_type")
+	q.Limit = utils.ParseIntQuery(c, "limit", 50)
+
+	reports, hasMore, err := h.reportService.ListReports(c.Request.Context(), q)
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{
+		"reports":  reports,
+		"has_more": hasMore,
+	}))
+}
+
+// GetReport 查看举报详情
+func (h *ReportHandler) GetReport(c *gin.Context) {
+	reportID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "report ID")
+		return
+	}
+	report, err := h.reportService.GetReport(c.Request.Context(), reportID)
+	if err != nil {
+		handleReportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(report))
+}
+
+// ClaimReport 认领举报，其他审核员可据此避免重复处理
+func (h *ReportHandler) ClaimReport(c *gin.Context) {
+	reportID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "report ID")
+		return
+	}
+	report, err := h.reportService.ClaimReport(c.Request.Context(), actorID(c), reportID)
+	if err != nil {
+		handleReportError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionClaimReport,
+		TargetType: services.AuditTargetReport,
+		TargetID:   reportID,
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(report))
+}
+
+// ResolveReport 处理举报：不处理、下架消息、警告、禁言或封禁
+func (h *ReportHandler) ResolveReport(c *gin.Context) {
+	reportID, err := utils.ParseInt64Param(c, "id")
+	if err != nil {
+		utils.HandleParseError(c, "report ID")
+		return
+	}
+	var req services.ResolveReportRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	report, err := h.reportService.ResolveReport(c.Request.Context(), actorID(c), reportID, &req)
+	if err != nil {
+		handleReportError(c, err)
+		return
+	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionResolveReport,
+		TargetType: services.AuditTargetReport,
+		TargetID:   reportID,
+		Detail: map[string]interface{}{
+			"action":           req.Action,
+			"duration":         req.Duration,
+			"note":             req.Note,
+			"target_type":      report.TargetType,
+			"target_id":        report.TargetID,
+			"reported_user_id": report.ReportedUserID,
+		},
+	})
+	c.JSON(http.StatusOK, utils.SuccessResponse(report))
+}
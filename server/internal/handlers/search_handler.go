@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type SearchHandler struct {
+	searchService services.SearchService
+}
+
+func NewSearchHandler() *SearchHandler {
+	return &SearchHandler{searchService: services.GetSearchService()}
+}
+
+// Search 全局搜索消息、用户和群组，types为逗号分隔的搜索范围（默认全部），before_id为消息分页游标
+func (h *SearchHandler) Search(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	keyword, ok := utils.ValidateRequiredQuery(c, "keyword", "Search keyword")
+	if !ok {
+		return
+	}
+	q := services.SearchQuery{
+		Keyword: strings.TrimSpace(keyword),
+		Limit:   utils.ParseIntQuery(c, "limit", 20),
+	}
+	if q.Keyword == "" {
+		utils.HandleBadRequestError(c, "Search keyword is required")
+		return
+	}
+	var err error
+	if q.BeforeID, err = utils.ParseInt64Query(c, "before_id"); err != nil {
+		utils.HandleParseError(c, "before_id")
+		return
+	}
+	if types := c.Query("types"); types != "" {
+		q.Types = strings.Split(types, ",")
+	}
+
+	results, err := h.searchService.Search(c.Request.Context(), userID, q)
+	if errors.Is(err, services.ErrInvalidSearchType) {
+		utils.HandleBadRequestError(c, err.Error())
+		return
+	}
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(results))
+}
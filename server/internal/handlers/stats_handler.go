@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+type StatsHandler struct {
+	statsService     *services.AdminStatsService
+	analyticsService *services.AnalyticsService
+	maxDays          int
+}
+
+func NewStatsHandler(cfg *config.Config) *StatsHandler {
+	return &StatsHandler{
+		statsService:     services.NewAdminStatsService(&cfg.Admin.Stats),
+		analyticsService: services.NewAnalyticsService(cfg),
+		maxDays:          cfg.Admin.Stats.MaxDays,
+	}
+}
+
+// parseRange 解析from和to（UTC日期YYYY-MM-DD，含两端），默认最近7天
+func parseRange(c *gin.Context) (time.Time, time.Time, bool) {
+	to := time.Now().UTC()
+	var err error
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.DateOnly, value); err != nil {
+			utils.HandleParseError(c, "to (YYYY-MM-DD expected)")
+			return to, to, false
+		}
+	}
+	from := to.AddDate(0, 0, -6)
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.DateOnly, value); err != nil {
+			utils.HandleParseError(c, "from (YYYY-MM-DD expected)")
+			return from, to, false
+		}
+	}
+	return from, to, true
+}
+
+// respond 返回统计结果，时间范围无效时返回400
+func (h *StatsHandler) respond(c *gin.Context, result interface{}, err error) {
+	if errors.Is(err, services.ErrInvalidStatsRange) {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400,
+			fmt.Sprintf("from must not be after to, and the range must not exceed %d days", h.maxDays)))
+		return
+	}
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(result))
+}
+
+// GetStats 运营统计：from到to（UTC日期YYYY-MM-DD，含两端）每天的活跃用户、消息数、注册数、峰值连接数和存储增长，默认最近7天
+func (h *StatsHandler) GetStats(c *gin.Context) {
+	from, to, ok := parseRange(c)
+	if !ok {
+		return
+	}
+	stats, err := h.statsService.Query(c.Request.Context(), from, to)
+	h.respond(c, stats, err)
+}
+
+// GetMessageStats 按天（granularity=day，默认）或按小时（granularity=hour）的消息数，分单聊、群聊和消息类型
+func (h *StatsHandler) GetMessageStats(c *gin.Context) {
+	from, to, ok := parseRange(c)
+	if !ok {
+		return
+	}
+	granularity := c.DefaultQuery("granularity", "day")
+	if granularity != "day" && granularity != "hour" {
+		utils.HandleParseError(c, "granularity (day or hour expected)")
+		return
+	}
+	stats, err := h.analyticsService.MessageStats(c.Request.Context(), from, to, granularity == "hour")
+	h.respond(c, stats, err)
+}
+
+// GetActiveUsers 每天的活跃用户数和范围内去重后的活跃用户数（精确值）
+func (h *StatsHandler) GetActiveUsers(c *gin.Context) {
+	from, to, ok := parseRange(c)
+	if !ok {
+		return
+	}
+	stats, err := h.analyticsService.ActiveUsers(c.Request.Context(), from, to)
+	h.respond(c, stats, err)
+}
+
+// GetGroupLeaderboard 范围内消息数最多的群，limit默认10、最大100
+func (h *StatsHandler) GetGroupLeaderboard(c *gin.Context) {
+	from, to, ok := parseRange(c)
+	if !ok {
+		return
+	}
+	groups, err := h.analyticsService.GroupLeaderboard(c.Request.Context(), from, to, utils.ParseIntQuery(c, "limit", 10))
+	h.respond(c, gin.H{"groups": groups}, err)
+}
+
+// GetRetention 按注册日期分组的留存，days为逗号分隔的天数点（默认1,7,30）
+func (h *StatsHandler) GetRetention(c *gin.Context) {
+	from, to, ok := parseRange(c)
+	if !ok {
+		return
+	}
+	offsets := services.DefaultRetentionDays
+	if value := c.Query("days"); value != "" {
+		offsets = nil
+		for _, part := range strings.Split(value, ",") {
+			offset, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				utils.HandleParseError(c, "days")
+				return
+			}
+			offsets = append(offsets, offset)
+		}
+	}
+	cohorts, err := h.analyticsService.Retention(c.Request.Context(), from, to, offsets)
+	if errors.Is(err, services.ErrInvalidRetentionDays) {
+		utils.HandleBadRequestError(c, "days must contain 1 to 10 values between 1 and 365")
+		return
+	}
+	h.respond(c, gin.H{"cohorts": cohorts}, err)
+}
@@ -1,29 +1,56 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 
 	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/models"
 	"gochat/internal/services"
 	"gochat/internal/utils"
 )
 
 type UploadHandler struct {
-	config      *config.Config
-	fileService *services.FileService
+	config         *config.Config
+	upload         atomic.Pointer[config.UploadConfig] // 大小、类型等上传限制，支持热加载
+	fileService    *services.FileService
+	videoProcessor services.VideoProcessor              // 未安装ffmpeg时为nil，视频上传不可用
+	quota          atomic.Pointer[services.UploadQuota] // 未启用时为nil，不限制
+	sessions       atomic.Pointer[services.UploadSessionService]
 }
 
 func NewUploadHandler(cfg *config.Config) *UploadHandler {
-	return &UploadHandler{
+	h := &UploadHandler{
 		config:      cfg,
 		fileService: services.NewFileService(),
 	}
+	h.upload.Store(&cfg.Upload)
+	h.quota.Store(services.NewUploadQuota(&cfg.Upload.Quota))
+	h.sessions.Store(services.NewUploadSessionService(&cfg.Upload.Session))
+	config.OnReload(func(next *config.Config) {
+		h.upload.Store(&next.Upload)
+		h.quota.Store(services.NewUploadQuota(&next.Upload.Quota))
+		h.sessions.Store(services.NewUploadSessionService(&next.Upload.Session))
+	})
+	if processor, err := services.NewFFmpegProcessor(cfg.Upload.Video); err != nil {
+		logger.GetLogger().Warnf("视频上传不可用: %v", err)
+	} else {
+		h.videoProcessor = processor
+	}
+	return h
 }
 
 // UploadImage 上传聊天图片（使用文件去重系统）
@@ -76,23 +103,66 @@ func (h *UploadHandler) UploadImage(c *gin.Context) {
 		return
 	}
 
+	// 按上传的内容检查配额
+	release, ok := h.reserveQuota(c, userID.(int64), file, fileHeader.Size)
+	if !ok {
+		return
+	}
+
+	// 去除元数据（GPS定位等），需在计算哈希去重之前
+	source := stripImageMetadata(file, fileHeader.Filename, h.upload.Load().Image)
+
+	// 压缩超出尺寸的图片，失败时按原图上传
+	upload := source
+	compressed, err := services.CompressImage(source, h.upload.Load().Image)
+	if err != nil {
+		logger.GetLogger().Warnf("压缩图片失败: file=%s, error=%v", fileHeader.Filename, err)
+	} else if compressed != nil {
+		upload = compressed
+	}
+
 	// 使用FileService上传文件（自动去重）
-	result, err := h.fileService.UploadFile(file, fileHeader, userID.(int64), "chat_image", "uploads/images")
+	result, err := h.fileService.UploadFile(c.Request.Context(), upload, fileHeader, userID.(int64), "chat_image", "uploads/images")
 	if err != nil {
+		release()
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, fmt.Sprintf("Failed to upload file: %v", err)))
 		return
 	}
 
+	// 按配置保留原图，保存失败不影响压缩图的上传结果
+	var originalURL string
+	if compressed != nil && h.upload.Load().Image.KeepOriginal {
+		original, err := h.fileService.UploadFile(c.Request.Context(), source, fileHeader, userID.(int64), "chat_image_original", "")
+		if err != nil {
+			logger.GetLogger().Warnf("保存原图失败: file=%s, error=%v", fileHeader.Filename, err)
+		} else {
+			originalURL = services.PublicURL("/" + original.URL)
+		}
+	}
+
+	// 生成缩略图，失败时缩略图URL退回原图，不影响上传结果
+	if err := h.fileService.GenerateThumbnails(result.FileStorage); err != nil {
+		logger.GetLogger().Warnf("生成缩略图失败: path=%s, error=%v", result.URL, err)
+	}
+
 	// 提取文件名（用于兼容前端）
 	filename := filepath.Base(result.URL)
 
-	// 返回文件URL和去重信息
+	// 返回文件URL、缩略图URL和去重信息
 	response := gin.H{
-		"image_url":    "/" + result.URL,
+		"image_url":    services.PublicURL("/" + result.URL),
+		"thumbnails":   services.ThumbnailURLs("/" + result.URL),
 		"filename":     filename,
 		"message":      "Image uploaded successfully",
 		"deduplicated": result.IsDedup,
 	}
+	if blurhash := services.ImageBlurhash("/" + result.URL); blurhash != "" {
+		response["blurhash"] = blurhash
+	}
+
+	if originalURL != "" {
+		response["original_url"] = originalURL
+	}
 
 	if result.IsDedup {
 		response["message"] = "Image uploaded successfully (deduplicated)"
@@ -151,6 +221,12 @@ func (h *UploadHandler) UploadVoice(c *gin.Context) {
 		return
 	}
 
+	// 按上传的内容检查配额
+	release, ok := h.reserveQuota(c, userID.(int64), file, fileHeader.Size)
+	if !ok {
+		return
+	}
+
 	// 获取前端传入的时长（秒）
 	durationStr := c.PostForm("duration")
 	var duration float64
@@ -161,8 +237,9 @@ func (h *UploadHandler) UploadVoice(c *gin.Context) {
 	}
 
 	// 使用FileService上传文件（自动去重）
-	result, err := h.fileService.UploadFile(file, fileHeader, userID.(int64), "chat_voice", "uploads/voices")
+	result, err := h.fileService.UploadFile(c.Request.Context(), file, fileHeader, userID.(int64), "chat_voice", "uploads/voices")
 	if err != nil {
+		release()
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, fmt.Sprintf("Failed to upload voice file: %v", err)))
 		return
 	}
@@ -172,7 +249,8 @@ func (h *UploadHandler) UploadVoice(c *gin.Context) {
 
 	// 返回文件URL和去重信息
 	response := gin.H{
-		"voice_url":    "/" + result.URL,
+		"voice_url":    services.PublicURL("/" + result.URL),
+		"file_id":      result.FileStorage.ID,
 		"filename":     filename,
 		"duration":     duration,
 		"message":      "Voice uploaded successfully",
@@ -185,3 +263,453 @@ func (h *UploadHandler) UploadVoice(c *gin.Context) {
 
 	c.JSON(http.StatusOK, utils.SuccessResponse(response))
 }
+
+// UploadVideo 上传视频（使用文件去重系统），校验容器、编码和时长并截取封面图
+func (h *UploadHandler) UploadVideo(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	// 获取上传的文件
+	fileHeader, err := c.FormFile("video")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "No video file uploaded"))
+		return
+	}
+
+	// 检查文件大小和类型
+	ext, err := h.checkVideoUpload(fileHeader.Filename, fileHeader.Size)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	// 打开文件
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to open uploaded file"))
+		return
+	}
+	defer file.Close()
+
+	// 写入临时文件供ffprobe读取
+	tmp, err := services.SpoolTempFile(file, ext)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to buffer uploaded file"))
+		return
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	response, err := h.storeVideo(c.Request.Context(), userID.(int64), tmp, fileHeader, ext, nil)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(response))
+}
+
+// checkVideoUpload 按文件名和大小检查视频上传，返回小写的扩展名
+func (h *UploadHandler) checkVideoUpload(fileName string, size int64) (string, error) {
+	// 没有ffprobe时无法校验编码和时长，不接受视频
+	if h.videoProcessor == nil {
+		return "", &uploadError{status: http.StatusServiceUnavailable, message: "Video upload is not available"}
+	}
+
+	// 检查文件大小
+	maxSizeMB := h.upload.Load().Video.MaxSizeMB
+	if size > int64(maxSizeMB)<<20 {
+		return "", badUpload(fmt.Sprintf("Video file size too large, maximum %dMB", maxSizeMB))
+	}
+
+	// 检查文件类型
+	allowedTypes := []string{".mp4", ".mov", ".m4v", ".webm"}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if !slices.Contains(allowedTypes, ext) {
+		return "", badUpload("Invalid file type, only mp4, mov, m4v, webm are allowed")
+	}
+	return ext, nil
+}
+
+// storeVideo 校验视频内容后存储并截取封面，返回上传响应；file为可供ffprobe读取的本地文件
+// setState不为nil时在进入存储、截取封面阶段时调用，用于分片上传会话报告处理进度
+func (h *UploadHandler) storeVideo(ctx context.Context, userID int64, file *os.File, fileHeader *multipart.FileHeader, ext string, setState func(state string)) (gin.H, error) {
+	// 验证视频文件（MIME类型 + 扩展名匹配）
+	if err := utils.ValidateVideoFile(file, fileHeader.Filename, ext); err != nil {
+		return nil, badUpload(err.Error())
+	}
+
+	// 探测并校验容器、编码和时长
+	info, err := h.videoProcessor.Probe(ctx, file.Name())
+	if err != nil {
+		logger.GetLogger().Warnf("探测视频失败: file=%s, error=%v", fileHeader.Filename, err)
+		return nil, badUpload("Invalid video file")
+	}
+	if err := services.ValidateVideo(info, h.upload.Load().Video); err != nil {
+		return nil, badUpload(err.Error())
+	}
+
+	if setState != nil {
+		setState(services.UploadSessionStoring)
+	}
+
+	// 按上传的内容检查配额
+	release, err := h.reserveQuotaContext(ctx, userID, file, fileHeader.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用FileService上传文件（自动去重）
+	result, err := h.fileService.UploadFile(ctx, file, fileHeader, userID, "chat_video", "uploads/videos")
+	if err != nil {
+		release()
+		return nil, &uploadError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to upload video file: %v", err)}
+	}
+
+	if setState != nil {
+		setState(services.UploadSessionThumbnailing)
+	}
+
+	// 截取封面图，失败时客户端显示默认占位图，不影响上传结果
+	if err := h.fileService.GenerateVideoPoster(ctx, h.videoProcessor, result.FileStorage, info.Duration); err != nil {
+		logger.GetLogger().Warnf("生成视频封面失败: path=%s, error=%v", result.URL, err)
+	}
+
+	// 返回文件URL、封面、时长和去重信息
+	response := gin.H{
+		"video_url":    services.PublicURL("/" + result.URL),
+		"file_id":      result.FileStorage.ID,
+		"thumbnails":   services.MessageThumbnails(models.MessageTypeVideo, "/"+result.URL),
+		"filename":     filepath.Base(result.URL),
+		"duration":     info.Duration.Seconds(),
+		"width":        info.Width,
+		"height":       info.Height,
+		"message":      "Video uploaded successfully",
+		"deduplicated": result.IsDedup,
+	}
+
+	if result.IsDedup {
+		response["message"] = "Video uploaded successfully (deduplicated)"
+	}
+	return response, nil
+}
+
+// UploadFile 上传文档（使用文件去重系统），返回的file_url和原始文件名用于发送文件消息
+func (h *UploadHandler) UploadFile(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	// 获取上传的文件
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "No file uploaded"))
+		return
+	}
+
+	// 检查文件大小和文件名
+	fileName, err := h.checkDocumentUpload(fileHeader.Filename, fileHeader.Size)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	// 打开文件
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to open uploaded file"))
+		return
+	}
+	defer file.Close()
+
+	response, err := h.storeDocument(c.Request.Context(), userID.(int64), file, fileHeader, fileName, nil)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(response))
+}
+
+// checkDocumentUpload 按文件名和大小检查文档上传，返回清理后的文件名
+func (h *UploadHandler) checkDocumentUpload(fileName string, size int64) (string, error) {
+	// 检查文件大小
+	maxSizeMB := h.upload.Load().File.MaxSizeMB
+	if size > int64(maxSizeMB)<<20 {
+		return "", badUpload(fmt.Sprintf("File size too large, maximum %dMB", maxSizeMB))
+	}
+
+	// 检查文件名，拒绝浏览器会直接执行的扩展名（静态目录按扩展名返回Content-Type）
+	fileName = services.SanitizeFileName(fileName)
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if fileName == "" || utils.IsActiveContentExt(ext) {
+		return "", badUpload("Invalid file name or file extension")
+	}
+	return fileName, nil
+}
+
+// storeDocument 按文件内容校验文档类型后存储，返回上传响应
+// setState不为nil时在进入存储阶段时调用，用于分片上传会话报告处理进度
+func (h *UploadHandler) storeDocument(ctx context.Context, userID int64, file multipart.File, fileHeader *multipart.FileHeader, fileName string, setState func(state string)) (gin.H, error) {
+	// 按文件内容检测的MIME类型校验
+	mimeType, err := utils.ValidateDocumentFile(file, h.upload.Load().File.AllowedTypes)
+	if err != nil {
+		return nil, badUpload(err.Error())
+	}
+	// 以检测到的类型入库，不信任客户端声明的Content-Type
+	fileHeader.Header.Set("Content-Type", mimeType)
+
+	if setState != nil {
+		setState(services.UploadSessionStoring)
+	}
+
+	// 按上传的内容检查配额
+	release, err := h.reserveQuotaContext(ctx, userID, file, fileHeader.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用FileService上传文件（自动去重）
+	result, err := h.fileService.UploadFile(ctx, file, fileHeader, userID, "chat_file", "")
+	if err != nil {
+		release()
+		return nil, &uploadError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to upload file: %v", err)}
+	}
+
+	// 返回文件信息，发送文件消息时content为{"url": file_url, "name": file_name, "size": file_size}
+	response := gin.H{
+		"file_id":      result.FileStorage.ID,
+		"file_url":     services.PublicURL("/" + result.URL),
+		"file_name":    fileName,
+		"file_size":    result.FileStorage.FileSize,
+		"mime_type":    mimeType,
+		"message":      "File uploaded successfully",
+		"deduplicated": result.IsDedup,
+	}
+
+	if result.IsDedup {
+		response["message"] = "File uploaded successfully (deduplicated)"
+	}
+	return response, nil
+}
+
+// PrecheckRequest 秒传预检请求
+type PrecheckRequest struct {
+	Hash  string `json:"hash" binding:"required,len=64,hexadecimal"` // 文件内容的SHA256（小写十六进制）
+	Size  int64  `json:"size" binding:"required,min=1"`
+	Type  string `json:"type" binding:"required,oneof=image voice video file"`
+	Name  string `json:"name"`  // 原始文件名，type=file时用于文件消息
+	Proof string `json:"proof"` // 校验片段的SHA256，第一次请求时不传
+}
+
+// instantUploadExts 各类型允许秒传的存储扩展名，与对应上传接口一致；文档另按检测到的MIME类型校验
+var instantUploadExts = map[string][]string{
+	"image": {".jpg", ".jpeg", ".png", ".gif", ".webp"},
+	"voice": {".webm", ".mp4", ".m4a", ".mp3", ".ogg", ".wav", ".aac"},
+	"video": {".mp4", ".mov", ".m4v", ".webm"},
+}
+
+// Precheck 秒传预检：文件已存在时返回校验片段，客户端提交片段的SHA256后直接创建引用并返回URL，无需上传文件内容
+// 文件不存在（或不能秒传）时返回exists=false，客户端改用普通上传接口
+func (h *UploadHandler) Precheck(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+
+	var req PrecheckRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+	req.Hash = strings.ToLower(req.Hash)
+
+	// 大小上限与对应上传接口一致
+	maxSize := map[string]int64{
+		"image": 5 << 20,
+		"voice": 2 << 20,
+		"video": int64(h.upload.Load().Video.MaxSizeMB) << 20,
+		"file":  int64(h.upload.Load().File.MaxSizeMB) << 20,
+	}[req.Type]
+	if req.Size > maxSize {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, fmt.Sprintf("File size too large, maximum %dMB", maxSize>>20)))
+		return
+	}
+	fileName := services.SanitizeFileName(req.Name)
+	if req.Type == "file" && fileName == "" {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "File name is required"))
+		return
+	}
+
+	file, err := h.fileService.FindInstantUploadFile(c.Request.Context(), req.Hash, req.Size)
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	if file == nil || !h.instantUploadAllowed(req.Type, file) {
+		c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{"exists": false}))
+		return
+	}
+
+	challenge := services.NewPossessionChallenge(uploadSigningSecret(h.config), userID, file)
+	if req.Proof == "" {
+		c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{"exists": true, "challenge": challenge}))
+		return
+	}
+	valid, err := services.VerifyPossession(file, challenge, strings.ToLower(req.Proof))
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid proof"))
+		return
+	}
+
+	// 秒传不传输文件内容，只计入上传次数和重复上传次数
+	quota := h.quota.Load()
+	if err := quota.Reserve(c.Request.Context(), userID, req.Hash, 0); err != nil {
+		respondUploadQuotaExceeded(c, err)
+		return
+	}
+
+	refType := "chat_" + req.Type
+	if err := h.fileService.InstantUpload(c.Request.Context(), file, userID, refType); err != nil {
+		quota.Release(c.Request.Context(), userID, req.Hash, 0)
+		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, fmt.Sprintf("Failed to upload file: %v", err)))
+		return
+	}
+
+	fileURL := "/" + services.LocalStoragePath(file)
+	response := gin.H{
+		"exists":       true,
+		"file_id":      file.ID,
+		"file_url":     services.PublicURL(fileURL),
+		"file_size":    file.FileSize,
+		"mime_type":    file.MimeType,
+		"message":      "File uploaded successfully (deduplicated)",
+		"deduplicated": true,
+	}
+	if req.Type == "file" {
+		response["file_name"] = fileName
+	}
+	switch req.Type {
+	case "image":
+		response["thumbnails"] = services.MessageThumbnails(models.MessageTypeImage, fileURL)
+		if blurhash := services.ImageBlurhash(fileURL); blurhash != "" {
+			response["blurhash"] = blurhash
+		}
+	case "video":
+		response["thumbnails"] = services.MessageThumbnails(models.MessageTypeVideo, fileURL)
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(response))
+}
+
+// instantUploadAllowed 已存储的文件能否按请求的类型秒传，避免把文档当作图片等类型发送
+func (h *UploadHandler) instantUploadAllowed(fileType string, file *models.FileStorage) bool {
+	ext := strings.ToLower(filepath.Ext(services.LocalStoragePath(file)))
+	if fileType == "file" {
+		return !utils.IsActiveContentExt(ext) && slices.Contains(h.upload.Load().File.AllowedTypes, file.MimeType)
+	}
+	return slices.Contains(instantUploadExts[fileType], ext)
+}
+
+// reserveQuota 按文件内容的SHA256占用上传配额，超出配额时返回429并返回false
+// 返回的release在上传失败时归还配额
+func (h *UploadHandler) reserveQuota(c *gin.Context, userID int64, file multipart.File, size int64) (func(), bool) {
+	release, err := h.reserveQuotaContext(c.Request.Context(), userID, file, size)
+	if err != nil {
+		respondUploadError(c, err)
+		return nil, false
+	}
+	return release, true
+}
+
+// reserveQuotaContext 按文件内容的SHA256占用上传配额，超出配额时返回*services.UploadQuotaExceededError
+func (h *UploadHandler) reserveQuotaContext(ctx context.Context, userID int64, file multipart.File, size int64) (func(), error) {
+	quota := h.quota.Load()
+	if quota == nil {
+		return func() {}, nil
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	hash, err := h.fileService.CalculateFileHash(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, err
+	}
+
+	if err := quota.Reserve(ctx, userID, hash, size); err != nil {
+		return nil, err
+	}
+	return func() { quota.Release(ctx, userID, hash, size) }, nil
+}
+
+// uploadError 上传校验或处理失败，status为返回给客户端的HTTP状态码
+type uploadError struct {
+	status  int
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+// badUpload 文件不符合上传要求
+func badUpload(message string) error {
+	return &uploadError{status: http.StatusBadRequest, message: message}
+}
+
+// respondUploadError 按错误类型返回上传失败的响应
+func respondUploadError(c *gin.Context, err error) {
+	var uploadErr *uploadError
+	var exceeded *services.UploadQuotaExceededError
+	switch {
+	case errors.As(err, &uploadErr):
+		c.JSON(uploadErr.status, utils.ErrorResponse(uploadErr.status, uploadErr.message))
+	case errors.As(err, &exceeded):
+		respondUploadQuotaExceeded(c, err)
+	default:
+		utils.HandleInternalError(c, err)
+	}
+}
+
+// respondUploadQuotaExceeded 返回超出上传配额的错误，data中带有超出的配额类型、用量和可重试的秒数
+func respondUploadQuotaExceeded(c *gin.Context, err error) {
+	var exceeded *services.UploadQuotaExceededError
+	if !errors.As(err, &exceeded) {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	retryAfter := int(math.Ceil(exceeded.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, utils.FormatResponse(429, err.Error(), gin.H{
+		"limit":       exceeded.Limit,
+		"used":        exceeded.Used,
+		"max":         exceeded.Max,
+		"retry_after": retryAfter,
+	}))
+}
+
+// stripImageMetadata 按配置去除图片元数据，未开启、没有元数据或处理失败时返回原文件
+func stripImageMetadata(file multipart.File, filename string, cfg config.ImageUploadConfig) multipart.File {
+	if !cfg.StripMetadata {
+		return file
+	}
+	stripped, err := services.StripMetadata(file)
+	if err != nil {
+		logger.GetLogger().Warnf("去除图片元数据失败: file=%s, error=%v", filename, err)
+		return file
+	}
+	if stripped == nil {
+		return file
+	}
+	return stripped
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/cache"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+// uploadSessionLockTTL 处理分片上传会话的分布式锁过期时间，执行期间自动续期
+// 实例在处理中退出时锁过期，客户端再次调用complete即可重新处理
+const uploadSessionLockTTL = time.Minute
+
+// CreateUploadSessionRequest 创建分片上传会话请求
+type CreateUploadSessionRequest struct {
+	Type     string `json:"type" binding:"required,oneof=video file"`
+	FileName string `json:"file_name" binding:"required"`
+	Size     int64  `json:"size" binding:"required,gt=0"`
+}
+
+// CreateUploadSession 创建分片上传会话，文件大小和类型按对应的上传接口（/upload/video、/upload/file）检查
+func (h *UploadHandler) CreateUploadSession(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+
+	var req CreateUploadSessionRequest
+	if !utils.ValidateAndBindJSON(c, &req) {
+		return
+	}
+
+	fileName, err := h.checkUploadSessionFile(req.Type, req.FileName, req.Size)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	session, err := h.sessions.Load().Create(c.Request.Context(), userID, req.Type, fileName, req.Size)
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(session))
+}
+
+// checkUploadSessionFile 按文件类型检查文件名和大小，返回存储使用的文件名
+func (h *UploadHandler) checkUploadSessionFile(fileType, fileName string, size int64) (string, error) {
+	if fileType == "video" {
+		if _, err := h.checkVideoUpload(fileName, size); err != nil {
+			return "", err
+		}
+		return fileName, nil
+	}
+	return h.checkDocumentUpload(fileName, size)
+}
+
+// UploadPart 上传第n个分片（从1开始），请求体为分片的原始内容，重复上传同一分片时覆盖
+func (h *UploadHandler) UploadPart(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(c.Param("n"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid part number"))
+		return
+	}
+
+	sessions := h.sessions.Load()
+	ctx := c.Request.Context()
+	session, err := sessions.Get(ctx, userID, c.Param("id"))
+	if err != nil {
+		respondUploadSessionError(c, err)
+		return
+	}
+	if err := sessions.PutPart(ctx, session, n, c.Request.Body); err != nil {
+		respondUploadSessionError(c, err)
+		return
+	}
+
+	h.respondUploadSession(c, http.StatusOK, sessions, userID)
+}
+
+// GetUploadSession 查询分片上传会话的进度：已接收的分片和字节数、服务端处理状态，处理完成后返回上传结果
+// 客户端重启后据此跳过已上传的分片继续上传，或在处理中轮询直到completed/failed
+func (h *UploadHandler) GetUploadSession(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	h.respondUploadSession(c, http.StatusOK, h.sessions.Load(), userID)
+}
+
+// CompleteUploadSession 所有分片上传后开始处理，返回202，客户端通过GetUploadSession查询处理进度
+// 会话停留在处理状态（处理的实例已退出）时再次调用会重新处理；已结束的会话直接返回结果
+func (h *UploadHandler) CompleteUploadSession(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+
+	sessions := h.sessions.Load()
+	ctx := c.Request.Context()
+	session, err := sessions.Get(ctx, userID, c.Param("id"))
+	if err != nil {
+		respondUploadSessionError(c, err)
+		return
+	}
+
+	switch session.State {
+	case services.UploadSessionCompleted, services.UploadSessionFailed:
+		c.JSON(http.StatusOK, utils.SuccessResponse(session))
+		return
+	case services.UploadSessionUploading:
+		if err := sessions.Begin(ctx, session.ID); err != nil && !errors.Is(err, services.ErrUploadSessionClosed) {
+			respondUploadSessionError(c, err)
+			return
+		}
+	}
+
+	go h.processUploadSession(sessions, session)
+	h.respondUploadSession(c, http.StatusAccepted, sessions, userID)
+}
+
+// AbortUploadSession 取消分片上传会话并删除已上传的分片，处理中的会话不能取消
+func (h *UploadHandler) AbortUploadSession(c *gin.Context) {
+	userID, ok := utils.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+
+	sessions := h.sessions.Load()
+	ctx := c.Request.Context()
+	session, err := sessions.Get(ctx, userID, c.Param("id"))
+	if err != nil {
+		respondUploadSessionError(c, err)
+		return
+	}
+	switch session.State {
+	case services.UploadSessionScanning, services.UploadSessionStoring, services.UploadSessionThumbnailing:
+		c.JSON(http.StatusConflict, utils.ErrorResponse(409, "Upload session is being processed"))
+		return
+	}
+
+	if err := sessions.Abort(ctx, session.ID); err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{"message": "Upload session aborted"}))
+}
+
+// respondUploadSession 返回会话的最新状态
+func (h *UploadHandler) respondUploadSession(c *gin.Context, status int, sessions *services.UploadSessionService, userID int64) {
+	session, err := sessions.Get(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		respondUploadSessionError(c, err)
+		return
+	}
+	c.JSON(status, utils.SuccessResponse(session))
+}
+
+// processUploadSession 合并分片并按普通上传的流程校验和存储，结果写入会话
+// 通过分布式锁保证同一会话只由一个实例处理
+func (h *UploadHandler) processUploadSession(sessions *services.UploadSessionService, session *services.UploadSession) {
+	log := logger.GetLogger()
+	err := cache.WithLock(context.Background(), "upload_session:"+session.ID, uploadSessionLockTTL, func(ctx context.Context) error {
+		response, err := h.storeUploadSession(ctx, sessions, session)
+		if err == nil {
+			return sessions.Complete(ctx, session.ID, response)
+		}
+
+		// 校验失败和超出配额的原因返回给客户端，其他错误只记录日志
+		var uploadErr *uploadError
+		var exceeded *services.UploadQuotaExceededError
+		reason := "Failed to process uploaded file"
+		if errors.As(err, &uploadErr) || errors.As(err, &exceeded) {
+			reason = err.Error()
+		} else {
+			log.Errorf("处理分片上传失败: upload_id=%s, error=%v", session.ID, err)
+		}
+		return sessions.Fail(ctx, session.ID, reason)
+	})
+	if err != nil && err != cache.ErrLockNotAcquired {
+		log.Errorf("更新分片上传状态失败: upload_id=%s, error=%v", session.ID, err)
+	}
+}
+
+// storeUploadSession 合并分片后按文件类型存储，返回与普通上传接口相同的响应
+func (h *UploadHandler) storeUploadSession(ctx context.Context, sessions *services.UploadSessionService, session *services.UploadSession) (gin.H, error) {
+	setState := func(state string) {
+		if err := sessions.SetState(ctx, session.ID, state); err != nil {
+			logger.GetLogger().Warnf("更新分片上传状态失败: upload_id=%s, error=%v", session.ID, err)
+		}
+	}
+	setState(services.UploadSessionScanning)
+
+	// 创建会话后配置可能已变更，按当前限制重新检查
+	fileName, err := h.checkUploadSessionFile(session.Type, session.FileName, session.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := sessions.Assemble(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		file.Close()
+		os.Remove(file.Name())
+	}()
+
+	fileHeader := &multipart.FileHeader{Filename: fileName, Size: session.Size, Header: textproto.MIMEHeader{}}
+	if session.Type == "video" {
+		ext := strings.ToLower(filepath.Ext(fileName))
+		fileHeader.Header.Set("Content-Type", mime.TypeByExtension(ext))
+		return h.storeVideo(ctx, session.UserID, file, fileHeader, ext, setState)
+	}
+	return h.storeDocument(ctx, session.UserID, file, fileHeader, fileName, setState)
+}
+
+// respondUploadSessionError 返回分片上传会话操作失败的响应
+func respondUploadSessionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUploadSessionNotFound):
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, err.Error()))
+	case errors.Is(err, services.ErrUploadSessionClosed):
+		c.JSON(http.StatusConflict, utils.ErrorResponse(409, err.Error()))
+	case errors.Is(err, services.ErrUploadSessionIncomplete),
+		errors.Is(err, services.ErrUploadPartOutOfRange),
+		errors.Is(err, services.ErrUploadPartSize):
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, err.Error()))
+	default:
+		respondUploadError(c, err)
+	}
+}
@@ -1,28 +1,41 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"image"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 
 	"gochat/internal/config"
+	"gochat/internal/logger"
 	"gochat/internal/services"
 	"gochat/internal/utils"
 )
 
 type UserHandler struct {
+	config      *config.Config
+	image       atomic.Pointer[config.ImageUploadConfig] // 头像的图片处理配置，支持热加载
 	userService *services.UserService
 	fileService *services.FileService
 }
 
 func NewUserHandler(cfg *config.Config) *UserHandler {
-	return &UserHandler{
+	h := &UserHandler{
+		config:      cfg,
 		userService: services.NewUserService(cfg),
 		fileService: services.NewFileService(),
 	}
+	h.image.Store(&cfg.Upload.Image)
+	config.OnReload(func(next *config.Config) {
+		h.image.Store(&next.Upload.Image)
+	})
+	return h
 }
 
 // GetProfile 获取个人信息
@@ -33,13 +46,14 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	profile, err := h.userService.GetProfile(userID.(int64))
+	profile, err := h.userService.GetProfile(c.Request.Context(), userID.(int64))
 	if err != nil {
 		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, utils.SuccessResponse(profile))
+	// 客户端轮询个人信息，内容未变化时返回304
+	utils.JSONWithETag(c, profile)
 }
 
 // UpdateProfile 更新个人信息
@@ -56,11 +70,17 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	err := h.userService.UpdateProfile(userID.(int64), &req)
+	err := h.userService.UpdateProfile(c.Request.Context(), userID.(int64), &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, err.Error()))
 		return
 	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionUpdateProfile,
+		TargetType: services.AuditTargetUser,
+		TargetID:   userID.(int64),
+		Detail:     profileChanges(&req),
+	})
 
 	c.JSON(http.StatusOK, utils.SuccessResponse("Profile updated successfully"))
 }
@@ -115,19 +135,42 @@ func (h *UserHandler) UploadAvatar(c *gin.Context) {
 		return
 	}
 
+	// 去除元数据（GPS定位等）后上传
+	upload := stripImageMetadata(file, fileHeader.Filename, *h.image.Load())
+
+	// 按客户端选择的区域裁剪（可选）
+	cropRect, hasCrop, err := parseCropRect(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, err.Error()))
+		return
+	}
+	if hasCrop {
+		cropped, err := services.CropImage(upload, cropRect)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, fmt.Sprintf("Failed to crop avatar: %v", err)))
+			return
+		}
+		upload = cropped
+	}
+
 	// 使用FileService上传文件（统一存储目录，自动去重）
-	result, err := h.fileService.UploadFile(file, fileHeader, userID.(int64), "avatar", "")
+	result, err := h.fileService.UploadFile(c.Request.Context(), upload, fileHeader, userID.(int64), "avatar", "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, fmt.Sprintf("Failed to upload file: %v", err)))
 		return
 	}
 
+	// 生成列表等场景使用的标准尺寸头像，失败时回退原图，不影响上传结果
+	if err := h.fileService.GenerateAvatarVariants(result.FileStorage); err != nil {
+		logger.GetLogger().Warnf("生成头像尺寸图失败: path=%s, error=%v", result.URL, err)
+	}
+
 	// 获取旧头像信息，用于删除旧引用
-	user, err := h.userService.GetUserByID(userID.(int64))
+	user, err := h.userService.GetUserByID(c.Request.Context(), userID.(int64))
 	if err == nil && user.Avatar != "" && user.Avatar != "default.png" {
 		// 尝试从旧文件系统查找并删除引用
 		// 注意：旧文件可能不在新系统中，这是正常的
-		h.fileService.DeleteReference(0, userID.(int64), "avatar")
+		h.fileService.DeleteReference(c.Request.Context(), 0, userID.(int64), "avatar")
 	}
 
 	// 更新用户头像（存储完整路径）
@@ -135,17 +178,24 @@ func (h *UserHandler) UploadAvatar(c *gin.Context) {
 		Avatar: result.URL, // 存储完整路径而不是仅文件名
 	}
 
-	err = h.userService.UpdateProfile(userID.(int64), req)
+	err = h.userService.UpdateProfile(c.Request.Context(), userID.(int64), req)
 	if err != nil {
 		// 如果数据库更新失败，删除文件引用
-		h.fileService.DeleteReference(result.FileStorage.ID, userID.(int64), "avatar")
+		h.fileService.DeleteReference(c.Request.Context(), result.FileStorage.ID, userID.(int64), "avatar")
 		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, err.Error()))
 		return
 	}
+	recordAudit(c, &services.AuditEntry{
+		Action:     services.AuditActionUpdateAvatar,
+		TargetType: services.AuditTargetUser,
+		TargetID:   userID.(int64),
+		Detail:     map[string]interface{}{"avatar": result.URL},
+	})
 
 	// 返回统一文件路径和去重信息
 	response := map[string]interface{}{
-		"avatar_url":   "/" + result.URL,
+		"avatar_url":   services.PublicURL("/" + result.URL),
+		"avatars":      services.AvatarURLs("/" + result.URL),
 		"message":      "Avatar uploaded successfully",
 		"deduplicated": result.IsDedup,
 		"storage_path": result.URL, // 添加完整路径信息
@@ -157,3 +207,103 @@ func (h *UserHandler) UploadAvatar(c *gin.Context) {
 
 	c.JSON(http.StatusOK, utils.SuccessResponse(response))
 }
+
+// profileChanges 资料修改的审计内容，只记录请求中出现的字段
+func profileChanges(req *services.UpdateProfileRequest) map[string]interface{} {
+	changes := make(map[string]interface{})
+	if req.Nickname != "" {
+		changes["nickname"] = req.Nickname
+	}
+	if req.Avatar != "" {
+		changes["avatar"] = req.Avatar
+	}
+	if req.Gender != nil {
+		changes["gender"] = *req.Gender
+	}
+	if req.Signature != "" {
+		changes["signature"] = req.Signature
+	}
+	if req.Email != nil {
+		changes["email"] = *req.Email
+	}
+	if req.EmailSecurityAlerts != nil {
+		changes["email_security_alerts"] = *req.EmailSecurityAlerts
+	}
+	if req.EmailDigest != nil {
+		changes["email_digest"] = *req.EmailDigest
+	}
+	if req.UnarchiveOnMessage != nil {
+		changes["unarchive_on_message"] = *req.UnarchiveOnMessage
+	}
+	return changes
+}
+
+// GetAvatar 按尺寸获取用户头像，size为期望的边长（像素），返回不小于该尺寸的标准尺寸头像，不传时返回原图
+func (h *UserHandler) GetAvatar(c *gin.Context) {
+	targetID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || targetID <= 0 {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid user ID"))
+		return
+	}
+
+	size := 0
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil || size <= 0 {
+			c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid size"))
+			return
+		}
+	}
+
+	user, err := h.userService.GetUserByID(c.Request.Context(), targetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "User not found"))
+		return
+	}
+	path, ok := services.AvatarPath(user.Avatar, size)
+	if !ok {
+		// 默认头像由前端自行展示
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "Avatar not found"))
+		return
+	}
+	// 只公开该用户上传的头像，其他文件按文件下载接口校验权限
+	owned, err := h.fileService.OwnsAvatar(c.Request.Context(), targetID, user.Avatar)
+	if err != nil {
+		utils.HandleInternalError(c, err)
+		return
+	}
+	if !owned {
+		c.JSON(http.StatusNotFound, utils.ErrorResponse(404, "Avatar not found"))
+		return
+	}
+
+	// 头像可能随时更换，只允许短时间缓存
+	c.Header("Cache-Control", "private, max-age=300")
+	c.File(path)
+}
+
+// parseCropRect 解析头像裁剪区域（crop_x、crop_y、crop_w、crop_h，单位像素），四个参数都不传时不裁剪
+func parseCropRect(c *gin.Context) (image.Rectangle, bool, error) {
+	keys := []string{"crop_x", "crop_y", "crop_w", "crop_h"}
+	values := make([]int, len(keys))
+	provided := 0
+	for i, key := range keys {
+		raw := c.PostForm(key)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			return image.Rectangle{}, false, fmt.Errorf("invalid %s", key)
+		}
+		values[i] = v
+		provided++
+	}
+	if provided == 0 {
+		return image.Rectangle{}, false, nil
+	}
+	if provided != len(keys) || values[2] == 0 || values[3] == 0 {
+		return image.Rectangle{}, false, errors.New("crop_x, crop_y, crop_w and crop_h must all be provided with a non-zero size")
+	}
+	return image.Rect(values[0], values[1], values[0]+values[2], values[1]+values[3]), true, nil
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/buildinfo"
+	"gochat/internal/websocket"
+)
+
+// GetVersion 返回构建信息和服务端支持的最新WebSocket协议版本，客户端可据此判断功能是否可用
+func GetVersion(c *gin.Context) {
+	info := buildinfo.Get()
+	c.JSON(http.StatusOK, gin.H{
+		"version":            info.Version,
+		"commit":             info.Commit,
+		"build_time":         info.BuildTime,
+		"modified":           info.Modified,
+		"go_version":         info.GoVersion,
+		"websocket_protocol": websocket.CurrentProtocolVersion,
+	})
+}
@@ -0,0 +1,181 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"gochat/internal/metrics"
+)
+
+// 整体状态
+const (
+	StatusOK          = "ok"          // 所有依赖正常
+	StatusDegraded    = "degraded"    // 非关键依赖异常，服务降级运行
+	StatusUnavailable = "unavailable" // 关键依赖异常，无法正常提供服务
+)
+
+// 单个依赖的检查结果
+const (
+	CheckUp   = "up"
+	CheckDown = "down"
+)
+
+// checkUp 各依赖最近一次检查是否正常: 1-正常 0-异常
+var checkUp = metrics.NewGaugeVec("health_check_up", "健康检查中各依赖是否正常: 1-正常 0-异常", "check")
+
+// CheckFunc 检查依赖是否可用，ctx带有检查超时
+type CheckFunc func(ctx context.Context) error
+
+// Check 一项依赖检查
+type Check struct {
+	Name     string
+	Critical bool // 关键依赖失败时整体状态为unavailable，否则为degraded
+	Run      CheckFunc
+}
+
+// CheckResult 单个依赖的检查结果
+type CheckResult struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report 一次健康检查的结果
+type Report struct {
+	Status    string                 `json:"status"`
+	Checks    map[string]CheckResult `json:"checks"`
+	CheckedAt time.Time              `json:"checked_at"`
+}
+
+// Checker 并发执行各项依赖检查，结果缓存cacheTTL，负载均衡频繁探测时不会反复访问依赖
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	cached *Report
+}
+
+// NewChecker 创建健康检查
+func NewChecker(timeout, cacheTTL time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout, cacheTTL: cacheTTL, now: time.Now}
+}
+
+// Run 执行所有检查，缓存有效时直接返回缓存的结果
+// 同时到达的请求等待同一次检查完成，每项检查最多耗时timeout
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached != nil && c.now().Sub(c.cached.CheckedAt) < c.cacheTTL {
+		return *c.cached
+	}
+
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.runCheck(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks)), CheckedAt: c.now()}
+	for i, check := range c.checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		if result.Status == CheckUp {
+			checkUp.WithLabelValues(check.Name).Set(1)
+			continue
+		}
+		checkUp.WithLabelValues(check.Name).Set(0)
+		if check.Critical {
+			report.Status = StatusUnavailable
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	c.cached = &report
+	return report
+}
+
+// runCheck 执行单项检查，检查函数不响应ctx（如挂起的网络文件系统）时也按超时返回
+func (c *Checker) runCheck(ctx context.Context, check Check) CheckResult {
+	// 请求方断开时也完成检查，避免把取消误记为依赖失败并缓存
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{
+		Status:    CheckUp,
+		Critical:  check.Critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = CheckDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Database 检查数据库连接（Ping主库）
+func Database(db *gorm.DB) CheckFunc {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// Redis 检查Redis连接（PING）
+func Redis(client *redis.Client) CheckFunc {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+// WritableDir 检查目录是否可写：创建并删除一个临时文件，目录不存在时与保存上传文件时一样先创建
+func WritableDir(dir string) CheckFunc {
+	return func(ctx context.Context) error {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("directory not writable: %w", err)
+		}
+		f, err := os.CreateTemp(dir, ".health-*")
+		if err != nil {
+			return fmt.Errorf("directory not writable: %w", err)
+		}
+		name := f.Name()
+		_, err = f.Write([]byte("ok"))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if removeErr := os.Remove(name); err == nil {
+			err = removeErr
+		}
+		return err
+	}
+}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ok(ctx context.Context) error { return nil }
+
+func fail(ctx context.Context) error { return errors.New("connection refused") }
+
+func TestCheckerStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		database CheckFunc
+		redis    CheckFunc
+		want     string
+	}{
+		{"all up", ok, ok, StatusOK},
+		{"non-critical down", ok, fail, StatusDegraded},
+		{"critical down", fail, ok, StatusUnavailable},
+		{"both down", fail, fail, StatusUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(time.Second, 0,
+				Check{Name: "database", Critical: true, Run: tt.database},
+				Check{Name: "redis", Run: tt.redis},
+			)
+			report := checker.Run(context.Background())
+			assert.Equal(t, tt.want, report.Status)
+			require.Len(t, report.Checks, 2)
+			assert.True(t, report.Checks["database"].Critical)
+			assert.False(t, report.Checks["redis"].Critical)
+			if report.Checks["redis"].Status == CheckDown {
+				assert.Equal(t, "connection refused", report.Checks["redis"].Error)
+			} else {
+				assert.Empty(t, report.Checks["redis"].Error)
+			}
+		})
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	// 不响应ctx的检查也按超时返回
+	block := make(chan struct{})
+	defer close(block)
+	checker := NewChecker(50*time.Millisecond, 0,
+		Check{Name: "uploads", Run: func(ctx context.Context) error { <-block; return nil }},
+	)
+
+	start := time.Now()
+	report := checker.Run(context.Background())
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, CheckDown, report.Checks["uploads"].Status)
+	assert.Contains(t, report.Checks["uploads"].Error, "deadline exceeded")
+	assert.GreaterOrEqual(t, report.Checks["uploads"].LatencyMs, 50.0)
+}
+
+func TestCheckerCachesResults(t *testing.T) {
+	var calls int32
+	checker := NewChecker(time.Second, 5*time.Second,
+		Check{Name: "database", Critical: true, Run: func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		}},
+	)
+	current := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	checker.now = func() time.Time { return current }
+
+	checker.Run(context.Background())
+	checker.Run(context.Background())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	current = current.Add(5 * time.Second)
+	checker.Run(context.Background())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestCheckerIgnoresCallerCancellation(t *testing.T) {
+	// 请求方已断开时检查照常完成，不会把取消缓存为依赖失败
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checker := NewChecker(time.Second, time.Minute, Check{Name: "database", Critical: true, Run: func(ctx context.Context) error {
+		return ctx.Err()
+	}})
+
+	assert.Equal(t, StatusOK, checker.Run(ctx).Status)
+}
+
+func TestRedisCheck(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	assert.NoError(t, Redis(client)(context.Background()))
+	mr.Close()
+	assert.Error(t, Redis(client)(context.Background()))
+}
+
+func TestWritableDirCheck(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "uploads", "files")
+	require.NoError(t, WritableDir(dir)(context.Background()))
+
+	// 目录已创建，临时文件已删除
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// 路径被普通文件占用时失败
+	file := filepath.Join(t.TempDir(), "uploads")
+	require.NoError(t, os.WriteFile(file, []byte("x"), 0644))
+	assert.Error(t, WritableDir(filepath.Join(file, "files"))(context.Background()))
+}
@@ -0,0 +1,45 @@
+package health
+
+import "sync/atomic"
+
+// 就绪状态：启动阶段完成的步骤和关闭时的排空，由main在对应阶段设置
+var (
+	migrated atomic.Bool
+	warmedUp atomic.Bool
+	draining atomic.Bool
+)
+
+// SetMigrated 数据库迁移已完成
+func SetMigrated() {
+	migrated.Store(true)
+}
+
+// SetWarmedUp 缓存预热已完成（未启用预热时启动后直接设置）
+func SetWarmedUp() {
+	warmedUp.Store(true)
+}
+
+// SetDraining 开始关闭，之后/readyz返回503，负载均衡不再转发新请求
+func SetDraining() {
+	draining.Store(true)
+}
+
+// IsDraining 是否正在关闭
+func IsDraining() bool {
+	return draining.Load()
+}
+
+// PendingReasons 尚未满足的就绪条件，全部满足时返回空
+func PendingReasons() []string {
+	var reasons []string
+	if draining.Load() {
+		reasons = append(reasons, "draining")
+	}
+	if !migrated.Load() {
+		reasons = append(reasons, "database_not_migrated")
+	}
+	if !warmedUp.Load() {
+		reasons = append(reasons, "cache_warming_up")
+	}
+	return reasons
+}
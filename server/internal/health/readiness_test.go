@@ -0,0 +1,35 @@
+package health
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resetReadiness(t *testing.T) {
+	t.Helper()
+	migrated.Store(false)
+	warmedUp.Store(false)
+	draining.Store(false)
+	t.Cleanup(func() {
+		migrated.Store(false)
+		warmedUp.Store(false)
+		draining.Store(false)
+	})
+}
+
+func TestPendingReasons(t *testing.T) {
+	resetReadiness(t)
+	assert.Equal(t, []string{"database_not_migrated", "cache_warming_up"}, PendingReasons())
+
+	SetMigrated()
+	assert.Equal(t, []string{"cache_warming_up"}, PendingReasons())
+
+	SetWarmedUp()
+	assert.Empty(t, PendingReasons())
+	assert.False(t, IsDraining())
+
+	SetDraining()
+	assert.True(t, IsDraining())
+	assert.Equal(t, []string{"draining"}, PendingReasons())
+}
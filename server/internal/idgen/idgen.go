@@ -0,0 +1,97 @@
+package idgen
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ID布局（共53位，不超过JavaScript的Number.MAX_SAFE_INTEGER，前端解析JSON不丢精度）：
+// 41位毫秒时间戳（相对Epoch，约69年） | 5位节点号 | 7位毫秒内序号
+const (
+	nodeBits     = 5
+	sequenceBits = 7
+
+	// MaxNodeID 节点号上限，每个服务实例需要配置不同的节点号
+	MaxNodeID = 1<<nodeBits - 1
+	// CommandNodeID 种子数据、gochatctl等一次性命令使用的节点号，保留给命令使用，不分配给服务实例
+	CommandNodeID = MaxNodeID
+
+	maxSequence = 1<<sequenceBits - 1
+	timeShift   = nodeBits + sequenceBits
+)
+
+// Epoch 时间戳起点
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Generator 按时间递增的分布式ID生成器，不同节点号的实例之间无需协调
+type Generator struct {
+	mu       sync.Mutex
+	node     int64
+	lastTime int64 // 上次分配使用的毫秒时间戳（相对Epoch）
+	sequence int64
+	now      func() time.Time
+}
+
+// New 创建指定节点号的生成器
+func New(node int64) (*Generator, error) {
+	if node < 0 || node > MaxNodeID {
+		return nil, fmt.Errorf("node id must be between 0 and %d, got %d", MaxNodeID, node)
+	}
+	return &Generator{node: node, now: time.Now}, nil
+}
+
+// Next 生成下一个ID，同一生成器产生的ID严格递增
+// 时钟回拨或同一毫秒内序号用完时沿用/借用后续的时间戳，不阻塞等待
+func (g *Generator) Next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now().Sub(Epoch).Milliseconds()
+	if now > g.lastTime {
+		g.lastTime = now
+		g.sequence = 0
+	} else {
+		g.sequence++
+		if g.sequence > maxSequence {
+			g.lastTime++
+			g.sequence = 0
+		}
+	}
+	return g.lastTime<<timeShift | g.node<<sequenceBits | g.sequence
+}
+
+// Time 返回ID中的时间戳
+func Time(id int64) time.Time {
+	return Epoch.Add(time.Duration(id>>timeShift) * time.Millisecond)
+}
+
+// Node 返回ID中的节点号
+func Node(id int64) int64 {
+	return id >> sequenceBits & MaxNodeID
+}
+
+var (
+	defaultMu           sync.RWMutex
+	defaultGenerator, _ = New(0)
+)
+
+// Init 设置默认生成器的节点号，需要在写入消息前调用
+func Init(node int64) error {
+	g, err := New(node)
+	if err != nil {
+		return err
+	}
+	defaultMu.Lock()
+	defaultGenerator = g
+	defaultMu.Unlock()
+	return nil
+}
+
+// NextID 使用默认生成器生成ID
+func NextID() int64 {
+	defaultMu.RLock()
+	g := defaultGenerator
+	defaultMu.RUnlock()
+	return g.Next()
+}
@@ -0,0 +1,40 @@
+package idgen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextIsMonotonic(t *testing.T) {
+	g, err := New(3)
+	require.NoError(t, err)
+
+	current := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return current }
+
+	var last int64
+	// 超过单毫秒序号上限，以及时钟回拨，都不能产生重复或更小的ID
+	for i := 0; i < 3*(maxSequence+1); i++ {
+		id := g.Next()
+		assert.Greater(t, id, last)
+		assert.Equal(t, int64(3), Node(id))
+		last = id
+	}
+	current = current.Add(-time.Second)
+	assert.Greater(t, g.Next(), last)
+
+	current = current.Add(time.Hour)
+	id := g.Next()
+	assert.Equal(t, current, Time(id))
+	assert.Less(t, id, int64(1)<<53, "ID必须能被JavaScript精确表示")
+}
+
+func TestNewRejectsInvalidNode(t *testing.T) {
+	_, err := New(-1)
+	assert.Error(t, err)
+	_, err = New(MaxNodeID + 1)
+	assert.Error(t, err)
+}
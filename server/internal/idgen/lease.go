@@ -0,0 +1,123 @@
+package idgen
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 未配置节点号的实例从Redis租用空闲的节点号，避免多个实例都使用默认节点号生成重复的ID
+const (
+	nodeLeasePrefix = "idgen:node:" // idgen:node:3 节点号3的租约，值为持有者令牌
+
+	// DefaultLeaseTTL 节点号租约的有效期，持有期间每1/3有效期续期一次
+	DefaultLeaseTTL = time.Minute
+)
+
+var (
+	// ErrNoFreeNode 所有节点号都已被其他实例租用
+	ErrNoFreeNode = errors.New("idgen: no free node id")
+	// ErrLeaseLost 租约已过期并被其他实例租用
+	ErrLeaseLost = errors.New("idgen: node id lease taken by another instance")
+)
+
+var renewLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// NodeLease 从Redis租用的节点号
+type NodeLease struct {
+	client *redis.Client
+	node   int64
+	token  string
+	ttl    time.Duration
+}
+
+// LeaseNode 按节点号从小到大租用第一个空闲的节点号（SET NX + 过期时间），不分配CommandNodeID
+func LeaseNode(ctx context.Context, client *redis.Client, ttl time.Duration) (*NodeLease, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	lease := &NodeLease{client: client, token: hex.EncodeToString(buf), ttl: ttl}
+
+	for node := int64(0); node < CommandNodeID; node++ {
+		ok, err := client.SetNX(ctx, leaseKey(node), lease.token, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			lease.node = node
+			return lease, nil
+		}
+	}
+	return nil, ErrNoFreeNode
+}
+
+func leaseKey(node int64) string {
+	return nodeLeasePrefix + strconv.FormatInt(node, 10)
+}
+
+// Node 租用的节点号
+func (l *NodeLease) Node() int64 {
+	return l.node
+}
+
+// Renew 续期租约；租约已过期但节点号仍空闲时重新租用，已被其他实例租用时返回ErrLeaseLost
+func (l *NodeLease) Renew(ctx context.Context) error {
+	key := leaseKey(l.node)
+	n, err := renewLeaseScript.Run(ctx, l.client, []string{key}, l.token, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 1 {
+		return nil
+	}
+
+	ok, err := l.client.SetNX(ctx, key, l.token, l.ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// KeepAlive 每1/3有效期续期一次，直到ctx取消；租约被其他实例租用时调用onLost后退出
+// Redis暂时不可用时继续重试，只要在有效期内恢复就不会丢失租约
+func (l *NodeLease) KeepAlive(ctx context.Context, onLost func(err error)) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Renew(ctx); errors.Is(err, ErrLeaseLost) {
+				onLost(err)
+				return
+			}
+		}
+	}
+}
+
+// Release 释放租约，实例退出后节点号可立即被其他实例租用
+func (l *NodeLease) Release(ctx context.Context) error {
+	return releaseLeaseScript.Run(ctx, l.client, []string{leaseKey(l.node)}, l.token).Err()
+}
@@ -0,0 +1,72 @@
+package idgen
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestLeaseNodeAllocatesDistinctNodes(t *testing.T) {
+	_, client := newTestRedis(t)
+	ctx := context.Background()
+
+	a, err := LeaseNode(ctx, client, time.Minute)
+	require.NoError(t, err)
+	b, err := LeaseNode(ctx, client, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), a.Node())
+	assert.Equal(t, int64(1), b.Node())
+
+	// 释放后节点号可以被其他实例租用
+	require.NoError(t, a.Release(ctx))
+	c, err := LeaseNode(ctx, client, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), c.Node())
+}
+
+func TestLeaseNodeExhausted(t *testing.T) {
+	_, client := newTestRedis(t)
+	ctx := context.Background()
+
+	for i := 0; i < CommandNodeID; i++ {
+		lease, err := LeaseNode(ctx, client, time.Minute)
+		require.NoError(t, err)
+		assert.NotEqual(t, int64(CommandNodeID), lease.Node())
+	}
+	_, err := LeaseNode(ctx, client, time.Minute)
+	assert.ErrorIs(t, err, ErrNoFreeNode)
+}
+
+func TestNodeLeaseRenew(t *testing.T) {
+	mr, client := newTestRedis(t)
+	ctx := context.Background()
+
+	lease, err := LeaseNode(ctx, client, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, lease.Renew(ctx))
+
+	// 租约过期但节点号仍空闲时重新租用
+	mr.FastForward(2 * time.Minute)
+	require.NoError(t, lease.Renew(ctx))
+	assert.Equal(t, int64(0), lease.Node())
+
+	// 过期后被其他实例租用
+	mr.FastForward(2 * time.Minute)
+	other, err := LeaseNode(ctx, client, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), other.Node())
+	assert.ErrorIs(t, lease.Renew(ctx), ErrLeaseLost)
+}
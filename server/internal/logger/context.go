@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID 把请求ID放入上下文，后续的日志（如慢查询）据此关联到同一请求
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// NewRequestID 生成16字节随机十六进制请求ID，HTTP请求由中间件生成，WebSocket消息等没有HTTP请求的操作自行生成
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestIDFrom 从上下文中取出请求ID，不存在时返回空字符串
+func RequestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// WithContext 返回带有上下文中请求ID字段的日志条目
+func WithContext(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(GetLogger())
+	if requestID := RequestIDFrom(ctx); requestID != "" {
+		entry = entry.WithField("request_id", requestID)
+	}
+	return entry
+}
@@ -66,6 +66,16 @@ func Init(logDir string, logLevel string, output string) error {
 	return nil
 }
 
+// SetLevel 修改日志级别（配置热加载时调用）
+func SetLevel(logLevel string) error {
+	level, err := logrus.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	GetLogger().SetLevel(level)
+	return nil
+}
+
 // GetLogger 获取日志实例
 func GetLogger() *logrus.Logger {
 	if Log == nil {
@@ -0,0 +1,157 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gochat/internal/config"
+)
+
+// ErrSTARTTLSUnsupported 配置为starttls但服务器不支持
+var ErrSTARTTLSUnsupported = errors.New("mailer: server does not support STARTTLS")
+
+// Message 纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// SMTP 通过SMTP发送邮件，每封邮件使用单独的连接
+type SMTP struct {
+	addr      string
+	host      string
+	username  string
+	password  string
+	tlsMode   string
+	timeout   time.Duration
+	from      *mail.Address
+	tlsConfig *tls.Config
+	now       func() time.Time
+}
+
+// New 创建SMTP发送器，配置已在加载时校验
+func New(cfg *config.SMTPConfig, from string) (*SMTP, error) {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: invalid from address: %w", err)
+	}
+	timeout, _ := time.ParseDuration(cfg.Timeout)
+	return &SMTP{
+		addr:      net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		host:      cfg.Host,
+		username:  cfg.Username,
+		password:  cfg.Password,
+		tlsMode:   cfg.TLS,
+		timeout:   timeout,
+		from:      address,
+		tlsConfig: &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12},
+		now:       time.Now,
+	}, nil
+}
+
+// Send 发送邮件，超时时间取ctx的截止时间和配置的timeout中较早的一个
+func (s *SMTP) Send(ctx context.Context, msg *Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid recipient: %w", err)
+	}
+	data, err := s.build(to, msg)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+	if s.tlsMode == "tls" {
+		conn = tls.Client(conn, s.tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.tlsMode == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrSTARTTLSUnsupported
+		}
+		if err := client.StartTLS(s.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// build 生成邮件内容：UTF-8纯文本，正文按base64编码
+func (s *SMTP) build(to *mail.Address, msg *Message) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := s.from.Address[strings.LastIndex(s.from.Address, "@")+1:]
+	// 主题中的换行会被当作新的邮件头，替换为空格
+	subject := strings.Join(strings.Fields(msg.Subject), " ")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", s.now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,145 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+// fakeSMTP 只实现发送一封邮件需要的命令，记录收到的命令和邮件内容
+type fakeSMTP struct {
+	listener net.Listener
+	commands chan string
+	data     chan string
+}
+
+func newFakeSMTP(t *testing.T, extensions ...string) *fakeSMTP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	f := &fakeSMTP{listener: listener, commands: make(chan string, 20), data: make(chan string, 1)}
+	go f.serve(extensions)
+	return f
+}
+
+func (f *fakeSMTP) serve(extensions []string) {
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		f.commands <- line
+		switch verb := strings.ToUpper(strings.Fields(line)[0]); verb {
+		case "EHLO":
+			reply("250-fake")
+			for _, ext := range extensions {
+				reply("250-" + ext)
+			}
+			reply("250 8BITMIME")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			f.data <- data.String()
+			reply("250 queued")
+		case "AUTH":
+			reply("235 authenticated")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func newTestSMTP(t *testing.T, f *fakeSMTP, cfg config.SMTPConfig) *SMTP {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(f.listener.Addr().String())
+	cfg.Host = host
+	cfg.Port, _ = strconv.Atoi(port)
+	cfg.Timeout = "5s"
+	s, err := New(&cfg, "GoChat <no-reply@example.com>")
+	require.NoError(t, err)
+	s.now = func() time.Time { return time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC) }
+	return s
+}
+
+func TestSendPlainWithAuth(t *testing.T) {
+	f := newFakeSMTP(t, "AUTH PLAIN")
+	s := newTestSMTP(t, f, config.SMTPConfig{TLS: "none", Username: "mailer", Password: "secret"})
+
+	err := s.Send(context.Background(), &Message{To: "alice@example.com", Subject: "新设备登录\r\nBcc: evil@example.com", Body: "您好，\n您的账号在新设备上登录。"})
+	require.NoError(t, err)
+
+	var commands []string
+	for len(f.commands) > 0 {
+		commands = append(commands, <-f.commands)
+	}
+	assert.Contains(t, commands, "AUTH PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00mailer\x00secret")))
+	assert.Contains(t, commands, "MAIL FROM:<no-reply@example.com> BODY=8BITMIME")
+	assert.Contains(t, commands, "RCPT TO:<alice@example.com>")
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-f.data))
+	require.NoError(t, err)
+	decoded, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "新设备登录 Bcc: evil@example.com", decoded)
+	assert.Empty(t, msg.Header.Get("Bcc"))
+	assert.Equal(t, `"GoChat" <no-reply@example.com>`, msg.Header.Get("From"))
+	assert.Equal(t, "Thu, 01 Oct 2026 08:00:00 +0000", msg.Header.Get("Date"))
+	assert.True(t, strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>"))
+
+	raw, err := io.ReadAll(msg.Body)
+	require.NoError(t, err)
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+	require.NoError(t, err)
+	assert.Equal(t, "您好，\n您的账号在新设备上登录。", string(body))
+}
+
+func TestSendRequiresSTARTTLS(t *testing.T) {
+	f := newFakeSMTP(t)
+	s := newTestSMTP(t, f, config.SMTPConfig{TLS: "starttls"})
+
+	err := s.Send(context.Background(), &Message{To: "alice@example.com", Subject: "hi", Body: "hi"})
+	assert.ErrorIs(t, err, ErrSTARTTLSUnsupported)
+}
+
+func TestSendRejectsInvalidRecipient(t *testing.T) {
+	s, err := New(&config.SMTPConfig{Host: "127.0.0.1", Port: 25, TLS: "none", Timeout: "1s"}, "no-reply@example.com")
+	require.NoError(t, err)
+	assert.Error(t, s.Send(context.Background(), &Message{To: "not an address", Subject: "hi", Body: "hi"}))
+}
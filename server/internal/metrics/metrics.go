@@ -0,0 +1,484 @@
+// Package metrics 进程内指标注册表（计数器、仪表、直方图、速率）
+// 默认注册表通过 /debug/metrics（JSON快照，handlers.GetMetrics）和 metrics.path（Prometheus文本格式，handlers.GetPrometheusMetrics）导出
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metric 指标的通用接口
+type Metric interface {
+	// Name 指标名称
+	Name() string
+	// Help 指标说明
+	Help() string
+	// Snapshot 指标当前值的快照，用于导出
+	Snapshot() interface{}
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mutex   sync.RWMutex
+	metrics map[string]Metric
+}
+
+// NewRegistry 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]Metric)}
+}
+
+// defaultRegistry 默认注册表，包级构造函数创建的指标都注册在这里
+var defaultRegistry = NewRegistry()
+
+// Default 获取默认注册表
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register 注册指标，同名指标已存在时返回已注册的指标
+func (r *Registry) Register(m Metric) Metric {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if existing, ok := r.metrics[m.Name()]; ok {
+		return existing
+	}
+	r.metrics[m.Name()] = m
+	return m
+}
+
+// Metrics 按名称排序返回所有已注册的指标
+func (r *Registry) Metrics() []Metric {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	list := make([]Metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+// Snapshot 获取所有指标当前值
+func (r *Registry) Snapshot() map[string]interface{} {
+	snapshot := make(map[string]interface{})
+	for _, m := range r.Metrics() {
+		snapshot[m.Name()] = m.Snapshot()
+	}
+	return snapshot
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	name  string
+	help  string
+	value int64
+}
+
+// NewCounter 创建计数器并注册到默认注册表
+func NewCounter(name, help string) *Counter {
+	return defaultRegistry.Register(&Counter{name: name, help: help}).(*Counter)
+}
+
+func (c *Counter) Name() string { return c.name }
+func (c *Counter) Help() string { return c.help }
+
+// Inc 计数加1
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.value, 1)
+}
+
+// Add 计数增加n（n为负数时忽略）
+func (c *Counter) Add(n int64) {
+	if n > 0 {
+		atomic.AddInt64(&c.value, n)
+	}
+}
+
+// Value 当前计数
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+func (c *Counter) Snapshot() interface{} {
+	return c.Value()
+}
+
+// Gauge 可增可减的瞬时值
+type Gauge struct {
+	name  string
+	help  string
+	value int64
+}
+
+// NewGauge 创建瞬时值指标并注册到默认注册表
+func NewGauge(name, help string) *Gauge {
+	return defaultRegistry.Register(&Gauge{name: name, help: help}).(*Gauge)
+}
+
+func (g *Gauge) Name() string { return g.name }
+func (g *Gauge) Help() string { return g.help }
+
+// Set 设置当前值
+func (g *Gauge) Set(v int64) {
+	atomic.StoreInt64(&g.value, v)
+}
+
+// Inc 当前值加1
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.value, 1)
+}
+
+// Dec 当前值减1
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.value, -1)
+}
+
+// Add 当前值增加n
+func (g *Gauge) Add(n int64) {
+	atomic.AddInt64(&g.value, n)
+}
+
+// Value 当前值
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+func (g *Gauge) Snapshot() interface{} {
+	return g.Value()
+}
+
+// Meter 带一分钟滑动窗口的计数器，用于统计每分钟发生次数
+type Meter struct {
+	name  string
+	help  string
+	total int64
+
+	mutex   sync.Mutex
+	buckets [60]int64 // 每秒一个桶
+	stamps  [60]int64 // 桶对应的Unix秒，用于判断桶是否过期
+	now     func() time.Time
+}
+
+// MeterSnapshot Meter的快照
+type MeterSnapshot struct {
+	Total     int64 `json:"total"`
+	PerMinute int64 `json:"per_minute"`
+}
+
+// NewMeter 创建滑动窗口计数器并注册到默认注册表
+func NewMeter(name, help string) *Meter {
+	return defaultRegistry.Register(newMeter(name, help, time.Now)).(*Meter)
+}
+
+func newMeter(name, help string, now func() time.Time) *Meter {
+	return &Meter{name: name, help: help, now: now}
+}
+
+func (m *Meter) Name() string { return m.name }
+func (m *Meter) Help() string { return m.help }
+
+// Mark 记录一次事件
+func (m *Meter) Mark() {
+	atomic.AddInt64(&m.total, 1)
+
+	sec := m.now().Unix()
+	idx := sec % 60
+
+	m.mutex.Lock()
+	if m.stamps[idx] != sec {
+		m.stamps[idx] = sec
+		m.buckets[idx] = 0
+	}
+	m.buckets[idx]++
+	m.mutex.Unlock()
+}
+
+// Total 累计事件数
+func (m *Meter) Total() int64 {
+	return atomic.LoadInt64(&m.total)
+}
+
+// PerMinute 最近一分钟的事件数
+func (m *Meter) PerMinute() int64 {
+	sec := m.now().Unix()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var sum int64
+	for i := range m.buckets {
+		if sec-m.stamps[i] < 60 {
+			sum += m.buckets[i]
+		}
+	}
+	return sum
+}
+
+func (m *Meter) Snapshot() interface{} {
+	return MeterSnapshot{Total: m.Total(), PerMinute: m.PerMinute()}
+}
+
+// DefaultLatencyBuckets 默认延迟分桶（秒）
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram 分桶统计观测值的分布（如延迟）
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mutex  sync.Mutex
+	counts []int64 // counts[i]为不大于buckets[i]的观测数，最后一个为+Inf
+	count  int64
+	sum    float64
+}
+
+// HistogramSnapshot Histogram的快照
+type HistogramSnapshot struct {
+	Count   int64            `json:"count"`
+	Sum     float64          `json:"sum"`
+	Buckets map[string]int64 `json:"buckets"` // 上界 -> 累计观测数
+}
+
+// NewHistogram 创建分布统计并注册到默认注册表，buckets为空时使用DefaultLatencyBuckets
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return defaultRegistry.Register(newHistogram(name, help, buckets)).(*Histogram)
+}
+
+func newHistogram(name, help string, buckets []float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		name:    name,
+		help:    help,
+		buckets: sorted,
+		counts:  make([]int64, len(sorted)+1),
+	}
+}
+
+func (h *Histogram) Name() string { return h.name }
+func (h *Histogram) Help() string { return h.help }
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	idx := sort.SearchFloat64s(h.buckets, v)
+
+	h.mutex.Lock()
+	h.counts[idx]++
+	h.count++
+	h.sum += v
+	h.mutex.Unlock()
+}
+
+// ObserveDuration 记录一个耗时（秒）
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Since 记录从start到现在的耗时，便于 defer h.Since(time.Now()) 使用
+func (h *Histogram) Since(start time.Time) {
+	h.ObserveDuration(time.Since(start))
+}
+
+// Bucket 分桶上界及累计观测数
+type Bucket struct {
+	UpperBound float64
+	Count      int64
+}
+
+// Buckets 返回各分桶的累计观测数（最后一个上界为+Inf）以及总数和总和
+func (h *Histogram) Buckets() ([]Bucket, int64, float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	result := make([]Bucket, 0, len(h.counts))
+	var cumulative int64
+	for i, c := range h.counts {
+		cumulative += c
+		bound := math.Inf(1)
+		if i < len(h.buckets) {
+			bound = h.buckets[i]
+		}
+		result = append(result, Bucket{UpperBound: bound, Count: cumulative})
+	}
+	return result, h.count, h.sum
+}
+
+func (h *Histogram) Snapshot() interface{} {
+	buckets, count, sum := h.Buckets()
+	snapshot := HistogramSnapshot{Count: count, Sum: sum, Buckets: make(map[string]int64, len(buckets))}
+	for _, b := range buckets {
+		snapshot.Buckets[formatBound(b.UpperBound)] = b.Count
+	}
+	return snapshot
+}
+
+// formatBound 格式化分桶上界
+func formatBound(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+// CounterVec 按标签区分的一组计数器
+type CounterVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	counters sync.Map // 标签值组合 -> *Counter
+}
+
+// NewCounterVec 创建带标签的计数器组并注册到默认注册表
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return defaultRegistry.Register(&CounterVec{name: name, help: help, labelNames: labelNames}).(*CounterVec)
+}
+
+func (v *CounterVec) Name() string { return v.name }
+func (v *CounterVec) Help() string { return v.help }
+
+// LabelNames 标签名列表
+func (v *CounterVec) LabelNames() []string {
+	return v.labelNames
+}
+
+// WithLabelValues 获取指定标签值对应的计数器，标签值个数需与标签名一致
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	key := strings.Join(values, "\xff")
+	if c, ok := v.counters.Load(key); ok {
+		return c.(*Counter)
+	}
+	c, _ := v.counters.LoadOrStore(key, &Counter{name: v.name, help: v.help})
+	return c.(*Counter)
+}
+
+// Each 遍历所有标签值组合及其计数
+func (v *CounterVec) Each(fn func(labelValues []string, value int64)) {
+	v.counters.Range(func(k, c interface{}) bool {
+		fn(strings.Split(k.(string), "\xff"), c.(*Counter).Value())
+		return true
+	})
+}
+
+func (v *CounterVec) Snapshot() interface{} {
+	snapshot := make(map[string]int64)
+	v.Each(func(labelValues []string, value int64) {
+		snapshot[strings.Join(labelValues, ",")] = value
+	})
+	return snapshot
+}
+
+// GaugeVec 按标签区分的一组仪表
+type GaugeVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	gauges sync.Map // 标签值组合 -> *Gauge
+}
+
+// NewGaugeVec 创建带标签的仪表组并注册到默认注册表
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return defaultRegistry.Register(&GaugeVec{name: name, help: help, labelNames: labelNames}).(*GaugeVec)
+}
+
+func (v *GaugeVec) Name() string { return v.name }
+func (v *GaugeVec) Help() string { return v.help }
+
+// LabelNames 标签名列表
+func (v *GaugeVec) LabelNames() []string {
+	return v.labelNames
+}
+
+// WithLabelValues 获取指定标签值对应的仪表，标签值个数需与标签名一致
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	key := strings.Join(values, "\xff")
+	if g, ok := v.gauges.Load(key); ok {
+		return g.(*Gauge)
+	}
+	g, _ := v.gauges.LoadOrStore(key, &Gauge{name: v.name, help: v.help})
+	return g.(*Gauge)
+}
+
+// Each 遍历所有标签值组合及其当前值
+func (v *GaugeVec) Each(fn func(labelValues []string, value int64)) {
+	v.gauges.Range(func(k, g interface{}) bool {
+		fn(strings.Split(k.(string), "\xff"), g.(*Gauge).Value())
+		return true
+	})
+}
+
+func (v *GaugeVec) Snapshot() interface{} {
+	snapshot := make(map[string]int64)
+	v.Each(func(labelValues []string, value int64) {
+		snapshot[strings.Join(labelValues, ",")] = value
+	})
+	return snapshot
+}
+
+// HistogramVec 按标签区分的一组分布统计，各组使用相同的分桶
+type HistogramVec struct {
+	name       string
+	help       string
+	buckets    []float64
+	labelNames []string
+
+	histograms sync.Map // 标签值组合 -> *Histogram
+}
+
+// NewHistogramVec 创建带标签的分布统计组并注册到默认注册表，buckets为空时使用DefaultLatencyBuckets
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return defaultRegistry.Register(newHistogramVec(name, help, buckets, labelNames...)).(*HistogramVec)
+}
+
+func newHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{name: name, help: help, buckets: buckets, labelNames: labelNames}
+}
+
+func (v *HistogramVec) Name() string { return v.name }
+func (v *HistogramVec) Help() string { return v.help }
+
+// LabelNames 标签名列表
+func (v *HistogramVec) LabelNames() []string {
+	return v.labelNames
+}
+
+// WithLabelValues 获取指定标签值对应的分布统计，标签值个数需与标签名一致
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	key := strings.Join(values, "\xff")
+	if h, ok := v.histograms.Load(key); ok {
+		return h.(*Histogram)
+	}
+	h, _ := v.histograms.LoadOrStore(key, newHistogram(v.name, v.help, v.buckets))
+	return h.(*Histogram)
+}
+
+// Each 遍历所有标签值组合及其分布统计
+func (v *HistogramVec) Each(fn func(labelValues []string, h *Histogram)) {
+	v.histograms.Range(func(k, h interface{}) bool {
+		fn(strings.Split(k.(string), "\xff"), h.(*Histogram))
+		return true
+	})
+}
+
+func (v *HistogramVec) Snapshot() interface{} {
+	snapshot := make(map[string]interface{})
+	v.Each(func(labelValues []string, h *Histogram) {
+		snapshot[strings.Join(labelValues, ",")] = h.Snapshot()
+	})
+	return snapshot
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterAndGauge(t *testing.T) {
+	c := &Counter{name: "test_counter"}
+	c.Inc()
+	c.Add(4)
+	c.Add(-3) // 计数器不允许减少
+	assert.Equal(t, int64(5), c.Value())
+
+	g := &Gauge{name: "test_gauge"}
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	assert.Equal(t, int64(1), g.Value())
+	g.Set(10)
+	assert.Equal(t, int64(10), g.Value())
+}
+
+func TestMeterPerMinute(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := newMeter("test_meter", "", func() time.Time { return now })
+
+	m.Mark()
+	m.Mark()
+	now = now.Add(30 * time.Second)
+	m.Mark()
+	assert.Equal(t, int64(3), m.PerMinute())
+
+	// 超过一分钟的事件不再计入
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, int64(1), m.PerMinute())
+	assert.Equal(t, int64(3), m.Total())
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram("test_histogram", "", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	buckets, count, sum := h.Buckets()
+	assert.Equal(t, int64(4), count)
+	assert.InDelta(t, 3.65, sum, 1e-9)
+	assert.Equal(t, []Bucket{
+		{UpperBound: 0.1, Count: 2},
+		{UpperBound: 1, Count: 3},
+		{UpperBound: math.Inf(1), Count: 4},
+	}, buckets)
+}
+
+func TestCounterVec(t *testing.T) {
+	v := &CounterVec{name: "test_vec", labelNames: []string{"family", "result"}}
+	v.WithLabelValues("user", "hit").Inc()
+	v.WithLabelValues("user", "hit").Inc()
+	v.WithLabelValues("user", "miss").Inc()
+
+	assert.Equal(t, map[string]int64{"user,hit": 2, "user,miss": 1}, v.Snapshot())
+}
+
+func TestGaugeVec(t *testing.T) {
+	v := &GaugeVec{name: "test_gauge_vec", labelNames: []string{"table"}}
+	v.WithLabelValues("messages").Set(10)
+	v.WithLabelValues("messages").Set(7)
+	v.WithLabelValues("users").Inc()
+
+	assert.Equal(t, map[string]int64{"messages": 7, "users": 1}, v.Snapshot())
+}
+
+func TestRegistryReturnsExisting(t *testing.T) {
+	r := NewRegistry()
+	first := r.Register(&Counter{name: "dup"})
+	second := r.Register(&Counter{name: "dup"})
+	assert.Same(t, first, second)
+	assert.Len(t, r.Metrics(), 1)
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType Prometheus文本格式的Content-Type
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus 以Prometheus文本格式输出所有指标
+// Counter、CounterVec导出为counter，Gauge、GaugeVec为gauge，Histogram、HistogramVec为histogram，
+// Meter导出累计次数，名称加_total后缀；其他类型的指标不导出
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range r.Metrics() {
+		switch m := m.(type) {
+		case *Counter:
+			writeHeader(bw, m.name, m.help, "counter")
+			writeSample(bw, m.name, nil, nil, float64(m.Value()))
+		case *Gauge:
+			writeHeader(bw, m.name, m.help, "gauge")
+			writeSample(bw, m.name, nil, nil, float64(m.Value()))
+		case *Meter:
+			name := m.name + "_total"
+			writeHeader(bw, name, m.help, "counter")
+			writeSample(bw, name, nil, nil, float64(m.Total()))
+		case *Histogram:
+			writeHeader(bw, m.name, m.help, "histogram")
+			writeHistogram(bw, m.name, nil, nil, m)
+		case *CounterVec:
+			writeHeader(bw, m.name, m.help, "counter")
+			writeVec(bw, m.name, m.labelNames, m.Each)
+		case *GaugeVec:
+			writeHeader(bw, m.name, m.help, "gauge")
+			writeVec(bw, m.name, m.labelNames, m.Each)
+		case *HistogramVec:
+			writeHeader(bw, m.name, m.help, "histogram")
+			var series []labeledHistogram
+			m.Each(func(labelValues []string, h *Histogram) {
+				series = append(series, labeledHistogram{labelValues, h})
+			})
+			sort.Slice(series, func(i, j int) bool {
+				return lessLabels(series[i].labelValues, series[j].labelValues)
+			})
+			for _, s := range series {
+				writeHistogram(bw, m.name, m.labelNames, s.labelValues, s.histogram)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+type labeledHistogram struct {
+	labelValues []string
+	histogram   *Histogram
+}
+
+type labeledValue struct {
+	labelValues []string
+	value       int64
+}
+
+// writeVec 按标签值排序输出计数器组或仪表组
+func writeVec(w *bufio.Writer, name string, labelNames []string, each func(func([]string, int64))) {
+	var series []labeledValue
+	each(func(labelValues []string, value int64) {
+		series = append(series, labeledValue{labelValues, value})
+	})
+	sort.Slice(series, func(i, j int) bool {
+		return lessLabels(series[i].labelValues, series[j].labelValues)
+	})
+	for _, s := range series {
+		writeSample(w, name, labelNames, s.labelValues, float64(s.value))
+	}
+}
+
+// writeHistogram 输出累计分桶、_sum和_count
+func writeHistogram(w *bufio.Writer, name string, labelNames, labelValues []string, h *Histogram) {
+	buckets, count, sum := h.Buckets()
+	bucketLabels := append(append([]string(nil), labelNames...), "le")
+	for _, b := range buckets {
+		writeSample(w, name+"_bucket", bucketLabels, append(append([]string(nil), labelValues...), formatBound(b.UpperBound)), float64(b.Count))
+	}
+	writeSample(w, name+"_sum", labelNames, labelValues, sum)
+	writeSample(w, name+"_count", labelNames, labelValues, float64(count))
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	if help != "" {
+		w.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	}
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func writeSample(w *bufio.Writer, name string, labelNames, labelValues []string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 {
+		w.WriteByte('{')
+		for i, label := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			var v string
+			if i < len(labelValues) {
+				v = labelValues[i]
+			}
+			w.WriteString(label + `="` + escapeLabelValue(v) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatValue(value))
+	w.WriteByte('\n')
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpEscaper.Replace(s) }
+func escapeLabelValue(s string) string { return labelEscaper.Replace(s) }
+
+// lessLabels 按标签值逐个比较，保证输出顺序稳定
+func lessLabels(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
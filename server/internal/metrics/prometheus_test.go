@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	counter := r.Register(&Counter{name: "requests_total", help: "请求数"}).(*Counter)
+	counter.Add(3)
+	gauge := r.Register(&Gauge{name: "connections", help: "line1\nline2"}).(*Gauge)
+	gauge.Set(-2)
+	meter := r.Register(newMeter("connects", "", time.Now)).(*Meter)
+	meter.Mark()
+	vec := r.Register(&CounterVec{name: "lookups_total", labelNames: []string{"family", "result"}}).(*CounterVec)
+	vec.WithLabelValues("user", "miss").Inc()
+	vec.WithLabelValues("user", "hit").Add(2)
+	vec.WithLabelValues(`a"b\c`, "hit").Inc()
+	histograms := r.Register(newHistogramVec("latency_seconds", "耗时", []float64{0.1, 1}, "route")).(*HistogramVec)
+	histograms.WithLabelValues("/b").Observe(0.5)
+	histograms.WithLabelValues("/a").Observe(0.05)
+	histograms.WithLabelValues("/a").Observe(2)
+
+	var out strings.Builder
+	require.NoError(t, r.WritePrometheus(&out))
+	assert.Equal(t, `# HELP connections line1\nline2
+# TYPE connections gauge
+connections -2
+# TYPE connects_total counter
+connects_total 1
+# HELP latency_seconds 耗时
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 1
+latency_seconds_bucket{route="/a",le="+Inf"} 2
+latency_seconds_sum{route="/a"} 2.05
+latency_seconds_count{route="/a"} 2
+latency_seconds_bucket{route="/b",le="0.1"} 0
+latency_seconds_bucket{route="/b",le="1"} 1
+latency_seconds_bucket{route="/b",le="+Inf"} 1
+latency_seconds_sum{route="/b"} 0.5
+latency_seconds_count{route="/b"} 1
+# TYPE lookups_total counter
+lookups_total{family="a\"b\\c",result="hit"} 1
+lookups_total{family="user",result="hit"} 2
+lookups_total{family="user",result="miss"} 1
+# HELP requests_total 请求数
+# TYPE requests_total counter
+requests_total 3
+`, out.String())
+}
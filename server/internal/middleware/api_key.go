@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/logger"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+// APIKeyHeader 服务集成携带API密钥的请求头
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuth API密钥认证中间件，与JWTAuth并列，需注册在JWTAuth之前
+// 请求携带X-API-Key时按密钥认证并以密钥绑定的用户身份继续处理，JWTAuth不再校验Token；绑定的用户被停用或封禁时返回403；
+// 只允许访问routeScopes中列出的接口（键为"方法 路由模板"，如"GET /api/v1/message/history"），且密钥需拥有对应的授权范围
+func APIKeyAuth(routeScopes map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plaintext := c.GetHeader(APIKeyHeader)
+		if plaintext == "" {
+			c.Next()
+			return
+		}
+
+		key, err := services.NewAPIKeyService().Authenticate(c.Request.Context(), plaintext)
+		if errors.Is(err, services.ErrInvalidAPIKey) || errors.Is(err, services.ErrAPIKeyExpired) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse(401, "Invalid or expired API key"))
+			return
+		}
+		var suspended *services.AccountSuspendedError
+		if errors.As(err, &suspended) {
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.FormatResponse(403, err.Error(), gin.H{"suspended_until": suspended.Until, "reason": suspended.Reason}))
+			return
+		}
+		if err != nil {
+			logger.WithContext(c.Request.Context()).Errorf("校验API密钥失败: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to verify API key"))
+			return
+		}
+
+		scope, ok := routeScopes[c.Request.Method+" "+c.FullPath()]
+		if !ok || !services.HasScope(key, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse(403, "API key is not allowed to access this endpoint"))
+			return
+		}
+
+		c.Set("user_id", key.UserID)
+		c.Set("api_key_id", key.ID)
+		c.Next()
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/models"
+	"gochat/internal/services"
+)
+
+func TestAPIKeyAuthRejectsSuspendedUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	require.NoError(t, database.Init(&config.DatabaseConfig{
+		Driver: database.DriverSQLite,
+		DBName: filepath.Join(t.TempDir(), "gochat.db"),
+	}))
+	t.Cleanup(func() { database.Close() })
+	require.NoError(t, database.Migrate())
+
+	// 停用用户时撤销登录会话，会话保存在Redis中
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	previous := cache.RedisClient
+	cache.RedisClient = client
+	t.Cleanup(func() {
+		cache.RedisClient = previous
+		client.Close()
+	})
+
+	db := database.GetDB()
+	user := &models.User{Phone: "13800000001", PasswordHash: "x", Nickname: "notifier"}
+	require.NoError(t, db.Create(user).Error)
+	ctx := context.Background()
+	plaintext, _, err := services.NewAPIKeyServiceWithDB(db).CreateAPIKey(ctx, "notifier", user.ID, []string{services.ScopeMessagesRead}, 0)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(APIKeyAuth(map[string]string{"GET /history": services.ScopeMessagesRead}))
+	r.GET("/history", func(c *gin.Context) { c.Status(http.StatusOK) })
+	request := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/history", nil)
+		req.Header.Set(APIKeyHeader, plaintext)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	require.Equal(t, http.StatusOK, request())
+
+	admin := services.NewAdminServiceWithDB(db)
+	until := time.Now().Add(time.Hour)
+	_, err = admin.SuspendUser(ctx, 0, user.ID, &until, "spam")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, request(), "停用期间密钥失效")
+
+	_, err = admin.SuspendUser(ctx, 0, user.ID, nil, "spam")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, request(), "封禁后密钥失效")
+
+	_, err = admin.UnbanUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, request(), "解除封禁后恢复")
+}
@@ -1,16 +1,21 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 
+	"gochat/internal/breaker"
 	"gochat/internal/cache"
 	"gochat/internal/config"
+	"gochat/internal/errreport"
 	"gochat/internal/logger"
+	"gochat/internal/services"
 	"gochat/internal/utils"
 )
 
@@ -25,6 +30,12 @@ func JWTAuth(cfg *config.JWTConfig, skipPaths []string) gin.HandlerFunc {
 			}
 		}
 
+		// 已通过API密钥认证
+		if _, ok := c.Get("api_key_id"); ok {
+			c.Next()
+			return
+		}
+
 		// 从请求头获取token
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -49,7 +60,11 @@ func JWTAuth(cfg *config.JWTConfig, skipPaths []string) gin.HandlerFunc {
 		}
 
 		// 验证token在Redis中是否存在（可选，用于强制登出）
+		// Redis熔断期间只校验JWT签名和有效期，已登出的token在恢复前仍可使用
 		storedToken, err := cache.GetToken(userID)
+		if errors.Is(err, breaker.ErrOpen) {
+			storedToken, err = tokenString, nil
+		}
 		if err != nil || storedToken != tokenString {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse(401, "Token not found or expired"))
 			return
@@ -58,14 +73,22 @@ func JWTAuth(cfg *config.JWTConfig, skipPaths []string) gin.HandlerFunc {
 		// 设置用户信息到上下文中
 		c.Set("user_id", userID)
 		c.Set("token", tokenString)
+		services.RecordActiveUsers(c.Request.Context(), userID)
 
 		c.Next()
 	}
 }
 
-// CORS 跨域中间件
-func CORS(corsConfig *config.CORSConfig) gin.HandlerFunc {
+// CORS 跨域中间件，允许的来源等配置支持热加载
+func CORS(cfg *config.CORSConfig) gin.HandlerFunc {
+	var current atomic.Pointer[config.CORSConfig]
+	current.Store(cfg)
+	config.OnReload(func(next *config.Config) {
+		current.Store(&next.CORS)
+	})
+
 	return func(c *gin.Context) {
+		corsConfig := current.Load()
 		// 检查请求来源是否在允许列表中
 		origin := c.Request.Header.Get("Origin")
 		allowed := false
@@ -162,13 +185,20 @@ func isPrivateNetworkOrigin(origin string) bool {
 // RequestLogger 请求日志中间件
 func RequestLogger() gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("[%s] %s %s %d %s %s\n",
+		requestID, _ := param.Keys["request_id"].(string)
+		path := param.Path
+		// Incoming Webhook地址中的令牌即凭证，不写入日志
+		if strings.HasPrefix(path, "/api/v1/hooks/") {
+			path = "/api/v1/hooks/***"
+		}
+		return fmt.Sprintf("[%s] %s %s %d %s %s request_id=%s\n",
 			param.TimeStamp.Format("2006/01/02 15:04:05"),
 			param.Method,
-			param.Path,
+			path,
 			param.StatusCode,
 			param.Latency,
 			param.Request.UserAgent(),
+			requestID,
 		)
 	})
 }
@@ -176,11 +206,30 @@ func RequestLogger() gin.HandlerFunc {
 // Recovery 错误恢复中间件
 func Recovery() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		log := logger.WithContext(c.Request.Context())
 		if err, ok := recovered.(string); ok {
-			logger.GetLogger().Errorf("panic recovered: %s", err)
+			log.Errorf("panic recovered: %s", err)
 		} else {
-			logger.GetLogger().Errorf("panic recovered: %v", recovered)
+			log.Errorf("panic recovered: %v", recovered)
 		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Internal server error"))
+		errreport.CapturePanic(c, recovered)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.WithRequestID(c, utils.ErrorResponse(500, "Internal server error")))
 	})
 }
+
+// RequestIDHeader 请求ID头，客户端或网关传入时沿用，否则由服务端生成
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID 请求ID中间件，把请求ID写入响应头、gin上下文和请求的context
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = logger.NewRequestID()
+		}
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), requestID))
+		c.Next()
+	}
+}
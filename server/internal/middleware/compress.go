@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+)
+
+// Compression 响应压缩中间件：客户端支持时按gzip（优先）或deflate压缩JSON等文本响应
+// WebSocket升级请求、配置中排除的路径（如SSE）、带Accept-Ranges的文件下载和已编码的响应不压缩
+func Compression(cfg *config.CompressionConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(io.Discard, cfg.Level)
+			return w
+		}},
+		"deflate": {New: func() interface{} {
+			w, _ := zlib.NewWriterLevel(io.Discard, cfg.Level)
+			return w
+		}},
+	}
+
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead ||
+			strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			c.Next()
+			return
+		}
+		for _, prefix := range cfg.ExcludedPaths {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, cfg: cfg, encoding: encoding, pool: pools[encoding]}
+		c.Writer = w
+		defer w.close()
+		c.Next()
+	}
+}
+
+// negotiateEncoding 按Accept-Encoding选择压缩方式，不支持时返回空字符串
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if enabled, ok := accepted[encoding]; ok {
+			if enabled {
+				return encoding
+			}
+			continue
+		}
+		if accepted["*"] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressor gzip.Writer和zlib.Writer的公共方法
+type compressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+	Flush() error
+}
+
+// compressWriter 先缓冲响应体，达到min_size后开始压缩；响应结束时仍不足min_size则原样输出
+type compressWriter struct {
+	gin.ResponseWriter
+	cfg      *config.CompressionConfig
+	encoding string
+	pool     *sync.Pool
+
+	buf     []byte
+	decided bool       // 是否已确定压缩与否
+	writer  compressor // 压缩时非nil
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		if !w.compressible() {
+			if err := w.start(false); err != nil {
+				return 0, err
+			}
+			return w.ResponseWriter.Write(data)
+		}
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.cfg.MinSize {
+			return len(data), nil
+		}
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.writer != nil {
+		return w.writer.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written 缓冲中的响应也视为已写入，避免后续处理重复写状态码
+func (w *compressWriter) Written() bool {
+	return w.ResponseWriter.Written() || len(w.buf) > 0
+}
+
+// Flush 流式响应立即输出已缓冲的内容
+func (w *compressWriter) Flush() {
+	if !w.decided && len(w.buf) > 0 {
+		w.start(true)
+	}
+	if w.writer != nil {
+		w.writer.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// compressible 按状态码和响应头判断是否压缩，需在写入响应体前调用
+func (w *compressWriter) compressible() bool {
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent ||
+		status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Accept-Ranges") != "" {
+		return false
+	}
+	mediaType, _, _ := strings.Cut(header.Get("Content-Type"), ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, allowed := range w.cfg.ContentTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(mediaType, prefix) {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// start 确定是否压缩并输出已缓冲的内容
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	buf := w.buf
+	w.buf = nil
+
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		header.Add("Vary", "Accept-Encoding")
+		w.writer = w.pool.Get().(compressor)
+		w.writer.Reset(w.ResponseWriter)
+		if len(buf) > 0 {
+			_, err := w.writer.Write(buf)
+			return err
+		}
+		return nil
+	}
+	if len(buf) > 0 {
+		_, err := w.ResponseWriter.Write(buf)
+		return err
+	}
+	return nil
+}
+
+// close 结束压缩流，响应不足min_size时原样输出
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.start(false)
+	}
+	if w.writer != nil {
+		w.writer.Close()
+		w.writer.Reset(io.Discard)
+		w.pool.Put(w.writer)
+		w.writer = nil
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/logger"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+// rateLimitedKey RateLimit拒绝请求时设置的上下文键，供IPBlocklist统计违规
+const rateLimitedKey = "rate_limited"
+
+// IPBlocklist IP封禁中间件，需注册在RateLimit之前
+// 被封禁的IP直接返回403；请求结束后把登录失败、认证失败（401）和触发限流计入自动封禁的违规次数
+func IPBlocklist(banService *services.IPBanService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		if banService.IsBanned(clientIP) {
+			logger.WithContext(c.Request.Context()).Warnf("拒绝被封禁IP %s 的请求: %s", clientIP, c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.WithRequestID(c, utils.ErrorResponse(403, "Access denied")))
+			return
+		}
+
+		c.Next()
+
+		ctx := c.Request.Context()
+		status := c.Writer.Status()
+		switch {
+		case c.GetBool(rateLimitedKey):
+			banService.RecordOffense(ctx, clientIP, services.OffenseRateLimited)
+		case c.FullPath() == "/api/v1/auth/login" && status >= http.StatusBadRequest && status < http.StatusInternalServerError:
+			banService.RecordOffense(ctx, clientIP, services.OffenseLoginFailure)
+		case status == http.StatusUnauthorized:
+			banService.RecordOffense(ctx, clientIP, services.OffenseAuthFailure)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/metrics"
+)
+
+// requestDuration 按路由和状态码统计的请求耗时，次数即_count
+var requestDuration = metrics.NewHistogramVec("http_request_duration_seconds",
+	"HTTP请求处理耗时（按路由模板统计，未匹配的路由记为unmatched）", nil, "method", "route", "status")
+
+// HTTPMetrics 记录每个请求的耗时和状态码
+// route取路由模板（如/api/v1/group/:id）而不是实际路径，避免标签数量随ID增长；WebSocket连接由ws_*指标单独统计
+func HTTPMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.IsWebsocket() {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+
+		method, route := c.Request.Method, c.FullPath()
+		if route == "" {
+			// 未匹配的请求方法由客户端任意指定，不作为标签值
+			method, route = "other", "unmatched"
+		}
+		requestDuration.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Since(start)
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/logger"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+// RequirePermission 管理后台权限校验，需注册在JWTAuth之后
+// 只接受用户登录Token，API密钥不能访问管理后台；角色每次从数据库读取，收回角色立即生效
+func RequirePermission(adminService *services.AdminService, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse(403, "API key is not allowed to access this endpoint"))
+			return
+		}
+		userID, ok := utils.GetAuthenticatedUser(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+			return
+		}
+
+		role, err := adminService.GetRole(c.Request.Context(), userID)
+		if err != nil {
+			logger.WithContext(c.Request.Context()).Errorf("查询管理后台角色失败: user_id=%d, error=%v", userID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to verify permission"))
+			return
+		}
+		if !services.HasPermission(role, permission) {
+			logger.WithContext(c.Request.Context()).Warnf("管理后台权限不足: user_id=%d, role=%q, permission=%s", userID, role, permission)
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse(403, "Permission denied"))
+			return
+		}
+
+		c.Set("admin_role", role)
+		c.Next()
+	}
+}
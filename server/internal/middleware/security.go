@@ -1,19 +1,26 @@
 package middleware
 
 import (
-	"html"
+	"crypto/subtle"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"gochat/internal/config"
 	"gochat/internal/errors"
 	"gochat/internal/logger"
+	"gochat/internal/utils"
 )
 
+// maxInputLength 路径和单个查询参数的最大字符数
+const maxInputLength = 10000
+
 // RateLimiter 基于令牌桶算法的速率限制器
 type RateLimiter struct {
 	tokens     int64     // 当前令牌数量
@@ -76,42 +83,6 @@ func min(a, b int64) int64 {
 	return b
 }
 
-// RateLimitConfig 速率限制配置
-type RateLimitConfig struct {
-	// 通用API限制
-	GlobalRPS    int64 // 每秒请求数
-	GlobalBurst  int64 // 突发容量
-
-	// 认证相关限制
-	AuthRPS      int64 // 认证接口每秒请求数
-	AuthBurst    int64 // 认证接口突发容量
-
-	// 消息发送限制
-	MessageRPS   int64 // 消息发送每秒请求数
-	MessageBurst int64 // 消息发送突发容量
-
-	// 文件上传限制
-	UploadRPS    int64 // 文件上传每秒请求数
-	UploadBurst  int64 // 文件上传突发容量
-}
-
-// DefaultRateLimitConfig 默认速率限制配置
-func DefaultRateLimitConfig() *RateLimitConfig {
-	return &RateLimitConfig{
-		GlobalRPS:    100, // 100 requests per second
-		GlobalBurst:  200, // burst of 200 requests
-
-		AuthRPS:      5,   // 5 auth requests per second
-		AuthBurst:    10,  // burst of 10 auth requests
-
-		MessageRPS:   10,  // 10 messages per second
-		MessageBurst: 20,  // burst of 20 messages
-
-		UploadRPS:    3,   // 3 uploads per second
-		UploadBurst:  5,   // burst of 5 uploads
-	}
-}
-
 // rateLimiters 存储不同用户和端点的速率限制器
 var (
 	globalLimiters = make(map[string]*RateLimiter)
@@ -165,6 +136,13 @@ func cleanupExpiredLimiters() {
 	}
 }
 
+// resetRateLimiters 清空所有速率限制器
+func resetRateLimiters() {
+	limiterMutex.Lock()
+	defer limiterMutex.Unlock()
+	globalLimiters = make(map[string]*RateLimiter)
+}
+
 // getRateLimiter 获取或创建速率限制器
 func getRateLimiter(key string, rps, burst int64) *RateLimiter {
 	limiterMutex.Lock()
@@ -179,9 +157,35 @@ func getRateLimiter(key string, rps, burst int64) *RateLimiter {
 	return limiter
 }
 
-// RateLimit 速率限制中间件
-func RateLimit(config *RateLimitConfig) gin.HandlerFunc {
+// rateLimitSettings 速率限制配置和解析后的豁免网段，热加载时整体替换
+type rateLimitSettings struct {
+	cfg        *config.RateLimitConfig
+	exemptNets []*net.IPNet
+}
+
+// RateLimit 速率限制中间件，限制值来自配置文件的rate_limit，支持热加载
+func RateLimit(cfg *config.RateLimitConfig) gin.HandlerFunc {
+	var settings atomic.Pointer[rateLimitSettings]
+	settings.Store(&rateLimitSettings{cfg: cfg, exemptNets: parseExemptIPs(cfg.ExemptIPs)})
+	config.OnReload(func(next *config.Config) {
+		settings.Store(&rateLimitSettings{cfg: &next.RateLimit, exemptNets: parseExemptIPs(next.RateLimit.ExemptIPs)})
+		// 已创建的限制器沿用创建时的限制值，清空后按新配置重新创建
+		resetRateLimiters()
+	})
+
 	return func(c *gin.Context) {
+		current := settings.Load()
+		cfg := current.cfg
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+		path := c.Request.URL.Path
+		if isRateLimitExempt(c, path, cfg.ExemptPaths, current.exemptNets) {
+			c.Next()
+			return
+		}
+
 		// 获取客户端标识（优先使用认证用户ID，否则使用IP）
 		var clientID string
 		if userID, exists := c.Get("user_id"); exists {
@@ -191,23 +195,8 @@ func RateLimit(config *RateLimitConfig) gin.HandlerFunc {
 		}
 
 		// 根据请求路径确定限制策略
-		var rps, burst int64
-		path := c.Request.URL.Path
-
-		switch {
-		case strings.Contains(path, "/auth/"):
-			rps = config.AuthRPS
-			burst = config.AuthBurst
-		case strings.Contains(path, "/upload/"):
-			rps = config.UploadRPS
-			burst = config.UploadBurst
-		case strings.Contains(path, "/message/") || c.Request.Method == "POST":
-			rps = config.MessageRPS
-			burst = config.MessageBurst
-		default:
-			rps = config.GlobalRPS
-			burst = config.GlobalBurst
-		}
+		rule := rateLimitRule(cfg, c.Request.Method, c.FullPath(), path)
+		rps, burst := rule.RPS, rule.Burst
 
 		// 创建限制器键
 		limiterKey := clientID + ":" + path
@@ -218,6 +207,7 @@ func RateLimit(config *RateLimitConfig) gin.HandlerFunc {
 		// 检查是否允许请求
 		if !limiter.Allow() {
 			logger.GetLogger().Warnf("Rate limit exceeded for client %s on path %s", clientID, path)
+			c.Set(rateLimitedKey, true)
 			errors.HandleBadRequest(c, "Rate limit exceeded. Please slow down.")
 			return
 		}
@@ -231,163 +221,208 @@ func RateLimit(config *RateLimitConfig) gin.HandlerFunc {
 	}
 }
 
-// SecurityHeaders 安全头中间件
-func SecurityHeaders() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 基本安全头设置
-		c.Header("X-Content-Type-Options", "nosniff")
-		c.Header("X-Frame-Options", "DENY")
-		c.Header("X-XSS-Protection", "1; mode=block")
-		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
-
-		// 强制HTTPS（仅在HTTPS时启用）
-		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
-			c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains; preload")
+// rateLimitRule 按路由覆盖或路径类别选择限制值，fullPath为匹配到的路由模板
+func rateLimitRule(cfg *config.RateLimitConfig, method, fullPath, path string) config.RateLimitRule {
+	for _, route := range cfg.Routes {
+		if route.Method != "" && !strings.EqualFold(route.Method, method) {
+			continue
 		}
-
-		// API缓存策略
-		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
-			c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
-			c.Header("Pragma", "no-cache")
-			c.Header("Expires", "0")
+		if matchRoute(route.Path, fullPath, path) {
+			return config.RateLimitRule{RPS: route.RPS, Burst: route.Burst}
 		}
-
-		c.Next()
 	}
-}
-
-// InputSanitization 输入清理中间件
-func InputSanitization() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 创建新的清理上下文
-		sanitizedCtx := &SanitizedContext{Context: c}
-
-		// 替换原有上下文
-		c.Set("sanitized", sanitizedCtx)
 
-		c.Next()
+	switch {
+	case strings.Contains(path, "/auth/"):
+		return cfg.Auth
+	case strings.Contains(path, "/upload/"):
+		return cfg.Upload
+	case strings.Contains(path, "/message/") || method == "POST":
+		return cfg.Message
+	default:
+		return cfg.Global
 	}
 }
 
-// SanitizedContext 清理后的上下文包装器
-type SanitizedContext struct {
-	*gin.Context
-}
-
-// SanitizeString 清理字符串输入
-func (sc *SanitizedContext) SanitizeString(input string) string {
-	// HTML转义防止XSS
-	sanitized := html.EscapeString(input)
-
-	// 移除潜在危险字符
-	sanitized = strings.ReplaceAll(sanitized, "<script", "&lt;script")
-	sanitized = strings.ReplaceAll(sanitized, "</script", "&lt;/script")
-	sanitized = strings.ReplaceAll(sanitized, "javascript:", "")
-	sanitized = strings.ReplaceAll(sanitized, "vbscript:", "")
-	sanitized = strings.ReplaceAll(sanitized, "onload=", "")
-	sanitized = strings.ReplaceAll(sanitized, "onerror=", "")
-
-	// 限制长度防止DoS
-	maxLength := 10000
-	if len(sanitized) > maxLength {
-		sanitized = sanitized[:maxLength]
+// matchRoute 配置中的路由是否匹配当前请求：以*结尾时按请求路径前缀匹配，否则与路由模板完全一致
+func matchRoute(pattern, fullPath, path string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(path, prefix)
 	}
-
-	return sanitized
+	return pattern == fullPath
 }
 
-// SanitizeJSON 清理JSON输入
-func (sc *SanitizedContext) SanitizeJSON(obj interface{}) error {
-	// 首先正常绑定JSON
-	if err := sc.ShouldBindJSON(obj); err != nil {
-		return err
+// parseExemptIPs 解析豁免的IP和网段，单个IP按/32（IPv6为/128）处理，无效项在加载配置时已校验
+func parseExemptIPs(entries []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
 	}
-
-	// 清理结构体中的字符串字段
-	sc.sanitizeStructFields(obj)
-
-	return nil
+	return nets
 }
 
-// sanitizeStructFields 清理结构体字段
-func (sc *SanitizedContext) sanitizeStructFields(obj interface{}) {
-	// 使用反射遍历结构体字段并清理字符串
-	// 这里可以根据需要实现更复杂的清理逻辑
-	// 为了示例，这里只是一个基础实现
-}
-
-// GetSanitizedString 从查询参数或表单获取清理后的字符串
-func (sc *SanitizedContext) GetSanitizedString(key string) string {
-	value := sc.Query(key)
-	if value == "" {
-		value = sc.PostForm(key)
+// isRateLimitExempt 请求路径或来源IP是否在豁免列表中
+func isRateLimitExempt(c *gin.Context, path string, exemptPaths []string, exemptNets []*net.IPNet) bool {
+	for _, prefix := range exemptPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
 	}
-	return sc.SanitizeString(value)
-}
-
-// ValidatePhoneNumber 验证手机号格式
-func ValidatePhoneNumber(phone string) bool {
-	// 验证中国手机号格式（11位数字，以1开头）
-	if len(phone) != 11 {
+	if len(exemptNets) == 0 {
 		return false
 	}
-
-	if phone[0] != '1' {
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil {
 		return false
 	}
-
-	for _, char := range phone {
-		if char < '0' || char > '9' {
-			return false
+	for _, ipNet := range exemptNets {
+		if ipNet.Contains(ip) {
+			return true
 		}
 	}
-
-	return true
+	return false
 }
 
-// ValidatePassword 验证密码强度
-func ValidatePassword(password string) bool {
-	// 基本长度检查
-	if len(password) < 6 || len(password) > 128 {
-		return false
-	}
+// securityHeaderSet 一组路由实际发送的安全响应头，值为空的不发送
+type securityHeaderSet struct {
+	csp               string
+	frameOptions      string
+	referrerPolicy    string
+	permissionsPolicy string
+}
 
-	// 检查是否包含不安全字符
-	unsafeChars := []string{"<", ">", "&", "'", "\"", "/", "\\"}
-	for _, char := range unsafeChars {
-		if strings.Contains(password, char) {
-			return false
+// newSecurityHeaderSet 合并路由覆盖值：未配置沿用全局值，off表示不发送
+func newSecurityHeaderSet(base securityHeaderSet, route config.SecurityHeadersRoute) securityHeaderSet {
+	override := func(value, fallback string) string {
+		switch {
+		case value == "":
+			return fallback
+		case strings.EqualFold(value, "off"):
+			return ""
 		}
+		return value
+	}
+	return securityHeaderSet{
+		csp:               override(route.ContentSecurityPolicy, base.csp),
+		frameOptions:      override(route.FrameOptions, base.frameOptions),
+		referrerPolicy:    override(route.ReferrerPolicy, base.referrerPolicy),
+		permissionsPolicy: override(route.PermissionsPolicy, base.permissionsPolicy),
 	}
+}
 
-	return true
+// hstsValue 拼接Strict-Transport-Security的值，未启用时返回空，max_age已在加载配置时校验
+func hstsValue(cfg *config.HSTSConfig) string {
+	if !cfg.Enabled {
+		return ""
+	}
+	maxAge, _ := time.ParseDuration(cfg.MaxAge)
+	value := "max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+	if cfg.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if cfg.Preload {
+		value += "; preload"
+	}
+	return value
 }
 
-// ValidateNickname 验证昵称
-func ValidateNickname(nickname string) bool {
-	// 长度检查
-	if len(nickname) < 1 || len(nickname) > 50 {
-		return false
+// SecurityHeaders 安全头中间件，CSP、X-Frame-Options、Referrer-Policy、Permissions-Policy和HSTS来自配置文件security_headers
+func SecurityHeaders(cfg *config.SecurityHeadersConfig) gin.HandlerFunc {
+	// 启动时合并好各路由的响应头，请求时只需匹配路由
+	base := newSecurityHeaderSet(securityHeaderSet{}, config.SecurityHeadersRoute{
+		ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+		FrameOptions:          cfg.FrameOptions,
+		ReferrerPolicy:        cfg.ReferrerPolicy,
+		PermissionsPolicy:     cfg.PermissionsPolicy,
+	})
+	routes := make([]securityHeaderSet, len(cfg.Routes))
+	for i, route := range cfg.Routes {
+		routes[i] = newSecurityHeaderSet(base, route)
 	}
+	hsts := hstsValue(&cfg.HSTS)
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		headers := base
+		for i, route := range cfg.Routes {
+			if matchRoute(route.Path, c.FullPath(), path) {
+				headers = routes[i]
+				break
+			}
+		}
 
-	// 检查特殊字符
-	forbidden := []string{"<", ">", "&", "'", "\"", "admin", "system", "root"}
-	lowercaseNickname := strings.ToLower(nickname)
+		// 基本安全头设置
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("X-XSS-Protection", "1; mode=block")
+		for name, value := range map[string]string{
+			"Content-Security-Policy": headers.csp,
+			"X-Frame-Options":         headers.frameOptions,
+			"Referrer-Policy":         headers.referrerPolicy,
+			"Permissions-Policy":      headers.permissionsPolicy,
+		} {
+			if value != "" {
+				c.Header(name, value)
+			}
+		}
 
-	for _, word := range forbidden {
-		if strings.Contains(lowercaseNickname, word) {
-			return false
+		// 强制HTTPS（仅在HTTPS时启用）
+		if hsts != "" && (c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https") {
+			c.Header("Strict-Transport-Security", hsts)
 		}
+
+		// API缓存策略
+		if strings.HasPrefix(path, "/api/") {
+			c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+			c.Header("Pragma", "no-cache")
+			c.Header("Expires", "0")
+		}
+
+		c.Next()
 	}
+}
 
-	return true
+// InputValidation 输入编码检查中间件：路径和查询参数必须是合法的UTF-8且不含控制字符，否则返回400
+// 不对输入做转义或关键词过滤：字段内容由各接口按长度、字符集和结构校验（见utils.ValidateXxx），
+// 数据库访问使用参数化查询，响应经JSON编码统一转义输出
+func InputValidation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !utils.ValidatePlainText(c.Request.URL.Path, maxInputLength) {
+			errors.HandleBadRequest(c, "Invalid request path")
+			return
+		}
+		for key, values := range c.Request.URL.Query() {
+			if !utils.ValidatePlainText(key, maxInputLength) {
+				errors.HandleBadRequest(c, "Invalid query parameter")
+				return
+			}
+			for _, value := range values {
+				if !utils.ValidatePlainText(value, maxInputLength) {
+					errors.HandleBadRequest(c, "Invalid query parameter: "+key)
+					return
+				}
+			}
+		}
+		c.Next()
+	}
 }
 
 // CSRF 防护中间件（简化版）
 func CSRFProtection() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 对于非安全方法，检查CSRF token
-		if c.Request.Method != "GET" && c.Request.Method != "HEAD" && c.Request.Method != "OPTIONS" {
+		// 携带API密钥的请求来自服务端集成，浏览器跨站请求无法附带自定义请求头，不需要检查
+		if c.Request.Method != "GET" && c.Request.Method != "HEAD" && c.Request.Method != "OPTIONS" &&
+			c.GetHeader(APIKeyHeader) == "" {
 			// 检查Referer头
 			referer := c.GetHeader("Referer")
 			origin := c.GetHeader("Origin")
@@ -443,6 +478,65 @@ func IPWhitelist(allowedIPs []string) gin.HandlerFunc {
 	}
 }
 
+// PrivateNetworkOnly 只允许回环和内网地址访问（用于指标等运维接口）
+func PrivateNetworkOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requirePrivateNetwork(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// requirePrivateNetwork 请求不是来自回环或内网地址时返回403并返回false
+// 供组合认证的中间件使用，不调用c.Next()，避免在认证完成前执行后续处理函数
+func requirePrivateNetwork(c *gin.Context) bool {
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil || !(ip.IsLoopback() || ip.IsPrivate()) {
+		logger.GetLogger().Warnf("拒绝来自 %s 的运维接口访问: %s", c.ClientIP(), c.Request.URL.Path)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return false
+	}
+	return true
+}
+
+// AdminAuth 管理接口认证：只允许内网访问，且X-Admin-Token需与配置的admin.token一致
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requirePrivateNetwork(c) {
+			return
+		}
+		provided := c.GetHeader("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			logger.GetLogger().Warnf("管理接口认证失败: %s %s", c.ClientIP(), c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Set("admin", true)
+		c.Next()
+	}
+}
+
+// MetricsAuth 指标接口认证：只允许内网访问，配置了token时还需携带Authorization: Bearer <token>
+func MetricsAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requirePrivateNetwork(c) {
+			return
+		}
+		if token == "" {
+			c.Next()
+			return
+		}
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			logger.GetLogger().Warnf("指标接口认证失败: %s %s", c.ClientIP(), c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
 // RequestSizeLimit 请求大小限制中间件
 func RequestSizeLimit(maxSize int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -452,6 +546,27 @@ func RequestSizeLimit(maxSize int64) gin.HandlerFunc {
 	}
 }
 
+// RequestSizeLimitByRoute 按路由设置请求大小上限（如文件上传），未列出的路由使用默认上限
+// routeLimits按配置计算各路由的上限，配置热加载后重新计算
+func RequestSizeLimitByRoute(cfg *config.Config, defaultSize int64, routeLimits func(cfg *config.Config) map[string]int64) gin.HandlerFunc {
+	var current atomic.Pointer[map[string]int64]
+	limits := routeLimits(cfg)
+	current.Store(&limits)
+	config.OnReload(func(next *config.Config) {
+		limits := routeLimits(next)
+		current.Store(&limits)
+	})
+
+	return func(c *gin.Context) {
+		maxSize := defaultSize
+		if limit, ok := (*current.Load())[c.FullPath()]; ok {
+			maxSize = limit
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+		c.Next()
+	}
+}
+
 // UserAgentFilter 用户代理过滤中间件
 func UserAgentFilter() gin.HandlerFunc {
 	// 恶意或可疑的用户代理模式
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/utils"
+)
+
+// RequestTimeout 请求超时中间件：请求的context在server.request_timeout后取消，使用该context的数据库查询随之中断
+// 处理函数在超时后写出的响应（通常是查询被取消导致的500）统一替换为503
+func RequestTimeout(cfg *config.ServerConfig) gin.HandlerFunc {
+	timeout, err := time.ParseDuration(cfg.RequestTimeout)
+	if err != nil || timeout <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		for _, prefix := range cfg.TimeoutExcludedPaths {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		w := &timeoutWriter{ResponseWriter: c.Writer, c: c}
+		c.Writer = w
+		c.Next()
+
+		// 处理函数超时后没有写响应
+		if !w.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			w.writeTimeout()
+		}
+	}
+}
+
+// timeoutWriter 开始写响应时检查是否已超时，已超时则改为输出503并丢弃处理函数的响应
+type timeoutWriter struct {
+	gin.ResponseWriter
+	c        *gin.Context
+	checked  bool
+	timedOut bool
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if w.check() {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if w.check() {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.check() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// check 首次写响应时检查context，返回是否已超时
+func (w *timeoutWriter) check() bool {
+	if !w.checked {
+		w.checked = true
+		if errors.Is(w.c.Request.Context().Err(), context.DeadlineExceeded) {
+			w.writeTimeout()
+		}
+	}
+	return w.timedOut
+}
+
+// writeTimeout 输出503超时响应
+func (w *timeoutWriter) writeTimeout() {
+	w.checked, w.timedOut = true, true
+	logger.WithContext(w.c.Request.Context()).Warnf("请求处理超时: %s %s", w.c.Request.Method, w.c.Request.URL.Path)
+
+	body, _ := json.Marshal(utils.WithRequestID(w.c, utils.ErrorResponse(http.StatusServiceUnavailable, "Request timeout")))
+	header := w.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Del("Content-Disposition")
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	w.ResponseWriter.Write(body)
+}
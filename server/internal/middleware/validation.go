@@ -7,6 +7,7 @@ import (
 	"github.com/go-playground/validator/v10"
 
 	"gochat/internal/errors"
+	"gochat/internal/utils"
 )
 
 // 全局验证器实例
@@ -37,162 +38,31 @@ func registerCustomValidations() {
 	validate.RegisterValidation("content", validateContent)
 }
 
-// validatePhoneSecure 安全的手机号验证
+// validatePhoneSecure 手机号验证
 func validatePhoneSecure(fl validator.FieldLevel) bool {
-	phone := fl.Field().String()
-
-	// 基本长度检查
-	if len(phone) != 11 {
-		return false
-	}
-
-	// 必须以1开头（中国手机号）
-	if phone[0] != '1' {
-		return false
-	}
-
-	// 检查是否全为数字
-	for _, c := range phone {
-		if c < '0' || c > '9' {
-			return false
-		}
-	}
-
-	// 检查常见的无效号码模式
-	invalidPatterns := []string{
-		"11111111111", "12345678901", "00000000000",
-		"99999999999", "10000000000",
-	}
-
-	for _, pattern := range invalidPatterns {
-		if phone == pattern {
-			return false
-		}
-	}
-
-	return true
+	return utils.ValidatePhone(fl.Field().String())
 }
 
-// validatePasswordSecure 增强的密码验证
+// validatePasswordSecure 密码验证：只检查长度和字符集，引号、分号等标点都是合法字符
 func validatePasswordSecure(fl validator.FieldLevel) bool {
-	password := fl.Field().String()
-
-	// 长度检查
-	if len(password) < 6 || len(password) > 128 {
-		return false
-	}
-
-	// 检查危险字符
-	dangerousChars := []string{
-		"<script", "</script", "javascript:", "vbscript:",
-		"<iframe", "</iframe", "onload=", "onerror=",
-		"<object", "</object", "data:", "src=",
-	}
-
-	lowercasePassword := strings.ToLower(password)
-	for _, dangerous := range dangerousChars {
-		if strings.Contains(lowercasePassword, dangerous) {
-			return false
-		}
-	}
-
-	// 检查SQL注入模式
-	sqlPatterns := []string{
-		"'", "\"", ";", "--", "/*", "*/",
-		" or ", " and ", " union ", " select ",
-		" drop ", " delete ", " insert ", " update ",
-	}
-
-	for _, pattern := range sqlPatterns {
-		if strings.Contains(lowercasePassword, pattern) {
-			return false
-		}
-	}
-
-	return true
+	return utils.ValidatePassword(fl.Field().String())
 }
 
-// validateNicknameSecure 增强的昵称验证
+// validateNicknameSecure 昵称验证
 func validateNicknameSecure(fl validator.FieldLevel) bool {
-	nickname := fl.Field().String()
-
-	// 长度检查
-	if len(nickname) < 1 || len(nickname) > 50 {
-		return false
-	}
-
-	// 禁止的关键词
-	forbidden := []string{
-		"admin", "administrator", "root", "system", "null", "undefined",
-		"<script", "</script", "javascript", "vbscript", "select", "drop",
-		"delete", "update", "insert", "union", "exec", "script",
-	}
-
-	lowercaseNickname := strings.ToLower(strings.TrimSpace(nickname))
-
-	for _, word := range forbidden {
-		if strings.Contains(lowercaseNickname, word) {
-			return false
-		}
-	}
-
-	// 检查特殊字符模式
-	if strings.Contains(nickname, "<") || strings.Contains(nickname, ">") ||
-	   strings.Contains(nickname, "&lt;") || strings.Contains(nickname, "&gt;") ||
-	   strings.Contains(nickname, "&#") || strings.Contains(nickname, "%3C") {
-		return false
-	}
-
-	return true
+	return utils.ValidateNickname(fl.Field().String())
 }
 
-// validateSafeString 通用安全字符串验证
+// validateSafeString 单行文本验证：不超过1000个字符，不包含控制字符
 func validateSafeString(fl validator.FieldLevel) bool {
-	str := fl.Field().String()
-
-	// 检查XSS模式
-	xssPatterns := []string{
-		"<script", "</script", "javascript:", "vbscript:",
-		"onload=", "onerror=", "onmouseover=", "onclick=",
-		"<iframe", "<object", "<embed", "<applet",
-		"&#x", "&#", "%3C", "%3E", "%22", "%27",
-	}
-
-	lowerStr := strings.ToLower(str)
-	for _, pattern := range xssPatterns {
-		if strings.Contains(lowerStr, pattern) {
-			return false
-		}
-	}
-
-	// 检查SQL注入模式
-	sqlPatterns := []string{
-		"'", "\"", ";", "--", "/*", "*/",
-		" or 1=1", " and 1=1", " union select",
-		" drop table", " delete from", " insert into",
-		" update ", " exec ", " xp_",
-	}
-
-	for _, pattern := range sqlPatterns {
-		if strings.Contains(lowerStr, pattern) {
-			return false
-		}
-	}
-
-	return true
+	return utils.ValidatePlainText(fl.Field().String(), 1000)
 }
 
 // validateContent 消息内容验证
 func validateContent(fl validator.FieldLevel) bool {
 	content := fl.Field().String()
 
-	// 长度检查
-	if len(content) > 5000 { // 消息内容不超过5000字符
-		return false
-	}
-
-	// 检查是否为纯空白字符
-	if strings.TrimSpace(content) == "" && content != "" {
+	if !utils.ValidateMessageText(content) {
 		return false
 	}
 
@@ -236,20 +106,9 @@ func checkRepeatingPattern(content string) bool {
 // ValidateJSON 验证JSON请求体中间件（增强版）
 func ValidateJSON(model interface{}) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 获取清理后的上下文
-		if sanitized, exists := c.Get("sanitized"); exists {
-			if sanitizedCtx, ok := sanitized.(*SanitizedContext); ok {
-				if err := sanitizedCtx.SanitizeJSON(model); err != nil {
-					handleValidationError(c, err)
-					return
-				}
-			}
-		} else {
-			// 回退到标准验证
-			if err := c.ShouldBindJSON(model); err != nil {
-				handleValidationError(c, err)
-				return
-			}
+		if err := c.ShouldBindJSON(model); err != nil {
+			handleValidationError(c, err)
+			return
 		}
 
 		// 验证模型字段
@@ -296,13 +155,13 @@ func formatFieldErrorSecure(fieldErr validator.FieldError) string {
 	case "phone":
 		return field + " must be a valid 11-digit Chinese mobile number"
 	case "password":
-		return field + " must be 6-128 characters and contain only safe characters"
+		return field + " must be 6-20 characters without control characters"
 	case "nickname":
-		return field + " must be 1-50 characters and contain only safe characters"
+		return field + " must be 2-20 characters without control characters or surrounding spaces"
 	case "safestring":
-		return field + " contains unsafe characters"
+		return field + " must be a single line of at most 1000 characters"
 	case "content":
-		return field + " contains invalid or unsafe content"
+		return field + " must be 1-5000 characters and not repetitive spam"
 	case "len":
 		return field + " must be exactly " + fieldErr.Param() + " characters"
 	case "oneof":
@@ -330,13 +189,6 @@ func ValidateQuery(rules map[string]string) gin.HandlerFunc {
 			}
 
 			if value != "" {
-				// 首先进行安全清理
-				if sanitized, exists := c.Get("sanitized"); exists {
-					if sanitizedCtx, ok := sanitized.(*SanitizedContext); ok {
-						value = sanitizedCtx.SanitizeString(value)
-					}
-				}
-
 				// 应用验证规则
 				switch rule {
 				case "numeric":
@@ -344,11 +196,11 @@ func ValidateQuery(rules map[string]string) gin.HandlerFunc {
 						errorMessages = append(errorMessages, param+" must be numeric")
 					}
 				case "safestring":
-					if !isSafeString(value) {
-						errorMessages = append(errorMessages, param+" contains unsafe characters")
+					if !utils.ValidatePlainText(value, 1000) {
+						errorMessages = append(errorMessages, param+" must be a single line of at most 1000 characters")
 					}
 				case "phone":
-					if !isValidPhoneNumber(value) {
+					if !utils.ValidatePhone(value) {
 						errorMessages = append(errorMessages, param+" must be a valid phone number")
 					}
 				}
@@ -379,49 +231,11 @@ func isNumericSecure(s string) bool {
 	return true
 }
 
-// isSafeString 检查字符串是否安全
-func isSafeString(s string) bool {
-	// 检查长度
-	if len(s) > 1000 {
-		return false
-	}
-
-	// 检查危险模式
-	dangerousPatterns := []string{
-		"<script", "</script", "javascript:", "vbscript:",
-		"<iframe", "<object", "<embed", "onload=", "onerror=",
-		"'", "\"", ";", "--", "/*", "*/", "union select",
-		"drop table", "delete from", "insert into", "update ",
-		"&#", "%3C", "%3E", "%22", "%27",
-	}
-
-	lowerStr := strings.ToLower(s)
-	for _, pattern := range dangerousPatterns {
-		if strings.Contains(lowerStr, pattern) {
-			return false
-		}
-	}
-
-	return true
-}
-
-// isValidPhoneNumber 验证手机号
-func isValidPhoneNumber(phone string) bool {
-	return len(phone) == 11 && phone[0] == '1' && isNumericSecure(phone)
-}
-
 // ValidateParam 路径参数验证中间件（增强版）
 func ValidateParam(paramName string, validator func(string) bool, errorMessage string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		value := c.Param(paramName)
 
-		// 安全清理
-		if sanitized, exists := c.Get("sanitized"); exists {
-			if sanitizedCtx, ok := sanitized.(*SanitizedContext); ok {
-				value = sanitizedCtx.SanitizeString(value)
-			}
-		}
-
 		if !validator(value) {
 			errors.HandleBadRequest(c, errorMessage)
 			return
@@ -470,14 +284,6 @@ func PaginationValidation() gin.HandlerFunc {
 		page := c.DefaultQuery("page", "1")
 		pageSize := c.DefaultQuery("page_size", "20")
 
-		// 清理输入
-		if sanitized, exists := c.Get("sanitized"); exists {
-			if sanitizedCtx, ok := sanitized.(*SanitizedContext); ok {
-				page = sanitizedCtx.SanitizeString(page)
-				pageSize = sanitizedCtx.SanitizeString(pageSize)
-			}
-		}
-
 		if !isNumericSecure(page) || !isPositiveIntSecure(page) {
 			errors.HandleBadRequest(c, "page must be a positive integer")
 			return
@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+
+	"gochat/internal/idgen"
 )
 
 // 消息类型常量
@@ -11,7 +13,9 @@ const (
 	MessageTypeText  = 1 // 文本消息
 	MessageTypeImage = 2 // 图片消息
 	MessageTypeVoice = 3 // 语音消息（预留）
-	MessageTypeVideo = 4 // 视频消息（预留）
+	MessageTypeVideo = 4 // 视频消息
+	MessageTypeFile  = 5 // 文件消息，内容为JSON：{"url","name","size"}
+	MessageTypeCall  = 6 // 通话记录（未接来电），由服务端生成，内容为JSON：{"call_id","media","status"}
 )
 
 // 会话类型常量
@@ -29,6 +33,16 @@ type User struct {
 	Avatar    string         `json:"avatar" gorm:"size:255;default:'default.png'"`
 	Gender    int            `json:"gender" gorm:"default:0"`           // 0-未设置 1-男 2-女
 	Signature string         `json:"signature" gorm:"size:200;default:''"`  // 个性签名
+	Email     string         `json:"-" gorm:"size:255;default:''"`          // 接收安全提醒、离线消息摘要和登录验证码的邮箱，为空时不发送邮件
+	EmailAlertsOptOut bool   `json:"-" gorm:"default:false"`              // 不接收安全提醒邮件（登录验证码仍会发送）
+	EmailDigestOptOut bool   `json:"-" gorm:"default:false"`              // 不接收离线消息摘要邮件
+	KeepArchived bool        `json:"-" gorm:"default:false"`              // 已归档的会话收到新消息时保持归档，不自动取消归档
+	IsBot     bool           `json:"is_bot" gorm:"default:false"`           // 群机器人账号，不能登录，只能通过Webhook发消息
+	Role      string         `json:"-" gorm:"size:20;default:''"`           // 管理后台角色：support/moderator/admin，为空表示普通用户
+	SuspendedUntil *time.Time `json:"-"`                                   // 停用截止时间，期间不能登录
+	BannedAt  *time.Time     `json:"-"`                                     // 永久封禁时间，不为空时不能登录
+	SuspendReason string     `json:"-" gorm:"size:255;default:''"`        // 停用或封禁原因
+	MutedUntil *time.Time    `json:"-"`                                     // 禁言截止时间，期间不能发消息
 
 	// 关联字段（不序列化）
 	Friends          []FriendRelation `json:"-" gorm:"foreignKey:UserID"`
@@ -88,7 +102,8 @@ type Message struct {
 	Content    string `json:"content" gorm:"type:text;not null"`
 	MsgType    int    `json:"msg_type" gorm:"default:1"`        // 1-文本
 
-	CreatedAt time.Time `json:"created_at"`
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"` // 软删除（对所有人删除）
 
 	// 关联
 	FromUser User `json:"-" gorm:"foreignKey:FromUserID"`
@@ -96,6 +111,54 @@ type Message struct {
 	Group    *Group `json:"-" gorm:"foreignKey:GroupID"`
 }
 
+// BeforeCreate 写入前分配按时间递增的消息ID，多实例无需通过数据库自增列协调
+// 保留列的自增属性，兼容滚动升级期间仍由旧版本写入的消息
+func (m *Message) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == 0 {
+		m.ID = idgen.NextID()
+	}
+	return nil
+}
+
+// ArchivedMessage 归档消息模型 - 超过保留期的消息从messages移入此表，保持热表较小
+// 保留原消息ID，不建外键，便于按原ID追溯
+type ArchivedMessage struct {
+	ID         int64  `json:"id" gorm:"primaryKey;autoIncrement:false"`
+	FromUserID int64  `json:"from_user_id" gorm:"not null;index:idx_messages_archive_private,priority:1"`
+	ToUserID   *int64 `json:"to_user_id" gorm:"default:null;index:idx_messages_archive_private,priority:2"`
+	GroupID    *int64 `json:"group_id" gorm:"default:null;index:idx_messages_archive_group,priority:1"`
+	Content    string `json:"content" gorm:"type:text;not null"`
+	MsgType    int    `json:"msg_type" gorm:"default:1"`
+
+	CreatedAt  time.Time      `json:"created_at" gorm:"index:idx_messages_archive_private,priority:3;index:idx_messages_archive_group,priority:2"`
+	ArchivedAt time.Time      `json:"archived_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// MessageDeletion 消息删除记录 - 用户"仅为自己删除"的消息，查询历史时对该用户隐藏
+// message_id 可能指向热表或归档表中的消息，因此不建外键
+type MessageDeletion struct {
+	ID        int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+	MessageID int64 `json:"message_id" gorm:"not null;uniqueIndex:idx_message_deletions_msg_user,priority:1"`
+	UserID    int64 `json:"user_id" gorm:"not null;uniqueIndex:idx_message_deletions_msg_user,priority:2"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OutboxEvent 发件箱事件 - 与业务数据在同一事务中写入，由后台中继投递（至少一次）
+type OutboxEvent struct {
+	ID            int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	EventType     string     `json:"event_type" gorm:"size:50;not null"`
+	AggregateID   int64      `json:"aggregate_id" gorm:"not null"` // 关联的业务ID（如消息ID）
+	Payload       string     `json:"payload" gorm:"type:text"`     // JSON负载
+	Attempts      int        `json:"attempts" gorm:"default:0;not null"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index:idx_outbox_events_pending,priority:2"` // 到期后中继才会重新投递
+	PublishedAt   *time.Time `json:"published_at" gorm:"default:null;index:idx_outbox_events_pending,priority:1"`
+	LastError     string     `json:"last_error" gorm:"size:500"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // Conversation 会话模型
 type Conversation struct {
 	ID          int64  `json:"id" gorm:"primaryKey;autoIncrement"`
@@ -103,7 +166,14 @@ type Conversation struct {
 	Type        int    `json:"type" gorm:"not null"`        // 1-单聊 2-群聊
 	TargetID    int64  `json:"target_id" gorm:"not null"`   // 好友ID或群组ID
 	LastMsgID   *int64 `json:"last_msg_id" gorm:"default:null"` // 最后一条消息ID
-	UnreadCount int    `json:"unread_count" gorm:"default:0"`
+	LastReadMsgID int64 `json:"last_read_msg_id" gorm:"default:0;not null"` // 已读位置，之后他人发送的消息为未读
+	UnreadCount int    `json:"unread_count" gorm:"-"`         // 未读数，查询时按已读位置统计
+	IsMuted     bool   `json:"is_muted" gorm:"default:false"`  // 免打扰
+	MutedUntil  *time.Time `json:"muted_until" gorm:"default:null"` // 免打扰截止时间，为空表示一直免打扰直到取消
+	HideUnread  bool       `json:"hide_unread" gorm:"default:false"` // 免打扰期间不显示未读数，不计入角标
+	IsPinned    bool   `json:"is_pinned" gorm:"default:false"` // 置顶
+	PinnedAt    *time.Time `json:"pinned_at" gorm:"default:null"` // 置顶时间，置顶的会话按置顶时间倒序排列
+	IsArchived  bool       `json:"is_archived" gorm:"default:false"` // 已归档，不在会话列表中显示
 
 	UpdatedAt time.Time `json:"updated_at"`
 
@@ -128,11 +198,12 @@ type FileStorage struct {
 
 // FileReference 文件引用模型 - 记录文件使用关系
 type FileReference struct {
-	ID      int64  `json:"id" gorm:"primaryKey;autoIncrement"`
-	FileID  int64  `json:"file_id" gorm:"index:idx_file_id;not null"`  // 关联file_storage.id
-	UserID  int64  `json:"user_id" gorm:"index:idx_user_id;not null"`  // 哪个用户使用
-	RefType string `json:"ref_type" gorm:"index:idx_ref_type;size:20"` // avatar/chat_image
-	RefID   int64  `json:"ref_id" gorm:"index:idx_ref_id"`              // 业务ID（消息ID等）
+	ID       int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	FileID   int64  `json:"file_id" gorm:"index:idx_file_id;not null"`  // 关联file_storage.id
+	UserID   int64  `json:"user_id" gorm:"index:idx_user_id;not null"`  // 哪个用户使用
+	RefType  string `json:"ref_type" gorm:"index:idx_ref_type;size:20"` // avatar/chat_image
+	RefID    int64  `json:"ref_id" gorm:"index:idx_ref_id"`              // 业务ID（消息ID等）
+	FileName string `json:"file_name" gorm:"size:255"`                   // 文件消息使用的原始文件名，同一内容可能以不同文件名发送
 
 	CreatedAt time.Time      `json:"created_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"` // 软删除
@@ -142,12 +213,221 @@ type FileReference struct {
 	User User        `json:"-" gorm:"foreignKey:UserID"`
 }
 
+// APIKey 服务集成（机器人、内部服务）使用的API密钥，以绑定的用户身份调用授权范围内的接口
+// 只保存密钥的SHA256，明文仅在创建时返回一次
+type APIKey struct {
+	ID         int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	Prefix     string     `json:"prefix" gorm:"size:16"`          // 密钥前几位，便于识别
+	UserID     int64      `json:"user_id" gorm:"index;not null"`  // 调用时使用的用户身份（机器人或服务账号）
+	Scopes     string     `json:"scopes" gorm:"size:500"`         // 授权范围，逗号分隔
+	ExpiresAt  *time.Time `json:"expires_at" gorm:"default:null"` // 为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at" gorm:"default:null"`
+	RevokedAt  *time.Time `json:"revoked_at" gorm:"default:null"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Bot 群机器人：群主创建，以机器人账号（users.is_bot）的身份加入群
+// 外部系统通过带令牌的Incoming Webhook地址向群里发消息；配置了outgoing_url时，群里的新消息以签名的JSON推送到该地址
+type Bot struct {
+	ID             int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID         int64  `json:"user_id" gorm:"uniqueIndex;not null"` // 机器人账号
+	GroupID        int64  `json:"group_id" gorm:"index;not null"`
+	CreatorID      int64  `json:"creator_id" gorm:"not null"`
+	Name           string `json:"name" gorm:"size:50;not null"`
+	TokenHash      string `json:"-" gorm:"uniqueIndex;size:64;not null"` // Incoming Webhook令牌的SHA-256
+	TokenPrefix    string `json:"token_prefix" gorm:"size:16"`          // 令牌前几位，便于识别
+	OutgoingURL    string `json:"outgoing_url" gorm:"size:500;default:''"`
+	OutgoingSecret string `json:"-" gorm:"size:64;default:''"` // Outgoing Webhook的签名密钥
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IPBan IP封禁记录，IP可以是单个地址或CIDR网段
+// 手动封禁来自管理接口，自动封禁来自登录爆破、认证失败和频繁触发限流的检测
+type IPBan struct {
+	ID        int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	IP        string     `json:"ip" gorm:"uniqueIndex;size:64;not null"`
+	Reason    string     `json:"reason" gorm:"size:255"`
+	Source    string     `json:"source" gorm:"size:20;not null"`       // manual-手动, auto-自动
+	ExpiresAt *time.Time `json:"expires_at" gorm:"index;default:null"` // 为空表示永久封禁
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AuditLog 敏感操作审计记录（认证、资料修改、群管理、删除好友、管理接口调用）
+type AuditLog struct {
+	ID         int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	ActorID    int64  `json:"actor_id" gorm:"index"`              // 操作者用户ID，匿名请求和管理接口为0
+	ActorType  string `json:"actor_type" gorm:"size:20;not null"` // user/api_key/admin/anonymous
+	Action     string `json:"action" gorm:"size:50;index;not null"`
+	TargetType string `json:"target_type" gorm:"size:30;index:idx_audit_target"`
+	TargetID   int64  `json:"target_id" gorm:"index:idx_audit_target"`
+	IP         string `json:"ip" gorm:"size:64"`
+	RequestID  string `json:"request_id" gorm:"size:64"`
+	Detail     string `json:"detail" gorm:"type:text"` // JSON格式的补充信息
+
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// UserDevice 账号登录过的设备，用于识别新设备和新地区的登录
+type UserDevice struct {
+	ID          int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID      int64  `json:"user_id" gorm:"not null;uniqueIndex:idx_user_device"`
+	Fingerprint string `json:"-" gorm:"size:64;not null;uniqueIndex:idx_user_device"` // 客户端设备ID和User-Agent的SHA-256
+	Name        string `json:"name" gorm:"size:255"`                                 // User-Agent
+	LastIP      string `json:"last_ip" gorm:"size:64"`
+	LastRegion  string `json:"last_region" gorm:"size:64"` // 地区代码或IP网段
+
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// Report 用户对消息或其他用户的举报，由管理后台审核处理
+// 同一对象的举报一起处理，处理后通知所有举报人
+type Report struct {
+	ID             int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReporterID     int64      `json:"reporter_id" gorm:"index;not null"`
+	TargetType     string     `json:"target_type" gorm:"size:20;not null;index:idx_report_target"` // message/user
+	TargetID       int64      `json:"target_id" gorm:"not null;index:idx_report_target"`
+	ReportedUserID int64      `json:"reported_user_id" gorm:"index;not null"` // 被举报的用户，举报消息时为消息发送者
+	Reason         string     `json:"reason" gorm:"size:20;not null"`         // spam/harassment/fraud/illegal/other
+	Description    string     `json:"description" gorm:"size:500;default:''"`
+	Snapshot       string     `json:"snapshot" gorm:"type:text"`            // 举报时的消息内容，消息被删除后仍可审核
+	Status         string     `json:"status" gorm:"size:20;not null;index"` // open/reviewing/resolved
+	AssigneeID     int64      `json:"assignee_id" gorm:"default:0"`         // 正在处理的审核员
+	Action         string     `json:"action" gorm:"size:20;default:''"`     // 处理结果：dismiss/delete_message/warn/mute/ban
+	ResolutionNote string     `json:"resolution_note" gorm:"size:500;default:''"`
+	ResolvedBy     int64      `json:"resolved_by" gorm:"default:0"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Call 一对一音视频通话记录，信令经WebSocket转发，媒体流由客户端之间通过WebRTC直连
+type Call struct {
+	ID         int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	CallerID   int64      `json:"caller_id" gorm:"index;not null"`
+	CalleeID   int64      `json:"callee_id" gorm:"index;not null"`
+	Media      string     `json:"media" gorm:"size:10;not null"`  // audio/video
+	Status     string     `json:"status" gorm:"size:20;not null"` // ringing/active/ended/missed/rejected/busy/canceled
+	EndReason  string     `json:"end_reason" gorm:"size:30;default:''"`
+	AnsweredAt *time.Time `json:"answered_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+	Duration   int        `json:"duration" gorm:"default:0"` // 接通时长（秒）
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DataExport 用户数据导出任务，由后台任务生成包含个人资料、好友、群组、消息和文件信息的压缩包
+// 运行中的任务按updated_at续租，实例退出后超过租期的任务由其他实例重新领取
+type DataExport struct {
+	ID          int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID      int64      `json:"-" gorm:"index;not null"`
+	Status      string     `json:"status" gorm:"size:20;not null;index"` // pending/running/completed/failed/expired
+	Progress    int        `json:"progress" gorm:"default:0;not null"`   // 0-100
+	Attempts    int        `json:"-" gorm:"default:0;not null"`
+	Error       string     `json:"error,omitempty" gorm:"size:500;default:''"`
+	FileSize    int64      `json:"file_size" gorm:"default:0"`
+	StoragePath string     `json:"-" gorm:"size:512;default:''"` // 本地文件路径或对象存储的键
+	Remote      bool       `json:"-" gorm:"default:false"`       // 压缩包在对象存储中
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"` // 过期后删除压缩包，不能再下载
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MessageStatHourly 每小时（UTC）的消息数，按会话类型和消息类型分别统计，由统计汇总任务从消息表计算
+type MessageStatHourly struct {
+	ID       int64     `json:"-" gorm:"primaryKey;autoIncrement"`
+	Hour     time.Time `json:"hour" gorm:"not null;uniqueIndex:idx_message_stat_hour,priority:1"`      // 整点
+	ChatType int       `json:"chat_type" gorm:"not null;uniqueIndex:idx_message_stat_hour,priority:2"` // 1=单聊, 2=群聊
+	MsgType  int       `json:"msg_type" gorm:"not null;uniqueIndex:idx_message_stat_hour,priority:3"`
+	Count    int64     `json:"count" gorm:"not null;default:0"`
+}
+
+// UserActivityDay 用户在某天（UTC）活跃过，用于精确的活跃用户数和留存统计
+// 来源：当天发送过消息，或通过HTTP认证、建立连接被记录为活跃
+type UserActivityDay struct {
+	ID     int64     `json:"-" gorm:"primaryKey;autoIncrement"`
+	Day    time.Time `json:"day" gorm:"not null;uniqueIndex:idx_user_activity_day,priority:1"` // 当天零点
+	UserID int64     `json:"user_id" gorm:"not null;uniqueIndex:idx_user_activity_day,priority:2;index"`
+}
+
+// GroupActivityDay 群在某天（UTC）的消息数和发言人数，用于群活跃度排行
+type GroupActivityDay struct {
+	ID       int64     `json:"-" gorm:"primaryKey;autoIncrement"`
+	Day      time.Time `json:"day" gorm:"not null;uniqueIndex:idx_group_activity_day,priority:1"`
+	GroupID  int64     `json:"group_id" gorm:"not null;uniqueIndex:idx_group_activity_day,priority:2;index"`
+	Messages int64     `json:"messages" gorm:"not null;default:0"`
+	Senders  int64     `json:"senders" gorm:"not null;default:0"`
+}
+
+// Announcement 系统公告，audience为segment时只推送给同时满足所有定向条件的用户
+type Announcement struct {
+	ID               int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Title            string     `json:"title" gorm:"size:100;not null"`
+	Content          string     `json:"content" gorm:"type:text;not null"`
+	Audience         string     `json:"audience" gorm:"size:10;not null"`     // all/segment
+	TargetUsers      int        `json:"target_users" gorm:"default:0"`        // 按用户ID定向的用户数，用户ID保存在announcement_targets
+	TargetGroupID    int64      `json:"target_group_id" gorm:"default:0"`     // 只推送给该群的成员
+	RegisteredAfter  *time.Time `json:"registered_after"`                     // 只推送给在此之后注册的用户
+	RegisteredBefore *time.Time `json:"registered_before"`                    // 只推送给在此之前注册的用户
+	Status           string     `json:"status" gorm:"size:20;not null;index"` // scheduled/published/cancelled
+	PublishAt        time.Time  `json:"publish_at" gorm:"not null;index"`
+	ExpiresAt        *time.Time `json:"expires_at"` // 过期后不再返回给用户
+	PublishedAt      *time.Time `json:"published_at"`
+	CancelledAt      *time.Time `json:"cancelled_at"`
+	CreatedBy        int64      `json:"created_by" gorm:"not null"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AnnouncementTarget 按用户ID定向的公告的目标用户
+type AnnouncementTarget struct {
+	ID             int64 `json:"-" gorm:"primaryKey;autoIncrement"`
+	AnnouncementID int64 `json:"announcement_id" gorm:"not null;uniqueIndex:idx_announcement_target,priority:1"`
+	UserID         int64 `json:"user_id" gorm:"not null;uniqueIndex:idx_announcement_target,priority:2"`
+}
+
+// AnnouncementRead 用户已读公告的记录
+type AnnouncementRead struct {
+	ID             int64     `json:"-" gorm:"primaryKey;autoIncrement"`
+	AnnouncementID int64     `json:"announcement_id" gorm:"not null;uniqueIndex:idx_announcement_read,priority:1"`
+	UserID         int64     `json:"user_id" gorm:"not null;uniqueIndex:idx_announcement_read,priority:2;index"`
+	ReadAt         time.Time `json:"read_at"`
+}
+
 // TableName 指定表名
-func (User) TableName() string           { return "users" }
-func (FriendRelation) TableName() string { return "friend_relations" }
-func (Group) TableName() string          { return "groups" }
-func (GroupMember) TableName() string    { return "group_members" }
-func (Message) TableName() string        { return "messages" }
-func (Conversation) TableName() string   { return "conversations" }
-func (FileStorage) TableName() string    { return "file_storage" }
-func (FileReference) TableName() string  { return "file_references" }
+func (User) TableName() string            { return "users" }
+func (FriendRelation) TableName() string  { return "friend_relations" }
+func (Group) TableName() string           { return "groups" }
+func (GroupMember) TableName() string     { return "group_members" }
+func (Message) TableName() string         { return "messages" }
+func (ArchivedMessage) TableName() string { return "messages_archive" }
+func (MessageDeletion) TableName() string { return "message_deletions" }
+func (OutboxEvent) TableName() string     { return "outbox_events" }
+func (Conversation) TableName() string    { return "conversations" }
+func (FileStorage) TableName() string     { return "file_storage" }
+func (FileReference) TableName() string   { return "file_references" }
+func (APIKey) TableName() string          { return "api_keys" }
+func (IPBan) TableName() string           { return "ip_bans" }
+func (AuditLog) TableName() string        { return "audit_logs" }
+func (UserDevice) TableName() string      { return "user_devices" }
+func (Report) TableName() string          { return "reports" }
+func (Call) TableName() string            { return "calls" }
+func (DataExport) TableName() string      { return "data_exports" }
+func (MessageStatHourly) TableName() string { return "analytics_message_hourly" }
+func (UserActivityDay) TableName() string   { return "analytics_user_days" }
+func (GroupActivityDay) TableName() string  { return "analytics_group_days" }
+func (Announcement) TableName() string       { return "announcements" }
+func (AnnouncementTarget) TableName() string { return "announcement_targets" }
+func (AnnouncementRead) TableName() string   { return "announcement_reads" }
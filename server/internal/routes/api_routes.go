@@ -1,11 +1,16 @@
 package routes
 
 import (
+	"context"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 
 	"gochat/internal/config"
 	"gochat/internal/handlers"
+	"gochat/internal/logger"
 	"gochat/internal/middleware"
+	"gochat/internal/services"
 	"gochat/internal/websocket"
 )
 
@@ -18,49 +23,99 @@ func SetupAPIRoutes(r *gin.Engine, cfg *config.Config) {
 	messageHandler := handlers.NewMessageHandler(cfg)
 	onlineHandler := handlers.NewOnlineHandler(cfg)
 	uploadHandler := handlers.NewUploadHandler(cfg)
+	fileHandler := handlers.NewFileHandler(cfg)
 	groupHandler := handlers.NewGroupHandler(cfg)
 
 	// 设置全局安全中间件（按顺序应用）
-	r.Use(middleware.SecurityHeaders())        // 安全头
-	r.Use(middleware.RequestSizeLimit(10 << 20)) // 10MB请求大小限制
+	r.Use(middleware.SecurityHeaders(&cfg.Headers)) // 安全头（使用配置）
+	r.Use(middleware.RequestSizeLimitByRoute(cfg, 10<<20, uploadSizeLimits)) // 10MB请求大小限制（上传路由除外）
 	r.Use(middleware.UserAgentFilter())        // 用户代理过滤
 	r.Use(middleware.CORS(&cfg.CORS))          // 跨域（使用配置）
+	r.Use(middleware.RequestID())              // 请求ID
 	r.Use(middleware.RequestLogger())          // 日志
+	r.Use(middleware.HTTPMetrics())            // 请求耗时和状态码指标
+	r.Use(middleware.Compression(&cfg.Compression)) // 响应压缩
 	r.Use(middleware.Recovery())               // 错误恢复
+	r.Use(middleware.ConcurrencyLimit(&cfg.Concurrency)) // 并发请求限制，超出上限立即拒绝
+	r.Use(middleware.RequestTimeout(&cfg.Server)) // 接口处理超时
+
+	// IP封禁（在速率限制之前检查，限流、登录失败和认证失败计入自动封禁）
+	var ipBanService *services.IPBanService
+	if cfg.IPBan.Enabled {
+		ipBanService = services.NewIPBanService(&cfg.IPBan)
+		if err := ipBanService.Reload(context.Background()); err != nil {
+			logger.GetLogger().Errorf("加载IP封禁列表失败: %v", err)
+		}
+		r.Use(middleware.IPBlocklist(ipBanService))
+	}
 
 	// 静态文件服务 - 确保CORS头正确应用
-	staticGroup := r.Group("/uploads")
-	staticGroup.Use(middleware.CORS(&cfg.CORS)) // 确保静态文件也有CORS头
-	staticGroup.Static("", "./uploads")
-
-	// 配置速率限制
-	rateLimitConfig := &middleware.RateLimitConfig{
-		GlobalRPS:    100, // 100 requests per second per user/IP
-		GlobalBurst:  200, // burst of 200 requests
-		AuthRPS:      5,   // 5 auth requests per second (stricter for auth)
-		AuthBurst:    10,  // burst of 10 auth requests
-		MessageRPS:   10,  // 10 messages per second
-		MessageBurst: 20,  // burst of 20 messages
-		UploadRPS:    3,   // 3 uploads per second
-		UploadBurst:  5,   // burst of 5 uploads
-	}
-
-	// 应用速率限制
-	r.Use(middleware.RateLimit(rateLimitConfig))
-
-	// 健康检查端点（不需要任何认证或限制）
-	r.GET("/api/v1/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "ok",
-			"message": "GoChat API is running",
-		})
-	})
+	// 静态目录不校验权限，关闭后文件只能通过/api/v1/file或签名链接访问
+	if cfg.Upload.PublicStatic {
+		staticGroup := r.Group("/uploads")
+		staticGroup.Use(middleware.CORS(&cfg.CORS)) // 确保静态文件也有CORS头
+		staticGroup.Static("", "./uploads")
+	}
+
+	// 应用速率限制（限制值见配置文件rate_limit）
+	r.Use(middleware.RateLimit(&cfg.RateLimit))
+
+	// 健康检查端点（不需要任何认证或限制），返回数据库、Redis和上传目录的检查结果及熔断状态
+	healthHandler := handlers.NewHealthHandler(&cfg.Health)
+	r.GET("/api/v1/health", healthHandler.HealthCheck)
+
+	// 版本信息，运维和客户端据此确认运行的构建
+	r.GET("/api/v1/version", handlers.GetVersion)
+
+	// 接口文档：OpenAPI规范和由其渲染的文档页面
+	if cfg.APIDocs.Enabled {
+		r.GET("/api/v1/openapi.json", handlers.GetOpenAPISpec)
+		r.GET("/api/v1/docs", handlers.GetAPIDocs)
+	}
+
+	// Kubernetes存活和就绪探针：/healthz只表示进程存活，/readyz在实例能处理聊天请求时才返回200
+	r.GET("/healthz", healthHandler.Liveness)
+	r.GET("/readyz", healthHandler.Readiness)
+
+	// 指标快照（仅内网访问）
+	r.GET("/debug/metrics", middleware.PrivateNetworkOnly(), handlers.GetMetrics)
+
+	// Prometheus指标（仅内网访问，可另外要求Bearer token）
+	if cfg.Metrics.Enabled {
+		r.GET(cfg.Metrics.Path, middleware.MetricsAuth(cfg.Metrics.Token), handlers.GetPrometheusMetrics)
+	}
+
+	// 管理接口（仅内网访问，需配置admin.token）
+	if cfg.Admin.Token != "" {
+		admin := r.Group("/admin", middleware.AdminAuth(cfg.Admin.Token))
+		admin.GET("/audit-logs", handlers.NewAuditHandler().QueryAuditLogs)
+		statsHandler := handlers.NewStatsHandler(cfg)
+		admin.GET("/stats", statsHandler.GetStats)
+		if cfg.Analytics.Enabled {
+			admin.GET("/stats/messages", statsHandler.GetMessageStats)
+			admin.GET("/stats/active-users", statsHandler.GetActiveUsers)
+			admin.GET("/stats/groups", statsHandler.GetGroupLeaderboard)
+			admin.GET("/stats/retention", statsHandler.GetRetention)
+		}
+		// 分配管理后台角色，用于指定第一个管理员
+		admin.PUT("/users/:id/role", handlers.NewAdminHandler(services.NewAdminService()).SetRole)
+		if ipBanService != nil {
+			ipBanHandler := handlers.NewIPBanHandler(ipBanService)
+			admin.GET("/ip-bans", ipBanHandler.ListBans)
+			admin.POST("/ip-bans", ipBanHandler.BanIP)
+			admin.DELETE("/ip-bans/:id", ipBanHandler.UnbanIP)
+		}
+		// 诊断接口（未配置单独端口时），主端口的写超时为30秒，CPU profile和trace的seconds参数应小于该值
+		if cfg.Debug.Pprof && cfg.Debug.Addr == "" {
+			admin.Any("/debug/*path", gin.WrapH(http.StripPrefix("/admin", NewDebugHandler())))
+		}
+	}
 
 	// API路由组 v1
 	apiV1 := r.Group("/api/v1")
 
-	// 添加输入清理和CSRF保护到API组
-	apiV1.Use(middleware.InputSanitization())
+	// 添加输入编码检查和CSRF保护到API组
+	apiV1.Use(middleware.InputValidation())
 	apiV1.Use(middleware.CSRFProtection())
 
 	// 不需要认证的路由
@@ -78,6 +133,34 @@ func SetupAPIRoutes(r *gin.Engine, cfg *config.Config) {
 		"/api/v1/health",
 	}
 
+	// 服务集成使用API密钥认证，只能访问下列接口，需要密钥拥有对应的授权范围
+	apiKeyScopes := map[string]string{
+		"GET /api/v1/message/history":               services.ScopeMessagesRead,
+		"GET /api/v1/message/search":                services.ScopeMessagesRead,
+		"DELETE /api/v1/message/:id":                services.ScopeMessagesDelete,
+		"GET /api/v1/conversation/list":             services.ScopeConversationsRead,
+		"GET /api/v1/file/list":                     services.ScopeFilesRead,
+		"GET /api/v1/file/:id":                      services.ScopeFilesRead,
+		"GET /api/v1/file/:id/url":                  services.ScopeFilesRead,
+		"POST /api/v1/upload/image":                 services.ScopeFilesWrite,
+		"POST /api/v1/upload/voice":                 services.ScopeFilesWrite,
+		"POST /api/v1/upload/file":                  services.ScopeFilesWrite,
+		"POST /api/v1/upload/video":                 services.ScopeFilesWrite,
+		"POST /api/v1/upload/precheck":              services.ScopeFilesWrite,
+		"POST /api/v1/upload/sessions":              services.ScopeFilesWrite,
+		"PUT /api/v1/upload/sessions/:id/parts/:n":  services.ScopeFilesWrite,
+		"GET /api/v1/upload/sessions/:id":           services.ScopeFilesWrite,
+		"POST /api/v1/upload/sessions/:id/complete": services.ScopeFilesWrite,
+		"DELETE /api/v1/upload/sessions/:id":        services.ScopeFilesWrite,
+		"GET /api/v1/group/:id":                     services.ScopeGroupsRead,
+		"GET /api/v1/group/:id/members":             services.ScopeGroupsRead,
+		"POST /api/v1/group/create":                 services.ScopeGroupsWrite,
+		"POST /api/v1/group/:id/members":            services.ScopeGroupsWrite,
+		"GET /api/v1/user/search":                   services.ScopeUsersRead,
+		"GET /api/v1/user/:id/avatar":               services.ScopeUsersRead,
+	}
+	apiV1.Use(middleware.APIKeyAuth(apiKeyScopes))
+
 	// 使用JWT认证中间件
 	apiV1.Use(middleware.JWTAuth(&cfg.JWT, skipPaths))
 
@@ -90,8 +173,17 @@ func SetupAPIRoutes(r *gin.Engine, cfg *config.Config) {
 		user.GET("/profile", userHandler.GetProfile)
 		user.PUT("/profile", userHandler.UpdateProfile)
 		user.POST("/upload-avatar", userHandler.UploadAvatar)
+		user.GET("/:id/avatar", userHandler.GetAvatar)
 		// 搜索用户功能
 		user.GET("/search", friendHandler.SearchUsers)
+		// 个人数据导出
+		if cfg.DataExport.Enabled {
+			dataExportHandler := handlers.NewDataExportHandler(cfg)
+			user.POST("/export", dataExportHandler.RequestExport)
+			user.GET("/export", dataExportHandler.ListExports)
+			user.GET("/export/:id", dataExportHandler.GetExport)
+			user.GET("/export/:id/download", dataExportHandler.DownloadExport)
+		}
 	}
 
 	// 好友相关的路由
@@ -107,12 +199,21 @@ func SetupAPIRoutes(r *gin.Engine, cfg *config.Config) {
 	{
 		conversation.GET("/list", conversationHandler.GetConversations)
 		conversation.POST("/:id/clear-unread", conversationHandler.ClearUnreadCount)
+		conversation.POST("/:id/read", conversationHandler.MarkRead)
+		conversation.PUT("/:id/mute", conversationHandler.MuteConversation)
+		conversation.DELETE("/:id/mute", conversationHandler.UnmuteConversation)
+		conversation.PUT("/:id/pin", conversationHandler.PinConversation)
+		conversation.GET("/archived", conversationHandler.GetArchivedConversations)
+		conversation.POST("/:id/archive", conversationHandler.ArchiveConversation)
+		conversation.POST("/:id/unarchive", conversationHandler.UnarchiveConversation)
 	}
 
 	// 消息相关的路由
 	message := apiV1.Group("/message")
 	{
 		message.GET("/history", messageHandler.GetMessages)
+		message.GET("/search", messageHandler.SearchMessages)
+		message.DELETE("/:id", messageHandler.DeleteMessage)
 	}
 
 	// 在线状态相关的路由
@@ -128,8 +229,30 @@ func SetupAPIRoutes(r *gin.Engine, cfg *config.Config) {
 	{
 		upload.POST("/image", uploadHandler.UploadImage)
 		upload.POST("/voice", uploadHandler.UploadVoice)
+		upload.POST("/file", uploadHandler.UploadFile)
+		upload.POST("/video", uploadHandler.UploadVideo)
+		upload.POST("/precheck", uploadHandler.Precheck)
+
+		// 分片上传会话（视频和文档），支持查询进度和断点续传
+		upload.POST("/sessions", uploadHandler.CreateUploadSession)
+		upload.PUT("/sessions/:id/parts/:n", uploadHandler.UploadPart)
+		upload.GET("/sessions/:id", uploadHandler.GetUploadSession)
+		upload.POST("/sessions/:id/complete", uploadHandler.CompleteUploadSession)
+		upload.DELETE("/sessions/:id", uploadHandler.AbortUploadSession)
+	}
+
+	// 文件下载相关的路由（校验会话成员身份）
+	file := apiV1.Group("/file")
+	{
+		file.GET("/list", fileHandler.ListFiles)
+		file.GET("/:id", fileHandler.Download)
+		file.GET("/:id/url", fileHandler.SignURL)
 	}
 
+	// SSE连接票据和投递确认（SSE推送入口本身在下方单独注册，不经过JWT中间件）
+	apiV1.POST("/events/ticket", websocket.EventsTicketHandler(cfg))
+	apiV1.POST("/events/ack", websocket.EventsAckHandler)
+
 	// 群组相关的路由
 	group := apiV1.Group("/group")
 	{
@@ -139,7 +262,95 @@ func SetupAPIRoutes(r *gin.Engine, cfg *config.Config) {
 		group.POST("/:id/members", groupHandler.AddGroupMembers)
 	}
 
+	// 群机器人管理（仅群主）
+	var botHandler *handlers.BotHandler
+	if cfg.Bots.Enabled {
+		botHandler = handlers.NewBotHandler(cfg)
+		group.GET("/:id/bots", botHandler.ListBots)
+		group.POST("/:id/bots", botHandler.CreateBot)
+		group.PUT("/:id/bots/:bot_id", botHandler.UpdateBot)
+		group.POST("/:id/bots/:bot_id/credentials", botHandler.ResetBotCredentials)
+		group.DELETE("/:id/bots/:bot_id", botHandler.DeleteBot)
+	}
+
+	// 音视频通话记录和STUN/TURN凭证（通话信令经WebSocket的call消息转发）
+	callHandler := handlers.NewCallHandler(cfg)
+	apiV1.GET("/call/history", callHandler.GetCallHistory)
+	apiV1.GET("/call/ice-servers", callHandler.GetICEServers)
+
+	// GraphQL查询：一次请求获取用户、好友、会话和消息
+	if cfg.GraphQL.Enabled {
+		apiV1.POST("/graphql", handlers.NewGraphQLHandler(cfg).Query)
+	}
+
+	// 全局搜索：消息、用户和群组
+	apiV1.GET("/search", handlers.NewSearchHandler().Search)
+
+	// 举报消息或用户，由管理后台审核
+	reportHandler := handlers.NewReportHandler()
+	apiV1.POST("/reports", reportHandler.CreateReport)
+
+	// 系统公告：离线期间发布的公告上线后拉取
+	var announcementHandler *handlers.AnnouncementHandler
+	if cfg.Announcements.Enabled {
+		announcementHandler = handlers.NewAnnouncementHandler(&cfg.Announcements)
+		apiV1.GET("/announcements", announcementHandler.GetAnnouncements)
+		apiV1.POST("/announcements/:id/read", announcementHandler.MarkAnnouncementRead)
+	}
+
+	// 管理后台（按角色授权，角色通过PUT /admin/users/:id/role分配）
+	adminService := services.NewAdminService()
+	adminHandler := handlers.NewAdminHandler(adminService)
+	allow := func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(adminService, permission)
+	}
+	console := apiV1.Group("/admin")
+	{
+		console.GET("/users", allow(services.PermUsersRead), adminHandler.SearchUsers)
+		console.GET("/users/:id", allow(services.PermUsersRead), adminHandler.GetUser)
+		console.POST("/users/:id/suspend", allow(services.PermUsersModerate), adminHandler.SuspendUser)
+		console.POST("/users/:id/ban", allow(services.PermUsersModerate), adminHandler.BanUser)
+		console.POST("/users/:id/unban", allow(services.PermUsersModerate), adminHandler.UnbanUser)
+		console.POST("/users/:id/logout", allow(services.PermUsersModerate), adminHandler.ForceLogout)
+		console.PUT("/users/:id/role", allow(services.PermRolesManage), adminHandler.SetRole)
+		console.GET("/groups/:id", allow(services.PermGroupsRead), adminHandler.GetGroup)
+		console.DELETE("/groups/:id", allow(services.PermGroupsManage), adminHandler.DissolveGroup)
+		console.DELETE("/messages/:id", allow(services.PermMessagesModerate), adminHandler.TakedownMessage)
+		console.GET("/jobs", allow(services.PermJobsRun), adminHandler.ListJobs)
+		console.POST("/jobs/:name", allow(services.PermJobsRun), adminHandler.RunJob)
+		console.GET("/reports", allow(services.PermReportsReview), reportHandler.ListReports)
+		console.GET("/reports/:id", allow(services.PermReportsReview), reportHandler.GetReport)
+		console.POST("/reports/:id/claim", allow(services.PermReportsReview), reportHandler.ClaimReport)
+		console.POST("/reports/:id/resolve", allow(services.PermReportsReview), reportHandler.ResolveReport)
+		if announcementHandler != nil {
+			console.GET("/announcements", allow(services.PermAnnouncementsManage), announcementHandler.ListAnnouncements)
+			console.POST("/announcements", allow(services.PermAnnouncementsManage), announcementHandler.CreateAnnouncement)
+			console.DELETE("/announcements/:id", allow(services.PermAnnouncementsManage), announcementHandler.CancelAnnouncement)
+		}
+	}
+
 	// WebSocket路由 (从配置中获取JWT密钥)
 	// WebSocket使用单独的安全配置
 	r.GET("/ws", websocket.WebSocketHandler(cfg))
+
+	// SSE推送路由，供无法建立WebSocket的客户端使用，鉴权方式与WebSocket一致
+	r.GET("/api/v1/events", websocket.EventsHandler(cfg))
+
+	// 签名下载链接，签名即授权，不经过JWT中间件
+	r.GET("/files/:id", fileHandler.DownloadSigned)
+
+	// 群机器人Incoming Webhook，令牌即授权，不经过JWT中间件
+	if botHandler != nil {
+		r.POST("/api/v1/hooks/:token", botHandler.PostIncomingWebhook)
+	}
+}
+
+// uploadSizeLimits 文件上传按配置放宽请求大小限制，额外1MB留给multipart表单开销
+func uploadSizeLimits(cfg *config.Config) map[string]int64 {
+	return map[string]int64{
+		"/api/v1/upload/file":  int64(cfg.Upload.File.MaxSizeMB+1) << 20,
+		"/api/v1/upload/video": int64(cfg.Upload.Video.MaxSizeMB+1) << 20,
+		// 分片以原始内容上传
+		"/api/v1/upload/sessions/:id/parts/:n": int64(cfg.Upload.Session.PartSizeMB+1) << 20,
+	}
 }
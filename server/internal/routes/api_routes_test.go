@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+)
+
+// TestUploadPathsMatchRoutes 示例配置中的上传路径前缀都要对应已注册的路由，否则上传不计入并发上限
+func TestUploadPathsMatchRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", strings.Repeat("s", 32))
+	cfg, err := config.Init("../../../config.yaml")
+	require.NoError(t, err)
+	require.NotEmpty(t, cfg.Concurrency.UploadPaths)
+
+	// 注册路由时会加载IP封禁列表等数据
+	require.NoError(t, database.Init(&config.DatabaseConfig{
+		Driver: database.DriverSQLite,
+		DBName: filepath.Join(t.TempDir(), "gochat.db"),
+	}))
+	t.Cleanup(func() { database.Close() })
+	require.NoError(t, database.Migrate())
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	previous := cache.RedisClient
+	cache.RedisClient = client
+	t.Cleanup(func() {
+		cache.RedisClient = previous
+		client.Close()
+	})
+
+	r := gin.New()
+	SetupAPIRoutes(r, cfg)
+
+	for _, prefix := range cfg.Concurrency.UploadPaths {
+		matched := false
+		for _, route := range r.Routes() {
+			if strings.HasPrefix(route.Path, prefix) {
+				matched = true
+				break
+			}
+		}
+		assert.True(t, matched, "upload path %s matches no route", prefix)
+	}
+}
@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+
+	"gochat/internal/metrics"
+)
+
+var publishDebugVarsOnce sync.Once
+
+// NewDebugHandler 运行时诊断接口
+// /debug/pprof/ 下为goroutine、heap、CPU profile、trace等（WebSocket相关goroutine带有component、user_id标签），/debug/vars 为expvar
+func NewDebugHandler() http.Handler {
+	publishDebugVarsOnce.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+		expvar.Publish("metrics", expvar.Func(func() interface{} { return metrics.Default().Snapshot() }))
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
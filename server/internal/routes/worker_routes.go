@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/handlers"
+	"gochat/internal/middleware"
+)
+
+// SetupWorkerRoutes worker角色只处理网关转发的聊天消息，不对外提供接口，只保留健康检查和指标
+func SetupWorkerRoutes(r *gin.Engine, cfg *config.Config) {
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Recovery())
+
+	healthHandler := handlers.NewHealthHandler(&cfg.Health)
+	r.GET("/api/v1/health", healthHandler.HealthCheck)
+	r.GET("/api/v1/version", handlers.GetVersion)
+	r.GET("/healthz", healthHandler.Liveness)
+	r.GET("/readyz", healthHandler.Readiness)
+
+	r.GET("/debug/metrics", middleware.PrivateNetworkOnly(), handlers.GetMetrics)
+	if cfg.Metrics.Enabled {
+		r.GET(cfg.Metrics.Path, middleware.MetricsAuth(cfg.Metrics.Token), handlers.GetPrometheusMetrics)
+	}
+}
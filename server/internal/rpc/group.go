@@ -0,0 +1,88 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gochat/internal/models"
+	"gochat/internal/rpc/internalpb"
+	"gochat/internal/services"
+)
+
+type groupServer struct {
+	internalpb.UnimplementedGroupServiceServer
+}
+
+// GetGroup 获取群组信息
+func (s *groupServer) GetGroup(ctx context.Context, req *internalpb.GetGroupRequest) (*internalpb.Group, error) {
+	if req.GroupId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "group_id is required")
+	}
+	group, err := services.NewGroupService().GetGroup(ctx, req.GroupId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return groupToProto(group), nil
+}
+
+// ListGroupMembers 获取群成员列表，群主在最前，其余按入群时间排序
+func (s *groupServer) ListGroupMembers(ctx context.Context, req *internalpb.ListGroupMembersRequest) (*internalpb.ListGroupMembersResponse, error) {
+	if req.GroupId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "group_id is required")
+	}
+	members, err := services.NewGroupService().GetGroupMembersWithUserInfo(ctx, req.GroupId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &internalpb.ListGroupMembersResponse{Members: make([]*internalpb.GroupMember, 0, len(members))}
+	for _, member := range members {
+		resp.Members = append(resp.Members, &internalpb.GroupMember{
+			UserId:   member.UserID,
+			Nickname: member.Nickname,
+			Avatar:   member.Avatar,
+			IsOwner:  member.IsOwner,
+			IsBot:    member.IsBot,
+		})
+	}
+	return resp, nil
+}
+
+// ListUserGroups 获取用户加入的群组
+func (s *groupServer) ListUserGroups(ctx context.Context, req *internalpb.ListUserGroupsRequest) (*internalpb.ListUserGroupsResponse, error) {
+	if req.UserId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	groups, err := services.NewGroupService().GetUserGroups(ctx, req.UserId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &internalpb.ListUserGroupsResponse{Groups: make([]*internalpb.Group, 0, len(groups))}
+	for i := range groups {
+		resp.Groups = append(resp.Groups, groupToProto(&groups[i]))
+	}
+	return resp, nil
+}
+
+// IsGroupMember 判断用户是否是群成员
+func (s *groupServer) IsGroupMember(ctx context.Context, req *internalpb.IsGroupMemberRequest) (*internalpb.IsGroupMemberResponse, error) {
+	if req.GroupId <= 0 || req.UserId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "group_id and user_id are required")
+	}
+	isMember, err := services.NewGroupService().IsUserInGroup(ctx, req.UserId, req.GroupId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &internalpb.IsGroupMemberResponse{IsMember: isMember}, nil
+}
+
+func groupToProto(group *models.Group) *internalpb.Group {
+	return &internalpb.Group{
+		Id:          group.ID,
+		Name:        group.Name,
+		OwnerId:     group.OwnerID,
+		MemberCount: int32(group.MemberCount),
+		CreatedAt:   group.CreatedAt.UnixMilli(),
+	}
+}
@@ -0,0 +1,175 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gochat/internal/logger"
+	"gochat/internal/models"
+	"gochat/internal/rpc/internalpb"
+	"gochat/internal/services"
+	"gochat/internal/utils"
+)
+
+const (
+	defaultMessageLimit = 20
+	maxMessageLimit     = 100
+)
+
+type messageServer struct {
+	internalpb.UnimplementedMessageServiceServer
+}
+
+// SendMessage 以from_user_id的身份发送消息，处理流程与WebSocket消息相同：禁言检查、敏感词过滤、保存并写入新消息事件、立即投递
+func (s *messageServer) SendMessage(ctx context.Context, req *internalpb.SendMessageRequest) (*internalpb.SendMessageResponse, error) {
+	if req.FromUserId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "from_user_id is required")
+	}
+	if (req.ToUserId > 0) == (req.GroupId > 0) {
+		return nil, status.Error(codes.InvalidArgument, "exactly one of to_user_id and group_id is required")
+	}
+	msgType := int(req.MsgType)
+	if msgType == 0 {
+		msgType = models.MessageTypeText
+	}
+	if msgType < models.MessageTypeText || msgType >= models.MessageTypeCall {
+		return nil, status.Error(codes.InvalidArgument, "invalid msg_type")
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, status.Error(codes.InvalidArgument, "content is required")
+	}
+	if msgType == models.MessageTypeText && !utils.ValidateMessageText(req.Content) {
+		return nil, status.Error(codes.InvalidArgument, "content must be at most 5000 characters without control characters")
+	}
+
+	// 被禁言的用户不能发消息
+	if err := services.CheckMuted(ctx, req.FromUserId); err != nil {
+		var muted *services.UserMutedError
+		if errors.As(err, &muted) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, toStatus(err)
+	}
+
+	// 确定接收者，群消息只能由群成员发送
+	var recipients []int64
+	if req.ToUserId > 0 {
+		recipients = []int64{req.ToUserId}
+	} else {
+		members, err := services.NewGroupService().GetGroupMembers(ctx, req.GroupId)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		isMember := false
+		for _, member := range members {
+			if member.UserID == req.FromUserId {
+				isMember = true
+			} else {
+				recipients = append(recipients, member.UserID)
+			}
+		}
+		if !isMember {
+			return nil, status.Error(codes.PermissionDenied, "sender is not a member of the group")
+		}
+	}
+
+	// 敏感词过滤（仅文本消息）
+	content := req.Content
+	var filtered *services.FilterResult
+	if msgType == models.MessageTypeText {
+		result, err := services.GetContentFilter().CheckMessage(content, req.GroupId)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		content = result.Text
+		filtered = result
+	}
+
+	msg := &models.Message{FromUserID: req.FromUserId, Content: content, MsgType: msgType}
+	if req.ToUserId > 0 {
+		msg.ToUserID = &req.ToUserId
+	} else {
+		msg.GroupID = &req.GroupId
+	}
+	saved, err := services.NewMessageService().SaveMessageWithEvent(ctx, msg, services.MessageCreatedEvent{
+		ClientMsgID: req.ClientMsgId,
+		Recipients:  recipients,
+		RequestID:   logger.RequestIDFrom(ctx),
+	})
+	var rejected *services.MessageRejectedError
+	if errors.As(err, &rejected) {
+		return nil, status.Error(codes.FailedPrecondition, rejected.Reason)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if filtered != nil && filtered.Flagged() {
+		services.RecordFlagged(ctx, req.FromUserId, "message", services.AuditTargetMessage, saved.MessageID, filtered)
+	}
+
+	// 立即投递新消息事件，失败时由发件箱中继重试
+	if _, err := services.NewOutboxService().Publish(ctx, saved.EventID); err != nil {
+		logger.WithContext(ctx).Warnf("消息 %d 投递失败，等待发件箱中继重试: %v", saved.MessageID, err)
+	}
+	return &internalpb.SendMessageResponse{MessageId: saved.MessageID, Content: msg.Content}, nil
+}
+
+// ListMessages 按游标获取单聊或群聊历史消息，按时间倒序
+func (s *messageServer) ListMessages(ctx context.Context, req *internalpb.ListMessagesRequest) (*internalpb.ListMessagesResponse, error) {
+	if req.ViewerId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "viewer_id is required")
+	}
+	if (req.PeerId > 0) == (req.GroupId > 0) {
+		return nil, status.Error(codes.InvalidArgument, "exactly one of peer_id and group_id is required")
+	}
+	if req.BeforeId < 0 || req.Limit < 0 || req.Limit > maxMessageLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "before_id must not be negative and limit must be between 0 and %d", maxMessageLimit)
+	}
+	cursor := services.MessageCursor{BeforeID: req.BeforeId, Limit: int(req.Limit)}
+	if cursor.Limit == 0 {
+		cursor.Limit = defaultMessageLimit
+	}
+
+	messageService := services.NewMessageService()
+	var messages []services.MessageInfo
+	var hasMore bool
+	var err error
+	if req.PeerId > 0 {
+		messages, hasMore, err = messageService.GetPrivateMessagesWithUserInfo(ctx, req.ViewerId, req.PeerId, cursor)
+	} else {
+		isMember, memberErr := services.NewGroupService().IsUserInGroup(ctx, req.ViewerId, req.GroupId)
+		if memberErr != nil {
+			return nil, toStatus(memberErr)
+		}
+		if !isMember {
+			return nil, status.Error(codes.PermissionDenied, "viewer is not a member of the group")
+		}
+		messages, hasMore, err = messageService.GetGroupMessagesWithUserInfo(ctx, req.GroupId, req.ViewerId, cursor)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &internalpb.ListMessagesResponse{Messages: make([]*internalpb.Message, 0, len(messages)), HasMore: hasMore}
+	for _, message := range messages {
+		item := &internalpb.Message{
+			Id:         message.ID,
+			FromUserId: message.FromUserID,
+			MsgType:    int32(message.MsgType),
+			Content:    message.Content,
+			CreatedAt:  message.CreatedAt,
+		}
+		if message.ToUserID != nil {
+			item.ToUserId = *message.ToUserID
+		}
+		if message.GroupID != nil {
+			item.GroupId = *message.GroupID
+		}
+		resp.Messages = append(resp.Messages, item)
+	}
+	return resp, nil
+}
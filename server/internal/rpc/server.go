@@ -0,0 +1,140 @@
+// Package rpc 内部gRPC接口，把用户、群组和消息服务暴露给推送、搜索、统计等内部服务
+// 接口定义见proto/gochat/internal/v1/internal.proto，生成的代码在internalpb包中
+package rpc
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=gochat --go-grpc_out=../.. --go-grpc_opt=module=gochat gochat/internal/v1/internal.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/rpc/internalpb"
+)
+
+// requestIDKey 调用方传入请求ID的metadata键，与HTTP的X-Request-ID对应
+const requestIDKey = "x-request-id"
+
+// requestDuration 按方法和状态码统计的调用耗时，次数即_count
+var requestDuration = metrics.NewHistogramVec("grpc_request_duration_seconds",
+	"内部gRPC调用耗时", nil, "method", "code")
+
+// Server 内部gRPC服务
+type Server struct {
+	addr   string
+	server *grpc.Server
+}
+
+// NewServer 创建内部gRPC服务并注册用户、群组和消息服务
+func NewServer(cfg *config.GRPCConfig) *Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		observe,
+		recoverPanic,
+		authenticate(cfg.Token),
+	))
+	internalpb.RegisterUserServiceServer(server, &userServer{})
+	internalpb.RegisterGroupServiceServer(server, &groupServer{})
+	internalpb.RegisterMessageServiceServer(server, &messageServer{})
+	return &Server{addr: cfg.Addr, server: server}
+}
+
+// Start 监听地址并在后台处理请求，监听失败时返回错误
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil {
+			logger.GetLogger().Errorf("gRPC server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop 停止接收新请求，等待进行中的请求完成，超过timeout后强制关闭
+func (s *Server) Stop(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.server.Stop()
+	}
+}
+
+// authenticate 校验调用方在metadata中携带的authorization: Bearer <token>
+func authenticate(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			provided, ok := strings.CutPrefix(value, "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+				return handler(ctx, req)
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+}
+
+// observe 为每次调用设置请求ID（调用方传入时沿用），记录耗时，服务端错误写日志
+func observe(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	if requestID == "" {
+		requestID = logger.NewRequestID()
+	}
+	ctx = logger.WithRequestID(ctx, requestID)
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	code := status.Code(err)
+	requestDuration.WithLabelValues(info.FullMethod, code.String()).Since(start)
+	if code == codes.Internal || code == codes.Unknown {
+		logger.WithContext(ctx).Errorf("gRPC %s failed: %v", info.FullMethod, err)
+	}
+	return resp, err
+}
+
+// recoverPanic 处理函数panic时返回Internal，不影响其他请求
+func recoverPanic(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.WithContext(ctx).Errorf("gRPC %s panic: %v", info.FullMethod, r)
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// toStatus 把服务层错误转换为gRPC状态码，未识别的错误返回Internal
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/gorm"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/models"
+	"gochat/internal/rpc/internalpb"
+)
+
+const testToken = "0123456789abcdef"
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	cfg := &config.DatabaseConfig{
+		Driver: database.DriverSQLite,
+		DBName: filepath.Join(t.TempDir(), "gochat.db"),
+	}
+	require.NoError(t, database.Init(cfg))
+	t.Cleanup(func() { database.Close() })
+	require.NoError(t, database.Migrate())
+
+	// 用户信息走缓存，使用内存Redis
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	cache.RedisClient = client
+	t.Cleanup(func() {
+		cache.RedisClient = nil
+		client.Close()
+	})
+	return database.GetDB()
+}
+
+// newTestConn 在内存连接上启动gRPC服务，返回客户端连接
+func newTestConn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(&config.GRPCConfig{Token: testToken})
+	go server.server.Serve(listener)
+	t.Cleanup(server.server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func authorized() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testToken)
+}
+
+func TestRequiresToken(t *testing.T) {
+	newTestDB(t)
+	client := internalpb.NewUserServiceClient(newTestConn(t))
+
+	_, err := client.GetUser(context.Background(), &internalpb.GetUserRequest{UserId: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer wrong")
+	_, err = client.GetUser(ctx, &internalpb.GetUserRequest{UserId: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.GetUser(authorized(), &internalpb.GetUserRequest{UserId: 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestSendAndListGroupMessages(t *testing.T) {
+	db := newTestDB(t)
+	alice := &models.User{Phone: "13800000001", PasswordHash: "x", Nickname: "alice"}
+	bob := &models.User{Phone: "13800000002", PasswordHash: "x", Nickname: "bob"}
+	carol := &models.User{Phone: "13800000003", PasswordHash: "x", Nickname: "carol"}
+	require.NoError(t, db.Create([]*models.User{alice, bob, carol}).Error)
+	group := &models.Group{Name: "team", OwnerID: alice.ID, MemberCount: 2}
+	require.NoError(t, db.Create(group).Error)
+	require.NoError(t, db.Create([]*models.GroupMember{
+		{GroupID: group.ID, UserID: alice.ID},
+		{GroupID: group.ID, UserID: bob.ID},
+	}).Error)
+
+	conn := newTestConn(t)
+	groups := internalpb.NewGroupServiceClient(conn)
+	members, err := groups.ListGroupMembers(authorized(), &internalpb.ListGroupMembersRequest{GroupId: group.ID})
+	require.NoError(t, err)
+	require.Len(t, members.Members, 2)
+	assert.Equal(t, alice.ID, members.Members[0].UserId)
+	assert.True(t, members.Members[0].IsOwner)
+
+	messages := internalpb.NewMessageServiceClient(conn)
+	_, err = messages.SendMessage(authorized(), &internalpb.SendMessageRequest{FromUserId: carol.ID, GroupId: group.ID, Content: "hi"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = messages.SendMessage(authorized(), &internalpb.SendMessageRequest{FromUserId: alice.ID, ToUserId: bob.ID, GroupId: group.ID, Content: "hi"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	sent, err := messages.SendMessage(authorized(), &internalpb.SendMessageRequest{FromUserId: alice.ID, GroupId: group.ID, Content: "hello"})
+	require.NoError(t, err)
+	assert.NotZero(t, sent.MessageId)
+
+	list, err := messages.ListMessages(authorized(), &internalpb.ListMessagesRequest{ViewerId: bob.ID, GroupId: group.ID})
+	require.NoError(t, err)
+	require.Len(t, list.Messages, 1)
+	assert.Equal(t, sent.MessageId, list.Messages[0].Id)
+	assert.Equal(t, "hello", list.Messages[0].Content)
+	assert.Equal(t, group.ID, list.Messages[0].GroupId)
+	assert.False(t, list.HasMore)
+
+	_, err = messages.ListMessages(authorized(), &internalpb.ListMessagesRequest{ViewerId: carol.ID, GroupId: group.ID})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gochat/internal/models"
+	"gochat/internal/rpc/internalpb"
+	"gochat/internal/services"
+)
+
+// maxBatchUsers 批量获取用户的最大数量
+const maxBatchUsers = 100
+
+type userServer struct {
+	internalpb.UnimplementedUserServiceServer
+}
+
+// GetUser 获取用户信息（缓存优先）
+func (s *userServer) GetUser(ctx context.Context, req *internalpb.GetUserRequest) (*internalpb.User, error) {
+	if req.UserId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	user, err := services.GetUserCacheService().GetUser(ctx, req.UserId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return userToProto(user), nil
+}
+
+// BatchGetUsers 批量获取用户信息，按请求的顺序返回，不存在的用户不返回
+func (s *userServer) BatchGetUsers(ctx context.Context, req *internalpb.BatchGetUsersRequest) (*internalpb.BatchGetUsersResponse, error) {
+	if len(req.UserIds) > maxBatchUsers {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d user_ids", maxBatchUsers)
+	}
+	users, err := services.GetUserCacheService().GetUsers(ctx, req.UserIds)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &internalpb.BatchGetUsersResponse{}
+	seen := make(map[int64]bool, len(req.UserIds))
+	for _, id := range req.UserIds {
+		if user, ok := users[id]; ok && !seen[id] {
+			seen[id] = true
+			resp.Users = append(resp.Users, userToProto(user))
+		}
+	}
+	return resp, nil
+}
+
+func userToProto(user *models.User) *internalpb.User {
+	return &internalpb.User{
+		Id:        user.ID,
+		Nickname:  user.Nickname,
+		Avatar:    services.PublicURL(user.Avatar),
+		Gender:    int32(user.Gender),
+		Signature: user.Signature,
+		IsBot:     user.IsBot,
+		CreatedAt: user.CreatedAt.UnixMilli(),
+	}
+}
@@ -0,0 +1,306 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gochat/internal/config"
+)
+
+// Document 消息索引文档
+type Document struct {
+	ID         int64  `json:"id"`
+	FromUserID int64  `json:"from_user_id"`
+	ToUserID   int64  `json:"to_user_id,omitempty"` // 单聊接收者，群聊消息为0
+	GroupID    int64  `json:"group_id,omitempty"`   // 群聊消息所在的群，单聊消息为0
+	MsgType    int    `json:"msg_type"`
+	Content    string `json:"content"`
+	CreatedAt  int64  `json:"created_at"` // 毫秒时间戳
+}
+
+// Query 消息搜索条件，只匹配UserID参与的单聊和GroupIDs中的群聊
+type Query struct {
+	Keyword  string
+	UserID   int64
+	GroupIDs []int64
+	BeforeID int64 // 游标，只返回ID小于该值的消息
+	Size     int
+}
+
+// Hit 搜索命中的消息ID和高亮片段（HTML转义，匹配部分用<em>标记）
+type Hit struct {
+	ID        int64
+	Highlight string
+}
+
+// Client Elasticsearch客户端，通过REST接口访问，只实现消息索引需要的操作
+type Client struct {
+	baseURL    *url.URL
+	index      string
+	analyzer   string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// New 创建客户端
+func New(cfg *config.ElasticsearchConfig) (*Client, error) {
+	baseURL, err := url.Parse(strings.TrimRight(cfg.URL, "/"))
+	if err != nil || baseURL.Host == "" {
+		return nil, fmt.Errorf("invalid elasticsearch url: %q", cfg.URL)
+	}
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	analyzer := cfg.Analyzer
+	if analyzer == "" {
+		analyzer = "standard"
+	}
+	return &Client{
+		baseURL:    baseURL,
+		index:      cfg.Index,
+		analyzer:   analyzer,
+		username:   cfg.Username,
+		password:   cfg.Password,
+		httpClient: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// EnsureIndex 索引不存在时按消息文档的映射创建索引
+func (c *Client) EnsureIndex(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodHead, "/"+c.index, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+	default:
+		return fmt.Errorf("elasticsearch: check index %s failed: %s", c.index, resp.Status)
+	}
+
+	mapping := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"dynamic": "strict",
+			"properties": map[string]interface{}{
+				"id":           map[string]string{"type": "long"},
+				"from_user_id": map[string]string{"type": "long"},
+				"to_user_id":   map[string]string{"type": "long"},
+				"group_id":     map[string]string{"type": "long"},
+				"msg_type":     map[string]string{"type": "integer"},
+				"content":      map[string]string{"type": "text", "analyzer": c.analyzer},
+				"created_at":   map[string]string{"type": "date", "format": "epoch_millis"},
+			},
+		},
+	}
+	body, err := json.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+	resp, err = c.do(ctx, http.MethodPut, "/"+c.index, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 多个实例同时启动时其他实例可能已经创建了索引
+	if resp.StatusCode == http.StatusBadRequest {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if strings.Contains(string(data), "resource_already_exists_exception") {
+			return nil
+		}
+		return fmt.Errorf("elasticsearch: create index %s failed: %s: %s", c.index, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError("create index "+c.index, resp)
+	}
+	return nil
+}
+
+// bulkResponse _bulk接口的响应，只解析判断每个操作是否成功需要的字段
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// Bulk 批量写入和删除文档，重复写入同一ID时覆盖，删除不存在的文档视为成功
+func (c *Client) Bulk(ctx context.Context, docs []Document, deleteIDs []int64) error {
+	if len(docs) == 0 && len(deleteIDs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range docs {
+		action := map[string]map[string]string{"index": {"_id": strconv.FormatInt(docs[i].ID, 10)}}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(&docs[i]); err != nil {
+			return err
+		}
+	}
+	for _, id := range deleteIDs {
+		action := map[string]map[string]string{"delete": {"_id": strconv.FormatInt(id, 10)}}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/"+c.index+"/_bulk", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("bulk", resp)
+	}
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("elasticsearch: decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	for _, item := range result.Items {
+		for op, r := range item {
+			if r.Status < 300 || (op == "delete" && r.Status == http.StatusNotFound) {
+				continue
+			}
+			if r.Error != nil {
+				return fmt.Errorf("elasticsearch: %s %s failed: %s: %s", op, r.ID, r.Error.Type, r.Error.Reason)
+			}
+			return fmt.Errorf("elasticsearch: %s %s failed with status %d", op, r.ID, r.Status)
+		}
+	}
+	return nil
+}
+
+// searchResponse _search接口的响应
+type searchResponse struct {
+	Hits struct {
+		Hits []struct {
+			ID        string              `json:"_id"`
+			Highlight map[string][]string `json:"highlight"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// Search 按短语匹配消息内容，结果按消息ID倒序（即时间倒序）
+func (c *Client) Search(ctx context.Context, q Query) ([]Hit, error) {
+	// 可见范围：所在群的消息，或自己发出、收到的单聊消息
+	visible := []interface{}{
+		map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{"exists": map[string]string{"field": "group_id"}},
+				"should": []interface{}{
+					map[string]interface{}{"term": map[string]int64{"from_user_id": q.UserID}},
+					map[string]interface{}{"term": map[string]int64{"to_user_id": q.UserID}},
+				},
+				"minimum_should_match": 1,
+			},
+		},
+	}
+	if len(q.GroupIDs) > 0 {
+		visible = append(visible, map[string]interface{}{"terms": map[string][]int64{"group_id": q.GroupIDs}})
+	}
+	filter := []interface{}{
+		map[string]interface{}{"bool": map[string]interface{}{"should": visible, "minimum_should_match": 1}},
+	}
+	if q.BeforeID > 0 {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"id": map[string]int64{"lt": q.BeforeID}}})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"size":    q.Size,
+		"_source": false,
+		"sort":    []interface{}{map[string]string{"id": "desc"}},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   map[string]interface{}{"match_phrase": map[string]string{"content": q.Keyword}},
+				"filter": filter,
+			},
+		},
+		"highlight": map[string]interface{}{
+			"encoder":   "html",
+			"pre_tags":  []string{"<em>"},
+			"post_tags": []string{"</em>"},
+			"fields": map[string]interface{}{
+				"content": map[string]int{"fragment_size": 100, "number_of_fragments": 1},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/"+c.index+"/_search", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("search", resp)
+	}
+	var result searchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("elasticsearch: decode search response: %w", err)
+	}
+
+	hits := make([]Hit, 0, len(result.Hits.Hits))
+	for _, h := range result.Hits.Hits {
+		id, err := strconv.ParseInt(h.ID, 10, 64)
+		if err != nil {
+			continue
+		}
+		hit := Hit{ID: id}
+		if fragments := h.Highlight["content"]; len(fragments) > 0 {
+			hit.Highlight = fragments[0]
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// do 发送请求，请求体为JSON（_bulk为NDJSON）
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path = strings.TrimRight(u.Path, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		if strings.HasSuffix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		} else {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.httpClient.Do(req)
+}
+
+// responseError 把非预期的响应转换为错误，附带响应体开头便于排查
+func responseError(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("elasticsearch: %s failed: %s: %s", op, resp.Status, strings.TrimSpace(string(body)))
+}
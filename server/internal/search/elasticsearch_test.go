@@ -0,0 +1,125 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := New(&config.ElasticsearchConfig{
+		URL:      server.URL,
+		Index:    "messages",
+		Username: "elastic",
+		Password: "secret",
+		Timeout:  "5s",
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func TestEnsureIndexCreatesMissingIndex(t *testing.T) {
+	var created map[string]interface{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "elastic", user)
+		assert.Equal(t, "secret", pass)
+		assert.Equal(t, "/messages", r.URL.Path)
+		switch r.Method {
+		case http.MethodHead:
+			if created == nil {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+		}
+	})
+
+	require.NoError(t, client.EnsureIndex(context.Background()))
+	require.NotNil(t, created)
+	properties := created["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, "standard", properties["content"].(map[string]interface{})["analyzer"])
+
+	// 已存在时不再创建
+	created["exists"] = true
+	require.NoError(t, client.EnsureIndex(context.Background()))
+	assert.Equal(t, true, created["exists"])
+}
+
+func TestBulk(t *testing.T) {
+	var lines []map[string]interface{}
+	response := `{"errors":false,"items":[]}`
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages/_bulk", r.URL.Path)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		lines = nil
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+		io.WriteString(w, response)
+	})
+	ctx := context.Background()
+
+	require.NoError(t, client.Bulk(ctx, nil, nil))
+	assert.Nil(t, lines, "empty bulk should not send a request")
+
+	require.NoError(t, client.Bulk(ctx, []Document{{ID: 1, FromUserID: 2, GroupID: 3, Content: "hello"}}, []int64{4}))
+	require.Len(t, lines, 3)
+	assert.Equal(t, map[string]interface{}{"index": map[string]interface{}{"_id": "1"}}, lines[0])
+	assert.Equal(t, "hello", lines[1]["content"])
+	assert.NotContains(t, lines[1], "to_user_id")
+	assert.Equal(t, map[string]interface{}{"delete": map[string]interface{}{"_id": "4"}}, lines[2])
+
+	// 删除不存在的文档不算失败
+	response = `{"errors":true,"items":[{"delete":{"_id":"4","status":404}}]}`
+	require.NoError(t, client.Bulk(ctx, nil, []int64{4}))
+
+	response = `{"errors":true,"items":[{"index":{"_id":"1","status":201}},{"index":{"_id":"2","status":400,"error":{"type":"mapper_parsing_exception","reason":"bad field"}}}]}`
+	err := client.Bulk(ctx, []Document{{ID: 1}, {ID: 2}}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mapper_parsing_exception")
+}
+
+func TestSearch(t *testing.T) {
+	var query map[string]interface{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages/_search", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&query))
+		io.WriteString(w, `{"hits":{"hits":[
+			{"_id":"9","highlight":{"content":["say <em>hello</em> &lt;b&gt;"]}},
+			{"_id":"7"}
+		]}}`)
+	})
+
+	hits, err := client.Search(context.Background(), Query{Keyword: "hello", UserID: 5, GroupIDs: []int64{10, 11}, BeforeID: 100, Size: 21})
+	require.NoError(t, err)
+	require.Len(t, hits, 2)
+	assert.Equal(t, Hit{ID: 9, Highlight: "say <em>hello</em> &lt;b&gt;"}, hits[0])
+	assert.Equal(t, Hit{ID: 7}, hits[1])
+
+	assert.EqualValues(t, 21, query["size"])
+	boolQuery := query["query"].(map[string]interface{})["bool"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"match_phrase": map[string]interface{}{"content": "hello"}}, boolQuery["must"])
+	filter := boolQuery["filter"].([]interface{})
+	require.Len(t, filter, 2)
+	visible := filter[0].(map[string]interface{})["bool"].(map[string]interface{})["should"].([]interface{})
+	require.Len(t, visible, 2)
+	assert.Equal(t, map[string]interface{}{"terms": map[string]interface{}{"group_id": []interface{}{10.0, 11.0}}}, visible[1])
+	assert.Equal(t, map[string]interface{}{"range": map[string]interface{}{"id": map[string]interface{}{"lt": 100.0}}}, filter[1])
+}
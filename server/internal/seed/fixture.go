@@ -0,0 +1,196 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture 种子数据文件，用户通过手机号引用，群组通过名称引用
+type Fixture struct {
+	Users    []UserFixture    `yaml:"users"`
+	Friends  [][2]string      `yaml:"friends"` // 好友对：[手机号, 手机号]
+	Groups   []GroupFixture   `yaml:"groups"`
+	Messages []MessageFixture `yaml:"messages"` // 按顺序写入，时间间隔1分钟，最后一条为当前时间
+	Generate *GenerateFixture `yaml:"generate"` // 批量生成数据（压测用）
+}
+
+// UserFixture 用户
+type UserFixture struct {
+	Phone     string `yaml:"phone"`
+	Password  string `yaml:"password"`
+	Nickname  string `yaml:"nickname"`
+	Avatar    string `yaml:"avatar"`
+	Gender    int    `yaml:"gender"`
+	Signature string `yaml:"signature"`
+}
+
+// GroupFixture 群组，成员不需要包含群主
+type GroupFixture struct {
+	Name    string   `yaml:"name"`
+	Owner   string   `yaml:"owner"`
+	Members []string `yaml:"members"`
+}
+
+// MessageFixture 消息，to和group二选一
+type MessageFixture struct {
+	From    string `yaml:"from"`
+	To      string `yaml:"to"`
+	Group   string `yaml:"group"`
+	Content string `yaml:"content"`
+}
+
+// GenerateFixture 按序号批量生成用户、好友和消息，相同配置每次生成的数据相同
+type GenerateFixture struct {
+	Users             int    `yaml:"users"`               // 生成的用户数
+	PhonePrefix       string `yaml:"phone_prefix"`        // 手机号前缀，后接序号补足11位，默认199
+	Password          string `yaml:"password"`            // 默认123456
+	FriendsPerUser    int    `yaml:"friends_per_user"`    // 每个用户与其后N个用户互为好友
+	MessagesPerFriend int    `yaml:"messages_per_friend"` // 每对好友的消息数
+}
+
+// Load 读取并校验种子数据文件，generate部分展开为普通数据
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := yaml.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("parse fixture %s: %w", path, err)
+	}
+	if err := fixture.expand(); err != nil {
+		return nil, err
+	}
+	if err := fixture.validate(); err != nil {
+		return nil, err
+	}
+	return &fixture, nil
+}
+
+// expand 把generate部分展开为用户、好友和消息
+func (f *Fixture) expand() error {
+	g := f.Generate
+	if g == nil || g.Users <= 0 {
+		return nil
+	}
+	prefix := g.PhonePrefix
+	if prefix == "" {
+		prefix = "199"
+	}
+	if len(prefix) >= 11 {
+		return errors.New("generate.phone_prefix is too long")
+	}
+	password := g.Password
+	if password == "" {
+		password = "123456"
+	}
+
+	digits := 11 - len(prefix)
+	phones := make([]string, g.Users)
+	for i := range phones {
+		phones[i] = fmt.Sprintf("%s%0*d", prefix, digits, i+1)
+		f.Users = append(f.Users, UserFixture{
+			Phone:    phones[i],
+			Password: password,
+			Nickname: fmt.Sprintf("user%d", i+1),
+		})
+	}
+	for i := range phones {
+		for j := i + 1; j <= i+g.FriendsPerUser && j < len(phones); j++ {
+			f.Friends = append(f.Friends, [2]string{phones[i], phones[j]})
+			for k := 0; k < g.MessagesPerFriend; k++ {
+				from, to := phones[i], phones[j]
+				if k%2 == 1 {
+					from, to = to, from
+				}
+				f.Messages = append(f.Messages, MessageFixture{
+					From:    from,
+					To:      to,
+					Content: fmt.Sprintf("message %d", k+1),
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// validate 检查引用的用户和群组都已定义
+func (f *Fixture) validate() error {
+	users := make(map[string]bool, len(f.Users))
+	for _, u := range f.Users {
+		if u.Phone == "" || u.Password == "" || u.Nickname == "" {
+			return fmt.Errorf("user %q: phone, password and nickname are required", u.Phone)
+		}
+		if users[u.Phone] {
+			return fmt.Errorf("user %s is defined more than once", u.Phone)
+		}
+		users[u.Phone] = true
+	}
+	userRef := func(phone, where string) error {
+		if !users[phone] {
+			return fmt.Errorf("%s: unknown user %q", where, phone)
+		}
+		return nil
+	}
+
+	for _, pair := range f.Friends {
+		if pair[0] == pair[1] {
+			return fmt.Errorf("friends: user %s cannot befriend themselves", pair[0])
+		}
+		for _, phone := range pair {
+			if err := userRef(phone, "friends"); err != nil {
+				return err
+			}
+		}
+	}
+
+	groups := make(map[string]map[string]bool, len(f.Groups))
+	for _, g := range f.Groups {
+		if g.Name == "" {
+			return errors.New("groups: name is required")
+		}
+		if groups[g.Name] != nil {
+			return fmt.Errorf("group %s is defined more than once", g.Name)
+		}
+		if err := userRef(g.Owner, "group "+g.Name); err != nil {
+			return err
+		}
+		members := map[string]bool{g.Owner: true}
+		for _, phone := range g.Members {
+			if err := userRef(phone, "group "+g.Name); err != nil {
+				return err
+			}
+			members[phone] = true
+		}
+		groups[g.Name] = members
+	}
+
+	for i, m := range f.Messages {
+		where := fmt.Sprintf("messages[%d]", i)
+		if m.Content == "" {
+			return fmt.Errorf("%s: content is required", where)
+		}
+		if err := userRef(m.From, where); err != nil {
+			return err
+		}
+		switch {
+		case m.To != "" && m.Group == "":
+			if err := userRef(m.To, where); err != nil {
+				return err
+			}
+		case m.Group != "" && m.To == "":
+			if groups[m.Group] == nil {
+				return fmt.Errorf("%s: unknown group %q", where, m.Group)
+			}
+			if !groups[m.Group][m.From] {
+				return fmt.Errorf("%s: %s is not a member of group %s", where, m.From, m.Group)
+			}
+		default:
+			return fmt.Errorf("%s: exactly one of to and group is required", where)
+		}
+	}
+	return nil
+}
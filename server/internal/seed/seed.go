@@ -0,0 +1,296 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/database"
+	"gochat/internal/models"
+	"gochat/internal/utils"
+)
+
+// messageBatchSize 批量写入消息的每批条数
+const messageBatchSize = 500
+
+// Result 本次新写入的数据量，已存在的数据不计入
+type Result struct {
+	Users       int
+	Friendships int
+	Groups      int
+	Messages    int
+}
+
+// Apply 在一个事务中写入种子数据，可重复执行：
+// 已存在的用户（按手机号）、好友关系、群组（按群主和名称）和群成员不会重复创建；
+// 消息只写入本次执行前还没有任何消息的会话
+// 直接写数据库，不经过Redis和发件箱，执行后需要清理缓存或在服务启动前执行
+func Apply(db *gorm.DB, fixture *Fixture) (*Result, error) {
+	result := &Result{}
+	err := database.Primary(db).Transaction(func(tx *gorm.DB) error {
+		s := &seeder{tx: tx, result: result, users: make(map[string]int64), groups: make(map[string]int64)}
+		if err := s.seedUsers(fixture.Users); err != nil {
+			return err
+		}
+		if err := s.seedFriends(fixture.Friends); err != nil {
+			return err
+		}
+		if err := s.seedGroups(fixture.Groups); err != nil {
+			return err
+		}
+		return s.seedMessages(fixture.Messages)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// seeder 保存写入过程中手机号、群名到ID的映射
+type seeder struct {
+	tx     *gorm.DB
+	result *Result
+	users  map[string]int64
+	groups map[string]int64
+}
+
+// seedUsers 创建不存在的用户，相同密码只哈希一次
+func (s *seeder) seedUsers(users []UserFixture) error {
+	hashes := make(map[string]string)
+	for _, u := range users {
+		var existing models.User
+		err := s.tx.Where("phone = ?", u.Phone).First(&existing).Error
+		if err == nil {
+			s.users[u.Phone] = existing.ID
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		hash, ok := hashes[u.Password]
+		if !ok {
+			if hash, err = utils.HashPassword(u.Password); err != nil {
+				return err
+			}
+			hashes[u.Password] = hash
+		}
+		avatar := u.Avatar
+		if avatar == "" {
+			avatar = "default.png"
+		}
+		user := models.User{
+			Phone:        u.Phone,
+			PasswordHash: hash,
+			Nickname:     u.Nickname,
+			Avatar:       avatar,
+			Gender:       u.Gender,
+			Signature:    u.Signature,
+		}
+		if err := s.tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("create user %s: %w", u.Phone, err)
+		}
+		s.users[u.Phone] = user.ID
+		s.result.Users++
+	}
+	return nil
+}
+
+// seedFriends 创建双向好友关系和双方的单聊会话
+func (s *seeder) seedFriends(pairs [][2]string) error {
+	for _, pair := range pairs {
+		userID, friendID := s.users[pair[0]], s.users[pair[1]]
+		created := false
+		for _, rel := range [][2]int64{{userID, friendID}, {friendID, userID}} {
+			var count int64
+			if err := s.tx.Model(&models.FriendRelation{}).
+				Where("user_id = ? AND friend_id = ?", rel[0], rel[1]).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			if err := s.tx.Create(&models.FriendRelation{UserID: rel[0], FriendID: rel[1]}).Error; err != nil {
+				return err
+			}
+			created = true
+			if err := s.ensureConversation(rel[0], models.ConversationTypePrivate, rel[1]); err != nil {
+				return err
+			}
+		}
+		if created {
+			s.result.Friendships++
+		}
+	}
+	return nil
+}
+
+// seedGroups 创建群组、补充缺少的成员及其群聊会话
+func (s *seeder) seedGroups(groups []GroupFixture) error {
+	for _, g := range groups {
+		ownerID := s.users[g.Owner]
+		var group models.Group
+		err := s.tx.Where("owner_id = ? AND name = ?", ownerID, g.Name).First(&group).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			group = models.Group{Name: g.Name, OwnerID: ownerID}
+			if err := s.tx.Create(&group).Error; err != nil {
+				return fmt.Errorf("create group %s: %w", g.Name, err)
+			}
+			s.result.Groups++
+		} else if err != nil {
+			return err
+		}
+		s.groups[g.Name] = group.ID
+
+		for _, phone := range append([]string{g.Owner}, g.Members...) {
+			member := models.GroupMember{GroupID: group.ID, UserID: s.users[phone]}
+			if err := s.tx.Where("group_id = ? AND user_id = ?", member.GroupID, member.UserID).
+				FirstOrCreate(&member).Error; err != nil {
+				return err
+			}
+			if err := s.ensureConversation(member.UserID, models.ConversationTypeGroup, group.ID); err != nil {
+				return err
+			}
+		}
+
+		var memberCount int64
+		if err := s.tx.Model(&models.GroupMember{}).Where("group_id = ?", group.ID).Count(&memberCount).Error; err != nil {
+			return err
+		}
+		if err := s.tx.Model(&group).Update("member_count", memberCount).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conversationKey 标识一个单聊（按双方ID）或群聊
+type conversationKey struct {
+	groupID int64
+	userA   int64
+	userB   int64
+}
+
+// seedMessages 按顺序写入消息，并把各会话的最后一条消息写回会话
+func (s *seeder) seedMessages(fixtures []MessageFixture) error {
+	if len(fixtures) == 0 {
+		return nil
+	}
+
+	// 已有消息的会话不再写入，保证重复执行时历史不重复
+	skip := make(map[conversationKey]bool)
+	checked := make(map[conversationKey]bool)
+	start := time.Now().UTC().Add(-time.Duration(len(fixtures)-1) * time.Minute)
+
+	messages := make([]models.Message, 0, len(fixtures))
+	keys := make([]conversationKey, 0, len(fixtures))
+	for i, m := range fixtures {
+		msg := models.Message{
+			FromUserID: s.users[m.From],
+			Content:    m.Content,
+			MsgType:    models.MessageTypeText,
+			CreatedAt:  start.Add(time.Duration(i) * time.Minute),
+		}
+		var key conversationKey
+		if m.Group != "" {
+			groupID := s.groups[m.Group]
+			msg.GroupID = &groupID
+			key = conversationKey{groupID: groupID}
+		} else {
+			toUserID := s.users[m.To]
+			msg.ToUserID = &toUserID
+			key = conversationKey{userA: msg.FromUserID, userB: toUserID}
+			if key.userA > key.userB {
+				key.userA, key.userB = key.userB, key.userA
+			}
+		}
+
+		if !checked[key] {
+			checked[key] = true
+			exists, err := s.hasMessages(key)
+			if err != nil {
+				return err
+			}
+			skip[key] = exists
+		}
+		if skip[key] {
+			continue
+		}
+		messages = append(messages, msg)
+		keys = append(keys, key)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	// 单聊和群聊消息分开批量写入：同一批中混合NULL的默认值列时SQLite不支持INSERT ... DEFAULT
+	// 同一会话的消息都在同一组中，组内顺序不变
+	for _, group := range [2]bool{false, true} {
+		batch := make([]*models.Message, 0, len(messages))
+		for i := range messages {
+			if (messages[i].GroupID != nil) == group {
+				batch = append(batch, &messages[i])
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		if err := s.tx.CreateInBatches(batch, messageBatchSize).Error; err != nil {
+			return err
+		}
+	}
+	s.result.Messages = len(messages)
+
+	// 消息按时间顺序写入，每个会话最后出现的即为最后一条消息
+	last := make(map[conversationKey]int64)
+	for i, key := range keys {
+		last[key] = messages[i].ID
+	}
+	for key, messageID := range last {
+		query := s.tx.Model(&models.Conversation{})
+		if key.groupID != 0 {
+			query = query.Where("type = ? AND target_id = ?", models.ConversationTypeGroup, key.groupID)
+		} else {
+			// 非好友之间的消息也需要会话才能在列表中显示
+			if err := s.ensureConversation(key.userA, models.ConversationTypePrivate, key.userB); err != nil {
+				return err
+			}
+			if err := s.ensureConversation(key.userB, models.ConversationTypePrivate, key.userA); err != nil {
+				return err
+			}
+			query = query.Where("type = ? AND ((user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?))",
+				models.ConversationTypePrivate, key.userA, key.userB, key.userB, key.userA)
+		}
+		if err := query.Updates(map[string]interface{}{
+			"last_msg_id": messageID,
+			"updated_at":  time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasMessages 会话中是否已有消息（包括已删除的）
+func (s *seeder) hasMessages(key conversationKey) (bool, error) {
+	query := s.tx.Unscoped().Model(&models.Message{})
+	if key.groupID != 0 {
+		query = query.Where("group_id = ?", key.groupID)
+	} else {
+		query = query.Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)",
+			key.userA, key.userB, key.userB, key.userA)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
+// ensureConversation 创建不存在的会话
+func (s *seeder) ensureConversation(userID int64, convType int, targetID int64) error {
+	conversation := models.Conversation{UserID: userID, Type: convType, TargetID: targetID}
+	return s.tx.Where("user_id = ? AND type = ? AND target_id = ?", userID, convType, targetID).
+		FirstOrCreate(&conversation).Error
+}
@@ -0,0 +1,63 @@
+package seed
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/models"
+)
+
+func TestApplyDemoFixtureIsRepeatable(t *testing.T) {
+	require.NoError(t, database.Init(&config.DatabaseConfig{Driver: database.DriverSQLite, DBName: filepath.Join(t.TempDir(), "gochat.db")}))
+	t.Cleanup(func() { database.Close() })
+	require.NoError(t, database.Migrate())
+	db := database.GetDB()
+
+	fixture, err := Load("../../../scripts/seed-demo.yaml")
+	require.NoError(t, err)
+
+	result, err := Apply(db, fixture)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Users: 3, Friendships: 2, Groups: 1, Messages: 4}, *result)
+
+	var group models.Group
+	require.NoError(t, db.First(&group).Error)
+	assert.Equal(t, 3, group.MemberCount)
+
+	var conversations []models.Conversation
+	require.NoError(t, db.Where("last_msg_id IS NOT NULL").Find(&conversations).Error)
+	assert.Len(t, conversations, 5, "单聊双方和3个群成员的会话都指向最后一条消息")
+
+	result, err = Apply(db, fixture)
+	require.NoError(t, err)
+	assert.Equal(t, Result{}, *result)
+
+	var messages int64
+	require.NoError(t, db.Model(&models.Message{}).Count(&messages).Error)
+	assert.Equal(t, int64(4), messages)
+}
+
+func TestLoadGenerateAndValidate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "fixture.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	fixture, err := Load(write("generate:\n  users: 4\n  friends_per_user: 2\n  messages_per_friend: 3\n"))
+	require.NoError(t, err)
+	require.Len(t, fixture.Users, 4)
+	assert.Equal(t, "19900000001", fixture.Users[0].Phone)
+	assert.Len(t, fixture.Friends, 5)
+	assert.Len(t, fixture.Messages, 15)
+
+	_, err = Load(write("users:\n  - {phone: \"13800000001\", password: \"123456\", nickname: a}\nmessages:\n  - {from: \"13800000001\", to: \"13800000009\", content: hi}\n"))
+	assert.ErrorContains(t, err, "unknown user")
+}
@@ -0,0 +1,481 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/cache"
+	"gochat/internal/database"
+	"gochat/internal/models"
+	"gochat/internal/utils"
+)
+
+// 管理后台角色
+const (
+	RoleSupport   = "support"   // 客服：查看用户和群组
+	RoleModerator = "moderator" // 审核员：另外可以停用、封禁用户，强制下线、下架消息和审核举报
+	RoleAdmin     = "admin"     // 管理员：全部权限
+)
+
+// 管理后台权限
+const (
+	PermUsersRead           = "users:read"
+	PermUsersModerate       = "users:moderate" // 停用、封禁、解封、强制下线
+	PermGroupsRead          = "groups:read"
+	PermGroupsManage        = "groups:manage"        // 解散群组
+	PermMessagesModerate    = "messages:moderate"    // 下架消息
+	PermJobsRun             = "jobs:run"             // 手动触发维护任务
+	PermRolesManage         = "roles:manage"         // 分配管理后台角色
+	PermReportsReview       = "reports:review"       // 审核举报
+	PermAnnouncementsManage = "announcements:manage" // 发布和撤回系统公告
+)
+
+// 用户状态，用于管理后台筛选
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+)
+
+// rolePermissions 各角色拥有的权限
+var rolePermissions = map[string][]string{
+	RoleSupport:   {PermUsersRead, PermGroupsRead},
+	RoleModerator: {PermUsersRead, PermGroupsRead, PermUsersModerate, PermMessagesModerate, PermReportsReview},
+	RoleAdmin: {PermUsersRead, PermGroupsRead, PermUsersModerate, PermMessagesModerate, PermReportsReview,
+		PermGroupsManage, PermJobsRun, PermRolesManage, PermAnnouncementsManage},
+}
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidRole  = errors.New("role must be support, moderator, admin or empty")
+	// ErrModerateStaff 不能停用或封禁有管理后台角色的用户，需先收回角色
+	ErrModerateStaff = errors.New("cannot suspend a user with an admin role, revoke the role first")
+	ErrModerateSelf  = errors.New("cannot change your own account")
+	ErrPhoneExists   = errors.New("phone number already exists")
+	ErrWeakPassword  = errors.New("password must be 6-20 characters without control characters")
+)
+
+// HasPermission 角色是否拥有权限
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AccountSuspendedError 账号被停用或封禁，Until为nil表示永久封禁
+type AccountSuspendedError struct {
+	Until  *time.Time
+	Reason string
+}
+
+func (e *AccountSuspendedError) Error() string {
+	if e.Until == nil {
+		return "account banned"
+	}
+	return "account suspended"
+}
+
+// checkAccountStatus 账号被封禁或在停用期内时返回AccountSuspendedError
+func checkAccountStatus(user *models.User, now time.Time) error {
+	if user.BannedAt != nil {
+		return &AccountSuspendedError{Reason: user.SuspendReason}
+	}
+	if user.SuspendedUntil != nil && user.SuspendedUntil.After(now) {
+		return &AccountSuspendedError{Until: user.SuspendedUntil, Reason: user.SuspendReason}
+	}
+	return nil
+}
+
+// UserMutedError 用户被禁言，禁言期间不能发消息
+type UserMutedError struct {
+	Until time.Time
+}
+
+func (e *UserMutedError) Error() string {
+	return "you are muted until " + e.Until.UTC().Format(time.RFC3339)
+}
+
+// CheckMuted 用户在禁言期内时返回UserMutedError
+func CheckMuted(ctx context.Context, userID int64) error {
+	var user models.User
+	err := database.GetDB().WithContext(ctx).Select("id", "muted_until").Where("id = ?", userID).Limit(1).Find(&user).Error
+	if err != nil {
+		return err
+	}
+	if user.MutedUntil != nil && user.MutedUntil.After(time.Now()) {
+		return &UserMutedError{Until: *user.MutedUntil}
+	}
+	return nil
+}
+
+// RevokeSessions 强制用户下线：删除登录token，并通知所有实例断开该用户的WebSocket和SSE连接
+func RevokeSessions(userID int64) error {
+	if err := cache.DeleteToken(userID); err != nil {
+		return err
+	}
+	cache.PublishInvalidation(cache.ScopeSession, userID)
+	return nil
+}
+
+// AdminUserInfo 管理后台看到的用户信息
+type AdminUserInfo struct {
+	ID             int64      `json:"id"`
+	Phone          string     `json:"phone"`
+	Nickname       string     `json:"nickname"`
+	Avatar         string     `json:"avatar"`
+	Email          string     `json:"email"`
+	IsBot          bool       `json:"is_bot"`
+	Role           string     `json:"role"`
+	Status         string     `json:"status"` // active/suspended/banned
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	BannedAt       *time.Time `json:"banned_at,omitempty"`
+	SuspendReason  string     `json:"suspend_reason,omitempty"`
+	MutedUntil     *time.Time `json:"muted_until,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// AdminUserQuery 管理后台用户搜索条件
+type AdminUserQuery struct {
+	Keyword  string // 匹配手机号、昵称，或等于用户ID
+	Role     string
+	Status   string // active/suspended/banned，为空表示全部
+	BeforeID int64  // 游标，返回ID小于该值的用户
+	Limit    int
+}
+
+// AdminGroupInfo 管理后台看到的群组详情
+type AdminGroupInfo struct {
+	Group   *models.Group     `json:"group"`
+	Members []GroupMemberInfo `json:"members"`
+	Bots    []models.Bot      `json:"bots"`
+}
+
+type AdminService struct {
+	db *gorm.DB
+}
+
+func NewAdminService() *AdminService {
+	return &AdminService{db: database.GetDB()}
+}
+
+// NewAdminServiceWithDB 创建管理后台服务（支持依赖注入）
+func NewAdminServiceWithDB(db *gorm.DB) *AdminService {
+	return &AdminService{db: db}
+}
+
+func newAdminUserInfo(user *models.User, now time.Time) AdminUserInfo {
+	info := AdminUserInfo{
+		ID:             user.ID,
+		Phone:          user.Phone,
+		Nickname:       user.Nickname,
+		Avatar:         PublicURL(user.Avatar),
+		Email:          user.Email,
+		IsBot:          user.IsBot,
+		Role:           user.Role,
+		Status:         UserStatusActive,
+		SuspendedUntil: user.SuspendedUntil,
+		BannedAt:       user.BannedAt,
+		SuspendReason:  user.SuspendReason,
+		MutedUntil:     user.MutedUntil,
+		CreatedAt:      user.CreatedAt,
+	}
+	var suspended *AccountSuspendedError
+	if errors.As(checkAccountStatus(user, now), &suspended) {
+		info.Status = UserStatusSuspended
+		if suspended.Until == nil {
+			info.Status = UserStatusBanned
+		}
+	}
+	return info
+}
+
+// GetRole 获取用户的管理后台角色，用户不存在时返回空角色
+func (s *AdminService) GetRole(ctx context.Context, userID int64) (string, error) {
+	var roles []string
+	err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Limit(1).Pluck("role", &roles).Error
+	if err != nil || len(roles) == 0 {
+		return "", err
+	}
+	return roles[0], nil
+}
+
+// SearchUsers 搜索用户，按ID倒序分页，返回是否还有下一页
+func (s *AdminService) SearchUsers(ctx context.Context, q AdminUserQuery) ([]AdminUserInfo, bool, error) {
+	if q.Limit <= 0 || q.Limit > 200 {
+		q.Limit = 50
+	}
+	now := time.Now()
+	query := s.db.WithContext(ctx).Model(&models.User{})
+	if q.Keyword != "" {
+		like := "%" + q.Keyword + "%"
+		if id, err := strconv.ParseInt(q.Keyword, 10, 64); err == nil {
+			query = query.Where("phone LIKE ? OR nickname LIKE ? OR id = ?", like, like, id)
+		} else {
+			query = query.Where("phone LIKE ? OR nickname LIKE ?", like, like)
+		}
+	}
+	if q.Role != "" {
+		query = query.Where("role = ?", q.Role)
+	}
+	switch q.Status {
+	case UserStatusActive:
+		query = query.Where("banned_at IS NULL AND (suspended_until IS NULL OR suspended_until <= ?)", now)
+	case UserStatusSuspended:
+		query = query.Where("banned_at IS NULL AND suspended_until > ?", now)
+	case UserStatusBanned:
+		query = query.Where("banned_at IS NOT NULL")
+	}
+	if q.BeforeID > 0 {
+		query = query.Where("id < ?", q.BeforeID)
+	}
+
+	var users []models.User
+	if err := query.Order("id DESC").Limit(q.Limit + 1).Find(&users).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(users) > q.Limit
+	if hasMore {
+		users = users[:q.Limit]
+	}
+	infos := make([]AdminUserInfo, 0, len(users))
+	for i := range users {
+		infos = append(infos, newAdminUserInfo(&users[i], now))
+	}
+	return infos, hasMore, nil
+}
+
+// findUser 查找未删除的用户
+func (s *AdminService) findUser(ctx context.Context, userID int64) (*models.User, error) {
+	var user models.User
+	err := database.Primary(s.db).WithContext(ctx).First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUser 获取用户详情
+func (s *AdminService) GetUser(ctx context.Context, userID int64) (*AdminUserInfo, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	info := newAdminUserInfo(user, time.Now())
+	return &info, nil
+}
+
+// SuspendUser 停用用户到until，until为nil时永久封禁；同时强制下线
+// actorID为0表示通过管理令牌操作
+func (s *AdminService) SuspendUser(ctx context.Context, actorID, userID int64, until *time.Time, reason string) (*AdminUserInfo, error) {
+	if actorID == userID {
+		return nil, ErrModerateSelf
+	}
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "" {
+		return nil, ErrModerateStaff
+	}
+
+	updates := map[string]interface{}{"suspend_reason": reason}
+	if until == nil {
+		updates["banned_at"] = time.Now()
+	} else {
+		updates["suspended_until"] = *until
+	}
+	if err := s.db.WithContext(ctx).Model(user).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	if err := RevokeSessions(userID); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, userID)
+}
+
+// MuteUser 禁言用户到until，期间可以登录和接收消息，但不能发消息
+func (s *AdminService) MuteUser(ctx context.Context, actorID, userID int64, until time.Time) (*AdminUserInfo, error) {
+	if actorID == userID {
+		return nil, ErrModerateSelf
+	}
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "" {
+		return nil, ErrModerateStaff
+	}
+	if err := s.db.WithContext(ctx).Model(user).Update("muted_until", until).Error; err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, userID)
+}
+
+// UnbanUser 解除停用、封禁和禁言，被停用或封禁的用户需要重新登录
+func (s *AdminService) UnbanUser(ctx context.Context, userID int64) (*AdminUserInfo, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"banned_at":       nil,
+		"suspended_until": nil,
+		"suspend_reason":  "",
+		"muted_until":     nil,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, userID)
+}
+
+// ForceLogout 强制用户下线，账号仍可重新登录
+func (s *AdminService) ForceLogout(ctx context.Context, userID int64) error {
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return err
+	}
+	return RevokeSessions(userID)
+}
+
+// SetRole 设置用户的管理后台角色，role为空表示收回角色；不能修改自己的角色，避免误操作后无人可以管理
+func (s *AdminService) SetRole(ctx context.Context, actorID, userID int64, role string) (*AdminUserInfo, error) {
+	if _, ok := rolePermissions[role]; !ok && role != "" {
+		return nil, ErrInvalidRole
+	}
+	if actorID == userID {
+		return nil, ErrModerateSelf
+	}
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsBot {
+		return nil, errors.New("cannot assign a role to a bot")
+	}
+	if err := s.db.WithContext(ctx).Model(user).Update("role", role).Error; err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, userID)
+}
+
+// CreateStaffUser 创建带管理后台角色的用户，供部署初始化或管理接口不可用时通过gochatctl创建管理员
+func (s *AdminService) CreateStaffUser(ctx context.Context, phone, nickname, password, role string) (*AdminUserInfo, error) {
+	if _, ok := rolePermissions[role]; !ok {
+		return nil, ErrInvalidRole
+	}
+	if !utils.ValidatePhone(phone) {
+		return nil, errors.New("invalid phone number")
+	}
+	if !utils.ValidatePassword(password) {
+		return nil, ErrWeakPassword
+	}
+	if !utils.ValidateNickname(nickname) {
+		return nil, errors.New("nickname must be 2-20 characters without control characters or surrounding spaces, and not a reserved name")
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := models.User{
+		Phone:        phone,
+		PasswordHash: hashedPassword,
+		Nickname:     nickname,
+		Avatar:       "default.png",
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	err = database.Primary(s.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("phone = ?", phone).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrPhoneExists
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return enqueueDomainEvent(tx, DomainUserRegistered, user.ID, UserRegisteredData{
+			UserID:    user.ID,
+			Nickname:  user.Nickname,
+			CreatedAt: user.CreatedAt.UnixMilli(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, user.ID)
+}
+
+// ResetPassword 重置用户密码并强制下线，已登录的设备需要用新密码重新登录
+func (s *AdminService) ResetPassword(ctx context.Context, userID int64, password string) (*AdminUserInfo, error) {
+	if !utils.ValidatePassword(password) {
+		return nil, ErrWeakPassword
+	}
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsBot {
+		return nil, errors.New("cannot reset the password of a bot")
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Model(user).Update("password_hash", hashedPassword).Error; err != nil {
+		return nil, err
+	}
+	if err := RevokeSessions(userID); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, userID)
+}
+
+// FindUserByPhone 按手机号查找用户
+func (s *AdminService) FindUserByPhone(ctx context.Context, phone string) (*AdminUserInfo, error) {
+	var user models.User
+	err := database.Primary(s.db).WithContext(ctx).Where("phone = ?", phone).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := newAdminUserInfo(&user, time.Now())
+	return &info, nil
+}
+
+// GetGroup 获取群组详情，包括成员和机器人
+func (s *AdminService) GetGroup(ctx context.Context, groupID int64) (*AdminGroupInfo, error) {
+	groupService := NewGroupServiceWithDB(s.db)
+	group, err := groupService.GetGroup(ctx, groupID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	members, err := groupService.GetGroupMembersWithUserInfo(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	bots := []models.Bot{}
+	if err := s.db.WithContext(ctx).Where("group_id = ?", groupID).Order("id").Find(&bots).Error; err != nil {
+		return nil, err
+	}
+	return &AdminGroupInfo{Group: group, Members: members, Bots: bots}, nil
+}
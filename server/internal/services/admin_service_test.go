@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/cache"
+	"gochat/internal/models"
+	"gochat/internal/utils"
+)
+
+// useTestRedis 把全局Redis客户端替换为miniredis，测试结束后恢复
+func useTestRedis(t *testing.T) {
+	t.Helper()
+	client, _ := newTestRedis(t)
+	previous := cache.RedisClient
+	cache.RedisClient = client
+	t.Cleanup(func() { cache.RedisClient = previous })
+}
+
+func TestRolePermissions(t *testing.T) {
+	assert.True(t, HasPermission(RoleSupport, PermUsersRead))
+	assert.False(t, HasPermission(RoleSupport, PermUsersModerate))
+	assert.True(t, HasPermission(RoleModerator, PermMessagesModerate))
+	assert.False(t, HasPermission(RoleModerator, PermGroupsManage))
+	assert.True(t, HasPermission(RoleAdmin, PermRolesManage))
+	assert.False(t, HasPermission("", PermUsersRead))
+	assert.False(t, HasPermission("root", PermUsersRead))
+}
+
+func TestCheckAccountStatus(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	assert.NoError(t, checkAccountStatus(&models.User{}, now))
+	assert.NoError(t, checkAccountStatus(&models.User{SuspendedUntil: &past}, now))
+
+	var suspended *AccountSuspendedError
+	require.True(t, errors.As(checkAccountStatus(&models.User{SuspendedUntil: &future, SuspendReason: "spam"}, now), &suspended))
+	assert.Equal(t, future, *suspended.Until)
+	assert.Equal(t, "spam", suspended.Reason)
+
+	require.True(t, errors.As(checkAccountStatus(&models.User{BannedAt: &past, SuspendedUntil: &future}, now), &suspended))
+	assert.Nil(t, suspended.Until)
+}
+
+func TestAdminSuspendAndBan(t *testing.T) {
+	useTestRedis(t)
+	db := newTestDB(t)
+	s := NewAdminServiceWithDB(db)
+	ctx := context.Background()
+	admin := createTestUser(t, db, "13800000001", "admin")
+	alice := createTestUser(t, db, "13800000002", "alice")
+	_, err := s.SetRole(ctx, 0, admin.ID, RoleAdmin)
+	require.NoError(t, err)
+	require.NoError(t, cache.StoreToken(alice.ID, "token", time.Hour))
+
+	var revoked []string
+	cache.OnInvalidate(cache.ScopeSession, func(id string) { revoked = append(revoked, id) })
+
+	_, err = s.SuspendUser(ctx, alice.ID, admin.ID, nil, "")
+	assert.ErrorIs(t, err, ErrModerateStaff)
+	_, err = s.SuspendUser(ctx, admin.ID, admin.ID, nil, "")
+	assert.ErrorIs(t, err, ErrModerateSelf)
+	_, err = s.SetRole(ctx, admin.ID, admin.ID, "")
+	assert.ErrorIs(t, err, ErrModerateSelf)
+	_, err = s.SetRole(ctx, admin.ID, alice.ID, "root")
+	assert.ErrorIs(t, err, ErrInvalidRole)
+
+	until := time.Now().Add(24 * time.Hour)
+	info, err := s.SuspendUser(ctx, admin.ID, alice.ID, &until, "spam")
+	require.NoError(t, err)
+	assert.Equal(t, UserStatusSuspended, info.Status)
+	assert.Equal(t, "spam", info.SuspendReason)
+	_, err = cache.GetToken(alice.ID)
+	assert.Error(t, err, "suspending should revoke the session token")
+	assert.Contains(t, revoked, "2")
+
+	info, err = s.SuspendUser(ctx, admin.ID, alice.ID, nil, "fraud")
+	require.NoError(t, err)
+	assert.Equal(t, UserStatusBanned, info.Status)
+
+	banned, _, err := s.SearchUsers(ctx, AdminUserQuery{Status: UserStatusBanned})
+	require.NoError(t, err)
+	require.Len(t, banned, 1)
+	assert.Equal(t, alice.ID, banned[0].ID)
+
+	info, err = s.UnbanUser(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, UserStatusActive, info.Status)
+	assert.Nil(t, info.BannedAt)
+	assert.Nil(t, info.SuspendedUntil)
+
+	_, err = s.GetUser(ctx, 999)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestAdminSearchUsers(t *testing.T) {
+	db := newTestDB(t)
+	s := NewAdminServiceWithDB(db)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "13800000001", "alice")
+	createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+	require.NoError(t, db.Model(carol).Update("role", RoleSupport).Error)
+
+	page, hasMore, err := s.SearchUsers(ctx, AdminUserQuery{Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	require.Len(t, page, 2)
+	assert.Equal(t, carol.ID, page[0].ID)
+
+	page, hasMore, err = s.SearchUsers(ctx, AdminUserQuery{Limit: 2, BeforeID: page[1].ID})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	require.Len(t, page, 1)
+	assert.Equal(t, alice.ID, page[0].ID)
+
+	found, _, err := s.SearchUsers(ctx, AdminUserQuery{Keyword: "bo"})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "bob", found[0].Nickname)
+
+	staff, _, err := s.SearchUsers(ctx, AdminUserQuery{Role: RoleSupport})
+	require.NoError(t, err)
+	require.Len(t, staff, 1)
+	assert.Equal(t, carol.ID, staff[0].ID)
+
+	role, err := s.GetRole(ctx, carol.ID)
+	require.NoError(t, err)
+	assert.Equal(t, RoleSupport, role)
+	role, err = s.GetRole(ctx, 999)
+	require.NoError(t, err)
+	assert.Empty(t, role)
+}
+
+func TestCreateStaffUserAndResetPassword(t *testing.T) {
+	useTestRedis(t)
+	db := newTestDB(t)
+	s := NewAdminServiceWithDB(db)
+	ctx := context.Background()
+
+	info, err := s.CreateStaffUser(ctx, "13800000001", "ops", "initial-pass", RoleAdmin)
+	require.NoError(t, err)
+	assert.Equal(t, RoleAdmin, info.Role)
+	assert.Equal(t, UserStatusActive, info.Status)
+
+	_, err = s.CreateStaffUser(ctx, "13800000001", "ops2", "initial-pass", RoleAdmin)
+	assert.ErrorIs(t, err, ErrPhoneExists)
+	_, err = s.CreateStaffUser(ctx, "13800000002", "ops2", "initial-pass", "")
+	assert.ErrorIs(t, err, ErrInvalidRole)
+	_, err = s.CreateStaffUser(ctx, "13800000002", "ops2", "123", RoleSupport)
+	assert.ErrorIs(t, err, ErrWeakPassword)
+
+	// 重置密码后旧token失效
+	require.NoError(t, cache.StoreToken(info.ID, "token", time.Hour))
+	found, err := s.FindUserByPhone(ctx, "13800000001")
+	require.NoError(t, err)
+	_, err = s.ResetPassword(ctx, found.ID, "new-password")
+	require.NoError(t, err)
+	var user models.User
+	require.NoError(t, db.First(&user, info.ID).Error)
+	assert.True(t, utils.CheckPasswordHash("new-password", user.PasswordHash))
+	_, err = cache.GetToken(info.ID)
+	assert.Error(t, err)
+
+	_, err = s.ResetPassword(ctx, info.ID, "123")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+	_, err = s.FindUserByPhone(ctx, "13800000009")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestAdminDissolveGroupAndTakedown(t *testing.T) {
+	db := newTestDB(t)
+	s := NewAdminServiceWithDB(db)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	groupService := NewGroupServiceWithDB(db)
+	group, err := groupService.CreateGroupWithMembers(ctx, alice.ID, "team", []int64{bob.ID})
+	require.NoError(t, err)
+
+	messageService := NewMessageServiceWithDB(db)
+	messageID, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: bob.ID, GroupID: &group.ID, Content: "spam", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	removed, err := messageService.TakedownMessage(ctx, messageID)
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, removed.FromUserID)
+	_, err = messageService.TakedownMessage(ctx, messageID)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+
+	info, err := s.GetGroup(ctx, group.ID)
+	require.NoError(t, err)
+	assert.Len(t, info.Members, 2)
+	assert.Empty(t, info.Bots)
+
+	memberIDs, err := groupService.DissolveGroup(ctx, group.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{alice.ID, bob.ID}, memberIDs)
+	var members int64
+	require.NoError(t, db.Model(&models.GroupMember{}).Where("group_id = ?", group.ID).Count(&members).Error)
+	assert.Zero(t, members)
+
+	_, err = s.GetGroup(ctx, group.ID)
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+	_, err = groupService.DissolveGroup(ctx, group.ID)
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+}
+
+func TestMaintenanceJobs(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	RegisterMaintenanceJob("test_job", "test", func() {
+		close(started)
+		<-release
+	})
+	t.Cleanup(func() {
+		maintenanceMu.Lock()
+		delete(maintenanceJobs, "test_job")
+		maintenanceMu.Unlock()
+	})
+
+	assert.ErrorIs(t, RunMaintenanceJob("missing"), ErrJobNotFound)
+	require.NoError(t, RunMaintenanceJob("test_job"))
+	<-started
+	assert.ErrorIs(t, RunMaintenanceJob("test_job"), ErrJobRunning)
+
+	jobs := ListMaintenanceJobs()
+	require.NotEmpty(t, jobs)
+	var job MaintenanceJob
+	for _, j := range jobs {
+		if j.Name == "test_job" {
+			job = j
+		}
+	}
+	assert.True(t, job.Running)
+	assert.NotNil(t, job.LastStartedAt)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		for _, j := range ListMaintenanceJobs() {
+			if j.Name == "test_job" {
+				return !j.Running
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+// 运营统计键前缀，按UTC日期统计
+const (
+	activeUsersPrefix      = "stats:active:"      // stats:active:{20260101} 当天的活跃用户（HyperLogLog）
+	activeUserIDsPrefix    = "stats:active_ids:"  // stats:active_ids:{20260101} 当天新记录、尚未由统计汇总任务持久化的活跃用户（SET）
+	connectionSamplePrefix = "stats:conn:"        // stats:conn:{202601011200} 该分钟各实例的连接数（HASH，field为节点号）
+	peakConnectionsPrefix  = "stats:peak:"        // stats:peak:{20260101} 当天的峰值连接数
+	dailyStatsCachePrefix  = "stats:admin:daily:" // stats:admin:daily:{20260101} 计算好的当天统计
+	statsTotalsCacheKey    = "stats:admin:totals" // 用户和文件总量
+	statsDateLayout        = "20060102"
+)
+
+// pastDailyStatsTTL 已结束日期的统计缓存时长，当天之后只有被清理的文件会改变结果
+const pastDailyStatsTTL = 7 * 24 * time.Hour
+
+// maxTrackedActiveUsers 每个实例在内存中去重的活跃用户数上限，超出后每次都写Redis
+const maxTrackedActiveUsers = 1 << 20
+
+// activeUserIDsTTL 待持久化的活跃用户集合的保留时长，统计汇总任务停止时不会无限增长
+const activeUserIDsTTL = 72 * time.Hour
+
+// ErrInvalidStatsRange 统计的时间范围无效（起始日期晚于结束日期或超过最大天数）
+var ErrInvalidStatsRange = errors.New("invalid stats range")
+
+// recordConnectionsScript 记录本实例当前分钟的连接数，所有实例之和超过当天峰值时更新峰值
+// ARGV: 节点号, 连接数, 峰值保留毫秒数
+var recordConnectionsScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('EXPIRE', KEYS[1], 300)
+local total = 0
+for _, v in ipairs(redis.call('HVALS', KEYS[1])) do
+	total = total + tonumber(v)
+end
+local peak = tonumber(redis.call('GET', KEYS[2]) or '0')
+if total > peak then
+	redis.call('SET', KEYS[2], total, 'PX', ARGV[3])
+end
+return total
+`)
+
+// statsDate 统计使用的UTC日期
+func statsDate(t time.Time) string {
+	return t.UTC().Format(statsDateLayout)
+}
+
+// ActiveUserTracker 记录每天的活跃用户（Redis HyperLogLog），每个实例在内存中去重，同一用户每天只写一次Redis
+type ActiveUserTracker struct {
+	client *redis.Client
+	now    func() time.Time
+
+	mu   sync.Mutex
+	day  string
+	seen map[int64]struct{}
+}
+
+// NewActiveUserTracker 创建活跃用户记录器
+func NewActiveUserTracker(client *redis.Client) *ActiveUserTracker {
+	return &ActiveUserTracker{client: client, now: time.Now, seen: make(map[int64]struct{})}
+}
+
+var (
+	activeUsersOnce sync.Once
+	activeUsers     *ActiveUserTracker
+)
+
+// RecordActiveUsers 记录用户今天活跃（HTTP认证、建立连接时调用，在线用户定期调用）
+func RecordActiveUsers(ctx context.Context, userIDs ...int64) {
+	activeUsersOnce.Do(func() {
+		activeUsers = NewActiveUserTracker(cache.GetRedisClient())
+	})
+	activeUsers.Record(ctx, userIDs...)
+}
+
+// Record 记录用户今天活跃，今天已记录过的用户跳过；写入失败只记录日志，下次调用时重试
+func (t *ActiveUserTracker) Record(ctx context.Context, userIDs ...int64) {
+	if t.client == nil {
+		return
+	}
+	day := statsDate(t.now())
+
+	t.mu.Lock()
+	if day != t.day {
+		t.day = day
+		t.seen = make(map[int64]struct{})
+	}
+	var members []interface{}
+	var added []int64
+	for _, id := range userIDs {
+		if _, ok := t.seen[id]; ok {
+			continue
+		}
+		if len(t.seen) < maxTrackedActiveUsers {
+			t.seen[id] = struct{}{}
+			added = append(added, id)
+		}
+		members = append(members, id)
+	}
+	t.mu.Unlock()
+	if len(members) == 0 {
+		return
+	}
+
+	key := activeUsersPrefix + day
+	pipe := t.client.Pipeline()
+	pipe.PFAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, cache.DailyStatsTTL)
+	pipe.SAdd(ctx, activeUserIDsPrefix+day, members...)
+	pipe.Expire(ctx, activeUserIDsPrefix+day, activeUserIDsTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.WithContext(ctx).Warnf("记录活跃用户失败: %v", err)
+		t.mu.Lock()
+		if t.day == day {
+			for _, id := range added {
+				delete(t.seen, id)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// DailyStats 一天（UTC）的运营统计
+type DailyStats struct {
+	Date              string `json:"date"` // 2026-01-01
+	ActiveUsers       int64  `json:"active_users"`
+	WeeklyActiveUsers int64  `json:"weekly_active_users"` // 截至当天的7天内活跃用户
+	Messages          int64  `json:"messages"`
+	NewUsers          int64  `json:"new_users"`
+	PeakConnections   int64  `json:"peak_connections"` // 所有实例连接数之和的峰值（按分钟采样）
+	NewFiles          int64  `json:"new_files"`
+	StorageBytes      int64  `json:"storage_bytes"` // 当天新增的文件存储字节数（去重后）
+}
+
+// StatsSummary 时间范围内的汇总
+type StatsSummary struct {
+	ActiveUsers     int64 `json:"active_users"` // 时间范围内的活跃用户（去重）
+	Messages        int64 `json:"messages"`
+	NewUsers        int64 `json:"new_users"`
+	PeakConnections int64 `json:"peak_connections"`
+	NewFiles        int64 `json:"new_files"`
+	StorageBytes    int64 `json:"storage_bytes"`
+}
+
+// StatsTotals 当前总量
+type StatsTotals struct {
+	Users        int64 `json:"users"`
+	Files        int64 `json:"files"`
+	StorageBytes int64 `json:"storage_bytes"`
+}
+
+// AdminStats 运营统计查询结果
+type AdminStats struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Days    []DailyStats `json:"days"`
+	Summary StatsSummary `json:"summary"`
+	Totals  StatsTotals  `json:"totals"`
+}
+
+// AdminStatsService 运营统计：活跃用户、消息数、峰值连接数来自Redis中的每日计数，注册数和存储增长来自数据库
+type AdminStatsService struct {
+	client   *redis.Client
+	db       *gorm.DB
+	cfg      *config.AdminStatsConfig
+	cacheTTL time.Duration
+	now      func() time.Time
+}
+
+// NewAdminStatsService 创建运营统计服务
+func NewAdminStatsService(cfg *config.AdminStatsConfig) *AdminStatsService {
+	return NewAdminStatsServiceWithClient(cache.GetRedisClient(), database.GetDB(), cfg)
+}
+
+// NewAdminStatsServiceWithClient 创建运营统计服务（支持依赖注入），配置已在加载时校验
+func NewAdminStatsServiceWithClient(client *redis.Client, db *gorm.DB, cfg *config.AdminStatsConfig) *AdminStatsService {
+	s := &AdminStatsService{client: client, db: db, cfg: cfg, now: time.Now}
+	s.cacheTTL, _ = time.ParseDuration(cfg.CacheTTL)
+	return s
+}
+
+// RecordConnections 记录本实例当前的连接数，用于统计所有实例的峰值连接数，每分钟调用一次
+func (s *AdminStatsService) RecordConnections(ctx context.Context, nodeID int64, count int) error {
+	now := s.now().UTC()
+	keys := []string{connectionSamplePrefix + now.Format("200601021504"), peakConnectionsPrefix + statsDate(now)}
+	return recordConnectionsScript.Run(ctx, s.client, keys, nodeID, count, cache.DailyStatsTTL.Milliseconds()).Err()
+}
+
+// NodeConnections 各实例最近上报的连接数，键为节点号；实例每分钟上报一次，停止超过两分钟的实例不再出现
+func (s *AdminStatsService) NodeConnections(ctx context.Context) (map[int64]int, error) {
+	now := s.now().UTC()
+	result := make(map[int64]int)
+	// 本分钟还有实例未上报，先取上一分钟的采样，再用本分钟已上报的覆盖
+	for _, minute := range []time.Time{now.Add(-time.Minute), now} {
+		values, err := s.client.HGetAll(ctx, connectionSamplePrefix+minute.Format("200601021504")).Result()
+		if err != nil {
+			return nil, err
+		}
+		for field, value := range values {
+			nodeID, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				continue
+			}
+			if count, err := strconv.Atoi(value); err == nil {
+				result[nodeID] = count
+			}
+		}
+	}
+	return result, nil
+}
+
+// Query 查询from到to（UTC日期，含两端）的每日统计、汇总和当前总量
+func (s *AdminStatsService) Query(ctx context.Context, from, to time.Time) (*AdminStats, error) {
+	from, to = truncateDay(from), truncateDay(to)
+	days := int(to.Sub(from)/(24*time.Hour)) + 1
+	if days <= 0 || days > s.cfg.MaxDays {
+		return nil, ErrInvalidStatsRange
+	}
+
+	result := &AdminStats{From: from.Format(time.DateOnly), To: to.Format(time.DateOnly), Days: make([]DailyStats, 0, days)}
+	activeKeys := make([]string, 0, days)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		daily, err := s.dailyStats(ctx, day)
+		if err != nil {
+			return nil, err
+		}
+		result.Days = append(result.Days, *daily)
+		activeKeys = append(activeKeys, activeUsersPrefix+statsDate(day))
+
+		result.Summary.Messages += daily.Messages
+		result.Summary.NewUsers += daily.NewUsers
+		result.Summary.NewFiles += daily.NewFiles
+		result.Summary.StorageBytes += daily.StorageBytes
+		if daily.PeakConnections > result.Summary.PeakConnections {
+			result.Summary.PeakConnections = daily.PeakConnections
+		}
+	}
+
+	// 多个HyperLogLog的PFCOUNT返回并集的基数，即范围内去重后的活跃用户数
+	if active, err := s.client.PFCount(ctx, activeKeys...).Result(); err != nil {
+		logger.WithContext(ctx).Warnf("统计活跃用户失败: %v", err)
+	} else {
+		result.Summary.ActiveUsers = active
+	}
+
+	totals, err := s.totals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result.Totals = *totals
+	return result, nil
+}
+
+// dailyStats 一天的统计，优先使用缓存；Redis出错时相应字段为0且不缓存
+func (s *AdminStatsService) dailyStats(ctx context.Context, day time.Time) (*DailyStats, error) {
+	date := statsDate(day)
+	cacheKey := dailyStatsCachePrefix + date
+	var daily DailyStats
+	if data, err := s.client.Get(ctx, cacheKey).Bytes(); err == nil && json.Unmarshal(data, &daily) == nil {
+		return &daily, nil
+	}
+
+	daily.Date = day.Format(time.DateOnly)
+	weekKeys := make([]string, 0, 7)
+	for i := 0; i < 7; i++ {
+		weekKeys = append(weekKeys, activeUsersPrefix+statsDate(day.AddDate(0, 0, -i)))
+	}
+	pipe := s.client.Pipeline()
+	active := pipe.PFCount(ctx, activeUsersPrefix+date)
+	weekly := pipe.PFCount(ctx, weekKeys...)
+	messages := pipe.Get(ctx, cache.MessageStatsPrefix+date)
+	peak := pipe.Get(ctx, peakConnectionsPrefix+date)
+	_, redisErr := pipe.Exec(ctx)
+	if redisErr == redis.Nil {
+		redisErr = nil
+	}
+	if redisErr != nil {
+		logger.WithContext(ctx).Warnf("读取 %s 的统计计数失败: %v", date, redisErr)
+	} else {
+		daily.ActiveUsers = active.Val()
+		daily.WeeklyActiveUsers = weekly.Val()
+		daily.Messages, _ = strconv.ParseInt(messages.Val(), 10, 64)
+		daily.PeakConnections, _ = strconv.ParseInt(peak.Val(), 10, 64)
+	}
+
+	end := day.AddDate(0, 0, 1)
+	db := s.db.WithContext(ctx)
+	// 已注销的用户同样计入当天的注册数
+	if err := db.Unscoped().Model(&models.User{}).
+		Where("created_at >= ? AND created_at < ?", day, end).
+		Count(&daily.NewUsers).Error; err != nil {
+		return nil, err
+	}
+	var files struct {
+		Count int64
+		Bytes int64
+	}
+	if err := db.Model(&models.FileStorage{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("created_at >= ? AND created_at < ?", day, end).
+		Scan(&files).Error; err != nil {
+		return nil, err
+	}
+	daily.NewFiles, daily.StorageBytes = files.Count, files.Bytes
+
+	if redisErr == nil {
+		ttl := s.cacheTTL
+		if end.Before(s.now()) {
+			ttl = pastDailyStatsTTL
+		}
+		if data, err := json.Marshal(daily); err == nil {
+			s.client.Set(ctx, cacheKey, data, ttl)
+		}
+	}
+	return &daily, nil
+}
+
+// totals 当前的用户和文件总量，缓存cacheTTL
+func (s *AdminStatsService) totals(ctx context.Context) (*StatsTotals, error) {
+	var totals StatsTotals
+	if data, err := s.client.Get(ctx, statsTotalsCacheKey).Bytes(); err == nil && json.Unmarshal(data, &totals) == nil {
+		return &totals, nil
+	}
+
+	db := s.db.WithContext(ctx)
+	if err := db.Model(&models.User{}).Count(&totals.Users).Error; err != nil {
+		return nil, err
+	}
+	var files struct {
+		Count int64
+		Bytes int64
+	}
+	if err := db.Model(&models.FileStorage{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS bytes").
+		Scan(&files).Error; err != nil {
+		return nil, err
+	}
+	totals.Files, totals.StorageBytes = files.Count, files.Bytes
+
+	if data, err := json.Marshal(totals); err == nil {
+		s.client.Set(ctx, statsTotalsCacheKey, data, s.cacheTTL)
+	}
+	return &totals, nil
+}
+
+// truncateDay 时间所在UTC日期的零点
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
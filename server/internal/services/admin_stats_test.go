@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+func newTestRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client, mr
+}
+
+func TestActiveUserTracker(t *testing.T) {
+	client, mr := newTestRedis(t)
+	ctx := context.Background()
+	tracker := NewActiveUserTracker(client)
+	current := time.Date(2026, 10, 1, 23, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return current }
+
+	tracker.Record(ctx, 1, 2)
+	tracker.Record(ctx, 2, 3)
+	count, err := client.PFCount(ctx, "stats:active:20261001").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	assert.True(t, mr.TTL("stats:active:20261001") > 0)
+
+	// 已记录的用户不再写Redis：删除键后重复记录不会重新创建
+	mr.Del("stats:active:20261001")
+	tracker.Record(ctx, 1, 2, 3)
+	assert.False(t, mr.Exists("stats:active:20261001"))
+
+	// 跨日后重新记录
+	current = current.Add(2 * time.Hour)
+	tracker.Record(ctx, 1)
+	count, err = client.PFCount(ctx, "stats:active:20261002").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestActiveUserTrackerRetriesAfterFailure(t *testing.T) {
+	client, mr := newTestRedis(t)
+	ctx := context.Background()
+	tracker := NewActiveUserTracker(client)
+
+	mr.SetError("LOADING")
+	tracker.Record(ctx, 1)
+	mr.SetError("")
+	tracker.Record(ctx, 1)
+
+	count, err := client.PFCount(ctx, activeUsersPrefix+statsDate(time.Now())).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func newTestAdminStats(t *testing.T) (*AdminStatsService, *redis.Client, *time.Time) {
+	t.Helper()
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	s := NewAdminStatsServiceWithClient(client, db, &config.AdminStatsConfig{MaxDays: 31, CacheTTL: "5m"})
+	current := time.Date(2026, 10, 2, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return current }
+	return s, client, &current
+}
+
+func TestRecordConnectionsKeepsDailyPeak(t *testing.T) {
+	s, client, now := newTestAdminStats(t)
+	ctx := context.Background()
+
+	// 同一分钟内各实例的连接数相加，同一实例重复上报时覆盖
+	require.NoError(t, s.RecordConnections(ctx, 0, 100))
+	require.NoError(t, s.RecordConnections(ctx, 1, 50))
+	require.NoError(t, s.RecordConnections(ctx, 1, 70))
+	peak, err := client.Get(ctx, "stats:peak:20261002").Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(170), peak)
+
+	// 下一分钟连接数下降，峰值不变
+	*now = now.Add(time.Minute)
+	require.NoError(t, s.RecordConnections(ctx, 0, 20))
+	peak, err = client.Get(ctx, "stats:peak:20261002").Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(170), peak)
+
+	// 本分钟尚未上报的实例沿用上一分钟的采样
+	nodes, err := s.NodeConnections(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int{0: 20, 1: 70}, nodes)
+}
+
+func TestAdminStatsQuery(t *testing.T) {
+	s, client, _ := newTestAdminStats(t)
+	ctx := context.Background()
+	day1 := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	day2 := time.Date(2026, 10, 2, 8, 0, 0, 0, time.UTC)
+
+	alice := createTestUser(t, s.db, "13800000001", "alice")
+	bob := createTestUser(t, s.db, "13800000002", "bob")
+	carol := createTestUser(t, s.db, "13800000003", "carol")
+	require.NoError(t, s.db.Model(alice).Update("created_at", day1).Error)
+	require.NoError(t, s.db.Model(bob).Update("created_at", day2).Error)
+	require.NoError(t, s.db.Model(carol).Update("created_at", day2).Error)
+	require.NoError(t, s.db.Delete(carol).Error)
+	require.NoError(t, s.db.Create(&models.FileStorage{Hash: "a", FileSize: 1000, StoragePath: "a", CreatedAt: day1}).Error)
+	require.NoError(t, s.db.Create(&models.FileStorage{Hash: "b", FileSize: 500, StoragePath: "b", CreatedAt: day2}).Error)
+	require.NoError(t, s.db.Create(&models.FileStorage{Hash: "c", FileSize: 250, StoragePath: "c", CreatedAt: day2}).Error)
+
+	// miniredis对多个键的PFCOUNT返回各键基数之和而不是并集，这里两天的活跃用户不重叠
+	require.NoError(t, client.PFAdd(ctx, "stats:active:20261001", 1, 2).Err())
+	require.NoError(t, client.PFAdd(ctx, "stats:active:20261002", 3, 4).Err())
+	require.NoError(t, client.Set(ctx, cache.MessageStatsPrefix+"20261001", 10, 0).Err())
+	require.NoError(t, client.Set(ctx, cache.MessageStatsPrefix+"20261002", 5, 0).Err())
+	require.NoError(t, client.Set(ctx, "stats:peak:20261002", 42, 0).Err())
+
+	stats, err := s.Query(ctx, day1, day2)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10-01", stats.From)
+	assert.Equal(t, "2026-10-02", stats.To)
+	require.Len(t, stats.Days, 2)
+	assert.Equal(t, DailyStats{Date: "2026-10-01", ActiveUsers: 2, WeeklyActiveUsers: 2, Messages: 10, NewUsers: 1, NewFiles: 1, StorageBytes: 1000}, stats.Days[0])
+	assert.Equal(t, DailyStats{Date: "2026-10-02", ActiveUsers: 2, WeeklyActiveUsers: 4, Messages: 5, NewUsers: 2, PeakConnections: 42, NewFiles: 2, StorageBytes: 750}, stats.Days[1])
+	assert.Equal(t, StatsSummary{ActiveUsers: 4, Messages: 15, NewUsers: 3, PeakConnections: 42, NewFiles: 3, StorageBytes: 1750}, stats.Summary)
+	assert.Equal(t, StatsTotals{Users: 2, Files: 3, StorageBytes: 1750}, stats.Totals)
+
+	// 结果已缓存：已结束的日期缓存7天，当天按cache_ttl缓存
+	assert.Greater(t, client.TTL(ctx, "stats:admin:daily:20261001").Val(), 24*time.Hour)
+	assert.Equal(t, 5*time.Minute, client.TTL(ctx, "stats:admin:daily:20261002").Val())
+	require.NoError(t, client.Set(ctx, cache.MessageStatsPrefix+"20261002", 6, 0).Err())
+	stats, err = s.Query(ctx, day1, day2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stats.Days[1].Messages)
+}
+
+func TestAdminStatsQueryRejectsInvalidRange(t *testing.T) {
+	s, _, now := newTestAdminStats(t)
+	ctx := context.Background()
+
+	_, err := s.Query(ctx, *now, now.AddDate(0, 0, -1))
+	assert.ErrorIs(t, err, ErrInvalidStatsRange)
+	_, err = s.Query(ctx, now.AddDate(0, 0, -31), *now)
+	assert.ErrorIs(t, err, ErrInvalidStatsRange)
+	_, err = s.Query(ctx, now.AddDate(0, 0, -30), *now)
+	assert.NoError(t, err)
+}
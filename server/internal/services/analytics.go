@@ -0,0 +1,475 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+// analyticsWatermarkKey 统计汇总已完成到的整点（Unix秒），停机后从这里补算
+const analyticsWatermarkKey = "stats:analytics:watermark"
+
+const (
+	// activityPopBatch 每次从待持久化集合中取出的活跃用户数
+	activityPopBatch = 1000
+	// maxRetentionOffsets 留存查询最多的天数点
+	maxRetentionOffsets = 10
+	// maxRetentionOffset 留存查询的最大天数
+	maxRetentionOffset = 365
+	// maxGroupLeaderboard 群活跃度排行最多返回的群数
+	maxGroupLeaderboard = 100
+)
+
+// ErrInvalidRetentionDays 留存查询的天数点无效
+var ErrInvalidRetentionDays = errors.New("invalid retention days")
+
+// DefaultRetentionDays 默认查询的留存天数点（次日、7日、30日留存）
+var DefaultRetentionDays = []int{1, 7, 30}
+
+// messageTypeName 统计结果中消息类型的名称，与指标标签相同
+func messageTypeName(msgType int) string {
+	if name, ok := messageTypeNames[msgType]; ok {
+		return name
+	}
+	return strconv.Itoa(msgType)
+}
+
+// AnalyticsService 统计汇总和查询
+// 汇总任务从消息表（包括归档表和已删除的消息）计算每小时消息数和每日群活跃度，并持久化每日活跃用户；
+// 运营统计接口按消息类型、活跃用户、群活跃度排行和注册留存查询汇总结果
+type AnalyticsService struct {
+	client       *redis.Client
+	db           *gorm.DB
+	lookback     time.Duration
+	backfillDays int
+	maxDays      int
+	now          func() time.Time
+}
+
+// NewAnalyticsService 创建统计服务
+func NewAnalyticsService(cfg *config.Config) *AnalyticsService {
+	return NewAnalyticsServiceWithClient(cache.GetRedisClient(), database.GetDB(), cfg)
+}
+
+// NewAnalyticsServiceWithClient 创建统计服务（支持依赖注入），配置已在加载时校验
+func NewAnalyticsServiceWithClient(client *redis.Client, db *gorm.DB, cfg *config.Config) *AnalyticsService {
+	s := &AnalyticsService{
+		client:       client,
+		db:           db,
+		backfillDays: cfg.Analytics.BackfillDays,
+		maxDays:      cfg.Admin.Stats.MaxDays,
+		now:          time.Now,
+	}
+	s.lookback, _ = time.ParseDuration(cfg.Analytics.Lookback)
+	return s
+}
+
+// Rollup 汇总从上次完成的整点（至少最近lookback）到当前整点的数据，重复执行结果相同
+// 消息数和群活跃度按整点和天整体重算，活跃用户只追加
+func (s *AnalyticsService) Rollup(ctx context.Context) error {
+	now := s.now().UTC()
+	currentHour := now.Truncate(time.Hour)
+	start := currentHour.Add(-s.lookback)
+	if watermark, err := s.client.Get(ctx, analyticsWatermarkKey).Int64(); err == nil {
+		if last := time.Unix(watermark, 0).UTC(); last.Before(start) {
+			start = last
+		}
+	} else if err == redis.Nil {
+		start = truncateDay(now).AddDate(0, 0, -s.backfillDays)
+	} else {
+		return err
+	}
+	if earliest := truncateDay(now).AddDate(0, 0, -s.backfillDays); start.Before(earliest) {
+		start = earliest
+	}
+
+	for hour := start; !hour.After(currentHour); hour = hour.Add(time.Hour) {
+		if err := s.rollupHour(ctx, hour); err != nil {
+			return err
+		}
+	}
+	for day := truncateDay(start); !day.After(now); day = day.AddDate(0, 0, 1) {
+		if err := s.rollupGroupDay(ctx, day); err != nil {
+			return err
+		}
+		windowStart := day
+		if start.After(windowStart) {
+			windowStart = start
+		}
+		if err := s.rollupActiveUsers(ctx, day, windowStart); err != nil {
+			return err
+		}
+	}
+	// 当前整点还会有新消息，下次从当前整点开始
+	return s.client.Set(ctx, analyticsWatermarkKey, currentHour.Unix(), 0).Err()
+}
+
+// sentMessages 时间范围内发送的消息（热表和归档表，包括已删除的），作为子查询使用
+func sentMessages(columns, where string) string {
+	return "(SELECT " + columns + " FROM " + models.Message{}.TableName() + " WHERE " + where +
+		" UNION ALL SELECT " + columns + " FROM " + models.ArchivedMessage{}.TableName() + " WHERE " + where + ") t"
+}
+
+// rollupHour 重算一个整点的消息数
+func (s *AnalyticsService) rollupHour(ctx context.Context, hour time.Time) error {
+	end := hour.Add(time.Hour)
+	var rows []models.MessageStatHourly
+	// chat_type: 1=单聊, 2=群聊（models.ConversationTypePrivate、models.ConversationTypeGroup）
+	err := s.db.WithContext(ctx).
+		Table(sentMessages("CASE WHEN group_id IS NULL THEN 1 ELSE 2 END AS chat_type, msg_type", "created_at >= ? AND created_at < ?"), hour, end, hour, end).
+		Select("chat_type, msg_type, COUNT(*) AS count").
+		Group("chat_type, msg_type").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		rows[i].Hour = hour
+	}
+	return database.Primary(s.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("hour = ?", hour).Delete(&models.MessageStatHourly{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// rollupGroupDay 重算一天的群消息数和发言人数
+func (s *AnalyticsService) rollupGroupDay(ctx context.Context, day time.Time) error {
+	end := day.AddDate(0, 0, 1)
+	var rows []models.GroupActivityDay
+	err := s.db.WithContext(ctx).
+		Table(sentMessages("group_id, from_user_id", "group_id IS NOT NULL AND created_at >= ? AND created_at < ?"), day, end, day, end).
+		Select("group_id, COUNT(*) AS messages, COUNT(DISTINCT from_user_id) AS senders").
+		Group("group_id").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		rows[i].Day = day
+	}
+	return database.Primary(s.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("day = ?", day).Delete(&models.GroupActivityDay{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&rows, 500).Error
+	})
+}
+
+// rollupActiveUsers 持久化一天的活跃用户：from之后发送过消息的用户，以及活跃用户记录器记录、尚未持久化的用户
+func (s *AnalyticsService) rollupActiveUsers(ctx context.Context, day, from time.Time) error {
+	end := day.AddDate(0, 0, 1)
+	var senders []int64
+	err := s.db.WithContext(ctx).
+		Table(sentMessages("from_user_id", "created_at >= ? AND created_at < ?"), from, end, from, end).
+		Distinct("from_user_id").
+		Pluck("from_user_id", &senders).Error
+	if err != nil {
+		return err
+	}
+	if err := s.insertActivity(ctx, day, senders); err != nil {
+		return err
+	}
+
+	// 取出后写入数据库，写入失败时放回集合下次重试
+	key := activeUserIDsPrefix + statsDate(day)
+	for {
+		members, err := s.client.SPopN(ctx, key, activityPopBatch).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if len(members) == 0 {
+			return nil
+		}
+		userIDs := make([]int64, 0, len(members))
+		for _, member := range members {
+			if id, err := strconv.ParseInt(member, 10, 64); err == nil {
+				userIDs = append(userIDs, id)
+			}
+		}
+		if err := s.insertActivity(ctx, day, userIDs); err != nil {
+			values := make([]interface{}, len(members))
+			for i, member := range members {
+				values[i] = member
+			}
+			if restoreErr := s.client.SAdd(ctx, key, values...).Err(); restoreErr != nil {
+				logger.WithContext(ctx).Warnf("放回待持久化的活跃用户失败: %v", restoreErr)
+			}
+			return err
+		}
+		if len(members) < activityPopBatch {
+			return nil
+		}
+	}
+}
+
+// insertActivity 记录用户当天活跃，已记录的跳过
+func (s *AnalyticsService) insertActivity(ctx context.Context, day time.Time, userIDs []int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	rows := make([]models.UserActivityDay, len(userIDs))
+	for i, id := range userIDs {
+		rows[i] = models.UserActivityDay{Day: day, UserID: id}
+	}
+	return database.Primary(s.db).WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(&rows, 500).Error
+}
+
+// checkRange 校验并规范化查询范围（UTC日期，含两端）
+func (s *AnalyticsService) checkRange(from, to time.Time) (time.Time, time.Time, error) {
+	from, to = truncateDay(from), truncateDay(to)
+	days := int(to.Sub(from)/(24*time.Hour)) + 1
+	if days <= 0 || days > s.maxDays {
+		return from, to, ErrInvalidStatsRange
+	}
+	return from, to, nil
+}
+
+// MessageStatsBucket 一天或一小时的消息数
+type MessageStatsBucket struct {
+	Time    string           `json:"time,omitempty"` // 按天为2026-01-01，按小时为2026-01-01T13:00:00Z
+	Total   int64            `json:"total"`
+	Private int64            `json:"private"`
+	Group   int64            `json:"group"`
+	ByType  map[string]int64 `json:"by_type"` // 按消息类型：text、image、voice、video、file、call
+}
+
+func (b *MessageStatsBucket) add(row *models.MessageStatHourly) {
+	b.Total += row.Count
+	if row.ChatType == models.ConversationTypeGroup {
+		b.Group += row.Count
+	} else {
+		b.Private += row.Count
+	}
+	b.ByType[messageTypeName(row.MsgType)] += row.Count
+}
+
+// MessageStats 消息数统计结果
+type MessageStats struct {
+	From        string               `json:"from"`
+	To          string               `json:"to"`
+	Granularity string               `json:"granularity"` // day或hour
+	Buckets     []MessageStatsBucket `json:"buckets"`
+	Summary     MessageStatsBucket   `json:"summary"`
+}
+
+// MessageStats 查询from到to（UTC日期，含两端）按天或按小时的消息数，没有消息的时段计为0
+func (s *AnalyticsService) MessageStats(ctx context.Context, from, to time.Time, hourly bool) (*MessageStats, error) {
+	from, to, err := s.checkRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	end := to.AddDate(0, 0, 1)
+	var rows []models.MessageStatHourly
+	if err := s.db.WithContext(ctx).Where("hour >= ? AND hour < ?", from, end).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := &MessageStats{
+		From:        from.Format(time.DateOnly),
+		To:          to.Format(time.DateOnly),
+		Granularity: "day",
+		Summary:     MessageStatsBucket{ByType: map[string]int64{}},
+	}
+	step, layout := 24*time.Hour, time.DateOnly
+	if hourly {
+		result.Granularity = "hour"
+		step, layout = time.Hour, time.RFC3339
+	}
+	index := make(map[int64]int)
+	for t := from; t.Before(end); t = t.Add(step) {
+		index[t.Unix()] = len(result.Buckets)
+		result.Buckets = append(result.Buckets, MessageStatsBucket{Time: t.Format(layout), ByType: map[string]int64{}})
+	}
+	for i := range rows {
+		bucket := rows[i].Hour.UTC()
+		if !hourly {
+			bucket = truncateDay(bucket)
+		}
+		if j, ok := index[bucket.Unix()]; ok {
+			result.Buckets[j].add(&rows[i])
+			result.Summary.add(&rows[i])
+		}
+	}
+	return result, nil
+}
+
+// ActiveUserDay 一天的活跃用户数
+type ActiveUserDay struct {
+	Date        string `json:"date"`
+	ActiveUsers int64  `json:"active_users"`
+}
+
+// ActiveUserStats 活跃用户统计结果，数据来自持久化的每日活跃用户，为精确值
+type ActiveUserStats struct {
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Days        []ActiveUserDay `json:"days"`
+	ActiveUsers int64           `json:"active_users"` // 整个范围内去重后的活跃用户数
+}
+
+// ActiveUsers 查询from到to（UTC日期，含两端）每天的活跃用户数和范围内去重后的活跃用户数
+func (s *AnalyticsService) ActiveUsers(ctx context.Context, from, to time.Time) (*ActiveUserStats, error) {
+	from, to, err := s.checkRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	result := &ActiveUserStats{From: from.Format(time.DateOnly), To: to.Format(time.DateOnly)}
+	db := s.db.WithContext(ctx).Model(&models.UserActivityDay{})
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		var count int64
+		if err := db.Session(&gorm.Session{}).Where("day = ?", day).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		result.Days = append(result.Days, ActiveUserDay{Date: day.Format(time.DateOnly), ActiveUsers: count})
+	}
+	err = db.Session(&gorm.Session{}).
+		Where("day >= ? AND day <= ?", from, to).
+		Distinct("user_id").
+		Count(&result.ActiveUsers).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GroupActivity 群活跃度排行中的一项
+type GroupActivity struct {
+	GroupID     int64  `json:"group_id"`
+	Name        string `json:"name"`
+	Dissolved   bool   `json:"dissolved"`
+	Messages    int64  `json:"messages"`
+	ActiveDays  int64  `json:"active_days"`  // 有消息的天数
+	PeakSenders int64  `json:"peak_senders"` // 单日最多的发言人数
+}
+
+// GroupLeaderboard 查询from到to（UTC日期，含两端）消息数最多的群，按消息数倒序
+func (s *AnalyticsService) GroupLeaderboard(ctx context.Context, from, to time.Time, limit int) ([]GroupActivity, error) {
+	from, to, err := s.checkRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxGroupLeaderboard {
+		limit = 10
+	}
+	groups := []GroupActivity{}
+	err = s.db.WithContext(ctx).Model(&models.GroupActivityDay{}).
+		Select("group_id, SUM(messages) AS messages, COUNT(*) AS active_days, MAX(senders) AS peak_senders").
+		Where("day >= ? AND day <= ?", from, to).
+		Group("group_id").
+		Order("messages DESC, group_id").
+		Limit(limit).
+		Scan(&groups).Error
+	if err != nil || len(groups) == 0 {
+		return groups, err
+	}
+
+	ids := make([]int64, len(groups))
+	for i := range groups {
+		ids[i] = groups[i].GroupID
+	}
+	var rows []models.Group
+	if err := s.db.WithContext(ctx).Unscoped().Select("id, name, deleted_at").Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*models.Group, len(rows))
+	for i := range rows {
+		byID[rows[i].ID] = &rows[i]
+	}
+	for i := range groups {
+		if group, ok := byID[groups[i].GroupID]; ok {
+			groups[i].Name = group.Name
+			groups[i].Dissolved = group.DeletedAt.Valid
+		} else {
+			groups[i].Dissolved = true
+		}
+	}
+	return groups, nil
+}
+
+// RetentionPoint 注册后第Day天仍活跃的用户数和比例
+type RetentionPoint struct {
+	Day   int     `json:"day"`
+	Users int64   `json:"users"`
+	Rate  float64 `json:"rate"`
+}
+
+// RetentionCohort 同一天（UTC）注册的用户的留存，尚未到达的天数点不返回
+type RetentionCohort struct {
+	Date      string           `json:"date"`
+	Users     int64            `json:"users"`
+	Retention []RetentionPoint `json:"retention"`
+}
+
+// Retention 查询from到to（UTC日期，含两端）每天注册的用户在第N天（offsets）的留存，包括之后注销的用户
+func (s *AnalyticsService) Retention(ctx context.Context, from, to time.Time, offsets []int) ([]RetentionCohort, error) {
+	from, to, err := s.checkRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(offsets) == 0 || len(offsets) > maxRetentionOffsets {
+		return nil, ErrInvalidRetentionDays
+	}
+	offsets = append([]int(nil), offsets...)
+	sort.Ints(offsets)
+	for _, offset := range offsets {
+		if offset < 1 || offset > maxRetentionOffset {
+			return nil, ErrInvalidRetentionDays
+		}
+	}
+
+	today := truncateDay(s.now())
+	db := s.db.WithContext(ctx)
+	cohorts := make([]RetentionCohort, 0, int(to.Sub(from)/(24*time.Hour))+1)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+		cohort := RetentionCohort{Date: day.Format(time.DateOnly), Retention: []RetentionPoint{}}
+		err := db.Unscoped().Model(&models.User{}).
+			Where("created_at >= ? AND created_at < ?", day, end).
+			Count(&cohort.Users).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, offset := range offsets {
+			target := day.AddDate(0, 0, offset)
+			if target.After(today) {
+				break
+			}
+			point := RetentionPoint{Day: offset}
+			if cohort.Users > 0 {
+				err := db.Table(models.UserActivityDay{}.TableName()+" a").
+					Joins("JOIN "+models.User{}.TableName()+" u ON u.id = a.user_id").
+					Where("a.day = ? AND u.created_at >= ? AND u.created_at < ?", target, day, end).
+					Count(&point.Users).Error
+				if err != nil {
+					return nil, err
+				}
+				point.Rate = float64(point.Users) / float64(cohort.Users)
+			}
+			cohort.Retention = append(cohort.Retention, point)
+		}
+		cohorts = append(cohorts, cohort)
+	}
+	return cohorts, nil
+}
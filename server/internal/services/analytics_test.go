@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+func newTestAnalytics(t *testing.T) (*AnalyticsService, *redis.Client, *time.Time) {
+	t.Helper()
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	cfg := &config.Config{
+		Analytics: config.AnalyticsConfig{Enabled: true, Lookback: "2h", BackfillDays: 3},
+		Admin:     config.AdminConfig{Stats: config.AdminStatsConfig{MaxDays: 31}},
+	}
+	s := NewAnalyticsServiceWithClient(client, db, cfg)
+	current := time.Date(2026, 10, 2, 12, 30, 0, 0, time.UTC)
+	s.now = func() time.Time { return current }
+	return s, client, &current
+}
+
+func createTestMessage(t *testing.T, s *AnalyticsService, message *models.Message, at time.Time) {
+	t.Helper()
+	message.CreatedAt = at
+	if message.MsgType == 0 {
+		message.MsgType = models.MessageTypeText
+	}
+	require.NoError(t, s.db.Create(message).Error)
+}
+
+func TestAnalyticsRollupAndMessageStats(t *testing.T) {
+	s, _, now := newTestAnalytics(t)
+	ctx := context.Background()
+	alice := createTestUser(t, s.db, "13800000001", "alice")
+	bob := createTestUser(t, s.db, "13800000002", "bob")
+	group := &models.Group{Name: "team", OwnerID: alice.ID, MemberCount: 2}
+	require.NoError(t, s.db.Create(group).Error)
+
+	day1 := time.Date(2026, 10, 1, 9, 15, 0, 0, time.UTC)
+	day2 := time.Date(2026, 10, 2, 11, 5, 0, 0, time.UTC)
+	createTestMessage(t, s, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "a"}, day1)
+	createTestMessage(t, s, &models.Message{FromUserID: bob.ID, ToUserID: &alice.ID, Content: "b", MsgType: models.MessageTypeImage}, day1.Add(10*time.Minute))
+	createTestMessage(t, s, &models.Message{FromUserID: alice.ID, GroupID: &group.ID, Content: "c"}, day2)
+	deleted := &models.Message{FromUserID: bob.ID, GroupID: &group.ID, Content: "d"}
+	createTestMessage(t, s, deleted, day2.Add(time.Minute))
+	require.NoError(t, s.db.Delete(deleted).Error)
+	require.NoError(t, s.db.Create(&models.ArchivedMessage{ID: 1000, FromUserID: alice.ID, GroupID: &group.ID, Content: "old", MsgType: models.MessageTypeText, CreatedAt: day1, ArchivedAt: day2}).Error)
+
+	require.NoError(t, s.Rollup(ctx))
+
+	stats, err := s.MessageStats(ctx, day1, day2, false)
+	require.NoError(t, err)
+	require.Len(t, stats.Buckets, 2)
+	assert.Equal(t, MessageStatsBucket{Time: "2026-10-01", Total: 3, Private: 2, Group: 1, ByType: map[string]int64{"text": 2, "image": 1}}, stats.Buckets[0])
+	assert.Equal(t, MessageStatsBucket{Time: "2026-10-02", Total: 2, Group: 2, ByType: map[string]int64{"text": 2}}, stats.Buckets[1])
+	assert.Equal(t, int64(5), stats.Summary.Total)
+
+	hourly, err := s.MessageStats(ctx, day2, day2, true)
+	require.NoError(t, err)
+	require.Len(t, hourly.Buckets, 24)
+	assert.Equal(t, "2026-10-02T11:00:00Z", hourly.Buckets[11].Time)
+	assert.Equal(t, int64(2), hourly.Buckets[11].Total)
+	assert.Zero(t, hourly.Buckets[10].Total)
+
+	// 重复汇总结果不变，新消息计入当前整点
+	createTestMessage(t, s, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "e"}, now.Add(-time.Minute))
+	require.NoError(t, s.Rollup(ctx))
+	stats, err = s.MessageStats(ctx, day1, day2, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Buckets[1].Total)
+	assert.Equal(t, int64(6), stats.Summary.Total)
+
+	leaderboard, err := s.GroupLeaderboard(ctx, day1, day2, 10)
+	require.NoError(t, err)
+	require.Len(t, leaderboard, 1)
+	assert.Equal(t, GroupActivity{GroupID: group.ID, Name: "team", Messages: 3, ActiveDays: 2, PeakSenders: 2}, leaderboard[0])
+}
+
+func TestAnalyticsActiveUsersAndRetention(t *testing.T) {
+	s, client, _ := newTestAnalytics(t)
+	ctx := context.Background()
+	day1 := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	day2 := time.Date(2026, 10, 2, 8, 0, 0, 0, time.UTC)
+
+	alice := createTestUser(t, s.db, "13800000001", "alice")
+	bob := createTestUser(t, s.db, "13800000002", "bob")
+	carol := createTestUser(t, s.db, "13800000003", "carol")
+	for _, user := range []*models.User{alice, bob} {
+		require.NoError(t, s.db.Model(user).Update("created_at", day1).Error)
+	}
+	require.NoError(t, s.db.Model(carol).Update("created_at", day2).Error)
+
+	// alice第二天发了消息，carol第二天被记录为活跃（尚未持久化）
+	createTestMessage(t, s, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hi"}, day2)
+	tracker := NewActiveUserTracker(client)
+	tracker.now = func() time.Time { return day2 }
+	tracker.Record(ctx, carol.ID, alice.ID)
+	createTestMessage(t, s, &models.Message{FromUserID: bob.ID, ToUserID: &alice.ID, Content: "hi"}, day1)
+
+	require.NoError(t, s.Rollup(ctx))
+	assert.Zero(t, client.SCard(ctx, "stats:active_ids:20261002").Val())
+
+	active, err := s.ActiveUsers(ctx, day1, day2)
+	require.NoError(t, err)
+	assert.Equal(t, []ActiveUserDay{{Date: "2026-10-01", ActiveUsers: 1}, {Date: "2026-10-02", ActiveUsers: 2}}, active.Days)
+	assert.Equal(t, int64(3), active.ActiveUsers)
+
+	cohorts, err := s.Retention(ctx, day1, day2, []int{7, 1})
+	require.NoError(t, err)
+	require.Len(t, cohorts, 2)
+	// 第7天尚未到达，不返回
+	assert.Equal(t, RetentionCohort{Date: "2026-10-01", Users: 2, Retention: []RetentionPoint{{Day: 1, Users: 1, Rate: 0.5}}}, cohorts[0])
+	assert.Equal(t, RetentionCohort{Date: "2026-10-02", Users: 1, Retention: []RetentionPoint{}}, cohorts[1])
+
+	_, err = s.Retention(ctx, day1, day2, []int{0})
+	assert.ErrorIs(t, err, ErrInvalidRetentionDays)
+	_, err = s.ActiveUsers(ctx, day2, day1)
+	assert.ErrorIs(t, err, ErrInvalidStatsRange)
+}
+
+func TestAnalyticsRollupResumesFromWatermark(t *testing.T) {
+	s, client, now := newTestAnalytics(t)
+	ctx := context.Background()
+	alice := createTestUser(t, s.db, "13800000001", "alice")
+	bob := createTestUser(t, s.db, "13800000002", "bob")
+
+	require.NoError(t, s.Rollup(ctx))
+	watermark, err := client.Get(ctx, analyticsWatermarkKey).Int64()
+	require.NoError(t, err)
+	assert.Equal(t, now.Truncate(time.Hour).Unix(), watermark)
+
+	// 停机5小时期间的消息在恢复后补算（超出lookback）
+	createTestMessage(t, s, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "a"}, now.Add(time.Hour))
+	*now = now.Add(5 * time.Hour)
+	require.NoError(t, s.Rollup(ctx))
+	stats, err := s.MessageStats(ctx, *now, *now, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Summary.Total)
+}
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/models"
+)
+
+// 公告受众
+const (
+	AnnouncementAudienceAll     = "all"     // 所有用户
+	AnnouncementAudienceSegment = "segment" // 满足定向条件的用户
+)
+
+// 公告状态
+const (
+	AnnouncementScheduled = "scheduled" // 等待到达发布时间
+	AnnouncementPublished = "published" // 已发布
+	AnnouncementCancelled = "cancelled" // 已取消，已发布的公告取消后从客户端撤回
+)
+
+const (
+	// announcementUserLimit 用户拉取公告时最多返回的条数
+	announcementUserLimit = 50
+	// announcementCandidateLimit 用户拉取公告时最多检查的公告数，定向不匹配的公告会被过滤
+	announcementCandidateLimit = 200
+	// announcementBatchSize 写入定向用户和筛选推送对象时每批的用户数
+	announcementBatchSize = 500
+	// announcementPublishBatch 每次最多发布的到期定时公告数
+	announcementPublishBatch = 100
+)
+
+var (
+	ErrAnnouncementNotFound    = errors.New("announcement not found")
+	ErrAnnouncementCancelled   = errors.New("announcement already cancelled")
+	ErrInvalidAudience         = errors.New("audience must be all or segment")
+	ErrInvalidSegment          = errors.New("segment requires user_ids, group_id, registered_after or registered_before, and registered_after must be before registered_before")
+	ErrTooManyTargets          = errors.New("too many target users")
+	ErrInvalidAnnouncementTime = errors.New("expires_at must be after publish_at and in the future")
+)
+
+// AnnouncementSegment 公告的定向条件，多个条件同时满足才推送
+type AnnouncementSegment struct {
+	UserIDs          []int64    `json:"user_ids"`
+	GroupID          int64      `json:"group_id"`
+	RegisteredAfter  *time.Time `json:"registered_after"`
+	RegisteredBefore *time.Time `json:"registered_before"`
+}
+
+// AnnouncementRequest 发布公告的请求，publish_at为空或早于当前时间时立即发布
+type AnnouncementRequest struct {
+	Title     string               `json:"title" binding:"required,max=100"`
+	Content   string               `json:"content" binding:"required,max=5000"`
+	Audience  string               `json:"audience"` // all/segment，默认all
+	Segment   *AnnouncementSegment `json:"segment"`
+	PublishAt *time.Time           `json:"publish_at"`
+	ExpiresAt *time.Time           `json:"expires_at"`
+}
+
+// AnnouncementQuery 管理后台公告列表的查询条件
+type AnnouncementQuery struct {
+	Status   string
+	BeforeID int64 // 游标，返回ID小于该值的公告
+	Limit    int
+}
+
+// AnnouncementAdminInfo 管理后台看到的公告，包含已读人数
+type AnnouncementAdminInfo struct {
+	models.Announcement
+	ReadCount int64 `json:"read_count"`
+}
+
+// AnnouncementInfo 用户看到的公告
+type AnnouncementInfo struct {
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	PublishedAt *time.Time `json:"published_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Read        bool       `json:"read"`
+}
+
+type AnnouncementService struct {
+	db             *gorm.DB
+	maxTargetUsers int
+	now            func() time.Time
+}
+
+func NewAnnouncementService(cfg *config.AnnouncementsConfig) *AnnouncementService {
+	return NewAnnouncementServiceWithDB(database.GetDB(), cfg)
+}
+
+// NewAnnouncementServiceWithDB 创建公告服务（支持依赖注入）
+func NewAnnouncementServiceWithDB(db *gorm.DB, cfg *config.AnnouncementsConfig) *AnnouncementService {
+	return &AnnouncementService{db: db, maxTargetUsers: cfg.MaxTargetUsers, now: time.Now}
+}
+
+// Create 创建公告；立即发布的公告通知所有实例推送给在线的目标用户，定时公告由后台任务到期后发布
+func (s *AnnouncementService) Create(ctx context.Context, actorID int64, req *AnnouncementRequest) (*models.Announcement, error) {
+	now := s.now()
+	announcement := &models.Announcement{
+		Title:     req.Title,
+		Content:   req.Content,
+		Audience:  req.Audience,
+		Status:    AnnouncementScheduled,
+		PublishAt: now,
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: actorID,
+	}
+	if announcement.Audience == "" {
+		announcement.Audience = AnnouncementAudienceAll
+	}
+	if req.PublishAt != nil && req.PublishAt.After(now) {
+		announcement.PublishAt = *req.PublishAt
+	} else {
+		announcement.Status = AnnouncementPublished
+		announcement.PublishedAt = &now
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(announcement.PublishAt) {
+		return nil, ErrInvalidAnnouncementTime
+	}
+
+	var userIDs []int64
+	switch announcement.Audience {
+	case AnnouncementAudienceAll:
+	case AnnouncementAudienceSegment:
+		segment := req.Segment
+		if segment == nil {
+			return nil, ErrInvalidSegment
+		}
+		userIDs = uniqueIDs(segment.UserIDs)
+		if len(userIDs) == 0 && segment.GroupID == 0 && segment.RegisteredAfter == nil && segment.RegisteredBefore == nil {
+			return nil, ErrInvalidSegment
+		}
+		if segment.RegisteredAfter != nil && segment.RegisteredBefore != nil && !segment.RegisteredAfter.Before(*segment.RegisteredBefore) {
+			return nil, ErrInvalidSegment
+		}
+		if len(userIDs) > s.maxTargetUsers {
+			return nil, ErrTooManyTargets
+		}
+		if segment.GroupID > 0 {
+			if _, err := NewGroupServiceWithDB(s.db).GetGroup(ctx, segment.GroupID); err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, ErrGroupNotFound
+				}
+				return nil, err
+			}
+		}
+		announcement.TargetUsers = len(userIDs)
+		announcement.TargetGroupID = segment.GroupID
+		announcement.RegisteredAfter = segment.RegisteredAfter
+		announcement.RegisteredBefore = segment.RegisteredBefore
+	default:
+		return nil, ErrInvalidAudience
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(announcement).Error; err != nil {
+			return err
+		}
+		if len(userIDs) == 0 {
+			return nil
+		}
+		targets := make([]models.AnnouncementTarget, len(userIDs))
+		for i, userID := range userIDs {
+			targets[i] = models.AnnouncementTarget{AnnouncementID: announcement.ID, UserID: userID}
+		}
+		return tx.CreateInBatches(targets, announcementBatchSize).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if announcement.Status == AnnouncementPublished {
+		cache.PublishInvalidation(cache.ScopeAnnouncement, announcement.ID)
+	}
+	return announcement, nil
+}
+
+// uniqueIDs 去掉重复和无效的ID，保持原有顺序
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// Get 获取公告，从主库读取，避免刚发布的公告因复制延迟查不到
+func (s *AnnouncementService) Get(ctx context.Context, id int64) (*models.Announcement, error) {
+	var announcement models.Announcement
+	err := database.Primary(s.db).WithContext(ctx).First(&announcement, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAnnouncementNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &announcement, nil
+}
+
+// List 查询公告，按ID倒序分页，返回是否还有下一页
+func (s *AnnouncementService) List(ctx context.Context, q AnnouncementQuery) ([]AnnouncementAdminInfo, bool, error) {
+	if q.Limit <= 0 || q.Limit > 200 {
+		q.Limit = 50
+	}
+	query := s.db.WithContext(ctx).Model(&models.Announcement{})
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.BeforeID > 0 {
+		query = query.Where("id < ?", q.BeforeID)
+	}
+	var announcements []models.Announcement
+	if err := query.Order("id DESC").Limit(q.Limit + 1).Find(&announcements).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(announcements) > q.Limit
+	if hasMore {
+		announcements = announcements[:q.Limit]
+	}
+
+	ids := make([]int64, len(announcements))
+	for i := range announcements {
+		ids[i] = announcements[i].ID
+	}
+	var counts []struct {
+		AnnouncementID int64
+		Count          int64
+	}
+	if len(ids) > 0 {
+		err := s.db.WithContext(ctx).Model(&models.AnnouncementRead{}).
+			Select("announcement_id, COUNT(*) AS count").
+			Where("announcement_id IN ?", ids).
+			Group("announcement_id").
+			Scan(&counts).Error
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	readCounts := make(map[int64]int64, len(counts))
+	for _, c := range counts {
+		readCounts[c.AnnouncementID] = c.Count
+	}
+
+	result := make([]AnnouncementAdminInfo, len(announcements))
+	for i, announcement := range announcements {
+		result[i] = AnnouncementAdminInfo{Announcement: announcement, ReadCount: readCounts[announcement.ID]}
+	}
+	return result, hasMore, nil
+}
+
+// Cancel 取消公告；定时公告不再发布，已发布的公告通知所有实例从在线用户的客户端撤回
+func (s *AnnouncementService) Cancel(ctx context.Context, id int64) (*models.Announcement, error) {
+	now := s.now()
+	result := database.Primary(s.db).WithContext(ctx).Model(&models.Announcement{}).
+		Where("id = ? AND status <> ?", id, AnnouncementCancelled).
+		Updates(map[string]interface{}{"status": AnnouncementCancelled, "cancelled_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	announcement, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAnnouncementCancelled
+	}
+	if announcement.PublishedAt != nil {
+		cache.PublishInvalidation(cache.ScopeAnnouncement, announcement.ID)
+	}
+	return announcement, nil
+}
+
+// PublishDue 发布到达发布时间的定时公告，返回发布的条数
+// 多实例同时执行时通过条件更新领取，每条公告只会被一个实例发布
+func (s *AnnouncementService) PublishDue(ctx context.Context) (int, error) {
+	now := s.now()
+	db := database.Primary(s.db).WithContext(ctx)
+
+	var ids []int64
+	err := db.Model(&models.Announcement{}).
+		Where("status = ? AND publish_at <= ?", AnnouncementScheduled, now).
+		Order("publish_at").
+		Limit(announcementPublishBatch).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return published, err
+		}
+		result := db.Model(&models.Announcement{}).
+			Where("id = ? AND status = ?", id, AnnouncementScheduled).
+			Updates(map[string]interface{}{"status": AnnouncementPublished, "published_at": now})
+		if result.Error != nil {
+			return published, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		cache.PublishInvalidation(cache.ScopeAnnouncement, id)
+		published++
+	}
+	return published, nil
+}
+
+// Active 公告是否已发布且未过期
+func (s *AnnouncementService) Active(announcement *models.Announcement) bool {
+	return announcement.Status == AnnouncementPublished &&
+		(announcement.ExpiresAt == nil || announcement.ExpiresAt.After(s.now()))
+}
+
+// Recipients 从给定的用户中筛选出公告的目标用户，用于推送给本实例上在线的用户
+func (s *AnnouncementService) Recipients(ctx context.Context, announcement *models.Announcement, userIDs []int64) ([]int64, error) {
+	if announcement.Audience == AnnouncementAudienceAll {
+		return userIDs, nil
+	}
+	recipients := make([]int64, 0)
+	for start := 0; start < len(userIDs); start += announcementBatchSize {
+		end := start + announcementBatchSize
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		query := s.db.WithContext(ctx).Model(&models.User{}).Where("users.id IN ?", userIDs[start:end])
+		if announcement.TargetUsers > 0 {
+			query = query.Where("EXISTS (SELECT 1 FROM announcement_targets t WHERE t.announcement_id = ? AND t.user_id = users.id)", announcement.ID)
+		}
+		if announcement.TargetGroupID > 0 {
+			query = query.Where("EXISTS (SELECT 1 FROM group_members m WHERE m.group_id = ? AND m.user_id = users.id)", announcement.TargetGroupID)
+		}
+		if announcement.RegisteredAfter != nil {
+			query = query.Where("users.created_at >= ?", *announcement.RegisteredAfter)
+		}
+		if announcement.RegisteredBefore != nil {
+			query = query.Where("users.created_at < ?", *announcement.RegisteredBefore)
+		}
+		var ids []int64
+		if err := query.Pluck("users.id", &ids).Error; err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, ids...)
+	}
+	return recipients, nil
+}
+
+// Info 转换为用户看到的公告
+func (s *AnnouncementService) Info(announcement *models.Announcement, read bool) AnnouncementInfo {
+	return AnnouncementInfo{
+		ID:          announcement.ID,
+		Title:       announcement.Title,
+		Content:     announcement.Content,
+		PublishedAt: announcement.PublishedAt,
+		ExpiresAt:   announcement.ExpiresAt,
+		Read:        read,
+	}
+}
+
+// ListForUser 获取用户可见的有效公告，按发布时间倒序，最多返回50条；unreadOnly为true时只返回未读公告
+// 离线期间发布的公告由客户端上线后通过此接口拉取
+func (s *AnnouncementService) ListForUser(ctx context.Context, userID int64, unreadOnly bool) ([]AnnouncementInfo, error) {
+	var candidates []models.Announcement
+	err := s.db.WithContext(ctx).
+		Where("status = ? AND (expires_at IS NULL OR expires_at > ?)", AnnouncementPublished, s.now()).
+		Order("published_at DESC, id DESC").
+		Limit(announcementCandidateLimit).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]models.Announcement, 0, len(candidates))
+	ids := make([]int64, 0, len(candidates))
+	for _, announcement := range candidates {
+		ok, err := s.visibleTo(ctx, &announcement, userID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			visible = append(visible, announcement)
+			ids = append(ids, announcement.ID)
+		}
+	}
+
+	var readIDs []int64
+	if len(ids) > 0 {
+		err := s.db.WithContext(ctx).Model(&models.AnnouncementRead{}).
+			Where("user_id = ? AND announcement_id IN ?", userID, ids).
+			Pluck("announcement_id", &readIDs).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	read := make(map[int64]bool, len(readIDs))
+	for _, id := range readIDs {
+		read[id] = true
+	}
+
+	result := make([]AnnouncementInfo, 0, len(visible))
+	for i := range visible {
+		if unreadOnly && read[visible[i].ID] {
+			continue
+		}
+		result = append(result, s.Info(&visible[i], read[visible[i].ID]))
+		if len(result) == announcementUserLimit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// MarkRead 标记公告为已读，重复标记不报错；用户看不到的公告返回ErrAnnouncementNotFound
+func (s *AnnouncementService) MarkRead(ctx context.Context, userID, id int64) error {
+	announcement, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !s.Active(announcement) {
+		return ErrAnnouncementNotFound
+	}
+	visible, err := s.visibleTo(ctx, announcement, userID)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return ErrAnnouncementNotFound
+	}
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.AnnouncementRead{AnnouncementID: id, UserID: userID, ReadAt: s.now()}).Error
+}
+
+// visibleTo 用户是否是公告的目标用户
+func (s *AnnouncementService) visibleTo(ctx context.Context, announcement *models.Announcement, userID int64) (bool, error) {
+	recipients, err := s.Recipients(ctx, announcement, []int64{userID})
+	if err != nil {
+		return false, err
+	}
+	return len(recipients) > 0, nil
+}
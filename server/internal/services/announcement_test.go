@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+// announcementEvents 记录公告发布和撤回事件，OnInvalidate注册后无法注销，只注册一次
+var (
+	announcementEventsOnce sync.Once
+	announcementEventsMu   sync.Mutex
+	announcementEvents     []string
+)
+
+func newTestAnnouncementService(t *testing.T, db *gorm.DB) (*AnnouncementService, *time.Time) {
+	t.Helper()
+	announcementEventsOnce.Do(func() {
+		cache.OnInvalidate(cache.ScopeAnnouncement, func(id string) {
+			announcementEventsMu.Lock()
+			defer announcementEventsMu.Unlock()
+			announcementEvents = append(announcementEvents, id)
+		})
+	})
+	announcementEventsMu.Lock()
+	announcementEvents = nil
+	announcementEventsMu.Unlock()
+
+	s := NewAnnouncementServiceWithDB(db, &config.AnnouncementsConfig{Enabled: true, PollInterval: "15s", MaxTargetUsers: 3})
+	current := time.Date(2026, 10, 2, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return current }
+	return s, &current
+}
+
+func takeAnnouncementEvents() []string {
+	announcementEventsMu.Lock()
+	defer announcementEventsMu.Unlock()
+	events := announcementEvents
+	announcementEvents = nil
+	return events
+}
+
+func TestAnnouncementScheduleAndCancel(t *testing.T) {
+	db := newTestDB(t)
+	admin := createTestUser(t, db, "13800000001", "admin")
+	alice := createTestUser(t, db, "13800000002", "alice")
+	s, now := newTestAnnouncementService(t, db)
+	ctx := context.Background()
+
+	// 立即发布的公告马上通知各实例推送
+	immediate, err := s.Create(ctx, admin.ID, &AnnouncementRequest{Title: "hello", Content: "welcome"})
+	require.NoError(t, err)
+	assert.Equal(t, AnnouncementPublished, immediate.Status)
+	assert.Equal(t, AnnouncementAudienceAll, immediate.Audience)
+	assert.Equal(t, []string{strconv.FormatInt(immediate.ID, 10)}, takeAnnouncementEvents())
+
+	publishAt := now.Add(time.Hour)
+	scheduled, err := s.Create(ctx, admin.ID, &AnnouncementRequest{Title: "maintenance", Content: "tonight", PublishAt: &publishAt})
+	require.NoError(t, err)
+	assert.Equal(t, AnnouncementScheduled, scheduled.Status)
+	assert.Empty(t, takeAnnouncementEvents())
+
+	announcements, err := s.ListForUser(ctx, alice.ID, false)
+	require.NoError(t, err)
+	require.Len(t, announcements, 1)
+	assert.Equal(t, immediate.ID, announcements[0].ID)
+
+	// 到达发布时间后只发布一次
+	published, err := s.PublishDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, published)
+	*now = now.Add(time.Hour)
+	published, err = s.PublishDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	published, err = s.PublishDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, published)
+	assert.Equal(t, []string{strconv.FormatInt(scheduled.ID, 10)}, takeAnnouncementEvents())
+
+	// 撤回已发布的公告
+	cancelled, err := s.Cancel(ctx, scheduled.ID)
+	require.NoError(t, err)
+	assert.Equal(t, AnnouncementCancelled, cancelled.Status)
+	assert.Equal(t, []string{strconv.FormatInt(scheduled.ID, 10)}, takeAnnouncementEvents())
+	_, err = s.Cancel(ctx, scheduled.ID)
+	assert.ErrorIs(t, err, ErrAnnouncementCancelled)
+	_, err = s.Cancel(ctx, 999)
+	assert.ErrorIs(t, err, ErrAnnouncementNotFound)
+
+	announcements, err = s.ListForUser(ctx, alice.ID, false)
+	require.NoError(t, err)
+	require.Len(t, announcements, 1)
+	assert.Equal(t, immediate.ID, announcements[0].ID)
+
+	// 过期时间必须晚于发布时间
+	expiresAt := now.Add(-time.Minute)
+	_, err = s.Create(ctx, admin.ID, &AnnouncementRequest{Title: "late", Content: "x", ExpiresAt: &expiresAt})
+	assert.ErrorIs(t, err, ErrInvalidAnnouncementTime)
+}
+
+func TestAnnouncementSegmentTargeting(t *testing.T) {
+	db := newTestDB(t)
+	admin := createTestUser(t, db, "13800000001", "admin")
+	alice := createTestUser(t, db, "13800000002", "alice")
+	bob := createTestUser(t, db, "13800000003", "bob")
+	carol := createTestUser(t, db, "13800000004", "carol")
+	s, now := newTestAnnouncementService(t, db)
+	ctx := context.Background()
+
+	registeredAt := now.Add(-48 * time.Hour)
+	require.NoError(t, db.Model(&models.User{}).Where("id IN ?", []int64{alice.ID, bob.ID}).Update("created_at", registeredAt).Error)
+	require.NoError(t, db.Model(carol).Update("created_at", now.Add(-time.Hour)).Error)
+	group := &models.Group{Name: "team", OwnerID: alice.ID, MemberCount: 2}
+	require.NoError(t, db.Create(group).Error)
+	require.NoError(t, db.Create([]*models.GroupMember{
+		{GroupID: group.ID, UserID: alice.ID},
+		{GroupID: group.ID, UserID: carol.ID},
+	}).Error)
+
+	// 群成员且在一天前注册：只有alice
+	registeredBefore := now.Add(-24 * time.Hour)
+	segment, err := s.Create(ctx, admin.ID, &AnnouncementRequest{
+		Title:    "members",
+		Content:  "x",
+		Audience: AnnouncementAudienceSegment,
+		Segment:  &AnnouncementSegment{GroupID: group.ID, RegisteredBefore: &registeredBefore},
+	})
+	require.NoError(t, err)
+	recipients, err := s.Recipients(ctx, segment, []int64{alice.ID, bob.ID, carol.ID})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{alice.ID}, recipients)
+
+	// 按用户ID定向，重复的ID只算一次
+	direct, err := s.Create(ctx, admin.ID, &AnnouncementRequest{
+		Title:    "direct",
+		Content:  "x",
+		Audience: AnnouncementAudienceSegment,
+		Segment:  &AnnouncementSegment{UserIDs: []int64{bob.ID, carol.ID, bob.ID}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, direct.TargetUsers)
+	recipients, err = s.Recipients(ctx, direct, []int64{alice.ID, bob.ID, carol.ID})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{bob.ID, carol.ID}, recipients)
+
+	announcements, err := s.ListForUser(ctx, bob.ID, false)
+	require.NoError(t, err)
+	require.Len(t, announcements, 1)
+	assert.Equal(t, direct.ID, announcements[0].ID)
+
+	// 看不到的公告不能标记已读
+	assert.ErrorIs(t, s.MarkRead(ctx, bob.ID, segment.ID), ErrAnnouncementNotFound)
+
+	_, err = s.Create(ctx, admin.ID, &AnnouncementRequest{Title: "x", Content: "x", Audience: AnnouncementAudienceSegment})
+	assert.ErrorIs(t, err, ErrInvalidSegment)
+	_, err = s.Create(ctx, admin.ID, &AnnouncementRequest{
+		Title: "x", Content: "x", Audience: AnnouncementAudienceSegment,
+		Segment: &AnnouncementSegment{UserIDs: []int64{1, 2, 3, 4}},
+	})
+	assert.ErrorIs(t, err, ErrTooManyTargets)
+	_, err = s.Create(ctx, admin.ID, &AnnouncementRequest{
+		Title: "x", Content: "x", Audience: AnnouncementAudienceSegment,
+		Segment: &AnnouncementSegment{GroupID: 999},
+	})
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+	_, err = s.Create(ctx, admin.ID, &AnnouncementRequest{Title: "x", Content: "x", Audience: "vip"})
+	assert.ErrorIs(t, err, ErrInvalidAudience)
+}
+
+func TestAnnouncementReadTracking(t *testing.T) {
+	db := newTestDB(t)
+	admin := createTestUser(t, db, "13800000001", "admin")
+	alice := createTestUser(t, db, "13800000002", "alice")
+	bob := createTestUser(t, db, "13800000003", "bob")
+	s, now := newTestAnnouncementService(t, db)
+	ctx := context.Background()
+
+	first, err := s.Create(ctx, admin.ID, &AnnouncementRequest{Title: "first", Content: "x"})
+	require.NoError(t, err)
+	*now = now.Add(time.Minute)
+	expiresAt := now.Add(time.Hour)
+	second, err := s.Create(ctx, admin.ID, &AnnouncementRequest{Title: "second", Content: "x", ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	require.NoError(t, s.MarkRead(ctx, alice.ID, first.ID))
+	require.NoError(t, s.MarkRead(ctx, alice.ID, first.ID))
+	require.NoError(t, s.MarkRead(ctx, bob.ID, first.ID))
+
+	announcements, err := s.ListForUser(ctx, alice.ID, false)
+	require.NoError(t, err)
+	require.Len(t, announcements, 2)
+	assert.Equal(t, second.ID, announcements[0].ID)
+	assert.False(t, announcements[0].Read)
+	assert.True(t, announcements[1].Read)
+
+	unread, err := s.ListForUser(ctx, alice.ID, true)
+	require.NoError(t, err)
+	require.Len(t, unread, 1)
+	assert.Equal(t, second.ID, unread[0].ID)
+
+	list, hasMore, err := s.List(ctx, AnnouncementQuery{})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	require.Len(t, list, 2)
+	assert.Equal(t, int64(0), list[0].ReadCount)
+	assert.Equal(t, int64(2), list[1].ReadCount)
+
+	// 过期的公告不再返回
+	*now = now.Add(2 * time.Hour)
+	announcements, err = s.ListForUser(ctx, alice.ID, false)
+	require.NoError(t, err)
+	require.Len(t, announcements, 1)
+	assert.Equal(t, first.ID, announcements[0].ID)
+	assert.ErrorIs(t, s.MarkRead(ctx, alice.ID, second.ID), ErrAnnouncementNotFound)
+}
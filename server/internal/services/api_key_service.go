@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/database"
+	"gochat/internal/models"
+)
+
+// APIKeyPrefix API密钥的固定前缀，便于在日志和代码仓库中识别泄露的密钥
+const APIKeyPrefix = "gck_"
+
+// API密钥授权范围
+const (
+	ScopeMessagesRead      = "messages:read"      // 历史消息、消息搜索
+	ScopeMessagesDelete    = "messages:delete"    // 撤回消息
+	ScopeConversationsRead = "conversations:read" // 会话列表
+	ScopeFilesRead         = "files:read"         // 文件列表、下载
+	ScopeFilesWrite        = "files:write"        // 上传文件
+	ScopeGroupsRead        = "groups:read"        // 群信息、群成员
+	ScopeGroupsWrite       = "groups:write"       // 创建群、添加群成员
+	ScopeUsersRead         = "users:read"         // 搜索用户、用户头像
+)
+
+// APIKeyScopes 所有可用的授权范围
+var APIKeyScopes = []string{
+	ScopeMessagesRead, ScopeMessagesDelete, ScopeConversationsRead, ScopeFilesRead,
+	ScopeFilesWrite, ScopeGroupsRead, ScopeGroupsWrite, ScopeUsersRead,
+}
+
+// lastUsedInterval last_used_at的更新间隔，避免每个请求都写数据库
+const lastUsedInterval = time.Minute
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrAPIKeyExpired = errors.New("api key expired")
+)
+
+type APIKeyService struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{db: database.GetDB()}
+}
+
+// NewAPIKeyServiceWithDB 创建API密钥服务（支持依赖注入）
+func NewAPIKeyServiceWithDB(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// CreateAPIKey 为用户创建API密钥，返回只出现这一次的明文密钥；ttl为0表示永不过期
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, name string, userID int64, scopes []string, ttl time.Duration) (string, *models.APIKey, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", nil, errors.New("api key name is required")
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(APIKeyScopes, scope) {
+			return "", nil, fmt.Errorf("unknown scope: %s", scope)
+		}
+	}
+	var user models.User
+	if err := s.db.WithContext(ctx).Select("id").First(&user, userID).Error; err != nil {
+		return "", nil, fmt.Errorf("user %d not found: %w", userID, err)
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	plaintext := APIKeyPrefix + hex.EncodeToString(secret)
+
+	key := &models.APIKey{
+		Name:    strings.TrimSpace(name),
+		KeyHash: hashAPIKey(plaintext),
+		Prefix:  plaintext[:len(APIKeyPrefix)+8],
+		UserID:  userID,
+		Scopes:  strings.Join(scopes, ","),
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		return "", nil, err
+	}
+	return plaintext, key, nil
+}
+
+// Authenticate 校验API密钥，返回未撤销、未过期的密钥记录
+func (s *APIKeyService) Authenticate(ctx context.Context, plaintext string) (*models.APIKey, error) {
+	if !strings.HasPrefix(plaintext, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	var key models.APIKey
+	err := s.db.WithContext(ctx).Where("key_hash = ? AND revoked_at IS NULL", hashAPIKey(plaintext)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	// 密钥绑定的用户被停用或封禁时密钥同样失效，解除后恢复
+	var user models.User
+	err = s.db.WithContext(ctx).Select("id", "banned_at", "suspended_until", "suspend_reason").First(&user, key.UserID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccountStatus(&user, now); err != nil {
+		return nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", key.ID).Update("last_used_at", now)
+		key.LastUsedAt = &now
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey 撤销API密钥，已撤销的密钥立即失效
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id int64) error {
+	result := s.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("api key %d not found or already revoked", id)
+	}
+	return nil
+}
+
+// ListAPIKeys 列出所有API密钥（不含明文和哈希）
+func (s *APIKeyService) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := s.db.WithContext(ctx).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// HasScope 密钥是否拥有授权范围
+func HasScope(key *models.APIKey, scope string) bool {
+	return slices.Contains(strings.Split(key.Scopes, ","), scope)
+}
+
+// hashAPIKey 密钥为高熵随机串，直接使用SHA256即可，无需慢哈希
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
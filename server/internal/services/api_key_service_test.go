@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	bot := createTestUser(t, db, "13800000001", "bot")
+	keyService := NewAPIKeyServiceWithDB(db)
+
+	plaintext, key, err := keyService.CreateAPIKey(context.Background(), "notifier", bot.ID, []string{ScopeMessagesRead, ScopeFilesWrite}, 0)
+	require.NoError(t, err)
+	assert.True(t, len(plaintext) > len(APIKeyPrefix)+32)
+	assert.Equal(t, plaintext[:len(key.Prefix)], key.Prefix)
+
+	// 只保存哈希
+	var stored models.APIKey
+	require.NoError(t, db.First(&stored, key.ID).Error)
+	assert.NotContains(t, stored.KeyHash, plaintext[len(APIKeyPrefix):])
+
+	authenticated, err := keyService.Authenticate(context.Background(), plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, bot.ID, authenticated.UserID)
+	assert.True(t, HasScope(authenticated, ScopeFilesWrite))
+	assert.False(t, HasScope(authenticated, ScopeGroupsWrite))
+	require.NotNil(t, authenticated.LastUsedAt)
+
+	_, err = keyService.Authenticate(context.Background(), plaintext+"x")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	require.NoError(t, keyService.RevokeAPIKey(context.Background(), key.ID))
+	_, err = keyService.Authenticate(context.Background(), plaintext)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	assert.Error(t, keyService.RevokeAPIKey(context.Background(), key.ID))
+}
+
+func TestAPIKeyValidationAndExpiry(t *testing.T) {
+	db := newTestDB(t)
+	bot := createTestUser(t, db, "13800000001", "bot")
+	keyService := NewAPIKeyServiceWithDB(db)
+
+	_, _, err := keyService.CreateAPIKey(context.Background(), "bad", bot.ID, []string{"admin:all"}, 0)
+	assert.Error(t, err)
+	_, _, err = keyService.CreateAPIKey(context.Background(), "nobody", bot.ID+100, []string{ScopeMessagesRead}, 0)
+	assert.Error(t, err)
+
+	plaintext, key, err := keyService.CreateAPIKey(context.Background(), "short", bot.ID, []string{ScopeMessagesRead}, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(key).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	_, err = keyService.Authenticate(context.Background(), plaintext)
+	assert.ErrorIs(t, err, ErrAPIKeyExpired)
+}
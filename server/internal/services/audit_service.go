@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+// 审计动作
+const (
+	AuditActionRegister            = "auth.register"
+	AuditActionLogin               = "auth.login"
+	AuditActionLoginFailed         = "auth.login_failed"
+	AuditActionLogout              = "auth.logout"
+	AuditActionAccountLocked       = "auth.account_locked"
+	AuditActionUpdateProfile       = "user.update_profile"
+	AuditActionUpdateAvatar        = "user.update_avatar"
+	AuditActionDataExport          = "user.data_export"
+	AuditActionDownloadExport      = "user.download_export"
+	AuditActionCreateGroup         = "group.create"
+	AuditActionAddMembers          = "group.add_members"
+	AuditActionCreateBot           = "group.create_bot"
+	AuditActionUpdateBot           = "group.update_bot"
+	AuditActionResetBot            = "group.reset_bot_credentials"
+	AuditActionDeleteBot           = "group.delete_bot"
+	AuditActionRemoveFriend        = "friend.remove"
+	AuditActionContentFlagged      = "content.flagged"
+	AuditActionReport              = "content.report"
+	AuditActionBanIP               = "admin.ban_ip"
+	AuditActionUnbanIP             = "admin.unban_ip"
+	AuditActionQueryAuditLogs      = "admin.query_audit_logs"
+	AuditActionSuspendUser         = "admin.suspend_user"
+	AuditActionBanUser             = "admin.ban_user"
+	AuditActionUnbanUser           = "admin.unban_user"
+	AuditActionForceLogout         = "admin.force_logout"
+	AuditActionSetRole             = "admin.set_role"
+	AuditActionDissolveGroup       = "admin.dissolve_group"
+	AuditActionTakedown            = "admin.takedown_message"
+	AuditActionRunJob              = "admin.run_job"
+	AuditActionClaimReport         = "admin.claim_report"
+	AuditActionResolveReport       = "admin.resolve_report"
+	AuditActionPublishAnnouncement = "admin.publish_announcement"
+	AuditActionCancelAnnouncement  = "admin.cancel_announcement"
+	AuditActionCreateStaffUser     = "admin.create_staff_user"
+	AuditActionResetPassword       = "admin.reset_password"
+)
+
+// 审计操作者类型
+const (
+	AuditActorUser      = "user"
+	AuditActorAPIKey    = "api_key"
+	AuditActorAdmin     = "admin"
+	AuditActorAnonymous = "anonymous"
+	AuditActorCLI       = "cli" // 通过gochatctl在服务器上操作
+)
+
+// 审计对象类型
+const (
+	AuditTargetUser         = "user"
+	AuditTargetGroup        = "group"
+	AuditTargetMessage      = "message"
+	AuditTargetIPBan        = "ip_ban"
+	AuditTargetBot          = "bot"
+	AuditTargetJob          = "job"
+	AuditTargetReport       = "report"
+	AuditTargetExport       = "data_export"
+	AuditTargetAnnouncement = "announcement"
+)
+
+// auditPurgeBatchSize 清理过期审计日志时每批删除的行数，避免长时间锁表
+const auditPurgeBatchSize = 1000
+
+// AuditEntry 待记录的审计条目，请求ID从context中获取
+type AuditEntry struct {
+	ActorID    int64
+	ActorType  string
+	Action     string
+	TargetType string
+	TargetID   int64
+	IP         string
+	Detail     map[string]interface{}
+}
+
+// AuditQuery 审计日志查询条件，零值表示不限制；Action以*结尾时按前缀匹配（如auth.*）
+type AuditQuery struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   int64
+	Since      time.Time
+	Until      time.Time
+	BeforeID   int64 // 游标，返回ID小于该值的记录
+	Limit      int
+}
+
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService() *AuditService {
+	return &AuditService{db: database.GetDB()}
+}
+
+// NewAuditServiceWithDB 创建审计服务（支持依赖注入）
+func NewAuditServiceWithDB(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record 写入一条审计日志
+func (s *AuditService) Record(ctx context.Context, entry *AuditEntry) error {
+	log := &models.AuditLog{
+		ActorID:    entry.ActorID,
+		ActorType:  entry.ActorType,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		IP:         entry.IP,
+		RequestID:  logger.RequestIDFrom(ctx),
+	}
+	if log.ActorType == "" {
+		log.ActorType = AuditActorAnonymous
+	}
+	if len(entry.Detail) > 0 {
+		detail, err := json.Marshal(entry.Detail)
+		if err != nil {
+			return err
+		}
+		log.Detail = string(detail)
+	}
+	return s.db.WithContext(ctx).Create(log).Error
+}
+
+// Query 按条件查询审计日志，按ID倒序返回，hasMore表示还有更早的记录
+func (s *AuditService) Query(ctx context.Context, q AuditQuery) ([]models.AuditLog, bool, error) {
+	if q.Limit <= 0 || q.Limit > 200 {
+		q.Limit = 50
+	}
+	query := s.db.WithContext(ctx).Model(&models.AuditLog{})
+	if q.ActorID > 0 {
+		query = query.Where("actor_id = ?", q.ActorID)
+	}
+	if prefix, ok := strings.CutSuffix(q.Action, "*"); ok {
+		query = query.Where("action LIKE ?", prefix+"%")
+	} else if q.Action != "" {
+		query = query.Where("action = ?", q.Action)
+	}
+	if q.TargetType != "" {
+		query = query.Where("target_type = ?", q.TargetType)
+	}
+	if q.TargetID > 0 {
+		query = query.Where("target_id = ?", q.TargetID)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("created_at < ?", q.Until)
+	}
+	if q.BeforeID > 0 {
+		query = query.Where("id < ?", q.BeforeID)
+	}
+
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").Limit(q.Limit + 1).Find(&logs).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(logs) > q.Limit
+	if hasMore {
+		logs = logs[:q.Limit]
+	}
+	return logs, hasMore, nil
+}
+
+// Purge 分批删除早于cutoff的审计日志，返回删除的行数
+func (s *AuditService) Purge(ctx context.Context, cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		var ids []int64
+		err := s.db.WithContext(ctx).Model(&models.AuditLog{}).
+			Where("created_at < ?", cutoff).
+			Order("id").Limit(auditPurgeBatchSize).Pluck("id", &ids).Error
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := s.db.WithContext(ctx).Where("id IN ?", ids).Delete(&models.AuditLog{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if len(ids) < auditPurgeBatchSize {
+			return total, nil
+		}
+	}
+}
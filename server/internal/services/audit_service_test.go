@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+func TestAuditRecordAndQuery(t *testing.T) {
+	db := newTestDB(t)
+	auditService := NewAuditServiceWithDB(db)
+
+	ctx := logger.WithRequestID(context.Background(), "req-1")
+	require.NoError(t, auditService.Record(ctx, &AuditEntry{
+		ActorID: 1, ActorType: AuditActorUser, Action: AuditActionLogin,
+		TargetType: AuditTargetUser, TargetID: 1, IP: "203.0.113.7",
+	}))
+	require.NoError(t, auditService.Record(context.Background(), &AuditEntry{
+		Action: AuditActionLoginFailed, IP: "203.0.113.7",
+		Detail: map[string]interface{}{"phone": "13800000001"},
+	}))
+	require.NoError(t, auditService.Record(context.Background(), &AuditEntry{
+		ActorID: 1, ActorType: AuditActorUser, Action: AuditActionCreateGroup,
+		TargetType: AuditTargetGroup, TargetID: 9,
+	}))
+
+	logs, hasMore, err := auditService.Query(context.Background(), AuditQuery{Action: "auth.*"})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	require.Len(t, logs, 2)
+	assert.Equal(t, AuditActionLoginFailed, logs[0].Action)
+	assert.Equal(t, AuditActorAnonymous, logs[0].ActorType)
+	assert.JSONEq(t, `{"phone":"13800000001"}`, logs[0].Detail)
+	assert.Equal(t, "req-1", logs[1].RequestID)
+
+	logs, _, err = auditService.Query(context.Background(), AuditQuery{TargetType: AuditTargetGroup, TargetID: 9})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, AuditActionCreateGroup, logs[0].Action)
+
+	// 游标分页
+	logs, hasMore, err = auditService.Query(context.Background(), AuditQuery{ActorID: 1, Limit: 1})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	require.Len(t, logs, 1)
+	logs, hasMore, err = auditService.Query(context.Background(), AuditQuery{ActorID: 1, Limit: 1, BeforeID: logs[0].ID})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	assert.Equal(t, AuditActionLogin, logs[0].Action)
+}
+
+func TestAuditPurge(t *testing.T) {
+	db := newTestDB(t)
+	auditService := NewAuditServiceWithDB(db)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, auditService.Record(context.Background(), &AuditEntry{Action: AuditActionLogin}))
+	}
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("id <= ?", 2).
+		Update("created_at", time.Now().Add(-100*24*time.Hour)).Error)
+
+	deleted, err := auditService.Purge(context.Background(), time.Now().Add(-90*24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	var count int64
+	db.Model(&models.AuditLog{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
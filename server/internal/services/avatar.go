@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/models"
+	"gochat/internal/utils"
+)
+
+// ErrAvatarNotOwned 头像不是该用户通过头像上传接口上传的文件
+var ErrAvatarNotOwned = errors.New("avatar must be uploaded via /api/v1/user/upload-avatar")
+
+// AvatarSizes 头像标准尺寸（正方形边长），列表等小图场景按需选用
+var AvatarSizes = []int{64, 128, 256}
+
+// avatarVariantPath 头像尺寸图存储路径：与原图同目录，文件名为"<哈希>_avatar<边长>"
+func avatarVariantPath(storagePath string, size int) string {
+	return thumbnailPath(storagePath, "avatar"+strconv.Itoa(size))
+}
+
+// CropImage 按裁剪区域裁剪图片并按原格式重新编码，坐标以按EXIF方向转正后的图片为准
+// GIF只保留第一帧；标准库无法解码的格式（如WebP）返回错误
+func CropImage(file io.ReadSeeker, rect image.Rectangle) (multipart.File, error) {
+	if rect.Dx() <= 0 || rect.Dy() <= 0 {
+		return nil, errors.New("invalid crop area")
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("image format does not support cropping")
+	}
+	img, err := decodeImageData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	rect = rect.Add(bounds.Min)
+	if !rect.In(bounds) {
+		return nil, errors.New("crop area is outside the image")
+	}
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+
+	var buf bytes.Buffer
+	switch format {
+	case "png":
+		err = png.Encode(&buf, cropped)
+	case "gif":
+		err = gif.Encode(&buf, cropped, nil)
+	default:
+		err = jpeg.Encode(&buf, cropped, &jpeg.Options{Quality: jpeg.DefaultQuality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytesFile{bytes.NewReader(buf.Bytes())}, nil
+}
+
+// GenerateAvatarVariants 为头像生成各标准尺寸的正方形图片（居中裁剪），已存在的不会重复生成
+func (s *FileService) GenerateAvatarVariants(file *models.FileStorage) error {
+	var square image.Image
+	for _, size := range AvatarSizes {
+		path := avatarVariantPath(LocalStoragePath(file), size)
+		if fileExists(path) {
+			continue
+		}
+
+		if square == nil {
+			img, err := decodeImage(LocalStoragePath(file))
+			if errors.Is(err, image.ErrFormat) {
+				// 标准库不支持的格式（如WebP）不生成，访问时使用原图
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			square = centerSquare(img)
+		}
+		if err := writeThumbnail(path, utils.ResizeToFit(square, size)); err != nil {
+			return fmt.Errorf("failed to write %dpx avatar: %w", size, err)
+		}
+	}
+	return nil
+}
+
+// centerSquare 居中裁剪出最大的正方形区域
+func centerSquare(img image.Image) image.Image {
+	bounds := img.Bounds()
+	edge := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-edge)/2
+	y := bounds.Min.Y + (bounds.Dy()-edge)/2
+
+	square := image.NewRGBA(image.Rect(0, 0, edge, edge))
+	draw.Draw(square, square.Bounds(), img, image.Pt(x, y), draw.Src)
+	return square
+}
+
+// removeAvatarVariants 删除头像的所有尺寸图
+func removeAvatarVariants(storagePath string) {
+	for _, size := range AvatarSizes {
+		os.Remove(avatarVariantPath(storagePath, size))
+	}
+}
+
+// AvatarPath 返回不小于指定边长的最小头像尺寸图路径（超过最大尺寸时使用最大尺寸），size为0或尺寸图不存在时返回原图
+// avatarURL不是本服务存储的文件（如默认头像）时返回false
+func AvatarPath(avatarURL string, size int) (string, bool) {
+	if _, ok := storedFileHash(avatarURL); !ok {
+		return "", false
+	}
+	storagePath := strings.TrimPrefix(avatarURL, "/")
+	if size <= 0 {
+		return storagePath, true
+	}
+
+	variant := AvatarSizes[len(AvatarSizes)-1]
+	for _, s := range AvatarSizes {
+		if s >= size {
+			variant = s
+			break
+		}
+	}
+	if path := avatarVariantPath(storagePath, variant); fileExists(path) {
+		return path, true
+	}
+	return storagePath, true
+}
+
+// OwnsAvatar 用户是否通过头像上传接口上传过该文件，只有这样的文件才作为头像对所有登录用户公开
+// avatarURL不是本服务存储的文件时返回false
+func (s *FileService) OwnsAvatar(ctx context.Context, userID int64, avatarURL string) (bool, error) {
+	return ownsAvatar(s.db.WithContext(ctx), userID, avatarURL)
+}
+
+func ownsAvatar(db *gorm.DB, userID int64, avatarURL string) (bool, error) {
+	hash, ok := storedFileHash(avatarURL)
+	if !ok {
+		return false, nil
+	}
+	var count int64
+	err := db.Table(models.FileReference{}.TableName()+" r").
+		Joins("JOIN "+models.FileStorage{}.TableName()+" f ON f.id = r.file_id").
+		Where("f.hash = ? AND r.user_id = ? AND r.ref_type = ? AND r.deleted_at IS NULL", hash, userID, "avatar").
+		Count(&count).Error
+	return count > 0, err
+}
+
+// AvatarURLs 返回头像各标准尺寸的访问URL，尺寸图不存在时使用原图URL
+// avatarURL不是本服务存储的文件时返回nil
+func AvatarURLs(avatarURL string) map[string]string {
+	if _, ok := storedFileHash(avatarURL); !ok {
+		return nil
+	}
+	storagePath := strings.TrimPrefix(avatarURL, "/")
+	urls := make(map[string]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		urls[strconv.Itoa(size)] = PublicURL("/" + storagePath)
+		if path := avatarVariantPath(storagePath, size); fileExists(path) {
+			urls[strconv.Itoa(size)] = PublicURL("/" + path)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+func TestGenerateAvatarVariants(t *testing.T) {
+	t.Chdir(t.TempDir())
+	storagePath := filepath.Join(FileStorageDir, strings.Repeat("ab", 32)+".png")
+	writeTestPNG(t, storagePath, 300, 200)
+
+	require.NoError(t, (&FileService{}).GenerateAvatarVariants(&models.FileStorage{StoragePath: storagePath}))
+
+	for size, edge := range map[int]int{64: 64, 128: 128, 256: 200} {
+		f, err := os.Open(avatarVariantPath(storagePath, size))
+		require.NoError(t, err)
+		config, _, err := image.DecodeConfig(f)
+		f.Close()
+		require.NoError(t, err)
+		assert.Equal(t, edge, config.Width, "size %d", size)
+		assert.Equal(t, edge, config.Height, "size %d", size)
+	}
+
+	path, ok := AvatarPath("/"+storagePath, 100)
+	assert.True(t, ok)
+	assert.Equal(t, strings.TrimSuffix(storagePath, ".png")+"_avatar128.png", path)
+	path, _ = AvatarPath(storagePath, 1000)
+	assert.Equal(t, strings.TrimSuffix(storagePath, ".png")+"_avatar256.png", path)
+	path, _ = AvatarPath(storagePath, 0)
+	assert.Equal(t, storagePath, path)
+	assert.Equal(t, "/"+strings.TrimSuffix(storagePath, ".png")+"_avatar64.png", AvatarURLs(storagePath)["64"])
+
+	_, ok = AvatarPath("default.png", 64)
+	assert.False(t, ok)
+
+	removeAvatarVariants(storagePath)
+	path, _ = AvatarPath(storagePath, 64)
+	assert.Equal(t, storagePath, path)
+}
+
+func TestCropImage(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestPNG(t, "src.png", 120, 80)
+	data, err := os.ReadFile("src.png")
+	require.NoError(t, err)
+
+	cropped, err := CropImage(bytes.NewReader(data), image.Rect(10, 20, 60, 70))
+	require.NoError(t, err)
+	config, format, err := image.DecodeConfig(cropped)
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, 50, config.Width)
+	assert.Equal(t, 50, config.Height)
+
+	_, err = CropImage(bytes.NewReader(data), image.Rect(100, 0, 150, 50))
+	assert.Error(t, err, "超出图片范围")
+}
+
+func TestUpdateProfileAvatarMustBeOwnAvatar(t *testing.T) {
+	useTestRedis(t)
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	userService := NewUserServiceWithDB(db, &config.Config{})
+	fileService := &FileService{db: db}
+	ctx := context.Background()
+
+	// 聊天附件不能设为头像，否则会通过头像接口对所有登录用户公开
+	attachment := createTestFile(t, db, "a", alice.ID)
+	err := userService.UpdateProfile(ctx, alice.ID, &UpdateProfileRequest{Avatar: "/" + attachment.StoragePath})
+	assert.ErrorIs(t, err, ErrAvatarNotOwned)
+
+	avatar := createTestFile(t, db, "b", alice.ID)
+	require.NoError(t, db.Create(&models.FileReference{FileID: avatar.ID, UserID: alice.ID, RefType: "avatar"}).Error)
+	require.NoError(t, userService.UpdateProfile(ctx, alice.ID, &UpdateProfileRequest{Avatar: "/" + avatar.StoragePath}))
+	err = userService.UpdateProfile(ctx, bob.ID, &UpdateProfileRequest{Avatar: "/" + avatar.StoragePath})
+	assert.ErrorIs(t, err, ErrAvatarNotOwned, "其他用户的头像")
+
+	owned, err := fileService.OwnsAvatar(ctx, alice.ID, "/"+avatar.StoragePath)
+	require.NoError(t, err)
+	assert.True(t, owned)
+	owned, err = fileService.OwnsAvatar(ctx, alice.ID, "/"+attachment.StoragePath)
+	require.NoError(t, err)
+	assert.False(t, owned)
+
+	// 不是本服务存储的文件（如第三方头像地址）不受影响
+	require.NoError(t, userService.UpdateProfile(ctx, bob.ID, &UpdateProfileRequest{Avatar: "https://example.com/a.png"}))
+}
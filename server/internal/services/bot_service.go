@@ -0,0 +1,591 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/models"
+	"gochat/internal/utils"
+	"gochat/internal/webhook"
+)
+
+// BotTokenPrefix Incoming Webhook令牌的固定前缀，便于在日志和代码仓库中识别泄露的令牌
+const BotTokenPrefix = "gcb_"
+
+// EventBotWebhook 群机器人Outgoing Webhook事件：把群消息推送到机器人配置的地址
+const EventBotWebhook = "bot.webhook"
+
+const (
+	// botWebhookMaxResponse 读取Outgoing Webhook响应的最大字节数
+	botWebhookMaxResponse = 64 << 10
+	// botPhonePrefix 机器人账号的占位手机号前缀，不是合法手机号，因此无法登录
+	botPhonePrefix = "bot_"
+)
+
+var (
+	ErrBotNotFound       = errors.New("bot not found")
+	ErrNotGroupOwner     = errors.New("only the group owner can manage bots")
+	ErrBotLimitReached   = errors.New("bot limit reached for this group")
+	ErrInvalidBotToken   = errors.New("invalid bot token")
+	ErrInvalidWebhookURL = errors.New("outgoing_url must be an absolute http or https url")
+	// ErrForbiddenAddress Outgoing Webhook地址解析到内网、回环等不允许访问的地址
+	ErrForbiddenAddress = errors.New("webhook address is not allowed")
+)
+
+var botWebhooks = metrics.NewCounterVec("bot_webhooks_total", "Outgoing Webhook投递次数，result: success、error、dropped", "result")
+
+// botWebhookClient Outgoing Webhook使用的HTTP客户端，未启用群机器人时为nil
+var botWebhookClient *http.Client
+
+// BotWebhookEvent Outgoing Webhook事件负载
+type BotWebhookEvent struct {
+	BotID     int64  `json:"bot_id"`
+	MessageID int64  `json:"message_id"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// BotWebhookPayload 推送到Outgoing Webhook地址的内容
+type BotWebhookPayload struct {
+	Event   string            `json:"event"` // 目前只有message.created
+	BotID   int64             `json:"bot_id"`
+	GroupID int64             `json:"group_id"`
+	Message BotWebhookMessage `json:"message"`
+}
+
+// BotWebhookMessage 推送的群消息
+type BotWebhookMessage struct {
+	ID           int64  `json:"id"`
+	FromUserID   int64  `json:"from_user_id"`
+	FromNickname string `json:"from_nickname"`
+	Content      string `json:"content"`
+	MsgType      int    `json:"msg_type"`
+	CreatedAt    int64  `json:"created_at"` // 毫秒时间戳
+}
+
+// BotMessageRequest 通过Incoming Webhook发送的消息，text兼容Slack格式的通知工具
+type BotMessageRequest struct {
+	Content string `json:"content"`
+	Text    string `json:"text"`
+}
+
+// BotRequest 创建或修改机器人的请求，修改时为nil的字段保持不变
+type BotRequest struct {
+	Name        *string `json:"name"`
+	OutgoingURL *string `json:"outgoing_url"` // 为空字符串时关闭Outgoing Webhook
+}
+
+// BotCredentials 机器人及新生成的凭证，令牌和签名密钥只在生成时返回这一次
+type BotCredentials struct {
+	Bot            *models.Bot `json:"bot"`
+	Token          string      `json:"token,omitempty"`           // Incoming Webhook令牌，地址为 /api/v1/hooks/{token}
+	OutgoingSecret string      `json:"outgoing_secret,omitempty"` // Outgoing Webhook签名密钥
+}
+
+// InitBots 按配置初始化Outgoing Webhook客户端并注册发件箱处理函数
+func InitBots(cfg *config.BotsConfig) {
+	// 未启用时仍注册处理函数，丢弃之前遗留的事件
+	RegisterOutboxHandler(EventBotWebhook, deliverBotWebhook)
+	if !cfg.Enabled {
+		botWebhookClient = nil
+		return
+	}
+	botWebhookClient = newBotWebhookClient(cfg)
+}
+
+// newBotWebhookClient 创建Outgoing Webhook的HTTP客户端：不跟随重定向，
+// 未允许访问内网时在连接前检查解析后的地址（防止DNS重绑定绕过检查）
+func newBotWebhookClient(cfg *config.BotsConfig) *http.Client {
+	timeout, _ := time.ParseDuration(cfg.WebhookTimeout)
+	dialer := &net.Dialer{Timeout: timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicIP 地址是否为公网地址
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() || ip.IsInterfaceLocalMulticast())
+}
+
+type BotService struct {
+	db  *gorm.DB
+	cfg *config.BotsConfig
+}
+
+func NewBotService(cfg *config.BotsConfig) *BotService {
+	return &BotService{db: database.GetDB(), cfg: cfg}
+}
+
+// NewBotServiceWithDB 创建群机器人服务（支持依赖注入）
+func NewBotServiceWithDB(db *gorm.DB, cfg *config.BotsConfig) *BotService {
+	return &BotService{db: db, cfg: cfg}
+}
+
+// requireOwner 校验用户是群主
+func (s *BotService) requireOwner(ctx context.Context, userID, groupID int64) error {
+	var group models.Group
+	err := s.db.WithContext(ctx).Select("id", "owner_id").First(&group, groupID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotGroupOwner
+	}
+	if err != nil {
+		return err
+	}
+	if group.OwnerID != userID {
+		return ErrNotGroupOwner
+	}
+	return nil
+}
+
+// findBot 查找群里的机器人
+func (s *BotService) findBot(ctx context.Context, groupID, botID int64) (*models.Bot, error) {
+	var bot models.Bot
+	err := s.db.WithContext(ctx).Where("id = ? AND group_id = ?", botID, groupID).First(&bot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bot, nil
+}
+
+// validateBotName 校验机器人名称，规则与昵称相同
+func validateBotName(name string) (*FilterResult, error) {
+	if !utils.ValidateNickname(name) {
+		return nil, errors.New("name must be 2-20 characters without control characters or surrounding spaces, and not a reserved name")
+	}
+	return GetContentFilter().CheckNickname(name)
+}
+
+// validateWebhookURL 校验Outgoing Webhook地址，为空表示关闭
+func validateWebhookURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || len(raw) > 500 {
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+// randomSecret 生成带前缀的随机凭证
+func randomSecret(prefix string, size int) (string, error) {
+	secret := make([]byte, size)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(secret), nil
+}
+
+// CreateBot 群主创建机器人：创建机器人账号并加入群，返回Incoming Webhook令牌
+// 设置了outgoing_url时同时生成签名密钥
+func (s *BotService) CreateBot(ctx context.Context, ownerID, groupID int64, req *BotRequest) (*BotCredentials, error) {
+	if req.Name == nil {
+		return nil, errors.New("name is required")
+	}
+	filtered, err := validateBotName(*req.Name)
+	if err != nil {
+		return nil, err
+	}
+	outgoingURL := ""
+	if req.OutgoingURL != nil {
+		outgoingURL = *req.OutgoingURL
+	}
+	if err := validateWebhookURL(outgoingURL); err != nil {
+		return nil, err
+	}
+	if err := s.requireOwner(ctx, ownerID, groupID); err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.Bot{}).Where("group_id = ?", groupID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if int(count) >= s.cfg.MaxPerGroup {
+		return nil, ErrBotLimitReached
+	}
+
+	credentials := &BotCredentials{}
+	if credentials.Token, err = randomSecret(BotTokenPrefix, 24); err != nil {
+		return nil, err
+	}
+	if outgoingURL != "" {
+		if credentials.OutgoingSecret, err = randomSecret("", 24); err != nil {
+			return nil, err
+		}
+	}
+	phone, err := randomSecret(botPhonePrefix, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	bot := &models.Bot{
+		GroupID:        groupID,
+		CreatorID:      ownerID,
+		Name:           filtered.Text,
+		TokenHash:      hashAPIKey(credentials.Token),
+		TokenPrefix:    credentials.Token[:len(BotTokenPrefix)+8],
+		OutgoingURL:    outgoingURL,
+		OutgoingSecret: credentials.OutgoingSecret,
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 机器人账号没有可用的密码，占位手机号也无法通过登录校验
+		user := &models.User{Phone: phone, PasswordHash: "!", Nickname: filtered.Text, IsBot: true}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		bot.UserID = user.ID
+		if err := tx.Create(bot).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.GroupMember{GroupID: groupID, UserID: user.ID, JoinedAt: time.Now()}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Group{}).Where("id = ?", groupID).
+			Update("member_count", gorm.Expr("member_count + 1")).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	NewGroupServiceWithDB(s.db).invalidateGroupMembers(groupID)
+	if filtered.Flagged() {
+		RecordFlagged(ctx, ownerID, "bot_name", AuditTargetUser, bot.UserID, filtered)
+	}
+	credentials.Bot = bot
+	return credentials, nil
+}
+
+// ListBots 群主查看群里的机器人
+func (s *BotService) ListBots(ctx context.Context, ownerID, groupID int64) ([]models.Bot, error) {
+	if err := s.requireOwner(ctx, ownerID, groupID); err != nil {
+		return nil, err
+	}
+	bots := []models.Bot{}
+	err := s.db.WithContext(ctx).Where("group_id = ?", groupID).Order("id").Find(&bots).Error
+	return bots, err
+}
+
+// UpdateBot 修改机器人名称或Outgoing Webhook地址；首次设置地址时生成签名密钥并返回
+func (s *BotService) UpdateBot(ctx context.Context, ownerID, groupID, botID int64, req *BotRequest) (*BotCredentials, error) {
+	if err := s.requireOwner(ctx, ownerID, groupID); err != nil {
+		return nil, err
+	}
+	bot, err := s.findBot(ctx, groupID, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := &BotCredentials{Bot: bot}
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		filtered, err := validateBotName(*req.Name)
+		if err != nil {
+			return nil, err
+		}
+		updates["name"] = filtered.Text
+	}
+	if req.OutgoingURL != nil {
+		if err := validateWebhookURL(*req.OutgoingURL); err != nil {
+			return nil, err
+		}
+		updates["outgoing_url"] = *req.OutgoingURL
+		if *req.OutgoingURL != "" && bot.OutgoingSecret == "" {
+			if credentials.OutgoingSecret, err = randomSecret("", 24); err != nil {
+				return nil, err
+			}
+			updates["outgoing_secret"] = credentials.OutgoingSecret
+		}
+	}
+	if len(updates) == 0 {
+		return credentials, nil
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(bot).Updates(updates).Error; err != nil {
+			return err
+		}
+		if name, ok := updates["name"]; ok {
+			return tx.Model(&models.User{}).Where("id = ?", bot.UserID).Update("nickname", name).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := updates["name"]; ok {
+		invalidateBotUser(bot.UserID)
+		NewGroupServiceWithDB(s.db).invalidateGroupMembers(groupID)
+	}
+	return credentials, nil
+}
+
+// ResetCredentials 重新生成Incoming Webhook令牌和Outgoing Webhook签名密钥，原凭证立即失效
+func (s *BotService) ResetCredentials(ctx context.Context, ownerID, groupID, botID int64) (*BotCredentials, error) {
+	if err := s.requireOwner(ctx, ownerID, groupID); err != nil {
+		return nil, err
+	}
+	bot, err := s.findBot(ctx, groupID, botID)
+	if err != nil {
+		return nil, err
+	}
+	credentials := &BotCredentials{Bot: bot}
+	if credentials.Token, err = randomSecret(BotTokenPrefix, 24); err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{
+		"token_hash":   hashAPIKey(credentials.Token),
+		"token_prefix": credentials.Token[:len(BotTokenPrefix)+8],
+	}
+	if bot.OutgoingURL != "" {
+		if credentials.OutgoingSecret, err = randomSecret("", 24); err != nil {
+			return nil, err
+		}
+		updates["outgoing_secret"] = credentials.OutgoingSecret
+	}
+	if err := s.db.WithContext(ctx).Model(bot).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// DeleteBot 删除机器人：移出群并删除机器人账号，已发送的消息保留
+func (s *BotService) DeleteBot(ctx context.Context, ownerID, groupID, botID int64) error {
+	if err := s.requireOwner(ctx, ownerID, groupID); err != nil {
+		return err
+	}
+	bot, err := s.findBot(ctx, groupID, botID)
+	if err != nil {
+		return err
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(bot).Error; err != nil {
+			return err
+		}
+		result := tx.Where("group_id = ? AND user_id = ?", groupID, bot.UserID).Delete(&models.GroupMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			if err := tx.Model(&models.Group{}).Where("id = ?", groupID).
+				Update("member_count", gorm.Expr("member_count - 1")).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.User{}, bot.UserID).Error
+	})
+	if err != nil {
+		return err
+	}
+	invalidateBotUser(bot.UserID)
+	NewGroupServiceWithDB(s.db).invalidateGroupMembers(groupID)
+	return nil
+}
+
+// invalidateBotUser 机器人改名或删除后删除机器人账号的用户缓存
+func invalidateBotUser(userID int64) {
+	if cache.GetCacheService() != nil {
+		_ = GetUserCacheService().InvalidateUser(userID) // 忽略缓存失效错误
+	}
+}
+
+// Authenticate 按Incoming Webhook令牌查找机器人
+func (s *BotService) Authenticate(ctx context.Context, token string) (*models.Bot, error) {
+	if !strings.HasPrefix(token, BotTokenPrefix) {
+		return nil, ErrInvalidBotToken
+	}
+	var bot models.Bot
+	err := s.db.WithContext(ctx).Where("token_hash = ?", hashAPIKey(token)).First(&bot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidBotToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bot, nil
+}
+
+// PostMessage 以机器人身份向所在的群发送文本消息，经过与普通消息相同的敏感词过滤，返回消息ID
+func (s *BotService) PostMessage(ctx context.Context, bot *models.Bot, content string) (int64, error) {
+	if !utils.ValidateMessageText(content) {
+		return 0, errors.New("content must be 1-5000 characters without control characters")
+	}
+	filtered, err := GetContentFilter().CheckMessage(content, bot.GroupID)
+	if err != nil {
+		return 0, err
+	}
+
+	msg := &models.Message{FromUserID: bot.UserID, GroupID: &bot.GroupID, Content: filtered.Text, MsgType: models.MessageTypeText}
+	saved, err := NewMessageServiceWithDB(s.db).SaveMessageWithEvent(ctx, msg, MessageCreatedEvent{
+		RequestID: logger.RequestIDFrom(ctx),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if filtered.Flagged() {
+		RecordFlagged(ctx, bot.UserID, "message", AuditTargetMessage, saved.MessageID, filtered)
+	}
+	if _, err := NewOutboxServiceWithDB(s.db).Publish(ctx, saved.EventID); err != nil {
+		logger.WithContext(ctx).Warnf("机器人消息 %d 投递失败，等待发件箱中继重试: %v", saved.MessageID, err)
+	}
+	return saved.MessageID, nil
+}
+
+// enqueueBotWebhooks 在保存群消息的事务中为群里配置了Outgoing Webhook的机器人写入推送事件
+// 机器人发送的消息不推送，避免机器人之间相互回复形成循环
+func enqueueBotWebhooks(tx *gorm.DB, msg *models.Message, requestID string) error {
+	if botWebhookClient == nil || msg.GroupID == nil {
+		return nil
+	}
+	var botIDs []int64
+	err := tx.Model(&models.Bot{}).
+		Where("group_id = ? AND outgoing_url <> ''", *msg.GroupID).
+		Where("NOT EXISTS (SELECT 1 FROM bots sender WHERE sender.user_id = ?)", msg.FromUserID).
+		Pluck("id", &botIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, botID := range botIDs {
+		event := BotWebhookEvent{BotID: botID, MessageID: msg.ID, RequestID: requestID}
+		if _, err := enqueueOutboxEvent(tx, EventBotWebhook, botID, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverBotWebhook 发件箱处理函数：把群消息以签名的JSON POST到机器人的Outgoing Webhook地址
+// 非2xx响应或请求失败时返回错误由中继重试，重试时投递ID不变；响应中带content时以机器人身份回复到群里
+func deliverBotWebhook(ctx context.Context, event *models.OutboxEvent) error {
+	var payload BotWebhookEvent
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		logger.GetLogger().Errorf("发件箱事件 %d 负载无效: %v", event.ID, err)
+		return nil
+	}
+	if payload.RequestID != "" && logger.RequestIDFrom(ctx) == "" {
+		ctx = logger.WithRequestID(ctx, payload.RequestID)
+	}
+	client := botWebhookClient
+	if client == nil {
+		botWebhooks.WithLabelValues("dropped").Inc()
+		return nil
+	}
+
+	db := database.Primary(database.GetDB()).WithContext(ctx)
+	var bot models.Bot
+	var msg models.Message
+	err := db.First(&bot, payload.BotID).Error
+	if err == nil {
+		err = db.First(&msg, payload.MessageID).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && bot.OutgoingURL == "") {
+		// 投递前机器人已删除、关闭了Outgoing Webhook或消息已删除
+		botWebhooks.WithLabelValues("dropped").Inc()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var fromUser models.User
+	if err := db.Select("id", "nickname").First(&fromUser, msg.FromUserID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	body, err := json.Marshal(BotWebhookPayload{
+		Event:   EventMessageCreated,
+		BotID:   bot.ID,
+		GroupID: bot.GroupID,
+		Message: BotWebhookMessage{
+			ID:           msg.ID,
+			FromUserID:   msg.FromUserID,
+			FromNickname: fromUser.Nickname,
+			Content:      msg.Content,
+			MsgType:      msg.MsgType,
+			CreatedAt:    msg.CreatedAt.UTC().UnixMilli(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, bot.OutgoingURL, bytes.NewReader(body))
+	if err != nil {
+		botWebhooks.WithLabelValues("dropped").Inc()
+		return nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+	webhook.NewSigner(bot.OutgoingSecret).SignRequest(req, body)
+	// 重试时沿用同一个投递ID，接收方可按ID去重
+	req.Header.Set(webhook.DefaultScheme.IDHeader, "evt_"+strconv.FormatInt(event.ID, 10))
+	resp, err := client.Do(req)
+	if err != nil {
+		botWebhooks.WithLabelValues("error").Inc()
+		return fmt.Errorf("bot %d webhook: %w", bot.ID, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, botWebhookMaxResponse))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		botWebhooks.WithLabelValues("error").Inc()
+		return fmt.Errorf("bot %d webhook returned %s", bot.ID, resp.Status)
+	}
+	botWebhooks.WithLabelValues("success").Inc()
+
+	var reply BotMessageRequest
+	if json.Unmarshal(respBody, &reply) == nil {
+		if content := reply.Message(); content != "" {
+			if _, err := NewBotServiceWithDB(database.GetDB(), nil).PostMessage(ctx, &bot, content); err != nil {
+				logger.WithContext(ctx).Warnf("机器人 %d 回复消息失败: %v", bot.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Message 消息内容，content为空时使用text
+func (r *BotMessageRequest) Message() string {
+	if r.Content != "" {
+		return r.Content
+	}
+	return r.Text
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+	"gochat/internal/webhook"
+)
+
+var registerBotHandler sync.Once
+
+func strPtr(s string) *string { return &s }
+
+// newTestBotService 创建群机器人服务，allowPrivate为true时启用Outgoing Webhook并允许访问本机的测试服务器
+func newTestBotService(t *testing.T, allowPrivate bool) *BotService {
+	t.Helper()
+	cfg := &config.BotsConfig{Enabled: true, MaxPerGroup: 1, WebhookTimeout: "5s", AllowPrivateNetworks: allowPrivate}
+	registerBotHandler.Do(func() { RegisterOutboxHandler(EventBotWebhook, deliverBotWebhook) })
+	if allowPrivate {
+		botWebhookClient = newBotWebhookClient(cfg)
+		t.Cleanup(func() { botWebhookClient = nil })
+	}
+	return NewBotServiceWithDB(newTestDB(t), cfg)
+}
+
+func TestBotLifecycle(t *testing.T) {
+	s := newTestBotService(t, false)
+	ctx := context.Background()
+	alice := createTestUser(t, s.db, "13800000001", "alice")
+	bob := createTestUser(t, s.db, "13800000002", "bob")
+	group, err := NewGroupServiceWithDB(s.db).CreateGroupWithMembers(ctx, alice.ID, "team", []int64{bob.ID})
+	require.NoError(t, err)
+
+	_, err = s.CreateBot(ctx, bob.ID, group.ID, &BotRequest{Name: strPtr("ci")})
+	assert.ErrorIs(t, err, ErrNotGroupOwner)
+	_, err = s.CreateBot(ctx, alice.ID, group.ID, &BotRequest{Name: strPtr("ci"), OutgoingURL: strPtr("ftp://example.com")})
+	assert.ErrorIs(t, err, ErrInvalidWebhookURL)
+
+	created, err := s.CreateBot(ctx, alice.ID, group.ID, &BotRequest{Name: strPtr("ci")})
+	require.NoError(t, err)
+	assert.Regexp(t, "^gcb_[0-9a-f]{48}$", created.Token)
+	assert.Empty(t, created.OutgoingSecret)
+	_, err = s.CreateBot(ctx, alice.ID, group.ID, &BotRequest{Name: strPtr("deploy")})
+	assert.ErrorIs(t, err, ErrBotLimitReached)
+
+	// 机器人是群成员，但不能被搜索或添加为好友
+	members, err := NewGroupServiceWithDB(s.db).GetGroupMembersWithUserInfo(ctx, group.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 3)
+	assert.Equal(t, created.Bot.UserID, members[2].UserID)
+	assert.True(t, members[2].IsBot)
+	found, err := NewFriendServiceWithDB(s.db).SearchUsers(ctx, "ci", alice.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	assert.Error(t, NewFriendServiceWithDB(s.db).AddFriend(ctx, alice.ID, created.Bot.UserID))
+
+	bot, err := s.Authenticate(ctx, created.Token)
+	require.NoError(t, err)
+	messageID, err := s.PostMessage(ctx, bot, "build #42 passed")
+	require.NoError(t, err)
+	var msg models.Message
+	require.NoError(t, s.db.First(&msg, messageID).Error)
+	assert.Equal(t, created.Bot.UserID, msg.FromUserID)
+	assert.Equal(t, group.ID, *msg.GroupID)
+
+	// 重置后原令牌失效
+	reset, err := s.ResetCredentials(ctx, alice.ID, group.ID, bot.ID)
+	require.NoError(t, err)
+	_, err = s.Authenticate(ctx, created.Token)
+	assert.ErrorIs(t, err, ErrInvalidBotToken)
+	_, err = s.Authenticate(ctx, reset.Token)
+	require.NoError(t, err)
+
+	require.NoError(t, s.DeleteBot(ctx, alice.ID, group.ID, bot.ID))
+	_, err = s.Authenticate(ctx, reset.Token)
+	assert.ErrorIs(t, err, ErrInvalidBotToken)
+	var refreshed models.Group
+	require.NoError(t, s.db.First(&refreshed, group.ID).Error)
+	assert.Equal(t, 2, refreshed.MemberCount)
+}
+
+func TestBotOutgoingWebhook(t *testing.T) {
+	s := newTestBotService(t, true)
+	ctx := context.Background()
+	alice := createTestUser(t, s.db, "13800000001", "alice")
+	group, err := NewGroupServiceWithDB(s.db).CreateGroupWithMembers(ctx, alice.ID, "team", []int64{})
+	require.NoError(t, err)
+
+	var secret string
+	var received []BotWebhookPayload
+	var deliveries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := webhook.NewVerifier(webhook.NewMemoryReplayGuard(), secret).VerifyRequest(r)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload BotWebhookPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		received = append(received, payload)
+		deliveries = append(deliveries, r.Header.Get(webhook.DefaultScheme.IDHeader))
+		w.Write([]byte(`{"content":"pong"}`))
+	}))
+	defer server.Close()
+
+	created, err := s.CreateBot(ctx, alice.ID, group.ID, &BotRequest{Name: strPtr("echo"), OutgoingURL: strPtr(server.URL + "/hook")})
+	require.NoError(t, err)
+	secret = created.OutgoingSecret
+	require.NotEmpty(t, secret)
+
+	messageID, err := NewMessageServiceWithDB(s.db).SaveMessage(ctx, &models.Message{FromUserID: alice.ID, GroupID: &group.ID, Content: "ping", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	var event models.OutboxEvent
+	require.NoError(t, s.db.Where("event_type = ?", EventBotWebhook).First(&event).Error)
+	published, err := NewOutboxServiceWithDB(s.db).Publish(ctx, event.ID)
+	require.NoError(t, err)
+	assert.True(t, published)
+
+	require.Len(t, received, 1)
+	assert.Equal(t, EventMessageCreated, received[0].Event)
+	assert.Equal(t, group.ID, received[0].GroupID)
+	assert.Equal(t, messageID, received[0].Message.ID)
+	assert.Equal(t, "alice", received[0].Message.FromNickname)
+	assert.Equal(t, "ping", received[0].Message.Content)
+	assert.Equal(t, "evt_"+strconv.FormatInt(event.ID, 10), deliveries[0])
+
+	// 回复以机器人身份发到群里，机器人的消息不再推送给机器人
+	var reply models.Message
+	require.NoError(t, s.db.Where("from_user_id = ?", created.Bot.UserID).First(&reply).Error)
+	assert.Equal(t, "pong", reply.Content)
+	var pending int64
+	require.NoError(t, s.db.Model(&models.OutboxEvent{}).Where("event_type = ?", EventBotWebhook).Count(&pending).Error)
+	assert.Equal(t, int64(1), pending)
+}
+
+func TestBotWebhookClientRejectsPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request to loopback address should not be sent")
+	}))
+	defer server.Close()
+
+	client := newBotWebhookClient(&config.BotsConfig{WebhookTimeout: "1s"})
+	_, err := client.Post(server.URL, "application/json", nil)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+}
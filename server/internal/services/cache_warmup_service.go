@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/cache"
+	"gochat/internal/database"
+	"gochat/internal/models"
+)
+
+// warmupBatchSize 预热时每批查询和写入的数量
+const warmupBatchSize = 500
+
+// CacheWarmupService 缓存预热服务，部署后预先加载热点数据，避免所有请求同时回源数据库
+type CacheWarmupService struct {
+	db *gorm.DB
+}
+
+// NewCacheWarmupService 创建缓存预热服务
+func NewCacheWarmupService() *CacheWarmupService {
+	return &CacheWarmupService{
+		db: database.GetDB(),
+	}
+}
+
+// NewCacheWarmupServiceWithDB 创建缓存预热服务（支持依赖注入）
+func NewCacheWarmupServiceWithDB(db *gorm.DB) *CacheWarmupService {
+	return &CacheWarmupService{
+		db: db,
+	}
+}
+
+// WarmupOptions 预热参数
+type WarmupOptions struct {
+	Since     time.Time // 只预热该时间之后活跃的用户和群组
+	MaxUsers  int
+	MaxGroups int
+}
+
+// WarmupResult 预热结果
+type WarmupResult struct {
+	Users  int `json:"users"`
+	Groups int `json:"groups"`
+}
+
+// Warmup 预热最近活跃用户的资料和好友ID列表，以及消息最多的群组的成员列表
+func (s *CacheWarmupService) Warmup(ctx context.Context, opts WarmupOptions) (*WarmupResult, error) {
+	cacheService := cache.GetCacheService()
+	result := &WarmupResult{}
+	if cacheService == nil {
+		return result, nil
+	}
+	db := s.db.WithContext(ctx)
+
+	// 最近发过消息的用户，按最后发言时间倒序
+	var userIDs []int64
+	if opts.MaxUsers > 0 {
+		err := db.Model(&models.Message{}).
+			Select("from_user_id").
+			Where("created_at >= ?", opts.Since).
+			Group("from_user_id").
+			Order("MAX(created_at) DESC").
+			Limit(opts.MaxUsers).
+			Pluck("from_user_id", &userIDs).Error
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for start := 0; start < len(userIDs); start += warmupBatchSize {
+		end := start + warmupBatchSize
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		batch := userIDs[start:end]
+
+		var users []models.User
+		if err := db.Where("id IN ?", batch).Find(&users).Error; err != nil {
+			return result, err
+		}
+		if err := cacheService.WarmupUserCache(users); err != nil {
+			return result, err
+		}
+
+		var relations []models.FriendRelation
+		if err := db.Select("user_id", "friend_id").Where("user_id IN ?", batch).Find(&relations).Error; err != nil {
+			return result, err
+		}
+		friendIDs := make(map[int64][]int64, len(batch))
+		for _, userID := range batch {
+			friendIDs[userID] = []int64{}
+		}
+		for _, relation := range relations {
+			friendIDs[relation.UserID] = append(friendIDs[relation.UserID], relation.FriendID)
+		}
+		if err := cacheService.WarmupFriendIDs(friendIDs); err != nil {
+			return result, err
+		}
+
+		result.Users += len(users)
+	}
+
+	// 消息最多的群组
+	var groupIDs []int64
+	if opts.MaxGroups > 0 {
+		err := db.Model(&models.Message{}).
+			Select("group_id").
+			Where("group_id IS NOT NULL AND created_at >= ?", opts.Since).
+			Group("group_id").
+			Order("COUNT(*) DESC").
+			Limit(opts.MaxGroups).
+			Pluck("group_id", &groupIDs).Error
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for start := 0; start < len(groupIDs); start += warmupBatchSize {
+		end := start + warmupBatchSize
+		if end > len(groupIDs) {
+			end = len(groupIDs)
+		}
+		batch := groupIDs[start:end]
+
+		var members []models.GroupMember
+		if err := db.Where("group_id IN ?", batch).Find(&members).Error; err != nil {
+			return result, err
+		}
+		grouped := make(map[int64][]models.GroupMember, len(batch))
+		for _, member := range members {
+			grouped[member.GroupID] = append(grouped[member.GroupID], member)
+		}
+		if err := cacheService.WarmupGroupMembers(grouped); err != nil {
+			return result, err
+		}
+
+		result.Groups += len(grouped)
+	}
+
+	return result, nil
+}
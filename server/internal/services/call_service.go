@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/models"
+)
+
+// 通话媒体类型
+const (
+	CallMediaAudio = "audio"
+	CallMediaVideo = "video"
+)
+
+// 通话状态
+const (
+	CallStatusRinging  = "ringing"  // 呼叫中
+	CallStatusActive   = "active"   // 已接通
+	CallStatusEnded    = "ended"    // 接通后挂断
+	CallStatusMissed   = "missed"   // 被叫超时未接听或不在线
+	CallStatusRejected = "rejected" // 被叫拒接
+	CallStatusBusy     = "busy"     // 被叫正在通话中
+	CallStatusCanceled = "canceled" // 主叫在接通前取消
+)
+
+// 通话结束原因，busy/rejected/canceled由状态本身说明，不再单独记录原因
+const (
+	CallReasonHangup       = "hangup"       // 一方挂断
+	CallReasonTimeout      = "timeout"      // 振铃超时
+	CallReasonOffline      = "offline"      // 被叫没有在线的设备
+	CallReasonDisconnected = "disconnected" // 一方的连接断开
+)
+
+// 通话方向（相对于查询通话记录的用户）
+const (
+	CallDirectionOutgoing = "outgoing"
+	CallDirectionIncoming = "incoming"
+)
+
+var (
+	ErrCallNotFound     = errors.New("call not found")
+	ErrCallFinished     = errors.New("call already finished")
+	ErrCallSelf         = errors.New("cannot call yourself")
+	ErrCallNotFriend    = errors.New("can only call friends")
+	ErrInvalidCallMedia = errors.New("media must be audio or video")
+)
+
+// callsFinished 按结束状态统计通话数
+var callsFinished = metrics.NewCounterVec("calls_total", "结束的通话数", "status")
+
+// CallMessage 未接来电消息的内容
+type CallMessage struct {
+	CallID int64  `json:"call_id"`
+	Media  string `json:"media"`
+	Status string `json:"status"` // missed/busy/canceled
+}
+
+// CallInfo 通话记录（包含对方的用户信息）
+type CallInfo struct {
+	models.Call
+	Direction string `json:"direction"` // outgoing/incoming
+	Peer      struct {
+		ID       int64  `json:"id"`
+		Nickname string `json:"nickname"`
+		Avatar   string `json:"avatar"`
+	} `json:"peer"`
+}
+
+type CallService struct {
+	db *gorm.DB
+}
+
+func NewCallService() *CallService {
+	return &CallService{db: database.GetDB()}
+}
+
+// NewCallServiceWithDB 创建通话服务（支持依赖注入）
+func NewCallServiceWithDB(db *gorm.DB) *CallService {
+	return &CallService{db: db}
+}
+
+// StartCall 创建呼叫中的通话记录，只能呼叫好友，不能呼叫机器人
+// 是否占线由调用方根据实时的通话状态判断，占线时随即以busy结束
+func (s *CallService) StartCall(ctx context.Context, callerID, calleeID int64, media string) (*models.Call, error) {
+	if media != CallMediaAudio && media != CallMediaVideo {
+		return nil, ErrInvalidCallMedia
+	}
+	if callerID == calleeID {
+		return nil, ErrCallSelf
+	}
+	callee, err := NewAdminServiceWithDB(s.db).findUser(ctx, calleeID)
+	if err != nil {
+		return nil, err
+	}
+	if callee.IsBot {
+		return nil, ErrCallNotFriend
+	}
+	if !NewFriendServiceWithDB(s.db).IsFriend(ctx, callerID, calleeID) {
+		return nil, ErrCallNotFriend
+	}
+
+	call := &models.Call{
+		CallerID: callerID,
+		CalleeID: calleeID,
+		Media:    media,
+		Status:   CallStatusRinging,
+	}
+	if err := s.db.WithContext(ctx).Create(call).Error; err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// AnswerCall 被叫接听，只有呼叫中的通话可以接听
+func (s *CallService) AnswerCall(ctx context.Context, callID int64) error {
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&models.Call{}).
+		Where("id = ? AND status = ?", callID, CallStatusRinging).
+		Updates(map[string]interface{}{"status": CallStatusActive, "answered_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCallFinished
+	}
+	return nil
+}
+
+// EndCall 结束通话，记录结束状态、原因和接通时长
+// 未接通的呼叫（missed/busy/canceled）以主叫的名义给被叫发一条未接来电消息，被叫不在线时也能在会话中看到
+func (s *CallService) EndCall(ctx context.Context, callID int64, status, reason string) (*models.Call, error) {
+	call, err := s.GetCall(ctx, callID)
+	if err != nil {
+		return nil, err
+	}
+	if call.Status != CallStatusRinging && call.Status != CallStatusActive {
+		return nil, ErrCallFinished
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":     status,
+		"end_reason": reason,
+		"ended_at":   now,
+	}
+	if call.AnsweredAt != nil {
+		updates["duration"] = int(now.Sub(*call.AnsweredAt).Seconds())
+	}
+	result := s.db.WithContext(ctx).Model(&models.Call{}).
+		Where("id = ? AND status = ?", callID, call.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCallFinished
+	}
+	callsFinished.WithLabelValues(status).Inc()
+
+	switch status {
+	case CallStatusMissed, CallStatusBusy, CallStatusCanceled:
+		s.sendMissedCallMessage(ctx, call, status)
+	}
+	return s.GetCall(ctx, callID)
+}
+
+// GetCall 获取通话记录
+func (s *CallService) GetCall(ctx context.Context, callID int64) (*models.Call, error) {
+	var call models.Call
+	err := database.Primary(s.db).WithContext(ctx).First(&call, callID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCallNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &call, nil
+}
+
+// ListCalls 查询用户拨出和接听的通话记录，按ID倒序分页，返回是否还有下一页
+func (s *CallService) ListCalls(ctx context.Context, userID, beforeID int64, limit int) ([]CallInfo, bool, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	query := s.db.WithContext(ctx).Where("(caller_id = ? OR callee_id = ?)", userID, userID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	var calls []models.Call
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&calls).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(calls) > limit
+	if hasMore {
+		calls = calls[:limit]
+	}
+
+	peerIDs := make([]int64, 0, len(calls))
+	for _, call := range calls {
+		peerIDs = append(peerIDs, callPeer(&call, userID))
+	}
+	var users []models.User
+	if len(peerIDs) > 0 {
+		if err := s.db.WithContext(ctx).Unscoped().Where("id IN ?", peerIDs).Find(&users).Error; err != nil {
+			return nil, false, err
+		}
+	}
+	usersByID := make(map[int64]*models.User, len(users))
+	for i := range users {
+		usersByID[users[i].ID] = &users[i]
+	}
+
+	infos := make([]CallInfo, 0, len(calls))
+	for _, call := range calls {
+		info := CallInfo{Call: call, Direction: CallDirectionIncoming}
+		if call.CallerID == userID {
+			info.Direction = CallDirectionOutgoing
+		}
+		info.Peer.ID = callPeer(&call, userID)
+		if user, ok := usersByID[info.Peer.ID]; ok {
+			info.Peer.Nickname = user.Nickname
+			info.Peer.Avatar = user.Avatar
+		}
+		infos = append(infos, info)
+	}
+	return infos, hasMore, nil
+}
+
+// callPeer 通话中相对于userID的另一方
+func callPeer(call *models.Call, userID int64) int64 {
+	if call.CallerID == userID {
+		return call.CalleeID
+	}
+	return call.CallerID
+}
+
+// sendMissedCallMessage 保存并投递未接来电消息，失败只记录日志，不影响通话结束
+func (s *CallService) sendMissedCallMessage(ctx context.Context, call *models.Call, status string) {
+	content, err := json.Marshal(CallMessage{CallID: call.ID, Media: call.Media, Status: status})
+	if err != nil {
+		return
+	}
+	calleeID := call.CalleeID
+	msg := &models.Message{FromUserID: call.CallerID, ToUserID: &calleeID, Content: string(content), MsgType: models.MessageTypeCall}
+	saved, err := NewMessageServiceWithDB(s.db).SaveMessageWithEvent(ctx, msg, MessageCreatedEvent{
+		Recipients: []int64{calleeID},
+		RequestID:  logger.RequestIDFrom(ctx),
+	})
+	if err != nil {
+		logger.WithContext(ctx).Errorf("保存通话 %d 的未接来电消息失败: %v", call.ID, err)
+		return
+	}
+	if _, err := NewOutboxServiceWithDB(s.db).Publish(ctx, saved.EventID); err != nil {
+		logger.WithContext(ctx).Warnf("未接来电消息 %d 投递失败，等待发件箱中继重试: %v", saved.MessageID, err)
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestCallLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	s := NewCallServiceWithDB(db)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+	require.NoError(t, NewFriendServiceWithDB(db).AddFriend(ctx, alice.ID, bob.ID))
+
+	_, err := s.StartCall(ctx, alice.ID, bob.ID, "screen")
+	assert.ErrorIs(t, err, ErrInvalidCallMedia)
+	_, err = s.StartCall(ctx, alice.ID, alice.ID, CallMediaAudio)
+	assert.ErrorIs(t, err, ErrCallSelf)
+	_, err = s.StartCall(ctx, alice.ID, carol.ID, CallMediaAudio)
+	assert.ErrorIs(t, err, ErrCallNotFriend)
+	_, err = s.StartCall(ctx, alice.ID, 999, CallMediaAudio)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	// 接通后挂断，记录接通时长，不发未接来电消息
+	answered, err := s.StartCall(ctx, alice.ID, bob.ID, CallMediaVideo)
+	require.NoError(t, err)
+	assert.Equal(t, CallStatusRinging, answered.Status)
+	require.NoError(t, s.AnswerCall(ctx, answered.ID))
+	assert.ErrorIs(t, s.AnswerCall(ctx, answered.ID), ErrCallFinished)
+	ended, err := s.EndCall(ctx, answered.ID, CallStatusEnded, CallReasonHangup)
+	require.NoError(t, err)
+	assert.Equal(t, CallStatusEnded, ended.Status)
+	assert.Equal(t, CallReasonHangup, ended.EndReason)
+	assert.NotNil(t, ended.AnsweredAt)
+	assert.NotNil(t, ended.EndedAt)
+	_, err = s.EndCall(ctx, answered.ID, CallStatusEnded, CallReasonHangup)
+	assert.ErrorIs(t, err, ErrCallFinished)
+
+	var count int64
+	require.NoError(t, db.Model(&models.Message{}).Where("msg_type = ?", models.MessageTypeCall).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// 未接听的呼叫以主叫的名义给被叫发未接来电消息
+	missed, err := s.StartCall(ctx, bob.ID, alice.ID, CallMediaAudio)
+	require.NoError(t, err)
+	_, err = s.EndCall(ctx, missed.ID, CallStatusMissed, CallReasonTimeout)
+	require.NoError(t, err)
+	var msg models.Message
+	require.NoError(t, db.Where("msg_type = ?", models.MessageTypeCall).First(&msg).Error)
+	assert.Equal(t, bob.ID, msg.FromUserID)
+	assert.Equal(t, alice.ID, *msg.ToUserID)
+	var content CallMessage
+	require.NoError(t, json.Unmarshal([]byte(msg.Content), &content))
+	assert.Equal(t, CallMessage{CallID: missed.ID, Media: CallMediaAudio, Status: CallStatusMissed}, content)
+
+	_, err = s.EndCall(ctx, 999, CallStatusMissed, CallReasonTimeout)
+	assert.ErrorIs(t, err, ErrCallNotFound)
+}
+
+func TestListCalls(t *testing.T) {
+	db := newTestDB(t)
+	s := NewCallServiceWithDB(db)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+	friendService := NewFriendServiceWithDB(db)
+	require.NoError(t, friendService.AddFriend(ctx, alice.ID, bob.ID))
+	require.NoError(t, friendService.AddFriend(ctx, bob.ID, carol.ID))
+
+	outgoing, err := s.StartCall(ctx, alice.ID, bob.ID, CallMediaAudio)
+	require.NoError(t, err)
+	_, err = s.StartCall(ctx, carol.ID, bob.ID, CallMediaVideo)
+	require.NoError(t, err)
+	incoming, err := s.StartCall(ctx, bob.ID, alice.ID, CallMediaVideo)
+	require.NoError(t, err)
+	_, err = s.EndCall(ctx, incoming.ID, CallStatusRejected, "")
+	require.NoError(t, err)
+
+	calls, hasMore, err := s.ListCalls(ctx, alice.ID, 0, 1)
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	require.Len(t, calls, 1)
+	assert.Equal(t, incoming.ID, calls[0].ID)
+	assert.Equal(t, CallStatusRejected, calls[0].Status)
+	assert.Equal(t, CallDirectionIncoming, calls[0].Direction)
+	assert.Equal(t, bob.ID, calls[0].Peer.ID)
+	assert.Equal(t, "bob", calls[0].Peer.Nickname)
+
+	calls, hasMore, err = s.ListCalls(ctx, alice.ID, calls[0].ID, 10)
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	require.Len(t, calls, 1, "calls between other users should not be returned")
+	assert.Equal(t, outgoing.ID, calls[0].ID)
+	assert.Equal(t, CallDirectionOutgoing, calls[0].Direction)
+	assert.Equal(t, "bob", calls[0].Peer.Nickname)
+}
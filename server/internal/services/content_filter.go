@@ -0,0 +1,348 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+)
+
+// 敏感词处理方式
+const (
+	FilterModeReject = "reject" // 拒绝
+	FilterModeMask   = "mask"   // 命中部分替换为掩码字符
+	FilterModeFlag   = "flag"   // 放行并记录审计日志
+	FilterModeOff    = "off"    // 不过滤（仅用于群覆盖）
+)
+
+// ErrSensitiveContent 内容包含敏感词且处理方式为拒绝
+var ErrSensitiveContent = errors.New("content contains sensitive words")
+
+// wordList 一份编译好的词库
+type wordList struct {
+	words    [][]rune // 已转为小写
+	patterns []*regexp.Regexp
+}
+
+// FilterResult 过滤结果
+type FilterResult struct {
+	Text    string   // 处理后的文本（mask模式下已替换）
+	Matches []string // 命中的词或正则
+	Mode    string   // 实际使用的处理方式
+}
+
+// Flagged 内容命中敏感词但按flag模式放行
+func (r *FilterResult) Flagged() bool {
+	return r.Mode == FilterModeFlag && len(r.Matches) > 0
+}
+
+// ContentFilter 敏感词过滤器，词库文件修改后在reload_interval内自动重新加载
+type ContentFilter struct {
+	cfg            *config.FilterConfig
+	reloadInterval time.Duration
+	maskChar       rune
+
+	mu         sync.RWMutex
+	global     *wordList
+	groups     map[int64]*wordList // 群额外词库
+	groupModes map[int64]string
+	modTime    time.Time
+	checkedAt  time.Time
+	reloading  atomic.Bool
+}
+
+// contentFilter 全局敏感词过滤器，未启用时为nil
+var contentFilter *ContentFilter
+
+// InitContentFilter 按配置初始化全局敏感词过滤器，未启用时不做任何处理
+func InitContentFilter(cfg *config.FilterConfig) error {
+	if !cfg.Enabled {
+		contentFilter = nil
+		return nil
+	}
+	filter, err := NewContentFilter(cfg)
+	if err != nil {
+		return err
+	}
+	contentFilter = filter
+	return nil
+}
+
+// GetContentFilter 获取全局敏感词过滤器，未启用时返回nil（nil过滤器放行所有内容）
+func GetContentFilter() *ContentFilter {
+	return contentFilter
+}
+
+// NewContentFilter 创建敏感词过滤器并加载词库，配置已在加载时校验
+func NewContentFilter(cfg *config.FilterConfig) (*ContentFilter, error) {
+	f := &ContentFilter{
+		cfg:        cfg,
+		maskChar:   []rune(cfg.MaskChar)[0],
+		groups:     make(map[int64]*wordList),
+		groupModes: make(map[int64]string),
+	}
+	f.reloadInterval, _ = time.ParseDuration(cfg.ReloadInterval)
+	for _, override := range cfg.GroupOverrides {
+		if override.Mode != "" {
+			f.groupModes[override.GroupID] = override.Mode
+		}
+		if len(override.Words) > 0 {
+			list, err := compileWordList(override.Words)
+			if err != nil {
+				return nil, fmt.Errorf("group %d: %w", override.GroupID, err)
+			}
+			f.groups[override.GroupID] = list
+		}
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload 重新加载词库文件，加载失败时保留原词库
+func (f *ContentFilter) Reload() error {
+	info, err := os.Stat(f.cfg.WordsFile)
+	if err != nil {
+		return err
+	}
+	lines, err := readWordLines(f.cfg.WordsFile)
+	if err != nil {
+		return err
+	}
+	list, err := compileWordList(lines)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.global = list
+	f.modTime = info.ModTime()
+	f.checkedAt = time.Now()
+	f.mu.Unlock()
+	logger.GetLogger().Infof("敏感词库已加载: %d个词, %d个正则", len(list.words), len(list.patterns))
+	return nil
+}
+
+// CheckMessage 过滤群聊或单聊的文本消息，groupID为0表示单聊；reject模式下命中时返回ErrSensitiveContent
+func (f *ContentFilter) CheckMessage(content string, groupID int64) (*FilterResult, error) {
+	if f == nil {
+		return &FilterResult{Text: content}, nil
+	}
+	f.reloadIfModified()
+
+	f.mu.RLock()
+	mode, ok := f.groupModes[groupID]
+	if !ok {
+		mode = f.cfg.MessageMode
+	}
+	lists := []*wordList{f.global}
+	if extra, ok := f.groups[groupID]; ok && groupID != 0 {
+		lists = append(lists, extra)
+	}
+	f.mu.RUnlock()
+
+	if mode == FilterModeOff {
+		return &FilterResult{Text: content, Mode: mode}, nil
+	}
+	return f.apply(content, mode, lists...)
+}
+
+// CheckNickname 过滤昵称；reject模式下命中时返回ErrSensitiveContent
+func (f *ContentFilter) CheckNickname(nickname string) (*FilterResult, error) {
+	if f == nil {
+		return &FilterResult{Text: nickname}, nil
+	}
+	f.reloadIfModified()
+
+	f.mu.RLock()
+	global := f.global
+	f.mu.RUnlock()
+	return f.apply(nickname, f.cfg.NicknameMode, global)
+}
+
+// apply 按处理方式处理命中的内容
+func (f *ContentFilter) apply(text, mode string, lists ...*wordList) (*FilterResult, error) {
+	masked, matches := matchWords(text, lists...)
+	result := &FilterResult{Text: text, Matches: matches, Mode: mode}
+	if len(matches) == 0 {
+		return result, nil
+	}
+	switch mode {
+	case FilterModeReject:
+		return result, ErrSensitiveContent
+	case FilterModeMask:
+		runes := []rune(text)
+		for i, hit := range masked {
+			if hit {
+				runes[i] = f.maskChar
+			}
+		}
+		result.Text = string(runes)
+	}
+	return result, nil
+}
+
+// reloadIfModified 超过检查间隔时在后台检查词库文件，修改过则重新加载
+func (f *ContentFilter) reloadIfModified() {
+	f.mu.RLock()
+	due := time.Since(f.checkedAt) > f.reloadInterval
+	modTime := f.modTime
+	f.mu.RUnlock()
+	if !due || !f.reloading.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer f.reloading.Store(false)
+		info, err := os.Stat(f.cfg.WordsFile)
+		if err == nil && info.ModTime().Equal(modTime) {
+			f.mu.Lock()
+			f.checkedAt = time.Now()
+			f.mu.Unlock()
+			return
+		}
+		if err == nil {
+			err = f.Reload()
+		}
+		if err != nil {
+			// 加载失败时继续使用原词库，到下个检查间隔再重试
+			f.mu.Lock()
+			f.checkedAt = time.Now()
+			f.mu.Unlock()
+			logger.GetLogger().Errorf("重新加载敏感词库失败: %v", err)
+		}
+	}()
+}
+
+// RecordFlagged flag模式下把命中的内容写入审计日志
+func RecordFlagged(ctx context.Context, userID int64, field, targetType string, targetID int64, result *FilterResult) {
+	err := NewAuditService().Record(ctx, &AuditEntry{
+		ActorID:    userID,
+		ActorType:  AuditActorUser,
+		Action:     AuditActionContentFlagged,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Detail:     map[string]interface{}{"field": field, "matches": result.Matches, "text": result.Text},
+	})
+	if err != nil {
+		logger.WithContext(ctx).Errorf("记录敏感内容失败: user=%d, error=%v", userID, err)
+	}
+}
+
+// readWordLines 读取词库文件，忽略空行和注释
+func readWordLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// compileWordList 编译词库，re:开头的为正则表达式（不区分大小写）
+func compileWordList(lines []string) (*wordList, error) {
+	list := &wordList{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if expr, ok := strings.CutPrefix(line, "re:"); ok {
+			pattern, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", expr, err)
+			}
+			list.patterns = append(list.patterns, pattern)
+			continue
+		}
+		word := []rune(line)
+		for i, r := range word {
+			word[i] = unicode.ToLower(r)
+		}
+		list.words = append(list.words, word)
+	}
+	return list, nil
+}
+
+// matchWords 查找所有命中的词和正则，返回每个字符是否被命中以及命中的词
+// 词按字符逐个比较，词库规模在几千以内时足够快
+func matchWords(text string, lists ...*wordList) ([]bool, []string) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	masked := make([]bool, len(runes))
+	var matches []string
+
+	for _, list := range lists {
+		if list == nil {
+			continue
+		}
+		for _, word := range list.words {
+			found := false
+			for i := 0; i+len(word) <= len(lower); i++ {
+				if equalRunes(lower[i:i+len(word)], word) {
+					found = true
+					for j := i; j < i+len(word); j++ {
+						masked[j] = true
+					}
+				}
+			}
+			if found {
+				matches = append(matches, string(word))
+			}
+		}
+
+		for _, pattern := range list.patterns {
+			found := false
+			for _, loc := range pattern.FindAllStringIndex(text, -1) {
+				if loc[0] == loc[1] {
+					continue
+				}
+				found = true
+				// 字节偏移转换为字符偏移
+				start := utf8.RuneCountInString(text[:loc[0]])
+				end := start + utf8.RuneCountInString(text[loc[0]:loc[1]])
+				for j := start; j < end; j++ {
+					masked[j] = true
+				}
+			}
+			if found {
+				matches = append(matches, "re:"+strings.TrimPrefix(pattern.String(), "(?i)"))
+			}
+		}
+	}
+	return masked, matches
+}
+
+func equalRunes(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+func newTestContentFilter(t *testing.T, words string, mutate func(cfg *config.FilterConfig)) *ContentFilter {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sensitive_words.txt")
+	require.NoError(t, os.WriteFile(path, []byte(words), 0o644))
+	cfg := &config.FilterConfig{
+		Enabled:        true,
+		WordsFile:      path,
+		ReloadInterval: "1h",
+		MessageMode:    FilterModeMask,
+		NicknameMode:   FilterModeReject,
+		MaskChar:       "*",
+	}
+	if mutate != nil {
+		mutate(cfg)
+	}
+	filter, err := NewContentFilter(cfg)
+	require.NoError(t, err)
+	return filter
+}
+
+func TestContentFilterMask(t *testing.T) {
+	filter := newTestContentFilter(t, "# 注释\n\nbadword\n坏词\nre:\\d{3}-\\d{4}\n", nil)
+
+	result, err := filter.CheckMessage("This BadWord is 坏词, call 555-1234", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "This ******* is **, call ********", result.Text)
+	assert.ElementsMatch(t, []string{"badword", "坏词", `re:\d{3}-\d{4}`}, result.Matches)
+	assert.False(t, result.Flagged())
+
+	result, err = filter.CheckMessage("hello", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Text)
+	assert.Empty(t, result.Matches)
+}
+
+func TestContentFilterRejectAndFlag(t *testing.T) {
+	filter := newTestContentFilter(t, "badword\n", func(cfg *config.FilterConfig) {
+		cfg.MessageMode = FilterModeFlag
+	})
+
+	_, err := filter.CheckNickname("BADWORD guy")
+	assert.ErrorIs(t, err, ErrSensitiveContent)
+	result, err := filter.CheckNickname("nice guy")
+	require.NoError(t, err)
+	assert.Equal(t, "nice guy", result.Text)
+
+	result, err = filter.CheckMessage("a badword here", 0)
+	require.NoError(t, err)
+	assert.True(t, result.Flagged())
+	assert.Equal(t, "a badword here", result.Text)
+}
+
+func TestContentFilterGroupOverrides(t *testing.T) {
+	filter := newTestContentFilter(t, "badword\n", func(cfg *config.FilterConfig) {
+		cfg.GroupOverrides = []config.GroupFilterOverride{
+			{GroupID: 1, Mode: FilterModeOff},
+			{GroupID: 2, Mode: FilterModeReject, Words: []string{"spoiler"}},
+		}
+	})
+
+	result, err := filter.CheckMessage("badword", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "badword", result.Text)
+
+	_, err = filter.CheckMessage("no spoiler please", 2)
+	assert.ErrorIs(t, err, ErrSensitiveContent)
+
+	// 群额外词库只对该群生效
+	result, err = filter.CheckMessage("no spoiler please", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "no spoiler please", result.Text)
+}
+
+func TestContentFilterHotReload(t *testing.T) {
+	filter := newTestContentFilter(t, "badword\n", func(cfg *config.FilterConfig) {
+		cfg.ReloadInterval = "1ms"
+	})
+
+	require.NoError(t, os.WriteFile(filter.cfg.WordsFile, []byte("newword\n"), 0o644))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filter.cfg.WordsFile, future, future))
+
+	assert.Eventually(t, func() bool {
+		result, err := filter.CheckMessage("badword newword", 0)
+		return err == nil && result.Text == "badword *******"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestContentFilterNil(t *testing.T) {
+	var filter *ContentFilter
+	result, err := filter.CheckMessage("anything", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "anything", result.Text)
+	assert.False(t, result.Flagged())
+}
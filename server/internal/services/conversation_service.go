@@ -1,11 +1,14 @@
 package services
 
 import (
+	"context"
 	"time"
 
 	"gorm.io/gorm"
 
+	"gochat/internal/cache"
 	"gochat/internal/database"
+	"gochat/internal/logger"
 	"gochat/internal/models"
 )
 
@@ -27,27 +30,136 @@ func NewConversationServiceWithDB(db *gorm.DB) *ConversationService {
 }
 
 type ConversationInfo struct {
-	ID             int64  `json:"id"`
-	Type           int    `json:"type"`
-	TargetID       int64  `json:"target_id"`
-	TargetName     string `json:"target_name"`
-	TargetAvatar   string `json:"target_avatar"`
-	LastMsgContent string `json:"last_msg_content"`
-	LastMsgType    int    `json:"last_msg_type"`
-	LastMsgTime    string `json:"last_msg_time"`
-	UnreadCount    int    `json:"unread_count"`
-}
-
-// GetConversations 获取用户的会话列表
-func (s *ConversationService) GetConversations(userID int64) ([]ConversationInfo, error) {
+	ID             int64      `json:"id"`
+	Type           int        `json:"type"`
+	TargetID       int64      `json:"target_id"`
+	TargetName     string     `json:"target_name"`
+	TargetAvatar   string     `json:"target_avatar"`
+	LastMsgContent string     `json:"last_msg_content"`
+	LastMsgType    int        `json:"last_msg_type"`
+	LastMsgTime    string     `json:"last_msg_time"`
+	UnreadCount    int        `json:"unread_count"`
+	LastReadMsgID  int64      `json:"last_read_msg_id"`
+	IsMuted        bool       `json:"is_muted"`
+	MutedUntil     *time.Time `json:"muted_until"`
+	HideUnread     bool       `json:"hide_unread"`
+	IsPinned       bool       `json:"is_pinned"`
+	PinnedAt       string     `json:"pinned_at"`
+	IsArchived     bool       `json:"is_archived"`
+}
+
+// applyMute 按截止时间计算免打扰状态，免打扰期间设置了不显示未读数时未读数返回0
+// 缓存中保存的是数据库中的原始设置，每次返回前重新计算，免打扰到期后不需要删除缓存
+func (c *ConversationInfo) applyMute(now time.Time) {
+	state := applyMuteSettings(muteState{IsMuted: c.IsMuted, MutedUntil: c.MutedUntil, HideUnread: c.HideUnread, UnreadCount: c.UnreadCount}, now)
+	c.IsMuted, c.MutedUntil, c.UnreadCount = state.IsMuted, state.MutedUntil, state.UnreadCount
+}
+
+// muteState 会话的免打扰设置和未读数
+type muteState struct {
+	IsMuted     bool
+	MutedUntil  *time.Time // 为空表示一直免打扰
+	HideUnread  bool
+	UnreadCount int
+}
+
+// applyMuteSettings 会话列表和单个会话共用的免打扰计算，返回now时生效的状态：
+// 到期后清除免打扰状态和截止时间，生效期间设置了不显示未读数时未读数置0
+func applyMuteSettings(state muteState, now time.Time) muteState {
+	state.IsMuted = state.IsMuted && (state.MutedUntil == nil || state.MutedUntil.After(now))
+	if !state.IsMuted {
+		state.MutedUntil = nil
+	} else if state.HideUnread {
+		state.UnreadCount = 0
+	}
+	return state
+}
+
+// 缓存完整会话列表时使用的分页参数（会话列表不分页）
+const (
+	conversationListCachePage     = 0
+	conversationListCachePageSize = 0
+)
+
+// unreadCountSQL 按已读位置统计会话c的未读数：已读位置之后他人发送、未删除且未对该用户隐藏的消息
+// 只统计热表，超过归档保留期仍未读的消息不计入
+const unreadCountSQL = `CASE WHEN c.type = 1 THEN (
+			SELECT COUNT(*) FROM messages um
+			WHERE um.to_user_id = c.user_id AND um.from_user_id = c.target_id AND um.id > c.last_read_msg_id
+			AND um.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM message_deletions ud WHERE ud.message_id = um.id AND ud.user_id = c.user_id)
+		) ELSE (
+			SELECT COUNT(*) FROM messages um
+			WHERE um.group_id = c.target_id AND um.from_user_id <> c.user_id AND um.id > c.last_read_msg_id
+			AND um.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM message_deletions ud WHERE ud.message_id = um.id AND ud.user_id = c.user_id)
+		) END`
+
+// GetConversations 获取用户的会话列表，不包括已归档的会话
+// 数据库中的列表会缓存到Redis，新消息、已读位置变化时删除缓存
+func (s *ConversationService) GetConversations(ctx context.Context, userID int64) ([]ConversationInfo, error) {
+	cacheService := cache.GetCacheService()
+
+	var conversations []ConversationInfo
+	if cacheService != nil {
+		if err := cacheService.GetConversationList(userID, conversationListCachePage, conversationListCachePageSize, &conversations); err != nil {
+			conversations = nil
+		}
+	}
+
+	if conversations == nil {
+		var err error
+		conversations, err = s.queryConversations(ctx, userID, false)
+		if err != nil {
+			return nil, err
+		}
+		if cacheService != nil && len(conversations) > 0 {
+			if err := cacheService.CacheConversationList(userID, conversationListCachePage, conversationListCachePageSize, conversations); err != nil {
+				logger.WithContext(ctx).Warnf("缓存会话列表失败: %v", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	for i := range conversations {
+		conversations[i].applyMute(now)
+	}
+	return conversations, nil
+}
+
+// GetArchivedConversations 获取用户已归档的会话列表，排列顺序与会话列表相同
+// 归档列表访问较少，不缓存
+func (s *ConversationService) GetArchivedConversations(ctx context.Context, userID int64) ([]ConversationInfo, error) {
+	conversations, err := s.queryConversations(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+	if conversations == nil {
+		conversations = []ConversationInfo{}
+	}
+	now := time.Now()
+	for i := range conversations {
+		conversations[i].applyMute(now)
+	}
+	return conversations, nil
+}
+
+// queryConversations 从数据库查询用户的会话列表，archived指定查询已归档或未归档的会话
+func (s *ConversationService) queryConversations(ctx context.Context, userID int64, archived bool) ([]ConversationInfo, error) {
 	var conversations []ConversationInfo
 
-	rows, err := s.db.Raw(`
+	rows, err := s.db.WithContext(ctx).Raw(`
 		SELECT
 			c.id,
 			c.type,
 			c.target_id,
-			c.unread_count,
+			`+unreadCountSQL+` as unread_count,
+			c.last_read_msg_id,
+			c.is_muted,
+			c.muted_until,
+			c.hide_unread,
+			c.is_pinned,
+			c.is_archived,
 			CASE
 				WHEN c.type = 1 THEN u.nickname
 				WHEN c.type = 2 THEN g.name
@@ -60,19 +172,21 @@ func (s *ConversationService) GetConversations(userID int64) ([]ConversationInfo
 			END as target_avatar,
 			COALESCE(m.content, '暂无消息') as last_msg_content,
 			COALESCE(m.msg_type, 1) as last_msg_type,
-			COALESCE(DATE_FORMAT(m.created_at, '%Y-%m-%d %H:%i:%s'), '') as last_msg_time
+			COALESCE(` + database.DateTimeExpr(s.db, "m.created_at") + `, '') as last_msg_time,
+			COALESCE(` + database.DateTimeExpr(s.db, "c.pinned_at") + `, '') as pinned_at
 		FROM conversations c
 		LEFT JOIN users u ON c.type = 1 AND c.target_id = u.id
-		LEFT JOIN ` + "`groups`" + ` g ON c.type = 2 AND c.target_id = g.id
+		LEFT JOIN ` + database.QuoteTable(s.db, "groups") + ` g ON c.type = 2 AND c.target_id = g.id
 		LEFT JOIN group_members gm ON c.type = 2 AND c.target_id = gm.group_id AND gm.user_id = c.user_id
-		LEFT JOIN messages m ON c.last_msg_id = m.id
-		WHERE c.user_id = ?
+		LEFT JOIN messages m ON c.last_msg_id = m.id AND m.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM message_deletions d WHERE d.message_id = m.id AND d.user_id = c.user_id)
+		WHERE c.user_id = ? AND c.is_archived = ?
 		AND (
 			c.type = 1
 			OR (c.type = 2 AND gm.user_id IS NOT NULL)
 		)
-		ORDER BY c.updated_at DESC
-	`, userID).Rows()
+		ORDER BY c.is_pinned DESC, c.pinned_at DESC, c.updated_at DESC
+	`, userID, archived).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -85,55 +199,140 @@ func (s *ConversationService) GetConversations(userID int64) ([]ConversationInfo
 			&conv.Type,
 			&conv.TargetID,
 			&conv.UnreadCount,
+			&conv.LastReadMsgID,
+			&conv.IsMuted,
+			&conv.MutedUntil,
+			&conv.HideUnread,
+			&conv.IsPinned,
+			&conv.IsArchived,
 			&conv.TargetName,
 			&conv.TargetAvatar,
 			&conv.LastMsgContent,
 			&conv.LastMsgType,
 			&conv.LastMsgTime,
+			&conv.PinnedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		conv.TargetAvatar = PublicURL(conv.TargetAvatar)
 		conversations = append(conversations, conv)
 	}
 
 	return conversations, nil
 }
 
-// ClearUnreadCount 清空未读计数
-func (s *ConversationService) ClearUnreadCount(userID, conversationID int64) error {
-	return s.db.Model(&models.Conversation{}).
-		Where("id = ? AND user_id = ?", conversationID, userID).
-		Update("unread_count", 0).Error
+// InvalidateConversationList 会话变更后删除用户的会话列表缓存
+func InvalidateConversationList(userIDs ...int64) {
+	cacheService := cache.GetCacheService()
+	if cacheService == nil {
+		return
+	}
+	for _, userID := range userIDs {
+		if err := cacheService.InvalidateConversationCache(userID); err != nil {
+			logger.GetLogger().Warnf("删除用户 %d 的会话列表缓存失败: %v", userID, err)
+		}
+	}
+}
+
+// ClearUnreadCount 清空未读计数，即已读位置前移到会话的最新消息
+func (s *ConversationService) ClearUnreadCount(ctx context.Context, userID, conversationID int64) error {
+	return s.MarkRead(ctx, userID, conversationID, 0)
+}
+
+// MarkRead 已读位置前移到messageID，messageID为0或超过会话最新消息时前移到最新消息
+// 已读位置只前移不后退，多端乱序上报时以最新的为准
+func (s *ConversationService) MarkRead(ctx context.Context, userID, conversationID, messageID int64) error {
+	var conversation models.Conversation
+	err := database.Primary(s.db.WithContext(ctx)).Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error
+	if err != nil {
+		return err
+	}
+	return s.advanceReadPointer(ctx, &conversation, messageID)
+}
+
+// MarkReadUpTo 按会话双方前移已读位置，会话不存在时忽略
+func (s *ConversationService) MarkReadUpTo(ctx context.Context, userID, targetID int64, conversationType int, messageID int64) error {
+	var conversation models.Conversation
+	err := database.Primary(s.db.WithContext(ctx)).Where("user_id = ? AND type = ? AND target_id = ?", userID, conversationType, targetID).
+		First(&conversation).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.advanceReadPointer(ctx, &conversation, messageID)
+}
+
+// advanceReadPointer 前移会话的已读位置
+func (s *ConversationService) advanceReadPointer(ctx context.Context, conversation *models.Conversation, messageID int64) error {
+	latest, err := latestMessageID(s.db.WithContext(ctx), conversation.UserID, conversation.TargetID, conversation.Type)
+	if err != nil {
+		return err
+	}
+	if messageID <= 0 || messageID > latest {
+		messageID = latest
+	}
+
+	result := database.Primary(s.db.WithContext(ctx)).Model(&models.Conversation{}).
+		Where("id = ? AND last_read_msg_id < ?", conversation.ID, messageID).
+		Update("last_read_msg_id", messageID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		InvalidateConversationList(conversation.UserID)
+	}
+	return nil
+}
+
+// latestMessageID 会话中最新一条消息的ID（包括已删除的），没有消息时返回0
+func latestMessageID(db *gorm.DB, userID, targetID int64, conversationType int) (int64, error) {
+	query := database.Primary(db).Unscoped().Model(&models.Message{})
+	if conversationType == models.ConversationTypeGroup {
+		query = query.Where("group_id = ?", targetID)
+	} else {
+		query = query.Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)",
+			userID, targetID, targetID, userID)
+	}
+	var latest int64
+	err := query.Select("COALESCE(MAX(id), 0)").Scan(&latest).Error
+	return latest, err
 }
 
 // UpdateLastMessage 更新会话的最后一条消息
-func (s *ConversationService) UpdateLastMessage(userID, targetID, messageID int64, content string) error {
+func (s *ConversationService) UpdateLastMessage(ctx context.Context, userID, targetID, messageID int64, content string) error {
 	// 判断会话类型（单聊还是群聊）
 	conversationType := models.ConversationTypePrivate // 默认单聊
 	// 如果targetID对应的是群组，则为群聊
 	var groupExists bool
-	s.db.Raw("SELECT EXISTS(SELECT 1 FROM `groups` WHERE id = ?)", targetID).Scan(&groupExists)
+	db := database.Primary(s.db.WithContext(ctx))
+	db.Raw("SELECT EXISTS(SELECT 1 FROM "+database.QuoteTable(s.db, "groups")+" WHERE id = ?)", targetID).Scan(&groupExists)
 	if groupExists {
 		conversationType = models.ConversationTypeGroup
 	}
 
-	// 查找或创建会话
+	// 查找或创建会话（走主库，避免副本延迟导致重复创建）
 	var conversation models.Conversation
-	err := s.db.Where("user_id = ? AND type = ? AND target_id = ?", userID, conversationType, targetID).
+	err := db.Where("user_id = ? AND type = ? AND target_id = ?", userID, conversationType, targetID).
 		First(&conversation).Error
 
 	if err == gorm.ErrRecordNotFound {
-		// 创建新会话
+		// 创建新会话，之前的消息视为已读，只有这条消息未读
 		conversation = models.Conversation{
-			UserID:      userID,
-			Type:        conversationType,
-			TargetID:    targetID,
-			LastMsgID:   &messageID,
-			UnreadCount: 0, // 新会话未读计数为0
-			UpdatedAt:   time.Now(),
-		}
-		return s.db.Create(&conversation).Error
+			UserID:        userID,
+			Type:          conversationType,
+			TargetID:      targetID,
+			LastMsgID:     &messageID,
+			LastReadMsgID: messageID - 1,
+			UpdatedAt:     time.Now(),
+		}
+		if err := s.db.WithContext(ctx).Create(&conversation).Error; err != nil {
+			return err
+		}
+		InvalidateConversationList(userID)
+		return nil
 	} else if err != nil {
 		return err
 	}
@@ -143,33 +342,73 @@ func (s *ConversationService) UpdateLastMessage(userID, targetID, messageID int6
 		"last_msg_id": messageID,
 		"updated_at":  time.Now(),
 	}
+	if conversation.IsArchived && s.unarchiveOnMessage(ctx, userID, messageID) {
+		updates["is_archived"] = false
+	}
+
+	if err := s.db.WithContext(ctx).Model(&conversation).Updates(updates).Error; err != nil {
+		return err
+	}
+	InvalidateConversationList(userID)
+	return nil
+}
 
-	return s.db.Model(&conversation).Updates(updates).Error
+// unarchiveOnMessage 已归档的会话收到他人的新消息时是否自动取消归档
+// 用户关闭了自动取消归档、或消息是用户自己发送的时保持归档
+func (s *ConversationService) unarchiveOnMessage(ctx context.Context, userID, messageID int64) bool {
+	var keepArchived bool
+	if err := database.Primary(s.db.WithContext(ctx)).Model(&models.User{}).Where("id = ?", userID).
+		Select("keep_archived").Scan(&keepArchived).Error; err != nil || keepArchived {
+		return false
+	}
+	var fromUserID int64
+	if err := database.Primary(s.db.WithContext(ctx)).Model(&models.Message{}).Where("id = ?", messageID).
+		Select("from_user_id").Scan(&fromUserID).Error; err != nil {
+		return false
+	}
+	return fromUserID != userID
 }
 
-// IncrementUnreadCount 增加未读计数 (用于消息接收者)
-func (s *ConversationService) IncrementUnreadCount(userID, targetID int64, conversationType int) error {
-	return s.db.Model(&models.Conversation{}).
-		Where("user_id = ? AND type = ? AND target_id = ?", userID, conversationType, targetID).
-		Update("unread_count", gorm.Expr("unread_count + 1")).Error
+// withUnreadCount 按已读位置统计会话的未读数，并按截止时间计算免打扰状态（与会话列表相同）
+func (s *ConversationService) withUnreadCount(ctx context.Context, conversation *models.Conversation) (*models.Conversation, error) {
+	err := s.db.WithContext(ctx).Raw("SELECT "+unreadCountSQL+" FROM conversations c WHERE c.id = ?", conversation.ID).
+		Scan(&conversation.UnreadCount).Error
+	if err != nil {
+		return nil, err
+	}
+	state := applyMuteSettings(muteState{
+		IsMuted:     conversation.IsMuted,
+		MutedUntil:  conversation.MutedUntil,
+		HideUnread:  conversation.HideUnread,
+		UnreadCount: conversation.UnreadCount,
+	}, time.Now())
+	conversation.IsMuted, conversation.MutedUntil, conversation.UnreadCount = state.IsMuted, state.MutedUntil, state.UnreadCount
+	return conversation, nil
 }
 
 // CreateOrUpdateConversation 创建或更新会话
-func (s *ConversationService) CreateOrUpdateConversation(userID, targetID int64, conversationType int) (*models.Conversation, error) {
+func (s *ConversationService) CreateOrUpdateConversation(ctx context.Context, userID, targetID int64, conversationType int) (*models.Conversation, error) {
 	var conversation models.Conversation
-	err := s.db.Where("user_id = ? AND type = ? AND target_id = ?", userID, conversationType, targetID).
+	err := database.Primary(s.db.WithContext(ctx)).Where("user_id = ? AND type = ? AND target_id = ?", userID, conversationType, targetID).
 		First(&conversation).Error
 
 	if err == gorm.ErrRecordNotFound {
-		// 创建新会话
+		// 创建新会话，已有的消息视为已读
+		latest, err := latestMessageID(s.db.WithContext(ctx), userID, targetID, conversationType)
+		if err != nil {
+			return nil, err
+		}
 		conversation = models.Conversation{
-			UserID:      userID,
-			Type:        conversationType,
-			TargetID:    targetID,
-			UnreadCount: 0,
-			UpdatedAt:   time.Now(),
+			UserID:        userID,
+			Type:          conversationType,
+			TargetID:      targetID,
+			LastReadMsgID: latest,
+			UpdatedAt:     time.Now(),
+		}
+		err = s.db.WithContext(ctx).Create(&conversation).Error
+		if err == nil {
+			InvalidateConversationList(userID)
 		}
-		err = s.db.Create(&conversation).Error
 		return &conversation, err
 	}
 
@@ -177,11 +416,160 @@ func (s *ConversationService) CreateOrUpdateConversation(userID, targetID int64,
 }
 
 // GetConversationByID 根据ID获取会话信息
-func (s *ConversationService) GetConversationByID(conversationID, userID int64) (*models.Conversation, error) {
+func (s *ConversationService) GetConversationByID(ctx context.Context, conversationID, userID int64) (*models.Conversation, error) {
+	var conversation models.Conversation
+	err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.withUnreadCount(ctx, &conversation)
+}
+
+// GetConversation 根据会话双方获取会话信息
+func (s *ConversationService) GetConversation(ctx context.Context, userID, targetID int64, conversationType int) (*models.Conversation, error) {
 	var conversation models.Conversation
-	err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error
+	err := s.db.WithContext(ctx).Where("user_id = ? AND type = ? AND target_id = ?", userID, conversationType, targetID).
+		First(&conversation).Error
 	if err != nil {
 		return nil, err
 	}
-	return &conversation, nil
+	return s.withUnreadCount(ctx, &conversation)
+}
+
+// Mute 设置会话免打扰，until为空表示一直免打扰直到取消；hideUnread为true时免打扰期间未读数返回0，不计入角标
+// 免打扰的会话照常接收消息和更新已读位置，不计入离线消息摘要
+func (s *ConversationService) Mute(ctx context.Context, userID, conversationID int64, until *time.Time, hideUnread bool) (*models.Conversation, error) {
+	return s.updateColumns(ctx, userID, conversationID, map[string]interface{}{
+		"is_muted":    true,
+		"muted_until": until,
+		"hide_unread": hideUnread,
+	})
+}
+
+// Unmute 取消会话免打扰
+func (s *ConversationService) Unmute(ctx context.Context, userID, conversationID int64) (*models.Conversation, error) {
+	return s.updateColumns(ctx, userID, conversationID, map[string]interface{}{
+		"is_muted":    false,
+		"muted_until": nil,
+		"hide_unread": false,
+	})
+}
+
+// SetPinned 设置会话置顶，置顶的会话按置顶时间倒序排在会话列表前面
+// 对已置顶的会话再次置顶时更新置顶时间，移到最前面；取消置顶时清空置顶时间
+func (s *ConversationService) SetPinned(ctx context.Context, userID, conversationID int64, pinned bool) (*models.Conversation, error) {
+	var pinnedAt *time.Time
+	if pinned {
+		now := time.Now()
+		pinnedAt = &now
+	}
+	return s.updateColumns(ctx, userID, conversationID, map[string]interface{}{"is_pinned": pinned, "pinned_at": pinnedAt})
+}
+
+// SetArchived 归档或取消归档会话，归档的会话不在会话列表中显示，消息记录保留
+func (s *ConversationService) SetArchived(ctx context.Context, userID, conversationID int64, archived bool) (*models.Conversation, error) {
+	return s.updateColumns(ctx, userID, conversationID, map[string]interface{}{"is_archived": archived})
+}
+
+// updateColumns 更新会话的设置字段并返回最新会话
+func (s *ConversationService) updateColumns(ctx context.Context, userID, conversationID int64, columns map[string]interface{}) (*models.Conversation, error) {
+	result := s.db.WithContext(ctx).Model(&models.Conversation{}).
+		Where("id = ? AND user_id = ?", conversationID, userID).
+		Updates(columns)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	InvalidateConversationList(userID)
+
+	// 刚更新过，从主库读取最新会话
+	var conversation models.Conversation
+	if err := database.Primary(s.db.WithContext(ctx)).Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return nil, err
+	}
+	return s.withUnreadCount(ctx, &conversation)
+}
+
+// unreadRepairBatchSize 重新计算未读数时每批检查的会话数
+const unreadRepairBatchSize = 500
+
+// UnreadRepairResult 重新计算未读数的结果
+type UnreadRepairResult struct {
+	Conversations int // 检查的会话数
+	Repaired      int // 修正了最后消息或已读位置的会话数
+	Users         int // 删除了会话列表缓存的用户数
+}
+
+// RecomputeUnread 重新计算会话的未读数，userID为0时处理所有用户
+// 未读数按已读位置实时统计，这里修正漏更新的最后消息和超过会话最新消息的已读位置，
+// 再删除会话列表缓存，下次获取会话列表时重新统计；用于Redis故障或数据恢复后缓存与数据库不一致的情况
+func (s *ConversationService) RecomputeUnread(ctx context.Context, userID int64) (*UnreadRepairResult, error) {
+	result := &UnreadRepairResult{}
+	seen := make(map[int64]bool)
+	var lastID int64
+	for {
+		query := database.Primary(s.db.WithContext(ctx)).Where("id > ?", lastID)
+		if userID > 0 {
+			query = query.Where("user_id = ?", userID)
+		}
+		var batch []models.Conversation
+		if err := query.Order("id").Limit(unreadRepairBatchSize).Find(&batch).Error; err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+
+		var users []int64
+		for i := range batch {
+			lastID = batch[i].ID
+			result.Conversations++
+			repaired, err := s.repairConversation(ctx, &batch[i])
+			if err != nil {
+				return result, err
+			}
+			if repaired {
+				result.Repaired++
+			}
+			if !seen[batch[i].UserID] {
+				seen[batch[i].UserID] = true
+				users = append(users, batch[i].UserID)
+			}
+		}
+		InvalidateConversationList(users...)
+		result.Users += len(users)
+	}
+}
+
+// repairConversation 修正会话的最后消息和已读位置，返回是否有修改
+// 会话中没有消息（或已全部归档）时不修改；已退出的群不前移最后消息，避免会话重新排到前面
+func (s *ConversationService) repairConversation(ctx context.Context, conversation *models.Conversation) (bool, error) {
+	latest, err := latestMessageID(s.db.WithContext(ctx), conversation.UserID, conversation.TargetID, conversation.Type)
+	if err != nil || latest == 0 {
+		return false, err
+	}
+
+	updates := make(map[string]interface{})
+	if conversation.LastMsgID == nil || *conversation.LastMsgID < latest {
+		member := true
+		if conversation.Type == models.ConversationTypeGroup {
+			var count int64
+			err := database.Primary(s.db.WithContext(ctx)).Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", conversation.TargetID, conversation.UserID).
+				Count(&count).Error
+			if err != nil {
+				return false, err
+			}
+			member = count > 0
+		}
+		if member {
+			updates["last_msg_id"] = latest
+		}
+	}
+	if conversation.LastReadMsgID > latest {
+		updates["last_read_msg_id"] = latest
+	}
+	if len(updates) == 0 {
+		return false, nil
+	}
+	err = database.Primary(s.db.WithContext(ctx)).Model(&models.Conversation{}).Where("id = ?", conversation.ID).Updates(updates).Error
+	return err == nil, err
 }
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestUnreadCountFollowsReadPointer(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	require.NoError(t, NewFriendServiceWithDB(db).AddFriend(context.Background(), alice.ID, bob.ID))
+
+	messageService := NewMessageServiceWithDB(db)
+	conversationService := NewConversationServiceWithDB(db)
+	send := func(from, to *models.User) int64 {
+		id, err := messageService.SaveMessage(context.Background(), &models.Message{FromUserID: from.ID, ToUserID: &to.ID, Content: "hi", MsgType: models.MessageTypeText})
+		require.NoError(t, err)
+		return id
+	}
+	first := send(alice, bob)
+	second := send(alice, bob)
+	third := send(alice, bob)
+	send(bob, alice)
+
+	conversation, err := conversationService.GetConversation(context.Background(), bob.ID, alice.ID, models.ConversationTypePrivate)
+	require.NoError(t, err)
+	assert.Equal(t, 3, conversation.UnreadCount, "自己发送的消息不计入未读")
+
+	unread := func() int {
+		conversations, err := conversationService.GetConversations(context.Background(), bob.ID)
+		require.NoError(t, err)
+		require.Len(t, conversations, 1)
+		return conversations[0].UnreadCount
+	}
+
+	require.NoError(t, conversationService.MarkRead(context.Background(), bob.ID, conversation.ID, second))
+	assert.Equal(t, 1, unread())
+
+	// 已读位置不后退
+	require.NoError(t, conversationService.MarkRead(context.Background(), bob.ID, conversation.ID, first))
+	assert.Equal(t, 1, unread())
+
+	// 对所有人删除的消息不计入未读
+	require.NoError(t, messageService.DeleteMessage(context.Background(), alice.ID, third, DeleteScopeEveryone))
+	assert.Equal(t, 0, unread())
+
+	send(alice, bob)
+	assert.Equal(t, 1, unread())
+	require.NoError(t, conversationService.ClearUnreadCount(context.Background(), bob.ID, conversation.ID))
+	assert.Equal(t, 0, unread())
+
+	// 已读位置不能超过会话的最新消息
+	require.NoError(t, conversationService.MarkRead(context.Background(), bob.ID, conversation.ID, third+1000))
+	next := send(alice, bob)
+	conversation, err = conversationService.GetConversationByID(context.Background(), conversation.ID, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, conversation.UnreadCount)
+
+	require.NoError(t, messageService.MarkAsRead(context.Background(), bob.ID, next))
+	conversation, err = conversationService.GetConversationByID(context.Background(), conversation.ID, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, next, conversation.LastReadMsgID)
+	assert.Equal(t, 0, conversation.UnreadCount)
+}
+
+func TestNewGroupMemberStartsWithoutUnread(t *testing.T) {
+	db := newTestDB(t)
+	owner := createTestUser(t, db, "13800000001", "owner")
+	member := createTestUser(t, db, "13800000002", "member")
+
+	groupService := NewGroupServiceWithDB(db)
+	group, err := groupService.CreateGroupWithMembers(context.Background(), owner.ID, "group", nil)
+	require.NoError(t, err)
+
+	messageService := NewMessageServiceWithDB(db)
+	_, err = messageService.SaveMessage(context.Background(), &models.Message{FromUserID: owner.ID, GroupID: &group.ID, Content: "before", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	require.NoError(t, groupService.AddGroupMembers(context.Background(), group.ID, []int64{member.ID}))
+	_, err = messageService.SaveMessage(context.Background(), &models.Message{FromUserID: owner.ID, GroupID: &group.ID, Content: "after", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	conversation, err := NewConversationServiceWithDB(db).GetConversation(context.Background(), member.ID, group.ID, models.ConversationTypeGroup)
+	require.NoError(t, err)
+	assert.Equal(t, 1, conversation.UnreadCount)
+}
+
+func TestRecomputeUnreadRepairsConversations(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	ctx := context.Background()
+	require.NoError(t, NewFriendServiceWithDB(db).AddFriend(ctx, alice.ID, bob.ID))
+
+	messageService := NewMessageServiceWithDB(db)
+	conversationService := NewConversationServiceWithDB(db)
+	first, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hi", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	second, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hi", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	// 模拟漏更新的最后消息和超出最新消息的已读位置
+	conversation, err := conversationService.GetConversation(ctx, bob.ID, alice.ID, models.ConversationTypePrivate)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(conversation).Updates(map[string]interface{}{"last_msg_id": first, "last_read_msg_id": second + 1000}).Error)
+
+	result, err := conversationService.RecomputeUnread(ctx, 0)
+	require.NoError(t, err)
+	// 测试中消息没有经过发件箱更新会话，alice的会话缺少最后消息，同样被修正
+	assert.Equal(t, 2, result.Conversations)
+	assert.Equal(t, 2, result.Repaired)
+	assert.Equal(t, 2, result.Users)
+
+	conversation, err = conversationService.GetConversationByID(ctx, conversation.ID, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, second, *conversation.LastMsgID)
+	assert.Equal(t, second, conversation.LastReadMsgID)
+	assert.Equal(t, 0, conversation.UnreadCount)
+
+	// 修正后再次执行不再修改
+	result, err = conversationService.RecomputeUnread(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Conversations)
+	assert.Zero(t, result.Repaired)
+}
+
+func TestPinnedConversationsListedFirst(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	friendService := NewFriendServiceWithDB(db)
+	conversationService := NewConversationServiceWithDB(db)
+	ctx := context.Background()
+
+	ids := make(map[string]int64)
+	for phone, name := range map[string]string{"13800000002": "bob", "13800000003": "carol", "13800000004": "dave"} {
+		friend := createTestUser(t, db, phone, name)
+		require.NoError(t, friendService.AddFriend(ctx, alice.ID, friend.ID))
+		conversation, err := conversationService.CreateOrUpdateConversation(ctx, alice.ID, friend.ID, models.ConversationTypePrivate)
+		require.NoError(t, err)
+		ids[name] = conversation.ID
+	}
+	order := func() []string {
+		conversations, err := conversationService.GetConversations(ctx, alice.ID)
+		require.NoError(t, err)
+		names := make([]string, 0, len(conversations))
+		for _, conversation := range conversations {
+			names = append(names, conversation.TargetName)
+		}
+		return names
+	}
+	pin := func(name string, pinned bool) *models.Conversation {
+		conversation, err := conversationService.SetPinned(ctx, alice.ID, ids[name], pinned)
+		require.NoError(t, err)
+		return conversation
+	}
+
+	// 后置顶的排在前面，未置顶的会话排在置顶会话之后
+	pin("dave", true)
+	time.Sleep(10 * time.Millisecond)
+	conversation := pin("bob", true)
+	assert.True(t, conversation.IsPinned)
+	require.NotNil(t, conversation.PinnedAt)
+	assert.Equal(t, []string{"bob", "dave", "carol"}, order())
+
+	// 再次置顶移到最前面
+	time.Sleep(10 * time.Millisecond)
+	pin("dave", true)
+	assert.Equal(t, []string{"dave", "bob", "carol"}, order())
+
+	conversation = pin("dave", false)
+	assert.False(t, conversation.IsPinned)
+	assert.Nil(t, conversation.PinnedAt)
+	assert.Equal(t, "bob", order()[0])
+
+	// 不能修改其他用户的会话
+	_, err := conversationService.SetPinned(ctx, alice.ID+100, ids["bob"], false)
+	assert.Error(t, err)
+}
+
+func TestArchivedConversationUnarchivesOnIncomingMessage(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	ctx := context.Background()
+	require.NoError(t, NewFriendServiceWithDB(db).AddFriend(ctx, alice.ID, bob.ID))
+
+	messageService := NewMessageServiceWithDB(db)
+	conversationService := NewConversationServiceWithDB(db)
+	// 测试中消息没有经过发件箱，手动更新接收方和发送方的会话
+	send := func(from, to *models.User) {
+		id, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: from.ID, ToUserID: &to.ID, Content: "hi", MsgType: models.MessageTypeText})
+		require.NoError(t, err)
+		require.NoError(t, conversationService.UpdateLastMessage(ctx, from.ID, to.ID, id, "hi"))
+		require.NoError(t, conversationService.UpdateLastMessage(ctx, to.ID, from.ID, id, "hi"))
+	}
+	send(alice, bob)
+	conversation, err := conversationService.GetConversation(ctx, bob.ID, alice.ID, models.ConversationTypePrivate)
+	require.NoError(t, err)
+	archived := func() bool {
+		list, err := conversationService.GetConversations(ctx, bob.ID)
+		require.NoError(t, err)
+		archivedList, err := conversationService.GetArchivedConversations(ctx, bob.ID)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(list)+len(archivedList))
+		return len(archivedList) == 1
+	}
+
+	// 归档后只出现在归档列表中，消息记录保留
+	conversation, err = conversationService.SetArchived(ctx, bob.ID, conversation.ID, true)
+	require.NoError(t, err)
+	assert.True(t, conversation.IsArchived)
+	assert.True(t, archived())
+	assert.Equal(t, 1, conversation.UnreadCount)
+
+	// 自己发送的消息不取消归档，收到他人的消息时自动取消归档
+	send(bob, alice)
+	assert.True(t, archived())
+	send(alice, bob)
+	assert.False(t, archived())
+
+	// 关闭自动取消归档后保持归档
+	require.NoError(t, db.Model(bob).Update("keep_archived", true).Error)
+	_, err = conversationService.SetArchived(ctx, bob.ID, conversation.ID, true)
+	require.NoError(t, err)
+	send(alice, bob)
+	assert.True(t, archived())
+}
+
+func TestMuteUntilAndHideUnread(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	ctx := context.Background()
+	require.NoError(t, NewFriendServiceWithDB(db).AddFriend(ctx, alice.ID, bob.ID))
+
+	conversationService := NewConversationServiceWithDB(db)
+	_, err := NewMessageServiceWithDB(db).SaveMessage(ctx, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hi", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	conversation, err := conversationService.GetConversation(ctx, bob.ID, alice.ID, models.ConversationTypePrivate)
+	require.NoError(t, err)
+	listed := func() ConversationInfo {
+		conversations, err := conversationService.GetConversations(ctx, bob.ID)
+		require.NoError(t, err)
+		require.Len(t, conversations, 1)
+		return conversations[0]
+	}
+
+	// 免打扰期间不显示未读数
+	until := time.Now().Add(time.Hour)
+	conversation, err = conversationService.Mute(ctx, bob.ID, conversation.ID, &until, true)
+	require.NoError(t, err)
+	assert.True(t, conversation.IsMuted)
+	assert.Zero(t, conversation.UnreadCount)
+	info := listed()
+	assert.True(t, info.IsMuted)
+	require.NotNil(t, info.MutedUntil)
+	assert.WithinDuration(t, until, *info.MutedUntil, time.Second)
+	assert.Zero(t, info.UnreadCount)
+
+	// 到期后恢复，数据库中的设置不需要清除
+	require.NoError(t, db.Model(&models.Conversation{}).Where("id = ?", conversation.ID).Update("muted_until", time.Now().Add(-time.Minute)).Error)
+	info = listed()
+	assert.False(t, info.IsMuted)
+	assert.Nil(t, info.MutedUntil)
+	assert.Equal(t, 1, info.UnreadCount)
+	conversation, err = conversationService.GetConversationByID(ctx, conversation.ID, bob.ID)
+	require.NoError(t, err)
+	assert.False(t, conversation.IsMuted)
+	assert.Equal(t, 1, conversation.UnreadCount)
+
+	// 一直免打扰但照常显示未读数
+	conversation, err = conversationService.Mute(ctx, bob.ID, conversation.ID, nil, false)
+	require.NoError(t, err)
+	assert.True(t, conversation.IsMuted)
+	assert.Nil(t, conversation.MutedUntil)
+	assert.Equal(t, 1, listed().UnreadCount)
+
+	conversation, err = conversationService.Unmute(ctx, bob.ID, conversation.ID)
+	require.NoError(t, err)
+	assert.False(t, conversation.IsMuted)
+	assert.False(t, listed().IsMuted)
+}
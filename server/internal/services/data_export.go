@@ -0,0 +1,553 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+	"gochat/internal/objectstore"
+)
+
+// 数据导出状态
+const (
+	DataExportPending   = "pending"
+	DataExportRunning   = "running"
+	DataExportCompleted = "completed"
+	DataExportFailed    = "failed"
+	DataExportExpired   = "expired"
+)
+
+const (
+	// dataExportLease 运行中的导出超过该时长没有更新进度时视为所在实例已退出，可被重新领取
+	dataExportLease = 5 * time.Minute
+	// dataExportMaxAttempts 同一导出最多领取的次数，超过后标记为失败
+	dataExportMaxAttempts = 3
+	// exportMessageBatch 每批导出的消息条数，每批之后更新一次进度
+	exportMessageBatch = 1000
+	// exportFileBatch 每批导出的文件记录条数
+	exportFileBatch = 100
+)
+
+var (
+	ErrExportInProgress = errors.New("a data export is already in progress")
+	ErrExportNotReady   = errors.New("data export is not ready")
+	ErrExportExpired    = errors.New("data export has expired")
+)
+
+// ExportCooldownError 距上次申请导出的时间不足冷却时长
+type ExportCooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ExportCooldownError) Error() string {
+	return "a data export was requested recently"
+}
+
+type DataExportService struct {
+	db        *gorm.DB
+	dir       string
+	retention time.Duration
+	cooldown  time.Duration
+}
+
+func NewDataExportService(cfg *config.DataExportConfig) *DataExportService {
+	return NewDataExportServiceWithDB(database.GetDB(), cfg)
+}
+
+// NewDataExportServiceWithDB 创建数据导出服务（支持依赖注入）
+func NewDataExportServiceWithDB(db *gorm.DB, cfg *config.DataExportConfig) *DataExportService {
+	retention, err := time.ParseDuration(cfg.Retention)
+	if err != nil || retention <= 0 {
+		retention = 7 * 24 * time.Hour
+	}
+	cooldown, err := time.ParseDuration(cfg.Cooldown)
+	if err != nil || cooldown < 0 {
+		cooldown = 0
+	}
+	return &DataExportService{db: db, dir: cfg.Dir, retention: retention, cooldown: cooldown}
+}
+
+// Request 创建导出任务，由后台任务生成压缩包
+// 已有未完成的导出时返回ErrExportInProgress，距上次申请不足冷却时长时返回*ExportCooldownError（上次失败的除外）
+func (s *DataExportService) Request(ctx context.Context, userID int64) (*models.DataExport, error) {
+	db := database.Primary(s.db).WithContext(ctx)
+	var last models.DataExport
+	err := db.Where("user_id = ?", userID).Order("id DESC").First(&last).Error
+	switch {
+	case err == nil:
+		if last.Status == DataExportPending || last.Status == DataExportRunning {
+			return nil, ErrExportInProgress
+		}
+		if last.Status != DataExportFailed && s.cooldown > 0 {
+			if wait := time.Until(last.CreatedAt.Add(s.cooldown)); wait > 0 {
+				return nil, &ExportCooldownError{RetryAfter: wait}
+			}
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	export := &models.DataExport{UserID: userID, Status: DataExportPending}
+	if err := db.Create(export).Error; err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// Get 获取用户自己的导出任务，不存在或属于其他用户时返回gorm.ErrRecordNotFound
+func (s *DataExportService) Get(ctx context.Context, userID, exportID int64) (*models.DataExport, error) {
+	var export models.DataExport
+	err := database.Primary(s.db).WithContext(ctx).Where("id = ? AND user_id = ?", exportID, userID).First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// List 按时间倒序列出用户最近的导出任务
+func (s *DataExportService) List(ctx context.Context, userID int64, limit int) ([]models.DataExport, error) {
+	exports := []models.DataExport{}
+	err := database.Primary(s.db).WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&exports).Error
+	return exports, err
+}
+
+// Downloadable 获取可下载的导出任务，未完成时返回ErrExportNotReady，压缩包已删除时返回ErrExportExpired
+func (s *DataExportService) Downloadable(ctx context.Context, userID, exportID int64) (*models.DataExport, error) {
+	export, err := s.Get(ctx, userID, exportID)
+	if err != nil {
+		return nil, err
+	}
+	switch export.Status {
+	case DataExportCompleted:
+		if export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt) {
+			return nil, ErrExportExpired
+		}
+		return export, nil
+	case DataExportExpired:
+		return nil, ErrExportExpired
+	}
+	return nil, ErrExportNotReady
+}
+
+// ProcessPending 依次领取并生成待处理的导出，直到没有待处理的导出，返回完成的数量
+// 导出通过行级领取保证不会被多个实例同时处理；ctx取消时正在生成的导出保持running，租期过后重新领取
+func (s *DataExportService) ProcessPending(ctx context.Context) (int, error) {
+	completed := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return completed, err
+		}
+		export, err := s.claimNext(ctx)
+		if err != nil || export == nil {
+			return completed, err
+		}
+		if export.Attempts > dataExportMaxAttempts {
+			s.fail(ctx, export, errors.New("too many attempts"))
+			continue
+		}
+		ok, err := s.generate(ctx, export)
+		if err != nil {
+			return completed, err
+		}
+		if ok {
+			completed++
+		}
+	}
+}
+
+// claimNext 领取最早的待处理导出（或租期已过的运行中导出），没有时返回nil
+func (s *DataExportService) claimNext(ctx context.Context) (*models.DataExport, error) {
+	db := database.Primary(s.db).WithContext(ctx)
+	claimable := "status = ? OR (status = ? AND updated_at < ?)"
+	staleBefore := time.Now().Add(-dataExportLease)
+
+	var ids []int64
+	err := db.Model(&models.DataExport{}).
+		Where(claimable, DataExportPending, DataExportRunning, staleBefore).
+		Order("id").Limit(10).Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		// 条件不满足（已被其他实例领取）时影响行数为0
+		result := db.Model(&models.DataExport{}).
+			Where("id = ?", id).
+			Where(claimable, DataExportPending, DataExportRunning, staleBefore).
+			Updates(map[string]interface{}{
+				"status":     DataExportRunning,
+				"progress":   0,
+				"attempts":   gorm.Expr("attempts + 1"),
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		var export models.DataExport
+		if err := db.First(&export, id).Error; err != nil {
+			return nil, err
+		}
+		return &export, nil
+	}
+	return nil, nil
+}
+
+// generate 生成压缩包并标记完成；生成失败时标记为失败，只有ctx取消时返回错误
+func (s *DataExportService) generate(ctx context.Context, export *models.DataExport) (bool, error) {
+	start := time.Now()
+	path, size, remote, err := s.build(ctx, export)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		s.fail(ctx, export, err)
+		return false, nil
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.retention)
+	err = database.Primary(s.db).WithContext(ctx).Model(export).Updates(map[string]interface{}{
+		"status":       DataExportCompleted,
+		"progress":     100,
+		"file_size":    size,
+		"storage_path": path,
+		"remote":       remote,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	}).Error
+	if err != nil {
+		s.removeArchive(ctx, path, remote)
+		return false, err
+	}
+	logger.GetLogger().Infof("用户 %d 的数据导出 %d 已生成，大小 %d 字节，耗时 %v", export.UserID, export.ID, size, time.Since(start))
+	return true, nil
+}
+
+// fail 标记导出失败，错误信息只保留前500个字符
+func (s *DataExportService) fail(ctx context.Context, export *models.DataExport, cause error) {
+	logger.GetLogger().Errorf("用户 %d 的数据导出 %d 失败: %v", export.UserID, export.ID, cause)
+	message := cause.Error()
+	if len(message) > 500 {
+		message = message[:500]
+	}
+	err := database.Primary(s.db).WithContext(ctx).Model(export).Updates(map[string]interface{}{
+		"status": DataExportFailed,
+		"error":  message,
+	}).Error
+	if err != nil {
+		logger.GetLogger().Errorf("标记数据导出 %d 失败状态出错: %v", export.ID, err)
+	}
+}
+
+// setProgress 更新进度，同时为运行中的导出续租
+func (s *DataExportService) setProgress(ctx context.Context, export *models.DataExport, progress int) error {
+	return database.Primary(s.db).WithContext(ctx).Model(export).Updates(map[string]interface{}{
+		"progress":   progress,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// build 在临时文件中写入压缩包，配置了对象存储时上传后删除临时文件，否则移动到导出目录
+// 返回压缩包的本地路径或对象存储的键
+func (s *DataExportService) build(ctx context.Context, export *models.DataExport) (path string, size int64, remote bool, err error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", 0, false, err
+	}
+	tmp, err := os.CreateTemp(s.dir, "export-*.zip.tmp")
+	if err != nil {
+		return "", 0, false, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name()) // 已移动到导出目录时文件不存在
+	}()
+
+	digest := sha256.New()
+	zw := zip.NewWriter(io.MultiWriter(tmp, digest))
+	if err := s.writeArchive(ctx, zw, export); err != nil {
+		return "", 0, false, err
+	}
+	if err := zw.Close(); err != nil {
+		return "", 0, false, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return "", 0, false, err
+	}
+	size = info.Size()
+
+	if store := objectstore.Default(); store != nil {
+		key := fmt.Sprintf("exports/%d/%d.zip", export.UserID, export.ID)
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return "", 0, false, err
+		}
+		if err := store.PutObject(ctx, key, tmp, size, hexDigest(digest), "application/zip"); err != nil {
+			return "", 0, false, err
+		}
+		return key, size, true, nil
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", 0, false, err
+	}
+	path = filepath.Join(s.dir, fmt.Sprintf("%d-%d.zip", export.UserID, export.ID))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, false, err
+	}
+	return path, size, false, nil
+}
+
+func hexDigest(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// exportProfile 导出的个人资料，包括登录过的设备
+type exportProfile struct {
+	UserInfo
+	CreatedAt time.Time           `json:"created_at"`
+	Devices   []models.UserDevice `json:"devices"`
+}
+
+// exportGroup 导出的群组成员关系
+type exportGroup struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	IsOwner  bool      `json:"is_owner"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// exportMessage 导出的消息，archived表示已移入归档表
+type exportMessage struct {
+	ID         int64     `json:"id"`
+	FromUserID int64     `json:"from_user_id"`
+	ToUserID   *int64    `json:"to_user_id,omitempty"`
+	GroupID    *int64    `json:"group_id,omitempty"`
+	Content    string    `json:"content"`
+	MsgType    int       `json:"msg_type"`
+	CreatedAt  time.Time `json:"created_at"`
+	Archived   bool      `json:"archived"`
+}
+
+// writeArchive 依次写入profile.json、friends.json、groups.json、messages.jsonl和files.json并更新进度
+// 消息可能很多，按行写入JSON（每行一条），占进度的10%-90%
+func (s *DataExportService) writeArchive(ctx context.Context, zw *zip.Writer, export *models.DataExport) error {
+	db := s.db.WithContext(ctx)
+	userID := export.UserID
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return fmt.Errorf("load user: %w", err)
+	}
+	profile := exportProfile{
+		UserInfo: UserInfo{
+			ID:                  user.ID,
+			Phone:               user.Phone,
+			Nickname:            user.Nickname,
+			Avatar:              PublicURL(user.Avatar),
+			Gender:              user.Gender,
+			Signature:           user.Signature,
+			Email:               user.Email,
+			EmailSecurityAlerts: !user.EmailAlertsOptOut,
+			EmailDigest:         !user.EmailDigestOptOut,
+			UnarchiveOnMessage:  !user.KeepArchived,
+		},
+		CreatedAt: user.CreatedAt,
+		Devices:   []models.UserDevice{},
+	}
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&profile.Devices).Error; err != nil {
+		return fmt.Errorf("load devices: %w", err)
+	}
+	if err := writeJSONEntry(zw, "profile.json", profile); err != nil {
+		return err
+	}
+
+	friends, err := NewFriendServiceWithDB(s.db).GetFriends(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("load friends: %w", err)
+	}
+	if friends == nil {
+		friends = []FriendInfo{}
+	}
+	if err := writeJSONEntry(zw, "friends.json", friends); err != nil {
+		return err
+	}
+
+	groups := []exportGroup{}
+	err = db.Table(models.GroupMember{}.TableName()+" gm").
+		Select("g.id, g.name, g.owner_id = gm.user_id AS is_owner, gm.joined_at").
+		Joins("JOIN "+models.Group{}.TableName()+" g ON g.id = gm.group_id AND g.deleted_at IS NULL").
+		Where("gm.user_id = ?", userID).
+		Order("gm.joined_at").
+		Scan(&groups).Error
+	if err != nil {
+		return fmt.Errorf("load groups: %w", err)
+	}
+	if err := writeJSONEntry(zw, "groups.json", groups); err != nil {
+		return err
+	}
+	if err := s.setProgress(ctx, export, 10); err != nil {
+		return err
+	}
+
+	if err := s.writeMessages(ctx, zw, export); err != nil {
+		return err
+	}
+
+	files := []UserFileInfo{}
+	fileService := &FileService{db: s.db}
+	filter := FileListFilter{Limit: exportFileBatch}
+	for {
+		page, hasMore, err := fileService.ListUserFiles(ctx, userID, filter)
+		if err != nil {
+			return fmt.Errorf("load files: %w", err)
+		}
+		files = append(files, page...)
+		if !hasMore || len(page) == 0 {
+			break
+		}
+		filter.BeforeID = page[len(page)-1].ID
+	}
+	return writeJSONEntry(zw, "files.json", files)
+}
+
+// writeMessages 写入用户发送的消息和收到的单聊消息（包括归档的消息，不包括已对所有人删除的），按ID顺序
+func (s *DataExportService) writeMessages(ctx context.Context, zw *zip.Writer, export *models.DataExport) error {
+	db := s.db.WithContext(ctx)
+	userID := export.UserID
+	where := "(from_user_id = ? OR to_user_id = ?) AND id > ?"
+
+	var archivedCount, hotCount int64
+	if err := db.Model(&models.ArchivedMessage{}).Where(where, userID, userID, 0).Count(&archivedCount).Error; err != nil {
+		return fmt.Errorf("count messages: %w", err)
+	}
+	if err := db.Model(&models.Message{}).Where(where, userID, userID, 0).Count(&hotCount).Error; err != nil {
+		return fmt.Errorf("count messages: %w", err)
+	}
+	total := archivedCount + hotCount
+
+	w, err := zw.Create("messages.jsonl")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	written := int64(0)
+	progress := 10
+
+	// 先导出归档表中较早的消息，再导出热表
+	for _, archived := range []bool{true, false} {
+		model := interface{}(&models.Message{})
+		if archived {
+			model = &models.ArchivedMessage{}
+		}
+		afterID := int64(0)
+		for {
+			var batch []exportMessage
+			err := db.Model(model).
+				Select("id, from_user_id, to_user_id, group_id, content, msg_type, created_at").
+				Where(where, userID, userID, afterID).
+				Order("id").Limit(exportMessageBatch).
+				Scan(&batch).Error
+			if err != nil {
+				return fmt.Errorf("load messages: %w", err)
+			}
+			for i := range batch {
+				batch[i].Archived = archived
+				if err := encoder.Encode(&batch[i]); err != nil {
+					return err
+				}
+			}
+			written += int64(len(batch))
+			if total > 0 {
+				if next := 10 + int(80*min(written, total)/total); next > progress {
+					progress = next
+					if err := s.setProgress(ctx, export, progress); err != nil {
+						return err
+					}
+				}
+			}
+			if len(batch) < exportMessageBatch {
+				break
+			}
+			afterID = batch[len(batch)-1].ID
+		}
+	}
+	return s.setProgress(ctx, export, 90)
+}
+
+func writeJSONEntry(zw *zip.Writer, name string, value interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// PurgeExpired 删除过期导出的压缩包并标记为expired，返回处理的数量
+func (s *DataExportService) PurgeExpired(ctx context.Context) (int, error) {
+	var exports []models.DataExport
+	err := database.Primary(s.db).WithContext(ctx).
+		Where("status = ? AND expires_at < ?", DataExportCompleted, time.Now()).
+		Order("id").Limit(100).Find(&exports).Error
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for i := range exports {
+		export := &exports[i]
+		if !s.removeArchive(ctx, export.StoragePath, export.Remote) {
+			continue
+		}
+		err := database.Primary(s.db).WithContext(ctx).Model(export).Updates(map[string]interface{}{
+			"status":       DataExportExpired,
+			"storage_path": "",
+		}).Error
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// removeArchive 删除压缩包，文件已不存在视为成功；对象存储未配置或删除失败时返回false，下次重试
+func (s *DataExportService) removeArchive(ctx context.Context, path string, remote bool) bool {
+	if path == "" {
+		return true
+	}
+	if remote {
+		store := objectstore.Default()
+		if store == nil {
+			logger.GetLogger().Warnf("对象存储未配置，跳过删除数据导出: key=%s", path)
+			return false
+		}
+		if err := store.DeleteObject(ctx, path); err != nil {
+			logger.GetLogger().Warnf("删除数据导出失败: key=%s, error=%v", path, err)
+			return false
+		}
+		return true
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logger.GetLogger().Warnf("删除数据导出失败: path=%s, error=%v", path, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+func newTestDataExportService(t *testing.T, db *gorm.DB) *DataExportService {
+	t.Helper()
+	return NewDataExportServiceWithDB(db, &config.DataExportConfig{
+		Enabled:   true,
+		Dir:       t.TempDir(),
+		Retention: "168h",
+		Cooldown:  "24h",
+	})
+}
+
+func TestDataExportRequestLimits(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	exportService := newTestDataExportService(t, db)
+	ctx := context.Background()
+
+	export, err := exportService.Request(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, DataExportPending, export.Status)
+
+	_, err = exportService.Request(ctx, alice.ID)
+	assert.ErrorIs(t, err, ErrExportInProgress)
+
+	// 完成后冷却期内不能再次申请
+	require.NoError(t, db.Model(export).Update("status", DataExportCompleted).Error)
+	_, err = exportService.Request(ctx, alice.ID)
+	var cooldown *ExportCooldownError
+	require.True(t, errors.As(err, &cooldown))
+	assert.Greater(t, cooldown.RetryAfter, 23*time.Hour)
+
+	// 失败后可以立即重新申请
+	require.NoError(t, db.Model(export).Update("status", DataExportFailed).Error)
+	_, err = exportService.Request(ctx, alice.ID)
+	assert.NoError(t, err)
+}
+
+func TestDataExportProcessBuildsArchive(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+	require.NoError(t, db.Create([]*models.FriendRelation{
+		{UserID: alice.ID, FriendID: bob.ID},
+		{UserID: bob.ID, FriendID: alice.ID},
+	}).Error)
+	group := &models.Group{Name: "team", OwnerID: alice.ID, MemberCount: 2}
+	require.NoError(t, db.Create(group).Error)
+	require.NoError(t, db.Create([]*models.GroupMember{
+		{GroupID: group.ID, UserID: alice.ID},
+		{GroupID: group.ID, UserID: bob.ID},
+	}).Error)
+
+	messages := []*models.Message{
+		{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "sent", MsgType: models.MessageTypeText},
+		{FromUserID: bob.ID, ToUserID: &alice.ID, Content: "received", MsgType: models.MessageTypeText},
+		{FromUserID: bob.ID, ToUserID: &carol.ID, Content: "not mine", MsgType: models.MessageTypeText},
+		{FromUserID: alice.ID, GroupID: &group.ID, Content: "to group", MsgType: models.MessageTypeText},
+		{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "deleted", MsgType: models.MessageTypeText},
+	}
+	for _, message := range messages {
+		require.NoError(t, db.Create(message).Error)
+	}
+	require.NoError(t, db.Delete(messages[4]).Error)
+	require.NoError(t, db.Create(&models.ArchivedMessage{ID: 1000, FromUserID: bob.ID, ToUserID: &alice.ID, Content: "old", MsgType: models.MessageTypeText, ArchivedAt: time.Now()}).Error)
+
+	exportService := newTestDataExportService(t, db)
+	ctx := context.Background()
+	export, err := exportService.Request(ctx, alice.ID)
+	require.NoError(t, err)
+
+	_, err = exportService.Downloadable(ctx, alice.ID, export.ID)
+	assert.ErrorIs(t, err, ErrExportNotReady)
+
+	completed, err := exportService.ProcessPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, completed)
+
+	export, err = exportService.Downloadable(ctx, alice.ID, export.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, export.Progress)
+	assert.NotNil(t, export.ExpiresAt)
+	info, err := os.Stat(export.StoragePath)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), export.FileSize)
+
+	archive, err := zip.OpenReader(export.StoragePath)
+	require.NoError(t, err)
+	defer archive.Close()
+	entries := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		entries[file.Name] = file
+	}
+	require.Len(t, entries, 5)
+
+	var profile struct {
+		Nickname string `json:"nickname"`
+	}
+	readJSONEntry(t, entries["profile.json"], &profile)
+	assert.Equal(t, "alice", profile.Nickname)
+
+	var friends []struct {
+		Nickname string `json:"nickname"`
+	}
+	readJSONEntry(t, entries["friends.json"], &friends)
+	require.Len(t, friends, 1)
+	assert.Equal(t, "bob", friends[0].Nickname)
+
+	var groups []exportGroup
+	readJSONEntry(t, entries["groups.json"], &groups)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "team", groups[0].Name)
+	assert.True(t, groups[0].IsOwner)
+
+	reader, err := entries["messages.jsonl"].Open()
+	require.NoError(t, err)
+	defer reader.Close()
+	var contents []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var message exportMessage
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &message))
+		assert.Equal(t, message.Content == "old", message.Archived)
+		contents = append(contents, message.Content)
+	}
+	assert.Equal(t, []string{"old", "sent", "received", "to group"}, contents)
+
+	// 其他用户看不到别人的导出
+	_, err = exportService.Get(ctx, bob.ID, export.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestDataExportPurgeExpired(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	exportService := newTestDataExportService(t, db)
+	ctx := context.Background()
+
+	export, err := exportService.Request(ctx, alice.ID)
+	require.NoError(t, err)
+	_, err = exportService.ProcessPending(ctx)
+	require.NoError(t, err)
+	export, err = exportService.Get(ctx, alice.ID, export.ID)
+	require.NoError(t, err)
+
+	purged, err := exportService.PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	require.NoError(t, db.Model(export).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	_, err = exportService.Downloadable(ctx, alice.ID, export.ID)
+	assert.ErrorIs(t, err, ErrExportExpired)
+
+	purged, err = exportService.PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = os.Stat(export.StoragePath)
+	assert.True(t, os.IsNotExist(err))
+
+	export, err = exportService.Get(ctx, alice.ID, export.ID)
+	require.NoError(t, err)
+	assert.Equal(t, DataExportExpired, export.Status)
+}
+
+func TestDataExportReclaimsStaleJobs(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	exportService := newTestDataExportService(t, db)
+	ctx := context.Background()
+
+	// 运行中但租期未过的导出不会被重新领取
+	export := &models.DataExport{UserID: alice.ID, Status: DataExportRunning, Attempts: 1}
+	require.NoError(t, db.Create(export).Error)
+	completed, err := exportService.ProcessPending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, completed)
+
+	require.NoError(t, db.Model(export).UpdateColumn("updated_at", time.Now().Add(-dataExportLease-time.Minute)).Error)
+	completed, err = exportService.ProcessPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, completed)
+
+	// 超过最大领取次数后标记为失败
+	stale := &models.DataExport{UserID: alice.ID, Status: DataExportRunning, Attempts: dataExportMaxAttempts}
+	require.NoError(t, db.Create(stale).Error)
+	require.NoError(t, db.Model(stale).UpdateColumn("updated_at", time.Now().Add(-dataExportLease-time.Minute)).Error)
+	completed, err = exportService.ProcessPending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, completed)
+	stale, err = exportService.Get(ctx, alice.ID, stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, DataExportFailed, stale.Status)
+}
+
+func readJSONEntry(t *testing.T, file *zip.File, out interface{}) {
+	t.Helper()
+	require.NotNil(t, file)
+	reader, err := file.Open()
+	require.NoError(t, err)
+	defer reader.Close()
+	require.NoError(t, json.NewDecoder(reader).Decode(out))
+}
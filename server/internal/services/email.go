@@ -0,0 +1,399 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/mailer"
+	"gochat/internal/metrics"
+	"gochat/internal/models"
+)
+
+// EventEmail 邮件发件箱事件：发送失败时由发件箱中继重试
+const EventEmail = "email.send"
+
+// 邮件类型，同时是模板文件名（{kind}.tmpl）
+const (
+	EmailKindSecurityAlert = "security_alert" // 账号安全提醒，可退订
+	EmailKindLoginCode     = "login_code"     // 新设备登录验证码，不可退订
+	EmailKindDigest        = "digest"         // 离线消息摘要，可退订
+)
+
+const (
+	// emailDigestPrefix email:digest:{userID} 上次发送摘要时的未读数，未读数增加后才再次发送
+	emailDigestPrefix = "email:digest:"
+	// emailDigestTTL 摘要记录的过期时间
+	emailDigestTTL = 30 * 24 * time.Hour
+	// emailDigestBatchSize 发送摘要时每批查询的用户数
+	emailDigestBatchSize = 200
+	// emailPreviewLength 摘要中消息预览的最大字符数
+	emailPreviewLength = 50
+)
+
+//go:embed email_templates/*.tmpl
+var emailTemplatesFS embed.FS
+
+var emailKinds = []string{EmailKindSecurityAlert, EmailKindLoginCode, EmailKindDigest}
+
+var emailsSent = metrics.NewCounterVec("emails_sent_total", "邮件发送次数，result: success、error、expired", "kind", "result")
+
+// EmailEvent 邮件事件负载，入队时已渲染好，投递时只负责发送
+type EmailEvent struct {
+	UserID    int64  `json:"user_id"`
+	Kind      string `json:"kind"`
+	To        string `json:"to"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // 过期时间（毫秒时间戳），过期后不再发送（如验证码）
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// EmailDigest 离线消息摘要
+type EmailDigest struct {
+	Unread        int                  // 未读消息总数（不含免打扰会话）
+	Conversations []DigestConversation // 有未读消息的会话，最多max_items个
+	More          int                  // 未列出的有未读消息的会话数
+}
+
+// DigestConversation 摘要中的一个会话
+type DigestConversation struct {
+	Name        string
+	Unread      int
+	LastMessage string
+}
+
+// emailData 模板数据
+type emailData struct {
+	Nickname string
+	Alert    *SecurityAlertEvent
+	Digest   *EmailDigest
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(ctx context.Context, msg *mailer.Message) error
+}
+
+// EmailService 邮件通知服务
+type EmailService struct {
+	db             *gorm.DB
+	client         *redis.Client
+	mailer         Mailer
+	templates      map[string]*template.Template
+	digestMaxItems int
+}
+
+// emailService 全局邮件服务，未启用时为nil
+var emailService *EmailService
+
+// InitEmail 按配置初始化全局邮件服务并注册发件箱处理函数，未启用时不发送邮件
+func InitEmail(cfg *config.EmailConfig) error {
+	// 未启用时仍注册处理函数，丢弃之前遗留的邮件事件
+	RegisterOutboxHandler(EventEmail, deliverEmail)
+	if !cfg.Enabled {
+		emailService = nil
+		return nil
+	}
+	smtp, err := mailer.New(&cfg.SMTP, cfg.From)
+	if err != nil {
+		return err
+	}
+	service, err := NewEmailServiceWithMailer(database.GetDB(), cache.GetRedisClient(), cfg, smtp)
+	if err != nil {
+		return err
+	}
+	emailService = service
+	return nil
+}
+
+// GetEmailService 获取全局邮件服务，未启用时返回nil
+func GetEmailService() *EmailService {
+	return emailService
+}
+
+// NewEmailServiceWithMailer 创建邮件服务（支持依赖注入）
+func NewEmailServiceWithMailer(db *gorm.DB, client *redis.Client, cfg *config.EmailConfig, m Mailer) (*EmailService, error) {
+	templates, err := loadEmailTemplates(cfg.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+	return &EmailService{
+		db:             db,
+		client:         client,
+		mailer:         m,
+		templates:      templates,
+		digestMaxItems: cfg.Digest.MaxItems,
+	}, nil
+}
+
+// loadEmailTemplates 加载内置模板，dir中存在同名文件时使用自定义模板
+// 每个模板需要定义subject和body两部分
+func loadEmailTemplates(dir string) (map[string]*template.Template, error) {
+	funcs := template.FuncMap{
+		"datetime": func(millis int64) string {
+			return time.UnixMilli(millis).Format("2006-01-02 15:04:05 MST")
+		},
+	}
+	templates := make(map[string]*template.Template, len(emailKinds))
+	for _, kind := range emailKinds {
+		name := kind + ".tmpl"
+		tmpl := template.New(name).Funcs(funcs)
+		var err error
+		custom := ""
+		if dir != "" {
+			custom = filepath.Join(dir, name)
+			if _, statErr := os.Stat(custom); statErr != nil {
+				custom = ""
+			}
+		}
+		if custom != "" {
+			tmpl, err = tmpl.ParseFiles(custom)
+		} else {
+			tmpl, err = tmpl.ParseFS(emailTemplatesFS, "email_templates/"+name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse email template %s: %w", name, err)
+		}
+		if tmpl.Lookup("subject") == nil || tmpl.Lookup("body") == nil {
+			return nil, fmt.Errorf("email template %s must define subject and body", name)
+		}
+		templates[kind] = tmpl
+	}
+	return templates, nil
+}
+
+// render 渲染邮件主题和正文
+func (s *EmailService) render(kind string, data *emailData) (string, string, error) {
+	tmpl := s.templates[kind]
+	if tmpl == nil {
+		return "", "", fmt.Errorf("unknown email kind %s", kind)
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(body.String()) + "\n", nil
+}
+
+// enqueue 渲染邮件并写入发件箱，用户没有邮箱或已退订该类邮件时返回nil
+func (s *EmailService) enqueue(ctx context.Context, user *models.User, kind string, data *emailData, expiresAt int64) (*models.OutboxEvent, error) {
+	if user.Email == "" {
+		return nil, nil
+	}
+	if (kind == EmailKindSecurityAlert && user.EmailAlertsOptOut) || (kind == EmailKindDigest && user.EmailDigestOptOut) {
+		return nil, nil
+	}
+	data.Nickname = user.Nickname
+	subject, body, err := s.render(kind, data)
+	if err != nil {
+		return nil, err
+	}
+	return enqueueOutboxEvent(s.db.WithContext(ctx), EventEmail, user.ID, &EmailEvent{
+		UserID:    user.ID,
+		Kind:      kind,
+		To:        user.Email,
+		Subject:   subject,
+		Body:      body,
+		ExpiresAt: expiresAt,
+		RequestID: logger.RequestIDFrom(ctx),
+	})
+}
+
+// queueSecurityAlertEmail 把安全提醒（含登录验证码）写入邮件队列，并在后台立即投递，不阻塞登录请求
+func queueSecurityAlertEmail(ctx context.Context, alert *SecurityAlertEvent) {
+	s := emailService
+	if s == nil {
+		return
+	}
+	kind, expiresAt := EmailKindSecurityAlert, int64(0)
+	if alert.Type == SecurityAlertLoginCode {
+		kind, expiresAt = EmailKindLoginCode, alert.ExpiresAt
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Select("id", "nickname", "email", "email_alerts_opt_out", "email_digest_opt_out").
+		First(&user, alert.UserID).Error
+	if err != nil {
+		logger.WithContext(ctx).Errorf("查询用户 %d 的邮箱失败: %v", alert.UserID, err)
+		return
+	}
+	event, err := s.enqueue(ctx, &user, kind, &emailData{Alert: alert}, expiresAt)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("写入用户 %d 的%s邮件失败: %v", alert.UserID, kind, err)
+		return
+	}
+	if event == nil {
+		return
+	}
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		if _, err := NewOutboxServiceWithDB(s.db).Publish(ctx, event.ID); err != nil {
+			logger.WithContext(ctx).Warnf("用户 %d 的%s邮件发送失败，等待发件箱中继重试: %v", alert.UserID, kind, err)
+		}
+	}()
+}
+
+// deliverEmail 发件箱处理函数：发送邮件，失败时返回错误由中继重试
+func deliverEmail(ctx context.Context, event *models.OutboxEvent) error {
+	var payload EmailEvent
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		// 负载损坏无法通过重试恢复，记录后丢弃
+		logger.GetLogger().Errorf("发件箱事件 %d 负载无效: %v", event.ID, err)
+		return nil
+	}
+	if payload.RequestID != "" && logger.RequestIDFrom(ctx) == "" {
+		ctx = logger.WithRequestID(ctx, payload.RequestID)
+	}
+	s := emailService
+	if s == nil {
+		logger.WithContext(ctx).Warnf("邮件通知未启用，丢弃发给用户 %d 的%s邮件", payload.UserID, payload.Kind)
+		return nil
+	}
+	return s.deliver(ctx, &payload)
+}
+
+// deliver 发送一封邮件，已过期的邮件直接丢弃
+func (s *EmailService) deliver(ctx context.Context, payload *EmailEvent) error {
+	if payload.ExpiresAt > 0 && time.Now().UnixMilli() >= payload.ExpiresAt {
+		emailsSent.WithLabelValues(payload.Kind, "expired").Inc()
+		return nil
+	}
+	err := s.mailer.Send(ctx, &mailer.Message{To: payload.To, Subject: payload.Subject, Body: payload.Body})
+	if err != nil {
+		emailsSent.WithLabelValues(payload.Kind, "error").Inc()
+		return fmt.Errorf("send %s email to user %d: %w", payload.Kind, payload.UserID, err)
+	}
+	emailsSent.WithLabelValues(payload.Kind, "success").Inc()
+	return nil
+}
+
+// SendDigests 给不在线且有未读消息的用户发送离线消息摘要，返回发送的邮件数
+// 免打扰会话不计入；同一用户只有未读数比上次发送时增加才会再次发送，未读清零后重新计算
+func (s *EmailService) SendDigests(ctx context.Context) (int, error) {
+	if s == nil || s.client == nil {
+		return 0, nil
+	}
+	var users []models.User
+	sent := 0
+	err := s.db.WithContext(ctx).
+		Select("id", "nickname", "email", "email_alerts_opt_out", "email_digest_opt_out").
+		Where("email <> '' AND email_digest_opt_out = ?", false).
+		FindInBatches(&users, emailDigestBatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range users {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				ok, err := s.sendDigest(ctx, &users[i])
+				if err != nil {
+					logger.WithContext(ctx).Warnf("发送用户 %d 的消息摘要失败: %v", users[i].ID, err)
+					continue
+				}
+				if ok {
+					sent++
+				}
+			}
+			return nil
+		}).Error
+	return sent, err
+}
+
+// sendDigest 给一个用户发送消息摘要，不需要发送时返回false
+func (s *EmailService) sendDigest(ctx context.Context, user *models.User) (bool, error) {
+	userKey := strconv.FormatInt(user.ID, 10)
+	online, err := s.client.Exists(ctx, cache.UserOnlinePrefix+userKey).Result()
+	if err != nil {
+		return false, err
+	}
+	if online > 0 {
+		return false, nil
+	}
+
+	// 已归档的会话不计入摘要
+	conversations, err := NewConversationServiceWithDB(s.db).queryConversations(ctx, user.ID, false)
+	if err != nil {
+		return false, err
+	}
+	digest := &EmailDigest{}
+	now := time.Now()
+	for _, conv := range conversations {
+		conv.applyMute(now)
+		if conv.IsMuted || conv.UnreadCount == 0 {
+			continue
+		}
+		digest.Unread += conv.UnreadCount
+		if len(digest.Conversations) >= s.digestMaxItems {
+			digest.More++
+			continue
+		}
+		digest.Conversations = append(digest.Conversations, DigestConversation{
+			Name:        conv.TargetName,
+			Unread:      conv.UnreadCount,
+			LastMessage: digestPreview(conv.LastMsgType, conv.LastMsgContent),
+		})
+	}
+
+	key := emailDigestPrefix + userKey
+	if digest.Unread == 0 {
+		return false, s.client.Del(ctx, key).Err()
+	}
+	last, err := s.client.Get(ctx, key).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return false, err
+	}
+	if digest.Unread <= last {
+		return false, nil
+	}
+
+	event, err := s.enqueue(ctx, user, EmailKindDigest, &emailData{Digest: digest}, 0)
+	if err != nil || event == nil {
+		return false, err
+	}
+	if err := s.client.Set(ctx, key, digest.Unread, emailDigestTTL).Err(); err != nil {
+		return false, err
+	}
+	if _, err := NewOutboxServiceWithDB(s.db).Publish(ctx, event.ID); err != nil {
+		logger.WithContext(ctx).Warnf("用户 %d 的消息摘要发送失败，等待发件箱中继重试: %v", user.ID, err)
+	}
+	return true, nil
+}
+
+// digestPreview 摘要中的消息预览，非文本消息只显示类型
+func digestPreview(msgType int, content string) string {
+	switch msgType {
+	case models.MessageTypeImage:
+		return "[图片]"
+	case models.MessageTypeVoice:
+		return "[语音]"
+	case models.MessageTypeVideo:
+		return "[视频]"
+	case models.MessageTypeFile:
+		return "[文件]"
+	case models.MessageTypeCall:
+		return "[未接来电]"
+	}
+	preview := []rune(strings.Join(strings.Fields(content), " "))
+	if len(preview) > emailPreviewLength {
+		return string(preview[:emailPreviewLength]) + "…"
+	}
+	return string(preview)
+}
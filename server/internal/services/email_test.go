@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/mailer"
+	"gochat/internal/models"
+)
+
+// fakeMailer 记录发送的邮件，err不为nil时发送失败
+type fakeMailer struct {
+	mutex    sync.Mutex
+	messages []*mailer.Message
+	err      error
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *fakeMailer) Messages() []*mailer.Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]*mailer.Message(nil), m.messages...)
+}
+
+var registerEmailHandler sync.Once
+
+// newTestEmailService 创建使用fakeMailer的邮件服务并设为全局邮件服务
+func newTestEmailService(t *testing.T, db *gorm.DB, client *redis.Client) (*EmailService, *fakeMailer) {
+	t.Helper()
+	registerEmailHandler.Do(func() { RegisterOutboxHandler(EventEmail, deliverEmail) })
+	m := &fakeMailer{}
+	s, err := NewEmailServiceWithMailer(db, client, &config.EmailConfig{Digest: config.EmailDigestConfig{MaxItems: 5}}, m)
+	require.NoError(t, err)
+	emailService = s
+	t.Cleanup(func() { emailService = nil })
+	return s, m
+}
+
+func createTestUserWithEmail(t *testing.T, db *gorm.DB, phone, nickname, email string) *models.User {
+	t.Helper()
+	user := createTestUser(t, db, phone, nickname)
+	require.NoError(t, db.Model(user).Update("email", email).Error)
+	user.Email = email
+	return user
+}
+
+func TestSecurityAlertEmailRespectsOptOut(t *testing.T) {
+	db := newTestDB(t)
+	_, m := newTestEmailService(t, db, nil)
+	alice := createTestUserWithEmail(t, db, "13800000001", "alice", "alice@example.com")
+	bob := createTestUserWithEmail(t, db, "13800000002", "bob", "bob@example.com")
+	require.NoError(t, db.Model(bob).Update("email_alerts_opt_out", true).Error)
+	carol := createTestUser(t, db, "13800000003", "carol")
+
+	ctx := context.Background()
+	for _, user := range []*models.User{alice, bob, carol} {
+		publishSecurityAlert(ctx, db, &SecurityAlertEvent{UserID: user.ID, Type: SecurityAlertNewDeviceLogin, IP: "203.0.113.7", Region: "上海"})
+	}
+	// 退订安全提醒后仍会收到登录验证码
+	publishSecurityAlert(ctx, db, &SecurityAlertEvent{UserID: bob.ID, Type: SecurityAlertLoginCode, Code: "482913", ExpiresAt: time.Now().Add(5 * time.Minute).UnixMilli()})
+
+	// 邮件在后台投递，等待投递完成后再检查
+	require.Eventually(t, func() bool {
+		var published int64
+		db.Model(&models.OutboxEvent{}).Where("event_type = ? AND published_at IS NOT NULL", EventEmail).Count(&published)
+		return published == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	messages := m.Messages()
+	require.Len(t, messages, 2)
+	byRecipient := map[string]*mailer.Message{}
+	for _, msg := range messages {
+		byRecipient[msg.To] = msg
+	}
+	assert.Equal(t, "GoChat账号在新设备上登录", byRecipient["alice@example.com"].Subject)
+	assert.Contains(t, byRecipient["alice@example.com"].Body, "alice，您好")
+	assert.Contains(t, byRecipient["alice@example.com"].Body, "IP：203.0.113.7")
+	assert.Contains(t, byRecipient["alice@example.com"].Body, "地区：上海")
+	assert.Equal(t, "GoChat登录验证码：482913", byRecipient["bob@example.com"].Subject)
+	assert.Contains(t, byRecipient["bob@example.com"].Body, "    482913\n")
+}
+
+func TestEmailDeliverDropsExpiredAndReturnsSendErrors(t *testing.T) {
+	db := newTestDB(t)
+	s, m := newTestEmailService(t, db, nil)
+	ctx := context.Background()
+
+	expired := &EmailEvent{UserID: 1, Kind: EmailKindLoginCode, To: "alice@example.com", Subject: "code", Body: "code", ExpiresAt: time.Now().Add(-time.Second).UnixMilli()}
+	require.NoError(t, s.deliver(ctx, expired))
+	assert.Empty(t, m.Messages())
+
+	m.err = errors.New("421 service not available")
+	err := s.deliver(ctx, &EmailEvent{UserID: 1, Kind: EmailKindSecurityAlert, To: "alice@example.com", Subject: "alert", Body: "alert"})
+	assert.ErrorIs(t, err, m.err)
+}
+
+func TestEmailTemplatesOverride(t *testing.T) {
+	dir := t.TempDir()
+	custom := `{{define "subject"}}[{{.Digest.Unread}}] unread{{end}}{{define "body"}}Hi {{.Nickname}}{{end}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "digest.tmpl"), []byte(custom), 0o644))
+
+	s, err := NewEmailServiceWithMailer(nil, nil, &config.EmailConfig{TemplatesDir: dir}, &fakeMailer{})
+	require.NoError(t, err)
+	subject, body, err := s.render(EmailKindDigest, &emailData{Nickname: "alice", Digest: &EmailDigest{Unread: 3}})
+	require.NoError(t, err)
+	assert.Equal(t, "[3] unread", subject)
+	assert.Equal(t, "Hi alice\n", body)
+
+	// 未覆盖的模板使用内置模板
+	subject, _, err = s.render(EmailKindLoginCode, &emailData{Alert: &SecurityAlertEvent{Code: "123456"}})
+	require.NoError(t, err)
+	assert.Equal(t, "GoChat登录验证码：123456", subject)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "login_code.tmpl"), []byte(`{{define "subject"}}code{{end}}`), 0o644))
+	_, err = NewEmailServiceWithMailer(nil, nil, &config.EmailConfig{TemplatesDir: dir}, &fakeMailer{})
+	assert.Error(t, err)
+}
+
+func TestSendDigests(t *testing.T) {
+	db := newTestDB(t)
+	client, mr := newTestRedis(t)
+	s, m := newTestEmailService(t, db, client)
+	ctx := context.Background()
+
+	alice := createTestUserWithEmail(t, db, "13800000001", "alice", "alice@example.com")
+	bob := createTestUserWithEmail(t, db, "13800000002", "bob", "bob@example.com")
+	carol := createTestUserWithEmail(t, db, "13800000003", "carol", "carol@example.com")
+	require.NoError(t, db.Model(carol).Update("email_digest_opt_out", true).Error)
+
+	messageService := NewMessageServiceWithDB(db)
+	conversationService := NewConversationServiceWithDB(db)
+	send := func(from, to *models.User, content string) {
+		id, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: from.ID, ToUserID: &to.ID, Content: content, MsgType: models.MessageTypeText})
+		require.NoError(t, err)
+		require.NoError(t, conversationService.UpdateLastMessage(ctx, to.ID, from.ID, id, content))
+	}
+	send(bob, alice, "hi")
+	send(bob, alice, "在吗？\n晚上一起吃饭")
+	send(alice, carol, "hello")
+	send(alice, bob, "hello")
+
+	// 免打扰的群聊不计入
+	group, err := NewGroupServiceWithDB(db).CreateGroupWithMembers(ctx, bob.ID, "team", []int64{alice.ID})
+	require.NoError(t, err)
+	groupMsgID, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: bob.ID, GroupID: &group.ID, Content: "group", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	require.NoError(t, conversationService.UpdateLastMessage(ctx, alice.ID, group.ID, groupMsgID, "group"))
+	require.NoError(t, db.Model(&models.Conversation{}).Where("user_id = ? AND target_id = ?", alice.ID, group.ID).Update("is_muted", true).Error)
+
+	// bob在线，carol退订了摘要
+	mr.Set("user:online:"+strconv.FormatInt(bob.ID, 10), "1")
+
+	sent, err := s.SendDigests(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	messages := m.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "alice@example.com", messages[0].To)
+	assert.Equal(t, "您在GoChat有2条未读消息", messages[0].Subject)
+	assert.Contains(t, messages[0].Body, "- bob（2条）：在吗？ 晚上一起吃饭\n")
+	assert.NotContains(t, messages[0].Body, "team")
+
+	// 未读数没有增加时不重复发送
+	sent, err = s.SendDigests(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	send(bob, alice, "?")
+	sent, err = s.SendDigests(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, "您在GoChat有3条未读消息", m.Messages()[1].Subject)
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/eventbus"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/models"
+)
+
+// EventDomainEvent 领域事件：由发件箱中继发布到事件总线，未配置总线时投递给进程内订阅者
+const EventDomainEvent = "domain.event"
+
+// 领域事件类型，发布到总线时的主题为"{topic_prefix}.{类型}"
+const (
+	DomainMessageSent    = "message.sent"    // 消息已保存
+	DomainUserRegistered = "user.registered" // 用户注册成功
+	DomainGroupCreated   = "group.created"   // 群组创建成功
+)
+
+var domainEventsPublished = metrics.NewCounterVec("domain_events_published_total", "领域事件发布次数，result: success、error、local（进程内投递）", "type", "result")
+
+var (
+	// eventBus 外部事件总线，未配置时为nil
+	eventBus eventbus.Publisher
+	// eventBusTopicPrefix 事件总线主题前缀
+	eventBusTopicPrefix string
+
+	domainSubscribersMu sync.RWMutex
+	domainSubscribers   = make(map[string][]DomainEventHandler)
+)
+
+// DomainEvent 发布到事件总线的事件，ID为发件箱事件ID，消费者可据此去重
+type DomainEvent struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID int64           `json:"aggregate_id"`
+	OccurredAt  int64           `json:"occurred_at"` // 事件发生时间（毫秒时间戳）
+	Data        json.RawMessage `json:"data"`
+}
+
+// MessageSentData 消息已保存事件数据
+type MessageSentData struct {
+	MessageID  int64  `json:"message_id"`
+	FromUserID int64  `json:"from_user_id"`
+	ToUserID   *int64 `json:"to_user_id,omitempty"`
+	GroupID    *int64 `json:"group_id,omitempty"`
+	MsgType    int    `json:"msg_type"`
+	Content    string `json:"content"`
+	CreatedAt  int64  `json:"created_at"` // 毫秒时间戳
+}
+
+// UserRegisteredData 用户注册事件数据
+type UserRegisteredData struct {
+	UserID    int64  `json:"user_id"`
+	Nickname  string `json:"nickname"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// GroupCreatedData 群组创建事件数据，member_ids包含群主
+type GroupCreatedData struct {
+	GroupID   int64   `json:"group_id"`
+	Name      string  `json:"name"`
+	OwnerID   int64   `json:"owner_id"`
+	MemberIDs []int64 `json:"member_ids"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+// DomainEventHandler 进程内订阅者，返回错误时事件稍后重试（至少一次语义）
+type DomainEventHandler func(ctx context.Context, event *DomainEvent) error
+
+// SubscribeDomainEvent 注册进程内订阅者，只在未配置事件总线时调用；配置总线后应改为订阅总线主题
+func SubscribeDomainEvent(eventType string, handler DomainEventHandler) {
+	domainSubscribersMu.Lock()
+	defer domainSubscribersMu.Unlock()
+	domainSubscribers[eventType] = append(domainSubscribers[eventType], handler)
+}
+
+// InitEventBus 按配置连接事件总线并注册发件箱处理函数
+func InitEventBus(cfg *config.EventBusConfig) error {
+	// 未配置总线时仍注册处理函数，投递给进程内订阅者或丢弃遗留事件
+	RegisterOutboxHandler(EventDomainEvent, publishDomainEvent)
+	publisher, err := eventbus.New(cfg)
+	if err != nil {
+		return err
+	}
+	eventBus = publisher
+	eventBusTopicPrefix = cfg.TopicPrefix
+	return nil
+}
+
+// CloseEventBus 关闭事件总线连接
+func CloseEventBus() {
+	if eventBus != nil {
+		if err := eventBus.Close(); err != nil {
+			logger.GetLogger().Warnf("关闭事件总线失败: %v", err)
+		}
+	}
+}
+
+// domainEventWanted 是否需要记录该类型的事件：配置了事件总线，或有进程内订阅者
+func domainEventWanted(eventType string) bool {
+	if eventBus != nil {
+		return true
+	}
+	domainSubscribersMu.RLock()
+	defer domainSubscribersMu.RUnlock()
+	return len(domainSubscribers[eventType]) > 0
+}
+
+// enqueueDomainEvent 在业务事务中写入领域事件，事件与业务数据一起提交，由中继发布
+// 既没有事件总线也没有订阅者时不写入
+func enqueueDomainEvent(tx *gorm.DB, eventType string, aggregateID int64, data interface{}) error {
+	if !domainEventWanted(eventType) {
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = enqueueRelayedOutboxEvent(tx, EventDomainEvent, aggregateID, DomainEvent{
+		Type:        eventType,
+		AggregateID: aggregateID,
+		OccurredAt:  time.Now().UnixMilli(),
+		Data:        raw,
+	})
+	return err
+}
+
+// publishDomainEvent 发件箱处理函数：发布到"{topic_prefix}.{类型}"，以聚合ID为key保证同一对象的事件有序
+// 未配置事件总线时依次调用进程内订阅者
+func publishDomainEvent(ctx context.Context, outboxEvent *models.OutboxEvent) error {
+	var event DomainEvent
+	if err := json.Unmarshal([]byte(outboxEvent.Payload), &event); err != nil {
+		logger.GetLogger().Errorf("发件箱事件 %d 负载无效: %v", outboxEvent.ID, err)
+		return nil
+	}
+	event.ID = outboxEvent.ID
+
+	publisher := eventBus
+	if publisher == nil {
+		domainSubscribersMu.RLock()
+		handlers := domainSubscribers[event.Type]
+		domainSubscribersMu.RUnlock()
+		for _, handler := range handlers {
+			if err := handler(ctx, &event); err != nil {
+				return err
+			}
+		}
+		domainEventsPublished.WithLabelValues(event.Type, "local").Inc()
+		return nil
+	}
+
+	data, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+	topic := event.Type
+	if eventBusTopicPrefix != "" {
+		topic = eventBusTopicPrefix + "." + event.Type
+	}
+	if err := publisher.Publish(ctx, topic, strconv.FormatInt(event.AggregateID, 10), data); err != nil {
+		domainEventsPublished.WithLabelValues(event.Type, "error").Inc()
+		return err
+	}
+	domainEventsPublished.WithLabelValues(event.Type, "success").Inc()
+	return nil
+}
+
+// messageSentData 由消息生成消息已保存事件数据
+func messageSentData(msg *models.Message) MessageSentData {
+	return MessageSentData{
+		MessageID:  msg.ID,
+		FromUserID: msg.FromUserID,
+		ToUserID:   msg.ToUserID,
+		GroupID:    msg.GroupID,
+		MsgType:    msg.MsgType,
+		Content:    msg.Content,
+		CreatedAt:  msg.CreatedAt.UnixMilli(),
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/models"
+)
+
+// recordingPublisher 记录发布的事件，err不为空时发布失败
+type recordingPublisher struct {
+	topics []string
+	keys   []string
+	events []DomainEvent
+	err    error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, topic, key string, data []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	var event DomainEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	p.topics = append(p.topics, topic)
+	p.keys = append(p.keys, key)
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+// publishTestDomainEvents 依次发布数据库中的领域事件，返回发布失败的事件数
+func publishTestDomainEvents(t *testing.T, db *gorm.DB) int {
+	t.Helper()
+	var events []models.OutboxEvent
+	require.NoError(t, db.Where("event_type = ?", EventDomainEvent).Order("id").Find(&events).Error)
+	failed := 0
+	for i := range events {
+		if err := publishDomainEvent(context.Background(), &events[i]); err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+func TestDomainEventsPublishedToEventBus(t *testing.T) {
+	db := newTestDB(t)
+	publisher := &recordingPublisher{}
+	eventBus, eventBusTopicPrefix = publisher, "gochat"
+	t.Cleanup(func() { eventBus, eventBusTopicPrefix = nil, "" })
+
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	group, err := NewGroupServiceWithDB(db).CreateGroupWithMembers(context.Background(), alice.ID, "team", []int64{alice.ID, bob.ID})
+	require.NoError(t, err)
+	msgID, err := NewMessageServiceWithDB(db).SaveMessage(context.Background(), &models.Message{
+		FromUserID: alice.ID, GroupID: &group.ID, Content: "hello", MsgType: models.MessageTypeText,
+	})
+	require.NoError(t, err)
+
+	assert.Zero(t, publishTestDomainEvents(t, db))
+	assert.Equal(t, []string{"gochat.group.created", "gochat.message.sent"}, publisher.topics)
+	require.Len(t, publisher.events, 2)
+
+	created := publisher.events[0]
+	assert.NotZero(t, created.ID)
+	assert.Equal(t, DomainGroupCreated, created.Type)
+	var groupData GroupCreatedData
+	require.NoError(t, json.Unmarshal(created.Data, &groupData))
+	assert.Equal(t, group.ID, groupData.GroupID)
+	assert.Equal(t, []int64{alice.ID, bob.ID}, groupData.MemberIDs)
+
+	sent := publisher.events[1]
+	assert.Equal(t, msgID, sent.AggregateID)
+	assert.Equal(t, strconv.FormatInt(msgID, 10), publisher.keys[1])
+	var messageData MessageSentData
+	require.NoError(t, json.Unmarshal(sent.Data, &messageData))
+	assert.Equal(t, "hello", messageData.Content)
+	assert.Equal(t, &group.ID, messageData.GroupID)
+
+	// 总线不可用时返回错误，事件由发件箱稍后重试
+	publisher.err = errors.New("broker unavailable")
+	assert.Equal(t, 2, publishTestDomainEvents(t, db))
+}
+
+func TestDomainEventsLocalFallback(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+
+	// 没有总线也没有订阅者时不写入事件
+	_, err := NewGroupServiceWithDB(db).CreateGroupWithMembers(context.Background(), alice.ID, "empty", nil)
+	require.NoError(t, err)
+	var count int64
+	require.NoError(t, db.Model(&models.OutboxEvent{}).Where("event_type = ?", EventDomainEvent).Count(&count).Error)
+	assert.Zero(t, count)
+
+	var received []*DomainEvent
+	SubscribeDomainEvent(DomainGroupCreated, func(ctx context.Context, event *DomainEvent) error {
+		received = append(received, event)
+		return nil
+	})
+	t.Cleanup(func() {
+		domainSubscribersMu.Lock()
+		delete(domainSubscribers, DomainGroupCreated)
+		domainSubscribersMu.Unlock()
+	})
+
+	group, err := NewGroupServiceWithDB(db).CreateGroupWithMembers(context.Background(), alice.ID, "team", []int64{bob.ID})
+	require.NoError(t, err)
+	// 没有订阅者的事件类型仍不写入
+	_, err = NewMessageServiceWithDB(db).SaveMessage(context.Background(), &models.Message{
+		FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hi", MsgType: models.MessageTypeText,
+	})
+	require.NoError(t, err)
+
+	assert.Zero(t, publishTestDomainEvents(t, db))
+	require.Len(t, received, 1)
+	assert.Equal(t, DomainGroupCreated, received[0].Type)
+	assert.Equal(t, group.ID, received[0].AggregateID)
+}
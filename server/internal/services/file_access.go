@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/models"
+)
+
+// refTypeMessage 图片/语音/视频/文件消息对文件的引用，RefID为消息ID
+const refTypeMessage = "message"
+
+// storedFileHash 从消息内容（本服务存储的文件URL）中解析文件哈希
+func storedFileHash(content string) (string, bool) {
+	storagePath := strings.TrimPrefix(content, "/")
+	if !strings.HasPrefix(storagePath, FileStorageDir+"/") {
+		return "", false
+	}
+	name := filepath.Base(storagePath)
+	hash := strings.TrimSuffix(name, filepath.Ext(name))
+	if len(hash) != sha256.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	return hash, true
+}
+
+// errMessageFileDenied 消息引用了发送者无权访问的文件
+var errMessageFileDenied = RejectMessage("file not found or not accessible")
+
+// linkMessageFile 记录图片/语音/视频/文件消息引用的文件，下载时据此校验会话成员身份，文件消息同时记录原始文件名
+// 发送者必须能访问该文件（本人上传或秒传，或所在会话中的消息引用了该文件），否则拒绝消息，避免只凭URL获得下载权限
+// 内容不是本服务存储的文件时忽略
+func linkMessageFile(tx *gorm.DB, msg *models.Message) error {
+	var fileURL, fileName string
+	switch msg.MsgType {
+	case models.MessageTypeImage, models.MessageTypeVoice, models.MessageTypeVideo:
+		fileURL = msg.Content
+	case models.MessageTypeFile:
+		fm, ok := ParseFileMessage(msg.Content)
+		if !ok {
+			return nil
+		}
+		fileURL, fileName = fm.URL, fm.Name
+	default:
+		return nil
+	}
+	hash, ok := storedFileHash(fileURL)
+	if !ok {
+		return nil
+	}
+	var file models.FileStorage
+	err := tx.Select("id").Where("hash = ?", hash).First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	allowed, err := canAccessFile(tx, msg.FromUserID, file.ID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errMessageFileDenied
+	}
+
+	ref := &models.FileReference{FileID: file.ID, UserID: msg.FromUserID, RefType: refTypeMessage, RefID: msg.ID, FileName: fileName}
+	if err := tx.Create(ref).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.FileStorage{}).Where("id = ?", file.ID).
+		UpdateColumn("ref_count", gorm.Expr("ref_count + 1")).Error
+}
+
+// unlinkMessageFile 删除消息对文件的引用并减少引用计数，消息对所有人删除时调用
+// 引用计数归零且没有其他引用的文件由孤儿文件清理回收
+func unlinkMessageFile(tx *gorm.DB, messageID int64) error {
+	var refs []models.FileReference
+	if err := tx.Select("id", "file_id").Where("ref_type = ? AND ref_id = ?", refTypeMessage, messageID).Find(&refs).Error; err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := tx.Delete(&models.FileReference{}, ref.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.FileStorage{}).Where("id = ?", ref.FileID).
+			UpdateColumn("ref_count", gorm.Expr("CASE WHEN ref_count > 0 THEN ref_count - 1 ELSE 0 END")).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindFile 按ID或哈希（消息内容中的文件名）查找文件
+func (s *FileService) FindFile(ctx context.Context, idOrHash string) (*models.FileStorage, error) {
+	if len(idOrHash) == sha256.Size*2 {
+		return s.GetFileByHash(ctx, strings.ToLower(idOrHash))
+	}
+	fileID, err := strconv.ParseInt(idOrHash, 10, 64)
+	if err != nil || fileID <= 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return s.GetFileByID(ctx, fileID)
+}
+
+// memberMessageCondition 消息m未被删除且用户是其所在会话的成员（单聊双方或群成员），需要传入三次用户ID
+const memberMessageCondition = "m.deleted_at IS NULL AND (m.from_user_id = ? OR m.to_user_id = ? OR m.group_id IN (SELECT gm.group_id FROM group_members gm WHERE gm.user_id = ?))"
+
+// CanAccessFile 用户是否可以下载文件：上传者本人（包括秒传）、头像（登录用户均可见），或引用该文件的消息所在会话的成员
+func (s *FileService) CanAccessFile(ctx context.Context, userID int64, file *models.FileStorage) (bool, error) {
+	return canAccessFile(s.db.WithContext(ctx), userID, file.ID)
+}
+
+// canAccessFile 按文件引用校验下载权限；消息引用的UserID是发送者，不代表持有文件，只按会话成员身份校验
+func canAccessFile(db *gorm.DB, userID, fileID int64) (bool, error) {
+	var refs []models.FileReference
+	if err := db.Where("file_id = ?", fileID).Find(&refs).Error; err != nil {
+		return false, err
+	}
+
+	var messageIDs []int64
+	for _, ref := range refs {
+		switch {
+		case ref.RefType == refTypeMessage:
+			messageIDs = append(messageIDs, ref.RefID)
+		case ref.RefType == "avatar" || ref.UserID == userID:
+			return true, nil
+		}
+	}
+	if len(messageIDs) == 0 {
+		return false, nil
+	}
+
+	// 引用的消息可能已被归档
+	for _, table := range []string{models.Message{}.TableName(), models.ArchivedMessage{}.TableName()} {
+		var ids []int64
+		err := db.Table(table+" m").Where("m.id IN ? AND "+memberMessageCondition, messageIDs, userID, userID, userID).
+			Limit(1).Pluck("m.id", &ids).Error
+		if err != nil {
+			return false, err
+		}
+		if len(ids) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DownloadName 下载时使用的文件名：优先使用用户可见的文件消息中的原始文件名，
+// 同一内容可能被不同用户以不同文件名发送，不能直接使用首次上传时记录的文件名
+func (s *FileService) DownloadName(ctx context.Context, userID int64, file *models.FileStorage) (string, error) {
+	for _, table := range []string{models.Message{}.TableName(), models.ArchivedMessage{}.TableName()} {
+		var names []string
+		err := s.db.WithContext(ctx).Table(models.FileReference{}.TableName()+" r").
+			Joins("JOIN "+table+" m ON m.id = r.ref_id").
+			Where("r.file_id = ? AND r.ref_type = ? AND r.file_name <> '' AND r.deleted_at IS NULL", file.ID, refTypeMessage).
+			Where(memberMessageCondition, userID, userID, userID).
+			Order("r.id DESC").Limit(1).Pluck("r.file_name", &names).Error
+		if err != nil {
+			return "", err
+		}
+		if len(names) > 0 {
+			return names[0], nil
+		}
+	}
+	return SanitizeFileName(file.FileName), nil
+}
+
+// FilePath 返回文件或其指定尺寸缩略图的本地存储路径，缩略图不存在时返回原图（已迁移到对象存储的原图返回对象键）
+func FilePath(file *models.FileStorage, size string) string {
+	if size != "" {
+		if path := thumbnailPath(LocalStoragePath(file), size); fileExists(path) {
+			return path
+		}
+	}
+	return LocalStoragePath(file)
+}
+
+// ValidThumbnailSize 是否为支持的缩略图尺寸，空字符串表示原图
+func ValidThumbnailSize(size string) bool {
+	if size == "" {
+		return true
+	}
+	for _, s := range thumbnailSizes {
+		if s.name == size {
+			return true
+		}
+	}
+	return false
+}
+
+// SignFileURL 生成文件下载签名，签名覆盖文件ID、尺寸、下载文件名和过期时间
+func SignFileURL(secret string, fileID int64, size, name string, expires time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d:%s:%d:%s", fileID, size, expires.Unix(), name)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyFileSignature 校验下载签名，过期或不匹配时返回false
+func VerifyFileSignature(secret string, fileID int64, size, name string, expires time.Time, signature string) bool {
+	if time.Now().After(expires) {
+		return false
+	}
+	expected := SignFileURL(secret, fileID, size, name, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/models"
+)
+
+func createTestFile(t *testing.T, db *gorm.DB, hashChar string, ownerID int64) *models.FileStorage {
+	hash := strings.Repeat(hashChar, 64)
+	file := &models.FileStorage{Hash: hash, FileSize: 1, StoragePath: FileStorageDir + "/" + hash + ".jpg", RefCount: 1}
+	require.NoError(t, db.Create(file).Error)
+	require.NoError(t, db.Create(&models.FileReference{FileID: file.ID, UserID: ownerID, RefType: "chat_image"}).Error)
+	return file
+}
+
+func TestCanAccessFileRequiresConversationMembership(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+	fileService := &FileService{db: db}
+
+	file := createTestFile(t, db, "a", alice.ID)
+	_, err := NewMessageServiceWithDB(db).SaveMessage(context.Background(), &models.Message{
+		FromUserID: alice.ID, ToUserID: &bob.ID, Content: "/" + file.StoragePath, MsgType: models.MessageTypeImage,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, db.First(file, file.ID).Error)
+	assert.Equal(t, 2, file.RefCount, "消息引用计入引用计数")
+
+	for _, tc := range []struct {
+		user    *models.User
+		allowed bool
+	}{{alice, true}, {bob, true}, {carol, false}} {
+		allowed, err := fileService.CanAccessFile(context.Background(), tc.user.ID, file)
+		require.NoError(t, err)
+		assert.Equal(t, tc.allowed, allowed, tc.user.Nickname)
+	}
+
+	// 没有消息引用的文件不再按消息内容匹配
+	legacy := createTestFile(t, db, "b", alice.ID)
+	require.NoError(t, db.Create(&models.Message{
+		FromUserID: alice.ID, ToUserID: &bob.ID, Content: "/" + legacy.StoragePath, MsgType: models.MessageTypeImage,
+	}).Error)
+	allowed, err := fileService.CanAccessFile(context.Background(), bob.ID, legacy)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestSendFileMessageRequiresFileAccess(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+	dave := createTestUser(t, db, "13800000004", "dave")
+	fileService := &FileService{db: db}
+	messageService := NewMessageServiceWithDB(db)
+
+	file := createTestFile(t, db, "a", alice.ID)
+	send := func(from, to *models.User) error {
+		_, err := messageService.SaveMessage(context.Background(), &models.Message{
+			FromUserID: from.ID, ToUserID: &to.ID, Content: "/" + file.StoragePath, MsgType: models.MessageTypeImage,
+		})
+		return err
+	}
+
+	// 只知道URL、没有持有文件的用户不能发送该文件，也不会因此获得下载权限
+	var rejected *MessageRejectedError
+	require.ErrorAs(t, send(carol, dave), &rejected)
+	for _, user := range []*models.User{carol, dave} {
+		allowed, err := fileService.CanAccessFile(context.Background(), user.ID, file)
+		require.NoError(t, err)
+		assert.False(t, allowed, user.Nickname)
+	}
+
+	// 会话中收到文件的用户可以转发，转发者的消息引用不等于持有文件
+	require.NoError(t, send(alice, bob))
+	require.NoError(t, send(bob, carol))
+	allowed, err := fileService.CanAccessFile(context.Background(), carol.ID, file)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	require.NoError(t, db.Where("from_user_id = ?", alice.ID).Delete(&models.Message{}).Error)
+	allowed, err = fileService.CanAccessFile(context.Background(), bob.ID, file)
+	require.NoError(t, err)
+	assert.True(t, allowed, "bob仍是转发消息所在会话的成员")
+	require.NoError(t, db.Where("from_user_id = ?", bob.ID).Delete(&models.Message{}).Error)
+	allowed, err = fileService.CanAccessFile(context.Background(), bob.ID, file)
+	require.NoError(t, err)
+	assert.False(t, allowed, "消息删除后转发者不再持有文件")
+}
+
+func TestFileSignature(t *testing.T) {
+	expires := time.Now().Add(time.Minute).Truncate(time.Second)
+	sig := SignFileURL("secret", 42, ThumbnailSmall, "", expires)
+
+	assert.True(t, VerifyFileSignature("secret", 42, ThumbnailSmall, "", expires, sig))
+	assert.False(t, VerifyFileSignature("secret", 42, "", "", expires, sig), "签名覆盖尺寸")
+	assert.False(t, VerifyFileSignature("secret", 42, ThumbnailSmall, "a.pdf", expires, sig), "签名覆盖文件名")
+	assert.False(t, VerifyFileSignature("secret", 43, ThumbnailSmall, "", expires, sig))
+	assert.False(t, VerifyFileSignature("other", 42, ThumbnailSmall, "", expires, sig))
+
+	past := time.Now().Add(-time.Minute).Truncate(time.Second)
+	assert.False(t, VerifyFileSignature("secret", 42, "", "", past, SignFileURL("secret", 42, "", "", past)))
+}
+
+func TestDownloadNameFollowsVisibleFileMessage(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+	dave := createTestUser(t, db, "13800000004", "dave")
+	fileService := &FileService{db: db}
+	messageService := NewMessageServiceWithDB(db)
+
+	file := createTestFile(t, db, "c", alice.ID)
+	require.NoError(t, db.Model(file).Update("file_name", "first.pdf").Error)
+	send := func(to *models.User, name string) {
+		content, err := json.Marshal(FileMessageContent{URL: "/" + file.StoragePath, Name: name, Size: 1})
+		require.NoError(t, err)
+		_, err = messageService.SaveMessage(context.Background(), &models.Message{
+			FromUserID: alice.ID, ToUserID: &to.ID, Content: string(content), MsgType: models.MessageTypeFile,
+		})
+		require.NoError(t, err)
+	}
+	send(bob, "季度报告.pdf")
+	send(carol, "../other.pdf")
+
+	for _, tc := range []struct {
+		user *models.User
+		name string
+	}{{bob, "季度报告.pdf"}, {carol, "other.pdf"}, {dave, "first.pdf"}} {
+		name, err := fileService.DownloadName(context.Background(), tc.user.ID, file)
+		require.NoError(t, err)
+		assert.Equal(t, tc.name, name, tc.user.Nickname)
+	}
+
+	allowed, err := fileService.CanAccessFile(context.Background(), bob.ID, file)
+	require.NoError(t, err)
+	assert.True(t, allowed, "文件消息同样记录引用")
+}
+
+func TestDeleteMessageForEveryoneReleasesFileReference(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	fileService := &FileService{db: db}
+	messageService := NewMessageServiceWithDB(db)
+
+	file := createTestFile(t, db, "a", alice.ID)
+	msgID, err := messageService.SaveMessage(context.Background(), &models.Message{
+		FromUserID: alice.ID, ToUserID: &bob.ID, Content: "/" + file.StoragePath, MsgType: models.MessageTypeImage,
+	})
+	require.NoError(t, err)
+	var ref models.FileReference
+	require.NoError(t, db.Where("ref_type = ? AND file_id = ?", refTypeMessage, file.ID).First(&ref).Error)
+	assert.Equal(t, msgID, ref.RefID, "引用记录消息ID")
+
+	require.NoError(t, messageService.DeleteMessage(context.Background(), alice.ID, msgID, DeleteScopeEveryone))
+
+	require.NoError(t, db.First(file, file.ID).Error)
+	assert.Equal(t, 1, file.RefCount, "只剩上传引用")
+	var count int64
+	require.NoError(t, db.Model(&models.FileReference{}).Where("ref_type = ? AND ref_id = ?", refTypeMessage, msgID).Count(&count).Error)
+	assert.Zero(t, count)
+
+	allowed, err := fileService.CanAccessFile(context.Background(), bob.ID, file)
+	require.NoError(t, err)
+	assert.False(t, allowed, "消息删除后接收方不能再下载")
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"gochat/internal/models"
+)
+
+// 文件列表中的文件类别
+const (
+	FileKindImage  = "image"
+	FileKindVoice  = "voice"
+	FileKindVideo  = "video"
+	FileKindFile   = "file"
+	FileKindAvatar = "avatar"
+)
+
+// uploadRefKinds 上传引用类型对应的文件类别
+var uploadRefKinds = map[string]string{
+	"chat_image":          FileKindImage,
+	"chat_image_original": FileKindImage,
+	"chat_voice":          FileKindVoice,
+	"chat_video":          FileKindVideo,
+	"chat_file":           FileKindFile,
+	"avatar":              FileKindAvatar,
+}
+
+// messageKinds 消息类型对应的文件类别
+var messageKinds = map[int]string{
+	models.MessageTypeImage: FileKindImage,
+	models.MessageTypeVoice: FileKindVoice,
+	models.MessageTypeVideo: FileKindVideo,
+	models.MessageTypeFile:  FileKindFile,
+}
+
+// ValidFileKind 文件类别参数是否有效，空字符串表示不过滤
+func ValidFileKind(kind string) bool {
+	switch kind {
+	case "", FileKindImage, FileKindVoice, FileKindVideo, FileKindFile, FileKindAvatar:
+		return true
+	}
+	return false
+}
+
+// FileListFilter 文件列表查询条件
+type FileListFilter struct {
+	Kind     string // 文件类别，为空时不过滤
+	PeerID   int64  // 只返回发给该好友的文件消息
+	GroupID  int64  // 只返回发到该群的文件消息
+	BeforeID int64  // 游标：返回引用ID小于该值的记录
+	Limit    int
+}
+
+// UserFileInfo 用户文件列表项，每条对应一条文件引用（一次上传或一条文件消息）
+type UserFileInfo struct {
+	ID         int64             `json:"id"` // 引用ID，用作分页游标
+	FileID     int64             `json:"file_id"`
+	FileName   string            `json:"file_name"`
+	FileSize   int64             `json:"file_size"`
+	MimeType   string            `json:"mime_type"`
+	Kind       string            `json:"kind"`
+	URL        string            `json:"url"`
+	Thumbnails map[string]string `json:"thumbnails,omitempty"`
+	Blurhash   string            `json:"blurhash,omitempty"`
+	RefType    string            `json:"ref_type"`
+	MessageID  int64             `json:"message_id,omitempty"`
+	ToUserID   *int64            `json:"to_user_id,omitempty"` // 单聊对方
+	GroupID    *int64            `json:"group_id,omitempty"`   // 群聊ID
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// userFileRow 文件列表查询结果
+type userFileRow struct {
+	ID          int64
+	FileID      int64
+	RefType     string
+	RefID       int64
+	RefFileName string
+	FileName    string
+	FileSize    int64
+	MimeType    string
+	StoragePath string
+	MsgType     *int
+	ToUserID    *int64
+	GroupID     *int64
+	CreatedAt   time.Time
+}
+
+// ListUserFiles 按时间倒序列出用户上传和发送的文件，文件消息带有所在会话（单聊对方或群），
+// 已对所有人删除的消息不返回；消息已归档时同样能取到会话信息
+func (s *FileService) ListUserFiles(ctx context.Context, userID int64, filter FileListFilter) ([]UserFileInfo, bool, error) {
+	msgTable, archiveTable := models.Message{}.TableName(), models.ArchivedMessage{}.TableName()
+	query := s.db.WithContext(ctx).Table(models.FileReference{}.TableName()+" r").
+		Select("r.id, r.file_id, r.ref_type, r.ref_id, r.file_name AS ref_file_name, r.created_at, "+
+			"f.file_name, f.file_size, f.mime_type, f.storage_path, "+
+			"COALESCE(m.msg_type, a.msg_type) AS msg_type, "+
+			"COALESCE(m.to_user_id, a.to_user_id) AS to_user_id, "+
+			"COALESCE(m.group_id, a.group_id) AS group_id").
+		Joins("JOIN "+models.FileStorage{}.TableName()+" f ON f.id = r.file_id").
+		Joins("LEFT JOIN "+msgTable+" m ON r.ref_type = ? AND m.id = r.ref_id", refTypeMessage).
+		Joins("LEFT JOIN "+archiveTable+" a ON r.ref_type = ? AND a.id = r.ref_id", refTypeMessage).
+		Where("r.user_id = ? AND r.deleted_at IS NULL AND m.deleted_at IS NULL AND a.deleted_at IS NULL", userID)
+
+	if filter.Kind != "" {
+		var refTypes []string
+		for refType, kind := range uploadRefKinds {
+			if kind == filter.Kind {
+				refTypes = append(refTypes, refType)
+			}
+		}
+		var msgTypes []int
+		for msgType, kind := range messageKinds {
+			if kind == filter.Kind {
+				msgTypes = append(msgTypes, msgType)
+			}
+		}
+		if len(msgTypes) == 0 {
+			query = query.Where("r.ref_type IN ?", refTypes)
+		} else {
+			query = query.Where("(r.ref_type IN ? OR (r.ref_type = ? AND COALESCE(m.msg_type, a.msg_type) IN ?))",
+				refTypes, refTypeMessage, msgTypes)
+		}
+	}
+	if filter.PeerID > 0 {
+		query = query.Where("COALESCE(m.to_user_id, a.to_user_id) = ?", filter.PeerID)
+	}
+	if filter.GroupID > 0 {
+		query = query.Where("COALESCE(m.group_id, a.group_id) = ?", filter.GroupID)
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("r.id < ?", filter.BeforeID)
+	}
+
+	var rows []userFileRow
+	if err := query.Order("r.id DESC").Limit(filter.Limit + 1).Scan(&rows).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(rows) > filter.Limit
+	if hasMore {
+		rows = rows[:filter.Limit]
+	}
+
+	files := make([]UserFileInfo, len(rows))
+	for i, row := range rows {
+		url := "/" + LocalStoragePath(&models.FileStorage{StoragePath: row.StoragePath})
+		info := UserFileInfo{
+			ID:        row.ID,
+			FileID:    row.FileID,
+			FileName:  row.RefFileName,
+			FileSize:  row.FileSize,
+			MimeType:  row.MimeType,
+			Kind:      uploadRefKinds[row.RefType],
+			URL:       PublicURL(url),
+			RefType:   row.RefType,
+			CreatedAt: row.CreatedAt,
+		}
+		if info.FileName == "" {
+			info.FileName = SanitizeFileName(row.FileName)
+		}
+		if row.RefType == refTypeMessage {
+			info.MessageID = row.RefID
+			info.ToUserID, info.GroupID = row.ToUserID, row.GroupID
+			if row.MsgType != nil {
+				info.Kind = messageKinds[*row.MsgType]
+			}
+		}
+		switch info.Kind {
+		case FileKindImage:
+			info.Thumbnails = MessageThumbnails(models.MessageTypeImage, url)
+			info.Blurhash = ImageBlurhash(url)
+		case FileKindVideo:
+			info.Thumbnails = MessageThumbnails(models.MessageTypeVideo, url)
+		}
+		files[i] = info
+	}
+	return files, hasMore, nil
+}
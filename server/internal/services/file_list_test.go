@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestListUserFiles(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	fileService := &FileService{db: db}
+	messageService := NewMessageServiceWithDB(db)
+
+	group := &models.Group{Name: "team", OwnerID: alice.ID, MemberCount: 2}
+	require.NoError(t, db.Create(group).Error)
+	require.NoError(t, db.Create([]*models.GroupMember{
+		{GroupID: group.ID, UserID: alice.ID},
+		{GroupID: group.ID, UserID: bob.ID},
+	}).Error)
+
+	image := createTestFile(t, db, "a", alice.ID)
+	doc := createTestFile(t, db, "b", bob.ID)
+	send := func(msg *models.Message) int64 {
+		msg.FromUserID = alice.ID
+		id, err := messageService.SaveMessage(context.Background(), msg)
+		require.NoError(t, err)
+		return id
+	}
+	send(&models.Message{ToUserID: &bob.ID, Content: "/" + image.StoragePath, MsgType: models.MessageTypeImage})
+	content, err := json.Marshal(FileMessageContent{URL: "/" + doc.StoragePath, Name: "报告.pdf", Size: 1})
+	require.NoError(t, err)
+	// bob先在群里发送文档，alice作为群成员可以转发
+	_, err = messageService.SaveMessage(context.Background(), &models.Message{
+		FromUserID: bob.ID, GroupID: &group.ID, Content: string(content), MsgType: models.MessageTypeFile,
+	})
+	require.NoError(t, err)
+	send(&models.Message{GroupID: &group.ID, Content: string(content), MsgType: models.MessageTypeFile})
+	deletedID := send(&models.Message{GroupID: &group.ID, Content: "/" + image.StoragePath, MsgType: models.MessageTypeImage})
+	require.NoError(t, db.Delete(&models.Message{}, deletedID).Error)
+
+	files, hasMore, err := fileService.ListUserFiles(context.Background(), alice.ID, FileListFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	require.Len(t, files, 3, "上传引用和两条未删除的消息")
+	assert.Equal(t, FileKindFile, files[0].Kind)
+	assert.Equal(t, "报告.pdf", files[0].FileName)
+	assert.Equal(t, &group.ID, files[0].GroupID)
+	assert.Equal(t, FileKindImage, files[1].Kind)
+	assert.Equal(t, &bob.ID, files[1].ToUserID)
+	assert.Equal(t, "chat_image", files[2].RefType)
+	assert.Zero(t, files[2].MessageID)
+
+	files, _, err = fileService.ListUserFiles(context.Background(), alice.ID, FileListFilter{Kind: FileKindImage, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	files, _, err = fileService.ListUserFiles(context.Background(), alice.ID, FileListFilter{PeerID: bob.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "/"+image.StoragePath, files[0].URL)
+
+	page, hasMore, err := fileService.ListUserFiles(context.Background(), alice.ID, FileListFilter{Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	rest, hasMore, err := fileService.ListUserFiles(context.Background(), alice.ID, FileListFilter{BeforeID: page[1].ID, Limit: 2})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	require.Len(t, rest, 1)
+	assert.Equal(t, "chat_image", rest[0].RefType)
+}
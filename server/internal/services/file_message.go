@@ -0,0 +1,99 @@
+package services
+
+import (
+	"encoding/json"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gochat/internal/models"
+)
+
+// maxFileNameLength 原始文件名最大字节数，与file_references.file_name列宽一致
+const maxFileNameLength = 255
+
+// FileMessageContent 文件消息内容，以JSON存储在消息content中
+type FileMessageContent struct {
+	URL  string `json:"url"`  // 上传接口返回的file_url
+	Name string `json:"name"` // 原始文件名，下载时使用
+	Size int64  `json:"size"` // 文件大小（字节）
+}
+
+// ParseFileMessage 解析文件消息内容，URL不是本服务存储的文件时返回false
+func ParseFileMessage(content string) (FileMessageContent, bool) {
+	var fm FileMessageContent
+	if err := json.Unmarshal([]byte(content), &fm); err != nil {
+		return FileMessageContent{}, false
+	}
+	if _, ok := storedFileHash(fm.URL); !ok {
+		return FileMessageContent{}, false
+	}
+	fm.Name = SanitizeFileName(fm.Name)
+	return fm, true
+}
+
+// SanitizeFileName 清理客户端提供的文件名：去掉路径和控制字符，超长时按字符边界截断
+func SanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return strings.TrimSpace(name)
+}
+
+// mediaContentTypes 音视频扩展名对应的Content-Type
+// 标准库内置的类型表不含音视频，其余依赖系统的mime.types，精简镜像（如alpine）中通常不存在
+var mediaContentTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".webm": "video/webm",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+}
+
+// ContentType 文件的Content-Type：音视频优先使用上传时记录的类型（语音的webm/mp4应为audio/*），
+// 否则按存储扩展名判断，无法判断时返回空字符串，由http.ServeContent按内容检测
+func ContentType(file *models.FileStorage) string {
+	ext := strings.ToLower(filepath.Ext(file.StoragePath))
+	if mediaType, ok := mediaContentTypes[ext]; ok {
+		if strings.HasPrefix(file.MimeType, "audio/") || strings.HasPrefix(file.MimeType, "video/") {
+			return file.MimeType
+		}
+		return mediaType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// IsInlineMedia 文件是否为可在页面内直接展示的图片、音频或视频（按存储扩展名判断），其他文件下载时作为附件
+func IsInlineMedia(storagePath string) bool {
+	ext := strings.ToLower(filepath.Ext(storagePath))
+	if _, ok := mediaContentTypes[ext]; ok {
+		return true
+	}
+	mimeType := mime.TypeByExtension(ext)
+	if mimeType == "image/svg+xml" {
+		return false
+	}
+	for _, prefix := range []string{"image/", "audio/", "video/"} {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/models"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	assert.Equal(t, "report.pdf", SanitizeFileName("../../etc/report.pdf"))
+	assert.Equal(t, "report.pdf", SanitizeFileName(`C:\Users\me\report.pdf`))
+	assert.Equal(t, "ab.txt", SanitizeFileName("a\r\nb.txt"))
+	assert.Equal(t, "", SanitizeFileName("/"))
+
+	long := SanitizeFileName(strings.Repeat("文", 100) + ".txt")
+	assert.LessOrEqual(t, len(long), maxFileNameLength)
+	assert.Equal(t, strings.Repeat("文", 85), long, "按字符边界截断")
+}
+
+func TestContentType(t *testing.T) {
+	for _, tc := range []struct {
+		file     models.FileStorage
+		expected string
+	}{
+		{models.FileStorage{StoragePath: "uploads/files/a.m4a"}, "audio/mp4"},
+		{models.FileStorage{StoragePath: "uploads/files/a.mov"}, "video/quicktime"},
+		{models.FileStorage{StoragePath: "uploads/files/a.webm", MimeType: "audio/webm"}, "audio/webm"},
+		{models.FileStorage{StoragePath: "uploads/files/a.webm", MimeType: "application/octet-stream"}, "video/webm"},
+		{models.FileStorage{StoragePath: "uploads/files/a.png"}, "image/png"},
+	} {
+		assert.Equal(t, tc.expected, ContentType(&tc.file), tc.file.StoragePath)
+	}
+
+	assert.True(t, IsInlineMedia("uploads/files/a.mp3"))
+	assert.True(t, IsInlineMedia("uploads/files/a.jpg"))
+	assert.False(t, IsInlineMedia("uploads/files/a.svg"))
+	assert.False(t, IsInlineMedia("uploads/files/a.pdf"))
+}
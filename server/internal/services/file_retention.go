@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+// retentionBatchSize 每批过期的引用条数，避免长事务
+const retentionBatchSize = 500
+
+// ExpireReferences 按引用类型的保留天数删除过期的文件引用并减少引用计数，返回删除的引用数
+// 保留天数为0或未配置的类型永久保留；引用计数归零的文件由孤儿文件清理回收
+func (s *FileService) ExpireReferences(ctx context.Context, retentionDays map[string]int) (int64, error) {
+	log := logger.GetLogger()
+
+	// 按类型名排序，日志顺序稳定
+	refTypes := make([]string, 0, len(retentionDays))
+	for refType, days := range retentionDays {
+		if days > 0 {
+			refTypes = append(refTypes, refType)
+		}
+	}
+	sort.Strings(refTypes)
+
+	var total int64
+	for _, refType := range refTypes {
+		cutoff := time.Now().AddDate(0, 0, -retentionDays[refType])
+		var expired int64
+		for {
+			n, err := s.expireReferenceBatch(ctx, refType, cutoff)
+			if err != nil {
+				return total, err
+			}
+			expired += n
+			if n < retentionBatchSize {
+				break
+			}
+		}
+		if expired > 0 {
+			log.Infof("文件引用过期: 类型=%s, 保留=%d天, 删除=%d条", refType, retentionDays[refType], expired)
+		}
+		total += expired
+	}
+	return total, nil
+}
+
+// expireReferenceBatch 在一个事务中删除一批过期引用并同步减少对应文件的引用计数
+func (s *FileService) expireReferenceBatch(ctx context.Context, refType string, cutoff time.Time) (int64, error) {
+	var deleted int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var refs []models.FileReference
+		if err := tx.Select("id", "file_id").
+			Where("ref_type = ? AND created_at < ?", refType, cutoff).
+			Order("id").Limit(retentionBatchSize).Find(&refs).Error; err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(refs))
+		perFile := make(map[int64]int)
+		for i, ref := range refs {
+			ids[i] = ref.ID
+			perFile[ref.FileID]++
+		}
+		if err := tx.Delete(&models.FileReference{}, ids).Error; err != nil {
+			return err
+		}
+		for fileID, n := range perFile {
+			if err := tx.Model(&models.FileStorage{}).Where("id = ?", fileID).
+				UpdateColumn("ref_count", gorm.Expr("CASE WHEN ref_count > ? THEN ref_count - ? ELSE 0 END", n, n)).Error; err != nil {
+				return err
+			}
+		}
+		deleted = int64(len(refs))
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestExpireReferencesByRefType(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	fileService := &FileService{db: db}
+
+	old := time.Now().AddDate(0, 0, -200)
+	image := createTestFile(t, db, "a", alice.ID) // chat_image引用，当前时间创建
+	require.NoError(t, db.Create(&models.FileReference{FileID: image.ID, UserID: bob.ID, RefType: "chat_image", CreatedAt: old}).Error)
+	require.NoError(t, db.Model(image).Update("ref_count", 2).Error)
+
+	avatar := &models.FileStorage{Hash: "avatar", FileSize: 1, StoragePath: FileStorageDir + "/avatar.png", RefCount: 1}
+	require.NoError(t, db.Create(avatar).Error)
+	require.NoError(t, db.Create(&models.FileReference{FileID: avatar.ID, UserID: alice.ID, RefType: "avatar", CreatedAt: old}).Error)
+
+	expired, err := fileService.ExpireReferences(context.Background(), map[string]int{"chat_image": 180, "avatar": 0})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), expired)
+
+	require.NoError(t, db.First(image, image.ID).Error)
+	assert.Equal(t, 1, image.RefCount, "只有超过保留期的引用被删除")
+	var remaining []models.FileReference
+	require.NoError(t, db.Where("file_id = ?", image.ID).Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, alice.ID, remaining[0].UserID)
+
+	require.NoError(t, db.First(avatar, avatar.ID).Error)
+	assert.Equal(t, 1, avatar.RefCount, "头像永久保留")
+
+	// 再次执行没有可过期的引用
+	expired, err = fileService.ExpireReferences(context.Background(), map[string]int{"chat_image": 180})
+	require.NoError(t, err)
+	assert.Zero(t, expired)
+}
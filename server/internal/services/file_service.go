@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -17,6 +18,7 @@ import (
 	"gochat/internal/database"
 	"gochat/internal/logger"
 	"gochat/internal/models"
+	"gochat/internal/objectstore"
 )
 
 // 统一文件存储目录
@@ -41,6 +43,7 @@ type UploadFileResult struct {
 
 // UploadFile 上传文件（全局去重系统）
 func (s *FileService) UploadFile(
+	ctx context.Context,
 	file multipart.File,
 	header *multipart.FileHeader,
 	userID int64,
@@ -65,23 +68,23 @@ func (s *FileService) UploadFile(
 		return nil, fmt.Errorf("failed to seek file: %w", err)
 	}
 
-	// 4. 检查文件是否已存在（全局去重）
+	// 4. 检查文件是否已存在（全局去重，走主库避免重复入库）
 	var existingFile models.FileStorage
-	result := s.db.Where("hash = ?", hash).First(&existingFile)
+	result := database.Primary(s.db.WithContext(ctx)).Where("hash = ?", hash).First(&existingFile)
 
 	if result.Error == nil {
 		// 文件已存在，执行去重逻辑
 		log.Infof("文件去重命中: hash=%s, 用户=%d, 类型=%s", hash[:16], userID, refType)
 
 		// 增加引用计数
-		if err := s.IncrementRefCount(existingFile.ID); err != nil {
+		if err := s.IncrementRefCount(ctx, existingFile.ID); err != nil {
 			return nil, fmt.Errorf("failed to increment ref count: %w", err)
 		}
 
 		// 创建新的引用记录
-		if err := s.CreateReference(existingFile.ID, userID, refType, 0); err != nil {
+		if err := s.CreateReference(ctx, existingFile.ID, userID, refType, 0); err != nil {
 			// 引用创建失败，回滚引用计数
-			s.DecrementRefCount(existingFile.ID)
+			s.DecrementRefCount(ctx, existingFile.ID)
 			return nil, fmt.Errorf("failed to create reference: %w", err)
 		}
 
@@ -89,7 +92,7 @@ func (s *FileService) UploadFile(
 		return &UploadFileResult{
 			FileStorage: &existingFile,
 			IsDedup:     true,
-			URL:         existingFile.StoragePath,
+			URL:         LocalStoragePath(&existingFile),
 		}, nil
 	}
 
@@ -137,15 +140,15 @@ func (s *FileService) UploadFile(
 		RefCount:    1,
 	}
 
-	if err := s.db.Create(newFile).Error; err != nil {
+	if err := s.db.WithContext(ctx).Create(newFile).Error; err != nil {
 		os.Remove(fullPath) // 清理已保存的文件
 		return nil, fmt.Errorf("failed to create file record: %w", err)
 	}
 
 	// 11. 创建引用记录
-	if err := s.CreateReference(newFile.ID, userID, refType, 0); err != nil {
+	if err := s.CreateReference(ctx, newFile.ID, userID, refType, 0); err != nil {
 		// 引用创建失败，回滚
-		s.db.Delete(newFile)
+		s.db.WithContext(ctx).Delete(newFile)
 		os.Remove(fullPath)
 		return nil, fmt.Errorf("failed to create reference: %w", err)
 	}
@@ -170,44 +173,44 @@ func (s *FileService) CalculateFileHash(file multipart.File) (string, error) {
 }
 
 // GetFileByHash 根据哈希查找文件
-func (s *FileService) GetFileByHash(hash string) (*models.FileStorage, error) {
+func (s *FileService) GetFileByHash(ctx context.Context, hash string) (*models.FileStorage, error) {
 	var file models.FileStorage
-	if err := s.db.Where("hash = ?", hash).First(&file).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("hash = ?", hash).First(&file).Error; err != nil {
 		return nil, err
 	}
 	return &file, nil
 }
 
 // GetFileByID 根据ID查找文件
-func (s *FileService) GetFileByID(fileID int64) (*models.FileStorage, error) {
+func (s *FileService) GetFileByID(ctx context.Context, fileID int64) (*models.FileStorage, error) {
 	var file models.FileStorage
-	if err := s.db.First(&file, fileID).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&file, fileID).Error; err != nil {
 		return nil, err
 	}
 	return &file, nil
 }
 
 // IncrementRefCount 增加引用计数
-func (s *FileService) IncrementRefCount(fileID int64) error {
-	return s.db.Model(&models.FileStorage{}).
+func (s *FileService) IncrementRefCount(ctx context.Context, fileID int64) error {
+	return s.db.WithContext(ctx).Model(&models.FileStorage{}).
 		Where("id = ?", fileID).
 		UpdateColumn("ref_count", gorm.Expr("ref_count + 1")).
 		Error
 }
 
 // DecrementRefCount 减少引用计数
-func (s *FileService) DecrementRefCount(fileID int64) error {
-	return s.db.Model(&models.FileStorage{}).
+func (s *FileService) DecrementRefCount(ctx context.Context, fileID int64) error {
+	return s.db.WithContext(ctx).Model(&models.FileStorage{}).
 		Where("id = ?", fileID).
 		UpdateColumn("ref_count", gorm.Expr("ref_count - 1")).
 		Error
 }
 
 // CreateReference 创建文件引用记录
-func (s *FileService) CreateReference(fileID, userID int64, refType string, refID int64) error {
+func (s *FileService) CreateReference(ctx context.Context, fileID, userID int64, refType string, refID int64) error {
 	// 检查是否已存在相同的引用记录
 	var existingRef models.FileReference
-	result := s.db.Where("file_id = ? AND user_id = ? AND ref_type = ?", fileID, userID, refType).
+	result := database.Primary(s.db.WithContext(ctx)).Where("file_id = ? AND user_id = ? AND ref_type = ?", fileID, userID, refType).
 		First(&existingRef)
 
 	if result.Error == nil {
@@ -222,15 +225,15 @@ func (s *FileService) CreateReference(fileID, userID int64, refType string, refI
 		RefType: refType,
 		RefID:   refID,
 	}
-	return s.db.Create(ref).Error
+	return s.db.WithContext(ctx).Create(ref).Error
 }
 
 // DeleteReference 删除引用（软删除）
-func (s *FileService) DeleteReference(fileID, userID int64, refType string) error {
+func (s *FileService) DeleteReference(ctx context.Context, fileID, userID int64, refType string) error {
 	log := logger.GetLogger()
 
 	// 软删除引用记录
-	result := s.db.Where("file_id = ? AND user_id = ? AND ref_type = ?", fileID, userID, refType).
+	result := s.db.WithContext(ctx).Where("file_id = ? AND user_id = ? AND ref_type = ?", fileID, userID, refType).
 		Delete(&models.FileReference{})
 
 	if result.Error != nil {
@@ -239,7 +242,7 @@ func (s *FileService) DeleteReference(fileID, userID int64, refType string) erro
 
 	// 如果删除成功，减少引用计数
 	if result.RowsAffected > 0 {
-		if err := s.DecrementRefCount(fileID); err != nil {
+		if err := s.DecrementRefCount(ctx, fileID); err != nil {
 			log.Errorf("减少引用计数失败: fileID=%d, error=%v", fileID, err)
 			return err
 		}
@@ -249,9 +252,9 @@ func (s *FileService) DeleteReference(fileID, userID int64, refType string) erro
 }
 
 // GetReferencesByUser 获取用户的文件引用
-func (s *FileService) GetReferencesByUser(userID int64, refType string) ([]models.FileReference, error) {
+func (s *FileService) GetReferencesByUser(ctx context.Context, userID int64, refType string) ([]models.FileReference, error) {
 	var refs []models.FileReference
-	query := s.db.Where("user_id = ?", userID)
+	query := s.db.WithContext(ctx).Where("user_id = ?", userID)
 
 	if refType != "" {
 		query = query.Where("ref_type = ?", refType)
@@ -264,7 +267,7 @@ func (s *FileService) GetReferencesByUser(userID int64, refType string) ([]model
 }
 
 // CleanupOrphanFiles 清理孤儿文件（引用计数为0且创建时间超过指定天数）
-func (s *FileService) CleanupOrphanFiles(olderThanDays int) ([]string, error) {
+func (s *FileService) CleanupOrphanFiles(ctx context.Context, olderThanDays int) ([]string, error) {
 	log := logger.GetLogger()
 
 	// 计算截止时间
@@ -272,7 +275,7 @@ func (s *FileService) CleanupOrphanFiles(olderThanDays int) ([]string, error) {
 
 	// 查找符合条件的孤儿文件
 	var orphanFiles []models.FileStorage
-	if err := s.db.Where("ref_count = 0 AND created_at < ?", cutoffTime).
+	if err := s.db.WithContext(ctx).Where("ref_count = 0 AND created_at < ?", cutoffTime).
 		Find(&orphanFiles).Error; err != nil {
 		return nil, fmt.Errorf("failed to query orphan files: %w", err)
 	}
@@ -287,19 +290,37 @@ func (s *FileService) CleanupOrphanFiles(olderThanDays int) ([]string, error) {
 
 	// 删除文件
 	for _, file := range orphanFiles {
+		// 已迁移到对象存储的文件先删除对象，失败时保留记录等下次清理
+		localPath := LocalStoragePath(&file)
+		if IsRemoteFile(&file) {
+			store := objectstore.Default()
+			if store == nil {
+				log.Warnf("对象存储未配置，跳过已迁移的孤儿文件: id=%d", file.ID)
+				continue
+			}
+			if err := store.DeleteObject(ctx, localPath); err != nil {
+				log.Warnf("删除对象失败: key=%s, error=%v", localPath, err)
+				continue
+			}
+			deletedPaths = append(deletedPaths, file.StoragePath)
+			totalSize += file.FileSize
+		}
+
 		// 删除物理文件
-		fullPath := filepath.Join("./", file.StoragePath)
+		fullPath := filepath.Join("./", localPath)
 		if err := os.Remove(fullPath); err != nil {
 			if !os.IsNotExist(err) {
 				log.Warnf("删除文件失败: path=%s, error=%v", fullPath, err)
 			}
-		} else {
+		} else if !IsRemoteFile(&file) {
 			deletedPaths = append(deletedPaths, file.StoragePath)
 			totalSize += file.FileSize
 		}
+		removeThumbnails(localPath)
+		removeAvatarVariants(localPath)
 
 		// 删除数据库记录
-		if err := s.db.Delete(&file).Error; err != nil {
+		if err := s.db.WithContext(ctx).Delete(&file).Error; err != nil {
 			log.Errorf("删除文件记录失败: id=%d, error=%v", file.ID, err)
 		}
 	}
@@ -311,7 +332,7 @@ func (s *FileService) CleanupOrphanFiles(olderThanDays int) ([]string, error) {
 }
 
 // GetStorageStats 获取存储统计信息
-func (s *FileService) GetStorageStats() (map[string]interface{}, error) {
+func (s *FileService) GetStorageStats(ctx context.Context) (map[string]interface{}, error) {
 	var stats struct {
 		TotalFiles    int64
 		TotalSize     int64
@@ -321,18 +342,18 @@ func (s *FileService) GetStorageStats() (map[string]interface{}, error) {
 	}
 
 	// 总文件数和总大小
-	s.db.Model(&models.FileStorage{}).Count(&stats.TotalFiles)
-	s.db.Model(&models.FileStorage{}).Select("COALESCE(SUM(file_size), 0)").Scan(&stats.TotalSize)
+	s.db.WithContext(ctx).Model(&models.FileStorage{}).Count(&stats.TotalFiles)
+	s.db.WithContext(ctx).Model(&models.FileStorage{}).Select("COALESCE(SUM(file_size), 0)").Scan(&stats.TotalSize)
 
 	// 总引用数
-	s.db.Model(&models.FileReference{}).Count(&stats.TotalRefs)
+	s.db.WithContext(ctx).Model(&models.FileReference{}).Count(&stats.TotalRefs)
 
 	// 孤儿文件数
-	s.db.Model(&models.FileStorage{}).Where("ref_count = 0").Count(&stats.OrphanFiles)
+	s.db.WithContext(ctx).Model(&models.FileStorage{}).Where("ref_count = 0").Count(&stats.OrphanFiles)
 
 	// 平均引用计数
 	if stats.TotalFiles > 0 {
-		s.db.Model(&models.FileStorage{}).Select("AVG(ref_count)").Scan(&stats.AverageRefCount)
+		s.db.WithContext(ctx).Model(&models.FileStorage{}).Select("AVG(ref_count)").Scan(&stats.AverageRefCount)
 	}
 
 	return map[string]interface{}{
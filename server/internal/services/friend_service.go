@@ -1,11 +1,13 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"gorm.io/gorm"
 
+	"gochat/internal/cache"
 	"gochat/internal/database"
 	"gochat/internal/logger"
 	"gochat/internal/models"
@@ -38,13 +40,13 @@ type FriendInfo struct {
 }
 
 // checkFriendshipExists 高效检查好友关系是否存在
-func (s *FriendService) checkFriendshipExists(userID, friendID int64) (bool, error) {
+func (s *FriendService) checkFriendshipExists(ctx context.Context, userID, friendID int64) (bool, error) {
 	var count int64
 
-	// 使用超时控制和优化的查询
-	err := database.QueryWithTimeout(3*time.Second, func(db *gorm.DB) error {
+	// 使用超时控制和优化的查询，走主库保证刚添加/删除的关系可见
+	err := database.QueryWithTimeoutCtx(ctx, 3*time.Second, func(db *gorm.DB) error {
 		// 使用UNION查询，比OR更高效
-		return db.Raw(`
+		return database.Primary(db).Raw(`
 			SELECT COUNT(*) FROM (
 				SELECT 1 FROM friend_relations WHERE user_id = ? AND friend_id = ?
 				UNION
@@ -57,7 +59,7 @@ func (s *FriendService) checkFriendshipExists(userID, friendID int64) (bool, err
 }
 
 // AddFriend 添加好友
-func (s *FriendService) AddFriend(userID, friendID int64) error {
+func (s *FriendService) AddFriend(ctx context.Context, userID, friendID int64) error {
 	// 不能添加自己为好友
 	if userID == friendID {
 		return errors.New("cannot add yourself as friend")
@@ -65,7 +67,7 @@ func (s *FriendService) AddFriend(userID, friendID int64) error {
 
 	// 检查用户是否存在（使用超时控制）
 	var user, friend models.User
-	err := database.QueryWithTimeout(3*time.Second, func(db *gorm.DB) error {
+	err := database.QueryWithTimeoutCtx(ctx, 3*time.Second, func(db *gorm.DB) error {
 		if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
 			return err
 		}
@@ -77,9 +79,13 @@ func (s *FriendService) AddFriend(userID, friendID int64) error {
 		}
 		return err
 	}
+	// 机器人账号只属于所在的群，不能添加为好友
+	if friend.IsBot {
+		return errors.New("cannot add a bot as friend")
+	}
 
 	// 检查是否已经是好友（使用优化的查询）
-	exists, err := s.checkFriendshipExists(userID, friendID)
+	exists, err := s.checkFriendshipExists(ctx, userID, friendID)
 	if err != nil {
 		return err
 	}
@@ -88,7 +94,7 @@ func (s *FriendService) AddFriend(userID, friendID int64) error {
 	}
 
 	// 创建双向好友关系（使用超时控制和事务）
-	err = database.QueryWithTimeout(5*time.Second, func(db *gorm.DB) error {
+	err = database.QueryWithTimeoutCtx(ctx, 5*time.Second, func(db *gorm.DB) error {
 		return db.Transaction(func(tx *gorm.DB) error {
 			// 创建第一个方向的关系
 			if err := tx.Create(&models.FriendRelation{
@@ -117,18 +123,20 @@ func (s *FriendService) AddFriend(userID, friendID int64) error {
 	}
 
 	// 创建互相的会话
-	s.createConversation(userID, friendID, 1) // 1-单聊
-	s.createConversation(friendID, userID, 1)
+	s.createConversation(ctx, userID, friendID, 1) // 1-单聊
+	s.createConversation(ctx, friendID, userID, 1)
+	InvalidateConversationList(userID, friendID)
+	s.invalidateFriendIDs(userID, friendID)
 
 	return nil
 }
 
 // RemoveFriend 删除好友
-func (s *FriendService) RemoveFriend(userID, friendID int64) error {
+func (s *FriendService) RemoveFriend(ctx context.Context, userID, friendID int64) error {
 	log := logger.GetLogger()
 
 	// 使用超时控制和事务删除双向好友关系
-	err := database.QueryWithTimeout(10*time.Second, func(db *gorm.DB) error {
+	err := database.QueryWithTimeoutCtx(ctx, 10*time.Second, func(db *gorm.DB) error {
 		return db.Transaction(func(tx *gorm.DB) error {
 			// 删除双向好友关系
 			if err := tx.Where("user_id = ? AND friend_id = ?", userID, friendID).Delete(&models.FriendRelation{}).Error; err != nil {
@@ -138,10 +146,9 @@ func (s *FriendService) RemoveFriend(userID, friendID int64) error {
 				return err
 			}
 
-			// 删除相关的消息
-			if err := tx.Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)",
-				userID, friendID, friendID, userID).Delete(&models.Message{}).Error; err != nil {
-				log.Warnf("Failed to delete messages for users %d and %d: %v", userID, friendID, err)
+			// 聊天记录同时属于双方，只对删除方隐藏，对方的历史不受影响
+			if err := hideMessagesForUser(tx, userID, friendID); err != nil {
+				log.Warnf("Failed to hide messages between users %d and %d: %v", userID, friendID, err)
 			}
 
 			// 删除相关的会话
@@ -159,17 +166,19 @@ func (s *FriendService) RemoveFriend(userID, friendID int64) error {
 	if err != nil {
 		return err
 	}
+	InvalidateConversationList(userID, friendID)
+	s.invalidateFriendIDs(userID, friendID)
 
 	log.Infof("Successfully removed friend relationship and cleaned up data for users %d and %d", userID, friendID)
 	return nil
 }
 
 // GetFriends 获取好友列表
-func (s *FriendService) GetFriends(userID int64) ([]FriendInfo, error) {
+func (s *FriendService) GetFriends(ctx context.Context, userID int64) ([]FriendInfo, error) {
 	var friends []FriendInfo
 
 	// 查询好友关系，获取好友信息
-	rows, err := s.db.Raw(`
+	rows, err := s.db.WithContext(ctx).Raw(`
 		SELECT u.id, u.phone, u.nickname, u.avatar, u.gender, u.signature
 		FROM friend_relations fr
 		JOIN users u ON fr.friend_id = u.id
@@ -186,17 +195,37 @@ func (s *FriendService) GetFriends(userID int64) ([]FriendInfo, error) {
 		if err := rows.Scan(&friend.ID, &friend.Phone, &friend.Nickname, &friend.Avatar, &friend.Gender, &friend.Signature); err != nil {
 			return nil, err
 		}
+		friend.Avatar = PublicURL(friend.Avatar)
 		friends = append(friends, friend)
 	}
 
 	return friends, nil
 }
 
-// GetFriendIDs 获取好友ID列表
-func (s *FriendService) GetFriendIDs(userID int64) ([]int64, error) {
+// GetFriendIDs 获取好友ID列表（缓存优先）
+func (s *FriendService) GetFriendIDs(ctx context.Context, userID int64) ([]int64, error) {
+	cacheService := cache.GetCacheService()
+	if cacheService != nil {
+		if cached, err := cacheService.GetFriendIDs(userID); err == nil && cached != nil {
+			return cached, nil
+		}
+	}
+
+	friendIDs, err := s.queryFriendIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if cacheService != nil {
+		_ = cacheService.CacheFriendIDs(userID, friendIDs) // 忽略缓存写入错误
+	}
+	return friendIDs, nil
+}
+
+// queryFriendIDs 从数据库查询好友ID列表
+func (s *FriendService) queryFriendIDs(ctx context.Context, userID int64) ([]int64, error) {
 	var friendIDs []int64
 
-	rows, err := s.db.Raw(`
+	rows, err := s.db.WithContext(ctx).Raw(`
 		SELECT fr.friend_id
 		FROM friend_relations fr
 		WHERE fr.user_id = ?
@@ -218,21 +247,22 @@ func (s *FriendService) GetFriendIDs(userID int64) ([]int64, error) {
 }
 
 // SearchUsers 搜索用户
-func (s *FriendService) SearchUsers(keyword string, currentUserID int64, limit int) ([]FriendInfo, error) {
+func (s *FriendService) SearchUsers(ctx context.Context, keyword string, currentUserID int64, limit int) ([]FriendInfo, error) {
 	if limit <= 0 || limit > 50 {
 		limit = 20
 	}
 
 	var users []FriendInfo
 
-	rows, err := s.db.Raw(`
+	rows, err := s.db.WithContext(ctx).Raw(`
 		SELECT id, phone, nickname, avatar
 		FROM users
 		WHERE (phone LIKE ? OR nickname LIKE ?)
 		AND id != ?
+		AND is_bot = ?
 		ORDER BY nickname
 		LIMIT ?
-	`, "%"+keyword+"%", "%"+keyword+"%", currentUserID, limit).Rows()
+	`, "%"+keyword+"%", "%"+keyword+"%", currentUserID, false, limit).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -243,6 +273,7 @@ func (s *FriendService) SearchUsers(keyword string, currentUserID int64, limit i
 		if err := rows.Scan(&user.ID, &user.Phone, &user.Nickname, &user.Avatar); err != nil {
 			return nil, err
 		}
+		user.Avatar = PublicURL(user.Avatar)
 		users = append(users, user)
 	}
 
@@ -250,8 +281,8 @@ func (s *FriendService) SearchUsers(keyword string, currentUserID int64, limit i
 }
 
 // IsFriend 检查是否是好友（使用优化查询）
-func (s *FriendService) IsFriend(userID, friendID int64) bool {
-	exists, err := s.checkFriendshipExists(userID, friendID)
+func (s *FriendService) IsFriend(ctx context.Context, userID, friendID int64) bool {
+	exists, err := s.checkFriendshipExists(ctx, userID, friendID)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to check friendship: %v", err)
 		return false
@@ -259,18 +290,32 @@ func (s *FriendService) IsFriend(userID, friendID int64) bool {
 	return exists
 }
 
+// invalidateFriendIDs 好友关系变更后删除双方的好友ID列表缓存
+func (s *FriendService) invalidateFriendIDs(userIDs ...int64) {
+	if cacheService := cache.GetCacheService(); cacheService != nil {
+		if err := cacheService.InvalidateFriendIDs(userIDs...); err != nil {
+			logger.GetLogger().Warnf("删除好友ID列表缓存失败: %v", err)
+		}
+	}
+}
+
 // createConversation 创建会话
-func (s *FriendService) createConversation(userID, targetID int64, convType int) {
+func (s *FriendService) createConversation(ctx context.Context, userID, targetID int64, convType int) {
+	// 重新添加好友时，之前的历史消息视为已读
+	latest, err := latestMessageID(s.db.WithContext(ctx), userID, targetID, convType)
+	if err != nil {
+		logger.GetLogger().Warnf("Failed to get latest message between users %d and %d: %v", userID, targetID, err)
+	}
 	conversation := &models.Conversation{
-		UserID:   userID,
-		Type:     convType,
-		TargetID: targetID,
-		UnreadCount: 0,
-		UpdatedAt: time.Now(),
+		UserID:        userID,
+		Type:          convType,
+		TargetID:      targetID,
+		LastReadMsgID: latest,
+		UpdatedAt:     time.Now(),
 	}
 
-	// 使用FirstOrCreate避免重复创建
-	s.db.Where(models.Conversation{
+	// 使用FirstOrCreate避免重复创建（查询走主库）
+	database.Primary(s.db.WithContext(ctx)).Where(models.Conversation{
 		UserID:   userID,
 		Type:     convType,
 		TargetID: targetID,
@@ -1,14 +1,21 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
 
+	"gochat/internal/cache"
 	"gochat/internal/database"
 	"gochat/internal/models"
 )
 
+// ErrGroupNotFound 群组不存在或已解散
+var ErrGroupNotFound = errors.New("group not found")
+
 type GroupService struct {
 	db *gorm.DB
 }
@@ -27,40 +34,75 @@ func NewGroupServiceWithDB(db *gorm.DB) *GroupService {
 }
 
 // 获取群成员列表
-func (s *GroupService) GetGroupMembers(groupID int64) ([]models.GroupMember, error) {
+// 每条群消息都会调用，依次查询进程内L1、Redis和数据库
+func (s *GroupService) GetGroupMembers(ctx context.Context, groupID int64) ([]models.GroupMember, error) {
+	l1Key := strconv.FormatInt(groupID, 10)
+	if cached, ok := cache.L1(cache.L1GroupMembers).Get(l1Key); ok {
+		return append([]models.GroupMember(nil), cached.([]models.GroupMember)...), nil
+	}
+
+	cacheService := cache.GetCacheService()
+	if cacheService != nil {
+		var members []models.GroupMember
+		if err := cacheService.GetGroupMembers(groupID, &members); err == nil && members != nil {
+			cache.L1(cache.L1GroupMembers).Set(l1Key, append([]models.GroupMember(nil), members...))
+			return members, nil
+		}
+	}
+
 	var members []models.GroupMember
-	err := s.db.Where("group_id = ?", groupID).Find(&members).Error
-	return members, err
+	if err := s.db.WithContext(ctx).Where("group_id = ?", groupID).Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	if cacheService != nil {
+		cacheService.CacheGroupMembers(groupID, members)
+	}
+	cache.L1(cache.L1GroupMembers).Set(l1Key, append([]models.GroupMember(nil), members...))
+	return members, nil
+}
+
+// invalidateGroupMembers 群成员变更后清除Redis和所有实例的L1缓存
+func (s *GroupService) invalidateGroupMembers(groupID int64) {
+	if cacheService := cache.GetCacheService(); cacheService != nil {
+		cacheService.InvalidateGroupCache(groupID)
+		return
+	}
+	cache.PublishInvalidation(cache.ScopeGroup, groupID)
 }
 
 // 检查用户是否在群中
-func (s *GroupService) IsUserInGroup(userID, groupID int64) (bool, error) {
+func (s *GroupService) IsUserInGroup(ctx context.Context, userID, groupID int64) (bool, error) {
 	var count int64
-	err := s.db.Model(&models.GroupMember{}).
+	err := s.db.WithContext(ctx).Model(&models.GroupMember{}).
 		Where("user_id = ? AND group_id = ?", userID, groupID).
 		Count(&count).Error
 	return count > 0, err
 }
 
 // 创建群组
-func (s *GroupService) CreateGroup(group *models.Group) error {
-	return s.db.Create(group).Error
+func (s *GroupService) CreateGroup(ctx context.Context, group *models.Group) error {
+	return s.db.WithContext(ctx).Create(group).Error
 }
 
 // 添加群成员
-func (s *GroupService) AddGroupMember(groupID, userID int64) error {
+func (s *GroupService) AddGroupMember(ctx context.Context, groupID, userID int64) error {
 	member := &models.GroupMember{
 		GroupID:  groupID,
 		UserID:   userID,
 		JoinedAt: time.Now(),
 	}
-	return s.db.Create(member).Error
+	if err := s.db.WithContext(ctx).Create(member).Error; err != nil {
+		return err
+	}
+	s.invalidateGroupMembers(groupID)
+	return nil
 }
 
 // 移除群成员
-func (s *GroupService) RemoveGroupMember(groupID, userID int64) error {
+func (s *GroupService) RemoveGroupMember(ctx context.Context, groupID, userID int64) error {
 	// 开启事务确保数据一致性
-	tx := s.db.Begin()
+	tx := s.db.WithContext(ctx).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -88,23 +130,85 @@ func (s *GroupService) RemoveGroupMember(groupID, userID int64) error {
 		return err
 	}
 
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	s.invalidateGroupMembers(groupID)
+	InvalidateConversationList(userID)
+	return nil
+}
+
+// DissolveGroup 解散群组：删除群成员、群会话和群机器人账号，群组软删除，历史消息保留
+// 返回解散前的成员ID，供调用方通知成员
+func (s *GroupService) DissolveGroup(ctx context.Context, groupID int64) ([]int64, error) {
+	var memberIDs []int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Group{}, groupID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrGroupNotFound
+		}
+		if err := tx.Model(&models.GroupMember{}).Where("group_id = ?", groupID).Pluck("user_id", &memberIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("type = ? AND target_id = ?", models.ConversationTypeGroup, groupID).Delete(&models.Conversation{}).Error; err != nil {
+			return err
+		}
+		var botUserIDs []int64
+		if err := tx.Model(&models.Bot{}).Where("group_id = ?", groupID).Pluck("user_id", &botUserIDs).Error; err != nil {
+			return err
+		}
+		if len(botUserIDs) == 0 {
+			return nil
+		}
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.Bot{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, botUserIDs).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateGroupMembers(groupID)
+	InvalidateConversationList(memberIDs...)
+	return memberIDs, nil
 }
 
 // 获取群组信息
-func (s *GroupService) GetGroup(groupID int64) (*models.Group, error) {
+func (s *GroupService) GetGroup(ctx context.Context, groupID int64) (*models.Group, error) {
 	var group models.Group
-	err := s.db.First(&group, groupID).Error
+	err := s.db.WithContext(ctx).First(&group, groupID).Error
 	if err != nil {
 		return nil, err
 	}
 	return &group, nil
 }
 
+// GetGroups 批量获取群组信息，不存在或已解散的群组不返回
+func (s *GroupService) GetGroups(ctx context.Context, groupIDs []int64) (map[int64]*models.Group, error) {
+	groups := make(map[int64]*models.Group, len(groupIDs))
+	if len(groupIDs) == 0 {
+		return groups, nil
+	}
+	var rows []models.Group
+	if err := s.db.WithContext(ctx).Where("id IN ?", groupIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		groups[rows[i].ID] = &rows[i]
+	}
+	return groups, nil
+}
+
 // 获取用户参与的群组
-func (s *GroupService) GetUserGroups(userID int64) ([]models.Group, error) {
+func (s *GroupService) GetUserGroups(ctx context.Context, userID int64) ([]models.Group, error) {
 	var groups []models.Group
-	err := s.db.Table("groups").
+	err := s.db.WithContext(ctx).Table("groups").
 		Joins("JOIN group_members ON groups.id = group_members.group_id").
 		Where("group_members.user_id = ?", userID).
 		Find(&groups).Error
@@ -112,9 +216,9 @@ func (s *GroupService) GetUserGroups(userID int64) ([]models.Group, error) {
 }
 
 // CreateGroupWithMembers 创建群组并添加初始成员
-func (s *GroupService) CreateGroupWithMembers(ownerID int64, groupName string, memberIDs []int64) (*models.Group, error) {
+func (s *GroupService) CreateGroupWithMembers(ctx context.Context, ownerID int64, groupName string, memberIDs []int64) (*models.Group, error) {
 	// 开启事务
-	tx := s.db.Begin()
+	tx := s.db.WithContext(ctx).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -144,6 +248,7 @@ func (s *GroupService) CreateGroupWithMembers(ownerID int64, groupName string, m
 	}
 
 	// 添加其他成员
+	members := []int64{ownerID}
 	for _, memberID := range memberIDs {
 		// 避免重复添加群主
 		if memberID == ownerID {
@@ -158,6 +263,19 @@ func (s *GroupService) CreateGroupWithMembers(ownerID int64, groupName string, m
 			tx.Rollback()
 			return nil, err
 		}
+		members = append(members, memberID)
+	}
+
+	// 群组创建事件随事务一起提交
+	if err := enqueueDomainEvent(tx, DomainGroupCreated, group.ID, GroupCreatedData{
+		GroupID:   group.ID,
+		Name:      group.Name,
+		OwnerID:   ownerID,
+		MemberIDs: members,
+		CreatedAt: group.CreatedAt.UnixMilli(),
+	}); err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
 	// 提交事务
@@ -177,39 +295,51 @@ type GroupMemberInfo struct {
 	Avatar   string `json:"avatar"`
 	JoinedAt string `json:"joined_at"`
 	IsOwner  bool   `json:"is_owner"`
+	IsBot    bool   `json:"is_bot"`
 }
 
 // GetGroupMembersWithUserInfo 获取群成员列表（含用户信息）
-func (s *GroupService) GetGroupMembersWithUserInfo(groupID int64) ([]GroupMemberInfo, error) {
+func (s *GroupService) GetGroupMembersWithUserInfo(ctx context.Context, groupID int64) ([]GroupMemberInfo, error) {
 	var members []GroupMemberInfo
-	err := s.db.Raw(`
+	err := s.db.WithContext(ctx).Raw(`
 		SELECT
 			gm.id,
 			gm.user_id,
 			u.nickname as username,
 			u.nickname,
 			u.avatar,
-			DATE_FORMAT(gm.joined_at, '%Y-%m-%d %H:%i:%s') as joined_at,
-			CASE WHEN g.owner_id = gm.user_id THEN 1 ELSE 0 END as is_owner
+			`+database.DateTimeExpr(s.db, "gm.joined_at")+` as joined_at,
+			CASE WHEN g.owner_id = gm.user_id THEN 1 ELSE 0 END as is_owner,
+			u.is_bot
 		FROM group_members gm
 		LEFT JOIN users u ON gm.user_id = u.id
-		LEFT JOIN `+"`groups`"+` g ON gm.group_id = g.id
+		LEFT JOIN `+database.QuoteTable(s.db, "groups")+` g ON gm.group_id = g.id
 		WHERE gm.group_id = ?
 		ORDER BY is_owner DESC, gm.joined_at ASC
 	`, groupID).Scan(&members).Error
+	for i := range members {
+		members[i].Avatar = PublicURL(members[i].Avatar)
+	}
 	return members, err
 }
 
 // AddGroupMembers 批量添加群成员
-func (s *GroupService) AddGroupMembers(groupID int64, userIDs []int64) error {
+func (s *GroupService) AddGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error {
 	// 开启事务
-	tx := s.db.Begin()
+	tx := s.db.WithContext(ctx).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
 		}
 	}()
 
+	// 新成员看不到入群前的未读消息，已读位置从当前最新消息开始
+	latest, err := latestMessageID(tx, 0, groupID, models.ConversationTypeGroup)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	addedCount := 0
 	addedUserIDs := []int64{}
 
@@ -235,11 +365,11 @@ func (s *GroupService) AddGroupMembers(groupID int64, userIDs []int64) error {
 
 		// 为新成员创建群会话
 		conversation := &models.Conversation{
-			UserID:      userID,
-			Type:        models.ConversationTypeGroup,
-			TargetID:    groupID,
-			UnreadCount: 0,
-			UpdatedAt:   time.Now(),
+			UserID:        userID,
+			Type:          models.ConversationTypeGroup,
+			TargetID:      groupID,
+			LastReadMsgID: latest,
+			UpdatedAt:     time.Now(),
 		}
 		if err := tx.Create(conversation).Error; err != nil {
 			tx.Rollback()
@@ -260,5 +390,12 @@ func (s *GroupService) AddGroupMembers(groupID int64, userIDs []int64) error {
 	}
 
 	// 提交事务
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	if addedCount > 0 {
+		s.invalidateGroupMembers(groupID)
+		InvalidateConversationList(addedUserIDs...)
+	}
+	return nil
 }
\ No newline at end of file
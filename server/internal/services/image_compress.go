@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+
+	"gochat/internal/config"
+	"gochat/internal/utils"
+)
+
+// CompressImage 长边超过配置尺寸的图片按原格式缩小并重新编码，JPEG会先按EXIF方向转正
+// 返回nil表示无需压缩（未开启、尺寸未超出或格式不支持重新编码，如GIF动图和WebP）
+func CompressImage(file io.ReadSeeker, cfg config.ImageUploadConfig) (multipart.File, error) {
+	if cfg.MaxDimension <= 0 {
+		return nil, nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	imgConfig, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil, nil
+	}
+	if imgConfig.Width <= cfg.MaxDimension && imgConfig.Height <= cfg.MaxDimension {
+		return nil, nil
+	}
+
+	img, err := decodeImageData(data)
+	if err != nil {
+		return nil, err
+	}
+	img = utils.ResizeToFit(img, cfg.MaxDimension)
+
+	var buf bytes.Buffer
+	if format == "png" {
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, img)
+	} else {
+		quality := cfg.Quality
+		if quality < 1 || quality > 100 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytesFile{bytes.NewReader(buf.Bytes())}, nil
+}
+
+// StripMetadata 去除图片中的EXIF（含GPS定位）、XMP等元数据，返回nil表示没有需要去除的内容
+func StripMetadata(file io.ReadSeeker) (multipart.File, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	stripped, changed := utils.StripImageMetadata(data)
+	if !changed {
+		return nil, nil
+	}
+	return bytesFile{bytes.NewReader(stripped)}, nil
+}
+
+// bytesFile 内存中的文件，用于把压缩结果交给UploadFile
+type bytesFile struct {
+	*bytes.Reader
+}
+
+func (bytesFile) Close() error { return nil }
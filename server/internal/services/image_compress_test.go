@@ -0,0 +1,80 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+// withOrientation 在JPEG的SOI之后插入只包含方向标记的EXIF段
+func withOrientation(jpegData []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	payload := append(append([]byte("Exif\x00\x00"), tiff...), append(entry, 0, 0, 0, 0)...)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(append(out, segment...), payload...)
+	return append(out, jpegData[2:]...)
+}
+
+func decodedSize(t *testing.T, data []byte) (int, int, string) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	return cfg.Width, cfg.Height, format
+}
+
+func TestCompressImageResizesOversizedImages(t *testing.T) {
+	cfg := config.ImageUploadConfig{MaxDimension: 100, Quality: 80}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 200))))
+	compressed, err := CompressImage(bytes.NewReader(buf.Bytes()), cfg)
+	require.NoError(t, err)
+	require.NotNil(t, compressed)
+	data := new(bytes.Buffer)
+	_, err = data.ReadFrom(compressed)
+	require.NoError(t, err)
+	w, h, format := decodedSize(t, data.Bytes())
+	assert.Equal(t, []int{100, 50}, []int{w, h})
+	assert.Equal(t, "png", format, "保留原格式")
+
+	// 未超出尺寸或关闭压缩时不处理
+	small := new(bytes.Buffer)
+	require.NoError(t, png.Encode(small, image.NewRGBA(image.Rect(0, 0, 80, 60))))
+	compressed, err = CompressImage(bytes.NewReader(small.Bytes()), cfg)
+	require.NoError(t, err)
+	assert.Nil(t, compressed)
+	compressed, err = CompressImage(bytes.NewReader(buf.Bytes()), config.ImageUploadConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, compressed)
+}
+
+func TestCompressImageAppliesEXIFOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 200)), nil))
+	rotated := withOrientation(buf.Bytes(), 6)
+
+	compressed, err := CompressImage(bytes.NewReader(rotated), config.ImageUploadConfig{MaxDimension: 100, Quality: 80})
+	require.NoError(t, err)
+	require.NotNil(t, compressed)
+	data := new(bytes.Buffer)
+	_, err = data.ReadFrom(compressed)
+	require.NoError(t, err)
+	w, h, format := decodedSize(t, data.Bytes())
+	assert.Equal(t, []int{50, 100}, []int{w, h}, "竖拍照片转正后宽高互换")
+	assert.Equal(t, "jpeg", format)
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/utils"
+)
+
+func readAll(t *testing.T, r io.Reader) []byte {
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return data
+}
+
+func TestStripMetadataKeepsJPEGOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 20)), nil))
+	withExif := withOrientation(buf.Bytes(), 6)
+	// 在EXIF之后追加一段注释，模拟相机写入的其他元数据
+	comment := []byte("GPS 31.2304N 121.4737E")
+	com := append([]byte{0xFF, 0xFE, 0, byte(len(comment) + 2)}, comment...)
+	data := append(append(append([]byte{}, withExif[:2]...), com...), withExif[2:]...)
+
+	stripped, err := StripMetadata(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NotNil(t, stripped)
+	out := readAll(t, stripped)
+
+	assert.False(t, bytes.Contains(out, comment))
+	assert.Equal(t, 6, utils.JPEGOrientation(out), "方向标记保留")
+	_, err = jpeg.Decode(bytes.NewReader(out))
+	assert.NoError(t, err)
+
+	// 没有元数据时不处理
+	stripped, err = StripMetadata(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Nil(t, stripped)
+}
+
+func TestStripMetadataRemovesPNGTextChunks(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+
+	text := []byte("Location\x00Shanghai")
+	chunk := make([]byte, 8, 12+len(text))
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)))
+	copy(chunk[4:], "tEXt")
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	// 插入到IHDR块之后
+	ihdrEnd := 8 + 12 + 13
+	data := append(append(append([]byte{}, buf.Bytes()[:ihdrEnd]...), chunk...), buf.Bytes()[ihdrEnd:]...)
+
+	stripped, err := StripMetadata(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NotNil(t, stripped)
+	out := readAll(t, stripped)
+	assert.Equal(t, buf.Bytes(), out)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/models"
+)
+
+// possessionSampleSize 秒传时客户端需要提交哈希的文件片段长度
+const possessionSampleSize = 64 << 10
+
+// PossessionChallenge 秒传校验片段：客户端提交文件中[offset, offset+length)字节的SHA256，
+// 证明确实持有该文件，而不只是知道哈希（消息内容中的文件名即哈希）
+type PossessionChallenge struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// NewPossessionChallenge 按用户和文件确定校验片段，同一用户对同一文件的片段固定，其他用户无法复用
+func NewPossessionChallenge(secret string, userID int64, file *models.FileStorage) PossessionChallenge {
+	length := min(file.FileSize, possessionSampleSize)
+	challenge := PossessionChallenge{Length: length}
+	if span := file.FileSize - length; span > 0 {
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "possession:%d:%s", userID, file.Hash)
+		challenge.Offset = int64(binary.BigEndian.Uint64(mac.Sum(nil)) % uint64(span+1))
+	}
+	return challenge
+}
+
+// FindInstantUploadFile 查找可以秒传的文件：哈希和大小一致且原文件在本地（校验片段需要读取原文件），找不到时返回nil
+func (s *FileService) FindInstantUploadFile(ctx context.Context, hash string, size int64) (*models.FileStorage, error) {
+	var file models.FileStorage
+	err := s.db.WithContext(ctx).Where("hash = ? AND file_size = ?", hash, size).First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fileExists(LocalStoragePath(&file)) {
+		return nil, nil
+	}
+	return &file, nil
+}
+
+// VerifyPossession 校验客户端提交的片段哈希（十六进制）
+func VerifyPossession(file *models.FileStorage, challenge PossessionChallenge, proof string) (bool, error) {
+	f, err := os.Open(LocalStoragePath(file))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(f, challenge.Offset, challenge.Length)); err != nil {
+		return false, err
+	}
+	expected := hex.EncodeToString(hasher.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(proof)), nil
+}
+
+// InstantUpload 秒传：为已存在的文件创建上传引用，与上传时命中去重的处理相同
+func (s *FileService) InstantUpload(ctx context.Context, file *models.FileStorage, userID int64, refType string) error {
+	if err := s.IncrementRefCount(ctx, file.ID); err != nil {
+		return fmt.Errorf("failed to increment ref count: %w", err)
+	}
+	if err := s.CreateReference(ctx, file.ID, userID, refType, 0); err != nil {
+		s.DecrementRefCount(ctx, file.ID)
+		return fmt.Errorf("failed to create reference: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstantUploadRequiresPossession(t *testing.T) {
+	t.Chdir(t.TempDir())
+	fileService := &FileService{db: newTestDB(t)}
+	alice := createTestUser(t, fileService.db, "13800000001", "alice")
+	bob := createTestUser(t, fileService.db, "13800000002", "bob")
+
+	content := bytes.Repeat([]byte("0123456789"), 20000)
+	file := writeStoredFile(t, fileService, string(content))
+
+	found, err := fileService.FindInstantUploadFile(context.Background(), file.Hash, file.FileSize+1)
+	require.NoError(t, err)
+	assert.Nil(t, found, "大小不一致")
+	found, err = fileService.FindInstantUploadFile(context.Background(), file.Hash, file.FileSize)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+
+	challenge := NewPossessionChallenge("secret", alice.ID, found)
+	assert.Equal(t, int64(possessionSampleSize), challenge.Length)
+	assert.LessOrEqual(t, challenge.Offset+challenge.Length, file.FileSize)
+	assert.Equal(t, challenge, NewPossessionChallenge("secret", alice.ID, found), "同一用户的片段固定")
+
+	sum := sha256.Sum256(content[challenge.Offset : challenge.Offset+challenge.Length])
+	proof := hex.EncodeToString(sum[:])
+	valid, err := VerifyPossession(found, challenge, proof)
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	bobChallenge := NewPossessionChallenge("secret", bob.ID, found)
+	if bobChallenge != challenge {
+		valid, err = VerifyPossession(found, bobChallenge, proof)
+		require.NoError(t, err)
+		assert.False(t, valid, "其他用户不能复用校验结果")
+	}
+
+	require.NoError(t, fileService.InstantUpload(context.Background(), found, alice.ID, "chat_file"))
+	require.NoError(t, fileService.db.First(file, file.ID).Error)
+	assert.Equal(t, 2, file.RefCount)
+	refs, err := fileService.GetReferencesByUser(context.Background(), alice.ID, "chat_file")
+	require.NoError(t, err)
+	assert.Len(t, refs, 1)
+
+	// 原文件已迁移到对象存储并删除本地副本时不能秒传
+	require.NoError(t, os.Remove(file.StoragePath))
+	found, err = fileService.FindInstantUploadFile(context.Background(), file.Hash, file.FileSize)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func TestPossessionChallengeSmallFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	file := writeStoredFile(t, &FileService{db: newTestDB(t)}, "tiny")
+	assert.Equal(t, PossessionChallenge{Offset: 0, Length: 4}, NewPossessionChallenge("secret", 1, file))
+}
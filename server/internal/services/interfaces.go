@@ -1,61 +1,63 @@
 package services
 
 import (
-	"time"
+	"context"
 
 	"gochat/internal/models"
 )
 
 // MessageServiceInterface 消息服务接口
 type MessageServiceInterface interface {
-	SaveMessage(msg *models.Message) (int64, error)
-	GetPrivateMessages(userID1, userID2 int64, page, pageSize int) ([]models.Message, int64, error)
-	GetGroupMessages(groupID int64, page, pageSize int) ([]models.Message, int64, error)
-	GetLastMessage(userID, targetID int64, isGroup bool) (*models.Message, error)
-	GetUnreadCount(userID, targetID int64, isGroup bool, lastReadTime time.Time) (int64, error)
-	MarkAsRead(userID, messageID int64) error
-	GetPrivateMessagesWithUserInfo(userID1, userID2 int64, page, pageSize int) ([]MessageInfo, int64, error)
-	GetGroupMessagesWithUserInfo(groupID int64, page, pageSize int) ([]MessageInfo, int64, error)
+	SaveMessage(ctx context.Context, msg *models.Message) (int64, error)
+	GetPrivateMessages(ctx context.Context, userID1, userID2 int64, page, pageSize int) ([]models.Message, bool, error)
+	GetGroupMessages(ctx context.Context, groupID int64, page, pageSize int) ([]models.Message, bool, error)
+	GetLastMessage(ctx context.Context, userID, targetID int64, isGroup bool) (*models.Message, error)
+	GetUnreadCount(ctx context.Context, userID, targetID int64, isGroup bool, lastReadMsgID int64) (int64, error)
+	MarkAsRead(ctx context.Context, userID, messageID int64) error
+	GetPrivateMessagesWithUserInfo(ctx context.Context, userID1, userID2 int64, cursor MessageCursor) ([]MessageInfo, bool, error)
+	GetGroupMessagesWithUserInfo(ctx context.Context, groupID, userID int64, cursor MessageCursor) ([]MessageInfo, bool, error)
+	SearchMessages(ctx context.Context, userID int64, search MessageSearch, cursor MessageCursor) ([]MessageInfo, bool, error)
+	DeleteMessage(ctx context.Context, userID, messageID int64, scope string) error
 }
 
 // ConversationServiceInterface 会话服务接口
 type ConversationServiceInterface interface {
-	GetConversations(userID int64) ([]ConversationInfo, error)
-	ClearUnreadCount(userID, conversationID int64) error
-	UpdateLastMessage(userID, targetID, messageID int64, content string) error
-	IncrementUnreadCount(userID, targetID int64, conversationType int) error
-	CreateOrUpdateConversation(userID, targetID int64, conversationType int) (*models.Conversation, error)
-	GetConversationByID(conversationID, userID int64) (*models.Conversation, error)
+	GetConversations(ctx context.Context, userID int64) ([]ConversationInfo, error)
+	ClearUnreadCount(ctx context.Context, userID, conversationID int64) error
+	MarkRead(ctx context.Context, userID, conversationID, messageID int64) error
+	UpdateLastMessage(ctx context.Context, userID, targetID, messageID int64, content string) error
+	CreateOrUpdateConversation(ctx context.Context, userID, targetID int64, conversationType int) (*models.Conversation, error)
+	GetConversationByID(ctx context.Context, conversationID, userID int64) (*models.Conversation, error)
 }
 
 // FriendServiceInterface 好友服务接口
 type FriendServiceInterface interface {
-	AddFriend(userID, friendID int64) error
-	RemoveFriend(userID, friendID int64) error
-	GetFriends(userID int64) ([]FriendInfo, error)
-	GetFriendIDs(userID int64) ([]int64, error)
-	IsFriend(userID, friendID int64) bool
-	SearchUsers(keyword string, currentUserID int64, limit int) ([]FriendInfo, error)
+	AddFriend(ctx context.Context, userID, friendID int64) error
+	RemoveFriend(ctx context.Context, userID, friendID int64) error
+	GetFriends(ctx context.Context, userID int64) ([]FriendInfo, error)
+	GetFriendIDs(ctx context.Context, userID int64) ([]int64, error)
+	IsFriend(ctx context.Context, userID, friendID int64) bool
+	SearchUsers(ctx context.Context, keyword string, currentUserID int64, limit int) ([]FriendInfo, error)
 }
 
 // GroupServiceInterface 群组服务接口
 type GroupServiceInterface interface {
-	CreateGroup(group *models.Group) error
-	GetGroup(groupID int64) (*models.Group, error)
-	GetGroupMembers(groupID int64) ([]models.GroupMember, error)
-	GetGroupMembersWithUserInfo(groupID int64) ([]GroupMemberInfo, error)
-	AddGroupMembers(groupID int64, userIDs []int64) error
-	RemoveGroupMember(groupID int64, userID int64) error
-	IsUserInGroup(userID, groupID int64) (bool, error)
-	GetUserGroups(userID int64) ([]models.Group, error)
+	CreateGroup(ctx context.Context, group *models.Group) error
+	GetGroup(ctx context.Context, groupID int64) (*models.Group, error)
+	GetGroupMembers(ctx context.Context, groupID int64) ([]models.GroupMember, error)
+	GetGroupMembersWithUserInfo(ctx context.Context, groupID int64) ([]GroupMemberInfo, error)
+	AddGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error
+	RemoveGroupMember(ctx context.Context, groupID int64, userID int64) error
+	IsUserInGroup(ctx context.Context, userID, groupID int64) (bool, error)
+	GetUserGroups(ctx context.Context, userID int64) ([]models.Group, error)
 }
 
 // UserServiceInterface 用户服务接口
 type UserServiceInterface interface {
-	Register(req *RegisterRequest) (*RegisterResponse, error)
-	Login(req *LoginRequest) (*LoginResponse, error)
-	Logout(userID int64) error
-	GetProfile(userID int64) (*UserInfo, error)
-	UpdateProfile(userID int64, req *UpdateProfileRequest) error
-	GetUserByID(userID int64) (*models.User, error)
+	Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error)
+	Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error)
+	Logout(ctx context.Context, userID int64) error
+	GetProfile(ctx context.Context, userID int64) (*UserInfo, error)
+	UpdateProfile(ctx context.Context, userID int64, req *UpdateProfileRequest) error
+	GetUserByID(ctx context.Context, userID int64) (*models.User, error)
 }
\ No newline at end of file
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+// 封禁来源
+const (
+	IPBanSourceManual = "manual"
+	IPBanSourceAuto   = "auto"
+)
+
+// Offense 自动封禁统计的违规类型
+type Offense string
+
+const (
+	OffenseLoginFailure Offense = "login_failure" // 登录失败
+	OffenseAuthFailure  Offense = "auth_failure"  // Token或API密钥无效
+	OffenseRateLimited  Offense = "rate_limited"  // 触发限流
+)
+
+// ErrIPBanNotFound 封禁记录不存在
+var ErrIPBanNotFound = errors.New("ip ban not found")
+
+// offenseCountersLimit 违规计数超过该数量时清理过期的计数
+const offenseCountersLimit = 10000
+
+// bannedNet 内存中的网段封禁
+type bannedNet struct {
+	network   *net.IPNet
+	expiresAt time.Time // 零值表示永久
+}
+
+// offenseCounter 固定窗口内的违规计数
+type offenseCounter struct {
+	count   int
+	resetAt time.Time
+}
+
+// IPBanService IP封禁服务
+// 封禁列表保存在数据库中，内存中保留一份快照供每个请求检查，超过refresh_interval后在后台重新加载，
+// 使其他实例的封禁和解封在该间隔内生效；本实例的封禁和解封立即生效
+type IPBanService struct {
+	db              *gorm.DB
+	cfg             *config.IPBanConfig
+	refreshInterval time.Duration
+	window          time.Duration
+	banDuration     time.Duration
+	exempt          []*net.IPNet
+
+	mu       sync.RWMutex
+	ips      map[string]time.Time // 单个IP，零值表示永久
+	nets     []bannedNet
+	loadedAt time.Time
+
+	refreshing atomic.Bool
+
+	offenseMu sync.Mutex
+	offenses  map[string]*offenseCounter // 键为"违规类型|IP"
+}
+
+// NewIPBanService 创建IP封禁服务
+func NewIPBanService(cfg *config.IPBanConfig) *IPBanService {
+	return NewIPBanServiceWithDB(database.GetDB(), cfg)
+}
+
+// NewIPBanServiceWithDB 创建IP封禁服务（支持依赖注入），配置已在加载时校验
+func NewIPBanServiceWithDB(db *gorm.DB, cfg *config.IPBanConfig) *IPBanService {
+	s := &IPBanService{
+		db:       db,
+		cfg:      cfg,
+		ips:      make(map[string]time.Time),
+		offenses: make(map[string]*offenseCounter),
+	}
+	s.refreshInterval, _ = time.ParseDuration(cfg.RefreshInterval)
+	s.window, _ = time.ParseDuration(cfg.AutoBan.Window)
+	s.banDuration, _ = time.ParseDuration(cfg.AutoBan.Duration)
+	for _, entry := range cfg.ExemptIPs {
+		if network, err := parseIPOrCIDR(entry); err == nil {
+			s.exempt = append(s.exempt, network)
+		}
+	}
+	return s
+}
+
+// Reload 从数据库重新加载未过期的封禁列表，并清理已过期的记录
+func (s *IPBanService) Reload(ctx context.Context) error {
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Where("expires_at IS NOT NULL AND expires_at <= ?", now).Delete(&models.IPBan{}).Error; err != nil {
+		return err
+	}
+	var bans []models.IPBan
+	if err := s.db.WithContext(ctx).Find(&bans).Error; err != nil {
+		return err
+	}
+
+	ips := make(map[string]time.Time, len(bans))
+	var nets []bannedNet
+	for _, ban := range bans {
+		var expiresAt time.Time
+		if ban.ExpiresAt != nil {
+			expiresAt = *ban.ExpiresAt
+		}
+		if ip := net.ParseIP(ban.IP); ip != nil {
+			ips[ip.String()] = expiresAt
+			continue
+		}
+		if _, network, err := net.ParseCIDR(ban.IP); err == nil {
+			nets = append(nets, bannedNet{network: network, expiresAt: expiresAt})
+		}
+	}
+
+	s.mu.Lock()
+	s.ips = ips
+	s.nets = nets
+	s.loadedAt = now
+	s.mu.Unlock()
+	return nil
+}
+
+// IsBanned IP是否被封禁，快照过期时在后台重新加载
+func (s *IPBanService) IsBanned(clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	now := time.Now()
+
+	s.mu.RLock()
+	stale := now.Sub(s.loadedAt) > s.refreshInterval
+	banned := false
+	if expiresAt, ok := s.ips[ip.String()]; ok && (expiresAt.IsZero() || now.Before(expiresAt)) {
+		banned = true
+	}
+	for _, ban := range s.nets {
+		if banned {
+			break
+		}
+		banned = ban.network.Contains(ip) && (ban.expiresAt.IsZero() || now.Before(ban.expiresAt))
+	}
+	s.mu.RUnlock()
+
+	if stale && s.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer s.refreshing.Store(false)
+			if err := s.Reload(context.Background()); err != nil {
+				logger.GetLogger().Errorf("加载IP封禁列表失败: %v", err)
+			}
+		}()
+	}
+	return banned
+}
+
+// BanIP 封禁IP或网段，已封禁时更新原因和过期时间；ttl为0表示永久封禁
+func (s *IPBanService) BanIP(ctx context.Context, entry, reason, source string, ttl time.Duration) (*models.IPBan, error) {
+	network, err := parseIPOrCIDR(entry)
+	if err != nil {
+		return nil, err
+	}
+	ban := &models.IPBan{}
+	err = s.db.WithContext(ctx).Where("ip = ?", normalizeBanEntry(network)).First(ban).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	ban.IP = normalizeBanEntry(network)
+	ban.Reason = reason
+	ban.Source = source
+	ban.ExpiresAt = nil
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		ban.ExpiresAt = &expiresAt
+	}
+	if err := s.db.WithContext(ctx).Save(ban).Error; err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	var expiresAt time.Time
+	if ban.ExpiresAt != nil {
+		expiresAt = *ban.ExpiresAt
+	}
+	if ones, bits := network.Mask.Size(); ones == bits {
+		s.ips[network.IP.String()] = expiresAt
+	} else {
+		s.nets = append(s.nets, bannedNet{network: network, expiresAt: expiresAt})
+	}
+	s.mu.Unlock()
+
+	logger.WithContext(ctx).Warnf("封禁IP %s（%s）: %s", ban.IP, source, reason)
+	return ban, nil
+}
+
+// UnbanIP 解除封禁
+func (s *IPBanService) UnbanIP(ctx context.Context, id int64) error {
+	var ban models.IPBan
+	if err := s.db.WithContext(ctx).First(&ban, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrIPBanNotFound
+		}
+		return err
+	}
+	if err := s.db.WithContext(ctx).Delete(&ban).Error; err != nil {
+		return err
+	}
+	logger.WithContext(ctx).Infof("解除IP封禁 %s", ban.IP)
+	return s.Reload(ctx)
+}
+
+// ListBans 列出未过期的封禁
+func (s *IPBanService) ListBans(ctx context.Context) ([]models.IPBan, error) {
+	var bans []models.IPBan
+	err := s.db.WithContext(ctx).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("id DESC").Find(&bans).Error
+	return bans, err
+}
+
+// RecordOffense 记录一次违规，统计窗口内达到阈值时自动封禁该IP
+func (s *IPBanService) RecordOffense(ctx context.Context, clientIP string, offense Offense) {
+	if !s.cfg.AutoBan.Enabled {
+		return
+	}
+	threshold := s.offenseThreshold(offense)
+	ip := net.ParseIP(clientIP)
+	if threshold <= 0 || ip == nil || s.isExempt(ip) {
+		return
+	}
+
+	now := time.Now()
+	key := string(offense) + "|" + ip.String()
+	s.offenseMu.Lock()
+	if len(s.offenses) > offenseCountersLimit {
+		for k, counter := range s.offenses {
+			if now.After(counter.resetAt) {
+				delete(s.offenses, k)
+			}
+		}
+	}
+	counter, ok := s.offenses[key]
+	if !ok || now.After(counter.resetAt) {
+		counter = &offenseCounter{resetAt: now.Add(s.window)}
+		s.offenses[key] = counter
+	}
+	counter.count++
+	reached := counter.count >= threshold
+	if reached {
+		delete(s.offenses, key)
+	}
+	s.offenseMu.Unlock()
+
+	if !reached {
+		return
+	}
+	reason := fmt.Sprintf("%s: %d times within %s", offense, threshold, s.cfg.AutoBan.Window)
+	if _, err := s.BanIP(ctx, ip.String(), reason, IPBanSourceAuto, s.banDuration); err != nil {
+		logger.WithContext(ctx).Errorf("自动封禁IP %s 失败: %v", ip, err)
+	}
+}
+
+// offenseThreshold 违规类型对应的封禁阈值
+func (s *IPBanService) offenseThreshold(offense Offense) int {
+	switch offense {
+	case OffenseLoginFailure:
+		return s.cfg.AutoBan.LoginFailures
+	case OffenseAuthFailure:
+		return s.cfg.AutoBan.AuthFailures
+	case OffenseRateLimited:
+		return s.cfg.AutoBan.RateLimitHits
+	}
+	return 0
+}
+
+// isExempt IP是否在自动封禁豁免列表中
+func (s *IPBanService) isExempt(ip net.IP) bool {
+	for _, network := range s.exempt {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPOrCIDR 解析单个IP或CIDR网段，单个IP按全长掩码处理
+func parseIPOrCIDR(entry string) (*net.IPNet, error) {
+	if ip := net.ParseIP(entry); ip != nil {
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return network, nil
+	}
+	return nil, fmt.Errorf("invalid ip or cidr: %s", entry)
+}
+
+// normalizeBanEntry 单个IP保存为地址本身，网段保存为规范的CIDR
+func normalizeBanEntry(network *net.IPNet) string {
+	if ones, bits := network.Mask.Size(); ones == bits {
+		return network.IP.String()
+	}
+	return network.String()
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+func newTestIPBanConfig() *config.IPBanConfig {
+	return &config.IPBanConfig{
+		Enabled:         true,
+		RefreshInterval: "1h",
+		ExemptIPs:       []string{"10.0.0.0/8"},
+		AutoBan: config.AutoBanConfig{
+			Enabled:       true,
+			Window:        "10m",
+			Duration:      "1h",
+			LoginFailures: 3,
+		},
+	}
+}
+
+func TestIPBanManual(t *testing.T) {
+	db := newTestDB(t)
+	banService := NewIPBanServiceWithDB(db, newTestIPBanConfig())
+	require.NoError(t, banService.Reload(context.Background()))
+
+	ban, err := banService.BanIP(context.Background(), "203.0.113.7", "spam", IPBanSourceManual, 0)
+	require.NoError(t, err)
+	assert.Nil(t, ban.ExpiresAt)
+	_, err = banService.BanIP(context.Background(), "198.51.100.0/24", "scanner", IPBanSourceManual, time.Hour)
+	require.NoError(t, err)
+	_, err = banService.BanIP(context.Background(), "not-an-ip", "", IPBanSourceManual, 0)
+	assert.Error(t, err)
+
+	assert.True(t, banService.IsBanned("203.0.113.7"))
+	assert.True(t, banService.IsBanned("198.51.100.42"))
+	assert.False(t, banService.IsBanned("203.0.113.8"))
+
+	// 其他实例从数据库加载到相同的封禁
+	other := NewIPBanServiceWithDB(db, newTestIPBanConfig())
+	require.NoError(t, other.Reload(context.Background()))
+	assert.True(t, other.IsBanned("198.51.100.1"))
+
+	// 重复封禁只更新记录
+	_, err = banService.BanIP(context.Background(), "203.0.113.7", "spam again", IPBanSourceManual, time.Hour)
+	require.NoError(t, err)
+	bans, err := banService.ListBans(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, bans, 2)
+
+	require.NoError(t, banService.UnbanIP(context.Background(), ban.ID))
+	assert.False(t, banService.IsBanned("203.0.113.7"))
+	assert.ErrorIs(t, banService.UnbanIP(context.Background(), ban.ID), ErrIPBanNotFound)
+}
+
+func TestIPBanExpiry(t *testing.T) {
+	db := newTestDB(t)
+	banService := NewIPBanServiceWithDB(db, newTestIPBanConfig())
+
+	ban, err := banService.BanIP(context.Background(), "203.0.113.7", "", IPBanSourceManual, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(ban).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	require.NoError(t, banService.Reload(context.Background()))
+	assert.False(t, banService.IsBanned("203.0.113.7"))
+	var count int64
+	db.Model(&models.IPBan{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestIPBanAutoBan(t *testing.T) {
+	db := newTestDB(t)
+	banService := NewIPBanServiceWithDB(db, newTestIPBanConfig())
+	require.NoError(t, banService.Reload(context.Background()))
+
+	for i := 0; i < 2; i++ {
+		banService.RecordOffense(context.Background(), "203.0.113.7", OffenseLoginFailure)
+	}
+	assert.False(t, banService.IsBanned("203.0.113.7"))
+	banService.RecordOffense(context.Background(), "203.0.113.7", OffenseLoginFailure)
+	assert.True(t, banService.IsBanned("203.0.113.7"))
+
+	var ban models.IPBan
+	require.NoError(t, db.Where("ip = ?", "203.0.113.7").First(&ban).Error)
+	assert.Equal(t, IPBanSourceAuto, ban.Source)
+	require.NotNil(t, ban.ExpiresAt)
+
+	// 豁免网段和未配置阈值的违规类型不会被封禁
+	for i := 0; i < 5; i++ {
+		banService.RecordOffense(context.Background(), "10.1.2.3", OffenseLoginFailure)
+		banService.RecordOffense(context.Background(), "203.0.113.9", OffenseRateLimited)
+	}
+	assert.False(t, banService.IsBanned("10.1.2.3"))
+	assert.False(t, banService.IsBanned("203.0.113.9"))
+}
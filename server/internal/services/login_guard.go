@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+)
+
+// 登录保护键前缀
+const (
+	loginFailuresPrefix = "login:fail:" // login:fail:13800000000 失败次数和最后一次失败时间（HASH）
+	loginLockPrefix     = "login:lock:" // login:lock:13800000000 账号锁定标记
+)
+
+// 安全提醒类型
+const (
+	SecurityAlertAccountLocked      = "account_locked"       // 多次登录失败，账号被临时锁定
+	SecurityAlertLoginAfterFailures = "login_after_failures" // 多次登录失败后登录成功
+)
+
+var (
+	// ErrCaptchaRequired 登录失败次数较多，需要提供验证码
+	ErrCaptchaRequired = errors.New("captcha required")
+	// ErrCaptchaInvalid 验证码校验未通过
+	ErrCaptchaInvalid = errors.New("invalid captcha")
+)
+
+// recordLoginFailureScript 增加失败次数并记录失败时间，统计窗口从第一次失败开始
+var recordLoginFailureScript = redis.NewScript(`
+local count = redis.call('HINCRBY', KEYS[1], 'count', 1)
+redis.call('HSET', KEYS[1], 'last', ARGV[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return count
+`)
+
+// LoginThrottledError 登录失败次数过多，需要等待后再试
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool // 账号已被锁定
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "account temporarily locked due to too many failed login attempts"
+	}
+	return "too many failed login attempts, please try again later"
+}
+
+// LoginGuard 账号登录保护
+// 按手机号统计登录失败次数，计数保存在Redis中，各实例共享；Redis不可用时放行，只记录警告
+type LoginGuard struct {
+	client       *redis.Client
+	db           *gorm.DB
+	cfg          *config.LoginProtectionConfig
+	window       time.Duration
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	lockDuration time.Duration
+	httpClient   *http.Client
+}
+
+// NewLoginGuard 创建登录保护，未启用时返回nil（nil的LoginGuard放行所有登录）
+func NewLoginGuard(cfg *config.LoginProtectionConfig) *LoginGuard {
+	return NewLoginGuardWithClient(cache.GetRedisClient(), database.GetDB(), cfg)
+}
+
+// NewLoginGuardWithClient 创建登录保护（支持依赖注入），配置已在加载时校验
+func NewLoginGuardWithClient(client *redis.Client, db *gorm.DB, cfg *config.LoginProtectionConfig) *LoginGuard {
+	if !cfg.Enabled {
+		return nil
+	}
+	g := &LoginGuard{client: client, db: db, cfg: cfg}
+	g.window, _ = time.ParseDuration(cfg.Window)
+	g.baseDelay, _ = time.ParseDuration(cfg.BaseDelay)
+	g.maxDelay, _ = time.ParseDuration(cfg.MaxDelay)
+	g.lockDuration, _ = time.ParseDuration(cfg.LockDuration)
+	timeout, _ := time.ParseDuration(cfg.Captcha.Timeout)
+	g.httpClient = &http.Client{Timeout: timeout}
+	return g
+}
+
+// Check 登录前检查账号是否被锁定、是否需要等待或提供验证码
+func (g *LoginGuard) Check(ctx context.Context, phone, captchaToken, clientIP string) error {
+	if g == nil {
+		return nil
+	}
+	lockTTL, err := g.client.PTTL(ctx, loginLockPrefix+phone).Result()
+	if err != nil {
+		logger.WithContext(ctx).Warnf("读取登录锁定状态失败: %v", err)
+		return nil
+	}
+	if lockTTL > 0 {
+		return &LoginThrottledError{RetryAfter: lockTTL, Locked: true}
+	}
+
+	failures, last, err := g.failures(ctx, phone)
+	if err != nil {
+		logger.WithContext(ctx).Warnf("读取登录失败次数失败: %v", err)
+		return nil
+	}
+	if delay := g.delay(failures); delay > 0 {
+		if wait := time.Until(last.Add(delay)); wait > 0 {
+			return &LoginThrottledError{RetryAfter: wait}
+		}
+	}
+	if g.captchaRequired(failures) {
+		if captchaToken == "" {
+			return ErrCaptchaRequired
+		}
+		return g.verifyCaptcha(ctx, captchaToken, clientIP)
+	}
+	return nil
+}
+
+// RecordFailure 记录一次登录失败，达到lock_after时锁定账号并通知账号所有者
+// userID为0表示手机号未注册，同样计数，锁定后不再查询该手机号
+func (g *LoginGuard) RecordFailure(ctx context.Context, phone string, userID int64, clientIP string) {
+	if g == nil {
+		return
+	}
+	now := time.Now()
+	failures, err := recordLoginFailureScript.Run(ctx, g.client,
+		[]string{loginFailuresPrefix + phone}, now.UnixMilli(), g.window.Milliseconds()).Int()
+	if err != nil {
+		logger.WithContext(ctx).Warnf("记录登录失败次数失败: %v", err)
+		return
+	}
+	if g.cfg.LockAfter <= 0 || failures < g.cfg.LockAfter {
+		return
+	}
+
+	// 只有第一个设置锁定标记的请求负责清零计数和发送通知
+	locked, err := g.client.SetNX(ctx, loginLockPrefix+phone, failures, g.lockDuration).Result()
+	if err != nil || !locked {
+		return
+	}
+	g.client.Del(ctx, loginFailuresPrefix+phone)
+	logger.WithContext(ctx).Warnf("账号 %s 登录失败%d次，锁定%s", phone, failures, g.cfg.LockDuration)
+	if userID > 0 {
+		err := NewAuditServiceWithDB(g.db).Record(ctx, &AuditEntry{
+			Action:     AuditActionAccountLocked,
+			TargetType: AuditTargetUser,
+			TargetID:   userID,
+			IP:         clientIP,
+			Detail:     map[string]interface{}{"failures": failures, "lock_duration": g.cfg.LockDuration},
+		})
+		if err != nil {
+			logger.WithContext(ctx).Errorf("记录账号锁定失败: user=%d, error=%v", userID, err)
+		}
+		g.notify(ctx, &SecurityAlertEvent{
+			UserID:      userID,
+			Type:        SecurityAlertAccountLocked,
+			IP:          clientIP,
+			Failures:    failures,
+			LockedUntil: now.Add(g.lockDuration).UnixMilli(),
+		})
+	}
+}
+
+// RecordSuccess 登录成功后清零失败次数，之前失败次数较多时通知账号所有者
+func (g *LoginGuard) RecordSuccess(ctx context.Context, phone string, userID int64, clientIP string) {
+	if g == nil {
+		return
+	}
+	failures, _, err := g.failures(ctx, phone)
+	if err != nil || failures == 0 {
+		return
+	}
+	g.client.Del(ctx, loginFailuresPrefix+phone)
+	if g.delay(failures) > 0 || g.captchaRequired(failures) {
+		g.notify(ctx, &SecurityAlertEvent{
+			UserID:   userID,
+			Type:     SecurityAlertLoginAfterFailures,
+			IP:       clientIP,
+			Failures: failures,
+		})
+	}
+}
+
+// Unlock 清除手机号的登录失败次数和锁定，管理员重置密码后用户可以立即登录
+func (g *LoginGuard) Unlock(ctx context.Context, phone string) error {
+	if g == nil {
+		return nil
+	}
+	return g.client.Del(ctx, loginFailuresPrefix+phone, loginLockPrefix+phone).Err()
+}
+
+// failures 统计窗口内的失败次数和最后一次失败时间
+func (g *LoginGuard) failures(ctx context.Context, phone string) (int, time.Time, error) {
+	values, err := g.client.HMGet(ctx, loginFailuresPrefix+phone, "count", "last").Result()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	count, _ := strconv.Atoi(fmt.Sprint(values[0]))
+	lastMillis, _ := strconv.ParseInt(fmt.Sprint(values[1]), 10, 64)
+	return count, time.UnixMilli(lastMillis), nil
+}
+
+// delay 失败failures次后下次尝试前需要等待的时间，从base_delay开始每次翻倍，不超过max_delay
+func (g *LoginGuard) delay(failures int) time.Duration {
+	if g.cfg.DelayAfter <= 0 || failures < g.cfg.DelayAfter {
+		return 0
+	}
+	delay := g.baseDelay
+	for i := g.cfg.DelayAfter; i < failures && delay < g.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, g.maxDelay)
+}
+
+// captchaRequired 失败failures次后是否需要验证码
+func (g *LoginGuard) captchaRequired(failures int) bool {
+	return g.cfg.CaptchaAfter > 0 && g.cfg.Captcha.VerifyURL != "" && failures >= g.cfg.CaptchaAfter
+}
+
+// verifyCaptcha 调用验证码服务的siteverify接口校验token
+func (g *LoginGuard) verifyCaptcha(ctx context.Context, token, clientIP string) error {
+	form := url.Values{"secret": {g.cfg.Captcha.Secret}, "response": {token}}
+	if clientIP != "" {
+		form.Set("remoteip", clientIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.Captcha.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("verify captcha: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("verify captcha: %w", err)
+	}
+	if !result.Success {
+		return ErrCaptchaInvalid
+	}
+	return nil
+}
+
+// notify 发送安全提醒
+func (g *LoginGuard) notify(ctx context.Context, alert *SecurityAlertEvent) {
+	if !g.cfg.Notify {
+		return
+	}
+	publishSecurityAlert(ctx, g.db, alert)
+}
+
+// publishSecurityAlert 通过发件箱投递安全提醒，用户不在线时进入离线队列，重连后补发
+// 启用邮件通知时同时发送邮件
+func publishSecurityAlert(ctx context.Context, db *gorm.DB, alert *SecurityAlertEvent) {
+	alert.CreatedAt = time.Now().UnixMilli()
+	alert.RequestID = logger.RequestIDFrom(ctx)
+	queueSecurityAlertEmail(ctx, alert)
+	event, err := enqueueOutboxEvent(db.WithContext(ctx), EventSecurityAlert, alert.UserID, alert)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("写入用户 %d 的安全提醒失败: %v", alert.UserID, err)
+		return
+	}
+	if _, err := NewOutboxServiceWithDB(db).Publish(ctx, event.ID); err != nil {
+		logger.WithContext(ctx).Warnf("用户 %d 的安全提醒投递失败，等待发件箱中继重试: %v", alert.UserID, err)
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+func newTestLoginGuard(t *testing.T, mutate func(cfg *config.LoginProtectionConfig)) (*LoginGuard, *miniredis.Miniredis, *gorm.DB) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	cfg := &config.LoginProtectionConfig{
+		Enabled:      true,
+		Window:       "15m",
+		DelayAfter:   2,
+		BaseDelay:    "1s",
+		MaxDelay:     "4s",
+		LockAfter:    5,
+		LockDuration: "15m",
+		Notify:       true,
+		Captcha:      config.CaptchaConfig{Timeout: "1s"},
+	}
+	if mutate != nil {
+		mutate(cfg)
+	}
+	db := newTestDB(t)
+	return NewLoginGuardWithClient(client, db, cfg), mr, db
+}
+
+func TestLoginGuardEscalatingDelay(t *testing.T) {
+	guard, _, _ := newTestLoginGuard(t, nil)
+	ctx := context.Background()
+	phone := "13800000001"
+
+	guard.RecordFailure(ctx, phone, 0, "203.0.113.1")
+	require.NoError(t, guard.Check(ctx, phone, "", ""))
+
+	guard.RecordFailure(ctx, phone, 0, "203.0.113.1")
+	var throttled *LoginThrottledError
+	require.ErrorAs(t, guard.Check(ctx, phone, "", ""), &throttled)
+	assert.False(t, throttled.Locked)
+	assert.InDelta(t, time.Second, throttled.RetryAfter, float64(100*time.Millisecond))
+
+	assert.Equal(t, time.Second, guard.delay(2))
+	assert.Equal(t, 2*time.Second, guard.delay(3))
+	assert.Equal(t, 4*time.Second, guard.delay(4))
+	assert.Equal(t, 4*time.Second, guard.delay(10))
+}
+
+func TestLoginGuardLockAndNotify(t *testing.T) {
+	guard, mr, db := newTestLoginGuard(t, nil)
+	ctx := context.Background()
+	user := createTestUser(t, db, "13800000001", "alice")
+
+	for i := 0; i < 5; i++ {
+		guard.RecordFailure(ctx, user.Phone, user.ID, "203.0.113.1")
+	}
+	var throttled *LoginThrottledError
+	require.ErrorAs(t, guard.Check(ctx, user.Phone, "", ""), &throttled)
+	assert.True(t, throttled.Locked)
+	assert.Equal(t, 15*time.Minute, mr.TTL(loginLockPrefix+user.Phone))
+
+	// 锁定期间的失败不会重复通知
+	guard.RecordFailure(ctx, user.Phone, user.ID, "203.0.113.1")
+
+	var events []models.OutboxEvent
+	require.NoError(t, db.Where("event_type = ?", EventSecurityAlert).Find(&events).Error)
+	require.Len(t, events, 1)
+	var alert SecurityAlertEvent
+	require.NoError(t, json.Unmarshal([]byte(events[0].Payload), &alert))
+	assert.Equal(t, user.ID, alert.UserID)
+	assert.Equal(t, SecurityAlertAccountLocked, alert.Type)
+	assert.Equal(t, 5, alert.Failures)
+
+	var audits int64
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("action = ?", AuditActionAccountLocked).Count(&audits).Error)
+	assert.Equal(t, int64(1), audits)
+
+	// 锁定到期后重新计数
+	mr.FastForward(16 * time.Minute)
+	require.NoError(t, guard.Check(ctx, user.Phone, "", ""))
+}
+
+func TestLoginGuardSuccessResets(t *testing.T) {
+	guard, _, db := newTestLoginGuard(t, nil)
+	ctx := context.Background()
+	user := createTestUser(t, db, "13800000001", "alice")
+
+	guard.RecordFailure(ctx, user.Phone, user.ID, "")
+	guard.RecordFailure(ctx, user.Phone, user.ID, "")
+	guard.RecordSuccess(ctx, user.Phone, user.ID, "203.0.113.1")
+
+	failures, _, err := guard.failures(ctx, user.Phone)
+	require.NoError(t, err)
+	assert.Zero(t, failures)
+
+	var alert models.OutboxEvent
+	require.NoError(t, db.Where("event_type = ?", EventSecurityAlert).First(&alert).Error)
+	assert.Contains(t, alert.Payload, SecurityAlertLoginAfterFailures)
+}
+
+func TestLoginGuardCaptcha(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "secret", r.PostForm.Get("secret"))
+		json.NewEncoder(w).Encode(map[string]bool{"success": r.PostForm.Get("response") == "good"})
+	}))
+	defer server.Close()
+
+	guard, _, _ := newTestLoginGuard(t, func(cfg *config.LoginProtectionConfig) {
+		cfg.DelayAfter = 0
+		cfg.CaptchaAfter = 2
+		cfg.Captcha.VerifyURL = server.URL
+		cfg.Captcha.Secret = "secret"
+	})
+	ctx := context.Background()
+	phone := "13800000001"
+
+	guard.RecordFailure(ctx, phone, 0, "")
+	require.NoError(t, guard.Check(ctx, phone, "", ""))
+	guard.RecordFailure(ctx, phone, 0, "")
+	assert.ErrorIs(t, guard.Check(ctx, phone, "", ""), ErrCaptchaRequired)
+	assert.ErrorIs(t, guard.Check(ctx, phone, "bad", "203.0.113.1"), ErrCaptchaInvalid)
+	assert.NoError(t, guard.Check(ctx, phone, "good", "203.0.113.1"))
+}
+
+func TestLoginGuardDisabled(t *testing.T) {
+	guard := NewLoginGuardWithClient(nil, nil, &config.LoginProtectionConfig{})
+	assert.Nil(t, guard)
+	assert.NoError(t, guard.Check(context.Background(), "13800000001", "", ""))
+	guard.RecordFailure(context.Background(), "13800000001", 1, "")
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+	"gochat/internal/webhook"
+)
+
+// loginCodePrefix 新设备登录验证码键前缀
+// login:code:{userID}:{fingerprint} 验证码哈希和剩余尝试次数（HASH），有效期内不重新发送
+const loginCodePrefix = "login:code:"
+
+// 登录风险提醒类型
+const (
+	SecurityAlertNewDeviceLogin = "new_device_login" // 新设备或新地区登录成功
+	SecurityAlertLoginCode      = "login_code"       // 新设备登录需要验证码，提醒中带验证码
+)
+
+var (
+	// ErrLoginCodeRequired 登录风险较高，需要输入发给账号所有者的验证码
+	ErrLoginCodeRequired = errors.New("login verification code required")
+	// ErrLoginCodeInvalid 验证码错误或尝试次数已用完
+	ErrLoginCodeInvalid = errors.New("invalid login verification code")
+)
+
+// issueLoginCodeScript 没有有效验证码时保存新验证码，返回是否保存
+var issueLoginCodeScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'code', ARGV[1], 'attempts', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// checkLoginCodeScript 校验验证码：1-正确（删除验证码） 0-错误 -1-没有有效验证码 -2-尝试次数已用完
+// 尝试次数用完后保留到过期，期间不重新发送，限制暴力猜测
+var checkLoginCodeScript = redis.NewScript(`
+local code = redis.call('HGET', KEYS[1], 'code')
+if not code then
+	return -1
+end
+if tonumber(redis.call('HGET', KEYS[1], 'attempts')) <= 0 then
+	return -2
+end
+if code == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+redis.call('HINCRBY', KEYS[1], 'attempts', -1)
+return 0
+`)
+
+// LoginAttempt 一次密码校验通过的登录，风险评分钩子按其中的设备和来源信息评分
+type LoginAttempt struct {
+	UserID      int64
+	Phone       string
+	IP          string
+	Region      string // 地区代码或IP网段
+	Device      string // User-Agent
+	Fingerprint string // 客户端设备ID和User-Agent的SHA-256
+
+	NewDevice  bool // 该账号从未使用过的设备
+	NewRegion  bool // 该账号的设备从未出现过的地区
+	FirstLogin bool // 账号还没有设备记录（首次登录或启用本功能前的账号），不评分
+	Score      int
+	Reasons    []string
+}
+
+// NewLoginAttempt 构造登录尝试，deviceID为客户端安装时生成的设备标识（可为空），region为空时按IP网段区分
+func NewLoginAttempt(userID int64, phone, deviceID, userAgent, ip, region string) *LoginAttempt {
+	sum := sha256.Sum256([]byte(deviceID + "\n" + userAgent))
+	if region == "" {
+		region = networkOf(ip)
+	}
+	return &LoginAttempt{
+		UserID:      userID,
+		Phone:       phone,
+		IP:          ip,
+		Region:      region,
+		Device:      truncateRunes(userAgent, 255),
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+}
+
+// networkOf IP所在网段（IPv4 /16、IPv6 /32），无法解析时返回空
+func networkOf(ip string) string {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return ""
+	case parsed.To4() != nil:
+		return parsed.Mask(net.CIDRMask(16, 32)).String() + "/16"
+	default:
+		return parsed.Mask(net.CIDRMask(32, 128)).String() + "/32"
+	}
+}
+
+// truncateRunes 截断到最多n个字符
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// RiskScorer 登录风险评分钩子，返回附加分数和原因（分数为0时忽略），可接入IP信誉库、异地距离等规则
+// 钩子在登录请求中同步执行，需要自行控制耗时
+type RiskScorer func(ctx context.Context, attempt *LoginAttempt) (score int, reason string)
+
+var (
+	riskScorersMu sync.RWMutex
+	riskScorers   []RiskScorer
+)
+
+// RegisterRiskScorer 注册登录风险评分钩子，分数与内置的新设备、新地区分数相加
+func RegisterRiskScorer(scorer RiskScorer) {
+	riskScorersMu.Lock()
+	defer riskScorersMu.Unlock()
+	riskScorers = append(riskScorers, scorer)
+}
+
+// LoginRisk 登录风险检测
+// 验证码保存在Redis中，Redis不可用时放行并记录警告，与登录保护一致
+type LoginRisk struct {
+	client     *redis.Client
+	db         *gorm.DB
+	cfg        *config.LoginRiskConfig
+	codeTTL    time.Duration
+	signer     *webhook.Signer
+	httpClient *http.Client
+}
+
+// NewLoginRisk 创建登录风险检测，未启用时返回nil（nil的LoginRisk放行所有登录）
+func NewLoginRisk(cfg *config.LoginRiskConfig) *LoginRisk {
+	return NewLoginRiskWithClient(cache.GetRedisClient(), database.GetDB(), cfg)
+}
+
+// NewLoginRiskWithClient 创建登录风险检测（支持依赖注入），配置已在加载时校验
+func NewLoginRiskWithClient(client *redis.Client, db *gorm.DB, cfg *config.LoginRiskConfig) *LoginRisk {
+	if !cfg.Enabled {
+		return nil
+	}
+	r := &LoginRisk{client: client, db: db, cfg: cfg}
+	r.codeTTL, _ = time.ParseDuration(cfg.CodeTTL)
+	if cfg.CodeWebhook.URL != "" {
+		timeout, _ := time.ParseDuration(cfg.CodeWebhook.Timeout)
+		r.signer = webhook.NewSigner(cfg.CodeWebhook.Secret)
+		r.httpClient = &http.Client{Timeout: timeout}
+	}
+	return r
+}
+
+// Evaluate 密码校验通过后评分，分数达到step_up_score时校验验证码
+// code为空时发送验证码并返回ErrLoginCodeRequired；验证码错误返回ErrLoginCodeInvalid
+func (r *LoginRisk) Evaluate(ctx context.Context, attempt *LoginAttempt, code string) error {
+	if r == nil {
+		return nil
+	}
+	if err := r.score(ctx, attempt); err != nil {
+		logger.WithContext(ctx).Warnf("读取用户 %d 的登录设备失败: %v", attempt.UserID, err)
+		return nil
+	}
+	if r.cfg.StepUpScore <= 0 || attempt.Score < r.cfg.StepUpScore {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s%d:%s", loginCodePrefix, attempt.UserID, attempt.Fingerprint)
+	if code != "" {
+		result, err := checkLoginCodeScript.Run(ctx, r.client, []string{key}, hashLoginCode(code)).Int()
+		if err != nil {
+			logger.WithContext(ctx).Warnf("校验登录验证码失败: %v", err)
+			return nil
+		}
+		switch result {
+		case 1:
+			return nil
+		case 0, -2:
+			return ErrLoginCodeInvalid
+		}
+		// 验证码已过期，重新发送
+	}
+	r.issueCode(ctx, key, attempt)
+	return ErrLoginCodeRequired
+}
+
+// score 按账号的设备记录和评分钩子计算风险分数
+func (r *LoginRisk) score(ctx context.Context, attempt *LoginAttempt) error {
+	var devices []models.UserDevice
+	err := r.db.WithContext(ctx).Select("fingerprint", "last_region").
+		Where("user_id = ?", attempt.UserID).Find(&devices).Error
+	if err != nil {
+		return err
+	}
+	attempt.Score, attempt.Reasons = 0, nil
+	attempt.FirstLogin = len(devices) == 0
+	if attempt.FirstLogin {
+		return nil
+	}
+
+	attempt.NewDevice, attempt.NewRegion = true, attempt.Region != ""
+	for _, device := range devices {
+		if device.Fingerprint == attempt.Fingerprint {
+			attempt.NewDevice = false
+		}
+		if device.LastRegion == attempt.Region {
+			attempt.NewRegion = false
+		}
+	}
+	if attempt.NewDevice {
+		attempt.add(r.cfg.NewDeviceScore, "new_device")
+	}
+	if attempt.NewRegion {
+		attempt.add(r.cfg.NewRegionScore, "new_region")
+	}
+
+	riskScorersMu.RLock()
+	scorers := riskScorers
+	riskScorersMu.RUnlock()
+	for _, scorer := range scorers {
+		attempt.add(scorer(ctx, attempt))
+	}
+	return nil
+}
+
+// add 累加分数
+func (a *LoginAttempt) add(score int, reason string) {
+	if score != 0 {
+		a.Score += score
+		a.Reasons = append(a.Reasons, reason)
+	}
+}
+
+// issueCode 生成并发送验证码，有效期内已发送过时不重复发送
+func (r *LoginRisk) issueCode(ctx context.Context, key string, attempt *LoginAttempt) {
+	code, err := newLoginCode()
+	if err != nil {
+		logger.WithContext(ctx).Errorf("生成登录验证码失败: %v", err)
+		return
+	}
+	issued, err := issueLoginCodeScript.Run(ctx, r.client, []string{key},
+		hashLoginCode(code), r.cfg.CodeAttempts, r.codeTTL.Milliseconds()).Int()
+	if err != nil {
+		logger.WithContext(ctx).Warnf("保存登录验证码失败: %v", err)
+		return
+	}
+	if issued == 0 {
+		return
+	}
+	logger.WithContext(ctx).Infof("用户 %d 从新设备登录（%s），已发送验证码", attempt.UserID, strings.Join(attempt.Reasons, ","))
+
+	// 推送到已登录的其他设备，用户不在线时重连后补发
+	expiresAt := time.Now().Add(r.codeTTL)
+	publishSecurityAlert(ctx, r.db, &SecurityAlertEvent{
+		UserID:    attempt.UserID,
+		Type:      SecurityAlertLoginCode,
+		IP:        attempt.IP,
+		Device:    attempt.Device,
+		Region:    attempt.Region,
+		Code:      code,
+		ExpiresAt: expiresAt.UnixMilli(),
+	})
+	if r.signer != nil {
+		if err := r.sendCode(ctx, attempt.Phone, code, expiresAt); err != nil {
+			logger.WithContext(ctx).Errorf("通过网关发送用户 %d 的登录验证码失败: %v", attempt.UserID, err)
+		}
+	}
+}
+
+// sendCode 把验证码POST到短信网关，请求按webhook包的格式签名
+func (r *LoginRisk) sendCode(ctx context.Context, phone, code string, expiresAt time.Time) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"purpose":    "login",
+		"phone":      phone,
+		"code":       code,
+		"expires_at": expiresAt.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.CodeWebhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	r.signer.SignRequest(req, body)
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("code webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// RecordLogin 登录成功后记录设备，风险分数达到notify_score时提醒账号所有者
+func (r *LoginRisk) RecordLogin(ctx context.Context, attempt *LoginAttempt) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	device := &models.UserDevice{
+		UserID:      attempt.UserID,
+		Fingerprint: attempt.Fingerprint,
+		Name:        attempt.Device,
+		LastIP:      attempt.IP,
+		LastRegion:  attempt.Region,
+		LastSeenAt:  now,
+	}
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "fingerprint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "last_ip", "last_region", "last_seen_at"}),
+	}).Create(device).Error
+	if err != nil {
+		logger.WithContext(ctx).Errorf("记录用户 %d 的登录设备失败: %v", attempt.UserID, err)
+		return
+	}
+	r.trimDevices(ctx, attempt.UserID)
+
+	if r.cfg.NotifyScore > 0 && attempt.Score >= r.cfg.NotifyScore {
+		publishSecurityAlert(ctx, r.db, &SecurityAlertEvent{
+			UserID: attempt.UserID,
+			Type:   SecurityAlertNewDeviceLogin,
+			IP:     attempt.IP,
+			Device: attempt.Device,
+			Region: attempt.Region,
+		})
+	}
+}
+
+// trimDevices 删除超出max_devices的最久未登录设备
+func (r *LoginRisk) trimDevices(ctx context.Context, userID int64) {
+	var staleIDs []int64
+	err := r.db.WithContext(ctx).Model(&models.UserDevice{}).
+		Where("user_id = ?", userID).
+		Order("last_seen_at DESC").
+		Offset(r.cfg.MaxDevices).Limit(100).
+		Pluck("id", &staleIDs).Error
+	if err != nil || len(staleIDs) == 0 {
+		return
+	}
+	r.db.WithContext(ctx).Delete(&models.UserDevice{}, staleIDs)
+}
+
+// newLoginCode 生成6位数字验证码
+func newLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashLoginCode Redis中只保存验证码的哈希
+func hashLoginCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
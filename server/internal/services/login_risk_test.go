@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+	"gochat/internal/webhook"
+)
+
+func newTestLoginRisk(t *testing.T, mutate func(cfg *config.LoginRiskConfig)) (*LoginRisk, *gorm.DB) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	cfg := &config.LoginRiskConfig{
+		Enabled:        true,
+		NewDeviceScore: 50,
+		NewRegionScore: 40,
+		StepUpScore:    80,
+		NotifyScore:    50,
+		MaxDevices:     2,
+		CodeTTL:        "10m",
+		CodeAttempts:   2,
+	}
+	if mutate != nil {
+		mutate(cfg)
+	}
+	db := newTestDB(t)
+	return NewLoginRiskWithClient(client, db, cfg), db
+}
+
+// lastLoginCode 从最近一条验证码提醒中取出验证码
+func lastLoginCode(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	var event models.OutboxEvent
+	require.NoError(t, db.Where("event_type = ? AND payload LIKE ?", EventSecurityAlert, "%"+SecurityAlertLoginCode+"%").
+		Order("id DESC").First(&event).Error)
+	var alert SecurityAlertEvent
+	require.NoError(t, json.Unmarshal([]byte(event.Payload), &alert))
+	return alert.Code
+}
+
+func TestLoginRiskStepUp(t *testing.T) {
+	risk, db := newTestLoginRisk(t, nil)
+	ctx := context.Background()
+	user := createTestUser(t, db, "13800000001", "alice")
+
+	// 首次登录只记录设备
+	home := NewLoginAttempt(user.ID, user.Phone, "phone-1", "GoChat/1.0 (iOS)", "203.0.113.7", "")
+	require.NoError(t, risk.Evaluate(ctx, home, ""))
+	assert.True(t, home.FirstLogin)
+	risk.RecordLogin(ctx, home)
+	assert.Equal(t, "203.0.0.0/16", home.Region)
+
+	// 已知设备换网络：只有新地区分数，不需要验证码
+	roaming := NewLoginAttempt(user.ID, user.Phone, "phone-1", "GoChat/1.0 (iOS)", "198.51.100.9", "")
+	require.NoError(t, risk.Evaluate(ctx, roaming, ""))
+	assert.Equal(t, 40, roaming.Score)
+
+	// 新设备且新地区：需要验证码
+	stranger := NewLoginAttempt(user.ID, user.Phone, "laptop", "Mozilla/5.0", "192.0.2.1", "")
+	assert.ErrorIs(t, risk.Evaluate(ctx, stranger, ""), ErrLoginCodeRequired)
+	assert.Equal(t, []string{"new_device", "new_region"}, stranger.Reasons)
+	code := lastLoginCode(t, db)
+	assert.Len(t, code, 6)
+
+	// 有效期内重新登录不重复发送
+	assert.ErrorIs(t, risk.Evaluate(ctx, stranger, ""), ErrLoginCodeRequired)
+	var sent int64
+	require.NoError(t, db.Model(&models.OutboxEvent{}).Where("payload LIKE ?", "%"+SecurityAlertLoginCode+"%").Count(&sent).Error)
+	assert.Equal(t, int64(1), sent)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	assert.ErrorIs(t, risk.Evaluate(ctx, stranger, wrong), ErrLoginCodeInvalid)
+	require.NoError(t, risk.Evaluate(ctx, stranger, code))
+	risk.RecordLogin(ctx, stranger)
+
+	// 登录后提醒账号所有者，设备已记住
+	var alert models.OutboxEvent
+	require.NoError(t, db.Where("payload LIKE ?", "%"+SecurityAlertNewDeviceLogin+"%").First(&alert).Error)
+	assert.Contains(t, alert.Payload, "Mozilla/5.0")
+	require.NoError(t, risk.Evaluate(ctx, stranger, ""))
+	assert.Zero(t, stranger.Score)
+}
+
+func TestLoginRiskCodeAttemptsExhausted(t *testing.T) {
+	risk, db := newTestLoginRisk(t, func(cfg *config.LoginRiskConfig) { cfg.StepUpScore = 50 })
+	ctx := context.Background()
+	user := createTestUser(t, db, "13800000001", "alice")
+	risk.RecordLogin(ctx, NewLoginAttempt(user.ID, user.Phone, "phone-1", "GoChat", "203.0.113.7", "CN"))
+
+	attempt := NewLoginAttempt(user.ID, user.Phone, "phone-2", "GoChat", "203.0.113.7", "CN")
+	assert.ErrorIs(t, risk.Evaluate(ctx, attempt, ""), ErrLoginCodeRequired)
+	code := lastLoginCode(t, db)
+	assert.ErrorIs(t, risk.Evaluate(ctx, attempt, "not-it"), ErrLoginCodeInvalid)
+	assert.ErrorIs(t, risk.Evaluate(ctx, attempt, "not-it"), ErrLoginCodeInvalid)
+	// 尝试次数用完后正确的验证码也不再接受
+	assert.ErrorIs(t, risk.Evaluate(ctx, attempt, code), ErrLoginCodeInvalid)
+}
+
+func TestLoginRiskScorerAndWebhook(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, webhook.NewVerifier(nil, "gateway-secret").Verify(r.Context(), r.Header, body))
+		require.NoError(t, json.Unmarshal(body, &received))
+	}))
+	defer server.Close()
+
+	risk, db := newTestLoginRisk(t, func(cfg *config.LoginRiskConfig) {
+		cfg.CodeWebhook = config.CodeWebhookConfig{URL: server.URL, Secret: "gateway-secret", Timeout: "1s"}
+	})
+	ctx := context.Background()
+	user := createTestUser(t, db, "13800000001", "alice")
+	risk.RecordLogin(ctx, NewLoginAttempt(user.ID, user.Phone, "phone-1", "GoChat", "203.0.113.7", "CN"))
+
+	RegisterRiskScorer(func(ctx context.Context, attempt *LoginAttempt) (int, string) {
+		if attempt.IP == "192.0.2.66" {
+			return 100, "ip_reputation"
+		}
+		return 0, ""
+	})
+	t.Cleanup(func() { riskScorers = nil })
+
+	// 已知设备和地区，评分钩子判定为高风险
+	attempt := NewLoginAttempt(user.ID, user.Phone, "phone-1", "GoChat", "192.0.2.66", "CN")
+	assert.ErrorIs(t, risk.Evaluate(ctx, attempt, ""), ErrLoginCodeRequired)
+	assert.Equal(t, []string{"ip_reputation"}, attempt.Reasons)
+	assert.Equal(t, user.Phone, received["phone"])
+	assert.Equal(t, lastLoginCode(t, db), received["code"])
+}
+
+func TestLoginRiskTrimsDevices(t *testing.T) {
+	risk, db := newTestLoginRisk(t, nil)
+	ctx := context.Background()
+	user := createTestUser(t, db, "13800000001", "alice")
+	for _, deviceID := range []string{"a", "b", "c"} {
+		risk.RecordLogin(ctx, NewLoginAttempt(user.ID, user.Phone, deviceID, "GoChat", "203.0.113.7", ""))
+	}
+	var count int64
+	require.NoError(t, db.Model(&models.UserDevice{}).Where("user_id = ?", user.ID).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	var nilRisk *LoginRisk
+	assert.NoError(t, nilRisk.Evaluate(ctx, NewLoginAttempt(user.ID, user.Phone, "x", "", "", ""), ""))
+}
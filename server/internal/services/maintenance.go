@@ -0,0 +1,82 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gochat/internal/logger"
+)
+
+var (
+	ErrJobNotFound = errors.New("maintenance job not found")
+	ErrJobRunning  = errors.New("maintenance job is already running")
+)
+
+// MaintenanceJob 可由管理员手动触发的维护任务（文件清理、消息归档等）
+type MaintenanceJob struct {
+	Name          string     `json:"name"`
+	Description   string     `json:"description"`
+	Running       bool       `json:"running"`
+	LastStartedAt *time.Time `json:"last_started_at,omitempty"`
+
+	run func()
+}
+
+var (
+	maintenanceMu   sync.Mutex
+	maintenanceJobs = make(map[string]*MaintenanceJob)
+)
+
+// RegisterMaintenanceJob 注册维护任务，同名任务后注册的覆盖先注册的
+// run同步执行任务，多实例之间的互斥由任务自己的分布式锁保证
+func RegisterMaintenanceJob(name, description string, run func()) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	maintenanceJobs[name] = &MaintenanceJob{Name: name, Description: description, run: run}
+}
+
+// ListMaintenanceJobs 按名称列出已注册的维护任务及本实例上的执行状态
+func ListMaintenanceJobs() []MaintenanceJob {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	jobs := make([]MaintenanceJob, 0, len(maintenanceJobs))
+	for _, job := range maintenanceJobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// RunMaintenanceJob 在后台执行维护任务，本实例上同一任务同时只执行一个
+func RunMaintenanceJob(name string) error {
+	maintenanceMu.Lock()
+	job, ok := maintenanceJobs[name]
+	if !ok {
+		maintenanceMu.Unlock()
+		return ErrJobNotFound
+	}
+	if job.Running {
+		maintenanceMu.Unlock()
+		return ErrJobRunning
+	}
+	now := time.Now()
+	job.Running = true
+	job.LastStartedAt = &now
+	maintenanceMu.Unlock()
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.GetLogger().Errorf("维护任务 %s panic: %v", name, r)
+			}
+			maintenanceMu.Lock()
+			job.Running = false
+			maintenanceMu.Unlock()
+		}()
+		logger.GetLogger().Infof("手动触发维护任务: %s", name)
+		job.run()
+	}()
+	return nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/database"
+	"gochat/internal/models"
+)
+
+// MessageArchiveService 消息归档服务，把过期消息从热表移入归档表
+type MessageArchiveService struct {
+	db *gorm.DB
+}
+
+// NewMessageArchiveService 创建消息归档服务
+func NewMessageArchiveService() *MessageArchiveService {
+	return &MessageArchiveService{
+		db: database.GetDB(),
+	}
+}
+
+// NewMessageArchiveServiceWithDB 创建消息归档服务（支持依赖注入）
+func NewMessageArchiveServiceWithDB(db *gorm.DB) *MessageArchiveService {
+	return &MessageArchiveService{
+		db: db,
+	}
+}
+
+// defaultArchiveBatchSize 默认每批归档的消息条数
+const defaultArchiveBatchSize = 1000
+
+// ArchiveBefore 分批把cutoff之前的消息移入归档表，返回归档条数
+// 仍被会话引用为最后一条消息的记录保留在热表，避免破坏会话的外键
+func (s *MessageArchiveService) ArchiveBefore(ctx context.Context, cutoff time.Time, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = defaultArchiveBatchSize
+	}
+
+	var archived int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return archived, err
+		}
+
+		var batch []models.Message
+		lastMessageIDs := s.db.Model(&models.Conversation{}).Select("last_msg_id").Where("last_msg_id IS NOT NULL")
+		// 已对所有人删除的消息同样归档，连同删除时间一起保留
+		err := database.Primary(s.db).WithContext(ctx).Unscoped().
+			Where("created_at < ?", cutoff).
+			Where("id NOT IN (?)", lastMessageIDs).
+			Order("id").
+			Limit(batchSize).
+			Find(&batch).Error
+		if err != nil {
+			return archived, err
+		}
+		if len(batch) == 0 {
+			return archived, nil
+		}
+
+		now := time.Now()
+		rows := make([]models.ArchivedMessage, len(batch))
+		ids := make([]int64, len(batch))
+		for i, msg := range batch {
+			rows[i] = models.ArchivedMessage{
+				ID:         msg.ID,
+				FromUserID: msg.FromUserID,
+				ToUserID:   msg.ToUserID,
+				GroupID:    msg.GroupID,
+				Content:    msg.Content,
+				MsgType:    msg.MsgType,
+				CreatedAt:  msg.CreatedAt,
+				ArchivedAt: now,
+				DeletedAt:  msg.DeletedAt,
+			}
+			ids[i] = msg.ID
+		}
+
+		// 插入归档表和删除热表在同一事务内完成，失败时整批回滚
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&rows).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Message{}).Error
+		})
+		if err != nil {
+			return archived, err
+		}
+
+		archived += int64(len(batch))
+		if len(batch) < batchSize {
+			return archived, nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestArchiveBeforeKeepsHistoryReadable(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+
+	old := time.Now().AddDate(-1, 0, 0)
+	send := func(from, to *models.User, createdAt time.Time) *models.Message {
+		msg := &models.Message{FromUserID: from.ID, ToUserID: &to.ID, Content: "m", MsgType: models.MessageTypeText, CreatedAt: createdAt}
+		require.NoError(t, db.Create(msg).Error)
+		return msg
+	}
+
+	// alice和bob：5条一年前的消息和2条新消息
+	var aliceBob []*models.Message
+	for i := 0; i < 5; i++ {
+		aliceBob = append(aliceBob, send(alice, bob, old.Add(time.Duration(i)*time.Minute)))
+	}
+	aliceBob = append(aliceBob, send(bob, alice, time.Now().Add(-time.Minute)), send(alice, bob, time.Now()))
+
+	// alice和carol：长期不活跃的会话，最后一条消息被会话引用，需要留在热表
+	send(alice, carol, old)
+	idle := send(carol, alice, old.Add(time.Minute))
+	require.NoError(t, db.Create(&models.Conversation{UserID: alice.ID, Type: models.ConversationTypePrivate, TargetID: carol.ID, LastMsgID: &idle.ID}).Error)
+
+	archived, err := NewMessageArchiveServiceWithDB(db).ArchiveBefore(context.Background(), time.Now().AddDate(0, -6, 0), 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), archived)
+
+	var hot, cold int64
+	db.Model(&models.Message{}).Count(&hot)
+	db.Model(&models.ArchivedMessage{}).Count(&cold)
+	assert.Equal(t, int64(3), hot)
+	assert.Equal(t, int64(6), cold)
+
+	// 向前翻页跨越热表和归档表，顺序不变
+	messageService := NewMessageServiceWithDB(db)
+	var ids []int64
+	cursor := MessageCursor{Limit: 3}
+	for {
+		messages, hasMore, err := messageService.GetPrivateMessagesWithUserInfo(context.Background(), alice.ID, bob.ID, cursor)
+		require.NoError(t, err)
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+		}
+		if !hasMore {
+			break
+		}
+		cursor.BeforeID = messages[len(messages)-1].ID
+	}
+	require.Len(t, ids, 7)
+	for i, msg := range aliceBob {
+		assert.Equal(t, msg.ID, ids[len(ids)-1-i])
+	}
+
+	// 从最早的归档消息向后翻页，同样跨越两张表
+	messages, hasMore, err := messageService.GetPrivateMessagesWithUserInfo(context.Background(), alice.ID, bob.ID, MessageCursor{AfterID: aliceBob[3].ID, Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	require.Len(t, messages, 2)
+	assert.Equal(t, aliceBob[5].ID, messages[0].ID)
+	assert.Equal(t, aliceBob[4].ID, messages[1].ID)
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/models"
+)
+
+// 消息处理流程的扩展点
+// 部署方在自己的代码中调用RegisterMessageHook注册钩子（如关键词触发、自动回复、合规存档），无需修改消息处理流程。
+// WebSocket、gRPC、群机器人发送的消息和服务端生成的通话记录都经过同样的钩子，钩子可以按消息类型和发送者自行过滤。
+const (
+	HookPreSave    = "pre_save"    // 保存前，可以修改内容和消息类型，或拒绝消息
+	HookPostSave   = "post_save"   // 保存并提交后异步执行，不影响发送结果
+	HookPreDeliver = "pre_deliver" // 实时推送前，可以减少推送的接收者
+)
+
+// MessageHook 消息钩子，不需要的阶段留空；钩子需要遵守ctx的超时（message_hooks.timeout）
+type MessageHook struct {
+	Name string
+
+	// PreSave 在敏感词过滤之后、写入数据库之前执行，可以修改msg.Content和msg.MsgType
+	// 返回RejectMessage的错误时拒绝消息并把原因返回给发送者，返回其他错误时消息保存失败
+	PreSave func(ctx context.Context, msg *models.Message) error
+
+	// PostSave 在消息保存并提交后异步执行，msg为副本，适合存档、关键词触发和自动回复
+	// 在钩子里发送的消息同样会触发钩子，自动回复需要自行避免循环
+	PostSave func(ctx context.Context, msg *models.Message)
+
+	// PreDeliver 在推送给接收者之前执行，返回实际推送的接收者，只能去掉不能增加
+	// 只影响实时推送：被去掉的接收者的会话和历史消息中仍有该消息；返回错误时忽略该钩子，照常推送
+	PreDeliver func(ctx context.Context, msg *models.Message, recipients []int64) ([]int64, error)
+}
+
+// MessageRejectedError 消息被钩子拒绝，或引用了发送者无权访问的文件
+type MessageRejectedError struct {
+	Hook   string
+	Reason string
+}
+
+func (e *MessageRejectedError) Error() string {
+	return e.Reason
+}
+
+// RejectMessage 供PreSave钩子返回，拒绝消息，reason会返回给发送者
+func RejectMessage(reason string) error {
+	return &MessageRejectedError{Reason: reason}
+}
+
+var messageHookRuns = metrics.NewCounterVec("message_hooks_total", "消息钩子执行次数，result: ok、rejected、error", "stage", "hook", "result")
+
+var (
+	messageHooksMu       sync.RWMutex
+	messageHooks         []MessageHook
+	messageHookTimeout   = 2 * time.Second
+	disabledMessageHooks = map[string]bool{}
+)
+
+// RegisterMessageHook 注册消息钩子，按注册顺序执行；同名钩子后注册的替换先注册的
+func RegisterMessageHook(hook MessageHook) {
+	if hook.Name == "" {
+		panic("message hook name is required")
+	}
+	messageHooksMu.Lock()
+	defer messageHooksMu.Unlock()
+	for i := range messageHooks {
+		if messageHooks[i].Name == hook.Name {
+			messageHooks[i] = hook
+			return
+		}
+	}
+	messageHooks = append(messageHooks, hook)
+}
+
+// InitMessageHooks 设置钩子的执行超时和关闭的钩子
+func InitMessageHooks(cfg *config.MessageHooksConfig) {
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	disabled := make(map[string]bool, len(cfg.Disabled))
+	for _, name := range cfg.Disabled {
+		disabled[name] = true
+	}
+
+	messageHooksMu.Lock()
+	defer messageHooksMu.Unlock()
+	messageHookTimeout = timeout
+	disabledMessageHooks = disabled
+	for _, hook := range messageHooks {
+		if disabled[hook.Name] {
+			logger.GetLogger().Warnf("消息钩子 %s 已通过配置关闭", hook.Name)
+		}
+	}
+}
+
+// activeMessageHooks 当前启用的钩子和执行超时
+func activeMessageHooks() ([]MessageHook, time.Duration) {
+	messageHooksMu.RLock()
+	defer messageHooksMu.RUnlock()
+	hooks := make([]MessageHook, 0, len(messageHooks))
+	for _, hook := range messageHooks {
+		if !disabledMessageHooks[hook.Name] {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks, messageHookTimeout
+}
+
+// callMessageHook 在超时context中执行钩子，钩子panic时转换为错误，不影响调用方
+func callMessageHook(ctx context.Context, timeout time.Duration, stage, name string, fn func(ctx context.Context) error) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		var rejected *MessageRejectedError
+		result := "ok"
+		if errors.As(err, &rejected) {
+			result = "rejected"
+		} else if err != nil {
+			result = "error"
+		}
+		messageHookRuns.WithLabelValues(stage, name, result).Inc()
+	}()
+	return fn(ctx)
+}
+
+// runPreSaveHooks 依次执行保存前钩子，钩子不能修改消息的发送者和接收方
+func runPreSaveHooks(ctx context.Context, msg *models.Message) error {
+	hooks, timeout := activeMessageHooks()
+	fromUserID, toUserID, groupID := msg.FromUserID, msg.ToUserID, msg.GroupID
+	defer func() {
+		msg.FromUserID, msg.ToUserID, msg.GroupID = fromUserID, toUserID, groupID
+	}()
+
+	for _, hook := range hooks {
+		if hook.PreSave == nil {
+			continue
+		}
+		err := callMessageHook(ctx, timeout, HookPreSave, hook.Name, func(ctx context.Context) error {
+			return hook.PreSave(ctx, msg)
+		})
+		var rejected *MessageRejectedError
+		if errors.As(err, &rejected) {
+			rejected.Hook = hook.Name
+			logger.WithContext(ctx).Infof("用户 %d 的消息被钩子 %s 拒绝: %s", fromUserID, hook.Name, rejected.Reason)
+			return rejected
+		}
+		if err != nil {
+			return fmt.Errorf("message hook %s: %w", hook.Name, err)
+		}
+	}
+	return nil
+}
+
+// runPostSaveHooks 异步执行保存后钩子，每个钩子拿到独立的消息副本
+func runPostSaveHooks(ctx context.Context, msg *models.Message) {
+	hooks, timeout := activeMessageHooks()
+	var postSave []MessageHook
+	for _, hook := range hooks {
+		if hook.PostSave != nil {
+			postSave = append(postSave, hook)
+		}
+	}
+	if len(postSave) == 0 {
+		return
+	}
+
+	// 钩子在发送请求返回后执行，不随请求的上下文取消
+	ctx = context.WithoutCancel(ctx)
+	saved := *msg
+	go func() {
+		for _, hook := range postSave {
+			copied := saved
+			err := callMessageHook(ctx, timeout, HookPostSave, hook.Name, func(ctx context.Context) error {
+				hook.PostSave(ctx, &copied)
+				return nil
+			})
+			if err != nil {
+				logger.WithContext(ctx).Errorf("消息 %d 的保存后钩子 %s 执行失败: %v", saved.ID, hook.Name, err)
+			}
+		}
+	}()
+}
+
+// ApplyPreDeliverHooks 依次执行推送前钩子，返回实际推送的接收者
+// 钩子返回的接收者中不在原列表里的会被忽略；钩子出错时跳过该钩子
+func ApplyPreDeliverHooks(ctx context.Context, msg *models.Message, recipients []int64) []int64 {
+	hooks, timeout := activeMessageHooks()
+	for _, hook := range hooks {
+		if hook.PreDeliver == nil {
+			continue
+		}
+		var result []int64
+		copied := *msg
+		input := append([]int64(nil), recipients...)
+		err := callMessageHook(ctx, timeout, HookPreDeliver, hook.Name, func(ctx context.Context) error {
+			var err error
+			result, err = hook.PreDeliver(ctx, &copied, input)
+			return err
+		})
+		if err != nil {
+			logger.WithContext(ctx).Errorf("消息 %d 的推送前钩子 %s 执行失败，按原接收者推送: %v", msg.ID, hook.Name, err)
+			continue
+		}
+		recipients = intersectIDs(recipients, result)
+	}
+	return recipients
+}
+
+// intersectIDs 返回allowed中同时出现在ids里的ID，保持allowed的顺序
+func intersectIDs(allowed, ids []int64) []int64 {
+	keep := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		keep[id] = true
+	}
+	result := make([]int64, 0, len(ids))
+	for _, id := range allowed {
+		if keep[id] {
+			result = append(result, id)
+			delete(keep, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+// resetMessageHooks 清空注册的钩子，测试结束后恢复默认配置
+func resetMessageHooks(t *testing.T) {
+	t.Helper()
+	messageHooksMu.Lock()
+	messageHooks = nil
+	messageHooksMu.Unlock()
+	t.Cleanup(func() {
+		messageHooksMu.Lock()
+		messageHooks = nil
+		messageHooksMu.Unlock()
+		InitMessageHooks(&config.MessageHooksConfig{Timeout: "2s"})
+	})
+}
+
+func TestMessageHooksPreSave(t *testing.T) {
+	resetMessageHooks(t)
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	messageService := NewMessageServiceWithDB(db)
+	ctx := context.Background()
+
+	RegisterMessageHook(MessageHook{
+		Name: "shout",
+		PreSave: func(ctx context.Context, msg *models.Message) error {
+			msg.Content = strings.ToUpper(msg.Content)
+			// 不能修改接收方
+			msg.ToUserID = &alice.ID
+			return nil
+		},
+	})
+	RegisterMessageHook(MessageHook{
+		Name: "block",
+		PreSave: func(ctx context.Context, msg *models.Message) error {
+			if strings.Contains(msg.Content, "SECRET") {
+				return RejectMessage("confidential content is not allowed")
+			}
+			return nil
+		},
+	})
+
+	msg := &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hello", MsgType: models.MessageTypeText}
+	_, err := messageService.SaveMessage(ctx, msg)
+	require.NoError(t, err)
+	var saved models.Message
+	require.NoError(t, db.First(&saved, msg.ID).Error)
+	assert.Equal(t, "HELLO", saved.Content)
+	assert.Equal(t, bob.ID, *saved.ToUserID)
+
+	_, err = messageService.SaveMessage(ctx, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "a secret", MsgType: models.MessageTypeText})
+	var rejected *MessageRejectedError
+	require.True(t, errors.As(err, &rejected))
+	assert.Equal(t, "block", rejected.Hook)
+	assert.Equal(t, "confidential content is not allowed", rejected.Reason)
+
+	// 同名钩子替换先注册的，钩子panic时消息保存失败
+	RegisterMessageHook(MessageHook{
+		Name:    "block",
+		PreSave: func(ctx context.Context, msg *models.Message) error { panic("boom") },
+	})
+	_, err = messageService.SaveMessage(ctx, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "a secret", MsgType: models.MessageTypeText})
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &rejected))
+
+	// 通过配置关闭出问题的钩子
+	InitMessageHooks(&config.MessageHooksConfig{Timeout: "2s", Disabled: []string{"block"}})
+	_, err = messageService.SaveMessage(ctx, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "a secret", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	var count int64
+	require.NoError(t, db.Model(&models.Message{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestMessageHooksPostSave(t *testing.T) {
+	resetMessageHooks(t)
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+
+	archived := make(chan models.Message, 1)
+	RegisterMessageHook(MessageHook{
+		Name: "archive",
+		PostSave: func(ctx context.Context, msg *models.Message) {
+			_, hasDeadline := ctx.Deadline()
+			assert.True(t, hasDeadline)
+			msg.Content = "changed"
+			archived <- *msg
+		},
+	})
+
+	msg := &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hello", MsgType: models.MessageTypeText}
+	_, err := NewMessageServiceWithDB(db).SaveMessage(context.Background(), msg)
+	require.NoError(t, err)
+
+	select {
+	case got := <-archived:
+		assert.Equal(t, msg.ID, got.ID)
+	case <-time.After(time.Second):
+		t.Fatal("post_save hook was not called")
+	}
+	// 钩子拿到的是副本
+	assert.Equal(t, "hello", msg.Content)
+}
+
+func TestMessageHooksPreDeliver(t *testing.T) {
+	resetMessageHooks(t)
+	ctx := context.Background()
+	msg := &models.Message{ID: 1, FromUserID: 1, Content: "hello"}
+
+	RegisterMessageHook(MessageHook{
+		Name: "skip_even",
+		PreDeliver: func(ctx context.Context, msg *models.Message, recipients []int64) ([]int64, error) {
+			var result []int64
+			for _, id := range recipients {
+				if id%2 == 1 {
+					result = append(result, id)
+				}
+			}
+			// 增加的接收者会被忽略
+			return append(result, 99), nil
+		},
+	})
+	RegisterMessageHook(MessageHook{
+		Name: "broken",
+		PreDeliver: func(ctx context.Context, msg *models.Message, recipients []int64) ([]int64, error) {
+			return nil, errors.New("unavailable")
+		},
+	})
+
+	assert.Equal(t, []int64{3, 5}, ApplyPreDeliverHooks(ctx, msg, []int64{2, 3, 4, 5}))
+}
@@ -1,17 +1,38 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
 
 	"gochat/internal/cache"
 	"gochat/internal/database"
 	"gochat/internal/logger"
+	"gochat/internal/metrics"
 	"gochat/internal/models"
 )
 
+// ErrMessageNotFound 消息不存在（热表和归档表中都没有）
+var ErrMessageNotFound = errors.New("message not found")
+
+// messagesSaved 按会话类型（private/group）和消息类型统计保存的消息数
+var messagesSaved = metrics.NewCounterVec("messages_saved_total", "保存的聊天消息数", "chat", "type")
+
+// messageTypeNames 消息类型的指标标签
+var messageTypeNames = map[int]string{
+	models.MessageTypeText:  "text",
+	models.MessageTypeImage: "image",
+	models.MessageTypeVoice: "voice",
+	models.MessageTypeVideo: "video",
+	models.MessageTypeFile:  "file",
+	models.MessageTypeCall:  "call",
+}
+
 type MessageService struct {
 	db *gorm.DB
 }
@@ -26,6 +47,11 @@ type MessageInfo struct {
 	MsgType    int    `json:"msg_type"`
 	CreatedAt  int64  `json:"created_at"` // 改为int64毫秒时间戳
 
+	// 图片消息的缩略图URL（small/medium），视频消息的封面图URL（poster），其他类型为空
+	Thumbnails map[string]string `json:"thumbnails,omitempty"`
+	// 图片消息的BlurHash占位图，未生成时为空
+	Blurhash string `json:"blurhash,omitempty"`
+
 	// 发送者信息
 	FromUser struct {
 		ID       int64  `json:"id"`
@@ -48,12 +74,49 @@ func NewMessageServiceWithDB(db *gorm.DB) *MessageService {
 }
 
 // 保存消息 - 使用UTC时间，带缓存失效
-func (s *MessageService) SaveMessage(msg *models.Message) (int64, error) {
+func (s *MessageService) SaveMessage(ctx context.Context, msg *models.Message) (int64, error) {
+	event, err := s.SaveMessageWithEvent(ctx, msg, MessageCreatedEvent{})
+	if err != nil {
+		return 0, err
+	}
+	return event.MessageID, nil
+}
+
+// SaveMessageWithEvent 保存消息，并在同一事务中写入新消息事件（发件箱）
+// 返回的事件ID供调用方立即投递；调用方未能投递时（如进程崩溃）由发件箱中继补投
+func (s *MessageService) SaveMessageWithEvent(ctx context.Context, msg *models.Message, event MessageCreatedEvent) (*SavedMessage, error) {
 	msg.CreatedAt = time.Now().UTC() // 使用UTC时间
-	result := s.db.Create(msg)
-	if result.Error != nil {
-		return 0, result.Error
+	if err := runPreSaveHooks(ctx, msg); err != nil {
+		return nil, err
 	}
+	canonicalMessageContent(msg)
+	var outboxEvent *models.OutboxEvent
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		if err := linkMessageFile(tx, msg); err != nil {
+			return err
+		}
+		event.MessageID = msg.ID
+		var err error
+		outboxEvent, err = enqueueOutboxEvent(tx, EventMessageCreated, msg.ID, event)
+		if err != nil {
+			return err
+		}
+		if err := enqueueSearchIndex(tx, msg.ID); err != nil {
+			return err
+		}
+		if err := enqueueDomainEvent(tx, DomainMessageSent, msg.ID, messageSentData(msg)); err != nil {
+			return err
+		}
+		return enqueueBotWebhooks(tx, msg, event.RequestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	recordMessageSaved(msg)
+	runPostSaveHooks(ctx, msg)
 
 	// 失效相关缓存
 	cacheService := cache.GetCacheService()
@@ -61,82 +124,108 @@ func (s *MessageService) SaveMessage(msg *models.Message) (int64, error) {
 		if msg.GroupID != nil {
 			// 群聊消息 - 失效群聊消息缓存
 			if err := cacheService.InvalidateMessageCache(0, *msg.GroupID, true); err != nil {
-				logger.GetLogger().Warnf("Failed to invalidate group message cache: %v", err)
+				logger.WithContext(ctx).Warnf("Failed to invalidate group message cache: %v", err)
 			}
 		} else if msg.ToUserID != nil {
 			// 单聊消息 - 失效私聊消息缓存
 			if err := cacheService.InvalidateMessageCache(msg.FromUserID, *msg.ToUserID, false); err != nil {
-				logger.GetLogger().Warnf("Failed to invalidate private message cache: %v", err)
+				logger.WithContext(ctx).Warnf("Failed to invalidate private message cache: %v", err)
 			}
 		}
 
 		// 更新最后一条消息缓存
 		if msg.GroupID != nil {
 			if err := cacheService.CacheLastMessage(0, *msg.GroupID, true, msg); err != nil {
-				logger.GetLogger().Warnf("Failed to cache last group message: %v", err)
+				logger.WithContext(ctx).Warnf("Failed to cache last group message: %v", err)
 			}
 		} else if msg.ToUserID != nil {
 			if err := cacheService.CacheLastMessage(msg.FromUserID, *msg.ToUserID, false, msg); err != nil {
-				logger.GetLogger().Warnf("Failed to cache last private message: %v", err)
+				logger.WithContext(ctx).Warnf("Failed to cache last private message: %v", err)
 			}
 		}
+
+		// 每日消息数，供运营统计使用
+		if err := cacheService.IncrementMessageStats(statsDate(msg.CreatedAt)); err != nil {
+			logger.WithContext(ctx).Warnf("Failed to increment message stats: %v", err)
+		}
 	}
 
-	return msg.ID, nil
+	return &SavedMessage{MessageID: msg.ID, EventID: outboxEvent.ID}, nil
+}
+
+// recordMessageSaved 记录消息吞吐指标
+func recordMessageSaved(msg *models.Message) {
+	chat := "private"
+	if msg.GroupID != nil {
+		chat = "group"
+	}
+	msgType, ok := messageTypeNames[msg.MsgType]
+	if !ok {
+		msgType = "other"
+	}
+	messagesSaved.WithLabelValues(chat, msgType).Inc()
 }
 
-// 获取单聊历史消息
-func (s *MessageService) GetPrivateMessages(userID1, userID2 int64, page, pageSize int) ([]models.Message, int64, error) {
+// SavedMessage 保存消息的结果
+type SavedMessage struct {
+	MessageID int64
+	EventID   int64 // 新消息事件ID
+}
+
+// 获取单聊历史消息，hasMore表示是否还有下一页
+// 多取一条判断是否有下一页，不再统计总数，翻页开销不随会话消息数增长
+func (s *MessageService) GetPrivateMessages(ctx context.Context, userID1, userID2 int64, page, pageSize int) ([]models.Message, bool, error) {
 	var messages []models.Message
-	var total int64
 
 	// 计算偏移
 	offset := (page - 1) * pageSize
 
-	// 查询总数
-	s.db.Model(&models.Message{}).
-		Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)",
-			userID1, userID2, userID2, userID1).
-		Count(&total)
-
 	// 查询消息，按时间倒序
-	err := s.db.Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)",
+	err := s.db.WithContext(ctx).Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)",
 		userID1, userID2, userID2, userID1).
-		Order("created_at DESC").
-		Limit(pageSize).
+		Order("id DESC").
+		Limit(pageSize + 1).
 		Offset(offset).
 		Find(&messages).Error
+	if err != nil {
+		return nil, false, err
+	}
 
-	return messages, total, err
+	hasMore := len(messages) > pageSize
+	if hasMore {
+		messages = messages[:pageSize]
+	}
+	return messages, hasMore, nil
 }
 
-// 获取群聊历史消息
-func (s *MessageService) GetGroupMessages(groupID int64, page, pageSize int) ([]models.Message, int64, error) {
+// 获取群聊历史消息，hasMore表示是否还有下一页
+func (s *MessageService) GetGroupMessages(ctx context.Context, groupID int64, page, pageSize int) ([]models.Message, bool, error) {
 	var messages []models.Message
-	var total int64
 
 	offset := (page - 1) * pageSize
 
-	// 查询总数
-	s.db.Model(&models.Message{}).
-		Where("group_id = ?", groupID).
-		Count(&total)
-
 	// 查询消息
-	err := s.db.Where("group_id = ?", groupID).
-		Order("created_at DESC").
-		Limit(pageSize).
+	err := s.db.WithContext(ctx).Where("group_id = ?", groupID).
+		Order("id DESC").
+		Limit(pageSize + 1).
 		Offset(offset).
 		Find(&messages).Error
+	if err != nil {
+		return nil, false, err
+	}
 
-	return messages, total, err
+	hasMore := len(messages) > pageSize
+	if hasMore {
+		messages = messages[:pageSize]
+	}
+	return messages, hasMore, nil
 }
 
 // 获取会话的最后一条消息
-func (s *MessageService) GetLastMessage(userID, targetID int64, isGroup bool) (*models.Message, error) {
+func (s *MessageService) GetLastMessage(ctx context.Context, userID, targetID int64, isGroup bool) (*models.Message, error) {
 	var msg models.Message
 
-	query := s.db
+	query := s.db.WithContext(ctx)
 
 	if isGroup {
 		query = query.Where("group_id = ?", targetID)
@@ -152,11 +241,11 @@ func (s *MessageService) GetLastMessage(userID, targetID int64, isGroup bool) (*
 	return &msg, err
 }
 
-// 获取未读消息数量
-func (s *MessageService) GetUnreadCount(userID, targetID int64, isGroup bool, lastReadTime time.Time) (int64, error) {
+// 获取未读消息数量：已读位置之后他人发送的未删除消息
+func (s *MessageService) GetUnreadCount(ctx context.Context, userID, targetID int64, isGroup bool, lastReadMsgID int64) (int64, error) {
 	var count int64
 
-	query := s.db.Model(&models.Message{}).Where("created_at > ?", lastReadTime)
+	query := s.db.WithContext(ctx).Model(&models.Message{}).Where("id > ?", lastReadMsgID)
 
 	if isGroup {
 		query = query.Where("group_id = ? AND from_user_id != ?", targetID, userID)
@@ -168,148 +257,246 @@ func (s *MessageService) GetUnreadCount(userID, targetID int64, isGroup bool, la
 	return count, err
 }
 
-// 标记消息为已读
-func (s *MessageService) MarkAsRead(userID, messageID int64) error {
-	return s.db.Model(&models.Message{}).
-		Where("id = ? AND to_user_id = ?", messageID, userID).
-		Update("is_read", true).Error
+// MarkAsRead 把消息所在会话的已读位置前移到该消息
+func (s *MessageService) MarkAsRead(ctx context.Context, userID, messageID int64) error {
+	msg, _, err := s.findMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+
+	conversationService := NewConversationServiceWithDB(s.db)
+	switch {
+	case msg.GroupID != nil:
+		return conversationService.MarkReadUpTo(ctx, userID, *msg.GroupID, models.ConversationTypeGroup, msg.ID)
+	case msg.ToUserID != nil && *msg.ToUserID == userID:
+		return conversationService.MarkReadUpTo(ctx, userID, msg.FromUserID, models.ConversationTypePrivate, msg.ID)
+	case msg.FromUserID == userID && msg.ToUserID != nil:
+		return conversationService.MarkReadUpTo(ctx, userID, *msg.ToUserID, models.ConversationTypePrivate, msg.ID)
+	}
+	return errors.New("message not found")
+}
+
+// MessageCursor 历史消息游标
+// BeforeID 不为0时返回比它更早的消息，AfterID 不为0时返回比它更新的消息，都为0时返回最新的一页
+type MessageCursor struct {
+	BeforeID int64
+	AfterID  int64
+	Limit    int
 }
 
-// GetPrivateMessagesWithUserInfo 获取单聊历史消息（包含用户信息，带缓存）
-func (s *MessageService) GetPrivateMessagesWithUserInfo(userID1, userID2 int64, page, pageSize int) ([]MessageInfo, int64, error) {
+// latest 是否查询最新一页
+func (c MessageCursor) latest() bool {
+	return c.BeforeID == 0 && c.AfterID == 0
+}
+
+// historyPage 缓存的最新一页历史消息
+type historyPage struct {
+	Messages []MessageInfo `json:"messages"`
+	HasMore  bool          `json:"has_more"`
+}
+
+// 缓存最新一页时使用的页码（只缓存不带游标的第一页）
+const latestHistoryPage = 0
+
+// GetPrivateMessagesWithUserInfo 按游标获取单聊历史消息（包含用户信息，最新一页带缓存）
+// 返回的消息按时间倒序，hasMore表示游标方向上是否还有更多消息
+// userID1为查看者，其仅为自己删除的消息不会返回
+func (s *MessageService) GetPrivateMessagesWithUserInfo(ctx context.Context, userID1, userID2 int64, cursor MessageCursor) ([]MessageInfo, bool, error) {
+	where := "((m.from_user_id = ? AND m.to_user_id = ?) OR (m.from_user_id = ? AND m.to_user_id = ?))"
+	args := []interface{}{userID1, userID2, userID2, userID1}
+
 	// 尝试从缓存获取
 	cacheService := cache.GetCacheService()
-	if cacheService != nil {
-		var cachedMessages []MessageInfo
-		if err := cacheService.GetPrivateMessages(userID1, userID2, page, pageSize, &cachedMessages); err == nil && cachedMessages != nil {
-			logger.GetLogger().Debugf("Cache hit for private messages between %d and %d, page %d", userID1, userID2, page)
-
-			// 获取总数（可能需要单独缓存或者从数据库获取）
-			var total int64
-			s.db.Model(&models.Message{}).
-				Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)",
-					userID1, userID2, userID2, userID1).
-				Count(&total)
-
-			return cachedMessages, total, nil
+	if cacheService != nil && cursor.latest() {
+		var cached *historyPage
+		if err := cacheService.GetPrivateMessages(userID1, userID2, latestHistoryPage, cursor.Limit, &cached); err == nil && cached != nil {
+			logger.WithContext(ctx).Debugf("Cache hit for private messages between %d and %d", userID1, userID2)
+			return cached.Messages, cached.HasMore, nil
 		}
 	}
 
-	var messages []MessageInfo
-	var total int64
+	messages, hasMore, err := s.queryHistory(ctx, userID1, where, args, "", cursor)
+	if err != nil {
+		return nil, false, err
+	}
 
-	// 计算偏移
-	offset := (page - 1) * pageSize
+	// 缓存结果
+	if cacheService != nil && cursor.latest() {
+		if err := cacheService.CachePrivateMessages(userID1, userID2, latestHistoryPage, cursor.Limit, historyPage{Messages: messages, HasMore: hasMore}); err != nil {
+			logger.WithContext(ctx).Warnf("Failed to cache private messages: %v", err)
+		}
+	}
 
-	// 查询总数
-	s.db.Model(&models.Message{}).
-		Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)",
-			userID1, userID2, userID2, userID1).
-		Count(&total)
+	return messages, hasMore, nil
+}
 
-	// 查询消息，按时间倒序，返回UTC时间戳（毫秒）
-	rows, err := s.db.Raw(`
-		SELECT
-			m.id, m.from_user_id, m.to_user_id, m.group_id,
-			m.content, m.msg_type,
-			CAST(UNIX_TIMESTAMP(m.created_at) * 1000 AS SIGNED) as created_at,
-			u.id as user_id, u.nickname as from_nickname, u.avatar as from_avatar
-		FROM messages m
-		JOIN users u ON m.from_user_id = u.id
-		WHERE (m.from_user_id = ? AND m.to_user_id = ?) OR (m.from_user_id = ? AND m.to_user_id = ?)
-		ORDER BY m.created_at DESC
-		LIMIT ? OFFSET ?
-	`, userID1, userID2, userID2, userID1, pageSize, offset).Rows()
+// GetGroupMessagesWithUserInfo 按游标获取群聊历史消息（包含用户信息，最新一页带缓存）
+// userID为查看者，其仅为自己删除的消息不会返回
+func (s *MessageService) GetGroupMessagesWithUserInfo(ctx context.Context, groupID, userID int64, cursor MessageCursor) ([]MessageInfo, bool, error) {
+	where := "m.group_id = ?"
+	args := []interface{}{groupID}
 
-	if err != nil {
-		return nil, 0, err
+	// 尝试从缓存获取
+	cacheService := cache.GetCacheService()
+	if cacheService != nil && cursor.latest() {
+		var cached *historyPage
+		if err := cacheService.GetGroupMessages(groupID, userID, latestHistoryPage, cursor.Limit, &cached); err == nil && cached != nil {
+			logger.WithContext(ctx).Debugf("Cache hit for group messages %d", groupID)
+			return cached.Messages, cached.HasMore, nil
+		}
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var msg MessageInfo
-		var toUserID sql.NullInt64
-		var groupID sql.NullInt64
+	messages, hasMore, err := s.queryHistory(ctx, userID, where, args, "", cursor)
+	if err != nil {
+		return nil, false, err
+	}
 
-		err := rows.Scan(
-			&msg.ID, &msg.FromUserID, &toUserID, &groupID,
-			&msg.Content, &msg.MsgType, &msg.CreatedAt,
-			&msg.FromUser.ID, &msg.FromUser.Nickname, &msg.FromUser.Avatar,
-		)
-		if err != nil {
-			logger.GetLogger().Errorf("Error scanning private message row: %v", err)
-			return nil, 0, err
+	// 缓存结果
+	if cacheService != nil && cursor.latest() {
+		if err := cacheService.CacheGroupMessages(groupID, userID, latestHistoryPage, cursor.Limit, historyPage{Messages: messages, HasMore: hasMore}); err != nil {
+			logger.WithContext(ctx).Warnf("Failed to cache group messages: %v", err)
 		}
+	}
 
-		// 处理可空字段
-		if toUserID.Valid {
-			msg.ToUserID = &toUserID.Int64
+	return messages, hasMore, nil
+}
+
+// queryHistory 按消息ID游标查询历史消息（seek分页，不扫描已翻过的行）
+// 归档表中的消息都早于热表：向前翻先读热表再读归档表，向后翻顺序相反
+// 已对所有人删除的消息和viewerID仅为自己删除的消息都会被过滤；keyword不为空时只返回内容匹配的消息
+func (s *MessageService) queryHistory(ctx context.Context, viewerID int64, where string, args []interface{}, keyword string, cursor MessageCursor) ([]MessageInfo, bool, error) {
+	// 多取一条用于判断是否还有更多
+	limit := cursor.Limit + 1
+	tables := []string{models.Message{}.TableName(), models.ArchivedMessage{}.TableName()}
+	order := "m.id DESC"
+	where += " AND m.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM message_deletions d WHERE d.message_id = m.id AND d.user_id = ?)"
+	args = append(append([]interface{}{}, args...), viewerID)
+
+	switch {
+	case cursor.AfterID > 0:
+		where += " AND m.id > ?"
+		args = append(args, cursor.AfterID)
+		order = "m.id ASC"
+		tables[0], tables[1] = tables[1], tables[0]
+	case cursor.BeforeID > 0:
+		where += " AND m.id < ?"
+		args = append(args, cursor.BeforeID)
+	}
+
+	var messages []MessageInfo
+	for _, table := range tables {
+		remaining := limit - len(messages)
+		if remaining <= 0 {
+			break
 		}
-		if groupID.Valid {
-			msg.GroupID = &groupID.Int64
+		tableWhere, tableArgs := where, args
+		if keyword != "" {
+			cond, condArgs := s.contentMatch(table, keyword)
+			tableWhere += " AND " + cond
+			tableArgs = append(append([]interface{}{}, args...), condArgs...)
+		}
+		rows, err := s.queryMessageInfos(ctx, table, tableWhere, tableArgs, order, remaining)
+		if err != nil {
+			return nil, false, err
 		}
+		messages = append(messages, rows...)
+	}
 
-		messages = append(messages, msg)
+	hasMore := len(messages) > cursor.Limit
+	if hasMore {
+		messages = messages[:cursor.Limit]
 	}
 
-	// 缓存结果
-	if cacheService != nil {
-		if err := cacheService.CachePrivateMessages(userID1, userID2, page, pageSize, messages); err != nil {
-			logger.GetLogger().Warnf("Failed to cache private messages: %v", err)
+	for i := range messages {
+		messages[i].Thumbnails = MessageThumbnails(messages[i].MsgType, messages[i].Content)
+		messages[i].Blurhash = MessageBlurhash(messages[i].MsgType, messages[i].Content)
+		messages[i].FromUser.Avatar = PublicURL(messages[i].FromUser.Avatar)
+	}
+
+	// 统一按时间倒序返回
+	if cursor.AfterID > 0 {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
 		}
 	}
 
-	return messages, total, nil
+	return messages, hasMore, nil
 }
 
-// GetGroupMessagesWithUserInfo 获取群聊历史消息（包含用户信息，带缓存）
-func (s *MessageService) GetGroupMessagesWithUserInfo(groupID int64, page, pageSize int) ([]MessageInfo, int64, error) {
-	// 尝试从缓存获取
-	cacheService := cache.GetCacheService()
-	if cacheService != nil {
-		var cachedMessages []MessageInfo
-		if err := cacheService.GetGroupMessages(groupID, page, pageSize, &cachedMessages); err == nil && cachedMessages != nil {
-			logger.GetLogger().Debugf("Cache hit for group messages %d, page %d", groupID, page)
+// likeEscaper 转义LIKE通配符，配合 ESCAPE '!' 使用（各数据库通用）
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
 
-			// 获取总数
-			var total int64
-			s.db.Model(&models.Message{}).
-				Where("group_id = ?", groupID).
-				Count(&total)
+// contentMatch 返回按关键词匹配消息内容的条件：表有全文索引时使用MATCH，否则退回LIKE
+func (s *MessageService) contentMatch(table, keyword string) (string, []interface{}) {
+	if utf8.RuneCountInString(keyword) >= database.NgramTokenSize && database.HasFullTextIndex(s.db, table) {
+		// 按短语匹配，去掉会破坏短语边界的双引号
+		phrase := `"` + strings.ReplaceAll(keyword, `"`, " ") + `"`
+		return "MATCH(m.content) AGAINST (? IN BOOLEAN MODE)", []interface{}{phrase}
+	}
+	return "m.content LIKE ? ESCAPE '!'", []interface{}{"%" + likeEscaper.Replace(keyword) + "%"}
+}
 
-			return cachedMessages, total, nil
-		}
+// MessageSearch 消息搜索条件
+type MessageSearch struct {
+	Keyword  string
+	TargetID int64 // 为0时搜索用户的全部会话
+	Type     int   // 会话类型（1-单聊 2-群聊），TargetID不为0时有效
+}
+
+// SearchMessages 在用户可见的消息（含归档）中按关键词搜索，结果按时间倒序，支持与历史消息相同的游标
+func (s *MessageService) SearchMessages(ctx context.Context, userID int64, search MessageSearch, cursor MessageCursor) ([]MessageInfo, bool, error) {
+	var where string
+	var args []interface{}
+	switch {
+	case search.TargetID == 0:
+		where, args = visibleMessagesWhere(userID)
+	case search.Type == models.ConversationTypeGroup:
+		where = "m.group_id = ? AND EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = m.group_id AND gm.user_id = ?)"
+		args = []interface{}{search.TargetID, userID}
+	default:
+		where = "((m.from_user_id = ? AND m.to_user_id = ?) OR (m.from_user_id = ? AND m.to_user_id = ?))"
+		args = []interface{}{userID, search.TargetID, search.TargetID, userID}
 	}
 
-	var messages []MessageInfo
-	var total int64
+	return s.queryHistory(ctx, userID, where, args, search.Keyword, cursor)
+}
 
-	offset := (page - 1) * pageSize
+// visibleMessagesWhere 用户可见的消息：自己参与的单聊和所在群的群聊
+func visibleMessagesWhere(userID int64) (string, []interface{}) {
+	return "((m.group_id IS NULL AND (m.from_user_id = ? OR m.to_user_id = ?)) OR m.group_id IN (SELECT gm.group_id FROM group_members gm WHERE gm.user_id = ?))",
+		[]interface{}{userID, userID, userID}
+}
 
-	// 查询总数
-	s.db.Model(&models.Message{}).
-		Where("group_id = ?", groupID).
-		Count(&total)
+// messagesByIDs 按ID查询用户可见的消息（含归档），按ID倒序返回，不可见或已删除的消息被跳过
+func (s *MessageService) messagesByIDs(ctx context.Context, userID int64, ids []int64) ([]MessageInfo, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	where, args := visibleMessagesWhere(userID)
+	messages, _, err := s.queryHistory(ctx, userID, where+" AND m.id IN ?", append(args, ids), "", MessageCursor{Limit: len(ids)})
+	return messages, err
+}
 
-	// 查询消息，返回UTC时间戳（毫秒）
-	rows, err := s.db.Raw(`
+// queryMessageInfos 从指定消息表查询消息及发送者信息，返回UTC时间戳（毫秒）
+func (s *MessageService) queryMessageInfos(ctx context.Context, table, where string, args []interface{}, order string, limit int) ([]MessageInfo, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
 		SELECT
 			m.id, m.from_user_id, m.to_user_id, m.group_id,
 			m.content, m.msg_type,
-			CAST(UNIX_TIMESTAMP(m.created_at) * 1000 AS SIGNED) as created_at,
+			`+database.UnixMillisExpr(s.db, "m.created_at")+` as created_at,
 			u.id as user_id, u.nickname as from_nickname, u.avatar as from_avatar
-		FROM messages m
+		FROM `+table+` m
 		JOIN users u ON m.from_user_id = u.id
-		WHERE m.group_id = ?
-		ORDER BY m.created_at DESC
-		LIMIT ? OFFSET ?
-	`, groupID, pageSize, offset).Rows()
-
+		WHERE `+where+`
+		ORDER BY `+order+`
+		LIMIT ?
+	`, append(append([]interface{}{}, args...), limit)...).Rows()
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
+	var messages []MessageInfo
 	for rows.Next() {
 		var msg MessageInfo
 		var toUserID sql.NullInt64
@@ -321,8 +508,8 @@ func (s *MessageService) GetGroupMessagesWithUserInfo(groupID int64, page, pageS
 			&msg.FromUser.ID, &msg.FromUser.Nickname, &msg.FromUser.Avatar,
 		)
 		if err != nil {
-			logger.GetLogger().Errorf("Error scanning group message row: %v", err)
-			return nil, 0, err
+			logger.WithContext(ctx).Errorf("Error scanning message row from %s: %v", table, err)
+			return nil, err
 		}
 
 		// 处理可空字段
@@ -336,12 +523,193 @@ func (s *MessageService) GetGroupMessagesWithUserInfo(groupID int64, page, pageS
 		messages = append(messages, msg)
 	}
 
-	// 缓存结果
-	if cacheService != nil {
-		if err := cacheService.CacheGroupMessages(groupID, page, pageSize, messages); err != nil {
-			logger.GetLogger().Warnf("Failed to cache group messages: %v", err)
+	return messages, nil
+}
+
+// 消息删除范围
+const (
+	DeleteScopeMe       = "me"       // 仅为自己删除
+	DeleteScopeEveryone = "everyone" // 对所有人删除（仅发送者可操作）
+)
+
+// DeleteMessage 按范围删除消息
+func (s *MessageService) DeleteMessage(ctx context.Context, userID, messageID int64, scope string) error {
+	switch scope {
+	case DeleteScopeMe:
+		return s.DeleteMessageForMe(ctx, userID, messageID)
+	case DeleteScopeEveryone:
+		return s.DeleteMessageForEveryone(ctx, userID, messageID)
+	default:
+		return errors.New("scope must be me or everyone")
+	}
+}
+
+// DeleteMessageForEveryone 对所有人删除消息（软删除），只有发送者可以操作
+// 消息可能已被归档，热表中找不到时再删除归档表中的记录
+func (s *MessageService) DeleteMessageForEveryone(ctx context.Context, userID, messageID int64) error {
+	msg, archived, err := s.findMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	if msg.FromUserID != userID {
+		return errors.New("only the sender can delete a message for everyone")
+	}
+	return s.deleteForEveryone(ctx, msg, archived)
+}
+
+// TakedownMessage 管理员下架违规消息：对所有人删除，不校验发送者，返回被删除的消息
+func (s *MessageService) TakedownMessage(ctx context.Context, messageID int64) (*models.Message, error) {
+	msg, archived, err := s.findMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.deleteForEveryone(ctx, msg, archived); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// deleteForEveryone 删除消息并刷新相关缓存和会话列表
+func (s *MessageService) deleteForEveryone(ctx context.Context, msg *models.Message, archived bool) error {
+	// 同时删除消息对文件的引用，文件不再因这条消息保留
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if archived {
+			err = tx.Where("id = ?", msg.ID).Delete(&models.ArchivedMessage{}).Error
+		} else {
+			err = tx.Where("id = ?", msg.ID).Delete(&models.Message{}).Error
+		}
+		if err != nil {
+			return err
 		}
+		if err := enqueueSearchIndex(tx, msg.ID); err != nil {
+			return err
+		}
+		return unlinkMessageFile(tx, msg.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateMessageCache(msg)
+	// 被删除的消息可能是会话的最后一条消息，刷新所有参与者的会话列表
+	if msg.GroupID != nil {
+		var memberIDs []int64
+		if err := s.db.WithContext(ctx).Model(&models.GroupMember{}).Where("group_id = ?", *msg.GroupID).Pluck("user_id", &memberIDs).Error; err != nil {
+			logger.WithContext(ctx).Warnf("Failed to load members of group %d: %v", *msg.GroupID, err)
+		}
+		InvalidateConversationList(memberIDs...)
+	} else if msg.ToUserID != nil {
+		InvalidateConversationList(msg.FromUserID, *msg.ToUserID)
+	}
+	return nil
+}
+
+// DeleteMessageForMe 仅为自己删除消息，其他参与者仍可看到
+func (s *MessageService) DeleteMessageForMe(ctx context.Context, userID, messageID int64) error {
+	msg, _, err := s.findMessage(ctx, messageID)
+	if err != nil {
+		return err
 	}
 
-	return messages, total, nil
+	isParticipant, err := s.isParticipant(ctx, msg, userID)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return errors.New("message not found")
+	}
+
+	// 重复删除时保持幂等
+	deletion := models.MessageDeletion{MessageID: messageID, UserID: userID}
+	err = s.db.WithContext(ctx).Where("message_id = ? AND user_id = ?", messageID, userID).FirstOrCreate(&deletion).Error
+	if err != nil {
+		return err
+	}
+
+	s.invalidateMessageCache(msg)
+	InvalidateConversationList(userID)
+	return nil
+}
+
+// isParticipant 用户是否能看到消息：单聊的双方，或群聊的当前成员
+func (s *MessageService) isParticipant(ctx context.Context, msg *models.Message, userID int64) (bool, error) {
+	if msg.FromUserID == userID || (msg.ToUserID != nil && *msg.ToUserID == userID) {
+		return true, nil
+	}
+	if msg.GroupID == nil {
+		return false, nil
+	}
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", *msg.GroupID, userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// findMessage 按ID查找未删除的消息，依次查找热表和归档表，archived表示消息位于归档表
+func (s *MessageService) findMessage(ctx context.Context, messageID int64) (*models.Message, bool, error) {
+	db := database.Primary(s.db.WithContext(ctx))
+
+	var msg models.Message
+	err := db.Where("id = ?", messageID).First(&msg).Error
+	if err == nil {
+		return &msg, false, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, err
+	}
+
+	var archivedMsg models.ArchivedMessage
+	err = db.Where("id = ?", messageID).First(&archivedMsg).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, false, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &models.Message{
+		ID:         archivedMsg.ID,
+		FromUserID: archivedMsg.FromUserID,
+		ToUserID:   archivedMsg.ToUserID,
+		GroupID:    archivedMsg.GroupID,
+		Content:    archivedMsg.Content,
+		MsgType:    archivedMsg.MsgType,
+		CreatedAt:  archivedMsg.CreatedAt,
+	}, true, nil
+}
+
+// invalidateMessageCache 删除消息所在会话的历史消息缓存
+func (s *MessageService) invalidateMessageCache(msg *models.Message) {
+	cacheService := cache.GetCacheService()
+	if cacheService == nil {
+		return
+	}
+	var err error
+	if msg.GroupID != nil {
+		err = cacheService.InvalidateMessageCache(0, *msg.GroupID, true)
+	} else if msg.ToUserID != nil {
+		err = cacheService.InvalidateMessageCache(msg.FromUserID, *msg.ToUserID, false)
+	}
+	if err != nil {
+		logger.GetLogger().Warnf("Failed to invalidate message cache for message %d: %v", msg.ID, err)
+	}
+}
+
+// hideMessagesForUser 把两个用户之间的全部单聊消息（含归档）对userID隐藏，对方的历史不受影响
+func hideMessagesForUser(tx *gorm.DB, userID, otherID int64) error {
+	now := time.Now()
+	for _, table := range []string{models.Message{}.TableName(), models.ArchivedMessage{}.TableName()} {
+		err := tx.Exec(`
+			INSERT INTO message_deletions (message_id, user_id, created_at)
+			SELECT m.id, ?, ?
+			FROM `+table+` m
+			WHERE ((m.from_user_id = ? AND m.to_user_id = ?) OR (m.from_user_id = ? AND m.to_user_id = ?))
+			AND NOT EXISTS (SELECT 1 FROM message_deletions d WHERE d.message_id = m.id AND d.user_id = ?)
+		`, userID, now, userID, otherID, otherID, userID, userID).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestDeleteMessageScopes(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+
+	messageService := NewMessageServiceWithDB(db)
+	send := func(from, to *models.User, content string) int64 {
+		id, err := messageService.SaveMessage(context.Background(), &models.Message{FromUserID: from.ID, ToUserID: &to.ID, Content: content, MsgType: models.MessageTypeText})
+		require.NoError(t, err)
+		return id
+	}
+	first := send(alice, bob, "first")
+	second := send(bob, alice, "second")
+	third := send(alice, bob, "third")
+
+	history := func(viewer, other *models.User) []int64 {
+		messages, _, err := messageService.GetPrivateMessagesWithUserInfo(context.Background(), viewer.ID, other.ID, MessageCursor{Limit: 20})
+		require.NoError(t, err)
+		return messageIDs(messages)
+	}
+
+	// 只有发送者可以对所有人删除
+	assert.Error(t, messageService.DeleteMessage(context.Background(), alice.ID, second, DeleteScopeEveryone))
+	require.NoError(t, messageService.DeleteMessage(context.Background(), alice.ID, third, DeleteScopeEveryone))
+
+	// 仅为自己删除，重复删除保持幂等
+	require.NoError(t, messageService.DeleteMessage(context.Background(), bob.ID, first, DeleteScopeMe))
+	require.NoError(t, messageService.DeleteMessage(context.Background(), bob.ID, first, DeleteScopeMe))
+
+	assert.Equal(t, []int64{second, first}, history(alice, bob))
+	assert.Equal(t, []int64{second}, history(bob, alice))
+
+	// 已删除的消息和非参与者都视为不存在
+	carol := createTestUser(t, db, "13800000003", "carol")
+	assert.Error(t, messageService.DeleteMessage(context.Background(), alice.ID, third, DeleteScopeMe))
+	assert.Error(t, messageService.DeleteMessage(context.Background(), carol.ID, second, DeleteScopeMe))
+	assert.Error(t, messageService.DeleteMessage(context.Background(), alice.ID, second, "all"))
+}
+
+func TestRemoveFriendKeepsHistoryForOtherSide(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+
+	friendService := NewFriendServiceWithDB(db)
+	require.NoError(t, friendService.AddFriend(context.Background(), alice.ID, bob.ID))
+
+	messageService := NewMessageServiceWithDB(db)
+	id, err := messageService.SaveMessage(context.Background(), &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hi", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	require.NoError(t, friendService.RemoveFriend(context.Background(), alice.ID, bob.ID))
+
+	forAlice, _, err := messageService.GetPrivateMessagesWithUserInfo(context.Background(), alice.ID, bob.ID, MessageCursor{Limit: 20})
+	require.NoError(t, err)
+	assert.Empty(t, forAlice)
+
+	forBob, _, err := messageService.GetPrivateMessagesWithUserInfo(context.Background(), bob.ID, alice.ID, MessageCursor{Limit: 20})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{id}, messageIDs(forBob))
+}
+
+func TestSearchMessagesFallsBackToLike(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+
+	group, err := NewGroupServiceWithDB(db).CreateGroupWithMembers(context.Background(), alice.ID, "team", []int64{bob.ID})
+	require.NoError(t, err)
+
+	messageService := NewMessageServiceWithDB(db)
+	send := func(msg *models.Message) int64 {
+		msg.MsgType = models.MessageTypeText
+		id, err := messageService.SaveMessage(context.Background(), msg)
+		require.NoError(t, err)
+		return id
+	}
+	private := send(&models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "明天开会"})
+	inGroup := send(&models.Message{FromUserID: bob.ID, GroupID: &group.ID, Content: "开会改到下午"})
+	send(&models.Message{FromUserID: carol.ID, ToUserID: &bob.ID, Content: "开会吗"})
+	percent := send(&models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "进度100%"})
+	send(&models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "进度1000"})
+
+	search := func(s MessageSearch, cursor MessageCursor) ([]int64, bool) {
+		messages, hasMore, err := messageService.SearchMessages(context.Background(), alice.ID, s, cursor)
+		require.NoError(t, err)
+		return messageIDs(messages), hasMore
+	}
+
+	// 只搜索alice可见的会话
+	ids, _ := search(MessageSearch{Keyword: "开会"}, MessageCursor{Limit: 20})
+	assert.Equal(t, []int64{inGroup, private}, ids)
+
+	ids, hasMore := search(MessageSearch{Keyword: "开会"}, MessageCursor{Limit: 1})
+	assert.True(t, hasMore)
+	assert.Equal(t, []int64{inGroup}, ids)
+	ids, hasMore = search(MessageSearch{Keyword: "开会"}, MessageCursor{BeforeID: inGroup, Limit: 1})
+	assert.False(t, hasMore)
+	assert.Equal(t, []int64{private}, ids)
+
+	ids, _ = search(MessageSearch{Keyword: "开会", TargetID: group.ID, Type: models.ConversationTypeGroup}, MessageCursor{Limit: 20})
+	assert.Equal(t, []int64{inGroup}, ids)
+
+	// 关键词中的通配符按字面匹配
+	ids, _ = search(MessageSearch{Keyword: "100%"}, MessageCursor{Limit: 20})
+	assert.Equal(t, []int64{percent}, ids)
+
+	// 仅为自己删除的消息不再出现在搜索结果中
+	require.NoError(t, messageService.DeleteMessage(context.Background(), alice.ID, private, DeleteScopeMe))
+	ids, _ = search(MessageSearch{Keyword: "开会", TargetID: bob.ID, Type: models.ConversationTypePrivate}, MessageCursor{Limit: 20})
+	assert.Empty(t, ids)
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+// 发件箱事件类型
+const (
+	EventMessageCreated   = "message.created"   // 新消息：更新会话、推送给接收者
+	EventSecurityAlert    = "security.alert"    // 账号安全提醒：推送给账号所有者
+	EventModerationNotice = "moderation.notice" // 审核通知：警告、禁言和举报处理结果，推送给相关用户
+)
+
+const (
+	// outboxLease 事件被领取后的租约时长，期间其他中继不会重复投递
+	// 新事件写入时同样设置租约，留给写入方立即投递，超时未投递（如进程崩溃）再由中继补投
+	outboxLease = 30 * time.Second
+	// outboxMaxBackoff 投递失败后的最大重试间隔
+	outboxMaxBackoff = 5 * time.Minute
+	// defaultOutboxMaxAttempts 默认最大投递次数
+	defaultOutboxMaxAttempts = 10
+)
+
+// MessageCreatedEvent 新消息事件负载
+type MessageCreatedEvent struct {
+	MessageID   int64   `json:"message_id"`
+	ClientMsgID string  `json:"client_msg_id,omitempty"` // 发送方客户端生成的消息ID
+	Recipients  []int64 `json:"recipients,omitempty"`    // 发送时确定的接收者（不含发送者），为空时投递时再确定
+	RequestID   string  `json:"request_id,omitempty"`    // 发送消息的请求ID，中继重试投递时沿用，日志可按ID串联
+}
+
+// SecurityAlertEvent 账号安全提醒事件负载
+type SecurityAlertEvent struct {
+	UserID      int64  `json:"user_id"`
+	Type        string `json:"type"`                   // 提醒类型，见SecurityAlert*
+	IP          string `json:"ip,omitempty"`           // 触发提醒的登录来源IP
+	Failures    int    `json:"failures"`               // 统计窗口内的登录失败次数
+	LockedUntil int64  `json:"locked_until,omitempty"` // 锁定截止时间（毫秒时间戳）
+	Device      string `json:"device,omitempty"`       // 登录设备（User-Agent）
+	Region      string `json:"region,omitempty"`       // 登录地区或IP网段
+	Code        string `json:"code,omitempty"`         // 新设备登录验证码，只在login_code提醒中出现
+	ExpiresAt   int64  `json:"expires_at,omitempty"`   // 验证码过期时间（毫秒时间戳）
+	CreatedAt   int64  `json:"created_at"`
+	RequestID   string `json:"request_id,omitempty"`
+}
+
+// OutboxHandler 发件箱事件处理函数，返回错误时事件稍后重试
+// 投递语义为至少一次，处理函数需要容忍重复事件
+type OutboxHandler func(ctx context.Context, event *models.OutboxEvent) error
+
+var (
+	outboxHandlersMu sync.RWMutex
+	outboxHandlers   = make(map[string][]OutboxHandler)
+)
+
+// RegisterOutboxHandler 注册事件处理函数（实时推送、推送通知、Webhook等），同一事件可注册多个
+func RegisterOutboxHandler(eventType string, handler OutboxHandler) {
+	outboxHandlersMu.Lock()
+	defer outboxHandlersMu.Unlock()
+	outboxHandlers[eventType] = append(outboxHandlers[eventType], handler)
+}
+
+// OutboxService 发件箱服务，负责写入和投递事件
+type OutboxService struct {
+	db          *gorm.DB
+	maxAttempts int
+}
+
+// NewOutboxService 创建发件箱服务
+func NewOutboxService() *OutboxService {
+	return &OutboxService{
+		db:          database.GetDB(),
+		maxAttempts: defaultOutboxMaxAttempts,
+	}
+}
+
+// NewOutboxServiceWithDB 创建发件箱服务（支持依赖注入）
+func NewOutboxServiceWithDB(db *gorm.DB) *OutboxService {
+	return &OutboxService{
+		db:          db,
+		maxAttempts: defaultOutboxMaxAttempts,
+	}
+}
+
+// SetMaxAttempts 设置最大投递次数
+func (s *OutboxService) SetMaxAttempts(maxAttempts int) {
+	if maxAttempts > 0 {
+		s.maxAttempts = maxAttempts
+	}
+}
+
+// enqueueOutboxEvent 在调用方的事务中写入事件
+func enqueueOutboxEvent(tx *gorm.DB, eventType string, aggregateID int64, payload interface{}) (*models.OutboxEvent, error) {
+	return insertOutboxEvent(tx, eventType, aggregateID, payload, outboxLease)
+}
+
+// enqueueRelayedOutboxEvent 在调用方的事务中写入只由中继投递的事件，不为写入方保留租约，中继下一轮扫描即可领取
+func enqueueRelayedOutboxEvent(tx *gorm.DB, eventType string, aggregateID int64, payload interface{}) (*models.OutboxEvent, error) {
+	return insertOutboxEvent(tx, eventType, aggregateID, payload, 0)
+}
+
+// insertOutboxEvent 写入事件，lease时间内中继不会投递
+func insertOutboxEvent(tx *gorm.DB, eventType string, aggregateID int64, payload interface{}, lease time.Duration) (*models.OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	event := &models.OutboxEvent{
+		EventType:     eventType,
+		AggregateID:   aggregateID,
+		Payload:       string(data),
+		NextAttemptAt: now.Add(lease),
+		CreatedAt:     now,
+	}
+	if err := tx.Create(event).Error; err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Publish 立即投递写入方刚提交的事件，事件已被领取或已投递时返回false
+func (s *OutboxService) Publish(ctx context.Context, eventID int64) (bool, error) {
+	// 写入方只领取从未投递过的事件，租约内中继不会抢占
+	return s.publish(ctx, eventID, "attempts = 0")
+}
+
+// PublishPending 投递到期未完成的事件（写入方崩溃或投递失败），返回成功投递的数量
+// 多实例同时执行时通过领取操作保证同一事件只被一个实例投递
+func (s *OutboxService) PublishPending(ctx context.Context, limit int) (int, error) {
+	var ids []int64
+	err := database.Primary(s.db).WithContext(ctx).Model(&models.OutboxEvent{}).
+		Where("published_at IS NULL AND next_attempt_at <= ? AND attempts < ?", time.Now(), s.maxAttempts).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return published, err
+		}
+		ok, err := s.publish(ctx, id, "next_attempt_at <= ?", time.Now())
+		if err != nil {
+			logger.GetLogger().Warnf("发件箱事件 %d 投递失败: %v", id, err)
+			continue
+		}
+		if ok {
+			published++
+		}
+	}
+	return published, nil
+}
+
+// PurgePublished 删除早于before的已投递事件，返回删除条数
+func (s *OutboxService) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).
+		Where("published_at IS NOT NULL AND published_at < ?", before).
+		Delete(&models.OutboxEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// publish 领取并投递事件，claim为领取条件
+func (s *OutboxService) publish(ctx context.Context, eventID int64, claim string, args ...interface{}) (bool, error) {
+	db := database.Primary(s.db).WithContext(ctx)
+
+	// 领取：增加投递次数并续租，条件不满足（已被其他实例领取或已投递）时影响行数为0
+	now := time.Now()
+	result := db.Model(&models.OutboxEvent{}).
+		Where("id = ? AND published_at IS NULL", eventID).
+		Where(claim, args...).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(outboxLease),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	var event models.OutboxEvent
+	if err := db.First(&event, eventID).Error; err != nil {
+		return false, err
+	}
+
+	if err := dispatchOutboxEvent(ctx, &event); err != nil {
+		backoff := outboxBackoff(event.Attempts)
+		lastError := err.Error()
+		if len(lastError) > 500 {
+			lastError = lastError[:500]
+		}
+		if event.Attempts >= s.maxAttempts {
+			logger.GetLogger().Errorf("发件箱事件 %d (%s) 已达到最大投递次数 %d，放弃投递: %v", event.ID, event.EventType, event.Attempts, err)
+		}
+		updateErr := db.Model(&models.OutboxEvent{}).Where("id = ?", event.ID).Updates(map[string]interface{}{
+			"next_attempt_at": time.Now().Add(backoff),
+			"last_error":      lastError,
+		}).Error
+		if updateErr != nil {
+			logger.GetLogger().Warnf("记录发件箱事件 %d 投递失败信息出错: %v", event.ID, updateErr)
+		}
+		return false, err
+	}
+
+	publishedAt := time.Now()
+	if err := db.Model(&models.OutboxEvent{}).Where("id = ?", event.ID).Update("published_at", &publishedAt).Error; err != nil {
+		// 已经投递成功，标记失败只会导致租约到期后重复投递
+		return true, err
+	}
+	return true, nil
+}
+
+// dispatchOutboxEvent 依次调用事件的所有处理函数
+func dispatchOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	outboxHandlersMu.RLock()
+	handlers := outboxHandlers[event.EventType]
+	outboxHandlersMu.RUnlock()
+
+	if len(handlers) == 0 {
+		return fmt.Errorf("no handler registered for outbox event %s", event.EventType)
+	}
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outboxBackoff 第attempts次投递失败后的重试间隔（指数退避）
+func outboxBackoff(attempts int) time.Duration {
+	backoff := time.Second
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	return backoff
+}
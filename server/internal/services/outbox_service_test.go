@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+func TestSaveMessageWritesOutboxEvent(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+
+	saved, err := NewMessageServiceWithDB(db).SaveMessageWithEvent(
+		context.Background(),
+		&models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hi", MsgType: models.MessageTypeText},
+		MessageCreatedEvent{ClientMsgID: "c1", Recipients: []int64{bob.ID}},
+	)
+	require.NoError(t, err)
+
+	var event models.OutboxEvent
+	require.NoError(t, db.First(&event, saved.EventID).Error)
+	assert.Equal(t, EventMessageCreated, event.EventType)
+	assert.Equal(t, saved.MessageID, event.AggregateID)
+	assert.Nil(t, event.PublishedAt)
+
+	var payload MessageCreatedEvent
+	require.NoError(t, json.Unmarshal([]byte(event.Payload), &payload))
+	assert.Equal(t, MessageCreatedEvent{MessageID: saved.MessageID, ClientMsgID: "c1", Recipients: []int64{bob.ID}}, payload)
+}
+
+func TestOutboxPublishAndRelay(t *testing.T) {
+	db := newTestDB(t)
+	outboxService := NewOutboxServiceWithDB(db)
+
+	var delivered []int64
+	fail := false
+	RegisterOutboxHandler("test.relay", func(ctx context.Context, event *models.OutboxEvent) error {
+		if fail {
+			return errors.New("push unavailable")
+		}
+		delivered = append(delivered, event.AggregateID)
+		return nil
+	})
+	enqueue := func(aggregateID int64) *models.OutboxEvent {
+		event, err := enqueueOutboxEvent(db, "test.relay", aggregateID, nil)
+		require.NoError(t, err)
+		return event
+	}
+	expireLease := func(event *models.OutboxEvent) {
+		require.NoError(t, db.Model(event).Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+	}
+
+	// 写入方立即投递，重复投递被忽略
+	first := enqueue(1)
+	ok, err := outboxService.Publish(context.Background(), first.ID)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = outboxService.Publish(context.Background(), first.ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 写入方崩溃：租约到期前中继不补投，到期后补投
+	second := enqueue(2)
+	published, err := outboxService.PublishPending(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Zero(t, published)
+	expireLease(second)
+	published, err = outboxService.PublishPending(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []int64{1, 2}, delivered)
+
+	// 投递失败时记录错误并退避重试
+	fail = true
+	third := enqueue(3)
+	_, err = outboxService.Publish(context.Background(), third.ID)
+	assert.Error(t, err)
+	require.NoError(t, db.First(third, third.ID).Error)
+	assert.Equal(t, 1, third.Attempts)
+	assert.Equal(t, "push unavailable", third.LastError)
+	assert.Nil(t, third.PublishedAt)
+	assert.True(t, third.NextAttemptAt.After(time.Now()))
+
+	fail = false
+	expireLease(third)
+	published, err = outboxService.PublishPending(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []int64{1, 2, 3}, delivered)
+
+	purged, err := outboxService.PurgePublished(context.Background(), time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+}
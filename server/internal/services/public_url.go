@@ -0,0 +1,65 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+
+	"gochat/internal/models"
+)
+
+// publicBaseURL 文件URL的公开访问前缀，如https://cdn.example.com，为空时返回相对路径
+var publicBaseURL string
+
+// SetPublicBaseURL 设置文件URL的公开访问前缀（CDN或反向代理地址）
+func SetPublicBaseURL(base string) {
+	publicBaseURL = strings.TrimRight(base, "/")
+}
+
+// PublicURL 将本服务的文件路径（/uploads/...、/files/...，头像可能不带开头的"/"）转换为公开访问URL，
+// 其他值（如默认头像、外部URL）原样返回
+func PublicURL(path string) string {
+	if publicBaseURL == "" {
+		return path
+	}
+	switch {
+	case strings.HasPrefix(path, "/uploads/"), strings.HasPrefix(path, "/files/"):
+		return publicBaseURL + path
+	case strings.HasPrefix(path, "uploads/"):
+		return publicBaseURL + "/" + path
+	}
+	return path
+}
+
+// CanonicalFileURL 去掉公开访问前缀，还原为存储在消息内容和用户资料中的相对路径
+// 客户端可能直接把上传接口返回的公开URL作为消息内容发送
+func CanonicalFileURL(url string) string {
+	if publicBaseURL != "" && strings.HasPrefix(url, publicBaseURL+"/") {
+		return strings.TrimPrefix(url, publicBaseURL)
+	}
+	return url
+}
+
+// canonicalMessageContent 将图片/语音/视频/文件消息内容中的公开URL还原为相对路径，
+// 保证引用记录、访问校验和CDN地址变更后的历史消息都按相对路径处理
+func canonicalMessageContent(msg *models.Message) {
+	if publicBaseURL == "" {
+		return
+	}
+	switch msg.MsgType {
+	case models.MessageTypeImage, models.MessageTypeVoice, models.MessageTypeVideo:
+		msg.Content = CanonicalFileURL(msg.Content)
+	case models.MessageTypeFile:
+		var content map[string]interface{}
+		if err := json.Unmarshal([]byte(msg.Content), &content); err != nil {
+			return
+		}
+		url, ok := content["url"].(string)
+		if !ok || CanonicalFileURL(url) == url {
+			return
+		}
+		content["url"] = CanonicalFileURL(url)
+		if data, err := json.Marshal(content); err == nil {
+			msg.Content = string(data)
+		}
+	}
+}
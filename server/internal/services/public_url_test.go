@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/models"
+)
+
+func TestPublicURL(t *testing.T) {
+	SetPublicBaseURL("https://cdn.example.com/")
+	t.Cleanup(func() { SetPublicBaseURL("") })
+
+	assert.Equal(t, "https://cdn.example.com/uploads/files/a.jpg", PublicURL("/uploads/files/a.jpg"))
+	assert.Equal(t, "https://cdn.example.com/uploads/files/a.jpg", PublicURL("uploads/files/a.jpg"), "头像存储时不带开头的/")
+	assert.Equal(t, "https://cdn.example.com/files/1?expires=1&sig=x", PublicURL("/files/1?expires=1&sig=x"))
+	assert.Equal(t, "default.png", PublicURL("default.png"))
+	assert.Equal(t, "https://other.example.com/a.jpg", PublicURL("https://other.example.com/a.jpg"))
+
+	assert.Equal(t, "/uploads/files/a.jpg", CanonicalFileURL("https://cdn.example.com/uploads/files/a.jpg"))
+	assert.Equal(t, "https://other.example.com/a.jpg", CanonicalFileURL("https://other.example.com/a.jpg"))
+
+	image := &models.Message{MsgType: models.MessageTypeImage, Content: "https://cdn.example.com/uploads/files/a.jpg"}
+	canonicalMessageContent(image)
+	assert.Equal(t, "/uploads/files/a.jpg", image.Content)
+
+	file := &models.Message{MsgType: models.MessageTypeFile, Content: `{"url":"https://cdn.example.com/uploads/files/a.pdf","name":"a.pdf","size":1}`}
+	canonicalMessageContent(file)
+	assert.JSONEq(t, `{"url":"/uploads/files/a.pdf","name":"a.pdf","size":1}`, file.Content)
+
+	text := &models.Message{MsgType: models.MessageTypeText, Content: "https://cdn.example.com/uploads/files/a.jpg"}
+	canonicalMessageContent(text)
+	assert.Equal(t, "https://cdn.example.com/uploads/files/a.jpg", text.Content, "文本消息不处理")
+}
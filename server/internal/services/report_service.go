@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+// 举报对象类型
+const (
+	ReportTargetMessage = "message"
+	ReportTargetUser    = "user"
+)
+
+// 举报状态
+const (
+	ReportStatusOpen      = "open"      // 待处理
+	ReportStatusReviewing = "reviewing" // 审核员已认领
+	ReportStatusResolved  = "resolved"  // 已处理
+)
+
+// 举报处理动作
+const (
+	ReportActionDismiss       = "dismiss"        // 不违规，不处理
+	ReportActionDeleteMessage = "delete_message" // 下架被举报的消息
+	ReportActionWarn          = "warn"           // 警告被举报的用户
+	ReportActionMute          = "mute"           // 禁言被举报的用户
+	ReportActionBan           = "ban"            // 永久封禁被举报的用户
+)
+
+// 审核通知类型
+const (
+	ModerationNoticeWarning        = "warning"         // 被警告
+	ModerationNoticeMuted          = "muted"           // 被禁言
+	ModerationNoticeReportResolved = "report_resolved" // 举报已处理，发给举报人
+)
+
+// reportReasons 允许的举报原因
+var reportReasons = map[string]bool{
+	"spam":       true,
+	"harassment": true,
+	"fraud":      true,
+	"illegal":    true,
+	"other":      true,
+}
+
+var (
+	ErrReportNotFound      = errors.New("report not found")
+	ErrReportResolved      = errors.New("report already resolved")
+	ErrInvalidReportTarget = errors.New("target_type must be message or user")
+	ErrInvalidReportReason = errors.New("reason must be spam, harassment, fraud, illegal or other")
+	ErrReportSelf          = errors.New("cannot report yourself")
+	ErrInvalidReportAction = errors.New("invalid action for this report")
+)
+
+// ReportRequest 举报请求
+type ReportRequest struct {
+	TargetType  string `json:"target_type" binding:"required"`
+	TargetID    int64  `json:"target_id" binding:"required"`
+	Reason      string `json:"reason" binding:"required"`
+	Description string `json:"description" binding:"max=500"`
+}
+
+// ResolveReportRequest 处理举报的请求，mute需要指定禁言时长（Go时长格式，如"24h"）
+type ResolveReportRequest struct {
+	Action   string `json:"action" binding:"required"`
+	Note     string `json:"note" binding:"max=500"`
+	Duration string `json:"duration"`
+}
+
+// ReportQuery 审核队列查询条件
+type ReportQuery struct {
+	Status         string
+	TargetType     string
+	ReportedUserID int64
+	BeforeID       int64 // 游标，返回ID小于该值的举报
+	Limit          int
+}
+
+// ModerationNoticeEvent 审核通知事件负载
+type ModerationNoticeEvent struct {
+	UserID      int64  `json:"user_id"`
+	Type        string `json:"type"` // 见ModerationNotice*
+	ReportID    int64  `json:"report_id,omitempty"`
+	TargetType  string `json:"target_type,omitempty"`
+	TargetID    int64  `json:"target_id,omitempty"`
+	ActionTaken bool   `json:"action_taken,omitempty"` // 举报处理结果：是否对被举报的内容或用户采取了措施
+	Note        string `json:"note,omitempty"`         // 警告和禁言的说明
+	MutedUntil  int64  `json:"muted_until,omitempty"`  // 禁言截止时间（毫秒时间戳）
+	CreatedAt   int64  `json:"created_at"`
+	RequestID   string `json:"request_id,omitempty"`
+}
+
+type ReportService struct {
+	db *gorm.DB
+}
+
+func NewReportService() *ReportService {
+	return &ReportService{db: database.GetDB()}
+}
+
+// NewReportServiceWithDB 创建举报服务（支持依赖注入）
+func NewReportServiceWithDB(db *gorm.DB) *ReportService {
+	return &ReportService{db: db}
+}
+
+// CreateReport 举报消息或用户；同一举报人对同一对象未处理的举报只保留一条，重复举报返回已有的举报
+// 只能举报自己能看到的消息，举报时保存消息内容的快照
+func (s *ReportService) CreateReport(ctx context.Context, reporterID int64, req *ReportRequest) (*models.Report, error) {
+	if !reportReasons[req.Reason] {
+		return nil, ErrInvalidReportReason
+	}
+	report := &models.Report{
+		ReporterID:  reporterID,
+		TargetType:  req.TargetType,
+		TargetID:    req.TargetID,
+		Reason:      req.Reason,
+		Description: req.Description,
+		Status:      ReportStatusOpen,
+	}
+
+	switch req.TargetType {
+	case ReportTargetMessage:
+		messageService := NewMessageServiceWithDB(s.db)
+		msg, _, err := messageService.findMessage(ctx, req.TargetID)
+		if err != nil {
+			return nil, err
+		}
+		visible, err := messageService.isParticipant(ctx, msg, reporterID)
+		if err != nil {
+			return nil, err
+		}
+		if !visible {
+			return nil, ErrMessageNotFound
+		}
+		report.ReportedUserID = msg.FromUserID
+		report.Snapshot = msg.Content
+	case ReportTargetUser:
+		if _, err := NewAdminServiceWithDB(s.db).findUser(ctx, req.TargetID); err != nil {
+			return nil, err
+		}
+		report.ReportedUserID = req.TargetID
+	default:
+		return nil, ErrInvalidReportTarget
+	}
+	if report.ReportedUserID == reporterID {
+		return nil, ErrReportSelf
+	}
+
+	var existing models.Report
+	err := database.Primary(s.db).WithContext(ctx).
+		Where("reporter_id = ? AND target_type = ? AND target_id = ? AND status <> ?", reporterID, req.TargetType, req.TargetID, ReportStatusResolved).
+		First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(report).Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ListReports 查询审核队列，按ID倒序分页，返回是否还有下一页
+func (s *ReportService) ListReports(ctx context.Context, q ReportQuery) ([]models.Report, bool, error) {
+	if q.Limit <= 0 || q.Limit > 200 {
+		q.Limit = 50
+	}
+	query := s.db.WithContext(ctx).Model(&models.Report{})
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.TargetType != "" {
+		query = query.Where("target_type = ?", q.TargetType)
+	}
+	if q.ReportedUserID > 0 {
+		query = query.Where("reported_user_id = ?", q.ReportedUserID)
+	}
+	if q.BeforeID > 0 {
+		query = query.Where("id < ?", q.BeforeID)
+	}
+
+	reports := []models.Report{}
+	if err := query.Order("id DESC").Limit(q.Limit + 1).Find(&reports).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(reports) > q.Limit
+	if hasMore {
+		reports = reports[:q.Limit]
+	}
+	return reports, hasMore, nil
+}
+
+// GetReport 获取举报详情
+func (s *ReportService) GetReport(ctx context.Context, reportID int64) (*models.Report, error) {
+	var report models.Report
+	err := database.Primary(s.db).WithContext(ctx).First(&report, reportID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ClaimReport 审核员认领举报，状态改为reviewing；已被他人认领时改由当前审核员处理
+func (s *ReportService) ClaimReport(ctx context.Context, reviewerID, reportID int64) (*models.Report, error) {
+	report, err := s.GetReport(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status == ReportStatusResolved {
+		return nil, ErrReportResolved
+	}
+	err = s.db.WithContext(ctx).Model(report).Updates(map[string]interface{}{
+		"status":      ReportStatusReviewing,
+		"assignee_id": reviewerID,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetReport(ctx, reportID)
+}
+
+// ResolveReport 执行处理动作，并把同一对象所有未处理的举报标记为已处理，通知举报人和被处理的用户
+func (s *ReportService) ResolveReport(ctx context.Context, reviewerID, reportID int64, req *ResolveReportRequest) (*models.Report, error) {
+	report, err := s.GetReport(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status == ReportStatusResolved {
+		return nil, ErrReportResolved
+	}
+
+	var mutedUntil time.Time
+	switch req.Action {
+	case ReportActionDismiss, ReportActionWarn, ReportActionBan:
+	case ReportActionDeleteMessage:
+		if report.TargetType != ReportTargetMessage {
+			return nil, ErrInvalidReportAction
+		}
+	case ReportActionMute:
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			return nil, errors.New("duration must be a positive duration such as 24h")
+		}
+		mutedUntil = time.Now().Add(duration)
+	default:
+		return nil, ErrInvalidReportAction
+	}
+
+	adminService := NewAdminServiceWithDB(s.db)
+	switch req.Action {
+	case ReportActionDeleteMessage:
+		// 消息可能已被发送者删除，仍然视为处理成功
+		if _, err := NewMessageServiceWithDB(s.db).TakedownMessage(ctx, report.TargetID); err != nil && !errors.Is(err, ErrMessageNotFound) {
+			return nil, err
+		}
+	case ReportActionWarn:
+		publishModerationNotice(ctx, s.db, &ModerationNoticeEvent{UserID: report.ReportedUserID, Type: ModerationNoticeWarning, Note: req.Note})
+	case ReportActionMute:
+		if _, err := adminService.MuteUser(ctx, reviewerID, report.ReportedUserID, mutedUntil); err != nil {
+			return nil, err
+		}
+		publishModerationNotice(ctx, s.db, &ModerationNoticeEvent{
+			UserID:     report.ReportedUserID,
+			Type:       ModerationNoticeMuted,
+			Note:       req.Note,
+			MutedUntil: mutedUntil.UnixMilli(),
+		})
+	case ReportActionBan:
+		if _, err := adminService.SuspendUser(ctx, reviewerID, report.ReportedUserID, nil, req.Note); err != nil {
+			return nil, err
+		}
+	}
+
+	// 同一对象的其他举报一并处理
+	var pending []models.Report
+	err = database.Primary(s.db).WithContext(ctx).
+		Where("target_type = ? AND target_id = ? AND status <> ?", report.TargetType, report.TargetID, ReportStatusResolved).
+		Find(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(pending))
+	for _, p := range pending {
+		ids = append(ids, p.ID)
+	}
+	now := time.Now()
+	err = s.db.WithContext(ctx).Model(&models.Report{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"status":          ReportStatusResolved,
+		"action":          req.Action,
+		"resolution_note": req.Note,
+		"resolved_by":     reviewerID,
+		"resolved_at":     now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pending {
+		publishModerationNotice(ctx, s.db, &ModerationNoticeEvent{
+			UserID:      p.ReporterID,
+			Type:        ModerationNoticeReportResolved,
+			ReportID:    p.ID,
+			TargetType:  p.TargetType,
+			TargetID:    p.TargetID,
+			ActionTaken: req.Action != ReportActionDismiss,
+		})
+	}
+	return s.GetReport(ctx, reportID)
+}
+
+// publishModerationNotice 通过发件箱投递审核通知，用户不在线时进入离线队列，重连后补发
+func publishModerationNotice(ctx context.Context, db *gorm.DB, notice *ModerationNoticeEvent) {
+	notice.CreatedAt = time.Now().UnixMilli()
+	notice.RequestID = logger.RequestIDFrom(ctx)
+	event, err := enqueueOutboxEvent(db.WithContext(ctx), EventModerationNotice, notice.UserID, notice)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("写入用户 %d 的审核通知失败: %v", notice.UserID, err)
+		return
+	}
+	if _, err := NewOutboxServiceWithDB(db).Publish(ctx, event.ID); err != nil {
+		logger.WithContext(ctx).Warnf("用户 %d 的审核通知投递失败，等待发件箱中继重试: %v", notice.UserID, err)
+	}
+}
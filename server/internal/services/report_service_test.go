@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+)
+
+// moderationNotices 读取发件箱中的审核通知
+func moderationNotices(t *testing.T, s *ReportService) []ModerationNoticeEvent {
+	t.Helper()
+	var events []models.OutboxEvent
+	require.NoError(t, s.db.Where("event_type = ?", EventModerationNotice).Order("id").Find(&events).Error)
+	notices := make([]ModerationNoticeEvent, 0, len(events))
+	for _, event := range events {
+		var notice ModerationNoticeEvent
+		require.NoError(t, json.Unmarshal([]byte(event.Payload), &notice))
+		notices = append(notices, notice)
+	}
+	return notices
+}
+
+func TestCreateReport(t *testing.T) {
+	s := NewReportServiceWithDB(newTestDB(t))
+	ctx := context.Background()
+	alice := createTestUser(t, s.db, "13800000001", "alice")
+	bob := createTestUser(t, s.db, "13800000002", "bob")
+	carol := createTestUser(t, s.db, "13800000003", "carol")
+	messageID, err := NewMessageServiceWithDB(s.db).SaveMessage(ctx, &models.Message{FromUserID: bob.ID, ToUserID: &alice.ID, Content: "buy now", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	report, err := s.CreateReport(ctx, alice.ID, &ReportRequest{TargetType: ReportTargetMessage, TargetID: messageID, Reason: "spam"})
+	require.NoError(t, err)
+	assert.Equal(t, ReportStatusOpen, report.Status)
+	assert.Equal(t, bob.ID, report.ReportedUserID)
+	assert.Equal(t, "buy now", report.Snapshot)
+
+	// 重复举报返回已有的举报
+	again, err := s.CreateReport(ctx, alice.ID, &ReportRequest{TargetType: ReportTargetMessage, TargetID: messageID, Reason: "fraud"})
+	require.NoError(t, err)
+	assert.Equal(t, report.ID, again.ID)
+
+	// 看不到的消息、自己和不存在的对象不能举报
+	_, err = s.CreateReport(ctx, carol.ID, &ReportRequest{TargetType: ReportTargetMessage, TargetID: messageID, Reason: "spam"})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, err = s.CreateReport(ctx, bob.ID, &ReportRequest{TargetType: ReportTargetMessage, TargetID: messageID, Reason: "spam"})
+	assert.ErrorIs(t, err, ErrReportSelf)
+	_, err = s.CreateReport(ctx, alice.ID, &ReportRequest{TargetType: ReportTargetUser, TargetID: 999, Reason: "spam"})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = s.CreateReport(ctx, alice.ID, &ReportRequest{TargetType: "group", TargetID: 1, Reason: "spam"})
+	assert.ErrorIs(t, err, ErrInvalidReportTarget)
+	_, err = s.CreateReport(ctx, alice.ID, &ReportRequest{TargetType: ReportTargetUser, TargetID: bob.ID, Reason: "boring"})
+	assert.ErrorIs(t, err, ErrInvalidReportReason)
+
+	_, err = s.CreateReport(ctx, carol.ID, &ReportRequest{TargetType: ReportTargetUser, TargetID: bob.ID, Reason: "harassment"})
+	require.NoError(t, err)
+	reports, hasMore, err := s.ListReports(ctx, ReportQuery{ReportedUserID: bob.ID, Limit: 1})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	require.Len(t, reports, 1)
+	assert.Equal(t, ReportTargetUser, reports[0].TargetType)
+}
+
+func TestResolveReportDeletesMessageAndNotifiesReporters(t *testing.T) {
+	s := NewReportServiceWithDB(newTestDB(t))
+	ctx := context.Background()
+	alice := createTestUser(t, s.db, "13800000001", "alice")
+	bob := createTestUser(t, s.db, "13800000002", "bob")
+	carol := createTestUser(t, s.db, "13800000003", "carol")
+	moderator := createTestUser(t, s.db, "13800000004", "moderator")
+	group, err := NewGroupServiceWithDB(s.db).CreateGroupWithMembers(ctx, alice.ID, "team", []int64{bob.ID, carol.ID})
+	require.NoError(t, err)
+	messageID, err := NewMessageServiceWithDB(s.db).SaveMessage(ctx, &models.Message{FromUserID: bob.ID, GroupID: &group.ID, Content: "abuse", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	first, err := s.CreateReport(ctx, alice.ID, &ReportRequest{TargetType: ReportTargetMessage, TargetID: messageID, Reason: "harassment"})
+	require.NoError(t, err)
+	second, err := s.CreateReport(ctx, carol.ID, &ReportRequest{TargetType: ReportTargetMessage, TargetID: messageID, Reason: "harassment"})
+	require.NoError(t, err)
+
+	claimed, err := s.ClaimReport(ctx, moderator.ID, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ReportStatusReviewing, claimed.Status)
+	assert.Equal(t, moderator.ID, claimed.AssigneeID)
+
+	_, err = s.ResolveReport(ctx, moderator.ID, first.ID, &ResolveReportRequest{Action: "shout"})
+	assert.ErrorIs(t, err, ErrInvalidReportAction)
+
+	resolved, err := s.ResolveReport(ctx, moderator.ID, first.ID, &ResolveReportRequest{Action: ReportActionDeleteMessage, Note: "harassment"})
+	require.NoError(t, err)
+	assert.Equal(t, ReportStatusResolved, resolved.Status)
+	assert.Equal(t, ReportActionDeleteMessage, resolved.Action)
+	assert.NotNil(t, resolved.ResolvedAt)
+	_, _, err = NewMessageServiceWithDB(s.db).findMessage(ctx, messageID)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+
+	// 同一消息的其他举报一并处理，快照仍保留消息内容
+	other, err := s.GetReport(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ReportStatusResolved, other.Status)
+	assert.Equal(t, "abuse", other.Snapshot)
+	_, err = s.ResolveReport(ctx, moderator.ID, second.ID, &ResolveReportRequest{Action: ReportActionDismiss})
+	assert.ErrorIs(t, err, ErrReportResolved)
+
+	notices := moderationNotices(t, s)
+	require.Len(t, notices, 2)
+	assert.ElementsMatch(t, []int64{alice.ID, carol.ID}, []int64{notices[0].UserID, notices[1].UserID})
+	for _, notice := range notices {
+		assert.Equal(t, ModerationNoticeReportResolved, notice.Type)
+		assert.True(t, notice.ActionTaken)
+		assert.Empty(t, notice.Note, "reporters should not see the moderator's note")
+	}
+}
+
+func TestResolveReportMutesUser(t *testing.T) {
+	s := NewReportServiceWithDB(newTestDB(t))
+	ctx := context.Background()
+	alice := createTestUser(t, s.db, "13800000001", "alice")
+	bob := createTestUser(t, s.db, "13800000002", "bob")
+	moderator := createTestUser(t, s.db, "13800000003", "moderator")
+
+	report, err := s.CreateReport(ctx, alice.ID, &ReportRequest{TargetType: ReportTargetUser, TargetID: bob.ID, Reason: "spam"})
+	require.NoError(t, err)
+	_, err = s.ResolveReport(ctx, moderator.ID, report.ID, &ResolveReportRequest{Action: ReportActionDeleteMessage})
+	assert.ErrorIs(t, err, ErrInvalidReportAction, "delete_message only applies to message reports")
+	_, err = s.ResolveReport(ctx, moderator.ID, report.ID, &ResolveReportRequest{Action: ReportActionMute})
+	assert.Error(t, err, "mute requires a duration")
+
+	require.NoError(t, CheckMuted(ctx, bob.ID))
+	_, err = s.ResolveReport(ctx, moderator.ID, report.ID, &ResolveReportRequest{Action: ReportActionMute, Duration: "24h", Note: "cool down"})
+	require.NoError(t, err)
+	var muted *UserMutedError
+	assert.True(t, errors.As(CheckMuted(ctx, bob.ID), &muted))
+
+	notices := moderationNotices(t, s)
+	require.Len(t, notices, 2)
+	assert.Equal(t, bob.ID, notices[0].UserID)
+	assert.Equal(t, ModerationNoticeMuted, notices[0].Type)
+	assert.Equal(t, "cool down", notices[0].Note)
+	assert.Equal(t, muted.Until.UnixMilli(), notices[0].MutedUntil)
+	assert.Equal(t, alice.ID, notices[1].UserID)
+	assert.Equal(t, ModerationNoticeReportResolved, notices[1].Type)
+}
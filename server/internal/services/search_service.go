@@ -0,0 +1,495 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/models"
+	"gochat/internal/search"
+)
+
+// 搜索后端
+const (
+	SearchBackendDatabase      = "database"
+	SearchBackendElasticsearch = "elasticsearch"
+)
+
+// 搜索范围
+const (
+	SearchTypeMessages = "messages"
+	SearchTypeUsers    = "users"
+	SearchTypeGroups   = "groups"
+)
+
+// EventSearchIndex 消息索引事件：消息写入或删除后由发件箱中继更新Elasticsearch索引
+const EventSearchIndex = "search.index"
+
+// highlightWidth 高亮片段的最大字符数
+const highlightWidth = 100
+
+var ErrInvalidSearchType = errors.New("types must be a comma separated list of messages, users and groups")
+
+var searchIndexed = metrics.NewCounterVec("search_index_total", "消息索引写入次数，result: success、error", "result")
+
+var (
+	// searchService 全局搜索服务，由InitSearch按配置创建
+	searchService SearchService
+	// searchIndexClient 消息索引使用的Elasticsearch客户端，使用数据库搜索时为nil
+	searchIndexClient *search.Client
+)
+
+// SearchIndexEvent 消息索引事件负载
+type SearchIndexEvent struct {
+	MessageID int64 `json:"message_id"`
+}
+
+// SearchQuery 全局搜索条件
+type SearchQuery struct {
+	Keyword  string
+	Types    []string // 搜索范围，为空时搜索全部
+	BeforeID int64    // 消息分页游标，只返回ID小于该值的消息
+	Limit    int      // 每种结果的最大条数
+}
+
+// includes 是否搜索该范围
+func (q SearchQuery) includes(searchType string) bool {
+	if len(q.Types) == 0 {
+		return true
+	}
+	for _, t := range q.Types {
+		if t == searchType {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchResults 全局搜索结果，highlight为HTML转义后的片段，匹配部分用<em>标记
+type SearchResults struct {
+	Messages     []MessageHit `json:"messages"`
+	HasMore      bool         `json:"has_more"`                 // 是否还有更多消息
+	NextBeforeID int64        `json:"next_before_id,omitempty"` // 下一页消息的before_id
+	Users        []UserHit    `json:"users"`
+	Groups       []GroupHit   `json:"groups"`
+}
+
+// MessageHit 消息搜索结果
+type MessageHit struct {
+	MessageInfo
+	Highlight string `json:"highlight"`
+}
+
+// UserHit 用户搜索结果，highlight为昵称
+type UserHit struct {
+	FriendInfo
+	Highlight string `json:"highlight"`
+}
+
+// GroupHit 群组搜索结果，只包含用户所在的群，highlight为群名
+type GroupHit struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	MemberCount int    `json:"member_count"`
+	Highlight   string `json:"highlight"`
+}
+
+// SearchService 全局搜索：在用户可见的范围内搜索消息、用户和群组
+type SearchService interface {
+	// Backend 后端名称，见SearchBackend*
+	Backend() string
+	// Search 搜索消息、用户和群组，消息按时间倒序
+	Search(ctx context.Context, userID int64, q SearchQuery) (*SearchResults, error)
+	// Reindex 从数据库重建消息索引，返回写入的消息数；数据库后端没有索引，直接返回
+	Reindex(ctx context.Context) (int, error)
+}
+
+// InitSearch 按配置创建全局搜索服务并注册发件箱处理函数，使用Elasticsearch时索引不存在则创建
+func InitSearch(cfg *config.SearchConfig) error {
+	// 切回数据库搜索时仍注册处理函数，丢弃之前遗留的事件
+	RegisterOutboxHandler(EventSearchIndex, indexSearchMessage)
+	if cfg.Backend != SearchBackendElasticsearch {
+		searchIndexClient = nil
+		searchService = NewDatabaseSearchWithDB(database.GetDB())
+		return nil
+	}
+
+	client, err := search.New(&cfg.Elasticsearch)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.EnsureIndex(ctx); err != nil {
+		return err
+	}
+	searchIndexClient = client
+	searchService = NewElasticsearchSearchWithDB(database.GetDB(), client, cfg.ReindexBatchSize)
+	return nil
+}
+
+// GetSearchService 返回全局搜索服务，未初始化时使用数据库搜索
+func GetSearchService() SearchService {
+	if searchService == nil {
+		return NewDatabaseSearchWithDB(database.GetDB())
+	}
+	return searchService
+}
+
+// ReindexSearch 维护任务：从数据库重建消息索引
+func ReindexSearch() {
+	start := time.Now()
+	count, err := GetSearchService().Reindex(context.Background())
+	if err != nil {
+		logger.GetLogger().Errorf("重建消息索引失败（已写入 %d 条）: %v", count, err)
+		return
+	}
+	logger.GetLogger().Infof("重建消息索引完成，写入 %d 条消息，耗时 %v", count, time.Since(start))
+}
+
+// DatabaseSearch 直接查询数据库的搜索，消息表有全文索引时使用FULLTEXT，否则使用LIKE
+type DatabaseSearch struct {
+	db *gorm.DB
+}
+
+// NewDatabaseSearchWithDB 创建数据库搜索服务（支持依赖注入）
+func NewDatabaseSearchWithDB(db *gorm.DB) *DatabaseSearch {
+	return &DatabaseSearch{db: db}
+}
+
+// Backend 后端名称
+func (s *DatabaseSearch) Backend() string {
+	return SearchBackendDatabase
+}
+
+// Search 搜索消息、用户和群组
+func (s *DatabaseSearch) Search(ctx context.Context, userID int64, q SearchQuery) (*SearchResults, error) {
+	results, err := newSearchResults(&q)
+	if err != nil {
+		return nil, err
+	}
+	if q.includes(SearchTypeMessages) {
+		messages, hasMore, err := NewMessageServiceWithDB(s.db).SearchMessages(ctx, userID, MessageSearch{Keyword: q.Keyword}, MessageCursor{BeforeID: q.BeforeID, Limit: q.Limit})
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range messages {
+			results.Messages = append(results.Messages, MessageHit{MessageInfo: msg, Highlight: messageHighlight(&msg, q.Keyword)})
+		}
+		if hasMore && len(messages) > 0 {
+			results.HasMore = true
+			results.NextBeforeID = messages[len(messages)-1].ID
+		}
+	}
+	if err := searchUsersAndGroups(ctx, s.db, userID, &q, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Reindex 数据库搜索没有索引
+func (s *DatabaseSearch) Reindex(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// ElasticsearchSearch 消息通过Elasticsearch搜索，用户和群组数据量小，仍然查询数据库
+type ElasticsearchSearch struct {
+	db        *gorm.DB
+	client    *search.Client
+	batchSize int
+}
+
+// NewElasticsearchSearchWithDB 创建Elasticsearch搜索服务（支持依赖注入）
+func NewElasticsearchSearchWithDB(db *gorm.DB, client *search.Client, batchSize int) *ElasticsearchSearch {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &ElasticsearchSearch{db: db, client: client, batchSize: batchSize}
+}
+
+// Backend 后端名称
+func (s *ElasticsearchSearch) Backend() string {
+	return SearchBackendElasticsearch
+}
+
+// Search 搜索消息、用户和群组
+// 索引只用于找出匹配的消息ID，消息内容和可见性（已删除、已退群）仍以数据库为准，索引滞后时不会返回不可见的消息
+func (s *ElasticsearchSearch) Search(ctx context.Context, userID int64, q SearchQuery) (*SearchResults, error) {
+	results, err := newSearchResults(&q)
+	if err != nil {
+		return nil, err
+	}
+	if q.includes(SearchTypeMessages) {
+		var groupIDs []int64
+		err := s.db.WithContext(ctx).Model(&models.GroupMember{}).Where("user_id = ?", userID).Pluck("group_id", &groupIDs).Error
+		if err != nil {
+			return nil, err
+		}
+		hits, err := s.client.Search(ctx, search.Query{
+			Keyword:  q.Keyword,
+			UserID:   userID,
+			GroupIDs: groupIDs,
+			BeforeID: q.BeforeID,
+			Size:     q.Limit + 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(hits) > q.Limit {
+			hits = hits[:q.Limit]
+			results.HasMore = true
+			results.NextBeforeID = hits[len(hits)-1].ID
+		}
+
+		ids := make([]int64, 0, len(hits))
+		highlights := make(map[int64]string, len(hits))
+		for _, hit := range hits {
+			ids = append(ids, hit.ID)
+			highlights[hit.ID] = hit.Highlight
+		}
+		messages, err := NewMessageServiceWithDB(s.db).messagesByIDs(ctx, userID, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range messages {
+			highlight := highlights[msg.ID]
+			if highlight == "" {
+				highlight = messageHighlight(&msg, q.Keyword)
+			}
+			results.Messages = append(results.Messages, MessageHit{MessageInfo: msg, Highlight: highlight})
+		}
+	}
+	if err := searchUsersAndGroups(ctx, s.db, userID, &q, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Reindex 按ID顺序分批把归档表和热表中的消息写入索引，重复执行时覆盖已有文档
+func (s *ElasticsearchSearch) Reindex(ctx context.Context) (int, error) {
+	if err := s.client.EnsureIndex(ctx); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, table := range []string{models.ArchivedMessage{}.TableName(), models.Message{}.TableName()} {
+		var lastID int64
+		for {
+			var batch []models.Message
+			err := s.db.WithContext(ctx).Table(table).
+				Where("id > ?", lastID).
+				Order("id").
+				Limit(s.batchSize).
+				Find(&batch).Error
+			if err != nil {
+				return total, err
+			}
+			if len(batch) == 0 {
+				break
+			}
+			docs := make([]search.Document, 0, len(batch))
+			for i := range batch {
+				if doc, ok := searchDocument(&batch[i]); ok {
+					docs = append(docs, doc)
+				}
+			}
+			if err := s.client.Bulk(ctx, docs, nil); err != nil {
+				return total, err
+			}
+			total += len(docs)
+			lastID = batch[len(batch)-1].ID
+			if len(batch) < s.batchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// newSearchResults 校验并补全搜索条件，返回空结果
+func newSearchResults(q *SearchQuery) (*SearchResults, error) {
+	for _, t := range q.Types {
+		if t != SearchTypeMessages && t != SearchTypeUsers && t != SearchTypeGroups {
+			return nil, ErrInvalidSearchType
+		}
+	}
+	if q.Limit <= 0 || q.Limit > 50 {
+		q.Limit = 20
+	}
+	return &SearchResults{Messages: []MessageHit{}, Users: []UserHit{}, Groups: []GroupHit{}}, nil
+}
+
+// searchUsersAndGroups 按昵称、手机号搜索用户，按群名搜索用户所在的群
+func searchUsersAndGroups(ctx context.Context, db *gorm.DB, userID int64, q *SearchQuery, results *SearchResults) error {
+	if q.includes(SearchTypeUsers) {
+		users, err := NewFriendServiceWithDB(db).SearchUsers(ctx, q.Keyword, userID, q.Limit)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			results.Users = append(results.Users, UserHit{FriendInfo: user, Highlight: highlightText(user.Nickname, q.Keyword)})
+		}
+	}
+	if q.includes(SearchTypeGroups) {
+		var groups []GroupHit
+		err := db.WithContext(ctx).Table("groups g").
+			Select("g.id, g.name, g.member_count").
+			Joins("JOIN group_members gm ON gm.group_id = g.id").
+			Where("gm.user_id = ? AND g.deleted_at IS NULL AND g.name LIKE ? ESCAPE '!'", userID, "%"+likeEscaper.Replace(q.Keyword)+"%").
+			Order("g.id DESC").
+			Limit(q.Limit).
+			Scan(&groups).Error
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			group.Highlight = highlightText(group.Name, q.Keyword)
+			results.Groups = append(results.Groups, group)
+		}
+	}
+	return nil
+}
+
+// messageHighlight 消息的高亮片段：文本消息为内容，文件消息为文件名，其他类型为空
+func messageHighlight(msg *MessageInfo, keyword string) string {
+	switch msg.MsgType {
+	case models.MessageTypeText:
+		return highlightText(msg.Content, keyword)
+	case models.MessageTypeFile:
+		if fm, ok := ParseFileMessage(msg.Content); ok {
+			return highlightText(fm.Name, keyword)
+		}
+	}
+	return ""
+}
+
+// highlightText 截取第一处匹配附近最多highlightWidth个字符，HTML转义后用<em>标记匹配部分（不区分大小写）
+func highlightText(text, keyword string) string {
+	runes := []rune(text)
+	lower := []rune(strings.Map(unicode.ToLower, text))
+	needle := []rune(strings.Map(unicode.ToLower, keyword))
+
+	var matches []int
+	if len(needle) > 0 {
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) == string(needle) {
+				matches = append(matches, i)
+				i += len(needle) - 1
+			}
+		}
+	}
+
+	// 匹配位置前保留少量上下文
+	start := 0
+	if len(matches) > 0 && len(runes) > highlightWidth && matches[0] > highlightWidth/5 {
+		start = matches[0] - highlightWidth/5
+	}
+	end := start + highlightWidth
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, m := range matches {
+		if m < pos {
+			continue
+		}
+		if m+len(needle) > end {
+			break
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:m])))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(string(runes[m : m+len(needle)])))
+		b.WriteString("</em>")
+		pos = m + len(needle)
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// searchDocument 把消息转换为索引文档：文本消息索引内容，文件消息索引文件名，其他类型不索引
+func searchDocument(msg *models.Message) (search.Document, bool) {
+	doc := search.Document{
+		ID:         msg.ID,
+		FromUserID: msg.FromUserID,
+		MsgType:    msg.MsgType,
+		CreatedAt:  msg.CreatedAt.UnixMilli(),
+	}
+	switch msg.MsgType {
+	case models.MessageTypeText:
+		doc.Content = msg.Content
+	case models.MessageTypeFile:
+		fm, ok := ParseFileMessage(msg.Content)
+		if !ok || fm.Name == "" {
+			return doc, false
+		}
+		doc.Content = fm.Name
+	default:
+		return doc, false
+	}
+	if msg.ToUserID != nil {
+		doc.ToUserID = *msg.ToUserID
+	}
+	if msg.GroupID != nil {
+		doc.GroupID = *msg.GroupID
+	}
+	return doc, true
+}
+
+// enqueueSearchIndex 在写入或删除消息的事务中写入索引事件，只有使用Elasticsearch时才需要
+// 事件由中继投递，索引出错时按发件箱的退避策略重试，不影响消息的实时推送
+func enqueueSearchIndex(tx *gorm.DB, messageID int64) error {
+	if searchIndexClient == nil {
+		return nil
+	}
+	_, err := enqueueRelayedOutboxEvent(tx, EventSearchIndex, messageID, SearchIndexEvent{MessageID: messageID})
+	return err
+}
+
+// indexSearchMessage 发件箱处理函数：按数据库中消息的当前状态更新索引，消息已被删除时从索引中移除
+// 同一消息的事件重复或乱序投递时结果相同
+func indexSearchMessage(ctx context.Context, event *models.OutboxEvent) error {
+	var payload SearchIndexEvent
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		logger.GetLogger().Errorf("发件箱事件 %d 负载无效: %v", event.ID, err)
+		return nil
+	}
+	client := searchIndexClient
+	if client == nil {
+		return nil
+	}
+
+	msg, _, err := NewMessageServiceWithDB(database.GetDB()).findMessage(ctx, payload.MessageID)
+	switch {
+	case errors.Is(err, ErrMessageNotFound):
+		err = client.Bulk(ctx, nil, []int64{payload.MessageID})
+	case err != nil:
+		return err
+	default:
+		if doc, ok := searchDocument(msg); ok {
+			err = client.Bulk(ctx, []search.Document{doc}, nil)
+		}
+	}
+	if err != nil {
+		searchIndexed.WithLabelValues("error").Inc()
+		return err
+	}
+	searchIndexed.WithLabelValues("success").Inc()
+	return nil
+}
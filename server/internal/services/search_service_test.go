@@ -0,0 +1,172 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+	"gochat/internal/search"
+)
+
+func TestHighlightText(t *testing.T) {
+	assert.Equal(t, "say <em>Hello</em> to <em>hello</em>", highlightText("say Hello to hello", "hello"))
+	assert.Equal(t, "&lt;b&gt;<em>你好</em>&lt;/b&gt;", highlightText("<b>你好</b>", "你好"))
+	assert.Equal(t, "no match", highlightText("no match", "xyz"))
+
+	long := strings.Repeat("a", 150) + "needle" + strings.Repeat("b", 150)
+	snippet := highlightText(long, "needle")
+	assert.True(t, strings.HasPrefix(snippet, "…"+strings.Repeat("a", highlightWidth/5)+"<em>needle</em>"))
+	assert.True(t, strings.HasSuffix(snippet, "b…"))
+	assert.Equal(t, highlightWidth, len([]rune(strings.NewReplacer("<em>", "", "</em>", "", "…", "").Replace(snippet))))
+}
+
+func TestDatabaseSearch(t *testing.T) {
+	db := newTestDB(t)
+	s := NewDatabaseSearchWithDB(db)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "Project bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+	groupService := NewGroupServiceWithDB(db)
+	team, err := groupService.CreateGroupWithMembers(ctx, alice.ID, "project team", []int64{bob.ID})
+	require.NoError(t, err)
+	_, err = groupService.CreateGroupWithMembers(ctx, carol.ID, "project secret", nil)
+	require.NoError(t, err)
+
+	messageService := NewMessageServiceWithDB(db)
+	first, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: bob.ID, ToUserID: &alice.ID, Content: "the project <plan>", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	second, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: bob.ID, GroupID: &team.ID, Content: "Project kickoff", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	_, err = messageService.SaveMessage(ctx, &models.Message{FromUserID: carol.ID, ToUserID: &bob.ID, Content: "project gossip", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	results, err := s.Search(ctx, alice.ID, SearchQuery{Keyword: "project", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, results.Messages, 1)
+	assert.Equal(t, second, results.Messages[0].ID)
+	assert.Equal(t, "<em>Project</em> kickoff", results.Messages[0].Highlight)
+	assert.True(t, results.HasMore)
+	assert.Equal(t, second, results.NextBeforeID)
+	require.Len(t, results.Users, 1)
+	assert.Equal(t, "<em>Project</em> bob", results.Users[0].Highlight)
+	require.Len(t, results.Groups, 1, "groups the user is not in should not be returned")
+	assert.Equal(t, team.ID, results.Groups[0].ID)
+	assert.Equal(t, "<em>project</em> team", results.Groups[0].Highlight)
+
+	results, err = s.Search(ctx, alice.ID, SearchQuery{Keyword: "project", Types: []string{SearchTypeMessages}, BeforeID: results.NextBeforeID})
+	require.NoError(t, err)
+	require.Len(t, results.Messages, 1)
+	assert.Equal(t, first, results.Messages[0].ID)
+	assert.Equal(t, "the <em>project</em> &lt;plan&gt;", results.Messages[0].Highlight)
+	assert.False(t, results.HasMore)
+	assert.Empty(t, results.Users)
+	assert.Empty(t, results.Groups)
+
+	_, err = s.Search(ctx, alice.ID, SearchQuery{Keyword: "project", Types: []string{"files"}})
+	assert.ErrorIs(t, err, ErrInvalidSearchType)
+}
+
+// fakeElasticsearch 记录_bulk请求中的文档操作，_search返回预设的命中
+type fakeElasticsearch struct {
+	mu      sync.Mutex
+	indexed map[string]string // 文档ID -> content
+	deleted []string
+	hits    []int64
+}
+
+func (f *fakeElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_bulk"):
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				continue
+			}
+			if op, ok := action["delete"]; ok {
+				f.deleted = append(f.deleted, op["_id"])
+				continue
+			}
+			scanner.Scan()
+			var doc search.Document
+			_ = json.Unmarshal(scanner.Bytes(), &doc)
+			f.indexed[action["index"]["_id"]] = doc.Content
+		}
+		fmt.Fprint(w, `{"errors":false,"items":[]}`)
+	case strings.HasSuffix(r.URL.Path, "/_search"):
+		var hits []string
+		for _, id := range f.hits {
+			hits = append(hits, fmt.Sprintf(`{"_id":"%d","highlight":{"content":["es <em>hit</em>"]}}`, id))
+		}
+		fmt.Fprintf(w, `{"hits":{"hits":[%s]}}`, strings.Join(hits, ","))
+	}
+}
+
+func TestElasticsearchIndexingAndSearch(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	fake := &fakeElasticsearch{indexed: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client, err := search.New(&config.ElasticsearchConfig{URL: server.URL, Index: "messages", Timeout: "5s"})
+	require.NoError(t, err)
+	searchIndexClient = client
+	t.Cleanup(func() { searchIndexClient = nil })
+	s := NewElasticsearchSearchWithDB(db, client, 2)
+
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+	carol := createTestUser(t, db, "13800000003", "carol")
+	messageService := NewMessageServiceWithDB(db)
+	visible, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: bob.ID, ToUserID: &alice.ID, Content: "hit one", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	deleted, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hit two", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	other, err := messageService.SaveMessage(ctx, &models.Message{FromUserID: carol.ID, ToUserID: &bob.ID, Content: "hit three", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	require.NoError(t, messageService.DeleteMessageForEveryone(ctx, alice.ID, deleted))
+
+	// 每条消息的写入和删除都有索引事件，按消息当前状态更新索引
+	var events []models.OutboxEvent
+	require.NoError(t, db.Where("event_type = ?", EventSearchIndex).Order("id").Find(&events).Error)
+	require.Len(t, events, 4)
+	for i := range events {
+		require.NoError(t, indexSearchMessage(ctx, &events[i]))
+	}
+	assert.Equal(t, map[string]string{fmt.Sprint(visible): "hit one", fmt.Sprint(other): "hit three"}, fake.indexed)
+	assert.Contains(t, fake.deleted, fmt.Sprint(deleted))
+
+	// 索引滞后时返回的已删除和不可见的消息由数据库过滤
+	fake.hits = []int64{other, deleted, visible}
+	results, err := s.Search(ctx, alice.ID, SearchQuery{Keyword: "hit", Types: []string{SearchTypeMessages}})
+	require.NoError(t, err)
+	require.Len(t, results.Messages, 1)
+	assert.Equal(t, visible, results.Messages[0].ID)
+	assert.Equal(t, "es <em>hit</em>", results.Messages[0].Highlight)
+	assert.False(t, results.HasMore)
+
+	results, err = s.Search(ctx, alice.ID, SearchQuery{Keyword: "hit", Types: []string{SearchTypeMessages}, Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, results.HasMore)
+	assert.Equal(t, deleted, results.NextBeforeID)
+
+	fake.indexed = make(map[string]string)
+	count, err := s.Reindex(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Len(t, fake.indexed, 2)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/models"
+)
+
+// newTestDB 使用临时SQLite文件初始化数据库并执行迁移
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	cfg := &config.DatabaseConfig{
+		Driver: database.DriverSQLite,
+		DBName: filepath.Join(t.TempDir(), "gochat.db"),
+	}
+	require.NoError(t, database.Init(cfg))
+	t.Cleanup(func() { database.Close() })
+	require.NoError(t, database.Migrate())
+	return database.GetDB()
+}
+
+func createTestUser(t *testing.T, db *gorm.DB, phone, nickname string) *models.User {
+	t.Helper()
+	user := &models.User{Phone: phone, PasswordHash: "x", Nickname: nickname, Avatar: nickname + ".png"}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+func TestPrivateMessagesOnSQLite(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+
+	messageService := NewMessageServiceWithDB(db)
+	before := time.Now().UTC().Add(-time.Second).UnixMilli()
+	_, err := messageService.SaveMessage(context.Background(), &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hi", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+
+	messages, hasMore, err := messageService.GetPrivateMessagesWithUserInfo(context.Background(), alice.ID, bob.ID, MessageCursor{Limit: 20})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "hi", messages[0].Content)
+	assert.Equal(t, "alice", messages[0].FromUser.Nickname)
+	assert.GreaterOrEqual(t, messages[0].CreatedAt, before)
+	assert.LessOrEqual(t, messages[0].CreatedAt, time.Now().UTC().Add(time.Second).UnixMilli())
+}
+
+func TestGroupQueriesOnSQLite(t *testing.T) {
+	db := newTestDB(t)
+	owner := createTestUser(t, db, "13800000001", "owner")
+	member := createTestUser(t, db, "13800000002", "member")
+
+	groupService := NewGroupServiceWithDB(db)
+	group, err := groupService.CreateGroupWithMembers(context.Background(), owner.ID, "team", []int64{member.ID})
+	require.NoError(t, err)
+
+	members, err := groupService.GetGroupMembersWithUserInfo(context.Background(), group.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	assert.Equal(t, owner.ID, members[0].UserID)
+	assert.True(t, members[0].IsOwner)
+	assert.Len(t, members[0].JoinedAt, len("2006-01-02 15:04:05"))
+
+	conversationService := NewConversationServiceWithDB(db)
+	msgID, err := NewMessageServiceWithDB(db).SaveMessage(context.Background(), &models.Message{FromUserID: owner.ID, GroupID: &group.ID, Content: "hello", MsgType: models.MessageTypeText})
+	require.NoError(t, err)
+	require.NoError(t, conversationService.UpdateLastMessage(context.Background(), member.ID, group.ID, msgID, "hello"))
+
+	conversations, err := conversationService.GetConversations(context.Background(), member.ID)
+	require.NoError(t, err)
+	require.Len(t, conversations, 1)
+	assert.Equal(t, "team", conversations[0].TargetName)
+	assert.Equal(t, "hello", conversations[0].LastMsgContent)
+	assert.NotEmpty(t, conversations[0].LastMsgTime)
+}
+
+func TestOptimizeDatabaseOnSQLite(t *testing.T) {
+	db := newTestDB(t)
+
+	require.NoError(t, database.OptimizeDatabase(db))
+	require.NoError(t, database.AnalyzeDatabase(db))
+
+	stats, err := database.GetDatabaseStats(db)
+	require.NoError(t, err)
+	assert.NotEmpty(t, stats["tables"])
+	assert.NotEmpty(t, stats["indexes"])
+}
+
+func TestMessageCursorPaginationIsStable(t *testing.T) {
+	db := newTestDB(t)
+	owner := createTestUser(t, db, "13800000001", "owner")
+	group := &models.Group{Name: "team", OwnerID: owner.ID}
+	require.NoError(t, db.Create(group).Error)
+
+	messageService := NewMessageServiceWithDB(db)
+	send := func() int64 {
+		id, err := messageService.SaveMessage(context.Background(), &models.Message{FromUserID: owner.ID, GroupID: &group.ID, Content: "m", MsgType: models.MessageTypeText})
+		require.NoError(t, err)
+		return id
+	}
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		ids = append(ids, send())
+	}
+
+	first, hasMore, err := messageService.GetGroupMessagesWithUserInfo(context.Background(), group.ID, owner.ID, MessageCursor{Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, []int64{ids[4], ids[3]}, messageIDs(first))
+
+	// 翻页期间有新消息到达，不影响下一页内容
+	newID := send()
+	second, hasMore, err := messageService.GetGroupMessagesWithUserInfo(context.Background(), group.ID, owner.ID, MessageCursor{BeforeID: ids[3], Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, []int64{ids[2], ids[1]}, messageIDs(second))
+
+	last, hasMore, err := messageService.GetGroupMessagesWithUserInfo(context.Background(), group.ID, owner.ID, MessageCursor{BeforeID: ids[1], Limit: 2})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	assert.Equal(t, []int64{ids[0]}, messageIDs(last))
+
+	newer, hasMore, err := messageService.GetGroupMessagesWithUserInfo(context.Background(), group.ID, owner.ID, MessageCursor{AfterID: ids[4], Limit: 2})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	assert.Equal(t, []int64{newID}, messageIDs(newer))
+}
+
+func TestPagedHistoryReportsHasMore(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+
+	messageService := NewMessageServiceWithDB(db)
+	for i := 0; i < 3; i++ {
+		_, err := messageService.SaveMessage(context.Background(), &models.Message{FromUserID: alice.ID, ToUserID: &bob.ID, Content: "hi", MsgType: models.MessageTypeText})
+		require.NoError(t, err)
+	}
+
+	first, hasMore, err := messageService.GetPrivateMessages(context.Background(), bob.ID, alice.ID, 1, 2)
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Len(t, first, 2)
+
+	second, hasMore, err := messageService.GetPrivateMessages(context.Background(), bob.ID, alice.ID, 2, 2)
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	require.Len(t, second, 1)
+	assert.Less(t, second[0].ID, first[1].ID)
+}
+
+func TestCancelledContextAbortsQuery(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "13800000001", "alice")
+	bob := createTestUser(t, db, "13800000002", "bob")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// 请求取消后不再执行查询
+	_, _, err := NewMessageServiceWithDB(db).GetPrivateMessagesWithUserInfo(ctx, alice.ID, bob.ID, MessageCursor{Limit: 20})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, NewFriendServiceWithDB(db).AddFriend(ctx, alice.ID, bob.ID), context.Canceled)
+
+	friends, err := NewFriendServiceWithDB(db).GetFriends(context.Background(), alice.ID)
+	require.NoError(t, err)
+	assert.Empty(t, friends)
+}
+
+func messageIDs(messages []MessageInfo) []int64 {
+	ids := make([]int64, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
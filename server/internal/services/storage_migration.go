@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gochat/internal/logger"
+	"gochat/internal/models"
+)
+
+// RemoteStoragePrefix 已迁移到对象存储的文件在storage_path中的前缀，其后为对象键（即原来的本地相对路径）
+const RemoteStoragePrefix = "s3://"
+
+// migrationBatchSize 每批读取的文件记录数
+const migrationBatchSize = 200
+
+// ObjectStore 文件迁移使用的对象存储操作，由objectstore.Client实现，测试时可替换
+type ObjectStore interface {
+	PutObject(ctx context.Context, key string, body io.ReadSeeker, size int64, sha256Hex, contentType string) error
+	HeadObject(ctx context.Context, key string) (int64, error)
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// IsRemoteFile 文件原图是否已迁移到对象存储
+func IsRemoteFile(file *models.FileStorage) bool {
+	return strings.HasPrefix(file.StoragePath, RemoteStoragePrefix)
+}
+
+// LocalStoragePath 文件的本地相对路径（已迁移文件即对象键），缩略图等派生文件始终在本地按此路径存放
+func LocalStoragePath(file *models.FileStorage) string {
+	return strings.TrimPrefix(file.StoragePath, RemoteStoragePrefix)
+}
+
+// StorageMigrationOptions 迁移参数
+type StorageMigrationOptions struct {
+	Limit       int   // 本次最多迁移的文件数，0表示不限制
+	RateBytes   int64 // 上传速率上限（字节/秒），0表示不限制
+	DeleteLocal bool  // 迁移成功后删除本地原图（缩略图等派生文件保留在本地）
+}
+
+// StorageMigrationResult 迁移结果
+type StorageMigrationResult struct {
+	Migrated int   // 迁移成功的文件数
+	Failed   int   // 失败的文件数，下次运行时重试
+	Bytes    int64 // 上传的字节数
+}
+
+// MigrateToObjectStore 将本地存储的文件逐个复制到对象存储，校验哈希后把storage_path改为对象存储路径
+// 已迁移的文件不会重复处理，中断后重新运行即可继续；单个文件失败只记录日志，不影响其他文件
+func (s *FileService) MigrateToObjectStore(ctx context.Context, store ObjectStore, opts StorageMigrationOptions) (*StorageMigrationResult, error) {
+	log := logger.GetLogger()
+	result := &StorageMigrationResult{}
+	start := time.Now()
+
+	var lastID int64
+	for {
+		var files []models.FileStorage
+		if err := s.db.WithContext(ctx).
+			Where("id > ? AND storage_path NOT LIKE ?", lastID, RemoteStoragePrefix+"%").
+			Order("id").Limit(migrationBatchSize).Find(&files).Error; err != nil {
+			return result, fmt.Errorf("failed to query files: %w", err)
+		}
+		if len(files) == 0 {
+			return result, nil
+		}
+
+		for i := range files {
+			file := &files[i]
+			lastID = file.ID
+			if opts.Limit > 0 && result.Migrated+result.Failed >= opts.Limit {
+				return result, nil
+			}
+
+			size, err := s.migrateFile(ctx, store, file, opts.DeleteLocal)
+			if err != nil {
+				if ctx.Err() != nil {
+					return result, ctx.Err()
+				}
+				result.Failed++
+				log.Warnf("文件迁移失败: id=%d, path=%s, error=%v", file.ID, file.StoragePath, err)
+				continue
+			}
+			result.Migrated++
+			result.Bytes += size
+
+			if err := throttle(ctx, start, result.Bytes, opts.RateBytes); err != nil {
+				return result, err
+			}
+		}
+		log.Infof("文件迁移进度: 已迁移=%d, 失败=%d, 上传=%.2fMB, 当前ID=%d",
+			result.Migrated, result.Failed, float64(result.Bytes)/1024/1024, lastID)
+	}
+}
+
+// migrateFile 迁移单个文件，返回上传的字节数（对象已存在时为0）
+func (s *FileService) migrateFile(ctx context.Context, store ObjectStore, file *models.FileStorage, deleteLocal bool) (int64, error) {
+	key := file.StoragePath
+	f, err := os.Open(key)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// 本地文件可能已损坏，哈希不一致时不迁移
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return 0, err
+	}
+	if hash := hex.EncodeToString(hasher.Sum(nil)); hash != file.Hash {
+		return 0, fmt.Errorf("hash mismatch: expected %s, got %s", file.Hash, hash)
+	}
+
+	// 上次运行可能在上传后、更新记录前中断，对象已完整存在时不重复上传
+	var uploaded int64
+	if remoteSize, err := store.HeadObject(ctx, key); err != nil || remoteSize != size {
+		contentType := ContentType(file)
+		if contentType == "" {
+			contentType = file.MimeType
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		// 请求携带内容的SHA256，对象存储据此校验收到的数据
+		if err := store.PutObject(ctx, key, f, size, file.Hash, contentType); err != nil {
+			return 0, err
+		}
+		remoteSize, err := store.HeadObject(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to verify uploaded object: %w", err)
+		}
+		if remoteSize != size {
+			return 0, fmt.Errorf("size mismatch after upload: expected %d, got %d", size, remoteSize)
+		}
+		uploaded = size
+	}
+
+	// 记录未被并发修改时才更新
+	res := s.db.WithContext(ctx).Model(&models.FileStorage{}).
+		Where("id = ? AND storage_path = ?", file.ID, key).
+		Update("storage_path", RemoteStoragePrefix+key)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, errors.New("file record changed during migration")
+	}
+
+	if deleteLocal {
+		f.Close()
+		if err := os.Remove(key); err != nil && !os.IsNotExist(err) {
+			logger.GetLogger().Warnf("删除已迁移的本地文件失败: path=%s, error=%v", key, err)
+		}
+	}
+	return uploaded, nil
+}
+
+// throttle 按累计上传量等待，使平均速率不超过rate字节/秒
+func throttle(ctx context.Context, start time.Time, bytes, rate int64) error {
+	if rate <= 0 {
+		return nil
+	}
+	wait := time.Duration(float64(bytes)/float64(rate)*float64(time.Second)) - time.Since(start)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+	"gochat/internal/objectstore"
+)
+
+// memoryStore 内存对象存储，像S3一样校验请求携带的SHA256
+type memoryStore struct {
+	objects map[string][]byte
+	puts    int
+}
+
+func (m *memoryStore) PutObject(ctx context.Context, key string, body io.ReadSeeker, size int64, sha256Hex, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != sha256Hex || int64(len(data)) != size {
+		return errors.New("XAmzContentSHA256Mismatch")
+	}
+	m.objects[key] = data
+	m.puts++
+	return nil
+}
+
+func (m *memoryStore) HeadObject(ctx context.Context, key string) (int64, error) {
+	data, ok := m.objects[key]
+	if !ok {
+		return 0, objectstore.ErrNotFound
+	}
+	return int64(len(data)), nil
+}
+
+func (m *memoryStore) DeleteObject(ctx context.Context, key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+// writeStoredFile 按哈希存储规则写入本地文件并创建记录
+func writeStoredFile(t *testing.T, fileService *FileService, content string) *models.FileStorage {
+	t.Helper()
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	path := filepath.Join(FileStorageDir, hash+".txt")
+	require.NoError(t, os.MkdirAll(FileStorageDir, 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	file := &models.FileStorage{Hash: hash, FileSize: int64(len(content)), MimeType: "text/plain", StoragePath: path, RefCount: 1}
+	require.NoError(t, fileService.db.Create(file).Error)
+	return file
+}
+
+func TestMigrateToObjectStoreIsResumable(t *testing.T) {
+	t.Chdir(t.TempDir())
+	fileService := &FileService{db: newTestDB(t)}
+	store := &memoryStore{objects: map[string][]byte{}}
+
+	first := writeStoredFile(t, fileService, "first file")
+	second := writeStoredFile(t, fileService, "second file")
+	corrupt := writeStoredFile(t, fileService, "original content")
+	require.NoError(t, os.WriteFile(corrupt.StoragePath, []byte("tampered"), 0644))
+
+	result, err := fileService.MigrateToObjectStore(context.Background(), store, StorageMigrationOptions{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Migrated)
+	require.NoError(t, fileService.db.First(first, first.ID).Error)
+	assert.True(t, IsRemoteFile(first))
+	assert.Equal(t, []byte("first file"), store.objects[LocalStoragePath(first)])
+
+	// 上次中断在上传之后、更新记录之前：对象已存在，不重复上传
+	store.objects[second.StoragePath] = []byte("second file")
+	result, err = fileService.MigrateToObjectStore(context.Background(), store, StorageMigrationOptions{DeleteLocal: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Migrated)
+	assert.Equal(t, 1, result.Failed, "哈希不一致的文件不迁移")
+	assert.Equal(t, int64(0), result.Bytes)
+	assert.Equal(t, 1, store.puts)
+
+	require.NoError(t, fileService.db.First(second, second.ID).Error)
+	assert.True(t, IsRemoteFile(second))
+	assert.NoFileExists(t, LocalStoragePath(second))
+	assert.FileExists(t, LocalStoragePath(first), "只删除本次迁移的本地文件")
+
+	require.NoError(t, fileService.db.First(corrupt, corrupt.ID).Error)
+	assert.False(t, IsRemoteFile(corrupt))
+	assert.NotContains(t, store.objects, corrupt.StoragePath)
+	assert.True(t, bytes.Equal([]byte("tampered"), mustReadFile(t, corrupt.StoragePath)))
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gochat/internal/models"
+	"gochat/internal/utils"
+)
+
+// 缩略图尺寸
+const (
+	ThumbnailSmall  = "small"  // 会话列表、消息气泡
+	ThumbnailMedium = "medium" // 聊天窗口内预览
+)
+
+// thumbnailSizes 各尺寸缩略图的长边像素
+var thumbnailSizes = []struct {
+	name    string
+	maxEdge int
+}{
+	{ThumbnailSmall, 240},
+	{ThumbnailMedium, 720},
+}
+
+const (
+	thumbnailQuality = 80 // JPEG缩略图质量
+	// blurhashEdge 计算BlurHash前把图片缩小到的长边像素，占位图本身很模糊，更大的尺寸没有意义
+	blurhashEdge = 32
+	// maxDecodePixels 超过该像素数的图片不解码（不生成缩略图、不压缩），避免占用过多内存
+	maxDecodePixels = 50_000_000
+)
+
+// thumbnailPath 缩略图存储路径：与原图同目录，文件名为"<哈希>_<尺寸>"
+// PNG和GIF可能带透明通道，缩略图保存为PNG，其他格式保存为JPEG
+func thumbnailPath(storagePath, size string) string {
+	ext := filepath.Ext(storagePath)
+	thumbExt := ".jpg"
+	switch strings.ToLower(ext) {
+	case ".png", ".gif":
+		thumbExt = ".png"
+	}
+	return strings.TrimSuffix(storagePath, ext) + "_" + size + thumbExt
+}
+
+// blurhashPath 图片BlurHash的存储路径：与缩略图同目录，文件名为"<哈希>_blurhash.txt"
+func blurhashPath(storagePath string) string {
+	ext := filepath.Ext(storagePath)
+	return strings.TrimSuffix(storagePath, ext) + "_blurhash.txt"
+}
+
+// GenerateThumbnails 为已存储的图片生成各尺寸缩略图和BlurHash占位图，已存在的不会重复生成
+// 图片本身不超过某个尺寸时不生成该尺寸，访问时直接使用原图
+func (s *FileService) GenerateThumbnails(file *models.FileStorage) error {
+	var img image.Image
+	decode := func() error {
+		if img != nil {
+			return nil
+		}
+		decoded, err := decodeImage(LocalStoragePath(file))
+		if err != nil {
+			return err
+		}
+		img = decoded
+		return nil
+	}
+
+	for _, size := range thumbnailSizes {
+		path := thumbnailPath(LocalStoragePath(file), size.name)
+		if fileExists(path) {
+			continue
+		}
+
+		if err := decode(); errors.Is(err, image.ErrFormat) {
+			// 标准库不支持的格式（如WebP）不生成缩略图
+			return nil
+		} else if err != nil {
+			return err
+		}
+		bounds := img.Bounds()
+		if bounds.Dx() <= size.maxEdge && bounds.Dy() <= size.maxEdge {
+			continue
+		}
+		if err := writeThumbnail(path, utils.ResizeToFit(img, size.maxEdge)); err != nil {
+			return fmt.Errorf("failed to write %s thumbnail: %w", size.name, err)
+		}
+	}
+
+	path := blurhashPath(LocalStoragePath(file))
+	if fileExists(path) {
+		return nil
+	}
+	if err := decode(); errors.Is(err, image.ErrFormat) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := writeBlurhash(path, img); err != nil {
+		return fmt.Errorf("failed to write blurhash: %w", err)
+	}
+	return nil
+}
+
+// writeBlurhash 计算BlurHash并写入文件，横图使用4x3个分量，竖图使用3x4个
+func writeBlurhash(path string, img image.Image) error {
+	small := utils.ResizeToFit(img, blurhashEdge)
+	xComponents, yComponents := 4, 3
+	if bounds := small.Bounds(); bounds.Dy() > bounds.Dx() {
+		xComponents, yComponents = 3, 4
+	}
+	hash := utils.EncodeBlurhash(small, xComponents, yComponents)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".blurhash-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(hash)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// decodeImage 读取并解码图片文件
+func decodeImage(path string) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeImageData(data)
+}
+
+// decodeImageData 解码图片并按EXIF方向转正，先检查尺寸避免超大图片占满内存
+func decodeImageData(data []byte) (image.Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxDecodePixels {
+		return nil, errors.New("image is too large to decode")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		img = utils.ApplyOrientation(img, utils.JPEGOrientation(data))
+	}
+	return img, nil
+}
+
+// writeThumbnail 先写临时文件再重命名，读取方不会看到写了一半的缩略图
+func writeThumbnail(path string, img image.Image) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if filepath.Ext(path) == ".png" {
+		err = png.Encode(tmp, img)
+	} else {
+		err = jpeg.Encode(tmp, img, &jpeg.Options{Quality: thumbnailQuality})
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeThumbnails 删除原图的所有缩略图（视频为封面图）
+func removeThumbnails(storagePath string) {
+	for _, size := range thumbnailSizes {
+		os.Remove(thumbnailPath(storagePath, size.name))
+	}
+	os.Remove(posterPath(storagePath))
+	os.Remove(blurhashPath(storagePath))
+}
+
+// ThumbnailURLs 返回图片各尺寸缩略图的访问URL，缩略图不存在（图片较小、格式不支持或生成失败）时使用原图URL
+// imageURL不是本服务存储的文件时返回nil
+func ThumbnailURLs(imageURL string) map[string]string {
+	storagePath := strings.TrimPrefix(imageURL, "/")
+	if !strings.HasPrefix(storagePath, FileStorageDir+"/") {
+		return nil
+	}
+	urls := make(map[string]string, len(thumbnailSizes))
+	for _, size := range thumbnailSizes {
+		urls[size.name] = PublicURL("/" + storagePath)
+		if path := thumbnailPath(storagePath, size.name); fileExists(path) {
+			urls[size.name] = PublicURL("/" + path)
+		}
+	}
+	return urls
+}
+
+// ImageBlurhash 返回图片的BlurHash，客户端在原图加载完成前据此渲染占位图
+// imageURL不是本服务存储的文件或尚未生成时返回空字符串
+func ImageBlurhash(imageURL string) string {
+	storagePath := strings.TrimPrefix(imageURL, "/")
+	if !strings.HasPrefix(storagePath, FileStorageDir+"/") {
+		return ""
+	}
+	data, err := os.ReadFile(blurhashPath(storagePath))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// MessageBlurhash 图片消息返回BlurHash，其他类型返回空字符串
+func MessageBlurhash(msgType int, content string) string {
+	if msgType != models.MessageTypeImage {
+		return ""
+	}
+	return ImageBlurhash(content)
+}
+
+// fileExists 文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/models"
+	"gochat/internal/utils"
+)
+
+func writeTestPNG(t *testing.T, path string, w, h int) {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+}
+
+func TestGenerateThumbnails(t *testing.T) {
+	t.Chdir(t.TempDir())
+	storagePath := filepath.Join(FileStorageDir, "abc.png")
+	writeTestPNG(t, storagePath, 1000, 500)
+
+	fileService := &FileService{}
+	require.NoError(t, fileService.GenerateThumbnails(&models.FileStorage{StoragePath: storagePath}))
+
+	urls := ThumbnailURLs("/" + storagePath)
+	assert.Equal(t, "/uploads/files/abc_small.png", urls[ThumbnailSmall])
+	assert.Equal(t, "/uploads/files/abc_medium.png", urls[ThumbnailMedium])
+
+	f, err := os.Open(filepath.Join(FileStorageDir, "abc_small.png"))
+	require.NoError(t, err)
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	require.NoError(t, err)
+	assert.Equal(t, 240, config.Width)
+	assert.Equal(t, 120, config.Height)
+
+	removeThumbnails(storagePath)
+	assert.Equal(t, "/"+storagePath, ThumbnailURLs("/" + storagePath)[ThumbnailSmall])
+}
+
+func TestSmallImageUsesOriginalAsThumbnail(t *testing.T) {
+	t.Chdir(t.TempDir())
+	storagePath := filepath.Join(FileStorageDir, "small.png")
+	writeTestPNG(t, storagePath, 300, 200)
+
+	require.NoError(t, (&FileService{}).GenerateThumbnails(&models.FileStorage{StoragePath: storagePath}))
+
+	urls := ThumbnailURLs("/" + storagePath)
+	assert.Equal(t, "/uploads/files/small_small.png", urls[ThumbnailSmall])
+	assert.Equal(t, "/"+storagePath, urls[ThumbnailMedium])
+	assert.Nil(t, ThumbnailURLs("https://example.com/a.png"))
+}
+
+func TestGenerateThumbnailsWritesBlurhash(t *testing.T) {
+	t.Chdir(t.TempDir())
+	storagePath := filepath.Join(FileStorageDir, "tall.png")
+	writeTestPNG(t, storagePath, 200, 400)
+
+	require.NoError(t, (&FileService{}).GenerateThumbnails(&models.FileStorage{StoragePath: storagePath}))
+
+	hash := ImageBlurhash("/" + storagePath)
+	// 竖图3x4个分量：1位尺寸标记 + 1位最大值 + 4位直流分量 + 11个交流分量各2位
+	require.Len(t, hash, 28)
+	assert.Equal(t, byte('T'), hash[0])
+	assert.Equal(t, hash, MessageBlurhash(models.MessageTypeImage, "/"+storagePath))
+	assert.Empty(t, MessageBlurhash(models.MessageTypeVideo, "/"+storagePath))
+	assert.Empty(t, ImageBlurhash("https://example.com/a.png"))
+
+	removeThumbnails(storagePath)
+	assert.Empty(t, ImageBlurhash("/"+storagePath))
+}
+
+func TestBlurhashSolidColor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	// 纯白图片：尺寸标记"L"（4x3），直流分量为0xFFFFFF（"TSUA"）
+	hash := utils.EncodeBlurhash(img, 4, 3)
+	require.Len(t, hash, 28)
+	assert.Equal(t, "L", hash[:1])
+	assert.Equal(t, "TSUA", hash[2:6])
+	assert.Empty(t, utils.EncodeBlurhash(image.NewRGBA(image.Rect(0, 0, 0, 0)), 4, 3))
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+)
+
+// turnIssuedPrefix turn:issued:{userID}:{2026010115} 每小时签发的TURN凭证数
+const turnIssuedPrefix = "turn:issued:"
+
+// ICEServer WebRTC的ICE服务器配置，客户端可直接作为RTCPeerConnection的iceServers使用
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// ICEServers 签发的ICE服务器列表，TURN凭证在expires_at之后失效，客户端应在此之前重新获取
+type ICEServers struct {
+	ICEServers []ICEServer `json:"ice_servers"`
+	TTL        int64       `json:"ttl,omitempty"`        // 凭证有效期（秒），未配置TURN时为0
+	ExpiresAt  int64       `json:"expires_at,omitempty"` // 凭证过期时间（毫秒时间戳）
+}
+
+// TURNRateLimitedError 用户获取TURN凭证过于频繁
+type TURNRateLimitedError struct {
+	Max        int
+	RetryAfter time.Duration
+}
+
+func (e *TURNRateLimitedError) Error() string {
+	return fmt.Sprintf("too many TURN credential requests, maximum %d per hour", e.Max)
+}
+
+// TURNService 签发音视频通话使用的STUN/TURN服务器和限时TURN凭证
+// 每个用户每小时签发的凭证数保存在Redis中，各实例共享；Redis不可用时放行，只记录警告
+type TURNService struct {
+	client *redis.Client
+	cfg    *config.TURNConfig
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewTURNService(cfg *config.TURNConfig) *TURNService {
+	return NewTURNServiceWithClient(cache.GetRedisClient(), cfg)
+}
+
+// NewTURNServiceWithClient 创建TURN凭证服务（支持依赖注入），配置已在加载时校验
+func NewTURNServiceWithClient(client *redis.Client, cfg *config.TURNConfig) *TURNService {
+	s := &TURNService{client: client, cfg: cfg, now: time.Now}
+	s.ttl, _ = time.ParseDuration(cfg.CredentialTTL)
+	return s
+}
+
+// ICEServers 返回STUN服务器和带有限时凭证的TURN服务器，超出每小时签发次数时返回*TURNRateLimitedError
+// 只配置了STUN时不签发凭证，也不计入次数
+func (s *TURNService) ICEServers(ctx context.Context, userID int64) (*ICEServers, error) {
+	result := &ICEServers{ICEServers: []ICEServer{}}
+	if len(s.cfg.STUNURLs) > 0 {
+		result.ICEServers = append(result.ICEServers, ICEServer{URLs: s.cfg.STUNURLs})
+	}
+	if len(s.cfg.URLs) == 0 {
+		return result, nil
+	}
+	if err := s.checkRate(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	expiresAt := s.now().Add(s.ttl)
+	username, credential := turnCredential(s.cfg.Secret, userID, expiresAt)
+	result.ICEServers = append(result.ICEServers, ICEServer{
+		URLs:       s.cfg.URLs,
+		Username:   username,
+		Credential: credential,
+	})
+	result.TTL = int64(s.ttl.Seconds())
+	result.ExpiresAt = expiresAt.UnixMilli()
+	return result, nil
+}
+
+// checkRate 按小时计数，超出max_per_hour时拒绝，被拒绝的请求不计数
+func (s *TURNService) checkRate(ctx context.Context, userID int64) error {
+	if s.cfg.MaxPerHour <= 0 {
+		return nil
+	}
+	now := s.now().UTC()
+	hour := now.Truncate(time.Hour)
+	key := turnIssuedPrefix + strconv.FormatInt(userID, 10) + ":" + hour.Format("2006010215")
+	count, err := s.client.Incr(ctx, key).Result()
+	if err != nil {
+		logger.WithContext(ctx).Warnf("统计用户 %d 的TURN凭证签发次数失败: %v", userID, err)
+		return nil
+	}
+	if count == 1 {
+		s.client.Expire(ctx, key, time.Hour)
+	}
+	if count > int64(s.cfg.MaxPerHour) {
+		s.client.Decr(ctx, key)
+		logger.WithContext(ctx).Infof("用户 %d 获取TURN凭证过于频繁", userID)
+		return &TURNRateLimitedError{Max: s.cfg.MaxPerHour, RetryAfter: hour.Add(time.Hour).Sub(now)}
+	}
+	return nil
+}
+
+// turnCredential 按TURN REST API约定生成凭证：username为"过期时间戳:用户ID"，credential为base64(HMAC-SHA1(secret, username))
+func turnCredential(secret string, userID int64, expiresAt time.Time) (string, string) {
+	username := strconv.FormatInt(expiresAt.Unix(), 10) + ":" + strconv.FormatInt(userID, 10)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+func newTestTURNService(t *testing.T, cfg *config.TURNConfig) (*TURNService, *time.Time) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	s := NewTURNServiceWithClient(client, cfg)
+	current := time.Date(2026, 10, 1, 9, 45, 0, 0, time.UTC)
+	s.now = func() time.Time { return current }
+	return s, &current
+}
+
+func TestTURNCredentials(t *testing.T) {
+	s, now := newTestTURNService(t, &config.TURNConfig{
+		STUNURLs:      []string{"stun:stun.example.com:3478"},
+		URLs:          []string{"turn:turn.example.com:3478?transport=udp", "turns:turn.example.com:5349"},
+		Secret:        "north",
+		CredentialTTL: "1h",
+	})
+
+	servers, err := s.ICEServers(context.Background(), 42)
+	require.NoError(t, err)
+	require.Len(t, servers.ICEServers, 2)
+	assert.Equal(t, ICEServer{URLs: []string{"stun:stun.example.com:3478"}}, servers.ICEServers[0])
+	assert.Equal(t, int64(3600), servers.TTL)
+	assert.Equal(t, now.Add(time.Hour).UnixMilli(), servers.ExpiresAt)
+
+	turn := servers.ICEServers[1]
+	assert.Len(t, turn.URLs, 2)
+	assert.Equal(t, fmt.Sprintf("%d:42", now.Add(time.Hour).Unix()), turn.Username)
+	// TURN服务器用共享密钥重新计算HMAC-SHA1校验
+	mac := hmac.New(sha1.New, []byte("north"))
+	mac.Write([]byte(turn.Username))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), turn.Credential)
+}
+
+func TestTURNCredentialsRateLimit(t *testing.T) {
+	s, now := newTestTURNService(t, &config.TURNConfig{
+		URLs:          []string{"turn:turn.example.com:3478"},
+		Secret:        "north",
+		CredentialTTL: "12h",
+		MaxPerHour:    2,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := s.ICEServers(ctx, 1)
+		require.NoError(t, err)
+	}
+	_, err := s.ICEServers(ctx, 1)
+	var limited *TURNRateLimitedError
+	require.ErrorAs(t, err, &limited)
+	assert.Equal(t, 2, limited.Max)
+	assert.Equal(t, 15*time.Minute, limited.RetryAfter)
+
+	// 其他用户不受影响，下一个小时重新计数
+	_, err = s.ICEServers(ctx, 2)
+	require.NoError(t, err)
+	*now = now.Add(15 * time.Minute)
+	_, err = s.ICEServers(ctx, 1)
+	require.NoError(t, err)
+}
+
+func TestSTUNOnlyDoesNotIssueCredentials(t *testing.T) {
+	s, _ := newTestTURNService(t, &config.TURNConfig{
+		STUNURLs:      []string{"stun:stun.example.com:3478"},
+		CredentialTTL: "12h",
+		MaxPerHour:    1,
+	})
+	for i := 0; i < 3; i++ {
+		servers, err := s.ICEServers(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, servers.ICEServers, 1)
+		assert.Empty(t, servers.ICEServers[0].Username)
+		assert.Zero(t, servers.TTL)
+	}
+}
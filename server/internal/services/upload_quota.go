@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+)
+
+// 上传配额键前缀
+const (
+	uploadQuotaPrefix     = "upload:quota:" // upload:quota:{userID}:{20260101} 当天的上传次数和字节数（HASH）
+	uploadDuplicatePrefix = "upload:dup:"   // upload:dup:{userID}:{sha256} 同一内容在统计窗口内的上传次数
+)
+
+// 超出的上传配额类型
+const (
+	UploadQuotaDailyCount = "daily_count"
+	UploadQuotaDailyBytes = "daily_bytes"
+	UploadQuotaDuplicate  = "duplicate"
+)
+
+// reserveUploadQuotaScript 检查并占用配额，任一配额超出时不计数
+// 返回 {0} 表示成功，否则返回 {超出的配额(1次数/2字节数/3重复), 已使用量, 剩余毫秒数}
+var reserveUploadQuotaScript = redis.NewScript(`
+local size = tonumber(ARGV[1])
+local maxCount = tonumber(ARGV[2])
+local maxBytes = tonumber(ARGV[3])
+local dupLimit = tonumber(ARGV[4])
+local count = tonumber(redis.call('HGET', KEYS[1], 'count') or '0')
+local bytes = tonumber(redis.call('HGET', KEYS[1], 'bytes') or '0')
+if maxCount > 0 and count + 1 > maxCount then
+	return {1, count, redis.call('PTTL', KEYS[1])}
+end
+if maxBytes > 0 and bytes + size > maxBytes then
+	return {2, bytes, redis.call('PTTL', KEYS[1])}
+end
+if dupLimit > 0 and KEYS[2] ~= '' then
+	local dup = tonumber(redis.call('GET', KEYS[2]) or '0')
+	if dup + 1 > dupLimit then
+		return {3, dup, redis.call('PTTL', KEYS[2])}
+	end
+	if redis.call('INCR', KEYS[2]) == 1 then
+		redis.call('PEXPIRE', KEYS[2], ARGV[6])
+	end
+end
+redis.call('HINCRBY', KEYS[1], 'count', 1)
+redis.call('HINCRBY', KEYS[1], 'bytes', size)
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return {0}
+`)
+
+// releaseUploadQuotaScript 归还占用的配额，计数已过期时不再处理，避免留下没有过期时间的负数键
+var releaseUploadQuotaScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('HINCRBY', KEYS[1], 'count', -1)
+	redis.call('HINCRBY', KEYS[1], 'bytes', -tonumber(ARGV[1]))
+end
+if KEYS[2] ~= '' and redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.call('DECR', KEYS[2])
+end
+return 0
+`)
+
+// UploadQuotaExceededError 用户的上传超出配额
+type UploadQuotaExceededError struct {
+	Limit      string // 超出的配额，见UploadQuota*
+	Used       int64  // 已使用的次数或字节数
+	Max        int64  // 配额上限
+	RetryAfter time.Duration
+}
+
+func (e *UploadQuotaExceededError) Error() string {
+	switch e.Limit {
+	case UploadQuotaDailyCount:
+		return fmt.Sprintf("daily upload limit reached, maximum %d files per day", e.Max)
+	case UploadQuotaDailyBytes:
+		return fmt.Sprintf("daily upload size limit reached, maximum %dMB per day", e.Max>>20)
+	default:
+		return "the same file has been uploaded too many times, please try again later"
+	}
+}
+
+// UploadQuota 每个用户的上传配额
+// 按用户统计每天的上传次数、字节数和同一内容的重复上传次数，计数保存在Redis中，各实例共享；Redis不可用时放行，只记录警告
+type UploadQuota struct {
+	client          *redis.Client
+	cfg             *config.UploadQuotaConfig
+	duplicateWindow time.Duration
+	now             func() time.Time
+}
+
+// NewUploadQuota 创建上传配额，未启用时返回nil（nil的UploadQuota放行所有上传）
+func NewUploadQuota(cfg *config.UploadQuotaConfig) *UploadQuota {
+	return NewUploadQuotaWithClient(cache.GetRedisClient(), cfg)
+}
+
+// NewUploadQuotaWithClient 创建上传配额（支持依赖注入），配置已在加载时校验
+func NewUploadQuotaWithClient(client *redis.Client, cfg *config.UploadQuotaConfig) *UploadQuota {
+	if !cfg.Enabled {
+		return nil
+	}
+	q := &UploadQuota{client: client, cfg: cfg, now: time.Now}
+	q.duplicateWindow, _ = time.ParseDuration(cfg.DuplicateWindow)
+	return q
+}
+
+// Reserve 上传前检查并占用配额，超出时返回*UploadQuotaExceededError
+// hash为文件内容的SHA256，为空时不检查重复上传；上传失败时调用Release归还配额
+func (q *UploadQuota) Reserve(ctx context.Context, userID int64, hash string, size int64) error {
+	if q == nil {
+		return nil
+	}
+	now := q.now().UTC()
+	dupKey := ""
+	if hash != "" {
+		dupKey = q.duplicateKey(userID, hash)
+	}
+	// 当天的计数保留到次日结束，跨日时旧键自然过期
+	dayTTL := q.nextDay(now).Sub(now) + 24*time.Hour
+	result, err := reserveUploadQuotaScript.Run(ctx, q.client, []string{q.dailyKey(userID, now), dupKey},
+		size, q.cfg.DailyCount, int64(q.cfg.DailyMB)<<20, q.cfg.DuplicateLimit,
+		dayTTL.Milliseconds(), q.duplicateWindow.Milliseconds()).Int64Slice()
+	if err != nil {
+		logger.WithContext(ctx).Warnf("检查用户 %d 的上传配额失败: %v", userID, err)
+		return nil
+	}
+	if result[0] == 0 {
+		return nil
+	}
+
+	exceeded := &UploadQuotaExceededError{Used: result[1]}
+	switch result[0] {
+	case 1:
+		exceeded.Limit, exceeded.Max = UploadQuotaDailyCount, int64(q.cfg.DailyCount)
+	case 2:
+		exceeded.Limit, exceeded.Max = UploadQuotaDailyBytes, int64(q.cfg.DailyMB)<<20
+	default:
+		exceeded.Limit, exceeded.Max = UploadQuotaDuplicate, int64(q.cfg.DuplicateLimit)
+	}
+	// 每日配额到UTC零点重置，重复上传到统计窗口结束
+	if exceeded.Limit == UploadQuotaDuplicate {
+		exceeded.RetryAfter = time.Duration(result[2]) * time.Millisecond
+	} else {
+		exceeded.RetryAfter = q.nextDay(now).Sub(now)
+	}
+	logger.WithContext(ctx).Infof("用户 %d 上传超出配额: limit=%s, used=%d, max=%d", userID, exceeded.Limit, exceeded.Used, exceeded.Max)
+	return exceeded
+}
+
+// Release 上传失败时归还Reserve占用的配额
+func (q *UploadQuota) Release(ctx context.Context, userID int64, hash string, size int64) {
+	if q == nil {
+		return
+	}
+	dupKey := ""
+	if hash != "" && q.cfg.DuplicateLimit > 0 {
+		dupKey = q.duplicateKey(userID, hash)
+	}
+	err := releaseUploadQuotaScript.Run(ctx, q.client, []string{q.dailyKey(userID, q.now().UTC()), dupKey}, size).Err()
+	if err != nil {
+		logger.WithContext(ctx).Warnf("归还用户 %d 的上传配额失败: %v", userID, err)
+	}
+}
+
+func (q *UploadQuota) dailyKey(userID int64, now time.Time) string {
+	return uploadQuotaPrefix + strconv.FormatInt(userID, 10) + ":" + now.Format("20060102")
+}
+
+func (q *UploadQuota) duplicateKey(userID int64, hash string) string {
+	return uploadDuplicatePrefix + strconv.FormatInt(userID, 10) + ":" + hash
+}
+
+// nextDay 下一个UTC零点
+func (q *UploadQuota) nextDay(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
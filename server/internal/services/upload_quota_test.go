@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+func newTestUploadQuota(t *testing.T, cfg *config.UploadQuotaConfig) (*UploadQuota, *miniredis.Miniredis, *time.Time) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	cfg.Enabled = true
+	q := NewUploadQuotaWithClient(client, cfg)
+	current := time.Date(2026, 10, 1, 23, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return current }
+	return q, mr, &current
+}
+
+func assertQuotaExceeded(t *testing.T, err error, limit string) *UploadQuotaExceededError {
+	t.Helper()
+	var exceeded *UploadQuotaExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.Equal(t, limit, exceeded.Limit)
+	return exceeded
+}
+
+func TestUploadQuotaDailyCount(t *testing.T) {
+	q, _, now := newTestUploadQuota(t, &config.UploadQuotaConfig{DailyCount: 2})
+	ctx := context.Background()
+
+	require.NoError(t, q.Reserve(ctx, 1, "a", 100))
+	require.NoError(t, q.Reserve(ctx, 1, "b", 100))
+	exceeded := assertQuotaExceeded(t, q.Reserve(ctx, 1, "c", 100), UploadQuotaDailyCount)
+	assert.Equal(t, int64(2), exceeded.Used)
+	assert.Equal(t, time.Hour, exceeded.RetryAfter)
+
+	// 其他用户不受影响
+	require.NoError(t, q.Reserve(ctx, 2, "c", 100))
+
+	// 上传失败归还配额
+	q.Release(ctx, 1, "b", 100)
+	require.NoError(t, q.Reserve(ctx, 1, "c", 100))
+
+	// UTC零点后重新计数
+	*now = now.Add(time.Hour)
+	require.NoError(t, q.Reserve(ctx, 1, "d", 100))
+}
+
+func TestUploadQuotaDailyBytes(t *testing.T) {
+	q, _, _ := newTestUploadQuota(t, &config.UploadQuotaConfig{DailyMB: 1})
+	ctx := context.Background()
+
+	require.NoError(t, q.Reserve(ctx, 1, "a", 800<<10))
+	exceeded := assertQuotaExceeded(t, q.Reserve(ctx, 1, "b", 300<<10), UploadQuotaDailyBytes)
+	assert.Equal(t, int64(800<<10), exceeded.Used)
+	assert.Equal(t, int64(1<<20), exceeded.Max)
+	// 超出时不计数，较小的文件仍可上传
+	require.NoError(t, q.Reserve(ctx, 1, "c", 200<<10))
+}
+
+func TestUploadQuotaDuplicate(t *testing.T) {
+	q, mr, _ := newTestUploadQuota(t, &config.UploadQuotaConfig{DuplicateLimit: 2, DuplicateWindow: "1h"})
+	ctx := context.Background()
+
+	require.NoError(t, q.Reserve(ctx, 1, "same", 100))
+	require.NoError(t, q.Reserve(ctx, 1, "same", 100))
+	exceeded := assertQuotaExceeded(t, q.Reserve(ctx, 1, "same", 100), UploadQuotaDuplicate)
+	assert.Equal(t, time.Hour, exceeded.RetryAfter)
+	require.NoError(t, q.Reserve(ctx, 1, "other", 100))
+
+	// 统计窗口结束后可以再次上传
+	mr.FastForward(time.Hour)
+	require.NoError(t, q.Reserve(ctx, 1, "same", 100))
+}
+
+func TestUploadQuotaFailsOpen(t *testing.T) {
+	q, mr, _ := newTestUploadQuota(t, &config.UploadQuotaConfig{DailyCount: 1})
+	ctx := context.Background()
+	mr.Close()
+	assert.NoError(t, q.Reserve(ctx, 1, "a", 100))
+	assert.NoError(t, q.Reserve(ctx, 1, "b", 100))
+
+	var nilQuota *UploadQuota
+	assert.NoError(t, nilQuota.Reserve(ctx, 1, "a", 100))
+	nilQuota.Release(ctx, 1, "a", 100)
+	assert.Nil(t, NewUploadQuotaWithClient(nil, &config.UploadQuotaConfig{}))
+}
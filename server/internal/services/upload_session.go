@@ -0,0 +1,426 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+)
+
+// 分片上传会话键前缀
+// upload:session:{id} 会话信息和处理状态（HASH）；upload:session:{id}:parts 已接收的分片序号和大小（HASH）；
+// upload:session:{id}:files 分片序号对应的分片文件名（HASH），合并时只读取登记的文件
+const uploadSessionPrefix = "upload:session:"
+
+// 分片上传会话状态，complete之后依次经过scanning、storing、thumbnailing（仅视频），最终为completed或failed
+const (
+	UploadSessionUploading    = "uploading"    // 接收分片中
+	UploadSessionScanning     = "scanning"     // 合并分片并校验文件内容（MIME类型、视频编码和时长）
+	UploadSessionStoring      = "storing"      // 检查配额并写入文件存储
+	UploadSessionThumbnailing = "thumbnailing" // 截取视频封面
+	UploadSessionCompleted    = "completed"    // 处理完成，result为与普通上传接口相同的响应
+	UploadSessionFailed       = "failed"       // 处理失败，error为失败原因
+)
+
+var (
+	// ErrUploadSessionNotFound 会话不存在、已过期或不属于该用户
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	// ErrUploadSessionClosed 会话已开始处理，不再接收分片
+	ErrUploadSessionClosed = errors.New("upload session is no longer accepting parts")
+	// ErrUploadSessionIncomplete 还有分片未上传
+	ErrUploadSessionIncomplete = errors.New("upload session has missing parts")
+	// ErrUploadPartOutOfRange 分片序号超出范围
+	ErrUploadPartOutOfRange = errors.New("part number out of range")
+	// ErrUploadPartSize 分片大小与会话约定的不一致
+	ErrUploadPartSize = errors.New("part size does not match the session part size")
+)
+
+// beginUploadSessionScript 所有分片都已接收时把会话从uploading切换到scanning
+// 返回 1 成功，0 会话不存在，-1 会话不在uploading状态，-2 还有分片未上传
+var beginUploadSessionScript = redis.NewScript(`
+local state = redis.call('HGET', KEYS[1], 'state')
+if not state then
+	return 0
+end
+if state ~= 'uploading' then
+	return -1
+end
+if redis.call('HLEN', KEYS[2]) < tonumber(redis.call('HGET', KEYS[1], 'total_parts')) then
+	return -2
+end
+redis.call('HSET', KEYS[1], 'state', ARGV[1])
+return 1
+`)
+
+// putUploadPartScript 会话处于uploading状态时登记分片，与beginUploadSessionScript互斥，开始处理后不再接受分片
+// 返回 {0} 会话不存在，{1} 会话不在uploading状态，{2, 被替换的分片文件名（没有时为空）} 成功
+var putUploadPartScript = redis.NewScript(`
+local state = redis.call('HGET', KEYS[1], 'state')
+if not state then
+	return {0}
+end
+if state ~= 'uploading' then
+	return {1}
+end
+local old = redis.call('HGET', KEYS[3], ARGV[1]) or ''
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[3])
+for i = 1, 3 do
+	redis.call('PEXPIRE', KEYS[i], ARGV[4])
+end
+return {2, old}
+`)
+
+// updateUploadSessionScript 更新会话字段，会话已过期时不处理，避免重新创建没有过期时间的键
+var updateUploadSessionScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV))
+return 1
+`)
+
+// UploadSession 分片上传会话，客户端按part_size切分文件依次上传，随时可查询已接收的分片继续上传
+type UploadSession struct {
+	ID            string          `json:"upload_id"`
+	UserID        int64           `json:"-"`
+	Type          string          `json:"type"` // video或file
+	FileName      string          `json:"file_name"`
+	Size          int64           `json:"size"`
+	PartSize      int64           `json:"part_size"`
+	TotalParts    int             `json:"total_parts"`
+	ReceivedParts []int           `json:"received_parts"` // 已接收的分片序号（从1开始），升序
+	ReceivedBytes int64           `json:"received_bytes"`
+	State         string          `json:"state"`
+	Error         string          `json:"error,omitempty"`
+	Result        json.RawMessage `json:"result,omitempty"`
+	ExpiresAt     time.Time       `json:"expires_at"`
+}
+
+// PartLength 第n个分片的字节数，最后一个分片可能小于part_size
+func (s *UploadSession) PartLength(n int) int64 {
+	if n == s.TotalParts {
+		return s.Size - int64(s.TotalParts-1)*s.PartSize
+	}
+	return s.PartSize
+}
+
+// UploadSessionService 分片上传会话
+// 会话状态保存在Redis中，分片保存在dir目录下（多实例部署时各实例需共享该目录）；会话在最后一次上传分片ttl后过期
+type UploadSessionService struct {
+	client   *redis.Client
+	dir      string
+	ttl      time.Duration
+	partSize int64
+}
+
+// NewUploadSessionService 创建分片上传会话服务
+func NewUploadSessionService(cfg *config.UploadSessionConfig) *UploadSessionService {
+	return NewUploadSessionServiceWithClient(cache.GetRedisClient(), cfg)
+}
+
+// NewUploadSessionServiceWithClient 创建分片上传会话服务（支持依赖注入），配置已在加载时校验
+func NewUploadSessionServiceWithClient(client *redis.Client, cfg *config.UploadSessionConfig) *UploadSessionService {
+	ttl, _ := time.ParseDuration(cfg.TTL)
+	return &UploadSessionService{
+		client:   client,
+		dir:      cfg.Dir,
+		ttl:      ttl,
+		partSize: int64(cfg.PartSizeMB) << 20,
+	}
+}
+
+func uploadSessionKey(id string) string {
+	return uploadSessionPrefix + id
+}
+
+func uploadSessionPartsKey(id string) string {
+	return uploadSessionPrefix + id + ":parts"
+}
+
+func uploadSessionFilesKey(id string) string {
+	return uploadSessionPrefix + id + ":files"
+}
+
+// Create 创建会话，文件类型、名称和大小由调用方按对应上传接口的限制校验
+func (s *UploadSessionService) Create(ctx context.Context, userID int64, fileType, fileName string, size int64) (*UploadSession, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	session := &UploadSession{
+		ID:            hex.EncodeToString(buf),
+		UserID:        userID,
+		Type:          fileType,
+		FileName:      fileName,
+		Size:          size,
+		PartSize:      s.partSize,
+		TotalParts:    int((size + s.partSize - 1) / s.partSize),
+		ReceivedParts: []int{},
+		State:         UploadSessionUploading,
+		ExpiresAt:     time.Now().Add(s.ttl),
+	}
+
+	key := uploadSessionKey(session.ID)
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"user_id":     userID,
+		"type":        fileType,
+		"file_name":   fileName,
+		"size":        size,
+		"part_size":   s.partSize,
+		"total_parts": session.TotalParts,
+		"state":       UploadSessionUploading,
+	})
+	pipe.Expire(ctx, key, s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Get 查询会话和已接收的分片，会话不存在或不属于该用户时返回ErrUploadSessionNotFound
+func (s *UploadSessionService) Get(ctx context.Context, userID int64, id string) (*UploadSession, error) {
+	key := uploadSessionKey(id)
+	pipe := s.client.Pipeline()
+	fieldsCmd := pipe.HGetAll(ctx, key)
+	partsCmd := pipe.HGetAll(ctx, uploadSessionPartsKey(id))
+	ttlCmd := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	fields := fieldsCmd.Val()
+	if len(fields) == 0 || fields["user_id"] != strconv.FormatInt(userID, 10) {
+		return nil, ErrUploadSessionNotFound
+	}
+	session := &UploadSession{
+		ID:            id,
+		UserID:        userID,
+		Type:          fields["type"],
+		FileName:      fields["file_name"],
+		ReceivedParts: []int{},
+		State:         fields["state"],
+		Error:         fields["error"],
+		ExpiresAt:     time.Now().Add(ttlCmd.Val()),
+	}
+	session.Size, _ = strconv.ParseInt(fields["size"], 10, 64)
+	session.PartSize, _ = strconv.ParseInt(fields["part_size"], 10, 64)
+	session.TotalParts, _ = strconv.Atoi(fields["total_parts"])
+	if result := fields["result"]; result != "" {
+		session.Result = json.RawMessage(result)
+	}
+	for part, size := range partsCmd.Val() {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			continue
+		}
+		length, _ := strconv.ParseInt(size, 10, 64)
+		session.ReceivedParts = append(session.ReceivedParts, n)
+		session.ReceivedBytes += length
+	}
+	sort.Ints(session.ReceivedParts)
+	return session, nil
+}
+
+// PutPart 保存第n个分片，重复上传同一分片时替换；每次上传分片都会延长会话有效期
+// 每次上传写入新的分片文件，在Redis中原子地检查会话状态并登记后才生效，开始处理后到达的分片不会影响合并的内容
+func (s *UploadSessionService) PutPart(ctx context.Context, session *UploadSession, n int, r io.Reader) error {
+	if session.State != UploadSessionUploading {
+		return ErrUploadSessionClosed
+	}
+	if n < 1 || n > session.TotalParts {
+		return ErrUploadPartOutOfRange
+	}
+
+	dir := filepath.Join(s.dir, session.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	part, err := os.CreateTemp(dir, strconv.Itoa(n)+".*.part")
+	if err != nil {
+		return err
+	}
+	registered := false
+	defer func() {
+		if !registered {
+			os.Remove(part.Name())
+		}
+	}()
+
+	length := session.PartLength(n)
+	written, err := io.Copy(part, io.LimitReader(r, length+1))
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written != length {
+		return ErrUploadPartSize
+	}
+
+	name := filepath.Base(part.Name())
+	keys := []string{uploadSessionKey(session.ID), uploadSessionPartsKey(session.ID), uploadSessionFilesKey(session.ID)}
+	result, err := putUploadPartScript.Run(ctx, s.client, keys, n, length, name, s.ttl.Milliseconds()).Slice()
+	if err != nil {
+		return err
+	}
+	switch result[0].(int64) {
+	case 0:
+		return ErrUploadSessionNotFound
+	case 1:
+		return ErrUploadSessionClosed
+	}
+	registered = true
+
+	// 被替换的分片只在uploading状态下存在，不会被合并读取
+	if old, _ := result[1].(string); old != "" && old != name {
+		os.Remove(filepath.Join(dir, old))
+	}
+	return nil
+}
+
+// Begin 所有分片都已接收时开始处理，会话进入scanning状态
+// 会话已在处理中或已结束时返回ErrUploadSessionClosed，还有分片未上传时返回ErrUploadSessionIncomplete
+func (s *UploadSessionService) Begin(ctx context.Context, id string) error {
+	n, err := beginUploadSessionScript.Run(ctx, s.client,
+		[]string{uploadSessionKey(id), uploadSessionPartsKey(id)}, UploadSessionScanning).Int()
+	if err != nil {
+		return err
+	}
+	switch n {
+	case 0:
+		return ErrUploadSessionNotFound
+	case -1:
+		return ErrUploadSessionClosed
+	case -2:
+		return ErrUploadSessionIncomplete
+	}
+	return nil
+}
+
+// Assemble 按顺序合并登记的分片，返回位于文件开头的临时文件，调用方负责关闭并删除
+func (s *UploadSessionService) Assemble(ctx context.Context, session *UploadSession) (*os.File, error) {
+	files, err := s.client.HGetAll(ctx, uploadSessionFilesKey(session.ID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.CreateTemp(filepath.Join(s.dir, session.ID), "assembled-*"+filepath.Ext(session.FileName))
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*os.File, error) {
+		out.Close()
+		os.Remove(out.Name())
+		return nil, err
+	}
+
+	for n := 1; n <= session.TotalParts; n++ {
+		name, ok := files[strconv.Itoa(n)]
+		if !ok {
+			return fail(fmt.Errorf("part %d: %w", n, ErrUploadSessionIncomplete))
+		}
+		part, err := os.Open(filepath.Join(s.dir, session.ID, name))
+		if err != nil {
+			return fail(fmt.Errorf("open part %d: %w", n, err))
+		}
+		_, err = io.Copy(out, part)
+		part.Close()
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return out, nil
+}
+
+// SetState 更新处理状态，会话已过期时不处理
+func (s *UploadSessionService) SetState(ctx context.Context, id, state string) error {
+	return s.update(ctx, id, "state", state)
+}
+
+func (s *UploadSessionService) update(ctx context.Context, id string, fields ...interface{}) error {
+	return updateUploadSessionScript.Run(ctx, s.client, []string{uploadSessionKey(id)}, fields...).Err()
+}
+
+// Complete 记录处理结果并删除分片，会话在有效期内仍可查询结果
+func (s *UploadSessionService) Complete(ctx context.Context, id string, result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := s.update(ctx, id, "state", UploadSessionCompleted, "result", data); err != nil {
+		return err
+	}
+	return s.removeParts(ctx, id)
+}
+
+// Fail 记录失败原因并删除分片，文件需要重新创建会话上传
+func (s *UploadSessionService) Fail(ctx context.Context, id string, reason string) error {
+	if err := s.update(ctx, id, "state", UploadSessionFailed, "error", reason); err != nil {
+		return err
+	}
+	return s.removeParts(ctx, id)
+}
+
+// Abort 取消会话，删除会话状态和已上传的分片
+func (s *UploadSessionService) Abort(ctx context.Context, id string) error {
+	if err := s.client.Del(ctx, uploadSessionKey(id)).Err(); err != nil {
+		return err
+	}
+	return s.removeParts(ctx, id)
+}
+
+func (s *UploadSessionService) removeParts(ctx context.Context, id string) error {
+	if err := s.client.Del(ctx, uploadSessionPartsKey(id), uploadSessionFilesKey(id)).Err(); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.dir, id))
+}
+
+// CleanupExpired 删除会话已过期的分片目录，返回删除的目录数
+func (s *UploadSessionService) CleanupExpired(ctx context.Context) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		exists, err := s.client.Exists(ctx, uploadSessionKey(entry.Name())).Result()
+		if err != nil {
+			return removed, err
+		}
+		if exists > 0 {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
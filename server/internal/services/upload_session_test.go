@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+func newTestUploadSessions(t *testing.T) (*UploadSessionService, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	s := NewUploadSessionServiceWithClient(client, &config.UploadSessionConfig{Dir: t.TempDir(), PartSizeMB: 1, TTL: "1h"})
+	return s, mr
+}
+
+func TestUploadSessionProgress(t *testing.T) {
+	s, _ := newTestUploadSessions(t)
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("abcdefgh"), (5<<20)/8)
+	content = append(content, "tail"...)
+
+	session, err := s.Create(ctx, 1, "file", "report.pdf", int64(len(content)))
+	require.NoError(t, err)
+	assert.Equal(t, 6, session.TotalParts)
+	assert.Equal(t, int64(4), session.PartLength(6))
+
+	// 乱序上传部分分片，状态中按序号返回已接收的分片和字节数
+	part := func(n int) io.Reader {
+		start := int64(n-1) << 20
+		return bytes.NewReader(content[start : start+session.PartLength(n)])
+	}
+	require.NoError(t, s.PutPart(ctx, session, 6, part(6)))
+	require.NoError(t, s.PutPart(ctx, session, 2, part(2)))
+
+	// 重复上传同一分片时替换原来的分片文件
+	require.NoError(t, s.PutPart(ctx, session, 2, part(2)))
+	entries, err := os.ReadDir(filepath.Join(s.dir, session.ID))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	status, err := s.Get(ctx, 1, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 6}, status.ReceivedParts)
+	assert.Equal(t, int64(1<<20+4), status.ReceivedBytes)
+	assert.Equal(t, UploadSessionUploading, status.State)
+
+	// 其他用户看不到该会话
+	_, err = s.Get(ctx, 2, session.ID)
+	assert.ErrorIs(t, err, ErrUploadSessionNotFound)
+
+	// 缺少分片时不能开始处理
+	assert.ErrorIs(t, s.Begin(ctx, session.ID), ErrUploadSessionIncomplete)
+	for _, n := range []int{1, 3, 4, 5} {
+		require.NoError(t, s.PutPart(ctx, session, n, part(n)))
+	}
+	require.NoError(t, s.Begin(ctx, session.ID))
+	assert.ErrorIs(t, s.Begin(ctx, session.ID), ErrUploadSessionClosed)
+
+	status, err = s.Get(ctx, 1, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, UploadSessionScanning, status.State)
+	assert.Equal(t, int64(len(content)), status.ReceivedBytes)
+	// 按开始处理前读取的会话状态上传的分片不会被登记，也不会影响合并的内容
+	assert.ErrorIs(t, s.PutPart(ctx, session, 1, bytes.NewReader(make([]byte, 1<<20))), ErrUploadSessionClosed)
+
+	// 按序号合并分片
+	file, err := s.Assemble(ctx, status)
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	assembled, err := io.ReadAll(file)
+	file.Close()
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(content, assembled))
+
+	// 完成后保留结果，删除分片
+	require.NoError(t, s.Complete(ctx, session.ID, map[string]interface{}{"file_id": 42}))
+	status, err = s.Get(ctx, 1, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, UploadSessionCompleted, status.State)
+	assert.JSONEq(t, `{"file_id": 42}`, string(status.Result))
+	assert.Empty(t, status.ReceivedParts)
+	assert.NoDirExists(t, filepath.Join(s.dir, session.ID))
+}
+
+func TestUploadSessionPartValidation(t *testing.T) {
+	s, _ := newTestUploadSessions(t)
+	ctx := context.Background()
+	session, err := s.Create(ctx, 1, "video", "clip.mp4", 3<<19)
+	require.NoError(t, err)
+	assert.Equal(t, 2, session.TotalParts)
+
+	assert.ErrorIs(t, s.PutPart(ctx, session, 0, bytes.NewReader(nil)), ErrUploadPartOutOfRange)
+	assert.ErrorIs(t, s.PutPart(ctx, session, 3, bytes.NewReader(nil)), ErrUploadPartOutOfRange)
+
+	// 分片过短或过长都不保存
+	assert.ErrorIs(t, s.PutPart(ctx, session, 1, bytes.NewReader(make([]byte, 100))), ErrUploadPartSize)
+	assert.ErrorIs(t, s.PutPart(ctx, session, 2, bytes.NewReader(make([]byte, 1<<19+1))), ErrUploadPartSize)
+	status, err := s.Get(ctx, 1, session.ID)
+	require.NoError(t, err)
+	assert.Empty(t, status.ReceivedParts)
+	entries, err := os.ReadDir(filepath.Join(s.dir, session.ID))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// 失败后记录原因并删除分片
+	require.NoError(t, s.PutPart(ctx, session, 2, bytes.NewReader(make([]byte, 1<<19))))
+	require.NoError(t, s.Fail(ctx, session.ID, "Invalid video file"))
+	status, err = s.Get(ctx, 1, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, UploadSessionFailed, status.State)
+	assert.Equal(t, "Invalid video file", status.Error)
+	assert.NoDirExists(t, filepath.Join(s.dir, session.ID))
+}
+
+func TestUploadSessionExpiredDuringProcessing(t *testing.T) {
+	s, mr := newTestUploadSessions(t)
+	ctx := context.Background()
+	session, err := s.Create(ctx, 1, "file", "a.pdf", 10)
+	require.NoError(t, err)
+	require.NoError(t, s.PutPart(ctx, session, 1, bytes.NewReader(make([]byte, 10))))
+	require.NoError(t, s.Begin(ctx, session.ID))
+
+	// 处理期间会话过期，更新状态和结果时不重新创建会话
+	mr.Del(uploadSessionKey(session.ID))
+	require.NoError(t, s.SetState(ctx, session.ID, UploadSessionStoring))
+	require.NoError(t, s.Complete(ctx, session.ID, map[string]interface{}{"file_id": 1}))
+	assert.False(t, mr.Exists(uploadSessionKey(session.ID)))
+	require.NoError(t, s.Fail(ctx, session.ID, "failed"))
+	assert.False(t, mr.Exists(uploadSessionKey(session.ID)))
+	assert.NoDirExists(t, filepath.Join(s.dir, session.ID))
+}
+
+func TestUploadSessionCleanupExpired(t *testing.T) {
+	s, mr := newTestUploadSessions(t)
+	ctx := context.Background()
+
+	active, err := s.Create(ctx, 1, "file", "a.pdf", 10)
+	require.NoError(t, err)
+	require.NoError(t, s.PutPart(ctx, active, 1, bytes.NewReader(make([]byte, 10))))
+	expired, err := s.Create(ctx, 1, "file", "b.pdf", 10)
+	require.NoError(t, err)
+	require.NoError(t, s.PutPart(ctx, expired, 1, bytes.NewReader(make([]byte, 10))))
+	mr.Del(uploadSessionKey(expired.ID))
+
+	removed, err := s.CleanupExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.DirExists(t, filepath.Join(s.dir, active.ID))
+	assert.NoDirExists(t, filepath.Join(s.dir, expired.ID))
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"time"
 
 	"gorm.io/gorm"
@@ -23,7 +24,7 @@ func NewUserCacheService() *UserCacheService {
 }
 
 // GetUser 获取用户信息（缓存优先）
-func (s *UserCacheService) GetUser(userID int64) (*models.User, error) {
+func (s *UserCacheService) GetUser(ctx context.Context, userID int64) (*models.User, error) {
 	// 1. 尝试从缓存获取
 	user, err := s.userCache.GetUser(userID)
 	if err == nil && user != nil {
@@ -32,7 +33,7 @@ func (s *UserCacheService) GetUser(userID int64) (*models.User, error) {
 
 	// 2. 缓存未命中，从数据库查询（使用3秒超时）
 	var dbUser models.User
-	err = database.QueryWithTimeout(3*time.Second, func(db *gorm.DB) error {
+	err = database.QueryWithTimeoutCtx(ctx, 3*time.Second, func(db *gorm.DB) error {
 		return db.Where("id = ?", userID).First(&dbUser).Error
 	})
 	if err != nil {
@@ -46,7 +47,7 @@ func (s *UserCacheService) GetUser(userID int64) (*models.User, error) {
 }
 
 // GetUsers 批量获取用户信息（缓存优先）
-func (s *UserCacheService) GetUsers(userIDs []int64) (map[int64]*models.User, error) {
+func (s *UserCacheService) GetUsers(ctx context.Context, userIDs []int64) (map[int64]*models.User, error) {
 	if len(userIDs) == 0 {
 		return make(map[int64]*models.User), nil
 	}
@@ -62,7 +63,7 @@ func (s *UserCacheService) GetUsers(userIDs []int64) (map[int64]*models.User, er
 	// 2. 查询缓存未命中的用户（使用5秒超时）
 	if len(missed) > 0 {
 		var dbUsers []models.User
-		err = database.QueryWithTimeout(5*time.Second, func(db *gorm.DB) error {
+		err = database.QueryWithTimeoutCtx(ctx, 5*time.Second, func(db *gorm.DB) error {
 			return db.Where("id IN ?", missed).Find(&dbUsers).Error
 		})
 		if err != nil {
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -14,23 +15,27 @@ import (
 )
 
 type UserService struct {
-	db  *gorm.DB
-	cfg *config.Config
+	db         *gorm.DB
+	cfg        *config.Config
+	loginGuard *LoginGuard
+	loginRisk  *LoginRisk
 }
 
 func NewUserService(cfg *config.Config) *UserService {
-	return &UserService{
-		db:  database.GetDB(),
-		cfg: cfg,
-	}
+	return NewUserServiceWithDB(database.GetDB(), cfg)
 }
 
 // NewUserServiceWithDB 创建用户服务（支持依赖注入）
 func NewUserServiceWithDB(db *gorm.DB, cfg *config.Config) *UserService {
-	return &UserService{
+	s := &UserService{
 		db:  db,
 		cfg: cfg,
 	}
+	if cfg != nil {
+		s.loginGuard = NewLoginGuardWithClient(cache.GetRedisClient(), db, &cfg.Login)
+		s.loginRisk = NewLoginRiskWithClient(cache.GetRedisClient(), db, &cfg.LoginRisk)
+	}
+	return s
 }
 
 type RegisterRequest struct {
@@ -46,8 +51,15 @@ type RegisterResponse struct {
 }
 
 type LoginRequest struct {
-	Phone    string `json:"phone" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Phone        string `json:"phone" binding:"required"`
+	Password     string `json:"password" binding:"required"`
+	CaptchaToken string `json:"captcha_token"` // 登录失败次数较多时需要提供
+	DeviceID     string `json:"device_id"`     // 客户端安装时生成的设备标识，用于识别新设备
+	// VerificationCode 新设备登录验证码，返回login verification code required后重新登录时提供
+	VerificationCode string `json:"verification_code"`
+	ClientIP         string `json:"-"`
+	UserAgent        string `json:"-"`
+	Region           string `json:"-"` // 反向代理提供的地区，为空时按IP网段区分
 }
 
 type LoginResponse struct {
@@ -64,25 +76,36 @@ type UserInfo struct {
 	Avatar    string `json:"avatar"`
 	Gender    int    `json:"gender"`    // 0-未设置 1-男 2-女
 	Signature string `json:"signature"` // 个性签名
+	// 邮件通知设置，只返回给本人
+	Email               string `json:"email"`
+	EmailSecurityAlerts bool   `json:"email_security_alerts"`
+	EmailDigest         bool   `json:"email_digest"`
+	// 会话设置，只返回给本人
+	UnarchiveOnMessage bool `json:"unarchive_on_message"` // 已归档的会话收到新消息时自动取消归档
 }
 
 // Register 用户注册
-func (s *UserService) Register(req *RegisterRequest) (*RegisterResponse, error) {
+func (s *UserService) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
 	// 验证输入
 	if !utils.ValidatePhone(req.Phone) {
 		return nil, errors.New("invalid phone number")
 	}
 	if !utils.ValidatePassword(req.Password) {
-		return nil, errors.New("password must be 6-20 characters")
+		return nil, errors.New("password must be 6-20 characters without control characters")
 	}
 	if !utils.ValidateNickname(req.Nickname) {
-		return nil, errors.New("nickname must be 2-20 characters")
+		return nil, errors.New("nickname must be 2-20 characters without control characters or surrounding spaces, and not a reserved name")
+	}
+	// 敏感词过滤
+	filtered, err := GetContentFilter().CheckNickname(req.Nickname)
+	if err != nil {
+		return nil, err
 	}
 
-	// 检查手机号是否已存在（使用3秒超时）
+	// 检查手机号是否已存在（使用3秒超时，走主库避免副本延迟导致重复注册）
 	var existingUser models.User
-	checkErr := database.QueryWithTimeout(3*time.Second, func(db *gorm.DB) error {
-		return db.Where("phone = ?", req.Phone).First(&existingUser).Error
+	checkErr := database.QueryWithTimeoutCtx(ctx, 3*time.Second, func(db *gorm.DB) error {
+		return database.Primary(db).Where("phone = ?", req.Phone).First(&existingUser).Error
 	})
 
 	if checkErr == nil {
@@ -101,17 +124,29 @@ func (s *UserService) Register(req *RegisterRequest) (*RegisterResponse, error)
 	user := models.User{
 		Phone:        req.Phone,
 		PasswordHash: hashedPassword,
-		Nickname:     req.Nickname,
+		Nickname:     filtered.Text,
 		Avatar:       "default.png",
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
-	if err := database.QueryWithTimeout(5*time.Second, func(db *gorm.DB) error {
-		return db.Create(&user).Error
+	if err := database.QueryWithTimeoutCtx(ctx, 5*time.Second, func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			return enqueueDomainEvent(tx, DomainUserRegistered, user.ID, UserRegisteredData{
+				UserID:    user.ID,
+				Nickname:  user.Nickname,
+				CreatedAt: user.CreatedAt.UnixMilli(),
+			})
+		})
 	}); err != nil {
 		return nil, err
 	}
+	if filtered.Flagged() {
+		RecordFlagged(ctx, user.ID, "nickname", AuditTargetUser, user.ID, filtered)
+	}
 
 	// 生成JWT token
 	token, expireAt, err := utils.GenerateToken(user.ID, &s.cfg.JWT)
@@ -138,20 +173,26 @@ func (s *UserService) Register(req *RegisterRequest) (*RegisterResponse, error)
 }
 
 // Login 用户登录
-func (s *UserService) Login(req *LoginRequest) (*LoginResponse, error) {
+func (s *UserService) Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
 	// 验证输入
 	if !utils.ValidatePhone(req.Phone) {
 		return nil, errors.New("invalid phone number")
 	}
 
-	// 查找用户（使用5秒超时）
+	// 账号登录保护：锁定、等待和验证码
+	if err := s.loginGuard.Check(ctx, req.Phone, req.CaptchaToken, req.ClientIP); err != nil {
+		return nil, err
+	}
+
+	// 查找用户（使用5秒超时，走主库保证注册后可立即登录）
 	var user models.User
-	err := database.QueryWithTimeout(5*time.Second, func(db *gorm.DB) error {
-		return db.Where("phone = ?", req.Phone).First(&user).Error
+	err := database.QueryWithTimeoutCtx(ctx, 5*time.Second, func(db *gorm.DB) error {
+		return database.Primary(db).Where("phone = ?", req.Phone).First(&user).Error
 	})
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.loginGuard.RecordFailure(ctx, req.Phone, 0, req.ClientIP)
 			return nil, errors.New("user not found")
 		}
 		return nil, err
@@ -159,9 +200,25 @@ func (s *UserService) Login(req *LoginRequest) (*LoginResponse, error) {
 
 	// 验证密码
 	if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+		s.loginGuard.RecordFailure(ctx, req.Phone, user.ID, req.ClientIP)
 		return nil, errors.New("incorrect password")
 	}
 
+	// 被停用或封禁的账号不能登录
+	if err := checkAccountStatus(&user, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// 新设备、新地区登录需要验证码，验证码错误计入登录失败
+	attempt := NewLoginAttempt(user.ID, user.Phone, req.DeviceID, req.UserAgent, req.ClientIP, req.Region)
+	if err := s.loginRisk.Evaluate(ctx, attempt, req.VerificationCode); err != nil {
+		if errors.Is(err, ErrLoginCodeInvalid) {
+			s.loginGuard.RecordFailure(ctx, req.Phone, user.ID, req.ClientIP)
+		}
+		return nil, err
+	}
+	s.loginGuard.RecordSuccess(ctx, req.Phone, user.ID, req.ClientIP)
+
 	// 生成JWT token
 	token, expireAt, err := utils.GenerateToken(user.ID, &s.cfg.JWT)
 	if err != nil {
@@ -178,14 +235,20 @@ func (s *UserService) Login(req *LoginRequest) (*LoginResponse, error) {
 	if err := cache.SetOnlineStatus(user.ID, true); err != nil {
 		// 不影响登录成功，仅记录警告
 	}
+	s.loginRisk.RecordLogin(ctx, attempt)
 
 	userInfo := &UserInfo{
 		ID:        user.ID,
 		Phone:     user.Phone,
 		Nickname:  user.Nickname,
-		Avatar:    user.Avatar,
+		Avatar:    PublicURL(user.Avatar),
 		Gender:    user.Gender,
 		Signature: user.Signature,
+
+		Email:               user.Email,
+		EmailSecurityAlerts: !user.EmailAlertsOptOut,
+		EmailDigest:         !user.EmailDigestOptOut,
+		UnarchiveOnMessage:  !user.KeepArchived,
 	}
 
 	return &LoginResponse{
@@ -197,7 +260,7 @@ func (s *UserService) Login(req *LoginRequest) (*LoginResponse, error) {
 }
 
 // Logout 用户登出
-func (s *UserService) Logout(userID int64) error {
+func (s *UserService) Logout(ctx context.Context, userID int64) error {
 	// 删除Redis中的token
 	if err := cache.DeleteToken(userID); err != nil {
 		return err
@@ -212,9 +275,9 @@ func (s *UserService) Logout(userID int64) error {
 }
 
 // GetProfile 获取个人信息
-func (s *UserService) GetProfile(userID int64) (*UserInfo, error) {
+func (s *UserService) GetProfile(ctx context.Context, userID int64) (*UserInfo, error) {
 	var user models.User
-	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("user not found")
 		}
@@ -225,37 +288,71 @@ func (s *UserService) GetProfile(userID int64) (*UserInfo, error) {
 		ID:        user.ID,
 		Phone:     user.Phone,
 		Nickname:  user.Nickname,
-		Avatar:    user.Avatar,
+		Avatar:    PublicURL(user.Avatar),
 		Gender:    user.Gender,
 		Signature: user.Signature,
+
+		Email:               user.Email,
+		EmailSecurityAlerts: !user.EmailAlertsOptOut,
+		EmailDigest:         !user.EmailDigestOptOut,
+		UnarchiveOnMessage:  !user.KeepArchived,
 	}, nil
 }
 
 type UpdateProfileRequest struct {
-	Nickname  string `json:"nickname"`
-	Avatar    string `json:"avatar"`
-	Gender    *int   `json:"gender"`    // 使用指针，允许设置为0
-	Signature string `json:"signature"`
+	Nickname            string  `json:"nickname"`
+	Avatar              string  `json:"avatar"`
+	Gender              *int    `json:"gender"` // 使用指针，允许设置为0
+	Signature           string  `json:"signature"`
+	Email               *string `json:"email"`                 // 通知邮箱，空字符串表示删除
+	EmailSecurityAlerts *bool   `json:"email_security_alerts"` // 是否接收安全提醒邮件
+	EmailDigest         *bool   `json:"email_digest"`          // 是否接收离线消息摘要邮件
+	UnarchiveOnMessage  *bool   `json:"unarchive_on_message"`  // 已归档的会话收到新消息时是否自动取消归档
 }
 
 // UpdateProfile 更新个人信息
-func (s *UserService) UpdateProfile(userID int64, req *UpdateProfileRequest) error {
+func (s *UserService) UpdateProfile(ctx context.Context, userID int64, req *UpdateProfileRequest) error {
 	// 验证输入
 	if req.Nickname != "" && !utils.ValidateNickname(req.Nickname) {
-		return errors.New("nickname must be 2-20 characters")
+		return errors.New("nickname must be 2-20 characters without control characters or surrounding spaces, and not a reserved name")
+	}
+	if !utils.ValidateSignature(req.Signature) {
+		return errors.New("signature must be a single line of at most 200 characters")
 	}
 
 	// 验证性别值
 	if req.Gender != nil && (*req.Gender < 0 || *req.Gender > 2) {
 		return errors.New("gender must be 0 (unset), 1 (male), or 2 (female)")
 	}
+	if req.Email != nil && !utils.ValidateEmail(*req.Email) {
+		return errors.New("invalid email address")
+	}
 
 	updates := make(map[string]interface{})
 	if req.Nickname != "" {
-		updates["nickname"] = req.Nickname
+		// 敏感词过滤
+		filtered, err := GetContentFilter().CheckNickname(req.Nickname)
+		if err != nil {
+			return err
+		}
+		if filtered.Flagged() {
+			RecordFlagged(ctx, userID, "nickname", AuditTargetUser, userID, filtered)
+		}
+		updates["nickname"] = filtered.Text
 	}
 	if req.Avatar != "" {
-		updates["avatar"] = req.Avatar
+		// 本服务存储的文件只能是本人上传的头像，否则任意聊天附件都可以通过头像接口公开
+		avatar := CanonicalFileURL(req.Avatar)
+		if _, stored := storedFileHash(avatar); stored {
+			owned, err := ownsAvatar(s.db.WithContext(ctx), userID, avatar)
+			if err != nil {
+				return err
+			}
+			if !owned {
+				return ErrAvatarNotOwned
+			}
+		}
+		updates["avatar"] = avatar
 	}
 	if req.Gender != nil {
 		updates["gender"] = *req.Gender
@@ -263,10 +360,22 @@ func (s *UserService) UpdateProfile(userID int64, req *UpdateProfileRequest) err
 	if req.Signature != "" {
 		updates["signature"] = req.Signature
 	}
+	if req.Email != nil {
+		updates["email"] = *req.Email
+	}
+	if req.EmailSecurityAlerts != nil {
+		updates["email_alerts_opt_out"] = !*req.EmailSecurityAlerts
+	}
+	if req.EmailDigest != nil {
+		updates["email_digest_opt_out"] = !*req.EmailDigest
+	}
+	if req.UnarchiveOnMessage != nil {
+		updates["keep_archived"] = !*req.UnarchiveOnMessage
+	}
 
 	if len(updates) > 0 {
 		updates["updated_at"] = time.Now()
-		err := s.db.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error
+		err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error
 		if err != nil {
 			return err
 		}
@@ -282,9 +391,9 @@ func (s *UserService) UpdateProfile(userID int64, req *UpdateProfileRequest) err
 }
 
 // GetUserByID 根据ID获取用户信息
-func (s *UserService) GetUserByID(userID int64) (*models.User, error) {
+func (s *UserService) GetUserByID(ctx context.Context, userID int64) (*models.User, error) {
 	var user models.User
-	if err := s.db.First(&user, userID).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+// VideoPoster 视频封面图在缩略图中的名称
+const VideoPoster = "poster"
+
+// posterMaxEdge 封面图长边像素，与medium缩略图一致
+const posterMaxEdge = 720
+
+// VideoInfo 视频探测结果
+type VideoInfo struct {
+	Format     string        // 容器格式，如"mov,mp4,m4a,3gp,3g2,mj2"
+	Duration   time.Duration // 时长
+	Width      int
+	Height     int
+	VideoCodec string // 视频编码，如h264
+	AudioCodec string // 音频编码，没有音轨时为空
+}
+
+// VideoProcessor 视频探测和封面截取，默认由ffprobe/ffmpeg实现，测试时可替换
+type VideoProcessor interface {
+	// Probe 探测视频的容器、编码、分辨率和时长
+	Probe(ctx context.Context, path string) (*VideoInfo, error)
+	// ExtractPoster 截取指定时间点的一帧保存为JPEG，长边不超过maxEdge
+	ExtractPoster(ctx context.Context, path, output string, at time.Duration, maxEdge int) error
+}
+
+// FFmpegProcessor 调用ffprobe和ffmpeg命令处理视频
+type FFmpegProcessor struct {
+	FFprobePath string
+	FFmpegPath  string
+	Timeout     time.Duration // 单条命令的超时时间
+}
+
+// NewFFmpegProcessor 按配置创建视频处理器，找不到ffprobe或ffmpeg时返回错误
+func NewFFmpegProcessor(cfg config.VideoUploadConfig) (*FFmpegProcessor, error) {
+	ffprobe, err := exec.LookPath(cfg.FFprobePath)
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe not found: %w", err)
+	}
+	ffmpeg, err := exec.LookPath(cfg.FFmpegPath)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	timeout, err := time.ParseDuration(cfg.ProbeTimeout)
+	if err != nil || timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &FFmpegProcessor{FFprobePath: ffprobe, FFmpegPath: ffmpeg, Timeout: timeout}, nil
+}
+
+// Probe 使用ffprobe读取视频信息
+func (p *FFmpegProcessor) Probe(ctx context.Context, path string) (*VideoInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, p.FFprobePath,
+		"-v", "error", "-print_format", "json", "-show_format", "-show_streams", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseProbeOutput(output)
+}
+
+// ExtractPoster 使用ffmpeg截取一帧作为封面
+func (p *FFmpegProcessor) ExtractPoster(ctx context.Context, path, output string, at time.Duration, maxEdge int) error {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	scale := fmt.Sprintf("scale='if(gt(iw,ih),min(%d,iw),-2)':'if(gt(iw,ih),-2,min(%d,ih))'", maxEdge, maxEdge)
+	cmd := exec.CommandContext(ctx, p.FFmpegPath, "-v", "error", "-y",
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64), "-i", path,
+		"-frames:v", "1", "-vf", scale, "-q:v", "4", output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// parseProbeOutput 解析ffprobe的JSON输出，取第一条视频流和第一条音频流
+func parseProbeOutput(output []byte) (*VideoInfo, error) {
+	var probe struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+
+	info := &VideoInfo{Format: probe.Format.FormatName}
+	if seconds, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "video" && info.VideoCodec == "":
+			info.VideoCodec = stream.CodecName
+			info.Width, info.Height = stream.Width, stream.Height
+		case stream.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = stream.CodecName
+		}
+	}
+	return info, nil
+}
+
+// ValidateVideo 校验容器格式、编码和时长是否符合配置
+func ValidateVideo(info *VideoInfo, cfg config.VideoUploadConfig) error {
+	formats := strings.Split(info.Format, ",")
+	if !slices.Contains(formats, "mp4") && !slices.Contains(formats, "mov") && !slices.Contains(formats, "webm") {
+		return fmt.Errorf("unsupported video container: %s", info.Format)
+	}
+	if info.VideoCodec == "" {
+		return errors.New("file has no video stream")
+	}
+	if !slices.Contains(cfg.AllowedVideoCodecs, info.VideoCodec) {
+		return fmt.Errorf("unsupported video codec: %s", info.VideoCodec)
+	}
+	if info.AudioCodec != "" && !slices.Contains(cfg.AllowedAudioCodecs, info.AudioCodec) {
+		return fmt.Errorf("unsupported audio codec: %s", info.AudioCodec)
+	}
+	if info.Duration <= 0 {
+		return errors.New("unable to determine video duration")
+	}
+	if maxDuration, err := time.ParseDuration(cfg.MaxDuration); err == nil && maxDuration > 0 && info.Duration > maxDuration {
+		return fmt.Errorf("video is too long, maximum %s", maxDuration)
+	}
+	return nil
+}
+
+// SpoolTempFile 将上传内容写入临时文件供ffprobe读取，调用方负责关闭并删除
+func SpoolTempFile(src io.Reader, ext string) (*os.File, error) {
+	tmp, err := os.CreateTemp("", "gochat-upload-*"+ext)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// posterPath 视频封面图存储路径：与视频同目录，文件名为"<哈希>_poster.jpg"
+func posterPath(storagePath string) string {
+	return thumbnailPath(storagePath, VideoPoster)
+}
+
+// GenerateVideoPoster 截取视频封面图（第1秒，短视频取中间帧），已存在时不重复生成
+func (s *FileService) GenerateVideoPoster(ctx context.Context, processor VideoProcessor, file *models.FileStorage, duration time.Duration) error {
+	path := posterPath(LocalStoragePath(file))
+	if fileExists(path) {
+		return nil
+	}
+
+	at := min(time.Second, duration/2)
+	// 先写临时文件再重命名，读取方不会看到写了一半的封面
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".poster-%d.jpg", time.Now().UnixNano()))
+	defer os.Remove(tmp)
+	if err := processor.ExtractPoster(ctx, LocalStoragePath(file), tmp, at, posterMaxEdge); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// MessageThumbnails 图片消息返回各尺寸缩略图URL，视频消息返回封面图URL（封面不存在时为nil），其他类型返回nil
+func MessageThumbnails(msgType int, content string) map[string]string {
+	switch msgType {
+	case models.MessageTypeImage:
+		return ThumbnailURLs(content)
+	case models.MessageTypeVideo:
+		storagePath := strings.TrimPrefix(content, "/")
+		if !strings.HasPrefix(storagePath, FileStorageDir+"/") {
+			return nil
+		}
+		if path := posterPath(storagePath); fileExists(path) {
+			return map[string]string{VideoPoster: PublicURL("/" + path)}
+		}
+	}
+	return nil
+}
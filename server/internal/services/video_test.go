@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+	"gochat/internal/models"
+)
+
+const sampleProbeOutput = `{
+	"streams": [
+		{"index": 0, "codec_name": "h264", "codec_type": "video", "width": 1920, "height": 1080},
+		{"index": 1, "codec_name": "aac", "codec_type": "audio"}
+	],
+	"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "12.480000"}
+}`
+
+var testVideoConfig = config.VideoUploadConfig{
+	MaxDuration:        "1m",
+	AllowedVideoCodecs: []string{"h264", "vp9"},
+	AllowedAudioCodecs: []string{"aac", "opus"},
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	info, err := parseProbeOutput([]byte(sampleProbeOutput))
+	require.NoError(t, err)
+	assert.Equal(t, "h264", info.VideoCodec)
+	assert.Equal(t, "aac", info.AudioCodec)
+	assert.Equal(t, 1920, info.Width)
+	assert.Equal(t, 1080, info.Height)
+	assert.Equal(t, 12480*time.Millisecond, info.Duration)
+	assert.NoError(t, ValidateVideo(info, testVideoConfig))
+}
+
+func TestValidateVideoRejects(t *testing.T) {
+	valid := VideoInfo{Format: "matroska,webm", Duration: 10 * time.Second, VideoCodec: "vp9", AudioCodec: "opus"}
+	require.NoError(t, ValidateVideo(&valid, testVideoConfig))
+
+	for name, modify := range map[string]func(*VideoInfo){
+		"容器":   func(v *VideoInfo) { v.Format = "avi" },
+		"无视频流": func(v *VideoInfo) { v.VideoCodec = "" },
+		"视频编码": func(v *VideoInfo) { v.VideoCodec = "mpeg4" },
+		"音频编码": func(v *VideoInfo) { v.AudioCodec = "pcm_s16le" },
+		"时长":   func(v *VideoInfo) { v.Duration = 2 * time.Minute },
+		"未知时长": func(v *VideoInfo) { v.Duration = 0 },
+	} {
+		info := valid
+		modify(&info)
+		assert.Error(t, ValidateVideo(&info, testVideoConfig), name)
+	}
+
+	silent := valid
+	silent.AudioCodec = ""
+	assert.NoError(t, ValidateVideo(&silent, testVideoConfig), "没有音轨的视频")
+}
+
+// fakeVideoProcessor 记录截图参数并写入占位封面
+type fakeVideoProcessor struct {
+	at time.Duration
+}
+
+func (p *fakeVideoProcessor) Probe(ctx context.Context, path string) (*VideoInfo, error) {
+	return parseProbeOutput([]byte(sampleProbeOutput))
+}
+
+func (p *fakeVideoProcessor) ExtractPoster(ctx context.Context, path, output string, at time.Duration, maxEdge int) error {
+	p.at = at
+	return os.WriteFile(output, []byte("jpeg"), 0644)
+}
+
+func TestGenerateVideoPoster(t *testing.T) {
+	t.Chdir(t.TempDir())
+	storagePath := filepath.Join(FileStorageDir, strings.Repeat("d", 64)+".mp4")
+	require.NoError(t, os.MkdirAll(FileStorageDir, 0755))
+	require.NoError(t, os.WriteFile(storagePath, []byte("video"), 0644))
+	file := &models.FileStorage{StoragePath: storagePath}
+
+	assert.Nil(t, MessageThumbnails(models.MessageTypeVideo, "/"+storagePath), "封面生成前")
+
+	processor := &fakeVideoProcessor{}
+	require.NoError(t, (&FileService{}).GenerateVideoPoster(context.Background(), processor, file, 1200*time.Millisecond))
+	assert.Equal(t, 600*time.Millisecond, processor.at, "短视频取中间帧")
+
+	thumbnails := MessageThumbnails(models.MessageTypeVideo, "/"+storagePath)
+	assert.Equal(t, "/"+strings.TrimSuffix(storagePath, ".mp4")+"_poster.jpg", thumbnails[VideoPoster])
+
+	removeThumbnails(storagePath)
+	assert.Nil(t, MessageThumbnails(models.MessageTypeVideo, "/"+storagePath))
+}
@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// analyticsRollupLockTTL 统计汇总任务的分布式锁过期时间，执行期间自动续期
+const analyticsRollupLockTTL = time.Minute
+
+// AnalyticsRollupTask 统计汇总任务，定期把消息数、活跃用户和群活跃度汇总到统计表
+type AnalyticsRollupTask struct {
+	analyticsService *services.AnalyticsService
+	cfg              *config.AnalyticsConfig
+	ticker           *time.Ticker
+	ctx              context.Context
+	cancel           context.CancelFunc
+	stopped          chan struct{}
+	stopOnce         sync.Once
+}
+
+// NewAnalyticsRollupTask 创建统计汇总任务
+func NewAnalyticsRollupTask(cfg *config.Config) *AnalyticsRollupTask {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AnalyticsRollupTask{
+		analyticsService: services.NewAnalyticsService(cfg),
+		cfg:              &cfg.Analytics,
+		ctx:              ctx,
+		cancel:           cancel,
+		stopped:          make(chan struct{}),
+	}
+}
+
+// Start 启动统计汇总任务，启动后立即执行一次（补算停机期间的数据）
+func (t *AnalyticsRollupTask) Start() {
+	log := logger.GetLogger()
+
+	interval, err := time.ParseDuration(t.cfg.Interval)
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	t.ticker = time.NewTicker(interval)
+	log.Infof("统计汇总任务已启动，间隔: %v", interval)
+
+	go func() {
+		defer close(t.stopped)
+		t.rollup()
+		for {
+			select {
+			case <-t.ticker.C:
+				t.rollup()
+			case <-t.ctx.Done():
+				log.Info("统计汇总任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止任务，中断正在进行的汇总并等待退出（下次执行时重新汇总）
+func (t *AnalyticsRollupTask) Stop() {
+	t.stopOnce.Do(func() {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		t.cancel()
+	})
+	<-t.stopped
+}
+
+// rollup 执行汇总，多实例部署时通过分布式锁保证同一时间只有一个实例执行
+func (t *AnalyticsRollupTask) rollup() {
+	log := logger.GetLogger()
+
+	startTime := time.Now()
+	err := cache.WithLock(t.ctx, "task:analytics_rollup", analyticsRollupLockTTL, t.analyticsService.Rollup)
+	observeTask("analytics_rollup", startTime, err)
+
+	switch {
+	case err == cache.ErrLockNotAcquired:
+		log.Debug("其他实例正在执行统计汇总任务，本实例跳过")
+	case err == context.Canceled:
+		log.Info("统计汇总任务被中断")
+	case err != nil:
+		log.Errorf("统计汇总任务失败: %v", err)
+	default:
+		log.Debugf("统计汇总完成，耗时: %v", time.Since(startTime))
+	}
+}
+
+// RunNow 立即执行一次汇总（用于测试和管理后台手动触发）
+func (t *AnalyticsRollupTask) RunNow() {
+	t.rollup()
+}
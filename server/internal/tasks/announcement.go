@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// AnnouncementTask 定时公告任务，发布到达发布时间的公告
+// 公告通过行级领取保证只被一个实例发布，因此不需要分布式锁
+type AnnouncementTask struct {
+	announcementService *services.AnnouncementService
+	cfg                 *config.AnnouncementsConfig
+	ticker              *time.Ticker
+	ctx                 context.Context
+	cancel              context.CancelFunc
+	stopped             chan struct{}
+	stopOnce            sync.Once
+}
+
+// NewAnnouncementTask 创建定时公告任务
+func NewAnnouncementTask(cfg *config.AnnouncementsConfig) *AnnouncementTask {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AnnouncementTask{
+		announcementService: services.NewAnnouncementService(cfg),
+		cfg:                 cfg,
+		ctx:                 ctx,
+		cancel:              cancel,
+		stopped:             make(chan struct{}),
+	}
+}
+
+// Start 启动定时公告任务，启动时立即检查一次（发布停机期间到期的公告）
+func (t *AnnouncementTask) Start() {
+	log := logger.GetLogger()
+
+	interval, err := time.ParseDuration(t.cfg.PollInterval)
+	if err != nil || interval <= 0 {
+		interval = 15 * time.Second
+	}
+	t.ticker = time.NewTicker(interval)
+	log.Infof("定时公告任务已启动，间隔: %v", interval)
+
+	go func() {
+		defer close(t.stopped)
+		t.publish()
+		for {
+			select {
+			case <-t.ticker.C:
+				t.publish()
+			case <-t.ctx.Done():
+				log.Info("定时公告任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止任务并等待退出
+func (t *AnnouncementTask) Stop() {
+	t.stopOnce.Do(func() {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		t.cancel()
+	})
+	<-t.stopped
+}
+
+// publish 发布到期的定时公告
+func (t *AnnouncementTask) publish() {
+	log := logger.GetLogger()
+
+	start := time.Now()
+	published, err := t.announcementService.PublishDue(t.ctx)
+	if err == context.Canceled {
+		err = nil
+	}
+	if err != nil {
+		log.Errorf("发布定时公告失败: %v", err)
+	}
+	observeTask("announcements", start, err)
+	if published > 0 {
+		log.Infof("发布定时公告 %d 条", published)
+	}
+}
+
+// RunNow 立即执行一次（用于测试和管理后台手动触发）
+func (t *AnnouncementTask) RunNow() {
+	t.publish()
+}
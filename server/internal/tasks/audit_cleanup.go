@@ -0,0 +1,93 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// AuditCleanupTask 审计日志清理任务，定期删除超过保留期的审计日志
+// 删除是幂等的，多实例同时执行也不会出错，因此不加分布式锁
+type AuditCleanupTask struct {
+	auditService *services.AuditService
+	retention    time.Duration
+	interval     time.Duration
+	ticker       *time.Ticker
+	ctx          context.Context
+	cancel       context.CancelFunc
+	stopped      chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewAuditCleanupTask 创建审计日志清理任务
+func NewAuditCleanupTask(cfg *config.AuditConfig) *AuditCleanupTask {
+	retention, _ := time.ParseDuration(cfg.Retention)
+	interval, err := time.ParseDuration(cfg.CleanupInterval)
+	if err != nil || interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AuditCleanupTask{
+		auditService: services.NewAuditService(),
+		retention:    retention,
+		interval:     interval,
+		ctx:          ctx,
+		cancel:       cancel,
+		stopped:      make(chan struct{}),
+	}
+}
+
+// Start 启动清理任务，启动后立即在后台执行一次
+func (t *AuditCleanupTask) Start() {
+	log := logger.GetLogger()
+	t.ticker = time.NewTicker(t.interval)
+	log.Infof("审计日志清理任务已启动，保留时长: %v，间隔: %v", t.retention, t.interval)
+
+	go func() {
+		defer close(t.stopped)
+		t.cleanup()
+		for {
+			select {
+			case <-t.ticker.C:
+				t.cleanup()
+			case <-t.ctx.Done():
+				log.Info("审计日志清理任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止清理任务并等待退出
+func (t *AuditCleanupTask) Stop() {
+	t.stopOnce.Do(func() {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		t.cancel()
+	})
+	<-t.stopped
+}
+
+// cleanup 删除超过保留期的审计日志
+func (t *AuditCleanupTask) cleanup() {
+	start := time.Now()
+	deleted, err := t.auditService.Purge(t.ctx, time.Now().Add(-t.retention))
+	observeTask("audit_cleanup", start, err)
+	if err != nil {
+		logger.GetLogger().Errorf("清理审计日志失败: %v", err)
+		return
+	}
+	if deleted > 0 {
+		logger.GetLogger().Infof("清理了 %d 条过期审计日志", deleted)
+	}
+}
+
+// RunNow 立即执行一次清理，供管理后台手动触发
+func (t *AuditCleanupTask) RunNow() {
+	t.cleanup()
+}
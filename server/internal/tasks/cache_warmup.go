@@ -0,0 +1,67 @@
+package tasks
+
+import (
+	"context"
+	"time"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// cacheWarmupLockTTL 缓存预热的分布式锁过期时间，执行期间自动续期
+const cacheWarmupLockTTL = 30 * time.Second
+
+// CacheWarmupTask 启动缓存预热任务
+type CacheWarmupTask struct {
+	warmupService *services.CacheWarmupService
+	cfg           *config.CacheConfig
+}
+
+// NewCacheWarmupTask 创建缓存预热任务
+func NewCacheWarmupTask(cfg *config.CacheConfig) *CacheWarmupTask {
+	return &CacheWarmupTask{
+		warmupService: services.NewCacheWarmupService(),
+		cfg:           cfg,
+	}
+}
+
+// Run 执行一次预热，超时后放弃剩余部分
+// 多个实例同时启动时只有一个实例执行，其余实例直接使用预热好的Redis缓存
+func (t *CacheWarmupTask) Run() {
+	log := logger.GetLogger()
+
+	window, err := time.ParseDuration(t.cfg.WarmupWindow)
+	if err != nil || window <= 0 {
+		window = 24 * time.Hour
+	}
+	timeout, err := time.ParseDuration(t.cfg.WarmupTimeout)
+	if err != nil || timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	err = cache.WithLock(ctx, "task:cache_warmup", cacheWarmupLockTTL, func(ctx context.Context) error {
+		result, err := t.warmupService.Warmup(ctx, services.WarmupOptions{
+			Since:     time.Now().Add(-window),
+			MaxUsers:  t.cfg.WarmupMaxUsers,
+			MaxGroups: t.cfg.WarmupMaxGroups,
+		})
+		if result != nil {
+			log.Infof("缓存预热完成: 用户=%d, 群组=%d, 耗时=%v", result.Users, result.Groups, time.Since(startTime))
+		}
+		return err
+	})
+	observeTask("cache_warmup", startTime, err)
+
+	switch {
+	case err == cache.ErrLockNotAcquired:
+		log.Info("其他实例正在预热缓存，本实例跳过")
+	case err != nil:
+		log.Warnf("缓存预热未完成: %v", err)
+	}
+}
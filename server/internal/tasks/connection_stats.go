@@ -0,0 +1,80 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// connectionStatsInterval 连接数采样间隔，峰值连接数按分钟统计
+const connectionStatsInterval = time.Minute
+
+// ConnectionStatsTask 连接数采样任务，每分钟把本实例的连接数写入Redis，用于统计所有实例每天的峰值连接数
+type ConnectionStatsTask struct {
+	nodeID       int64
+	count        func() int
+	statsService *services.AdminStatsService
+	ticker       *time.Ticker
+	stopChan     chan struct{}
+	stopped      chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewConnectionStatsTask 创建连接数采样任务，count返回本实例当前的连接数
+// 各实例按server.node_id区分，多实例部署时node_id必须不同
+func NewConnectionStatsTask(cfg *config.Config, count func() int) *ConnectionStatsTask {
+	return &ConnectionStatsTask{
+		nodeID:       cfg.Server.NodeID,
+		count:        count,
+		statsService: services.NewAdminStatsService(&cfg.Admin.Stats),
+		stopChan:     make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+}
+
+// Start 启动采样任务
+func (t *ConnectionStatsTask) Start() {
+	t.ticker = time.NewTicker(connectionStatsInterval)
+	logger.GetLogger().Infof("连接数采样任务已启动，间隔: %v", connectionStatsInterval)
+
+	go func() {
+		defer close(t.stopped)
+		for {
+			select {
+			case <-t.ticker.C:
+				t.sample()
+			case <-t.stopChan:
+				logger.GetLogger().Info("连接数采样任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止采样任务
+func (t *ConnectionStatsTask) Stop() {
+	t.stopOnce.Do(func() {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		close(t.stopChan)
+	})
+	<-t.stopped
+}
+
+// sample 记录本实例当前的连接数
+func (t *ConnectionStatsTask) sample() {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := t.statsService.RecordConnections(ctx, t.nodeID, t.count())
+	observeTask("connection_stats", start, err)
+	if err != nil {
+		logger.GetLogger().Warnf("记录连接数失败: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// dataExportPurgeInterval 清理过期导出的间隔
+const dataExportPurgeInterval = time.Hour
+
+// DataExportTask 数据导出任务，生成用户申请的导出压缩包，并删除过期的压缩包
+// 导出通过行级领取保证不会被多个实例重复生成，因此不需要分布式锁
+type DataExportTask struct {
+	exportService *services.DataExportService
+	cfg           *config.DataExportConfig
+	ticker        *time.Ticker
+	ctx           context.Context
+	cancel        context.CancelFunc
+	stopped       chan struct{}
+	stopOnce      sync.Once
+	lastPurge     time.Time
+}
+
+// NewDataExportTask 创建数据导出任务
+func NewDataExportTask(cfg *config.DataExportConfig) *DataExportTask {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DataExportTask{
+		exportService: services.NewDataExportService(cfg),
+		cfg:           cfg,
+		ctx:           ctx,
+		cancel:        cancel,
+		stopped:       make(chan struct{}),
+	}
+}
+
+// Start 启动导出任务，启动时立即处理一次（恢复上次退出时未完成的导出）
+func (t *DataExportTask) Start() {
+	log := logger.GetLogger()
+
+	interval, err := time.ParseDuration(t.cfg.PollInterval)
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+	t.ticker = time.NewTicker(interval)
+	log.Infof("数据导出任务已启动，间隔: %v", interval)
+
+	go func() {
+		defer close(t.stopped)
+		t.process()
+		for {
+			select {
+			case <-t.ticker.C:
+				t.process()
+			case <-t.ctx.Done():
+				log.Info("数据导出任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止任务并等待退出，正在生成的导出在租期过后由其他实例重新领取
+func (t *DataExportTask) Stop() {
+	t.stopOnce.Do(func() {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		t.cancel()
+	})
+	<-t.stopped
+}
+
+// process 生成所有待处理的导出
+func (t *DataExportTask) process() {
+	log := logger.GetLogger()
+
+	start := time.Now()
+	completed, err := t.exportService.ProcessPending(t.ctx)
+	if err == context.Canceled {
+		err = nil
+	}
+	if err != nil {
+		log.Errorf("生成数据导出失败: %v", err)
+	}
+	observeTask("data_export", start, err)
+	if completed > 0 {
+		log.Infof("生成数据导出 %d 个", completed)
+	}
+
+	if time.Since(t.lastPurge) >= dataExportPurgeInterval {
+		t.lastPurge = time.Now()
+		t.purge()
+	}
+}
+
+// purge 删除过期的导出压缩包
+func (t *DataExportTask) purge() {
+	purged, err := t.exportService.PurgeExpired(t.ctx)
+	if err != nil {
+		logger.GetLogger().Errorf("清理过期的数据导出失败: %v", err)
+		return
+	}
+	if purged > 0 {
+		logger.GetLogger().Infof("清理过期的数据导出 %d 个", purged)
+	}
+}
+
+// RunNow 立即执行一次（用于测试和管理后台手动触发）
+func (t *DataExportTask) RunNow() {
+	t.process()
+}
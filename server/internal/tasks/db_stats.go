@@ -0,0 +1,105 @@
+package tasks
+
+import (
+	"sync"
+	"time"
+
+	"gochat/internal/config"
+	"gochat/internal/database"
+	"gochat/internal/logger"
+)
+
+// DBStatsTask 数据库状态采样任务，定期把连接池状态和各表行数写入指标
+type DBStatsTask struct {
+	interval           time.Duration
+	tableStatsInterval time.Duration
+	lastTableStats     time.Time
+	lastWaitCount      int64
+	ticker             *time.Ticker
+	stopChan           chan struct{}
+	stopped            chan struct{}
+	stopOnce           sync.Once
+}
+
+// NewDBStatsTask 创建数据库状态采样任务
+func NewDBStatsTask(cfg *config.DatabaseConfig) *DBStatsTask {
+	interval, err := time.ParseDuration(cfg.StatsInterval)
+	if err != nil || interval <= 0 {
+		interval = 15 * time.Second
+	}
+	tableStatsInterval, err := time.ParseDuration(cfg.TableStatsInterval)
+	if err != nil || tableStatsInterval <= 0 {
+		tableStatsInterval = 5 * time.Minute
+	}
+	return &DBStatsTask{
+		interval:           interval,
+		tableStatsInterval: tableStatsInterval,
+		stopChan:           make(chan struct{}),
+		stopped:            make(chan struct{}),
+	}
+}
+
+// Start 启动采样任务，启动时立即采样一次
+func (t *DBStatsTask) Start() {
+	t.ticker = time.NewTicker(t.interval)
+	logger.GetLogger().Infof("数据库状态采样任务已启动，连接池间隔: %v，表行数间隔: %v", t.interval, t.tableStatsInterval)
+
+	go func() {
+		defer close(t.stopped)
+		t.sample()
+		for {
+			select {
+			case <-t.ticker.C:
+				t.sample()
+			case <-t.stopChan:
+				logger.GetLogger().Info("数据库状态采样任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止采样任务
+func (t *DBStatsTask) Stop() {
+	t.stopOnce.Do(func() {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		close(t.stopChan)
+	})
+	<-t.stopped
+}
+
+// sample 采样连接池状态，表行数按较长的间隔采样
+func (t *DBStatsTask) sample() {
+	log := logger.GetLogger()
+	db := database.GetDB()
+	start := time.Now()
+
+	stats, err := database.SamplePoolStats(db)
+	defer func() { observeTask("db_stats", start, err) }()
+	if err != nil {
+		log.Errorf("采样连接池状态失败: %v", err)
+	} else {
+		// 采样间隔内出现等待且连接已全部占用，说明连接池即将耗尽
+		waited := stats.WaitCount - t.lastWaitCount
+		if waited > 0 && stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+			log.Warnf("数据库连接池已耗尽: 使用中=%d/%d, 新增等待=%d次, 累计等待时长=%v",
+				stats.InUse, stats.MaxOpenConnections, waited, stats.WaitDuration)
+		}
+		t.lastWaitCount = stats.WaitCount
+	}
+
+	if time.Since(t.lastTableStats) >= t.tableStatsInterval {
+		t.lastTableStats = time.Now()
+		if tableErr := database.SampleTableStats(db); tableErr != nil {
+			log.Errorf("采样表行数失败: %v", tableErr)
+			err = tableErr
+		}
+	}
+}
+
+// RunNow 立即执行一次采样（用于测试和管理后台手动触发）
+func (t *DBStatsTask) RunNow() {
+	t.sample()
+}
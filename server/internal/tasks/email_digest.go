@@ -0,0 +1,101 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// emailDigestLockTTL 离线消息摘要任务的分布式锁过期时间，执行期间自动续期
+const emailDigestLockTTL = time.Minute
+
+// EmailDigestTask 离线消息摘要任务，定期给不在线且有未读消息的用户发送摘要邮件
+type EmailDigestTask struct {
+	emailService *services.EmailService
+	interval     time.Duration
+	ticker       *time.Ticker
+	ctx          context.Context
+	cancel       context.CancelFunc
+	stopped      chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewEmailDigestTask 创建离线消息摘要任务
+func NewEmailDigestTask(cfg *config.EmailDigestConfig) *EmailDigestTask {
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil || interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EmailDigestTask{
+		emailService: services.GetEmailService(),
+		interval:     interval,
+		ctx:          ctx,
+		cancel:       cancel,
+		stopped:      make(chan struct{}),
+	}
+}
+
+// Start 启动摘要任务，第一次在一个间隔后执行：刚启动时用户还没有重新连接，在线状态不准确
+func (t *EmailDigestTask) Start() {
+	log := logger.GetLogger()
+	t.ticker = time.NewTicker(t.interval)
+	log.Infof("离线消息摘要任务已启动，间隔: %v", t.interval)
+
+	go func() {
+		defer close(t.stopped)
+		for {
+			select {
+			case <-t.ticker.C:
+				t.send()
+			case <-t.ctx.Done():
+				log.Info("离线消息摘要任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止任务并等待退出
+func (t *EmailDigestTask) Stop() {
+	t.stopOnce.Do(func() {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		t.cancel()
+	})
+	<-t.stopped
+}
+
+// send 发送摘要，多实例部署时通过分布式锁保证同一时间只有一个实例执行
+func (t *EmailDigestTask) send() {
+	log := logger.GetLogger()
+	start := time.Now()
+	err := cache.WithLock(t.ctx, "task:email_digest", emailDigestLockTTL, func(ctx context.Context) error {
+		sent, err := t.emailService.SendDigests(ctx)
+		if sent > 0 || err == nil {
+			log.Infof("离线消息摘要发送完成: 发送=%d封, 耗时=%v", sent, time.Since(start))
+		}
+		return err
+	})
+	observeTask("email_digest", start, err)
+
+	switch {
+	case err == cache.ErrLockNotAcquired:
+		log.Info("其他实例正在发送离线消息摘要，本实例跳过")
+	case err == context.Canceled:
+		log.Info("离线消息摘要任务被中断")
+	case err != nil:
+		log.Errorf("离线消息摘要任务失败: %v", err)
+	}
+}
+
+// RunNow 立即发送一次摘要，供管理后台手动触发
+func (t *EmailDigestTask) RunNow() {
+	t.send()
+}
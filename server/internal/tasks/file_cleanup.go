@@ -1,23 +1,31 @@
 package tasks
 
 import (
+	"context"
 	"time"
 
+	"gochat/internal/cache"
+	"gochat/internal/config"
 	"gochat/internal/logger"
 	"gochat/internal/services"
 )
 
+// fileCleanupLockTTL 文件清理任务的分布式锁过期时间，执行期间自动续期
+const fileCleanupLockTTL = time.Minute
+
 // FileCleanupTask 文件清理任务
 type FileCleanupTask struct {
 	fileService *services.FileService
+	cfg         *config.UploadConfig
 	ticker      *time.Ticker
 	stopChan    chan struct{}
 }
 
 // NewFileCleanupTask 创建文件清理任务
-func NewFileCleanupTask() *FileCleanupTask {
+func NewFileCleanupTask(cfg *config.UploadConfig) *FileCleanupTask {
 	return &FileCleanupTask{
 		fileService: services.NewFileService(),
+		cfg:         cfg,
 		stopChan:    make(chan struct{}),
 	}
 }
@@ -65,28 +73,58 @@ func (t *FileCleanupTask) Stop() {
 	close(t.stopChan)
 }
 
-// cleanup 执行清理逻辑
+// cleanup 执行清理逻辑，多实例部署时通过分布式锁保证同一时间只有一个实例执行
 func (t *FileCleanupTask) cleanup() {
+	start := time.Now()
+	var cleanupErr error
+	err := cache.WithLock(context.Background(), "task:file_cleanup", fileCleanupLockTTL, func(ctx context.Context) error {
+		cleanupErr = t.runCleanup(ctx)
+		return nil
+	})
+	if err == cache.ErrLockNotAcquired {
+		logger.GetLogger().Info("其他实例正在执行文件清理任务，本实例跳过")
+	} else if err != nil {
+		logger.GetLogger().Errorf("获取文件清理任务锁失败: %v", err)
+	} else {
+		err = cleanupErr
+	}
+	observeTask("file_cleanup", start, err)
+}
+
+// runCleanup 按保留策略过期文件引用，清理孤儿文件并输出存储统计，返回孤儿文件清理的错误
+func (t *FileCleanupTask) runCleanup(ctx context.Context) error {
 	log := logger.GetLogger()
 
 	startTime := time.Now()
 	log.Info("开始执行文件清理任务...")
 
+	// 先按保留策略删除过期引用，引用计数归零的文件在下面的孤儿清理中回收
+	if _, err := t.fileService.ExpireReferences(ctx, t.cfg.Retention); err != nil {
+		log.Errorf("文件引用过期处理失败: %v", err)
+	}
+
+	// 删除已过期的分片上传会话遗留的分片
+	if removed, err := services.NewUploadSessionService(&t.cfg.Session).CleanupExpired(ctx); err != nil {
+		log.Errorf("清理过期分片上传失败: %v", err)
+	} else if removed > 0 {
+		log.Infof("已清理%d个过期的分片上传", removed)
+	}
+
 	// 清理7天前的孤儿文件
-	deletedFiles, err := t.fileService.CleanupOrphanFiles(7)
+	deletedFiles, err := t.fileService.CleanupOrphanFiles(ctx, 7)
 	if err != nil {
 		log.Errorf("文件清理任务失败: %v", err)
-		return
+		return err
 	}
 
 	duration := time.Since(startTime)
 	log.Infof("文件清理任务完成: 删除=%d个文件, 耗时=%v", len(deletedFiles), duration)
 
 	// 获取存储统计信息
-	stats, err := t.fileService.GetStorageStats()
+	stats, err := t.fileService.GetStorageStats(ctx)
 	if err != nil {
 		log.Warnf("获取存储统计失败: %v", err)
-		return
+		return nil
 	}
 
 	log.Infof("存储统计: 总文件=%d, 总大小=%.2fMB, 总引用=%d, 孤儿文件=%d, 去重率=%.2f%%",
@@ -95,9 +133,10 @@ func (t *FileCleanupTask) cleanup() {
 		stats["total_references"],
 		stats["orphan_files"],
 		stats["dedup_rate"])
+	return nil
 }
 
-// RunNow 立即执行一次清理（用于测试）
+// RunNow 立即执行一次清理（用于测试和管理后台手动触发）
 func (t *FileCleanupTask) RunNow() {
 	t.cleanup()
 }
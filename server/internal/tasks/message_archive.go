@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// messageArchiveLockTTL 消息归档任务的分布式锁过期时间，执行期间自动续期
+const messageArchiveLockTTL = time.Minute
+
+// MessageArchiveTask 消息归档任务，定期把超过保留期的消息移入归档表
+type MessageArchiveTask struct {
+	archiveService *services.MessageArchiveService
+	cfg            *config.ArchiveConfig
+	ticker         *time.Ticker
+	ctx            context.Context
+	cancel         context.CancelFunc
+	stopped        chan struct{}
+	stopOnce       sync.Once
+}
+
+// NewMessageArchiveTask 创建消息归档任务
+func NewMessageArchiveTask(cfg *config.ArchiveConfig) *MessageArchiveTask {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MessageArchiveTask{
+		archiveService: services.NewMessageArchiveService(),
+		cfg:            cfg,
+		ctx:            ctx,
+		cancel:         cancel,
+		stopped:        make(chan struct{}),
+	}
+}
+
+// Start 启动消息归档任务，启动后立即在后台执行一次
+func (t *MessageArchiveTask) Start() {
+	log := logger.GetLogger()
+
+	interval, err := time.ParseDuration(t.cfg.Interval)
+	if err != nil || interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	t.ticker = time.NewTicker(interval)
+	log.Infof("消息归档任务已启动，保留最近%d个月，间隔: %v", t.cfg.RetentionMonths, interval)
+
+	go func() {
+		defer close(t.stopped)
+		t.archive()
+		for {
+			select {
+			case <-t.ticker.C:
+				t.archive()
+			case <-t.ctx.Done():
+				log.Info("消息归档任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止任务，中断正在进行的归档并等待退出（已提交的批次不受影响）
+func (t *MessageArchiveTask) Stop() {
+	t.stopOnce.Do(func() {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		t.cancel()
+	})
+	<-t.stopped
+}
+
+// archive 执行归档，多实例部署时通过分布式锁保证同一时间只有一个实例执行
+func (t *MessageArchiveTask) archive() {
+	log := logger.GetLogger()
+
+	if t.cfg.RetentionMonths <= 0 {
+		log.Warnf("消息归档保留月数无效: %d，跳过归档", t.cfg.RetentionMonths)
+		return
+	}
+	cutoff := time.Now().AddDate(0, -t.cfg.RetentionMonths, 0)
+
+	startTime := time.Now()
+	err := cache.WithLock(t.ctx, "task:message_archive", messageArchiveLockTTL, func(ctx context.Context) error {
+		archived, err := t.archiveService.ArchiveBefore(ctx, cutoff, t.cfg.BatchSize)
+		if archived > 0 || err == nil {
+			log.Infof("消息归档完成: 归档=%d条, 截止时间=%s, 耗时=%v",
+				archived, cutoff.Format("2006-01-02 15:04:05"), time.Since(startTime))
+		}
+		return err
+	})
+	observeTask("message_archive", startTime, err)
+
+	switch {
+	case err == cache.ErrLockNotAcquired:
+		log.Info("其他实例正在执行消息归档任务，本实例跳过")
+	case err == context.Canceled:
+		log.Info("消息归档任务被中断")
+	case err != nil:
+		log.Errorf("消息归档任务失败: %v", err)
+	}
+}
+
+// RunNow 立即执行一次归档（用于测试和管理后台手动触发）
+func (t *MessageArchiveTask) RunNow() {
+	t.archive()
+}
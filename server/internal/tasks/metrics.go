@@ -0,0 +1,32 @@
+package tasks
+
+import (
+	"context"
+	"time"
+
+	"gochat/internal/cache"
+	"gochat/internal/errreport"
+	"gochat/internal/metrics"
+)
+
+// 后台任务指标
+var (
+	taskDuration = metrics.NewHistogramVec("task_duration_seconds", "后台任务单次执行耗时（不含因其他实例持有锁而跳过的执行）",
+		[]float64{0.01, 0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 3600}, "task")
+	taskRuns = metrics.NewCounterVec("task_runs_total", "后台任务执行次数，result: success、error、skipped（其他实例正在执行）", "task", "result")
+)
+
+// observeTask 记录一次任务执行的耗时和结果
+func observeTask(task string, start time.Time, err error) {
+	switch {
+	case err == cache.ErrLockNotAcquired:
+		taskRuns.WithLabelValues(task, "skipped").Inc()
+		return
+	case err != nil:
+		taskRuns.WithLabelValues(task, "error").Inc()
+		errreport.CaptureError(context.Background(), err, map[string]string{"task": task})
+	default:
+		taskRuns.WithLabelValues(task, "success").Inc()
+	}
+	taskDuration.WithLabelValues(task).Since(start)
+}
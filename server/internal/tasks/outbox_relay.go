@@ -0,0 +1,136 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// outboxPurgeInterval 清理已投递事件的间隔
+const outboxPurgeInterval = time.Hour
+
+// OutboxRelayTask 发件箱中继任务，补投写入方未能投递的事件，并清理已投递的事件
+// 事件通过行级领取保证不会被多个实例重复投递，因此不需要分布式锁
+type OutboxRelayTask struct {
+	outboxService *services.OutboxService
+	cfg           *config.OutboxConfig
+	ticker        *time.Ticker
+	ctx           context.Context
+	cancel        context.CancelFunc
+	stopped       chan struct{}
+	stopOnce      sync.Once
+	lastPurge     time.Time
+}
+
+// NewOutboxRelayTask 创建发件箱中继任务
+func NewOutboxRelayTask(cfg *config.OutboxConfig) *OutboxRelayTask {
+	ctx, cancel := context.WithCancel(context.Background())
+	outboxService := services.NewOutboxService()
+	outboxService.SetMaxAttempts(cfg.MaxAttempts)
+	return &OutboxRelayTask{
+		outboxService: outboxService,
+		cfg:           cfg,
+		ctx:           ctx,
+		cancel:        cancel,
+		stopped:       make(chan struct{}),
+	}
+}
+
+// Start 启动中继任务，启动时立即补投一次（恢复上次退出时遗留的事件）
+func (t *OutboxRelayTask) Start() {
+	log := logger.GetLogger()
+
+	interval, err := time.ParseDuration(t.cfg.PollInterval)
+	if err != nil || interval <= 0 {
+		interval = 5 * time.Second
+	}
+	t.ticker = time.NewTicker(interval)
+	log.Infof("发件箱中继任务已启动，间隔: %v", interval)
+
+	go func() {
+		defer close(t.stopped)
+		t.relay()
+		for {
+			select {
+			case <-t.ticker.C:
+				t.relay()
+			case <-t.ctx.Done():
+				log.Info("发件箱中继任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止任务并等待退出
+func (t *OutboxRelayTask) Stop() {
+	t.stopOnce.Do(func() {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		t.cancel()
+	})
+	<-t.stopped
+}
+
+// relay 补投到期的事件，每批处理完后继续下一批，直到没有到期事件
+func (t *OutboxRelayTask) relay() {
+	log := logger.GetLogger()
+
+	batchSize := t.cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	start := time.Now()
+	total := 0
+	var relayErr error
+	for {
+		published, err := t.outboxService.PublishPending(t.ctx, batchSize)
+		total += published
+		if err != nil {
+			if err != context.Canceled {
+				log.Errorf("发件箱中继失败: %v", err)
+				relayErr = err
+			}
+			break
+		}
+		if published < batchSize {
+			break
+		}
+	}
+	observeTask("outbox_relay", start, relayErr)
+	if total > 0 {
+		log.Infof("发件箱中继补投事件 %d 个", total)
+	}
+
+	if time.Since(t.lastPurge) >= outboxPurgeInterval {
+		t.lastPurge = time.Now()
+		t.purge()
+	}
+}
+
+// purge 删除超过保留时长的已投递事件
+func (t *OutboxRelayTask) purge() {
+	retention, err := time.ParseDuration(t.cfg.Retention)
+	if err != nil || retention <= 0 {
+		retention = 72 * time.Hour
+	}
+	purged, err := t.outboxService.PurgePublished(t.ctx, time.Now().Add(-retention))
+	if err != nil {
+		logger.GetLogger().Errorf("清理已投递的发件箱事件失败: %v", err)
+		return
+	}
+	if purged > 0 {
+		logger.GetLogger().Infof("清理已投递的发件箱事件 %d 个", purged)
+	}
+}
+
+// RunNow 立即执行一次补投（用于测试和管理后台手动触发）
+func (t *OutboxRelayTask) RunNow() {
+	t.relay()
+}
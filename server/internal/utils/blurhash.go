@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// blurhashChars BlurHash使用的base83字符表
+const blurhashChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// EncodeBlurhash 计算图片的BlurHash（https://blurha.sh），xComponents、yComponents为横纵方向的分量数（1-9）
+// 计算量与像素数成正比，调用方应先把图片缩小到几十像素
+func EncodeBlurhash(img image.Image, xComponents, yComponents int) string {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return ""
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	// 预先转换为线性颜色空间
+	linear := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*rgba.Stride + x*4
+			linear[y*w+x] = [3]float64{
+				srgbToLinear(rgba.Pix[i]),
+				srgbToLinear(rgba.Pix[i+1]),
+				srgbToLinear(rgba.Pix[i+2]),
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var factor [3]float64
+			for y := 0; y < h; y++ {
+				cosY := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+				for x := 0; x < w; x++ {
+					basis := normalisation * math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) * cosY
+					pixel := linear[y*w+x]
+					factor[0] += basis * pixel[0]
+					factor[1] += basis * pixel[1]
+					factor[2] += basis * pixel[2]
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var b strings.Builder
+	encode83(&b, (xComponents-1)+(yComponents-1)*9, 1)
+
+	// 交流分量按最大幅值量化
+	maximumValue := 1.0
+	ac := factors[1:]
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, factor := range ac {
+			actualMax = max(actualMax, math.Abs(factor[0]), math.Abs(factor[1]), math.Abs(factor[2]))
+		}
+		quantisedMax := int(max(0, min(82, math.Floor(actualMax*166-0.5))))
+		maximumValue = float64(quantisedMax+1) / 166
+		encode83(&b, quantisedMax, 1)
+	} else {
+		encode83(&b, 0, 1)
+	}
+
+	dc := factors[0]
+	encode83(&b, linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+	for _, factor := range ac {
+		value := 0
+		for _, c := range factor {
+			q := int(max(0, min(18, math.Floor(signPow(c/maximumValue, 0.5)*9+9.5))))
+			value = value*19 + q
+		}
+		encode83(&b, value, 2)
+	}
+	return b.String()
+}
+
+// encode83 以base83写入length位
+func encode83(b *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := value / int(math.Pow(83, float64(length-i))) % 83
+		b.WriteByte(blurhashChars[digit])
+	}
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := max(0, min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
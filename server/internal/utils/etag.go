@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSONWithETag 返回带ETag的成功响应，请求头If-None-Match与当前内容一致时返回304且不带响应体
+// ETag取响应体的SHA-256摘要，内容不变则各实例计算结果一致；使用弱校验值，压缩后的响应也可复用
+// 客户端可以缓存响应，但每次使用前须重新验证，避免看到过期的资料
+func JSONWithETag(c *gin.Context, data interface{}) {
+	body, err := json.Marshal(SuccessResponse(data))
+	if err != nil {
+		HandleInternalError(c, err)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	c.Writer.Header().Add("Vary", "Authorization")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// etagMatches 按弱比较判断If-None-Match是否命中，支持逗号分隔的多个值和*
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
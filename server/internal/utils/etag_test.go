@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveWithETag(data interface{}, ifNoneMatch string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/v1/user/profile", nil)
+	if ifNoneMatch != "" {
+		c.Request.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	JSONWithETag(c, data)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+func TestJSONWithETag(t *testing.T) {
+	data := map[string]interface{}{"id": 1, "nickname": "小明"}
+	w := serveWithETag(data, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^W/"[0-9a-f]{32}"$`, etag)
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"code":0,"message":"success","data":{"id":1,"nickname":"小明"}}`, w.Body.String())
+
+	// 内容不变时ETag稳定，命中返回304且无响应体
+	for _, header := range []string{etag, `"other", ` + etag, "*", etag[2:]} {
+		w = serveWithETag(data, header)
+		assert.Equal(t, http.StatusNotModified, w.Code, header)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+	}
+
+	// 内容变化后旧ETag失效
+	data["nickname"] = "小红"
+	w = serveWithETag(data, etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 // DetectMimeType 检测文件的真实MIME类型
@@ -145,4 +146,60 @@ func ValidateAudioFile(file io.ReadSeeker, filename string, ext string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+// ValidateDocumentFile 验证文档文件的真实MIME类型是否在允许列表中，返回检测到的MIME类型（不含参数）
+func ValidateDocumentFile(file io.ReadSeeker, allowedTypes []string) (string, error) {
+	// 检测文件的真实MIME类型
+	mimeType, err := DetectMimeType(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect file type: %v", err)
+	}
+
+	// 去掉charset等参数，如"text/plain; charset=utf-8"
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+
+	for _, allowed := range allowedTypes {
+		if strings.EqualFold(allowed, mimeType) {
+			return mimeType, nil
+		}
+	}
+	return "", fmt.Errorf("file type %s is not allowed", mimeType)
+}
+
+// IsActiveContentExt 扩展名是否对应浏览器会渲染或执行的内容（HTML、SVG、脚本等），这类文件不允许作为文档上传
+func IsActiveContentExt(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".html", ".htm", ".xhtml", ".shtml", ".svg", ".svgz", ".xml", ".xsl", ".js", ".mjs", ".swf":
+		return true
+	}
+	return false
+}
+
+// ValidateVideoFile 视频文件的初步验证（扩展名+MIME类型），编码和时长由ffprobe进一步校验
+func ValidateVideoFile(file io.ReadSeeker, filename string, ext string) error {
+	// 检测文件的真实MIME类型
+	mimeType, err := DetectMimeType(file)
+	if err != nil {
+		return fmt.Errorf("failed to detect file type: %v", err)
+	}
+
+	// QuickTime格式无法通过文件头识别，检测结果为application/octet-stream
+	validCombinations := map[string][]string{
+		".mp4":  {"video/mp4", "application/octet-stream"},
+		".m4v":  {"video/mp4", "application/octet-stream"},
+		".mov":  {"video/mp4", "application/octet-stream"},
+		".webm": {"video/webm"},
+	}
+	allowedMimeTypes, exists := validCombinations[ext]
+	if !exists {
+		return fmt.Errorf("invalid file extension: %s", ext)
+	}
+	for _, allowedMimeType := range allowedMimeTypes {
+		if allowedMimeType == mimeType {
+			return nil
+		}
+	}
+	return fmt.Errorf("file extension %s does not match detected file type %s", ext, mimeType)
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// StripImageMetadata 去除图片中的EXIF（含GPS定位）、XMP、IPTC和文本注释等元数据，返回处理后的数据和是否有改动
+// JPEG的方向标记会保留为只含方向的最小EXIF段，避免照片显示方向错误；不认识的格式原样返回
+func StripImageMetadata(data []byte) ([]byte, bool) {
+	switch {
+	case len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8:
+		return stripJPEGMetadata(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNGMetadata(data)
+	case len(data) > 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return stripWebPMetadata(data)
+	}
+	return data, false
+}
+
+// stripJPEGMetadata 去除APP1（EXIF/XMP）、APP13（IPTC）和COM段，保留JFIF、ICC色彩配置等影响显示的段
+func stripJPEGMetadata(data []byte) ([]byte, bool) {
+	orientation := JPEGOrientation(data)
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	changed := false
+
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return data, false
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // 填充字节
+			i++
+			continue
+		}
+		if marker == 0xDA { // SOS之后是图像数据，原样保留
+			break
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return data, false
+		}
+		segment := data[i : i+2+size]
+		i += 2 + size
+
+		switch marker {
+		case 0xE1, 0xED, 0xFE: // APP1、APP13、COM
+			if orientation > 1 && marker == 0xE1 && bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+				out = append(out, orientationSegment(orientation)...)
+				orientation = 1 // 只写入一次
+			}
+			changed = true
+			continue
+		}
+		out = append(out, segment...)
+	}
+	if !changed {
+		return data, false
+	}
+	return append(out, data[i:]...), true
+}
+
+// orientationSegment 构造只包含方向标记的APP1段
+func orientationSegment(orientation int) []byte {
+	payload := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 16) // IFD条目 + 下一个IFD偏移（0）
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], uint16(orientation))
+	payload = append(payload, entry...)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks PNG中可能携带元数据的辅助块
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripPNGMetadata 去除EXIF块和文本块
+func stripPNGMetadata(data []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	changed := false
+	for i := len(pngSignature); i < len(data); {
+		if i+8 > len(data) {
+			return data, false
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length // 长度、类型、数据、CRC
+		if length < 0 || end > len(data) {
+			return data, false
+		}
+		if pngMetadataChunks[string(data[i+4:i+8])] {
+			changed = true
+		} else {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	if !changed {
+		return data, false
+	}
+	return out, true
+}
+
+// stripWebPMetadata 去除EXIF和XMP块，并清除VP8X中对应的标志位
+func stripWebPMetadata(data []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	changed := false
+	vp8x := -1
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return data, false
+		}
+		fourcc := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2 // 块数据按偶数字节对齐
+		if size < 0 || end > len(data) {
+			return data, false
+		}
+		switch fourcc {
+		case "EXIF", "XMP ":
+			changed = true
+		default:
+			if fourcc == "VP8X" && size >= 1 {
+				vp8x = len(out) + 8
+			}
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	if !changed {
+		return data, false
+	}
+	if vp8x >= 0 {
+		out[vp8x] &^= 0x08 | 0x04 // EXIF、XMP标志
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, true
+}
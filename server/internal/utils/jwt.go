@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"gochat/internal/config"
+)
+
+// jwtKey 解析后的JWT密钥
+type jwtKey struct {
+	method    jwt.SigningMethod
+	signKey   interface{} // 签名密钥，RS256未配置私钥时为nil
+	verifyKey interface{}
+}
+
+// jwtKeyring 按kid索引的JWT密钥，kid为空的是jwt.secret
+type jwtKeyring struct {
+	keys          map[string]*jwtKey
+	signingID     string
+	acceptUnkeyed bool
+}
+
+// jwtKeyrings 已解析的密钥，按密钥配置缓存，避免每次请求读取密钥文件
+// 热加载每次生成新的配置对象，按内容而不是指针缓存，密钥未变更时复用已解析的密钥
+var jwtKeyrings sync.Map // jwtKeyringID -> *jwtKeyring
+
+// LoadJWTKeys 解析JWT密钥和密钥文件，启动时调用以便尽早发现配置错误
+func LoadJWTKeys(cfg *config.JWTConfig) error {
+	_, err := jwtKeyringFor(cfg)
+	return err
+}
+
+// jwtKeyringFor 获取配置对应的密钥，首次使用时解析
+func jwtKeyringFor(cfg *config.JWTConfig) (*jwtKeyring, error) {
+	id := jwtKeyringID(cfg)
+	if keyring, ok := jwtKeyrings.Load(id); ok {
+		return keyring.(*jwtKeyring), nil
+	}
+	keyring, err := newJWTKeyring(cfg)
+	if err != nil {
+		return nil, err
+	}
+	jwtKeyrings.Store(id, keyring)
+	return keyring, nil
+}
+
+// jwtKeyringID 由影响密钥解析的配置项生成缓存键，过期时间等其他配置项不影响
+func jwtKeyringID(cfg *config.JWTConfig) string {
+	id, _ := json.Marshal(struct {
+		Secret        string
+		SigningKeyID  string
+		AcceptUnkeyed bool
+		Keys          []config.JWTKey
+	}{cfg.Secret, cfg.SigningKeyID, cfg.AcceptUnkeyed, cfg.Keys})
+	return string(id)
+}
+
+// newJWTKeyring 解析配置中的全部密钥，密钥列表的结构已在加载配置时校验
+func newJWTKeyring(cfg *config.JWTConfig) (*jwtKeyring, error) {
+	keyring := &jwtKeyring{
+		keys:          make(map[string]*jwtKey, len(cfg.Keys)+1),
+		signingID:     cfg.SigningKeyID,
+		acceptUnkeyed: cfg.AcceptUnkeyed || cfg.SigningKeyID == "",
+	}
+	if cfg.Secret != "" {
+		keyring.keys[""] = &jwtKey{method: jwt.SigningMethodHS256, signKey: []byte(cfg.Secret), verifyKey: []byte(cfg.Secret)}
+	}
+
+	for _, key := range cfg.Keys {
+		switch key.Algorithm {
+		case "HS256", "HS384", "HS512":
+			secret := key.Secret
+			if secret == "" {
+				secret = os.Getenv(key.SecretEnv)
+			}
+			if len(secret) < 32 {
+				return nil, fmt.Errorf("jwt key %s: secret must be at least 32 characters", key.ID)
+			}
+			keyring.keys[key.ID] = &jwtKey{method: jwt.GetSigningMethod(key.Algorithm), signKey: []byte(secret), verifyKey: []byte(secret)}
+		case "RS256":
+			data, err := os.ReadFile(key.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("jwt key %s: %w", key.ID, err)
+			}
+			publicKey, err := jwt.ParseRSAPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("jwt key %s: invalid public key: %w", key.ID, err)
+			}
+			parsed := &jwtKey{method: jwt.SigningMethodRS256, verifyKey: publicKey}
+			if key.PrivateKeyFile != "" {
+				data, err := os.ReadFile(key.PrivateKeyFile)
+				if err != nil {
+					return nil, fmt.Errorf("jwt key %s: %w", key.ID, err)
+				}
+				privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+				if err != nil {
+					return nil, fmt.Errorf("jwt key %s: invalid private key: %w", key.ID, err)
+				}
+				if !privateKey.PublicKey.Equal(publicKey) {
+					return nil, fmt.Errorf("jwt key %s: private key does not match public key", key.ID)
+				}
+				parsed.signKey = privateKey
+			}
+			keyring.keys[key.ID] = parsed
+		default:
+			return nil, fmt.Errorf("jwt key %s: unsupported algorithm %s", key.ID, key.Algorithm)
+		}
+	}
+
+	if signing, ok := keyring.keys[keyring.signingID]; !ok || signing.signKey == nil {
+		return nil, fmt.Errorf("jwt signing key %q is not available", keyring.signingID)
+	}
+	return keyring, nil
+}
+
+// verifyKey 按Token头选择验证密钥，alg必须与密钥配置的算法一致（防止alg为none或用RSA公钥冒充HMAC密钥）
+func (k *jwtKeyring) verifyKey(token *jwt.Token) (interface{}, error) {
+	kid := ""
+	if raw, ok := token.Header["kid"]; ok {
+		if kid, ok = raw.(string); !ok || kid == "" {
+			return nil, errors.New("invalid kid")
+		}
+	}
+	if kid == "" && !k.acceptUnkeyed {
+		return nil, errors.New("token without kid is no longer accepted")
+	}
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// GenerateToken 生成JWT token，使用jwt.signing_key_id指定的密钥签名
+func GenerateToken(userID int64, cfg *config.JWTConfig) (string, int64, error) {
+	keyring, err := jwtKeyringFor(cfg)
+	if err != nil {
+		return "", 0, err
+	}
+	key := keyring.keys[keyring.signingID]
+
+	// 计算过期时间
+	expireAt := time.Now().Add(time.Hour * time.Duration(cfg.ExpireHours)).Unix()
+
+	// 创建claims
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"exp":     expireAt,
+		"iat":     time.Now().Unix(),
+	}
+
+	// 创建token，验证时按kid选择密钥
+	token := jwt.NewWithClaims(key.method, claims)
+	if keyring.signingID != "" {
+		token.Header["kid"] = keyring.signingID
+	}
+
+	// 签名token
+	tokenString, err := token.SignedString(key.signKey)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return tokenString, expireAt, nil
+}
+
+// ParseToken 验证JWT token的签名和有效期并返回claims
+func ParseToken(tokenString string, cfg *config.JWTConfig) (jwt.MapClaims, error) {
+	keyring, err := jwtKeyringFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(tokenString, keyring.verifyKey, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	// 提取claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+// ValidateToken 验证JWT token并返回userID
+func ValidateToken(tokenString string, cfg *config.JWTConfig) (int64, error) {
+	claims, err := ParseToken(tokenString, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	// 获取用户ID
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errors.New("user_id not found in token")
+	}
+
+	return int64(userID), nil
+}
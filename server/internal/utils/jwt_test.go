@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+const (
+	testJWTSecret = "legacy-secret-legacy-secret-legacy-secret"
+	testKeySecret = "key-2026-secret-key-2026-secret-key-2026"
+)
+
+func TestJWTKeyRotation(t *testing.T) {
+	legacy := &config.JWTConfig{Secret: testJWTSecret, ExpireHours: 1, AcceptUnkeyed: true}
+	oldToken, _, err := GenerateToken(42, legacy)
+	require.NoError(t, err)
+
+	// 加入新密钥并切换签发密钥，旧Token仍然有效
+	rotated := &config.JWTConfig{
+		Secret:        testJWTSecret,
+		ExpireHours:   1,
+		SigningKeyID:  "2026-10",
+		AcceptUnkeyed: true,
+		Keys:          []config.JWTKey{{ID: "2026-10", Algorithm: "HS256", Secret: testKeySecret}},
+	}
+	newToken, _, err := GenerateToken(42, rotated)
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10", parsed.Header["kid"])
+
+	for _, token := range []string{oldToken, newToken} {
+		userID, err := ValidateToken(token, rotated)
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), userID)
+	}
+
+	// 旧Token过期后不再接受不带kid的Token
+	strict := *rotated
+	strict.AcceptUnkeyed = false
+	_, err = ValidateToken(oldToken, &strict)
+	assert.Error(t, err)
+	_, err = ValidateToken(newToken, &strict)
+	assert.NoError(t, err)
+
+	// 未知kid
+	unknown := *rotated
+	unknown.Keys = []config.JWTKey{{ID: "2027-01", Algorithm: "HS256", Secret: testKeySecret}}
+	unknown.SigningKeyID = "2027-01"
+	_, err = ValidateToken(newToken, &unknown)
+	assert.Error(t, err)
+}
+
+func TestJWTAlgorithmPinning(t *testing.T) {
+	dir := t.TempDir()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	publicFile := filepath.Join(dir, "jwt.pub")
+	privateFile := filepath.Join(dir, "jwt.key")
+	require.NoError(t, os.WriteFile(publicFile, publicPEM, 0o600))
+	require.NoError(t, os.WriteFile(privateFile, privatePEM, 0o600))
+
+	cfg := &config.JWTConfig{
+		Secret:       testJWTSecret,
+		ExpireHours:  1,
+		SigningKeyID: "rsa-1",
+		Keys:         []config.JWTKey{{ID: "rsa-1", Algorithm: "RS256", PublicKeyFile: publicFile, PrivateKeyFile: privateFile}},
+	}
+	require.NoError(t, LoadJWTKeys(cfg))
+	token, _, err := GenerateToken(7, cfg)
+	require.NoError(t, err)
+	userID, err := ValidateToken(token, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), userID)
+
+	claims := jwt.MapClaims{"user_id": 7, "exp": time.Now().Add(time.Hour).Unix()}
+
+	// 用RSA公钥作为HMAC密钥伪造的Token
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "rsa-1"
+	forgedString, err := forged.SignedString(publicPEM)
+	require.NoError(t, err)
+	_, err = ValidateToken(forgedString, cfg)
+	assert.ErrorContains(t, err, "unexpected signing method")
+
+	// alg为none的Token
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	noneString, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = ValidateToken(noneString, cfg)
+	assert.Error(t, err)
+
+	// 缺少exp的Token
+	noExpiry := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 7})
+	noExpiryString, err := noExpiry.SignedString([]byte(testJWTSecret))
+	require.NoError(t, err)
+	_, err = ValidateToken(noExpiryString, &config.JWTConfig{Secret: testJWTSecret, AcceptUnkeyed: true})
+	assert.ErrorIs(t, err, jwt.ErrTokenRequiredClaimMissing)
+}
+
+func TestLoadJWTKeysRejectsWeakSecret(t *testing.T) {
+	t.Setenv("GOCHAT_TEST_JWT_KEY", strings.Repeat("k", 16))
+	cfg := &config.JWTConfig{
+		Secret:       testJWTSecret,
+		SigningKeyID: "env",
+		Keys:         []config.JWTKey{{ID: "env", Algorithm: "HS512", SecretEnv: "GOCHAT_TEST_JWT_KEY"}},
+	}
+	assert.ErrorContains(t, LoadJWTKeys(cfg), "at least 32 characters")
+}
+
+func TestJWTKeyringCachedByKeyConfig(t *testing.T) {
+	cfg := &config.JWTConfig{Secret: testJWTSecret, ExpireHours: 1, AcceptUnkeyed: true}
+	keyring, err := jwtKeyringFor(cfg)
+	require.NoError(t, err)
+
+	// 热加载生成新的配置对象，密钥未变更时复用已解析的密钥
+	reloaded := *cfg
+	reloaded.ExpireHours = 2
+	cached, err := jwtKeyringFor(&reloaded)
+	require.NoError(t, err)
+	assert.Same(t, keyring, cached)
+
+	// 密钥变更后重新解析
+	reloaded.SigningKeyID = "2026-10"
+	reloaded.Keys = []config.JWTKey{{ID: "2026-10", Algorithm: "HS256", Secret: testKeySecret}}
+	rotated, err := jwtKeyringFor(&reloaded)
+	require.NoError(t, err)
+	assert.NotSame(t, keyring, rotated)
+}
@@ -1,15 +1,12 @@
 package utils
 
 import (
-	"errors"
-	"fmt"
-	"time"
+	"net/mail"
+	"strings"
+	"unicode"
 	"unicode/utf8"
 
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
-
-	"gochat/internal/config"
 )
 
 // HashPassword 密码哈希
@@ -27,88 +24,105 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateToken 生成JWT token
-func GenerateToken(userID int64, cfg *config.JWTConfig) (string, int64, error) {
-	// 计算过期时间
-	expireAt := time.Now().Add(time.Hour * time.Duration(cfg.ExpireHours)).Unix()
+// 字段长度限制（按字符数计算）
+const (
+	PasswordMinLength    = 6
+	PasswordMaxLength    = 20
+	NicknameMinLength    = 2
+	NicknameMaxLength    = 20
+	SignatureMaxLength   = 200 // 与users.signature列长度一致
+	EmailMaxLength       = 255 // 与users.email列长度一致
+	MessageTextMaxLength = 5000
+)
 
-	// 创建claims
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     expireAt,
-		"iat":     time.Now().Unix(),
-	}
+// reservedNicknames 容易被用来冒充系统或管理员的昵称（不区分大小写，完全相同时拒绝）
+var reservedNicknames = []string{"admin", "administrator", "root", "system", "gochat"}
 
-	// 创建token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// 字段校验只检查长度、字符集和结构，不按关键词拒绝输入：
+// 数据库访问全部使用参数化查询，响应统一经JSON编码转义输出，引号、分号或"update"之类的单词都是合法输入
 
-	// 签名token
-	tokenString, err := token.SignedString([]byte(cfg.Secret))
-	if err != nil {
-		return "", 0, err
+// ValidatePhone 验证手机号格式：11位数字，以1开头，第二位为3-9
+func ValidatePhone(phone string) bool {
+	if len(phone) != 11 || phone[0] != '1' || phone[1] < '3' || phone[1] > '9' {
+		return false
+	}
+	for _, c := range phone {
+		if c < '0' || c > '9' {
+			return false
+		}
 	}
+	return true
+}
 
-	return tokenString, expireAt, nil
+// ValidatePassword 验证密码：6-20个字符，允许任意可打印字符（包括空格和标点），不允许控制字符
+func ValidatePassword(password string) bool {
+	return validText(password, PasswordMinLength, PasswordMaxLength, false)
 }
 
-// ValidateToken 验证JWT token并返回userID
-func ValidateToken(tokenString string, cfg *config.JWTConfig) (int64, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// ValidateNickname 验证昵称：2-20个字符，首尾不能是空白，不能包含控制字符和不可见的格式字符，不能使用保留昵称
+func ValidateNickname(nickname string) bool {
+	if !validText(nickname, NicknameMinLength, NicknameMaxLength, false) || strings.TrimSpace(nickname) != nickname {
+		return false
+	}
+	for _, reserved := range reservedNicknames {
+		if strings.EqualFold(nickname, reserved) {
+			return false
 		}
-		return []byte(cfg.Secret), nil
-	})
-
-	if err != nil {
-		return 0, err
 	}
+	return true
+}
 
-	if !token.Valid {
-		return 0, errors.New("invalid token")
-	}
+// ValidateSignature 验证个性签名：最多200个字符的单行文本
+func ValidateSignature(signature string) bool {
+	return validText(signature, 0, SignatureMaxLength, false)
+}
 
-	// 提取claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("invalid token claims")
+// ValidateEmail 验证通知邮箱：空字符串（不接收邮件）或不带显示名的邮箱地址，最多255个字符
+func ValidateEmail(email string) bool {
+	if email == "" {
+		return true
 	}
-
-	// 获取用户ID
-	userID, ok := claims["user_id"].(float64)
-	if !ok {
-		return 0, errors.New("user_id not found in token")
+	if len(email) > EmailMaxLength {
+		return false
 	}
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
 
-	return int64(userID), nil
+// ValidatePlainText 验证单行文本：不超过maxLength个字符，不包含控制字符和不可见的格式字符
+func ValidatePlainText(text string, maxLength int) bool {
+	return validText(text, 0, maxLength, false)
 }
 
-// ValidatePhone 验证手机号格式
-func ValidatePhone(phone string) bool {
-	if len(phone) != 11 {
+// ValidateMessageText 验证文本消息内容：非空白，最多5000个字符，允许换行和制表符
+func ValidateMessageText(content string) bool {
+	return strings.TrimSpace(content) != "" && validText(content, 1, MessageTextMaxLength, true)
+}
+
+// validText 检查UTF-8编码、字符数和字符集；multiline为true时允许换行、回车和制表符
+// 不可见的格式字符（零宽字符、双向文本控制符等）可用于伪装显示内容，一律拒绝
+func validText(text string, minLength, maxLength int, multiline bool) bool {
+	if !utf8.ValidString(text) {
 		return false
 	}
-	for _, c := range phone {
-		if c < '0' || c > '9' {
+	count := 0
+	for _, r := range text {
+		count++
+		if count > maxLength {
+			return false
+		}
+		if multiline && (r == '\n' || r == '\r' || r == '\t') {
+			continue
+		}
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
 			return false
 		}
 	}
-	return true
-}
-
-// ValidatePassword 验证密码强度
-func ValidatePassword(password string) bool {
-	return len(password) >= 6 && len(password) <= 20
-}
-
-// ValidateNickname 验证昵称
-func ValidateNickname(nickname string) bool {
-	// 使用utf8.RuneCountInString来正确计算Unicode字符数量，而不是字节数
-	runeCount := utf8.RuneCountInString(nickname)
-	return runeCount >= 2 && runeCount <= 20
+	return count >= minLength
 }
 
 // FormatResponse 格式化API响应
+// 响应统一经JSON编码输出，字符串中的<、>、&会被转义为\u003c、\u003e、\u0026，输入保存原文，不需要预先转义
 func FormatResponse(code int, message string, data interface{}) map[string]interface{} {
 	return map[string]interface{}{
 		"code":    code,
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePhone(t *testing.T) {
+	assert.True(t, ValidatePhone("13800000001"))
+	assert.True(t, ValidatePhone("19912345678"))
+	for _, phone := range []string{"", "1380000000", "138000000012", "23800000001", "12345678901", "1380000000a", "１3800000001"} {
+		assert.False(t, ValidatePhone(phone), phone)
+	}
+}
+
+func TestValidatePasswordAllowsPunctuation(t *testing.T) {
+	for _, password := range []string{`it's "ok"`, "a;b--c/*d*/", "update me", "union select 1", "<script>x", "密码密码密码"} {
+		assert.True(t, ValidatePassword(password), password)
+	}
+	for _, password := range []string{"12345", strings.Repeat("a", 21), "abc\x00def", "abc\ndef", "\xff\xfe\xfd\xfc\xfb\xfa"} {
+		assert.False(t, ValidatePassword(password), password)
+	}
+}
+
+func TestValidateNickname(t *testing.T) {
+	for _, nickname := range []string{"小明", "badminton fan", "O'Brien", "updater; drop", "Rootbeer", "<b>bold</b>"} {
+		assert.True(t, ValidateNickname(nickname), nickname)
+	}
+	for _, nickname := range []string{"a", strings.Repeat("名", 21), " padded", "padded ", "tab\tname", "zero\u200bwidth", "bidi\u202eeman", "Admin", "SYSTEM"} {
+		assert.False(t, ValidateNickname(nickname), nickname)
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	for _, email := range []string{"", "alice@example.com", "a.b+tag@mail.example.cn"} {
+		assert.True(t, ValidateEmail(email), email)
+	}
+	for _, email := range []string{"alice", "Alice <alice@example.com>", " alice@example.com", "alice@example.com\r\nBcc: x@example.com", strings.Repeat("a", EmailMaxLength) + "@example.com"} {
+		assert.False(t, ValidateEmail(email), email)
+	}
+}
+
+func TestValidateTextFields(t *testing.T) {
+	assert.True(t, ValidateSignature(""))
+	assert.True(t, ValidateSignature(strings.Repeat("签", SignatureMaxLength)))
+	assert.False(t, ValidateSignature(strings.Repeat("签", SignatureMaxLength+1)))
+	assert.False(t, ValidateSignature("line1\nline2"))
+
+	assert.True(t, ValidateMessageText("line1\nline2\tSELECT * FROM users; -- 'quoted'"))
+	assert.True(t, ValidateMessageText(strings.Repeat("字", MessageTextMaxLength)))
+	assert.False(t, ValidateMessageText(strings.Repeat("字", MessageTextMaxLength+1)))
+	assert.False(t, ValidateMessageText(" \n\t"))
+	assert.False(t, ValidateMessageText("bell\a"))
+
+	assert.True(t, ValidatePlainText("a & b; \"c\"", 10))
+	assert.False(t, ValidatePlainText("a & b; \"c\"!", 10))
+}
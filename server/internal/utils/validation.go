@@ -1,10 +1,15 @@
 package utils
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+
+	"gochat/internal/breaker"
+	"gochat/internal/errreport"
+	"gochat/internal/logger"
 )
 
 // GetAuthenticatedUser 从上下文中获取已认证的用户ID
@@ -24,7 +29,7 @@ func GetAuthenticatedUser(c *gin.Context) (int64, bool) {
 func RequireAuthentication(c *gin.Context) (int64, bool) {
 	userID, exists := GetAuthenticatedUser(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse(401, "User not authenticated"))
+		c.JSON(http.StatusUnauthorized, WithRequestID(c, ErrorResponse(401, "User not authenticated")))
 		c.Abort()
 		return 0, false
 	}
@@ -62,7 +67,7 @@ func ParseIntQuery(c *gin.Context, queryName string, defaultValue int) int {
 // ValidateAndBindJSON 验证并绑定JSON请求体，失败时自动返回400错误
 func ValidateAndBindJSON(c *gin.Context, obj interface{}) bool {
 	if err := c.ShouldBindJSON(obj); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(400, "Invalid request data"))
+		c.JSON(http.StatusBadRequest, WithRequestID(c, ErrorResponse(400, "Invalid request data")))
 		return false
 	}
 	return true
@@ -72,7 +77,7 @@ func ValidateAndBindJSON(c *gin.Context, obj interface{}) bool {
 func ValidateRequiredQuery(c *gin.Context, queryName, fieldName string) (string, bool) {
 	value := c.Query(queryName)
 	if value == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse(400, fieldName+" is required"))
+		c.JSON(http.StatusBadRequest, WithRequestID(c, ErrorResponse(400, fieldName+" is required")))
 		c.Abort()
 		return "", false
 	}
@@ -81,20 +86,35 @@ func ValidateRequiredQuery(c *gin.Context, queryName, fieldName string) (string,
 
 // HandleParseError 处理参数解析错误，统一返回400响应
 func HandleParseError(c *gin.Context, paramName string) {
-	c.JSON(http.StatusBadRequest, ErrorResponse(400, "Invalid "+paramName))
+	c.JSON(http.StatusBadRequest, WithRequestID(c, ErrorResponse(400, "Invalid "+paramName)))
 }
 
-// HandleInternalError 处理内部服务器错误，统一返回500响应
+// HandleInternalError 处理内部服务器错误，统一返回500响应（依赖熔断时返回503），错误日志带有请求ID
 func HandleInternalError(c *gin.Context, err error) {
-	c.JSON(http.StatusInternalServerError, ErrorResponse(500, err.Error()))
+	logger.WithContext(c.Request.Context()).Errorf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	if errors.Is(err, breaker.ErrOpen) {
+		// 依赖熔断中，客户端稍后重试即可
+		c.JSON(http.StatusServiceUnavailable, WithRequestID(c, ErrorResponse(503, "Service temporarily unavailable")))
+		return
+	}
+	errreport.CaptureRequestError(c, err)
+	c.JSON(http.StatusInternalServerError, WithRequestID(c, ErrorResponse(500, err.Error())))
 }
 
 // HandleNotFoundError 处理资源未找到错误，统一返回404响应
 func HandleNotFoundError(c *gin.Context, resourceName string) {
-	c.JSON(http.StatusNotFound, ErrorResponse(404, resourceName+" not found"))
+	c.JSON(http.StatusNotFound, WithRequestID(c, ErrorResponse(404, resourceName+" not found")))
 }
 
 // HandleBadRequestError 处理请求错误，统一返回400响应
 func HandleBadRequestError(c *gin.Context, message string) {
-	c.JSON(http.StatusBadRequest, ErrorResponse(400, message))
-}
\ No newline at end of file
+	c.JSON(http.StatusBadRequest, WithRequestID(c, ErrorResponse(400, message)))
+}
+
+// WithRequestID 在错误响应中加入请求ID，便于用户反馈问题时按请求ID查找日志
+func WithRequestID(c *gin.Context, response map[string]interface{}) map[string]interface{} {
+	if requestID := c.GetString("request_id"); requestID != "" {
+		response["request_id"] = requestID
+	}
+	return response
+}
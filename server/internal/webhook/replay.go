@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ReplayGuard 记录已处理的投递，防止同一请求被重复处理
+type ReplayGuard interface {
+	// Remember 记录key并保留ttl，首次出现时返回true
+	Remember(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// redisReplayGuard 基于Redis的防重放记录，多实例共享
+type redisReplayGuard struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisReplayGuard 创建基于Redis的防重放记录，prefix用于区分不同的回调来源
+func NewRedisReplayGuard(client *redis.Client, prefix string) ReplayGuard {
+	return &redisReplayGuard{client: client, prefix: "webhook:seen:" + prefix + ":"}
+}
+
+func (g *redisReplayGuard) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return g.client.SetNX(ctx, g.prefix+key, 1, ttl).Result()
+}
+
+// memoryReplayGuard 进程内的防重放记录，适用于单实例部署和测试
+type memoryReplayGuard struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // key -> 过期时间
+	now  func() time.Time
+}
+
+// NewMemoryReplayGuard 创建进程内的防重放记录
+func NewMemoryReplayGuard() ReplayGuard {
+	return &memoryReplayGuard{seen: make(map[string]time.Time), now: time.Now}
+}
+
+func (g *memoryReplayGuard) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	// 顺便清理过期记录，数量受时间偏差窗口内的请求数限制
+	for k, expiresAt := range g.seen {
+		if now.After(expiresAt) {
+			delete(g.seen, k)
+		}
+	}
+	if _, ok := g.seen[key]; ok {
+		return false, nil
+	}
+	g.seen[key] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,212 @@
+// Package webhook 提供Webhook签名工具：对发出的Webhook/机器人回调签名，并校验第三方发来的回调
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 校验失败的原因，调用方可按errors.Is区分后记录日志，响应中不应透露具体原因
+var (
+	ErrMissingSignature = errors.New("webhook: missing signature")
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	ErrInvalidTimestamp = errors.New("webhook: invalid or expired timestamp")
+	ErrReplayed         = errors.New("webhook: request already processed")
+	ErrBodyTooLarge     = errors.New("webhook: request body too large")
+)
+
+// Scheme 签名格式：签名所在的请求头、编码以及签名内容是否包含时间戳
+// 本服务发出的Webhook使用DefaultScheme，校验第三方回调时按对方文档构造
+type Scheme struct {
+	SignatureHeader string // 签名请求头，可包含多个签名（逗号或空格分隔），密钥轮换期间任一匹配即可
+	TimestampHeader string // 时间戳请求头（Unix秒），为空表示签名不含时间戳，此时只能按投递ID去重
+	IDHeader        string // 投递ID请求头，用于防重放，为空时以签名去重
+	Prefix          string // 签名值的前缀，如"v1="、"sha256="
+	Base64          bool   // 签名使用base64编码，默认为小写hex
+}
+
+// DefaultScheme 本服务发出的Webhook签名格式：
+// 签名 = hex(HMAC-SHA256(secret, 时间戳 + "." + 请求体))，请求头 X-GoChat-Signature: v1=<签名>
+var DefaultScheme = Scheme{
+	SignatureHeader: "X-GoChat-Signature",
+	TimestampHeader: "X-GoChat-Timestamp",
+	IDHeader:        "X-GoChat-Delivery",
+	Prefix:          "v1=",
+}
+
+// signedContent 参与签名的内容
+func (s *Scheme) signedContent(timestamp string, body []byte) []byte {
+	if s.TimestampHeader == "" {
+		return body
+	}
+	content := make([]byte, 0, len(timestamp)+1+len(body))
+	content = append(content, timestamp...)
+	content = append(content, '.')
+	return append(content, body...)
+}
+
+// sign 计算签名（不含前缀）
+func (s *Scheme) sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(s.signedContent(timestamp, body))
+	if s.Base64 {
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signer 发出Webhook时签名
+type Signer struct {
+	scheme Scheme
+	secret []byte
+	now    func() time.Time
+}
+
+// NewSigner 创建签名器，secret为与接收方约定的密钥
+func NewSigner(secret string) *Signer {
+	return &Signer{scheme: DefaultScheme, secret: []byte(secret), now: time.Now}
+}
+
+// Sign 对请求体签名，返回应设置的请求头（签名、时间戳和新生成的投递ID）
+// 重试同一次投递时应复用首次的请求头，接收方按投递ID去重
+func (s *Signer) Sign(body []byte) http.Header {
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	header := http.Header{}
+	header.Set(s.scheme.TimestampHeader, timestamp)
+	header.Set(s.scheme.SignatureHeader, s.scheme.Prefix+s.scheme.sign(s.secret, timestamp, body))
+	header.Set(s.scheme.IDHeader, newDeliveryID())
+	return header
+}
+
+// SignRequest 对请求签名并设置请求头，body为请求的完整内容
+func (s *Signer) SignRequest(req *http.Request, body []byte) {
+	for name, values := range s.Sign(body) {
+		req.Header[name] = values
+	}
+}
+
+// newDeliveryID 生成随机投递ID
+func newDeliveryID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Verifier 校验收到的Webhook
+type Verifier struct {
+	Scheme    Scheme
+	Secrets   []string      // 可用密钥，密钥轮换期间同时配置新旧密钥
+	Tolerance time.Duration // 时间戳与当前时间允许的最大偏差，默认5分钟
+	Replay    ReplayGuard   // 防重放，为nil时不检查
+	MaxBody   int64         // VerifyRequest读取请求体的上限，默认1MB
+
+	now func() time.Time
+}
+
+// NewVerifier 按DefaultScheme创建校验器，用于校验其他GoChat实例或使用相同格式的服务发来的回调
+func NewVerifier(replay ReplayGuard, secrets ...string) *Verifier {
+	return &Verifier{Scheme: DefaultScheme, Secrets: secrets, Replay: replay}
+}
+
+// Verify 校验签名、时间戳并检查重放，body为原始请求体
+func (v *Verifier) Verify(ctx context.Context, header http.Header, body []byte) error {
+	signatures := v.signatures(header.Get(v.Scheme.SignatureHeader))
+	if len(signatures) == 0 {
+		return ErrMissingSignature
+	}
+
+	tolerance := v.Tolerance
+	if tolerance <= 0 {
+		tolerance = 5 * time.Minute
+	}
+	timestamp := ""
+	if v.Scheme.TimestampHeader != "" {
+		timestamp = header.Get(v.Scheme.TimestampHeader)
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return ErrInvalidTimestamp
+		}
+		if skew := v.clock()().Sub(time.Unix(unix, 0)); skew > tolerance || skew < -tolerance {
+			return ErrInvalidTimestamp
+		}
+	}
+
+	matched := ""
+	for _, secret := range v.Secrets {
+		expected := v.Scheme.sign([]byte(secret), timestamp, body)
+		for _, signature := range signatures {
+			if hmac.Equal([]byte(expected), []byte(signature)) {
+				matched = signature
+			}
+		}
+	}
+	if matched == "" {
+		return ErrInvalidSignature
+	}
+
+	// 签名校验通过后才记录，避免伪造请求占用投递ID；超过时间偏差的请求已被拒绝，记录只需保留两倍偏差
+	if v.Replay != nil {
+		key := matched
+		if v.Scheme.IDHeader != "" && header.Get(v.Scheme.IDHeader) != "" {
+			key = header.Get(v.Scheme.IDHeader)
+		}
+		first, err := v.Replay.Remember(ctx, key, 2*tolerance)
+		if err != nil {
+			return fmt.Errorf("webhook: replay check failed: %w", err)
+		}
+		if !first {
+			return ErrReplayed
+		}
+	}
+	return nil
+}
+
+// VerifyRequest 读取并校验请求，返回请求体；请求体会被重置，后续处理可以再次读取
+func (v *Verifier) VerifyRequest(r *http.Request) ([]byte, error) {
+	maxBody := v.MaxBody
+	if maxBody <= 0 {
+		maxBody = 1 << 20
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBody {
+		return nil, ErrBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := v.Verify(r.Context(), r.Header, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// signatures 解析签名请求头，忽略前缀不符的值（如其他版本的签名）
+func (v *Verifier) signatures(value string) []string {
+	var signatures []string
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if signature, ok := strings.CutPrefix(part, v.Scheme.Prefix); ok && signature != "" {
+			signatures = append(signatures, signature)
+		}
+	}
+	return signatures
+}
+
+func (v *Verifier) clock() func() time.Time {
+	if v.now != nil {
+		return v.now
+	}
+	return time.Now
+}
@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"message.created","id":1}`)
+	signer := NewSigner("new-secret")
+	header := signer.Sign(body)
+	assert.Regexp(t, `^v1=[0-9a-f]{64}$`, header.Get("X-GoChat-Signature"))
+	assert.Len(t, header.Get("X-GoChat-Delivery"), 32)
+
+	// 密钥轮换期间新旧密钥都可以校验
+	verifier := NewVerifier(NewMemoryReplayGuard(), "old-secret", "new-secret")
+	require.NoError(t, verifier.Verify(context.Background(), header, body))
+
+	// 重试同一次投递被识别为重放
+	assert.ErrorIs(t, verifier.Verify(context.Background(), header, body), ErrReplayed)
+
+	// 请求体被篡改或密钥不对
+	header = signer.Sign(body)
+	assert.ErrorIs(t, verifier.Verify(context.Background(), header, []byte(`{"event":"message.created","id":2}`)), ErrInvalidSignature)
+	assert.ErrorIs(t, NewVerifier(nil, "other").Verify(context.Background(), header, body), ErrInvalidSignature)
+	assert.ErrorIs(t, verifier.Verify(context.Background(), http.Header{}, body), ErrMissingSignature)
+}
+
+func TestVerifyRejectsStaleTimestamp(t *testing.T) {
+	body := []byte("{}")
+	signer := NewSigner("secret")
+	signer.now = func() time.Time { return time.Now().Add(-10 * time.Minute) }
+	header := signer.Sign(body)
+
+	verifier := NewVerifier(nil, "secret")
+	assert.ErrorIs(t, verifier.Verify(context.Background(), header, body), ErrInvalidTimestamp)
+
+	verifier.Tolerance = 15 * time.Minute
+	assert.NoError(t, verifier.Verify(context.Background(), header, body))
+
+	header.Set("X-GoChat-Timestamp", "not-a-number")
+	assert.ErrorIs(t, verifier.Verify(context.Background(), header, body), ErrInvalidTimestamp)
+}
+
+func TestVerifyThirdPartyScheme(t *testing.T) {
+	// 签名不含时间戳、base64编码的第三方回调
+	body := []byte(`{"type":"ping"}`)
+	mac := hmac.New(sha256.New, []byte("partner"))
+	mac.Write(body)
+	req := httptest.NewRequest("POST", "/callback", bytes.NewReader(body))
+	req.Header.Set("X-Partner-Signature", "sha256="+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("X-Partner-Event-Id", "evt_1")
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	verifier := &Verifier{
+		Scheme:  Scheme{SignatureHeader: "X-Partner-Signature", IDHeader: "X-Partner-Event-Id", Prefix: "sha256=", Base64: true},
+		Secrets: []string{"partner"},
+		Replay:  NewRedisReplayGuard(client, "partner"),
+	}
+	read, err := verifier.VerifyRequest(req)
+	require.NoError(t, err)
+	assert.Equal(t, body, read)
+	// 请求体可以再次读取
+	again, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, again)
+	assert.True(t, mr.Exists("webhook:seen:partner:evt_1"))
+
+	req = httptest.NewRequest("POST", "/callback", bytes.NewReader(body))
+	req.Header = http.Header{"X-Partner-Signature": {"sha256=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))}, "X-Partner-Event-Id": {"evt_1"}}
+	_, err = verifier.VerifyRequest(req)
+	assert.ErrorIs(t, err, ErrReplayed)
+
+	verifier.MaxBody = 4
+	req = httptest.NewRequest("POST", "/callback", bytes.NewReader(body))
+	_, err = verifier.VerifyRequest(req)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestSignRequest(t *testing.T) {
+	body := []byte("payload")
+	signer := NewSigner("secret")
+	fixed := time.Unix(1760000000, 0)
+	signer.now = func() time.Time { return fixed }
+	req := httptest.NewRequest("POST", "https://example.com/hook", bytes.NewReader(body))
+	signer.SignRequest(req, body)
+
+	assert.Equal(t, strconv.FormatInt(fixed.Unix(), 10), req.Header.Get("X-GoChat-Timestamp"))
+	verifier := NewVerifier(nil, "secret")
+	verifier.now = func() time.Time { return fixed }
+	assert.NoError(t, verifier.Verify(context.Background(), req.Header, body))
+}
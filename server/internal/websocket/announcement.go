@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/services"
+)
+
+// 公告推送动作
+const (
+	AnnouncementActionNew      = "new"      // 新公告
+	AnnouncementActionWithdraw = "withdraw" // 公告被撤回
+)
+
+// announcementPushTimeout 筛选目标用户并推送一条公告的超时时间
+const announcementPushTimeout = 30 * time.Second
+
+// RegisterAnnouncementBroadcast 订阅公告发布和撤回通知，推送给本实例上在线的目标用户
+// 每个实例只推送给自己的连接，不经集群转发，避免重复推送；离线用户上线后通过接口拉取
+func RegisterAnnouncementBroadcast(cfg *config.AnnouncementsConfig) {
+	announcementService := services.NewAnnouncementService(cfg)
+	cache.OnInvalidate(cache.ScopeAnnouncement, func(id string) {
+		announcementID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return
+		}
+		// 在订阅协程之外筛选用户，避免阻塞其他失效事件
+		go pushAnnouncement(announcementService, announcementID)
+	})
+}
+
+// pushAnnouncement 把公告推送给本实例上在线的目标用户，已取消的公告推送撤回通知
+func pushAnnouncement(announcementService *services.AnnouncementService, announcementID int64) {
+	log := logger.GetLogger()
+	ctx, cancel := context.WithTimeout(context.Background(), announcementPushTimeout)
+	defer cancel()
+
+	announcement, err := announcementService.Get(ctx, announcementID)
+	if err != nil {
+		log.Errorf("获取公告 %d 失败: %v", announcementID, err)
+		return
+	}
+
+	var message WSMessage
+	switch {
+	case announcement.Status == services.AnnouncementCancelled:
+		message = WSMessage{Type: "announcement", Action: AnnouncementActionWithdraw, Data: map[string]int64{"id": announcement.ID}}
+	case announcementService.Active(announcement):
+		message = WSMessage{Type: "announcement", Action: AnnouncementActionNew, Data: announcementService.Info(announcement, false)}
+	default:
+		return
+	}
+
+	online := Manager.GetOnlineUsers()
+	if len(online) == 0 {
+		return
+	}
+	recipients, err := announcementService.Recipients(ctx, announcement, online)
+	if err != nil {
+		log.Errorf("筛选公告 %d 的推送对象失败: %v", announcementID, err)
+		return
+	}
+	sent := 0
+	for _, userID := range recipients {
+		if Manager.sendLocal(userID, message) {
+			sent++
+		}
+	}
+	log.Infof("公告 %d 已推送给本实例 %d 个在线用户（%s）", announcementID, sent, message.Action)
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+)
+
+// CloseUnauthorized 认证失败的关闭码
+const CloseUnauthorized = 4001
+
+// tokenSubprotocolPrefix 通过Sec-WebSocket-Protocol携带Token时使用的前缀
+// 浏览器无法为WebSocket设置自定义请求头，客户端以 new WebSocket(url, ['gochat.v1', 'access_token.' + token]) 的方式传递，
+// 服务端只会回应协议版本子协议，不会回显Token
+const tokenSubprotocolPrefix = "access_token."
+
+// defaultAuthTimeout 等待首个auth消息的默认超时
+const defaultAuthTimeout = 5 * time.Second
+
+// 流票据：无法设置请求头的客户端（EventSource）先用JWT换取短期票据，再以?ticket=建立连接，避免JWT出现在URL和访问日志中
+const (
+	streamTicketPrefix     = "ws:ticket:" // ws:ticket:{票据} 票据对应的用户（String，只能使用一次）
+	defaultStreamTicketTTL = 30 * time.Second
+)
+
+// streamTicket 票据对应的用户
+type streamTicket struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// tokenFromSubprotocol 从Sec-WebSocket-Protocol中提取Token
+func tokenFromSubprotocol(r *http.Request) string {
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if strings.HasPrefix(protocol, tokenSubprotocolPrefix) {
+				return strings.TrimPrefix(protocol, tokenSubprotocolPrefix)
+			}
+		}
+	}
+	return ""
+}
+
+// authenticateFirstFrame 升级后等待客户端发送 {"type":"auth","data":{"token":"..."}} 完成认证
+func authenticateFirstFrame(conn *websocket.Conn, cfg *config.Config) (int64, string, error) {
+	timeout, err := time.ParseDuration(cfg.WebSocket.AuthTimeout)
+	if err != nil || timeout <= 0 {
+		timeout = defaultAuthTimeout
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var message WSMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		return 0, "", errors.New("auth message required")
+	}
+	if message.Type != "auth" {
+		return 0, "", errors.New("first message must be auth")
+	}
+
+	data, ok := message.Data.(map[string]interface{})
+	if !ok {
+		return 0, "", errors.New("token required")
+	}
+	tokenStr, _ := data["token"].(string)
+	if tokenStr == "" {
+		return 0, "", errors.New("token required")
+	}
+
+	return parseStreamToken(tokenStr, cfg)
+}
+
+// streamTicketTTL 票据有效期
+func streamTicketTTL(cfg *config.WebSocketConfig) time.Duration {
+	ttl, err := time.ParseDuration(cfg.StreamTicketTTL)
+	if err != nil || ttl <= 0 {
+		return defaultStreamTicketTTL
+	}
+	return ttl
+}
+
+// issueStreamTicket 为已认证的用户签发只能使用一次的流票据
+func issueStreamTicket(userID int64, username string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(buf)
+
+	data, err := json.Marshal(streamTicket{UserID: userID, Username: username})
+	if err != nil {
+		return "", err
+	}
+	if err := cache.GetRedisClient().Set(context.Background(), streamTicketPrefix+ticket, data, ttl).Err(); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// redeemStreamTicket 使用流票据，票据使用后立即失效
+func redeemStreamTicket(ticket string) (int64, string, error) {
+	data, err := cache.GetRedisClient().GetDel(context.Background(), streamTicketPrefix+ticket).Bytes()
+	if err == redis.Nil {
+		return 0, "", errors.New("invalid or expired ticket")
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	var t streamTicket
+	if err := json.Unmarshal(data, &t); err != nil {
+		return 0, "", errors.New("invalid ticket")
+	}
+	return t.UserID, t.Username, nil
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+func TestTokenFromSubprotocol(t *testing.T) {
+	req := httptest.NewRequest("GET", "/ws", nil)
+	assert.Equal(t, "", tokenFromSubprotocol(req))
+
+	req.Header.Set("Sec-WebSocket-Protocol", "gochat.v1, access_token.header.payload.sig")
+	assert.Equal(t, "header.payload.sig", tokenFromSubprotocol(req))
+
+	// Token不影响协议版本协商
+	version, err := negotiateProtocolVersion(req)
+	assert.NoError(t, err)
+	assert.Equal(t, ProtocolV1, version)
+}
+
+func TestStreamTicketSingleUse(t *testing.T) {
+	newTestManager(t)
+
+	ticket, err := issueStreamTicket(7, "alice", time.Minute)
+	require.NoError(t, err)
+
+	userID, username, err := redeemStreamTicket(ticket)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), userID)
+	assert.Equal(t, "alice", username)
+
+	// 票据只能使用一次
+	_, _, err = redeemStreamTicket(ticket)
+	assert.Error(t, err)
+}
+
+func TestAuthenticateEventsQueryToken(t *testing.T) {
+	newTestManager(t)
+	cfg := &config.Config{}
+
+	// 与WebSocket相同，未开启allow_query_token时拒绝?token=
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/v1/events?token=header.payload.sig", nil)
+	_, _, ok := authenticateEvents(c, cfg)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "query token authentication is disabled")
+
+	ticket, err := issueStreamTicket(7, "alice", time.Minute)
+	require.NoError(t, err)
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/v1/events?ticket="+ticket, nil)
+	userID, _, ok := authenticateEvents(c, cfg)
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), userID)
+}
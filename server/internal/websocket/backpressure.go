@@ -0,0 +1,236 @@
+package websocket
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/logger"
+)
+
+// 慢客户端关闭码
+const CloseSlowConsumer = 4008
+
+// frameClass 出站消息的优先级分类，决定发送缓冲区满时的处理策略
+type frameClass int
+
+const (
+	frameCritical  frameClass = iota // 聊天、系统、错误等消息，缓冲区满时计入慢客户端判定
+	frameDroppable                   // 心跳、输入状态等，缓冲区满时直接丢弃
+	framePresence                    // 在线状态，缓冲区满时按用户合并只保留最新一条
+)
+
+// outboundFrame 待发送的消息帧
+type outboundFrame struct {
+	data  []byte
+	seq   int64 // 投递序号，0表示不参与断线补推去重
+	class frameClass
+}
+
+// ClientStats 单个连接的背压统计
+type ClientStats struct {
+	ClientID        string `json:"client_id"`
+	UserID          int64  `json:"user_id"`
+	Queued          int    `json:"queued"`
+	DroppedFrames   int64  `json:"dropped_frames"`
+	CoalescedFrames int64  `json:"coalesced_frames"`
+}
+
+// classifyMessage 根据消息类型确定分类，在线状态消息同时返回合并键（状态所属用户ID）
+func classifyMessage(message interface{}) (frameClass, int64) {
+	wsMsg, ok := message.(WSMessage)
+	if !ok {
+		return frameCritical, 0
+	}
+
+	switch wsMsg.Type {
+	case "ping", "pong", "typing":
+		return frameDroppable, 0
+	case "status":
+		if data, ok := wsMsg.Data.(gin.H); ok {
+			if userID, ok := data["user_id"].(int64); ok {
+				return framePresence, userID
+			}
+		}
+		return frameDroppable, 0
+	default:
+		return frameCritical, 0
+	}
+}
+
+// enqueue 将消息帧放入连接的发送缓冲区，不阻塞调用方
+// 缓冲区满时按分类处理：丢弃非关键消息、合并在线状态、关键消息返回失败并判定是否为慢客户端
+func (cm *ConnectionManager) enqueue(client *ClientInfo, frame outboundFrame, presenceKey int64) bool {
+	select {
+	case <-client.done:
+		return false
+	default:
+	}
+
+	select {
+	case client.send <- frame:
+		client.fullSince.Store(0)
+		return true
+	default:
+	}
+
+	// 发送缓冲区已满
+	switch frame.class {
+	case framePresence:
+		client.presenceMutex.Lock()
+		if _, exists := client.pendingPresence[presenceKey]; exists {
+			atomic.AddInt64(&client.coalescedFrames, 1)
+		}
+		client.pendingPresence[presenceKey] = frame
+		client.presenceMutex.Unlock()
+		cm.checkSlowClient(client)
+		return true
+	case frameDroppable:
+		atomic.AddInt64(&client.droppedFrames, 1)
+		droppedFrames.Inc()
+		cm.checkSlowClient(client)
+		return false
+	default:
+		atomic.AddInt64(&client.droppedFrames, 1)
+		droppedFrames.Inc()
+		sendFailures.Inc()
+		logger.GetLogger().Debugf("用户 %d 连接 %s 发送缓冲区已满，消息未发送", client.UserID, client.ID)
+		cm.checkSlowClient(client)
+		return false
+	}
+}
+
+// checkSlowClient 缓冲区持续满载超过阈值或丢弃帧数过多时断开连接
+func (cm *ConnectionManager) checkSlowClient(client *ClientInfo) {
+	now := time.Now().UnixNano()
+	client.fullSince.CompareAndSwap(0, now)
+
+	fullFor := time.Duration(now - client.fullSince.Load())
+	dropped := atomic.LoadInt64(&client.droppedFrames)
+	if fullFor < cm.slowClientTimeout && (cm.maxDroppedFrames <= 0 || dropped < int64(cm.maxDroppedFrames)) {
+		return
+	}
+
+	reason := fmt.Sprintf("slow consumer: send buffer full for %v, %d frames dropped", fullFor.Round(time.Millisecond), dropped)
+	logger.GetLogger().Warnf("断开慢客户端: 用户 %d，连接 %s，%s", client.UserID, client.ID, reason)
+	cm.closeClient(client, CloseSlowConsumer, reason)
+}
+
+// closeClient 发送关闭帧后断开连接并注销
+func (cm *ConnectionManager) closeClient(client *ClientInfo, code int, reason string) {
+	client.Transport.WriteClose(code, reason)
+	client.Transport.Close()
+	cm.RemoveClient(client)
+}
+
+// writePump 串行地将发送缓冲区中的消息写入连接，并定期发送ping控制帧
+// 断线补推完成（startDelivery）之前不写入，实时消息暂存在发送缓冲区中
+func (cm *ConnectionManager) writePump(client *ClientInfo) {
+	labelGoroutine("ws_write_pump", client.UserID)
+	select {
+	case <-client.ready:
+	case <-client.done:
+		return
+	}
+
+	ticker := time.NewTicker(cm.pingPeriod())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-ticker.C:
+			if !cm.writePing(client) {
+				return
+			}
+		case frame := <-client.send:
+			if !cm.writeFrame(client, frame) {
+				return
+			}
+			// 缓冲区清空后补发合并的在线状态
+			if len(client.send) == 0 && !cm.flushPresence(client) {
+				return
+			}
+		}
+	}
+}
+
+// writeFrame 写入单个消息帧，写入失败时注销连接
+func (cm *ConnectionManager) writeFrame(client *ClientInfo, frame outboundFrame) bool {
+	client.WriteMutex.Lock()
+
+	if client.Closed {
+		client.WriteMutex.Unlock()
+		return false
+	}
+
+	// 已通过断线补推送达的消息不再重复推送
+	if frame.seq > 0 && frame.seq <= client.LastSeq {
+		client.WriteMutex.Unlock()
+		return true
+	}
+
+	if cm.writeWait > 0 {
+		client.Transport.SetWriteDeadline(time.Now().Add(cm.writeWait))
+	}
+	err := cm.writeLocked(client, frame.data)
+	client.WriteMutex.Unlock()
+
+	if err != nil {
+		sendFailures.Inc()
+		logger.GetLogger().Warnf("发送消息失败: %v", err)
+		client.Transport.Close()
+		cm.RemoveClient(client) // 连接断开，移除客户端
+		return false
+	}
+	messagesOut.Inc()
+	return true
+}
+
+// flushPresence 写入缓冲区满期间合并的在线状态消息
+func (cm *ConnectionManager) flushPresence(client *ClientInfo) bool {
+	client.presenceMutex.Lock()
+	if len(client.pendingPresence) == 0 {
+		client.presenceMutex.Unlock()
+		return true
+	}
+	frames := make([]outboundFrame, 0, len(client.pendingPresence))
+	for key, frame := range client.pendingPresence {
+		frames = append(frames, frame)
+		delete(client.pendingPresence, key)
+	}
+	client.presenceMutex.Unlock()
+
+	for _, frame := range frames {
+		if !cm.writeFrame(client, frame) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetClientStats 获取所有连接的背压统计
+func (cm *ConnectionManager) GetClientStats() []ClientStats {
+	var stats []ClientStats
+	cm.clients.Range(func(k, v interface{}) bool {
+		for _, client := range v.(map[string]*ClientInfo) {
+			stats = append(stats, client.Stats())
+		}
+		return true
+	})
+	return stats
+}
+
+// Stats 获取连接的背压统计
+func (client *ClientInfo) Stats() ClientStats {
+	return ClientStats{
+		ClientID:        client.ID,
+		UserID:          client.UserID,
+		Queued:          len(client.send),
+		DroppedFrames:   atomic.LoadInt64(&client.droppedFrames),
+		CoalescedFrames: atomic.LoadInt64(&client.coalescedFrames),
+	}
+}
@@ -0,0 +1,360 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+	"gochat/internal/services"
+)
+
+// 通话信令动作（type为call）
+// 客户端发送：invite（主叫携带SDP offer发起呼叫）、answer（被叫携带SDP answer接听）、candidate（交换ICE候选）、reject（被叫拒接）、hangup（挂断，接通前由主叫发出即取消）
+// 服务端推送：ringing（呼叫已送达被叫，返回call_id）、invite/answer/candidate（转发对方的信令）、ended（通话结束）
+const (
+	callActionInvite    = "invite"
+	callActionAnswer    = "answer"
+	callActionCandidate = "candidate"
+	callActionReject    = "reject"
+	callActionHangup    = "hangup"
+	callActionRinging   = "ringing"
+	callActionEnded     = "ended"
+)
+
+// callReasonAnsweredElsewhere 被叫在其他设备上接听，通知其余振铃的设备停止振铃
+const callReasonAnsweredElsewhere = "answered_elsewhere"
+
+// defaultCallRingTimeout 默认振铃超时
+const defaultCallRingTimeout = 45 * time.Second
+
+// callData 通话信令数据
+type callData struct {
+	CallID    int64           `json:"call_id,omitempty"`
+	ToUserID  int64           `json:"to_user_id,omitempty"` // invite：被叫用户ID
+	Media     string          `json:"media,omitempty"`      // invite：audio/video
+	SDP       string          `json:"sdp,omitempty"`        // invite/answer：会话描述
+	Candidate json.RawMessage `json:"candidate,omitempty"`  // candidate：RTCIceCandidateInit，服务端原样转发
+}
+
+// callSession 进行中的通话
+// 主叫固定为发起呼叫的连接；被叫振铃期间所有设备都会收到呼叫，接听后固定为接听的设备
+type callSession struct {
+	call   *models.Call
+	caller *ClientInfo
+	callee *ClientInfo // 接听的设备，振铃期间为nil
+	timer  *time.Timer // 振铃超时
+}
+
+// callRegistry 本实例上进行中的通话，每个用户同时只能参与一个通话
+// 通话信令只在本实例的连接之间转发，被叫在本实例没有连接时按不在线处理
+type callRegistry struct {
+	mutex       sync.Mutex
+	calls       map[int64]*callSession // call_id -> 通话
+	users       map[int64]int64        // user_id -> call_id，发起呼叫期间为0
+	ringTimeout time.Duration
+}
+
+func newCallRegistry(cfg *config.WebSocketConfig) *callRegistry {
+	ringTimeout, err := time.ParseDuration(cfg.CallRingTimeout)
+	if err != nil || ringTimeout <= 0 {
+		ringTimeout = defaultCallRingTimeout
+	}
+	return &callRegistry{
+		calls:       make(map[int64]*callSession),
+		users:       make(map[int64]int64),
+		ringTimeout: ringTimeout,
+	}
+}
+
+// 处理通话信令
+func handleCallMessage(client *ClientInfo, message *WSMessage) {
+	ctx := logger.WithRequestID(context.Background(), logger.NewRequestID())
+	if Manager.calls == nil {
+		sendError(ctx, client, message.MsgID, "calls are not available")
+		return
+	}
+
+	var data callData
+	raw, err := json.Marshal(message.Data)
+	if err == nil {
+		err = json.Unmarshal(raw, &data)
+	}
+	if err != nil {
+		sendError(ctx, client, message.MsgID, "invalid call data")
+		return
+	}
+
+	switch message.Action {
+	case callActionInvite:
+		Manager.calls.invite(ctx, client, message.MsgID, &data)
+	case callActionAnswer:
+		Manager.calls.answer(ctx, client, message.MsgID, &data)
+	case callActionCandidate:
+		Manager.calls.relayCandidate(ctx, client, message.MsgID, &data)
+	case callActionReject, callActionHangup:
+		Manager.calls.hangup(ctx, client, message.MsgID, &data)
+	default:
+		sendError(ctx, client, message.MsgID, "unknown call action")
+	}
+}
+
+// invite 发起呼叫：主叫或被叫已在通话中时分别返回错误和占线，被叫不在线时记为未接来电
+func (r *callRegistry) invite(ctx context.Context, client *ClientInfo, msgID string, data *callData) {
+	if !Manager.CheckRateLimit(client.UserID) {
+		sendError(ctx, client, msgID, "rate limit exceeded")
+		return
+	}
+	if data.ToUserID <= 0 || data.SDP == "" {
+		sendError(ctx, client, msgID, "to_user_id and sdp are required")
+		return
+	}
+
+	// 先占用主叫，避免同一用户从多个设备同时发起呼叫
+	r.mutex.Lock()
+	if _, inCall := r.users[client.UserID]; inCall {
+		r.mutex.Unlock()
+		sendError(ctx, client, msgID, "already in a call")
+		return
+	}
+	r.users[client.UserID] = 0
+	r.mutex.Unlock()
+
+	callService := services.NewCallService()
+	call, err := callService.StartCall(ctx, client.UserID, data.ToUserID, data.Media)
+	if err != nil {
+		r.mutex.Lock()
+		delete(r.users, client.UserID)
+		r.mutex.Unlock()
+		switch {
+		case errors.Is(err, services.ErrInvalidCallMedia), errors.Is(err, services.ErrCallSelf),
+			errors.Is(err, services.ErrCallNotFriend), errors.Is(err, services.ErrUserNotFound):
+			sendError(ctx, client, msgID, err.Error())
+		default:
+			logger.WithContext(ctx).Errorf("用户 %d 发起通话失败: %v", client.UserID, err)
+			sendError(ctx, client, msgID, "start call failed")
+		}
+		return
+	}
+
+	r.mutex.Lock()
+	_, busy := r.users[call.CalleeID]
+	if busy {
+		delete(r.users, client.UserID)
+		r.mutex.Unlock()
+		r.endCall(ctx, &callSession{call: call, caller: client}, services.CallStatusBusy, "", msgID)
+		return
+	}
+	session := &callSession{call: call, caller: client}
+	r.calls[call.ID] = session
+	r.users[call.CallerID] = call.ID
+	r.users[call.CalleeID] = call.ID
+	session.timer = time.AfterFunc(r.ringTimeout, func() {
+		if s := r.remove(call.ID, true); s != nil {
+			r.endCall(context.Background(), s, services.CallStatusMissed, services.CallReasonTimeout, "")
+		}
+	})
+	r.mutex.Unlock()
+
+	delivered := Manager.SendToUser(call.CalleeID, WSMessage{
+		Type:   "call",
+		Action: callActionInvite,
+		Data: gin.H{
+			"call_id":      call.ID,
+			"from_user_id": call.CallerID,
+			"media":        call.Media,
+			"sdp":          data.SDP,
+		},
+	})
+	if !delivered {
+		if s := r.remove(call.ID, true); s != nil {
+			r.endCall(ctx, s, services.CallStatusMissed, services.CallReasonOffline, msgID)
+		}
+		return
+	}
+	Manager.SendToClient(client, WSMessage{
+		Type:   "call",
+		Action: callActionRinging,
+		MsgID:  msgID,
+		Data:   gin.H{"call_id": call.ID, "to_user_id": call.CalleeID, "media": call.Media},
+	})
+}
+
+// answer 被叫接听，把SDP answer转发给主叫，并通知被叫其余设备停止振铃
+func (r *callRegistry) answer(ctx context.Context, client *ClientInfo, msgID string, data *callData) {
+	if data.SDP == "" {
+		sendError(ctx, client, msgID, "sdp is required")
+		return
+	}
+	r.mutex.Lock()
+	session, ok := r.calls[data.CallID]
+	if !ok || session.call.CalleeID != client.UserID || session.callee != nil {
+		r.mutex.Unlock()
+		sendError(ctx, client, msgID, "call not found")
+		return
+	}
+	session.callee = client
+	session.timer.Stop()
+	r.mutex.Unlock()
+
+	if err := services.NewCallService().AnswerCall(ctx, session.call.ID); err != nil {
+		logger.WithContext(ctx).Warnf("记录通话 %d 接听失败: %v", session.call.ID, err)
+	}
+
+	Manager.SendToClient(session.caller, WSMessage{
+		Type:   "call",
+		Action: callActionAnswer,
+		Data:   gin.H{"call_id": session.call.ID, "sdp": data.SDP},
+	})
+	for _, other := range Manager.GetClients(client.UserID) {
+		if other != client {
+			Manager.SendToClient(other, callEndedMessage(session.call.ID, services.CallStatusActive, callReasonAnsweredElsewhere, ""))
+		}
+	}
+}
+
+// relayCandidate 把ICE候选转发给通话的另一方，被叫接听前主叫的候选发给被叫的所有设备
+func (r *callRegistry) relayCandidate(ctx context.Context, client *ClientInfo, msgID string, data *callData) {
+	if len(data.Candidate) == 0 {
+		sendError(ctx, client, msgID, "candidate is required")
+		return
+	}
+	r.mutex.Lock()
+	session, ok := r.calls[data.CallID]
+	var caller, callee *ClientInfo
+	if ok {
+		caller, callee = session.caller, session.callee
+	}
+	r.mutex.Unlock()
+
+	message := WSMessage{
+		Type:   "call",
+		Action: callActionCandidate,
+		Data:   gin.H{"call_id": data.CallID, "candidate": data.Candidate},
+	}
+	switch {
+	case ok && client == caller && callee != nil:
+		Manager.SendToClient(callee, message)
+	case ok && client == caller:
+		Manager.SendToUser(session.call.CalleeID, message)
+	case ok && client == callee:
+		Manager.SendToClient(caller, message)
+	default:
+		sendError(ctx, client, msgID, "call not found")
+	}
+}
+
+// hangup 挂断或拒接：接通前主叫挂断为取消，被叫挂断为拒接；接通后任一方挂断为结束
+func (r *callRegistry) hangup(ctx context.Context, client *ClientInfo, msgID string, data *callData) {
+	r.mutex.Lock()
+	session, ok := r.calls[data.CallID]
+	var status string
+	switch {
+	case !ok:
+	case session.callee == nil && client == session.caller:
+		status = services.CallStatusCanceled
+	case session.callee == nil && client.UserID == session.call.CalleeID:
+		status = services.CallStatusRejected
+	case session.callee != nil && (client == session.caller || client == session.callee):
+		status = services.CallStatusEnded
+	}
+	if status == "" {
+		r.mutex.Unlock()
+		sendError(ctx, client, msgID, "call not found")
+		return
+	}
+	r.removeLocked(session)
+	r.mutex.Unlock()
+
+	reason := ""
+	if status == services.CallStatusEnded {
+		reason = services.CallReasonHangup
+	}
+	r.endCall(ctx, session, status, reason, "")
+}
+
+// clientGone 连接断开时结束其参与的通话；振铃中的被叫只在最后一个设备断开时记为未接来电
+func (r *callRegistry) clientGone(client *ClientInfo) {
+	r.mutex.Lock()
+	session, ok := r.calls[r.users[client.UserID]]
+	var status, reason string
+	switch {
+	case !ok:
+	case client == session.caller && session.callee == nil:
+		status, reason = services.CallStatusCanceled, services.CallReasonDisconnected
+	case client == session.caller || client == session.callee:
+		status, reason = services.CallStatusEnded, services.CallReasonDisconnected
+	case session.callee == nil && client.UserID == session.call.CalleeID && !Manager.IsOnline(client.UserID):
+		status, reason = services.CallStatusMissed, services.CallReasonOffline
+	}
+	if status == "" {
+		r.mutex.Unlock()
+		return
+	}
+	r.removeLocked(session)
+	r.mutex.Unlock()
+
+	r.endCall(context.Background(), session, status, reason, "")
+}
+
+// remove 移除通话，ringing为true时只移除还在振铃的通话；通话已被移除时返回nil
+func (r *callRegistry) remove(callID int64, ringing bool) *callSession {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	session, ok := r.calls[callID]
+	if !ok || (ringing && session.callee != nil) {
+		return nil
+	}
+	r.removeLocked(session)
+	return session
+}
+
+// removeLocked 移除通话并释放双方，调用方需持有mutex
+func (r *callRegistry) removeLocked(session *callSession) {
+	if session.timer != nil {
+		session.timer.Stop()
+	}
+	delete(r.calls, session.call.ID)
+	for _, userID := range []int64{session.call.CallerID, session.call.CalleeID} {
+		if r.users[userID] == session.call.ID {
+			delete(r.users, userID)
+		}
+	}
+}
+
+// endCall 记录通话结束并通知双方，msgID为触发结束的主叫呼叫请求ID（占线、不在线时回执给主叫）
+func (r *callRegistry) endCall(ctx context.Context, session *callSession, status, reason, msgID string) {
+	if _, err := services.NewCallService().EndCall(ctx, session.call.ID, status, reason); err != nil {
+		logger.WithContext(ctx).Warnf("记录通话 %d 结束失败: %v", session.call.ID, err)
+	}
+
+	Manager.SendToClient(session.caller, callEndedMessage(session.call.ID, status, reason, msgID))
+	ended := callEndedMessage(session.call.ID, status, reason, "")
+	switch {
+	case session.callee != nil:
+		Manager.SendToClient(session.callee, ended)
+	case status != services.CallStatusBusy:
+		// 振铃中的所有设备停止振铃；占线时被叫没有收到呼叫，只会收到未接来电消息
+		Manager.SendToUser(session.call.CalleeID, ended)
+	}
+}
+
+// callEndedMessage 通话结束通知
+func callEndedMessage(callID int64, status, reason, msgID string) WSMessage {
+	data := gin.H{"call_id": callID, "status": status}
+	if reason != "" {
+		data["reason"] = reason
+	}
+	return WSMessage{
+		Type:   "call",
+		Action: callActionEnded,
+		MsgID:  msgID,
+		Data:   data,
+	}
+}
@@ -0,0 +1,387 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+)
+
+// 网关/业务处理拆分部署
+// gateway角色只维持连接：客户端发来的聊天消息按发送者ID分片写入Redis列表，由worker角色的进程保存、确定接收者并扇出；
+// 推送经各网关的pub/sub频道送达，用户有连接的网关记录在Redis中。投递记录和离线队列本来就保存在Redis中，所有进程共享。
+const (
+	RoleAll     = "all"
+	RoleGateway = "gateway"
+	RoleWorker  = "worker"
+)
+
+const (
+	inboundQueuePrefix   = "ws:inbound:" // ws:inbound:3 转发给worker的聊天消息（LIST），按发送者ID分片
+	routesPrefix         = "ws:routes:"  // ws:routes:123 用户有连接的网关（SET）
+	gatewayChannelPrefix = "ws:gateway:" // ws:gateway:{id} 发往网关的推送（pub/sub）
+
+	// routesTTL 路由记录的过期时间，网关定期续期，进程崩溃后遗留的记录到期清除
+	routesTTL = 10 * time.Minute
+	// inboundLockTTL worker持有分片锁的过期时间，持有期间自动续期
+	inboundLockTTL = 15 * time.Second
+	// inboundPollTimeout 等待转发消息的阻塞时长
+	inboundPollTimeout = time.Second
+)
+
+// 网关推送类型
+const (
+	pushToClient = "client"  // 推送到指定连接（ACK、错误回执）
+	pushToUser   = "user"    // 推送到用户的所有连接，不跟踪ACK
+	pushDeliver  = "deliver" // 可靠投递，由网关的投递队列跟踪ACK，超时转入离线队列
+)
+
+// gatewayPush 发往网关的推送
+type gatewayPush struct {
+	Kind     string    `json:"kind"`
+	UserID   int64     `json:"user_id"`
+	ClientID string    `json:"client_id,omitempty"`
+	Message  WSMessage `json:"message"`
+}
+
+// inboundMessage 网关转发给worker的聊天消息，带上发送连接的信息，worker据此把回执送回原连接
+type inboundMessage struct {
+	Gateway         string    `json:"gateway"`
+	ClientID        string    `json:"client_id"`
+	UserID          int64     `json:"user_id"`
+	Username        string    `json:"username"`
+	IP              string    `json:"ip"`
+	ProtocolVersion int       `json:"protocol_version"`
+	Message         WSMessage `json:"message"`
+}
+
+// clusterBridge 拆分部署时进程之间的消息通道
+type clusterBridge struct {
+	role   string
+	id     string // 网关标识，每次启动随机生成
+	shards int
+	lease  time.Duration
+	client *redis.Client
+}
+
+func newClusterBridge(cfg *config.ClusterConfig, client *redis.Client) *clusterBridge {
+	id := make([]byte, 8)
+	rand.Read(id)
+	lease, err := time.ParseDuration(cfg.ShardLease)
+	if err != nil || lease <= 0 {
+		lease = 30 * time.Second
+	}
+	shards := cfg.InboundShards
+	if shards <= 0 {
+		shards = 32
+	}
+	return &clusterBridge{
+		role:   cfg.Role,
+		id:     hex.EncodeToString(id),
+		shards: shards,
+		lease:  lease,
+		client: client,
+	}
+}
+
+// StartCluster 按部署角色启动进程之间的消息通道，返回的函数停止通道并等待正在处理的消息完成；all角色不需要
+// gateway订阅发往本网关的推送；worker消费转发队列，并初始化投递记录、投递队列和扇出工作池
+func StartCluster(cfg *config.Config) (stop func()) {
+	if cfg.Cluster.Role != RoleGateway && cfg.Cluster.Role != RoleWorker {
+		return func() {}
+	}
+	bridge := newClusterBridge(&cfg.Cluster, cache.GetRedisClient())
+	Manager.cluster = bridge
+	Manager.Configure(&cfg.WebSocket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	stop = func() {
+		cancel()
+		wg.Wait()
+	}
+	if bridge.role == RoleGateway {
+		bridge.subscribe(ctx, &wg)
+		logger.GetLogger().Infof("以gateway角色运行（%s），聊天消息转发给worker处理", bridge.id)
+		return stop
+	}
+	for shard := 0; shard < bridge.shards; shard++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			bridge.consumeShard(ctx, shard)
+		}(shard)
+	}
+	logger.GetLogger().Infof("以worker角色运行，消费 %d 个转发队列分片", bridge.shards)
+	return stop
+}
+
+// inboundQueue 发送者对应的转发队列
+func (b *clusterBridge) inboundQueue(userID int64) string {
+	return inboundQueuePrefix + strconv.Itoa(int(uint64(userID)%uint64(b.shards)))
+}
+
+// forwardInbound 网关把客户端发来的聊天消息转发给worker
+func (b *clusterBridge) forwardInbound(client *ClientInfo, message *WSMessage) error {
+	data, err := json.Marshal(inboundMessage{
+		Gateway:         b.id,
+		ClientID:        client.ID,
+		UserID:          client.UserID,
+		Username:        client.Username,
+		IP:              client.IP,
+		ProtocolVersion: client.ProtocolVersion,
+		Message:         *message,
+	})
+	if err != nil {
+		return err
+	}
+	return b.client.LPush(context.Background(), b.inboundQueue(client.UserID), data).Err()
+}
+
+// consumeShard worker消费一个分片：持有分片锁时按顺序处理，保证同一用户的消息顺序与发送顺序一致
+// 持有lease后释放锁，随机等待后重新竞争，分片在worker之间轮换
+func (b *clusterBridge) consumeShard(ctx context.Context, shard int) {
+	labelGoroutine("ws_inbound_worker", 0)
+	queue := inboundQueuePrefix + strconv.Itoa(shard)
+	for ctx.Err() == nil {
+		err := cache.WithLock(ctx, queue, inboundLockTTL, func(ctx context.Context) error {
+			return b.drain(ctx, queue, time.Now().Add(b.lease))
+		})
+		if err != nil && !errors.Is(err, cache.ErrLockNotAcquired) && ctx.Err() == nil {
+			logger.GetLogger().Warnf("消费转发队列 %s 失败: %v", queue, err)
+		}
+		jitter, _ := rand.Int(rand.Reader, big.NewInt(int64(time.Second)))
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(jitter.Int64())):
+		}
+	}
+}
+
+// drain 依次处理分片中的消息，直到until或ctx取消
+func (b *clusterBridge) drain(ctx context.Context, queue string, until time.Time) error {
+	for time.Now().Before(until) {
+		result, err := b.client.BRPop(ctx, inboundPollTimeout, queue).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		b.handleInbound(result[1])
+	}
+	return nil
+}
+
+// handleInbound 处理转发的聊天消息，与单进程部署走同一流程，回执经网关送回原连接
+func (b *clusterBridge) handleInbound(payload string) {
+	var inbound inboundMessage
+	if err := json.Unmarshal([]byte(payload), &inbound); err != nil {
+		logger.GetLogger().Errorf("转发的聊天消息无效: %v", err)
+		return
+	}
+	client := &ClientInfo{
+		ID:              inbound.ClientID,
+		UserID:          inbound.UserID,
+		Username:        inbound.Username,
+		IP:              inbound.IP,
+		ProtocolVersion: inbound.ProtocolVersion,
+		gateway:         inbound.Gateway,
+	}
+	handleChatMessage(client, &inbound.Message)
+}
+
+// subscribe 网关订阅发往本网关的推送
+func (b *clusterBridge) subscribe(ctx context.Context, wg *sync.WaitGroup) {
+	pubsub := b.client.Subscribe(ctx, gatewayChannelPrefix+b.id)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		labelGoroutine("ws_gateway_subscriber", 0)
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				b.handlePush(msg.Payload)
+			}
+		}
+	}()
+}
+
+// handlePush 网关把推送交给本实例上的连接
+func (b *clusterBridge) handlePush(payload string) {
+	var push gatewayPush
+	if err := json.Unmarshal([]byte(payload), &push); err != nil {
+		logger.GetLogger().Errorf("网关推送无效: %v", err)
+		return
+	}
+	message := push.Message
+	// 在线状态按所属用户ID合并，恢复classifyMessage需要的类型
+	if data, ok := message.Data.(map[string]interface{}); ok && message.Type == "status" {
+		if userID, ok := data["user_id"].(float64); ok {
+			data["user_id"] = int64(userID)
+			message.Data = gin.H(data)
+		}
+	}
+
+	switch push.Kind {
+	case pushToClient:
+		for _, client := range Manager.GetClients(push.UserID) {
+			if client.ID == push.ClientID {
+				Manager.SendToClient(client, message)
+			}
+		}
+	case pushToUser:
+		Manager.sendLocal(push.UserID, message)
+	case pushDeliver:
+		Manager.queue.Send(push.UserID, message)
+	}
+}
+
+// publish 发布推送到指定网关，网关已经退出（没有订阅者）时返回false
+func (b *clusterBridge) publish(gateway string, push gatewayPush) bool {
+	data, err := json.Marshal(push)
+	if err != nil {
+		logger.GetLogger().Errorf("序列化网关推送失败: %v", err)
+		return false
+	}
+	receivers, err := b.client.Publish(context.Background(), gatewayChannelPrefix+gateway, data).Result()
+	if err != nil {
+		logger.GetLogger().Warnf("发布到网关 %s 失败: %v", gateway, err)
+		return false
+	}
+	if receivers == 0 {
+		// 网关已经退出，清除遗留的路由记录
+		b.client.SRem(context.Background(), routesPrefix+strconv.FormatInt(push.UserID, 10), gateway)
+		return false
+	}
+	return true
+}
+
+// forward 把推送发给用户有连接的其他网关，任一网关收到即返回true
+func (b *clusterBridge) forward(userID int64, kind string, message interface{}) bool {
+	wsMsg, ok := message.(WSMessage)
+	if !ok {
+		// 推送给客户端的消息都是WSMessage，其他类型先转换
+		data, err := json.Marshal(message)
+		if err != nil || json.Unmarshal(data, &wsMsg) != nil {
+			return false
+		}
+	}
+
+	ctx := context.Background()
+	key := routesPrefix + strconv.FormatInt(userID, 10)
+	gateways, err := b.client.SMembers(ctx, key).Result()
+	if err != nil {
+		logger.GetLogger().Warnf("查询用户 %d 的网关失败: %v", userID, err)
+		return false
+	}
+	sent := false
+	for _, gateway := range gateways {
+		if gateway == b.id {
+			continue
+		}
+		if b.publish(gateway, gatewayPush{Kind: kind, UserID: userID, Message: wsMsg}) {
+			sent = true
+		}
+	}
+	return sent
+}
+
+// forwardToClient 把回执推送到连接所在的网关
+func (b *clusterBridge) forwardToClient(client *ClientInfo, message interface{}) bool {
+	wsMsg, ok := message.(WSMessage)
+	if !ok {
+		return false
+	}
+	return b.publish(client.gateway, gatewayPush{Kind: pushToClient, UserID: client.UserID, ClientID: client.ID, Message: wsMsg})
+}
+
+// join 记录用户在本网关上有连接
+func (b *clusterBridge) join(userID int64) {
+	b.refresh([]int64{userID})
+}
+
+// leave 用户在本网关上的连接全部断开，返回用户仍有连接的其他网关数
+func (b *clusterBridge) leave(userID int64) int64 {
+	ctx := context.Background()
+	key := routesPrefix + strconv.FormatInt(userID, 10)
+	pipe := b.client.TxPipeline()
+	pipe.SRem(ctx, key, b.id)
+	card := pipe.SCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.GetLogger().Warnf("移除用户 %d 的网关记录失败: %v", userID, err)
+		return 0
+	}
+	return card.Val()
+}
+
+// refresh 写入并续期本网关上在线用户的路由记录
+func (b *clusterBridge) refresh(userIDs []int64) {
+	ctx := context.Background()
+	pipe := b.client.Pipeline()
+	for i, userID := range userIDs {
+		key := routesPrefix + strconv.FormatInt(userID, 10)
+		pipe.SAdd(ctx, key, b.id)
+		pipe.Expire(ctx, key, routesTTL)
+		if (i+1)%500 == 0 || i == len(userIDs)-1 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				logger.GetLogger().Warnf("续期网关路由记录失败: %v", err)
+			}
+		}
+	}
+}
+
+// RoutedUsers 读取拆分部署时各网关上有连接的用户，值为用户有连接的网关；limit大于0时最多返回limit个用户
+// 供进程外的运维工具查看在线用户，单进程部署时没有路由记录，返回空
+func RoutedUsers(ctx context.Context, client *redis.Client, limit int) (map[int64][]string, error) {
+	users := make(map[int64][]string)
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, routesPrefix+"*", 500).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			userID, err := strconv.ParseInt(key[len(routesPrefix):], 10, 64)
+			if err != nil {
+				continue
+			}
+			gateways, err := client.SMembers(ctx, key).Result()
+			if err != nil {
+				return nil, err
+			}
+			if len(gateways) == 0 {
+				continue
+			}
+			users[userID] = gateways
+			if limit > 0 && len(users) >= limit {
+				return users, nil
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return users, nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/config"
+)
+
+func newTestBridges(t *testing.T, role string, n int) (*redis.Client, []*clusterBridge) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	bridges := make([]*clusterBridge, n)
+	for i := range bridges {
+		bridges[i] = newClusterBridge(&config.ClusterConfig{Role: role, InboundShards: 4, ShardLease: "30s"}, client)
+	}
+	return client, bridges
+}
+
+func TestClusterRoutes(t *testing.T) {
+	client, bridges := newTestBridges(t, RoleGateway, 2)
+	a, b := bridges[0], bridges[1]
+
+	a.join(7)
+	b.join(7)
+	members, err := client.SMembers(context.Background(), "ws:routes:7").Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{a.id, b.id}, members)
+
+	// 用户在另一个网关上仍有连接时不算下线
+	assert.Equal(t, int64(1), b.leave(7))
+	assert.Equal(t, int64(0), a.leave(7))
+}
+
+func TestRoutedUsers(t *testing.T) {
+	client, bridges := newTestBridges(t, RoleGateway, 2)
+	a, b := bridges[0], bridges[1]
+	ctx := context.Background()
+
+	a.refresh([]int64{7, 8})
+	b.join(7)
+	users, err := RoutedUsers(ctx, client, 0)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.ElementsMatch(t, []string{a.id, b.id}, users[7])
+	assert.Equal(t, []string{a.id}, users[8])
+
+	users, err = RoutedUsers(ctx, client, 1)
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestClusterForwardToGateway(t *testing.T) {
+	client, bridges := newTestBridges(t, RoleGateway, 2)
+	a, b := bridges[0], bridges[1]
+	ctx := context.Background()
+
+	pubsub := client.Subscribe(ctx, gatewayChannelPrefix+a.id)
+	defer pubsub.Close()
+	_, err := pubsub.Receive(ctx)
+	require.NoError(t, err)
+
+	// 用户只连接在本网关上时不需要转发
+	b.join(7)
+	assert.False(t, b.forward(7, pushToUser, WSMessage{Type: "status", Action: "online_status"}))
+
+	a.join(7)
+	assert.True(t, b.forward(7, pushDeliver, WSMessage{Type: "chat", Action: "receive", Seq: 3}))
+	select {
+	case msg := <-pubsub.Channel():
+		var push gatewayPush
+		require.NoError(t, json.Unmarshal([]byte(msg.Payload), &push))
+		assert.Equal(t, pushDeliver, push.Kind)
+		assert.Equal(t, int64(7), push.UserID)
+		assert.Equal(t, int64(3), push.Message.Seq)
+	case <-time.After(time.Second):
+		t.Fatal("push not received")
+	}
+}
+
+func TestClusterForwardDropsStaleGateway(t *testing.T) {
+	client, bridges := newTestBridges(t, RoleWorker, 1)
+	ctx := context.Background()
+	require.NoError(t, client.SAdd(ctx, "ws:routes:7", "gone").Err())
+
+	// 网关已经退出（没有订阅者），推送失败并清除路由记录
+	assert.False(t, bridges[0].forward(7, pushToUser, WSMessage{Type: "chat"}))
+	exists, err := client.Exists(ctx, "ws:routes:7").Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists)
+}
+
+func TestClusterForwardInbound(t *testing.T) {
+	client, bridges := newTestBridges(t, RoleGateway, 1)
+	gateway := bridges[0]
+	ctx := context.Background()
+
+	sender := &ClientInfo{ID: "client_1", UserID: 6, Username: "alice", ProtocolVersion: ProtocolV1}
+	for _, content := range []string{"first", "second"} {
+		require.NoError(t, gateway.forwardInbound(sender, &WSMessage{Type: "chat", Action: "send", MsgID: content}))
+	}
+
+	// 同一发送者的消息在同一分片中按发送顺序取出
+	assert.Equal(t, int64(2), client.LLen(ctx, "ws:inbound:2").Val())
+	var received []string
+	for i := 0; i < 2; i++ {
+		payload, err := client.RPop(ctx, "ws:inbound:2").Result()
+		require.NoError(t, err)
+		var inbound inboundMessage
+		require.NoError(t, json.Unmarshal([]byte(payload), &inbound))
+		assert.Equal(t, gateway.id, inbound.Gateway)
+		assert.Equal(t, "client_1", inbound.ClientID)
+		assert.Equal(t, int64(6), inbound.UserID)
+		received = append(received, inbound.Message.MsgID)
+	}
+	assert.Equal(t, []string{"first", "second"}, received)
+}
@@ -0,0 +1,84 @@
+package websocket
+
+import (
+	"context"
+
+	"gochat/internal/models"
+	"gochat/internal/services"
+)
+
+// 会话变更的字段
+const (
+	ConversationChangedUnread      = "unread_count"
+	ConversationChangedLastMessage = "last_message"
+	ConversationChangedMute        = "is_muted"
+	ConversationChangedPin         = "is_pinned"
+	ConversationChangedArchive     = "is_archived"
+)
+
+// ConversationUpdate 会话变更事件数据，客户端据此更新会话列表而无需重新拉取
+type ConversationUpdate struct {
+	ConversationID int64    `json:"conversation_id"`
+	Type           int      `json:"type"`
+	TargetID       int64    `json:"target_id"`
+	UnreadCount    int      `json:"unread_count"`
+	LastReadMsgID  int64    `json:"last_read_msg_id"`
+	LastMsgID      *int64   `json:"last_msg_id,omitempty"`
+	LastMsgContent string   `json:"last_msg_content,omitempty"`
+	LastMsgType    int      `json:"last_msg_type,omitempty"`
+	IsMuted        bool     `json:"is_muted"`
+	MutedUntil     int64    `json:"muted_until,omitempty"`
+	HideUnread     bool     `json:"hide_unread"`
+	IsPinned       bool     `json:"is_pinned"`
+	PinnedAt       int64    `json:"pinned_at,omitempty"`
+	IsArchived     bool     `json:"is_archived"`
+	UpdatedAt      int64    `json:"updated_at"`
+	Changed        []string `json:"changed"`
+}
+
+// PushConversationUpdate 推送会话变更到用户的所有设备（包括触发变更的设备）
+// lastMsg不为空时携带最后一条消息的摘要
+func PushConversationUpdate(conversation *models.Conversation, lastMsg *models.Message, changed ...string) {
+	update := ConversationUpdate{
+		ConversationID: conversation.ID,
+		Type:           conversation.Type,
+		TargetID:       conversation.TargetID,
+		UnreadCount:    conversation.UnreadCount,
+		LastReadMsgID:  conversation.LastReadMsgID,
+		LastMsgID:      conversation.LastMsgID,
+		IsMuted:        conversation.IsMuted,
+		HideUnread:     conversation.HideUnread,
+		IsPinned:       conversation.IsPinned,
+		IsArchived:     conversation.IsArchived,
+		UpdatedAt:      conversation.UpdatedAt.UnixMilli(),
+		Changed:        changed,
+	}
+	if conversation.MutedUntil != nil {
+		update.MutedUntil = conversation.MutedUntil.UnixMilli()
+	}
+	if conversation.PinnedAt != nil {
+		update.PinnedAt = conversation.PinnedAt.UnixMilli()
+	}
+	if lastMsg != nil {
+		update.LastMsgContent = lastMsg.Content
+		update.LastMsgType = lastMsg.MsgType
+	}
+
+	Manager.SendToUser(conversation.UserID, WSMessage{
+		Type:   "conversation",
+		Action: "update",
+		Data:   update,
+	})
+}
+
+// pushConversationState 查询最新的会话状态并推送，用户不在线时跳过
+func pushConversationState(ctx context.Context, conversationService *services.ConversationService, userID, targetID int64, conversationType int, lastMsg *models.Message, changed ...string) {
+	if !Manager.IsOnline(userID) {
+		return
+	}
+	conversation, err := conversationService.GetConversation(ctx, userID, targetID, conversationType)
+	if err != nil {
+		return
+	}
+	PushConversationUpdate(conversation, lastMsg, changed...)
+}
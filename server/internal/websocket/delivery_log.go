@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+)
+
+// 投递记录相关的Redis键
+const (
+	deliverySeqPrefix = "ws:seq:" // ws:seq:123 用户投递序号
+	deliveryLogPrefix = "ws:log:" // ws:log:123 用户投递记录（ZSET，score为序号）
+)
+
+// DeliveryLog 每个用户的消息投递记录，用于断线重连后补推
+type DeliveryLog struct {
+	maxEntries int64
+	ttl        time.Duration
+}
+
+// NewDeliveryLog 根据配置创建投递记录
+func NewDeliveryLog(cfg *config.WebSocketConfig) *DeliveryLog {
+	ttl, err := time.ParseDuration(cfg.ResumeLogTTL)
+	if err != nil || ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	maxEntries := int64(cfg.ResumeLogSize)
+	if maxEntries <= 0 {
+		maxEntries = 500
+	}
+	return &DeliveryLog{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+	}
+}
+
+// Append 为消息分配用户维度的序号并写入投递记录
+func (l *DeliveryLog) Append(userID int64, message *WSMessage) (int64, error) {
+	ctx := context.Background()
+	client := cache.GetRedisClient()
+	uid := strconv.FormatInt(userID, 10)
+
+	seq, err := client.Incr(ctx, deliverySeqPrefix+uid).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate delivery seq: %w", err)
+	}
+	message.Seq = seq
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return 0, err
+	}
+
+	logKey := deliveryLogPrefix + uid
+	pipe := client.TxPipeline()
+	pipe.ZAdd(ctx, logKey, &redis.Z{Score: float64(seq), Member: data})
+	// 只保留最近的maxEntries条记录
+	pipe.ZRemRangeByRank(ctx, logKey, 0, -l.maxEntries-1)
+	pipe.Expire(ctx, logKey, l.ttl)
+	pipe.Expire(ctx, deliverySeqPrefix+uid, l.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return seq, fmt.Errorf("failed to append delivery log: %w", err)
+	}
+
+	return seq, nil
+}
+
+// Since 获取序号大于lastSeq的所有投递记录（按序号升序）
+func (l *DeliveryLog) Since(userID int64, lastSeq int64) ([]json.RawMessage, error) {
+	ctx := context.Background()
+	key := deliveryLogPrefix + strconv.FormatInt(userID, 10)
+
+	members, err := cache.GetRedisClient().ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(lastSeq, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]json.RawMessage, 0, len(members))
+	for _, member := range members {
+		messages = append(messages, json.RawMessage(member))
+	}
+	return messages, nil
+}
+
+// Contains 投递记录中是否仍保留该序号的消息（断线补推能否送达）
+func (l *DeliveryLog) Contains(userID int64, seq int64) bool {
+	ctx := context.Background()
+	key := deliveryLogPrefix + strconv.FormatInt(userID, 10)
+	score := strconv.FormatInt(seq, 10)
+	count, err := cache.GetRedisClient().ZCount(ctx, key, score, score).Result()
+	return err == nil && count > 0
+}
+
+// CurrentSeq 获取用户当前的投递序号
+func (l *DeliveryLog) CurrentSeq(userID int64) int64 {
+	ctx := context.Background()
+	seq, err := cache.GetRedisClient().Get(ctx, deliverySeqPrefix+strconv.FormatInt(userID, 10)).Int64()
+	if err != nil && err != redis.Nil {
+		logger.GetLogger().Warnf("获取用户 %d 投递序号失败: %v", userID, err)
+	}
+	return seq
+}
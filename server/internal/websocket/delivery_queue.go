@@ -0,0 +1,250 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+	"gochat/internal/logger"
+)
+
+// 离线消息队列键前缀
+const offlineQueuePrefix = "ws:offline:" // ws:offline:123 用户离线消息（LIST）
+
+// pendingDelivery 已推送但尚未收到客户端ACK的消息
+type pendingDelivery struct {
+	client   *ClientInfo
+	message  WSMessage
+	attempts int
+	sentAt   time.Time
+}
+
+// DeliveryQueue 可靠投递队列
+// 只跟踪声明会确认投递的连接（ClientInfo.AckEnabled），超时未ACK的消息只向该连接重试，
+// 超过重试次数或连接断开后由断线补推（投递记录）兜底，不在投递记录中的消息才转入Redis离线队列；
+// 用户不在线时消息转入离线队列，下次连接时补发
+type DeliveryQueue struct {
+	manager *ConnectionManager
+	pending sync.Map // "user_id:client_id:seq" -> *pendingDelivery
+
+	ackTimeout       time.Duration
+	maxRetries       int
+	offlineQueueSize int64
+	offlineTTL       time.Duration
+
+	startOnce sync.Once
+	stopChan  chan struct{}
+}
+
+// NewDeliveryQueue 根据配置创建可靠投递队列
+func NewDeliveryQueue(manager *ConnectionManager, cfg *config.WebSocketConfig) *DeliveryQueue {
+	ackTimeout, err := time.ParseDuration(cfg.AckTimeout)
+	if err != nil || ackTimeout <= 0 {
+		ackTimeout = 10 * time.Second
+	}
+	offlineTTL, err := time.ParseDuration(cfg.OfflineTTL)
+	if err != nil || offlineTTL <= 0 {
+		offlineTTL = 7 * 24 * time.Hour
+	}
+	offlineQueueSize := int64(cfg.OfflineQueueSize)
+	if offlineQueueSize <= 0 {
+		offlineQueueSize = 1000
+	}
+
+	return &DeliveryQueue{
+		manager:          manager,
+		ackTimeout:       ackTimeout,
+		maxRetries:       cfg.MaxRetries,
+		offlineQueueSize: offlineQueueSize,
+		offlineTTL:       offlineTTL,
+		stopChan:         make(chan struct{}),
+	}
+}
+
+// pendingKey 生成待确认消息的键，同一用户的每个连接分别确认
+func pendingKey(userID int64, clientID string, seq int64) string {
+	return fmt.Sprintf("%d:%s:%d", userID, clientID, seq)
+}
+
+// Send 推送消息并等待客户端ACK，用户不在线时直接转入离线队列
+func (q *DeliveryQueue) Send(userID int64, message WSMessage) bool {
+	if q.sendLocal(userID, message) {
+		return true
+	}
+
+	q.spill(userID, message)
+	return false
+}
+
+// sendLocal 推送到用户在本实例上的连接并等待ACK，用户不在本实例上时返回false
+// 发送缓冲区已满的连接同样记录为待确认，由超时重试补发
+func (q *DeliveryQueue) sendLocal(userID int64, message WSMessage) bool {
+	clients := q.manager.GetClients(userID)
+	if len(clients) == 0 {
+		return false
+	}
+
+	frame, presenceKey, err := newFrame(message)
+	if err != nil {
+		logger.GetLogger().Errorf("序列化消息失败: %v", err)
+		return false
+	}
+
+	sent := false
+	for _, client := range clients {
+		if q.manager.enqueue(client, frame, presenceKey) {
+			sent = true
+		}
+		q.track(client, message, 1)
+	}
+	return sent
+}
+
+// track 记录待确认的消息（没有序号的消息和未声明确认投递的连接不做跟踪）
+func (q *DeliveryQueue) track(client *ClientInfo, message WSMessage, attempts int) {
+	if message.Seq == 0 || !client.AckEnabled {
+		return
+	}
+	q.pending.Store(pendingKey(client.UserID, client.ID, message.Seq), &pendingDelivery{
+		client:   client,
+		message:  message,
+		attempts: attempts,
+		sentAt:   time.Now(),
+	})
+}
+
+// Ack 客户端确认收到消息
+func (q *DeliveryQueue) Ack(userID int64, clientID string, seq int64) {
+	q.pending.Delete(pendingKey(userID, clientID, seq))
+}
+
+// spill 将消息写入Redis离线队列
+func (q *DeliveryQueue) spill(userID int64, message WSMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		logger.GetLogger().Errorf("序列化离线消息失败: %v", err)
+		return
+	}
+
+	ctx := context.Background()
+	key := offlineQueuePrefix + strconv.FormatInt(userID, 10)
+	pipe := cache.GetRedisClient().TxPipeline()
+	pipe.RPush(ctx, key, data)
+	// 队列超长时丢弃最旧的消息，客户端可通过历史接口拉取
+	pipe.LTrim(ctx, key, -q.offlineQueueSize, -1)
+	pipe.Expire(ctx, key, q.offlineTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.GetLogger().Errorf("写入用户 %d 离线队列失败: %v", userID, err)
+	}
+}
+
+// FlushOffline 连接建立后向该连接补发离线队列中的消息
+// 补发的消息不再跟踪ACK；序号不大于client.LastSeq的消息客户端已确认或刚由断线补推送达，不再补发
+func (q *DeliveryQueue) FlushOffline(client *ClientInfo) (int, error) {
+	ctx := context.Background()
+	key := offlineQueuePrefix + strconv.FormatInt(client.UserID, 10)
+	redisClient := cache.GetRedisClient()
+
+	// 原子地取出并清空离线队列，避免多实例重复补发
+	pipe := redisClient.TxPipeline()
+	rangeCmd := pipe.LRange(ctx, key, 0, -1)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	client.WriteMutex.Lock()
+	lastSeq := client.LastSeq
+	client.WriteMutex.Unlock()
+
+	delivered := 0
+	for _, data := range rangeCmd.Val() {
+		var message WSMessage
+		if err := json.Unmarshal([]byte(data), &message); err != nil {
+			logger.GetLogger().Warnf("解析用户 %d 离线消息失败: %v", client.UserID, err)
+			continue
+		}
+		if message.Seq > 0 && message.Seq <= lastSeq {
+			continue
+		}
+		frame, presenceKey, err := newFrame(message)
+		if err != nil {
+			continue
+		}
+		if q.manager.enqueue(client, frame, presenceKey) {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+// Start 启动超时重试协程
+func (q *DeliveryQueue) Start() {
+	q.startOnce.Do(func() {
+		ticker := time.NewTicker(q.ackTimeout / 2)
+		go func() {
+			labelGoroutine("ws_delivery_retry", 0)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					q.retryExpired()
+				case <-q.stopChan:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Stop 停止超时重试协程
+func (q *DeliveryQueue) Stop() {
+	close(q.stopChan)
+}
+
+// retryExpired 向未确认的连接重发超时的消息，超过重试次数或连接已断开时停止跟踪
+func (q *DeliveryQueue) retryExpired() {
+	now := time.Now()
+
+	q.pending.Range(func(k, v interface{}) bool {
+		delivery := v.(*pendingDelivery)
+		if now.Sub(delivery.sentAt) < q.ackTimeout {
+			return true
+		}
+
+		q.pending.Delete(k)
+
+		if delivery.attempts > q.maxRetries || !q.sendRetry(delivery.client, delivery.message) {
+			q.park(delivery.client.UserID, delivery.message)
+			return true
+		}
+		q.track(delivery.client, delivery.message, delivery.attempts+1)
+		return true
+	})
+}
+
+// sendRetry 只向未确认的连接重发，保留序号以便断线补推去重和客户端按序号去重
+func (q *DeliveryQueue) sendRetry(client *ClientInfo, message WSMessage) bool {
+	frame, _, err := newFrame(message)
+	if err != nil {
+		return false
+	}
+	frame.class = frameCritical
+	return q.manager.enqueue(client, frame, 0)
+}
+
+// park 放弃重试的消息：仍在投递记录中时由重连时的断线补推送达，否则转入离线队列
+func (q *DeliveryQueue) park(userID int64, message WSMessage) {
+	if q.manager.deliveryLog != nil && q.manager.deliveryLog.Contains(userID, message.Seq) {
+		logger.GetLogger().Debugf("用户 %d 消息 seq=%d 未确认，等待重连时按last_seq补推", userID, message.Seq)
+		return
+	}
+	logger.GetLogger().Debugf("用户 %d 消息 seq=%d 未确认，转入离线队列", userID, message.Seq)
+	q.spill(userID, message)
+}
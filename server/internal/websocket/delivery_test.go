@@ -0,0 +1,222 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gochat/internal/cache"
+	"gochat/internal/config"
+)
+
+// recordingTransport 记录写入的消息，用于校验投递顺序
+type recordingTransport struct {
+	mu     sync.Mutex
+	frames []WSMessage
+}
+
+func (t *recordingTransport) WriteMessage(data []byte, compress bool) error {
+	var message WSMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.frames = append(t.frames, message)
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *recordingTransport) WritePing(deadline time.Time) error        { return nil }
+func (t *recordingTransport) WriteClose(code int, reason string) error  { return nil }
+func (t *recordingTransport) SetWriteDeadline(deadline time.Time) error { return nil }
+func (t *recordingTransport) Close() error                              { return nil }
+
+// seqs 返回已写入消息的序号
+func (t *recordingTransport) seqs() []int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seqs := make([]int64, 0, len(t.frames))
+	for _, frame := range t.frames {
+		seqs = append(seqs, frame.Seq)
+	}
+	return seqs
+}
+
+// newTestManager 创建使用miniredis的连接管理器
+func newTestManager(t *testing.T) *ConnectionManager {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	previous := cache.RedisClient
+	cache.RedisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		cache.RedisClient.Close()
+		cache.RedisClient = previous
+	})
+
+	cm := &ConnectionManager{ipCounts: make(map[string]int)}
+	cm.configure(&config.WebSocketConfig{AckTimeout: "1s", MaxRetries: 2})
+	t.Cleanup(cm.queue.Stop)
+	return cm
+}
+
+// newTestClient 创建未注册的连接，发送缓冲区和writePump与AddClient一致
+func newTestClient(cm *ConnectionManager, id string, userID int64) (*ClientInfo, *recordingTransport) {
+	transport := &recordingTransport{}
+	client := &ClientInfo{
+		ID:              id,
+		UserID:          userID,
+		Transport:       transport,
+		send:            make(chan outboundFrame, 16),
+		done:            make(chan struct{}),
+		ready:           make(chan struct{}),
+		pendingPresence: make(map[int64]outboundFrame),
+	}
+	go cm.writePump(client)
+	return client, transport
+}
+
+func TestResumeClientBeforeLiveFrames(t *testing.T) {
+	cm := newTestManager(t)
+	for i := 0; i < 3; i++ {
+		message := WSMessage{Type: "chat", Action: "receive"}
+		_, err := cm.deliveryLog.Append(7, &message)
+		require.NoError(t, err)
+	}
+
+	client, transport := newTestClient(cm, "c1", 7)
+	defer cm.RemoveClient(client)
+
+	// 注册后、补推完成前到达的实时消息：seq=3已在补推范围内，seq=4是新消息
+	live := func(seq int64) outboundFrame {
+		data, _ := json.Marshal(WSMessage{Type: "chat", Action: "receive", Seq: seq})
+		return outboundFrame{data: data, seq: seq, class: frameCritical}
+	}
+	require.True(t, cm.enqueue(client, live(3), 0))
+	require.True(t, cm.enqueue(client, live(4), 0))
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, transport.seqs(), "实时消息应等待补推完成")
+
+	count, err := cm.ResumeClient(client, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	cm.startDelivery(client)
+
+	assert.Eventually(t, func() bool { return len(transport.seqs()) == 3 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{2, 3, 4}, transport.seqs())
+}
+
+// registerTestClients 将连接放入连接管理器，测试结束时注销
+func registerTestClients(t *testing.T, cm *ConnectionManager, clients ...*ClientInfo) {
+	t.Helper()
+	conns := make(map[string]*ClientInfo, len(clients))
+	for _, client := range clients {
+		conns[client.ID] = client
+		cm.startDelivery(client)
+	}
+	cm.clients.Store(clients[0].UserID, conns)
+	t.Cleanup(func() {
+		cm.clients.Delete(clients[0].UserID)
+		for _, client := range clients {
+			cm.RemoveClient(client)
+		}
+	})
+}
+
+func pendingCount(q *DeliveryQueue) int {
+	count := 0
+	q.pending.Range(func(k, v interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+func TestDeliveryQueueTracksAckClientsOnly(t *testing.T) {
+	cm := newTestManager(t)
+	acking, _ := newTestClient(cm, "a", 7)
+	acking.AckEnabled = true
+	legacy, legacyTransport := newTestClient(cm, "b", 7)
+	registerTestClients(t, cm, acking, legacy)
+
+	require.True(t, cm.queue.sendLocal(7, WSMessage{Type: "chat", Action: "receive", Seq: 5}))
+	assert.Eventually(t, func() bool { return len(legacyTransport.seqs()) == 1 }, time.Second, 10*time.Millisecond)
+
+	// 只跟踪声明确认投递的连接，其他连接的确认不影响该连接
+	_, tracked := cm.queue.pending.Load(pendingKey(7, "a", 5))
+	assert.True(t, tracked)
+	assert.Equal(t, 1, pendingCount(cm.queue))
+	cm.queue.Ack(7, "b", 5)
+	assert.Equal(t, 1, pendingCount(cm.queue))
+	cm.queue.Ack(7, "a", 5)
+	assert.Zero(t, pendingCount(cm.queue))
+}
+
+func TestDeliveryQueueRetryKeepsSeqForUnackedClient(t *testing.T) {
+	cm := newTestManager(t)
+	acking, ackingTransport := newTestClient(cm, "a", 7)
+	acking.AckEnabled = true
+	other, otherTransport := newTestClient(cm, "b", 7)
+	other.AckEnabled = true
+	registerTestClients(t, cm, acking, other)
+
+	message := WSMessage{Type: "chat", Action: "receive"}
+	_, err := cm.deliveryLog.Append(7, &message)
+	require.NoError(t, err)
+	require.True(t, cm.queue.sendLocal(7, message))
+	cm.queue.Ack(7, "b", message.Seq)
+
+	// 超时后只向未确认的连接重发，序号不变
+	cm.queue.pending.Range(func(k, v interface{}) bool {
+		v.(*pendingDelivery).sentAt = time.Now().Add(-time.Minute)
+		return true
+	})
+	cm.queue.retryExpired()
+	assert.Eventually(t, func() bool { return len(ackingTransport.seqs()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{message.Seq, message.Seq}, ackingTransport.seqs())
+	assert.Equal(t, []int64{message.Seq}, otherTransport.seqs())
+}
+
+func TestDeliveryQueueParkSkipsLoggedMessages(t *testing.T) {
+	cm := newTestManager(t)
+	logged := WSMessage{Type: "chat", Action: "receive"}
+	_, err := cm.deliveryLog.Append(7, &logged)
+	require.NoError(t, err)
+
+	// 仍在投递记录中的消息由断线补推送达，不进入离线队列
+	cm.queue.park(7, logged)
+	length, err := cache.RedisClient.LLen(context.Background(), offlineQueuePrefix+"7").Result()
+	require.NoError(t, err)
+	assert.Zero(t, length)
+
+	cm.queue.park(7, WSMessage{Type: "chat", Action: "receive", Seq: 99})
+	length, err = cache.RedisClient.LLen(context.Background(), offlineQueuePrefix+"7").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), length)
+}
+
+func TestFlushOfflineSkipsResumedMessages(t *testing.T) {
+	cm := newTestManager(t)
+	for _, seq := range []int64{2, 3, 0} {
+		cm.queue.spill(7, WSMessage{Type: "chat", Action: "receive", Seq: seq})
+	}
+
+	client, transport := newTestClient(cm, "a", 7)
+	client.AckEnabled = true
+	client.LastSeq = 2
+	registerTestClients(t, cm, client)
+
+	// seq=2已经通过断线补推送达；补发的消息不再跟踪ACK
+	delivered, err := cm.queue.FlushOffline(client)
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Eventually(t, func() bool { return len(transport.seqs()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{3, 0}, transport.seqs())
+	assert.Zero(t, pendingCount(cm.queue))
+}
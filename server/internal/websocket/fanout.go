@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"gochat/internal/config"
+)
+
+// FanoutPool 大群消息扇出的工作池
+// 接收者按用户ID分片到固定的worker，同一接收者的任务总在同一个worker上按提交顺序执行，
+// 保证同一用户收到的消息顺序与发送顺序一致
+type FanoutPool struct {
+	shards    []chan func()
+	batchSize int
+	startOnce sync.Once
+}
+
+// NewFanoutPool 根据配置创建扇出工作池
+func NewFanoutPool(cfg *config.WebSocketConfig) *FanoutPool {
+	workers := cfg.FanoutWorkers
+	if workers <= 0 {
+		workers = 8
+	}
+	queueSize := cfg.FanoutQueueSize
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+	batchSize := cfg.FanoutBatchSize
+	if batchSize <= 0 {
+		batchSize = 200
+	}
+
+	shards := make([]chan func(), workers)
+	for i := range shards {
+		shards[i] = make(chan func(), queueSize)
+	}
+	return &FanoutPool{shards: shards, batchSize: batchSize}
+}
+
+// Start 启动worker
+func (p *FanoutPool) Start() {
+	p.startOnce.Do(func() {
+		for _, shard := range p.shards {
+			go func(jobs chan func()) {
+				labelGoroutine("ws_fanout_worker", 0)
+				for job := range jobs {
+					job()
+				}
+			}(shard)
+		}
+	})
+}
+
+// Dispatch 将接收者按分片、分批提交给worker执行job，所有批次完成后调用done（可为nil）
+// 队列满时阻塞提交方，避免无限堆积
+func (p *FanoutPool) Dispatch(userIDs []int64, job func(batch []int64), done func()) {
+	partitions := make([][]int64, len(p.shards))
+	for _, userID := range userIDs {
+		idx := int(uint64(userID) % uint64(len(p.shards)))
+		partitions[idx] = append(partitions[idx], userID)
+	}
+
+	var batches int
+	for _, partition := range partitions {
+		batches += (len(partition) + p.batchSize - 1) / p.batchSize
+	}
+	if batches == 0 {
+		if done != nil {
+			done()
+		}
+		return
+	}
+
+	remaining := int64(batches)
+	for idx, partition := range partitions {
+		for start := 0; start < len(partition); start += p.batchSize {
+			end := start + p.batchSize
+			if end > len(partition) {
+				end = len(partition)
+			}
+			batch := partition[start:end]
+			p.shards[idx] <- func() {
+				job(batch)
+				if atomic.AddInt64(&remaining, -1) == 0 && done != nil {
+					done()
+				}
+			}
+		}
+	}
+}
+
+// DeliverAsync 通过工作池批量可靠投递消息，完成后回调在线/离线人数
+// 工作池未初始化时同步投递
+func (cm *ConnectionManager) DeliverAsync(userIDs []int64, message WSMessage, done func(online, offline int)) {
+	var online, offline int64
+	deliver := func(batch []int64) {
+		for _, userID := range batch {
+			if cm.Deliver(userID, message) {
+				atomic.AddInt64(&online, 1)
+			} else {
+				atomic.AddInt64(&offline, 1)
+			}
+		}
+	}
+	finish := func() {
+		if done != nil {
+			done(int(atomic.LoadInt64(&online)), int(atomic.LoadInt64(&offline)))
+		}
+	}
+
+	if cm.fanout == nil {
+		deliver(userIDs)
+		finish()
+		return
+	}
+	cm.fanout.Dispatch(userIDs, deliver, finish)
+}
+
+// RunAsync 通过工作池按接收者分批执行任务（如更新会话），与消息投递使用相同的分片保证顺序
+func (cm *ConnectionManager) RunAsync(userIDs []int64, job func(batch []int64)) {
+	if cm.fanout == nil {
+		job(userIDs)
+		return
+	}
+	cm.fanout.Dispatch(userIDs, job, nil)
+}
@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/config"
+)
+
+func TestFanoutPoolDispatch(t *testing.T) {
+	pool := NewFanoutPool(&config.WebSocketConfig{FanoutWorkers: 4, FanoutQueueSize: 16, FanoutBatchSize: 3})
+	pool.Start()
+
+	userIDs := make([]int64, 0, 50)
+	for i := int64(1); i <= 50; i++ {
+		userIDs = append(userIDs, i)
+	}
+
+	var mutex sync.Mutex
+	seen := make(map[int64][]int)
+	var wg sync.WaitGroup
+
+	// 连续提交两轮，同一用户的任务应按提交顺序执行
+	for round := 0; round < 2; round++ {
+		wg.Add(1)
+		r := round
+		pool.Dispatch(userIDs, func(batch []int64) {
+			assert.LessOrEqual(t, len(batch), 3)
+			mutex.Lock()
+			for _, userID := range batch {
+				seen[userID] = append(seen[userID], r)
+			}
+			mutex.Unlock()
+		}, wg.Done)
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 50)
+	for userID, rounds := range seen {
+		assert.Equal(t, []int{0, 1}, rounds, "user %d", userID)
+	}
+}
+
+func TestFanoutPoolDispatchEmpty(t *testing.T) {
+	pool := NewFanoutPool(&config.WebSocketConfig{})
+	called := false
+	pool.Dispatch(nil, func([]int64) {}, func() { called = true })
+	assert.True(t, called)
+}
@@ -1,67 +1,81 @@
 package websocket
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
 
+	"gochat/internal/breaker"
+	"gochat/internal/cache"
 	"gochat/internal/config"
 	"gochat/internal/logger"
 	"gochat/internal/models"
 	"gochat/internal/services"
+	"gochat/internal/utils"
 )
 
 // WebSocket消息格式
 type WSMessage struct {
-	Type    string      `json:"type"`    // ping | pong | chat
-	Action  string      `json:"action"`  // send | receive | online | offline
-	MsgID   string      `json:"msg_id,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
+	Type   string      `json:"type"`   // ping | pong | chat | ack | call
+	Action string      `json:"action"` // send | receive | online | offline
+	MsgID  string      `json:"msg_id,omitempty"`
+	Seq    int64       `json:"seq,omitempty"` // 用户维度的投递序号，用于断线重连补推
+	Data   interface{} `json:"data,omitempty"`
 }
 
 // 聊天消息数据结构
 type ChatMessage struct {
-	ToUserID   *int64  `json:"to_user_id,omitempty"`   // 单聊接收者ID
-	GroupID    *int64  `json:"group_id,omitempty"`     // 群聊群组ID
-	Content    string  `json:"content"`                // 消息内容
-	MsgType    int     `json:"msg_type,omitempty"`     // 消息类型：1-文本 2-图片
+	ToUserID    *int64 `json:"to_user_id,omitempty"`   // 单聊接收者ID
+	GroupID     *int64 `json:"group_id,omitempty"`     // 群聊群组ID
+	Content     string `json:"content"`                // 消息内容
+	MsgType     int    `json:"msg_type,omitempty"`     // 消息类型：1-文本 2-图片
 	ContentType string `json:"content_type,omitempty"` // 文本、图片等（已废弃，使用msg_type）
 }
 
 // 处理WebSocket连接请求
 func WebSocketHandler(cfg *config.Config) gin.HandlerFunc {
+	upgrader := newUpgrader(&cfg.WebSocket)
+	Manager.Configure(&cfg.WebSocket)
+
 	return func(c *gin.Context) {
-		// 从查询参数中获取Token
-		tokenStr := c.Query("token")
-		if tokenStr == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "token required"})
-			return
+		// 优先从Sec-WebSocket-Protocol获取Token，查询参数仅在兼容模式下接受
+		tokenStr := tokenFromSubprotocol(c.Request)
+		if tokenStr == "" && c.Query("token") != "" {
+			if !cfg.WebSocket.AllowQueryToken {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "query token authentication is disabled"})
+				return
+			}
+			tokenStr = c.Query("token")
 		}
 
-		// 验证JWT Token (从配置中获取密钥)
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			return []byte(cfg.JWT.Secret), nil
-		})
+		// 未携带Token时在升级后等待首个auth消息完成认证
+		var userID int64
+		var username string
+		if tokenStr != "" {
+			var ok bool
+			userID, username, ok = authenticateStream(c, cfg, tokenStr)
+			if !ok {
+				return
+			}
+		}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		// 断线重连时客户端携带最后确认的序号
+		lastSeq, resume, ok := parseLastSeq(c, c.Query("last_seq"))
+		if !ok {
 			return
 		}
 
-		// 从JWT中提取用户信息
-		claims := token.Claims.(jwt.MapClaims)
-		userIDFloat, ok := claims["user_id"].(float64)
+		// 协商协议版本（查询参数v或Sec-WebSocket-Protocol子协议）
+		protocolVersion, ok := negotiateProtocol(c)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id"})
 			return
 		}
-		userID := int64(userIDFloat)
-		username, _ := claims["username"].(string)
 
 		// 升级为WebSocket连接
 		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -71,41 +85,51 @@ func WebSocketHandler(cfg *config.Config) gin.HandlerFunc {
 		}
 		defer conn.Close()
 
+		if tokenStr == "" {
+			userID, username, err = authenticateFirstFrame(conn, cfg)
+			if err != nil {
+				logger.GetLogger().Infof("WebSocket首帧认证失败 (ip=%s): %v", c.ClientIP(), err)
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(CloseUnauthorized, err.Error()), time.Now().Add(time.Second))
+				return
+			}
+		}
+
 		// 创建客户端信息
 		clientID := generateClientID()
 		client := &ClientInfo{
-			ID:       clientID,
-			UserID:   userID,
-			Username: username,
-			Conn:     conn,
-			LastPing: time.Now(),
+			ID:              clientID,
+			UserID:          userID,
+			Username:        username,
+			IP:              c.ClientIP(),
+			Conn:            conn,
+			LastPing:        time.Now(),
+			ProtocolVersion: protocolVersion,
+			AckEnabled:      ackRequested(c),
 		}
 
-		// 添加到连接管理器
-		Manager.AddClient(client)
-		defer Manager.RemoveClient(userID)
-
-		// 广播用户上线状态给好友
-		go broadcastUserOnlineStatus(userID, true)
-		defer func() {
-			// 广播用户下线状态给好友
-			go broadcastUserOnlineStatus(userID, false)
-		}()
+		// 添加到连接管理器，超过连接数限制时以自定义关闭码拒绝
+		if err := Manager.AddClient(client); err != nil {
+			code := websocket.ClosePolicyViolation
+			if limitErr, ok := err.(*ConnectionLimitError); ok {
+				code = limitErr.Code
+			}
+			logger.GetLogger().Warnf("拒绝用户 %d 的WebSocket连接 (ip=%s): %v", userID, client.IP, err)
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, err.Error()), time.Now().Add(time.Second))
+			return
+		}
+		defer Manager.RemoveClient(client)
+		labelGoroutine("ws_read_loop", userID)
 
-		// 启动心跳检测协程
-		go startHeartbeat(client)
+		// 心跳：读超时 + ping/pong控制帧（ping由writePump定期发送）
+		Manager.setupHeartbeat(client)
 
-		// 发送连接成功消息 - 使用线程安全的SendToUser方法
-		connectMessage := WSMessage{
-			Type:   "system",
-			Action: "connected",
-			Data: gin.H{
-				"user_id":   userID,
-				"username":  username,
-				"client_id": clientID,
-			},
+		// 发送连接成功消息，同步写入以保证先于补推消息送达
+		if err := Manager.WriteToClient(client, connectedMessage(client)); err != nil {
+			logger.GetLogger().Warnf("发送连接成功消息失败: %v", err)
+			return
 		}
-		Manager.SendToUser(userID, connectMessage)
+
+		resumeDelivery(client, lastSeq, resume)
 
 		// 消息处理循环
 		for {
@@ -117,6 +141,7 @@ func WebSocketHandler(cfg *config.Config) gin.HandlerFunc {
 				}
 				break
 			}
+			messagesIn.Inc()
 
 			// 处理消息
 			handleMessage(client, &wsMsg)
@@ -124,17 +149,104 @@ func WebSocketHandler(cfg *config.Config) gin.HandlerFunc {
 	}
 }
 
-// 处理消息
-func handleMessage(client *ClientInfo, message *WSMessage) {
-	switch message.Type {
-	case "ping":
-		handlePing(client)
-	case "pong":
-		handlePong(client)
-	case "chat":
-		handleChatMessage(client, message)
-	default:
-		logger.GetLogger().Infof("未知消息类型: %s", message.Type)
+// authenticateStream 校验实时通道（WebSocket/SSE）的JWT，失败时直接写入401响应
+func authenticateStream(c *gin.Context, cfg *config.Config, tokenStr string) (int64, string, bool) {
+	if tokenStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token required"})
+		return 0, "", false
+	}
+
+	userID, username, err := parseStreamToken(tokenStr, cfg)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return 0, "", false
+	}
+	return userID, username, true
+}
+
+// parseStreamToken 验证JWT并提取用户信息
+func parseStreamToken(tokenStr string, cfg *config.Config) (int64, string, error) {
+	// 与HTTP接口使用同一套密钥和算法校验
+	claims, err := utils.ParseToken(tokenStr, &cfg.JWT)
+	if err != nil {
+		return 0, "", errors.New("invalid token")
+	}
+
+	// 从JWT中提取用户信息
+	userIDFloat, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, "", errors.New("invalid user_id")
+	}
+	userID := int64(userIDFloat)
+
+	// 与JWTAuth一致，Token需仍保存在Redis中，登出或被强制下线后不能再建立连接
+	storedToken, err := cache.GetToken(userID)
+	if errors.Is(err, breaker.ErrOpen) {
+		storedToken, err = tokenStr, nil
+	}
+	if err != nil || storedToken != tokenStr {
+		return 0, "", errors.New("token revoked or expired")
+	}
+
+	username, _ := claims["username"].(string)
+	return userID, username, nil
+}
+
+// parseLastSeq 解析客户端最后确认的投递序号，为空表示不需要补推
+func parseLastSeq(c *gin.Context, lastSeqStr string) (int64, bool, bool) {
+	if lastSeqStr == "" {
+		return 0, false, true
+	}
+	lastSeq, err := strconv.ParseInt(lastSeqStr, 10, 64)
+	if err != nil || lastSeq < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid last_seq"})
+		return 0, false, false
+	}
+	return lastSeq, true, true
+}
+
+// ackRequested 客户端是否声明会确认投递（查询参数ack=1），未声明的连接不等待ACK也不重试
+func ackRequested(c *gin.Context) bool {
+	ack := c.Query("ack")
+	return ack == "1" || ack == "true"
+}
+
+// connectedMessage 构造连接成功消息
+func connectedMessage(client *ClientInfo) WSMessage {
+	return WSMessage{
+		Type:   "system",
+		Action: "connected",
+		Data: gin.H{
+			"user_id":          client.UserID,
+			"username":         client.Username,
+			"client_id":        client.ID,
+			"last_seq":         Manager.deliveryLog.CurrentSeq(client.UserID),
+			"protocol_version": client.ProtocolVersion,
+			"ack":              client.AckEnabled,
+		},
+	}
+}
+
+// resumeDelivery 连接建立后补推断线期间错过的消息，并补发离线队列
+func resumeDelivery(client *ClientInfo, lastSeq int64, resume bool) {
+	userID := client.UserID
+
+	// 补推断线期间错过的消息，完成后再开始写入注册以来缓冲的实时消息
+	if resume {
+		count, err := Manager.ResumeClient(client, lastSeq)
+		if err != nil {
+			logger.GetLogger().Warnf("用户 %d 断线补推失败: %v", userID, err)
+		} else if count > 0 {
+			logger.GetLogger().Infof("用户 %d 断线补推 %d 条消息 (last_seq=%d)", userID, count, lastSeq)
+		}
+	}
+	Manager.startDelivery(client)
+
+	// 补发离线队列中的消息
+	if count, err := Manager.FlushOffline(client); err != nil {
+		logger.GetLogger().Warnf("用户 %d 离线消息补发失败: %v", userID, err)
+	} else if count > 0 {
+		logger.GetLogger().Infof("用户 %d 补发离线消息 %d 条", userID, count)
 	}
 }
 
@@ -149,25 +261,27 @@ func handlePing(client *ClientInfo) {
 		Data:   gin.H{"timestamp": time.Now().Unix()},
 	}
 
-	Manager.SendToUser(client.UserID, response)
+	Manager.SendToClient(client, response)
 }
 
-// 处理pong响应
-func handlePong(client *ClientInfo) {
-	// 客户端回复pong，更新心跳时间
-	client.LastPing = time.Now()
+// 处理客户端的投递确认
+func handleDeliveryAck(client *ClientInfo, message *WSMessage) {
+	if message.Seq <= 0 {
+		return
+	}
+	Manager.AckDelivery(client.UserID, client.ID, message.Seq)
 }
 
 // 聊天消息验证数据结构
 type ChatData struct {
-	Content    string `json:"content"`
-	MsgType    int    `json:"msg_type"`
-	ToUserID   *int64 `json:"to_user_id,omitempty"`
-	GroupID    *int64 `json:"group_id,omitempty"`
+	Content  string `json:"content"`
+	MsgType  int    `json:"msg_type"`
+	ToUserID *int64 `json:"to_user_id,omitempty"`
+	GroupID  *int64 `json:"group_id,omitempty"`
 }
 
 // validateChatData 验证聊天消息数据
-func validateChatData(client *ClientInfo, message *WSMessage) (*ChatData, bool) {
+func validateChatData(ctx context.Context, client *ClientInfo, message *WSMessage) (*ChatData, bool) {
 	if message.Action != "send" {
 		return nil, false
 	}
@@ -175,14 +289,14 @@ func validateChatData(client *ClientInfo, message *WSMessage) (*ChatData, bool)
 	// 解析聊天数据
 	chatDataMap, ok := message.Data.(map[string]interface{})
 	if !ok {
-		sendError(client, message.MsgID, "invalid chat data")
+		sendError(ctx, client, message.MsgID, "invalid chat data")
 		return nil, false
 	}
 
 	// 验证内容
 	content, ok := chatDataMap["content"].(string)
 	if !ok || strings.TrimSpace(content) == "" {
-		sendError(client, message.MsgID, "content is required")
+		sendError(ctx, client, message.MsgID, "content is required")
 		return nil, false
 	}
 
@@ -194,6 +308,17 @@ func validateChatData(client *ClientInfo, message *WSMessage) (*ChatData, bool)
 		}
 	}
 
+	// 通话记录只能由服务端生成
+	if msgType == models.MessageTypeCall {
+		sendError(ctx, client, message.MsgID, "msg_type is reserved for call records")
+		return nil, false
+	}
+
+	if msgType == models.MessageTypeText && !utils.ValidateMessageText(content) {
+		sendError(ctx, client, message.MsgID, "content must be at most 5000 characters without control characters")
+		return nil, false
+	}
+
 	chatData := &ChatData{
 		Content: content,
 		MsgType: msgType,
@@ -211,7 +336,7 @@ func validateChatData(client *ClientInfo, message *WSMessage) (*ChatData, bool)
 			chatData.GroupID = &groupIDInt
 		}
 	} else {
-		sendError(client, message.MsgID, "to_user_id or group_id is required")
+		sendError(ctx, client, message.MsgID, "to_user_id or group_id is required")
 		return nil, false
 	}
 
@@ -237,7 +362,7 @@ func createMessageRecord(client *ClientInfo, chatData *ChatData) *models.Message
 }
 
 // determineRecipients 确定消息接收者列表
-func determineRecipients(client *ClientInfo, chatData *ChatData, msgID string) ([]int64, bool) {
+func determineRecipients(ctx context.Context, client *ClientInfo, chatData *ChatData, msgID string) ([]int64, bool) {
 	var recipients []int64
 
 	if chatData.ToUserID != nil {
@@ -246,9 +371,9 @@ func determineRecipients(client *ClientInfo, chatData *ChatData, msgID string) (
 	} else if chatData.GroupID != nil {
 		// 群聊 - 获取群成员列表
 		groupService := services.NewGroupService()
-		members, err := groupService.GetGroupMembers(*chatData.GroupID)
+		members, err := groupService.GetGroupMembers(ctx, *chatData.GroupID)
 		if err != nil {
-			sendError(client, msgID, "failed to get group members")
+			sendError(ctx, client, msgID, "failed to get group members")
 			return nil, false
 		}
 
@@ -263,104 +388,139 @@ func determineRecipients(client *ClientInfo, chatData *ChatData, msgID string) (
 	return recipients, true
 }
 
-// saveMessageAndUpdateConversation 保存消息并更新会话信息
-func saveMessageAndUpdateConversation(client *ClientInfo, msg *models.Message, recipients []int64, msgID string) (int64, bool) {
-	// 保存消息到数据库
-	messageService := services.NewMessageService()
-	messageID, err := messageService.SaveMessage(msg)
-	if err != nil {
-		logger.GetLogger().Infof("保存消息失败: %v", err)
-		sendError(client, msgID, "save message failed")
-		return 0, false
-	}
-
-	// 更新会话信息
+// updateConversations 更新发送者和接收者的会话信息，并同步到各自的所有设备
+func updateConversations(ctx context.Context, msg *models.Message, recipients []int64) {
+	messageID := msg.ID
+	fromUserID := msg.FromUserID
 	conversationService := services.NewConversationService()
 	if msg.ToUserID != nil {
 		// 单聊：更新双方的会话
-		conversationService.UpdateLastMessage(client.UserID, *msg.ToUserID, messageID, msg.Content)
-		conversationService.UpdateLastMessage(*msg.ToUserID, client.UserID, messageID, msg.Content)
-		// 为接收者增加未读计数
-		conversationService.IncrementUnreadCount(*msg.ToUserID, client.UserID, models.ConversationTypePrivate)
+		conversationService.UpdateLastMessage(ctx, fromUserID, *msg.ToUserID, messageID, msg.Content)
+		conversationService.UpdateLastMessage(ctx, *msg.ToUserID, fromUserID, messageID, msg.Content)
+		// 发送者已读到自己发出的消息，接收者的未读数按已读位置统计
+		conversationService.MarkReadUpTo(ctx, fromUserID, *msg.ToUserID, models.ConversationTypePrivate, messageID)
+
+		// 同步会话变更到双方的所有设备
+		pushConversationState(ctx, conversationService, fromUserID, *msg.ToUserID, models.ConversationTypePrivate, msg,
+			ConversationChangedLastMessage, ConversationChangedUnread)
+		pushConversationState(ctx, conversationService, *msg.ToUserID, fromUserID, models.ConversationTypePrivate, msg,
+			ConversationChangedLastMessage, ConversationChangedUnread)
 	} else if msg.GroupID != nil {
-		// 群聊：更新所有群成员的会话
-		for _, recipientID := range recipients {
-			conversationService.UpdateLastMessage(recipientID, *msg.GroupID, messageID, msg.Content)
-			// 为接收者增加未读计数
-			conversationService.IncrementUnreadCount(recipientID, *msg.GroupID, models.ConversationTypeGroup)
-		}
+		// 群聊：异步分批更新所有群成员的会话，大群不阻塞读循环
+		groupID := *msg.GroupID
+		content := msg.Content
+		// 异步任务在调用方返回后执行，不随调用方的上下文取消
+		asyncCtx := context.WithoutCancel(ctx)
+		Manager.RunAsync(recipients, func(batch []int64) {
+			for _, recipientID := range batch {
+				conversationService.UpdateLastMessage(asyncCtx, recipientID, groupID, messageID, content)
+				pushConversationState(asyncCtx, conversationService, recipientID, groupID, models.ConversationTypeGroup, msg,
+					ConversationChangedLastMessage, ConversationChangedUnread)
+			}
+		})
 		// 也更新发送者的会话
-		conversationService.UpdateLastMessage(client.UserID, *msg.GroupID, messageID, msg.Content)
+		conversationService.UpdateLastMessage(ctx, fromUserID, groupID, messageID, msg.Content)
+		conversationService.MarkReadUpTo(ctx, fromUserID, groupID, models.ConversationTypeGroup, messageID)
+		pushConversationState(ctx, conversationService, fromUserID, groupID, models.ConversationTypeGroup, msg,
+			ConversationChangedLastMessage, ConversationChangedUnread)
 	}
-
-	return messageID, true
 }
 
-// buildAndBroadcastMessage 构建并广播消息给接收者
-func buildAndBroadcastMessage(client *ClientInfo, msg *models.Message, messageID int64, recipients []int64, msgID string) {
+// broadcastMessage 构建并广播消息给接收者
+func broadcastMessage(ctx context.Context, msg *models.Message, recipients []int64, msgID string) {
+	messageID := msg.ID
+
 	// 获取发送者的完整用户信息（使用缓存）
 	userCacheService := services.GetUserCacheService()
-	fromUser, userErr := userCacheService.GetUser(client.UserID)
+	fromUser, userErr := userCacheService.GetUser(ctx, msg.FromUserID)
 	if userErr != nil {
 		logger.GetLogger().Errorf("获取用户信息失败: %v", userErr)
-		// 如果获取用户信息失败，使用客户端的基本信息
-		fromUser = &models.User{
-			ID:       client.UserID,
-			Nickname: client.Username,
-		}
+		// 如果获取用户信息失败，只携带发送者ID
+		fromUser = &models.User{ID: msg.FromUserID}
 	}
 
-	// 推送给接收者
-	onlineCount := 0
-	offlineCount := 0
+	// 推送给接收者（不给自己发）
+	targets := make([]int64, 0, len(recipients))
 	for _, recipientID := range recipients {
-		if recipientID != client.UserID { // 不给自己发
-			pushData := gin.H{
-				"message_id":   messageID,
-				"from_user_id": client.UserID,
-				"content":      msg.Content,
-				"msg_type":     msg.MsgType,
-				"created_at":   time.Now().UTC().UnixMilli(),
-				"from_user": gin.H{
-					"id":       fromUser.ID,
-					"nickname": fromUser.Nickname,
-					"avatar":   fromUser.Avatar,
-				},
-			}
+		if recipientID != msg.FromUserID {
+			targets = append(targets, recipientID)
+		}
+	}
 
-			// 如果是群聊，添加group_id字段
-			if msg.GroupID != nil {
-				pushData["group_id"] = *msg.GroupID
-			}
+	pushData := gin.H{
+		"message_id":   messageID,
+		"from_user_id": msg.FromUserID,
+		"content":      msg.Content,
+		"msg_type":     msg.MsgType,
+		"created_at":   msg.CreatedAt.UTC().UnixMilli(),
+		"from_user": gin.H{
+			"id":       fromUser.ID,
+			"nickname": fromUser.Nickname,
+			"avatar":   services.PublicURL(fromUser.Avatar),
+		},
+	}
+	// 如果是群聊，添加group_id字段
+	if msg.GroupID != nil {
+		pushData["group_id"] = *msg.GroupID
+	}
+	if thumbnails := services.MessageThumbnails(msg.MsgType, msg.Content); thumbnails != nil {
+		pushData["thumbnails"] = thumbnails
+	}
+	if blurhash := services.MessageBlurhash(msg.MsgType, msg.Content); blurhash != "" {
+		pushData["blurhash"] = blurhash
+	}
 
-			pushMessage := WSMessage{
-				Type:   "chat",
-				Action: "receive",
-				MsgID:  msgID,
-				Data:   pushData,
-			}
-			if Manager.SendToUser(recipientID, pushMessage) {
-				onlineCount++
+	pushMessage := WSMessage{
+		Type:   "chat",
+		Action: "receive",
+		MsgID:  msgID,
+		Data:   pushData,
+	}
+
+	// 单聊直接投递，群聊交给扇出工作池分批并行投递
+	fanoutStart := time.Now()
+	logResult := func(onlineCount, offlineCount int) {
+		fanoutLatency.Since(fanoutStart)
+
+		// 记录日志
+		if msg.GroupID != nil { // 群聊
+			logger.WithContext(ctx).Infof("群聊消息发送完成，消息ID: %d，在线用户: %d，离线用户: %d", messageID, onlineCount, offlineCount)
+		} else { // 单聊
+			if onlineCount > 0 {
+				logger.WithContext(ctx).Infof("单聊消息实时发送成功，消息ID: %d，接收者在线", messageID)
 			} else {
-				offlineCount++
+				logger.WithContext(ctx).Infof("单聊消息已保存，消息ID: %d，接收者离线，等待上线后拉取", messageID)
 			}
 		}
 	}
 
-	// 记录日志
-	if len(recipients) > 1 { // 群聊
-		logger.GetLogger().Infof("群聊消息发送完成，消息ID: %d，在线用户: %d，离线用户: %d", messageID, onlineCount, offlineCount)
-	} else { // 单聊
-		if onlineCount > 0 {
-			logger.GetLogger().Infof("单聊消息实时发送成功，消息ID: %d，接收者在线", messageID)
-		} else {
-			logger.GetLogger().Infof("单聊消息已保存，消息ID: %d，接收者离线，等待上线后拉取", messageID)
+	if msg.GroupID == nil {
+		onlineCount, offlineCount := 0, 0
+		for _, recipientID := range targets {
+			if Manager.Deliver(recipientID, pushMessage) {
+				onlineCount++
+			} else {
+				offlineCount++
+			}
 		}
+		logResult(onlineCount, offlineCount)
+		return
 	}
+	Manager.DeliverAsync(targets, pushMessage, logResult)
 }
 
 // 处理聊天消息
 func handleChatMessage(client *ClientInfo, message *WSMessage) {
+	// 网关只转发，由worker保存和扇出
+	if Manager.cluster != nil && Manager.cluster.role == RoleGateway {
+		if err := Manager.cluster.forwardInbound(client, message); err != nil {
+			ctx := logger.WithRequestID(context.Background(), logger.NewRequestID())
+			logger.WithContext(ctx).Warnf("转发用户 %d 的聊天消息失败: %v", client.UserID, err)
+			sendError(ctx, client, message.MsgID, "message service unavailable")
+		}
+		return
+	}
+
 	// 0. 检查速率限制
 	if !Manager.CheckRateLimit(client.UserID) {
 		// 发送速率限制错误消息给用户
@@ -373,85 +533,121 @@ func handleChatMessage(client *ClientInfo, message *WSMessage) {
 				"message": "您发送消息过于频繁，请稍后再试",
 			},
 		}
-		Manager.SendToUser(client.UserID, errorResponse)
+		Manager.SendToClient(client, errorResponse)
 		logger.GetLogger().Warnf("用户 %d 触发WebSocket消息速率限制", client.UserID)
 		return
 	}
 
+	// 读循环没有请求上下文，每条消息的数据库操作独立于连接生命周期
+	// 每条消息生成独立的请求ID，保存、投递（包括发件箱中继重试）的日志和返回给客户端的错误都带有该ID
+	ctx := logger.WithRequestID(context.Background(), logger.NewRequestID())
+
 	// 1. 验证聊天数据
-	chatData, ok := validateChatData(client, message)
+	chatData, ok := validateChatData(ctx, client, message)
 	if !ok {
 		return
 	}
 
-	// 2. 创建消息记录
+	// 被禁言的用户不能发消息
+	if err := services.CheckMuted(ctx, client.UserID); err != nil {
+		var muted *services.UserMutedError
+		if errors.As(err, &muted) {
+			sendError(ctx, client, message.MsgID, err.Error())
+			return
+		}
+		logger.WithContext(ctx).Warnf("查询用户 %d 的禁言状态失败: %v", client.UserID, err)
+	}
+
+	// 2. 敏感词过滤（仅文本消息），按群覆盖的方式拒绝、替换或放行并记录
+	var filtered *services.FilterResult
+	originalContent := chatData.Content
+	if chatData.MsgType == models.MessageTypeText {
+		var groupID int64
+		if chatData.GroupID != nil {
+			groupID = *chatData.GroupID
+		}
+		result, err := services.GetContentFilter().CheckMessage(chatData.Content, groupID)
+		if err != nil {
+			logger.WithContext(ctx).Infof("用户 %d 的消息包含敏感词: %v", client.UserID, result.Matches)
+			sendError(ctx, client, message.MsgID, "content contains sensitive words")
+			return
+		}
+		chatData.Content = result.Text
+		filtered = result
+	}
+
+	// 3. 创建消息记录
 	msg := createMessageRecord(client, chatData)
 
-	// 3. 确定接收者列表
-	recipients, ok := determineRecipients(client, chatData, message.MsgID)
+	// 4. 确定接收者列表
+	recipients, ok := determineRecipients(ctx, client, chatData, message.MsgID)
 	if !ok {
 		return
 	}
 
-	// 4. 保存消息并更新会话信息
-	messageID, ok := saveMessageAndUpdateConversation(client, msg, recipients, message.MsgID)
-	if !ok {
+	// 5. 保存消息（先执行保存前钩子），同一事务写入新消息事件
+	saved, err := services.NewMessageService().SaveMessageWithEvent(ctx, msg, services.MessageCreatedEvent{
+		ClientMsgID: message.MsgID,
+		Recipients:  recipients,
+		RequestID:   logger.RequestIDFrom(ctx),
+	})
+	if err != nil {
+		var rejected *services.MessageRejectedError
+		if errors.As(err, &rejected) {
+			sendError(ctx, client, message.MsgID, rejected.Reason)
+			return
+		}
+		logger.WithContext(ctx).Infof("保存消息失败: %v", err)
+		sendError(ctx, client, message.MsgID, "save message failed")
 		return
 	}
 
-	// 5. 发送成功确认给发送者
-	sendACK(client, message.MsgID, messageID)
+	if filtered != nil && filtered.Flagged() {
+		services.RecordFlagged(ctx, client.UserID, "message", services.AuditTargetMessage, saved.MessageID, filtered)
+	}
+
+	// 6. 发送成功确认给发送者，文本内容被敏感词过滤或钩子替换时带上替换后的内容
+	// （文件类消息的地址在保存时会统一为相对地址，不算替换）
+	var maskedContent string
+	if msg.MsgType == models.MessageTypeText && msg.Content != originalContent {
+		maskedContent = msg.Content
+	}
+	sendACK(client, message.MsgID, saved.MessageID, maskedContent)
 
-	// 6. 构建并广播消息给接收者
-	buildAndBroadcastMessage(client, msg, messageID, recipients, message.MsgID)
+	// 7. 立即投递新消息事件（更新会话、广播给接收者），失败时由发件箱中继重试
+	if _, err := services.NewOutboxService().Publish(ctx, saved.EventID); err != nil {
+		logger.WithContext(ctx).Warnf("消息 %d 投递失败，等待发件箱中继重试: %v", saved.MessageID, err)
+	}
 }
 
-// 发送错误消息
-func sendError(client *ClientInfo, msgID, errorMsg string) {
+// 发送错误消息，带上请求ID便于按ID查找服务端日志
+func sendError(ctx context.Context, client *ClientInfo, msgID, errorMsg string) {
+	data := gin.H{"error": errorMsg}
+	if requestID := logger.RequestIDFrom(ctx); requestID != "" {
+		data["request_id"] = requestID
+	}
 	errorResponse := WSMessage{
 		Type:   "error",
 		Action: "error",
 		MsgID:  msgID,
-		Data:   gin.H{"error": errorMsg},
+		Data:   data,
 	}
-	Manager.SendToUser(client.UserID, errorResponse)
+	Manager.SendToClient(client, errorResponse)
 }
 
 // 发送ACK确认
-func sendACK(client *ClientInfo, msgID string, messageID int64) {
+func sendACK(client *ClientInfo, msgID string, messageID int64, maskedContent string) {
+	data := gin.H{"message_id": messageID}
+	if maskedContent != "" {
+		data["content"] = maskedContent
+	}
 	ackResponse := WSMessage{
 		Type:   "chat",
 		Action: "ack",
 		MsgID:  msgID,
-		Data:   gin.H{"message_id": messageID},
-	}
-	Manager.SendToUser(client.UserID, ackResponse)
-}
-
-// 启动心跳检测
-func startHeartbeat(client *ClientInfo) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			// 每30秒发送ping
-			pingMsg := WSMessage{
-				Type:   "ping",
-				Action: "ping",
-				Data:   gin.H{"timestamp": time.Now().Unix()},
-			}
-			Manager.SendToUser(client.UserID, pingMsg)
-
-			// 检查是否超时 - 允许更长的超时时间
-			if time.Since(client.LastPing) > 180*time.Second {
-				logger.GetLogger().Infof("用户 %d 心跳超时，断开连接", client.UserID)
-				client.Conn.Close()
-				return
-			}
-		}
+		Data:   data,
 	}
+	Manager.SendToClient(client, ackResponse)
 }
 
 // 生成客户端ID
@@ -463,7 +659,7 @@ func generateClientID() string {
 func broadcastUserOnlineStatus(userID int64, isOnline bool) {
 	// 获取用户的好友列表
 	friendService := services.NewFriendService()
-	friends, err := friendService.GetFriendIDs(userID)
+	friends, err := friendService.GetFriendIDs(context.Background(), userID)
 	if err != nil {
 		logger.GetLogger().Infof("获取用户 %d 的好友列表失败: %v", userID, err)
 		return
@@ -480,10 +676,8 @@ func broadcastUserOnlineStatus(userID int64, isOnline bool) {
 		},
 	}
 
-	// 向在线好友广播状态
+	// 向在线好友广播状态（好友不在线时SendToUser直接返回，拆分部署时也会推送到好友所在的网关）
 	for _, friendID := range friends {
-		if Manager.IsOnline(friendID) {
-			Manager.SendToUser(friendID, statusMessage)
-		}
+		Manager.SendToUser(friendID, statusMessage)
 	}
 }
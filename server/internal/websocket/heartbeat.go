@@ -0,0 +1,54 @@
+package websocket
+
+import "time"
+
+// 默认心跳参数
+const (
+	defaultPongWait = 60 * time.Second
+	pingRatio       = 9 // pingPeriod = pongWait * 9 / 10，保证在读超时之前发出ping
+)
+
+// setupHeartbeat 设置读超时和pong处理器
+// 服务端定期发送ping控制帧，客户端（浏览器自动）回复pong，收到pong后顺延读超时；
+// 超过pongWait未收到任何数据时ReadMessage返回超时错误，读循环退出并注销连接
+func (cm *ConnectionManager) setupHeartbeat(client *ClientInfo) {
+	pongWait := cm.pongWait
+	if pongWait <= 0 {
+		pongWait = defaultPongWait
+	}
+
+	client.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	client.Conn.SetPongHandler(func(string) error {
+		client.LastPing = time.Now()
+		return client.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+}
+
+// pingPeriod 发送ping的间隔
+func (cm *ConnectionManager) pingPeriod() time.Duration {
+	pongWait := cm.pongWait
+	if pongWait <= 0 {
+		pongWait = defaultPongWait
+	}
+	return pongWait * pingRatio / 10
+}
+
+// writePing 发送ping控制帧，失败时注销连接
+func (cm *ConnectionManager) writePing(client *ClientInfo) bool {
+	writeWait := cm.writeWait
+	if writeWait <= 0 {
+		writeWait = 10 * time.Second
+	}
+
+	if err := client.Transport.WritePing(time.Now().Add(writeWait)); err != nil {
+		sendFailures.Inc()
+		client.Transport.Close()
+		cm.RemoveClient(client)
+		return false
+	}
+	// SSE没有pong回执，写入成功即视为连接存活
+	if client.Conn == nil {
+		client.LastPing = time.Now()
+	}
+	return true
+}
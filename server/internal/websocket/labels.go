@@ -0,0 +1,17 @@
+package websocket
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+)
+
+// labelGoroutine 给当前goroutine设置pprof标签，goroutine profile（/debug/pprof/goroutine?debug=1）中
+// 可按component区分读循环、写协程等，结合user_id定位未退出的连接协程；userID为0时不带user_id
+func labelGoroutine(component string, userID int64) {
+	labels := pprof.Labels("component", component)
+	if userID != 0 {
+		labels = pprof.Labels("component", component, "user_id", strconv.FormatInt(userID, 10))
+	}
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), labels))
+}
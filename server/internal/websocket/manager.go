@@ -6,41 +6,143 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 
 	"gochat/internal/cache"
+	"gochat/internal/config"
 	"gochat/internal/logger"
 	"gochat/internal/middleware"
+	"gochat/internal/services"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 开发阶段允许所有源
-	},
+// newUpgrader 根据配置创建WebSocket升级器
+func newUpgrader(cfg *config.WebSocketConfig) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		EnableCompression: cfg.EnableCompression,   // 与客户端协商permessage-deflate
+		Subprotocols:      supportedSubprotocols(), // 通过子协议协商协议版本
+		CheckOrigin: func(r *http.Request) bool {
+			return true // 开发阶段允许所有源
+		},
+	}
 }
 
 type ClientInfo struct {
-	ID       string          `json:"id"`
-	UserID   int64           `json:"user_id"`
-	Username string          `json:"username"`
-	Conn     *websocket.Conn `json:"-"`
-	LastPing time.Time       `json:"last_ping"`
-	ConnectedAt time.Time    `json:"connected_at"`
-	WriteMutex sync.Mutex    `json:"-"` // 保证WebSocket写操作的线程安全
-	Closed   bool            `json:"-"` // 标记连接是否已关闭
+	ID              string          `json:"id"`
+	UserID          int64           `json:"user_id"`
+	Username        string          `json:"username"`
+	IP              string          `json:"ip"`
+	Conn            *websocket.Conn `json:"-"` // WebSocket连接（SSE连接为nil）
+	Transport       Transport       `json:"-"` // 写入使用的底层传输，未设置时使用Conn
+	LastPing        time.Time       `json:"last_ping"`
+	ConnectedAt     time.Time       `json:"connected_at"`
+	WriteMutex      sync.Mutex      `json:"-"`                // 保证WebSocket写操作的线程安全
+	Closed          bool            `json:"-"`                // 标记连接是否已关闭
+	ProtocolVersion int             `json:"protocol_version"` // 协商的协议版本
+	LastSeq         int64           `json:"-"`                // 已补推到的投递序号，序号不大于该值的实时消息不再重复推送
+	AckEnabled      bool            `json:"ack_enabled"`      // 客户端连接时声明会确认投递（ack=1），只有这类连接的消息会等待ACK并重试
+
+	gateway string // 连接所在的网关，非空表示连接在其他进程上（worker处理网关转发的聊天消息时使用）
+
+	send      chan outboundFrame // 发送缓冲区，由writePump串行写入连接
+	done      chan struct{}      // 连接注销时关闭
+	doneOnce  sync.Once
+	ready     chan struct{} // 断线补推完成后关闭，此前实时消息只进入发送缓冲区
+	readyOnce sync.Once
+
+	presenceMutex   sync.Mutex
+	pendingPresence map[int64]outboundFrame // 缓冲区满期间合并的在线状态，按状态所属用户ID去重
+
+	droppedFrames   int64        // 因缓冲区满丢弃的消息数
+	coalescedFrames int64        // 被合并掉的在线状态消息数
+	fullSince       atomic.Int64 // 缓冲区开始持续满载的时间（UnixNano），0表示未满
+}
+
+// 自定义关闭码（4000-4999为应用保留区间）
+const (
+	CloseUserConnectionLimit = 4029 // 用户连接数超限
+	CloseIPConnectionLimit   = 4030 // 来源IP连接数超限
+	CloseSessionRevoked      = 4031 // 会话被管理员撤销（强制下线、停用或封禁）
+)
+
+// ConnectionLimitError 连接数超限错误，携带关闭码
+type ConnectionLimitError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ConnectionLimitError) Error() string {
+	return e.Reason
 }
 
 type ConnectionManager struct {
-	clients      sync.Map         // user_id -> *ClientInfo
-	rateLimiters sync.Map         // user_id -> *middleware.RateLimiter
+	clients      sync.Map // user_id -> map[client_id]*ClientInfo（由mutex保护）
+	rateLimiters sync.Map // user_id -> *middleware.RateLimiter
 	mutex        sync.RWMutex
+	ipCounts     map[string]int // 来源IP -> 连接数（由mutex保护）
+
+	maxConnsPerUser int // 每个用户最大连接数，0表示不限制
+	maxConnsPerIP   int // 每个IP最大连接数，0表示不限制
+
+	sendBufferSize    int           // 每个连接的发送缓冲区大小
+	slowClientTimeout time.Duration // 缓冲区持续满载超过该时长则断开
+	maxDroppedFrames  int           // 丢弃帧数超过该值则断开，0表示不限制
+	writeWait         time.Duration // 单次写入超时
+	pongWait          time.Duration // 读超时，超过该时长未收到pong视为连接已断开
+
+	compressionLevel     int // 压缩级别
+	compressionThreshold int // 压缩阈值（字节），小于该值的消息不压缩
+
+	deliveryLog *DeliveryLog   // 投递记录，用于断线重连补推
+	queue       *DeliveryQueue // 可靠投递队列（重试 + 离线队列）
+	fanout      *FanoutPool    // 大群消息扇出工作池
+	calls       *callRegistry  // 进行中的音视频通话
+	cluster     *clusterBridge // 拆分部署时进程之间的消息通道，单进程部署为nil
+
+	configureOnce sync.Once
 }
 
-var Manager = &ConnectionManager{}
+var Manager = &ConnectionManager{
+	ipCounts: make(map[string]int),
+}
+
+// Configure 应用WebSocket配置，WebSocket和SSE入口共用，只在首次调用时生效
+func (cm *ConnectionManager) Configure(cfg *config.WebSocketConfig) {
+	cm.configureOnce.Do(func() { cm.configure(cfg) })
+}
+
+func (cm *ConnectionManager) configure(cfg *config.WebSocketConfig) {
+	cm.maxConnsPerUser = cfg.MaxConnectionsPerUser
+	cm.maxConnsPerIP = cfg.MaxConnectionsPerIP
+	cm.sendBufferSize = cfg.SendBufferSize
+	if cm.sendBufferSize <= 0 {
+		cm.sendBufferSize = 256
+	}
+	slowClientTimeout, err := time.ParseDuration(cfg.SlowClientTimeout)
+	if err != nil || slowClientTimeout <= 0 {
+		slowClientTimeout = 10 * time.Second
+	}
+	cm.slowClientTimeout = slowClientTimeout
+	cm.maxDroppedFrames = cfg.MaxDroppedFrames
+	if writeWait, err := time.ParseDuration(cfg.WriteWait); err == nil {
+		cm.writeWait = writeWait
+	}
+	if pongWait, err := time.ParseDuration(cfg.PongWait); err == nil {
+		cm.pongWait = pongWait
+	}
+	cm.compressionLevel = cfg.CompressionLevel
+	cm.compressionThreshold = cfg.CompressionThreshold
+	cm.deliveryLog = NewDeliveryLog(cfg)
+	cm.queue = NewDeliveryQueue(cm, cfg)
+	cm.queue.Start()
+	cm.fanout = NewFanoutPool(cfg)
+	cm.fanout.Start()
+	cm.calls = newCallRegistry(cfg)
+}
 
 // GetOrCreateRateLimiter 获取或创建用户的速率限制器
 func (cm *ConnectionManager) GetOrCreateRateLimiter(userID int64) *middleware.RateLimiter {
@@ -55,60 +157,200 @@ func (cm *ConnectionManager) CheckRateLimit(userID int64) bool {
 	return limiter.Allow()
 }
 
-func (cm *ConnectionManager) AddClient(client *ClientInfo) {
+// AddClient 注册连接，同一用户可以有多个设备同时在线
+// 注册后实时消息先进入发送缓冲区，调用startDelivery之后才写入连接，保证断线补推的消息先于实时消息送达
+// 超过用户或IP连接数限制时返回*ConnectionLimitError
+func (cm *ConnectionManager) AddClient(client *ClientInfo) error {
+	if client.Transport == nil {
+		client.Transport = newWSTransport(client.Conn)
+	}
 	client.ConnectedAt = time.Now()
 	client.LastPing = time.Now() // 初始化心跳时间
-	client.Closed = false       // 初始化为未关闭状态
+	client.Closed = false        // 初始化为未关闭状态
+	bufferSize := cm.sendBufferSize
+	if bufferSize <= 0 {
+		bufferSize = 256
+	}
+	client.send = make(chan outboundFrame, bufferSize)
+	client.done = make(chan struct{})
+	client.ready = make(chan struct{})
+	client.pendingPresence = make(map[int64]outboundFrame)
+
+	cm.mutex.Lock()
+	var conns map[string]*ClientInfo
+	if existing, ok := cm.clients.Load(client.UserID); ok {
+		conns = existing.(map[string]*ClientInfo)
+	}
 
-	// 检查是否已经有该用户的连接，如果有则先关闭旧连接
-	if existingClient, exists := cm.GetClient(client.UserID); exists {
-		logger.GetLogger().Debugf("用户 %d 有旧连接，先关闭旧连接", client.UserID)
-		// 标记旧连接为已关闭
-		existingClient.WriteMutex.Lock()
-		existingClient.Closed = true
-		existingClient.WriteMutex.Unlock()
-		existingClient.Conn.Close()
-		cm.RemoveClient(client.UserID)
+	if cm.maxConnsPerUser > 0 && len(conns) >= cm.maxConnsPerUser {
+		cm.mutex.Unlock()
+		rejectedConns.WithLabelValues("user_limit").Inc()
+		return &ConnectionLimitError{Code: CloseUserConnectionLimit, Reason: "too many connections for user"}
+	}
+	if cm.maxConnsPerIP > 0 && client.IP != "" && cm.ipCounts[client.IP] >= cm.maxConnsPerIP {
+		cm.mutex.Unlock()
+		rejectedConns.WithLabelValues("ip_limit").Inc()
+		return &ConnectionLimitError{Code: CloseIPConnectionLimit, Reason: "too many connections from this address"}
 	}
 
-	cm.clients.Store(client.UserID, client)
+	// 写时复制，读取方无需加锁即可安全遍历
+	updated := make(map[string]*ClientInfo, len(conns)+1)
+	for id, c := range conns {
+		updated[id] = c
+	}
+	updated[client.ID] = client
+	cm.clients.Store(client.UserID, updated)
+	if client.IP != "" {
+		cm.ipCounts[client.IP]++
+	}
+	firstConn := len(updated) == 1
+	cm.mutex.Unlock()
 
-	// 设置Redis在线状态
-	ctx := context.Background()
-	cache.GetRedisClient().Set(ctx, fmt.Sprintf("online:%d", client.UserID), "1", 5*time.Minute)
+	activeConnections.Inc()
+	connectsMeter.Mark()
+	if firstConn {
+		onlineUsers.Inc()
+	}
 
-	logger.GetLogger().Infof("用户 %d (%s) 已上线，当前在线用户数: %d", client.UserID, client.Username, cm.GetOnlineCount())
-}
+	go cm.writePump(client)
 
-func (cm *ConnectionManager) RemoveClient(userID int64) {
-	if client, exists := cm.clients.LoadAndDelete(userID); exists {
-		clientInfo := client.(*ClientInfo)
+	// 设置压缩级别（仅在协商成功时生效）
+	if cm.compressionLevel != 0 && client.Conn != nil {
+		if err := client.Conn.SetCompressionLevel(cm.compressionLevel); err != nil {
+			logger.GetLogger().Warnf("设置WebSocket压缩级别失败: %v", err)
+		}
+	}
 
-		// 标记连接为已关闭
-		clientInfo.WriteMutex.Lock()
-		clientInfo.Closed = true
-		clientInfo.WriteMutex.Unlock()
+	services.RecordActiveUsers(context.Background(), client.UserID)
 
-		// 清理速率限制器（可选，减少内存占用）
-		cm.rateLimiters.Delete(userID)
+	if firstConn {
+		if cm.cluster != nil {
+			cm.cluster.join(client.UserID)
+		}
 
-		// 清除Redis在线状态
+		// 设置Redis在线状态
 		ctx := context.Background()
-		cache.GetRedisClient().Del(ctx, fmt.Sprintf("online:%d", userID))
+		cache.GetRedisClient().Set(ctx, fmt.Sprintf("online:%d", client.UserID), "1", 5*time.Minute)
+
+		// 广播用户上线状态给好友
+		go broadcastUserOnlineStatus(client.UserID, true)
+
+		logger.GetLogger().Infof("用户 %d (%s) 已上线，当前在线用户数: %d", client.UserID, client.Username, cm.GetOnlineCount())
+	} else {
+		logger.GetLogger().Debugf("用户 %d 新增设备连接 %s，当前设备数: %d", client.UserID, client.ID, len(updated))
+	}
+
+	return nil
+}
+
+// RemoveClient 注销连接，用户最后一个连接断开时标记为下线
+func (cm *ConnectionManager) RemoveClient(client *ClientInfo) {
+	// 标记连接为已关闭
+	client.WriteMutex.Lock()
+	client.Closed = true
+	client.WriteMutex.Unlock()
+	if client.done != nil {
+		client.doneOnce.Do(func() { close(client.done) })
+	}
+
+	cm.mutex.Lock()
+	existing, ok := cm.clients.Load(client.UserID)
+	if !ok {
+		cm.mutex.Unlock()
+		return
+	}
+	conns := existing.(map[string]*ClientInfo)
+	if _, registered := conns[client.ID]; !registered {
+		cm.mutex.Unlock()
+		return
+	}
+
+	updated := make(map[string]*ClientInfo, len(conns))
+	for id, c := range conns {
+		if id != client.ID {
+			updated[id] = c
+		}
+	}
+	lastConn := len(updated) == 0
+	if lastConn {
+		cm.clients.Delete(client.UserID)
+	} else {
+		cm.clients.Store(client.UserID, updated)
+	}
+	if client.IP != "" {
+		cm.ipCounts[client.IP]--
+		if cm.ipCounts[client.IP] <= 0 {
+			delete(cm.ipCounts, client.IP)
+		}
+	}
+	cm.mutex.Unlock()
+
+	activeConnections.Dec()
+	disconnectsMeter.Mark()
+	if lastConn {
+		onlineUsers.Dec()
+	}
+
+	// 结束该连接参与的通话
+	if cm.calls != nil {
+		cm.calls.clientGone(client)
+	}
+
+	if stats := client.Stats(); stats.DroppedFrames > 0 || stats.CoalescedFrames > 0 {
+		logger.GetLogger().Infof("用户 %d 连接 %s 背压统计: 丢弃 %d 条，合并 %d 条",
+			client.UserID, client.ID, stats.DroppedFrames, stats.CoalescedFrames)
+	}
 
-		// 记录在线时长
-		duration := time.Since(clientInfo.ConnectedAt)
-		logger.GetLogger().Infof("用户 %d 已下线，在线时长: %v，当前在线用户数: %d",
-			userID, duration, cm.GetOnlineCount())
+	if !lastConn {
+		logger.GetLogger().Debugf("用户 %d 设备连接 %s 已断开，剩余设备数: %d", client.UserID, client.ID, len(updated))
+		return
 	}
+
+	userID := client.UserID
+
+	// 清理速率限制器（可选，减少内存占用）
+	cm.rateLimiters.Delete(userID)
+
+	// 用户在其他网关上仍有连接时不算下线
+	if cm.cluster != nil && cm.cluster.leave(userID) > 0 {
+		logger.GetLogger().Debugf("用户 %d 在本网关上的连接已全部断开，其他网关上仍有连接", userID)
+		return
+	}
+
+	// 清除Redis在线状态
+	ctx := context.Background()
+	cache.GetRedisClient().Del(ctx, fmt.Sprintf("online:%d", userID))
+
+	// 广播用户下线状态给好友
+	go broadcastUserOnlineStatus(userID, false)
+
+	// 记录在线时长
+	duration := time.Since(client.ConnectedAt)
+	logger.GetLogger().Infof("用户 %d 已下线，在线时长: %v，当前在线用户数: %d",
+		userID, duration, cm.GetOnlineCount())
+}
+
+// GetClients 获取用户的所有设备连接
+func (cm *ConnectionManager) GetClients(userID int64) []*ClientInfo {
+	existing, ok := cm.clients.Load(userID)
+	if !ok {
+		return nil
+	}
+	conns := existing.(map[string]*ClientInfo)
+	clients := make([]*ClientInfo, 0, len(conns))
+	for _, client := range conns {
+		clients = append(clients, client)
+	}
+	return clients
 }
 
-func (cm *ConnectionManager) GetClient(userID int64) (*ClientInfo, bool) {
-	client, exists := cm.clients.Load(userID)
-	if !exists {
-		return nil, false
+// DisconnectUser 断开用户在本实例上的所有连接，返回断开的连接数
+func (cm *ConnectionManager) DisconnectUser(userID int64, code int, reason string) int {
+	clients := cm.GetClients(userID)
+	for _, client := range clients {
+		cm.closeClient(client, code, reason)
 	}
-	return client.(*ClientInfo), true
+	return len(clients)
 }
 
 func (cm *ConnectionManager) GetOnlineCount() int {
@@ -120,6 +362,16 @@ func (cm *ConnectionManager) GetOnlineCount() int {
 	return count
 }
 
+// GetConnectionCount 获取当前连接总数（含同一用户的多个设备）
+func (cm *ConnectionManager) GetConnectionCount() int {
+	count := 0
+	cm.clients.Range(func(k, v interface{}) bool {
+		count += len(v.(map[string]*ClientInfo))
+		return true
+	})
+	return count
+}
+
 // 获取所有在线用户ID
 func (cm *ConnectionManager) GetOnlineUsers() []int64 {
 	var users []int64
@@ -131,38 +383,178 @@ func (cm *ConnectionManager) GetOnlineUsers() []int64 {
 	return users
 }
 
+// SendToUser 推送消息到用户的所有设备，任一设备成功即返回true
+// 拆分部署时同时推送到用户有连接的其他网关
 func (cm *ConnectionManager) SendToUser(userID int64, message interface{}) bool {
-	client, exists := cm.GetClient(userID)
-	if !exists {
+	sent := cm.sendLocal(userID, message)
+	if cm.cluster != nil && cm.cluster.forward(userID, pushToUser, message) {
+		sent = true
+	}
+	return sent
+}
+
+// sendLocal 推送消息到用户在本实例上的所有设备
+func (cm *ConnectionManager) sendLocal(userID int64, message interface{}) bool {
+	clients := cm.GetClients(userID)
+	if len(clients) == 0 {
 		// 用户不在线，静默处理，不输出日志
 		return false
 	}
 
-	// 使用写锁保证线程安全
-	client.WriteMutex.Lock()
-	defer client.WriteMutex.Unlock()
-
-	// 检查连接是否已关闭
-	if client.Closed {
-		logger.GetLogger().Debugf("用户 %d 连接已关闭，跳过消息发送", userID)
+	frame, presenceKey, err := newFrame(message)
+	if err != nil {
+		logger.GetLogger().Errorf("序列化消息失败: %v", err)
 		return false
 	}
 
+	sent := false
+	for _, client := range clients {
+		if cm.enqueue(client, frame, presenceKey) {
+			sent = true
+		}
+	}
+	return sent
+}
+
+// newFrame 序列化消息并确定分类，带投递序号的消息参与断线补推去重
+func newFrame(message interface{}) (outboundFrame, int64, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return outboundFrame{}, 0, err
+	}
+	class, presenceKey := classifyMessage(message)
+	frame := outboundFrame{data: data, class: class}
+	if wsMsg, ok := message.(WSMessage); ok {
+		frame.seq = wsMsg.Seq
+	}
+	return frame, presenceKey, nil
+}
+
+// SendToClient 推送消息到指定的设备连接（用于心跳、错误回执等只针对当前连接的消息）
+func (cm *ConnectionManager) SendToClient(client *ClientInfo, message interface{}) bool {
+	if client.gateway != "" {
+		return cm.cluster != nil && cm.cluster.forwardToClient(client, message)
+	}
 	data, err := json.Marshal(message)
 	if err != nil {
 		logger.GetLogger().Errorf("序列化消息失败: %v", err)
 		return false
 	}
+	class, presenceKey := classifyMessage(message)
+	return cm.enqueue(client, outboundFrame{data: data, class: class}, presenceKey)
+}
 
-	if err := client.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		logger.GetLogger().Warnf("发送消息失败: %v", err)
-		client.Closed = true // 标记连接已关闭
-		cm.RemoveClient(userID) // 连接断开，移除客户端
-		return false
+// WriteToClient 绕过发送缓冲区同步写入消息，用于需要保证先于后续消息送达的场景（如连接成功通知）
+func (cm *ConnectionManager) WriteToClient(client *ClientInfo, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	client.WriteMutex.Lock()
+	defer client.WriteMutex.Unlock()
+
+	if client.Closed {
+		return websocket.ErrCloseSent
+	}
+	if err := cm.writeLocked(client, data); err != nil {
+		sendFailures.Inc()
+		return err
+	}
+	messagesOut.Inc()
+	return nil
+}
+
+// writeLocked 写入一帧数据，调用方需持有client.WriteMutex
+func (cm *ConnectionManager) writeLocked(client *ClientInfo, data []byte) error {
+	// 只对超过阈值的消息启用压缩，小消息压缩收益低且浪费CPU
+	return client.Transport.WriteMessage(data, len(data) >= cm.compressionThreshold)
+}
+
+// Deliver 记录投递日志后可靠推送消息（至少一次）
+// 声明确认投递的连接超时未ACK时重试，之后由断线补推兜底；用户不在线时转入离线队列，上线后补发
+func (cm *ConnectionManager) Deliver(userID int64, message WSMessage) bool {
+	if cm.deliveryLog != nil {
+		if _, err := cm.deliveryLog.Append(userID, &message); err != nil {
+			logger.GetLogger().Warnf("记录用户 %d 投递日志失败: %v", userID, err)
+		}
+	}
+	if cm.queue == nil {
+		return cm.SendToUser(userID, message)
+	}
+	if cm.cluster == nil {
+		return cm.queue.Send(userID, message)
+	}
+	// 拆分部署：本实例和其他网关上的连接分别投递，都不在线时转入离线队列
+	local := cm.queue.sendLocal(userID, message)
+	remote := cm.cluster.forward(userID, pushDeliver, message)
+	if !local && !remote {
+		cm.queue.spill(userID, message)
+	}
+	return local || remote
+}
+
+// AckDelivery 客户端连接确认收到消息
+func (cm *ConnectionManager) AckDelivery(userID int64, clientID string, seq int64) {
+	if cm.queue != nil {
+		cm.queue.Ack(userID, clientID, seq)
 	}
+}
 
-	// 移除频繁的日志输出，消息发送成功静默处理
-	return true
+// FlushOffline 向新建立的连接补发用户离线队列中的消息
+func (cm *ConnectionManager) FlushOffline(client *ClientInfo) (int, error) {
+	if cm.queue == nil {
+		return 0, nil
+	}
+	return cm.queue.FlushOffline(client)
+}
+
+// ResumeClient 补推客户端断线期间错过的消息（序号大于lastSeq）
+// 需在startDelivery之前调用：此时实时消息仍在发送缓冲区中，补推完成后按LastSeq去重再写入
+func (cm *ConnectionManager) ResumeClient(client *ClientInfo, lastSeq int64) (int, error) {
+	if cm.deliveryLog == nil {
+		return 0, nil
+	}
+
+	client.WriteMutex.Lock()
+	defer client.WriteMutex.Unlock()
+
+	if client.Closed {
+		return 0, nil
+	}
+	// 客户端已确认lastSeq及之前的消息
+	client.LastSeq = lastSeq
+
+	missed, err := cm.deliveryLog.Since(client.UserID, lastSeq)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, data := range missed {
+		if err := cm.writeLocked(client, data); err != nil {
+			sendFailures.Inc()
+			client.Closed = true
+			return i, err
+		}
+	}
+	messagesOut.Add(int64(len(missed)))
+
+	// 记录补推到的最大序号，避免与实时推送重复
+	if len(missed) > 0 {
+		var last WSMessage
+		if err := json.Unmarshal(missed[len(missed)-1], &last); err == nil {
+			client.LastSeq = last.Seq
+		}
+	}
+
+	return len(missed), nil
+}
+
+// startDelivery 开始将发送缓冲区中的实时消息写入连接
+func (cm *ConnectionManager) startDelivery(client *ClientInfo) {
+	if client.ready != nil {
+		client.readyOnce.Do(func() { close(client.ready) })
+	}
 }
 
 // 批量发送消息
@@ -208,37 +600,42 @@ func (cm *ConnectionManager) GetOnlineStatus(userIDs []int64) map[int64]bool {
 func (cm *ConnectionManager) StartCleanup() {
 	ticker := time.NewTicker(30 * time.Second)
 	go func() {
+		labelGoroutine("ws_cleanup", 0)
 		for {
 			<-ticker.C
 			cm.cleanup()
+			if cm.cluster != nil {
+				cm.cluster.refresh(cm.GetOnlineUsers())
+			}
+			// 长时间在线的用户跨日后同样计入当天的活跃用户（已记录的用户在内存中跳过）
+			services.RecordActiveUsers(context.Background(), cm.GetOnlineUsers()...)
 		}
 	}()
 }
 
 func (cm *ConnectionManager) cleanup() {
 	now := time.Now()
-	var timeoutUsers []int64
+	var timeoutClients []*ClientInfo
+
+	// 读超时会先断开失联的连接，这里只兜底清理未正常注销的连接
+	timeout := 3 * time.Minute
+	if 2*cm.pongWait > timeout {
+		timeout = 2 * cm.pongWait
+	}
 
 	cm.clients.Range(func(k, v interface{}) bool {
-		client := v.(*ClientInfo)
-		if now.Sub(client.LastPing) > 3*time.Minute {
-			userID := k.(int64)
-			timeoutUsers = append(timeoutUsers, userID)
-			logger.GetLogger().Debugf("清理超时连接: 用户 %d，最后心跳: %v", userID, client.LastPing)
+		for _, client := range v.(map[string]*ClientInfo) {
+			if now.Sub(client.LastPing) > timeout {
+				timeoutClients = append(timeoutClients, client)
+				logger.GetLogger().Debugf("清理超时连接: 用户 %d，连接 %s，最后心跳: %v", client.UserID, client.ID, client.LastPing)
+			}
 		}
 		return true
 	})
 
-	// 清理超时用户
-	for _, userID := range timeoutUsers {
-		if client, exists := cm.GetClient(userID); exists {
-			// 标记连接为已关闭
-			client.WriteMutex.Lock()
-			client.Closed = true
-			client.WriteMutex.Unlock()
-
-			client.Conn.Close()
-			cm.RemoveClient(userID)
-		}
+	// 清理超时连接
+	for _, client := range timeoutClients {
+		client.Transport.Close()
+		cm.RemoveClient(client)
 	}
 }
@@ -0,0 +1,17 @@
+package websocket
+
+import "gochat/internal/metrics"
+
+// WebSocket相关指标
+var (
+	activeConnections = metrics.NewGauge("ws_active_connections", "当前WebSocket连接数")
+	onlineUsers       = metrics.NewGauge("ws_online_users", "当前在线用户数")
+	connectsMeter     = metrics.NewMeter("ws_connects", "WebSocket建立连接次数")
+	disconnectsMeter  = metrics.NewMeter("ws_disconnects", "WebSocket断开连接次数")
+	rejectedConns     = metrics.NewCounterVec("ws_rejected_connections_total", "因连接数限制被拒绝的连接数", "reason")
+	messagesIn        = metrics.NewCounter("ws_messages_in_total", "收到的客户端消息数")
+	messagesOut       = metrics.NewCounter("ws_messages_out_total", "成功写入连接的消息数")
+	sendFailures      = metrics.NewCounter("ws_send_failures_total", "写入失败的消息数")
+	droppedFrames     = metrics.NewCounter("ws_dropped_frames_total", "因发送缓冲区满被丢弃的消息数")
+	fanoutLatency     = metrics.NewHistogram("ws_fanout_duration_seconds", "单条聊天消息推送给所有接收者的耗时", nil)
+)
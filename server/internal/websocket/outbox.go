@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+
+	"gorm.io/gorm"
+
+	"gochat/internal/database"
+	"gochat/internal/logger"
+	"gochat/internal/models"
+	"gochat/internal/services"
+)
+
+// RegisterOutboxHandlers 注册实时推送相关的发件箱事件处理函数
+func RegisterOutboxHandlers() {
+	services.RegisterOutboxHandler(services.EventMessageCreated, publishMessageCreated)
+	services.RegisterOutboxHandler(services.EventSecurityAlert, publishSecurityAlert)
+	services.RegisterOutboxHandler(services.EventModerationNotice, publishModerationNotice)
+}
+
+// publishMessageCreated 投递新消息事件：更新会话并推送给接收者
+// 事件可能被重复投递，客户端按message_id去重
+func publishMessageCreated(ctx context.Context, event *models.OutboxEvent) error {
+	var payload services.MessageCreatedEvent
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		// 负载损坏无法通过重试恢复，记录后丢弃
+		logger.GetLogger().Errorf("发件箱事件 %d 负载无效: %v", event.ID, err)
+		return nil
+	}
+	if payload.RequestID != "" && logger.RequestIDFrom(ctx) == "" {
+		ctx = logger.WithRequestID(ctx, payload.RequestID)
+	}
+
+	var msg models.Message
+	err := database.Primary(database.GetDB()).WithContext(ctx).First(&msg, payload.MessageID).Error
+	if err == gorm.ErrRecordNotFound {
+		// 投递前消息已被删除
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	recipients := payload.Recipients
+	if recipients == nil && msg.ToUserID != nil {
+		recipients = []int64{*msg.ToUserID}
+	} else if recipients == nil && msg.GroupID != nil {
+		members, err := services.NewGroupService().GetGroupMembers(ctx, *msg.GroupID)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if member.UserID != msg.FromUserID {
+				recipients = append(recipients, member.UserID)
+			}
+		}
+	}
+
+	updateConversations(ctx, &msg, recipients)
+	// 推送前钩子只影响实时推送，会话已按全部接收者更新
+	broadcastMessage(ctx, &msg, services.ApplyPreDeliverHooks(ctx, &msg, recipients), payload.ClientMsgID)
+	return nil
+}
+
+// publishSecurityAlert 投递账号安全提醒，用户不在线时进入离线队列
+func publishSecurityAlert(ctx context.Context, event *models.OutboxEvent) error {
+	var payload services.SecurityAlertEvent
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		logger.GetLogger().Errorf("发件箱事件 %d 负载无效: %v", event.ID, err)
+		return nil
+	}
+	Manager.Deliver(payload.UserID, WSMessage{
+		Type:   "security",
+		Action: "alert",
+		Data:   payload,
+	})
+	return nil
+}
+
+// publishModerationNotice 投递审核通知（警告、禁言、举报处理结果）
+func publishModerationNotice(ctx context.Context, event *models.OutboxEvent) error {
+	var payload services.ModerationNoticeEvent
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		logger.GetLogger().Errorf("发件箱事件 %d 负载无效: %v", event.ID, err)
+		return nil
+	}
+	Manager.Deliver(payload.UserID, WSMessage{
+		Type:   "moderation",
+		Action: payload.Type,
+		Data:   payload,
+	})
+	return nil
+}
@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/logger"
+)
+
+// 协议版本
+// 新增不兼容的WSMessage变更时增加版本号并注册对应的分发表，旧版本客户端继续按原协议处理
+const (
+	ProtocolV1 = 1
+
+	// CurrentProtocolVersion 服务端支持的最新协议版本
+	CurrentProtocolVersion = ProtocolV1
+	// DefaultProtocolVersion 客户端未声明版本时使用的协议版本（兼容未升级的旧客户端）
+	DefaultProtocolVersion = ProtocolV1
+)
+
+// subprotocolPrefix 通过Sec-WebSocket-Protocol协商版本时使用的子协议前缀，如 gochat.v1
+const subprotocolPrefix = "gochat.v"
+
+// messageHandlerFunc 客户端消息处理函数
+type messageHandlerFunc func(client *ClientInfo, message *WSMessage)
+
+// protocolDispatchers 各协议版本的消息分发表：版本 -> 消息类型 -> 处理函数
+var protocolDispatchers = map[int]map[string]messageHandlerFunc{
+	ProtocolV1: {
+		// 兼容旧版客户端的应用层心跳，新客户端依赖ping/pong控制帧
+		"ping": func(client *ClientInfo, message *WSMessage) { handlePing(client) },
+		"chat": handleChatMessage,
+		"ack":  handleDeliveryAck,
+		"call": handleCallMessage,
+	},
+}
+
+// supportedSubprotocols 升级时可接受的子协议列表（新版本在前，优先选中）
+func supportedSubprotocols() []string {
+	protocols := make([]string, 0, len(protocolDispatchers))
+	for version := CurrentProtocolVersion; version >= ProtocolV1; version-- {
+		if _, ok := protocolDispatchers[version]; ok {
+			protocols = append(protocols, subprotocolPrefix+strconv.Itoa(version))
+		}
+	}
+	return protocols
+}
+
+// negotiateProtocolVersion 协商协议版本
+// 优先使用查询参数v，其次使用Sec-WebSocket-Protocol中服务端支持的最高版本，都未提供时使用默认版本
+func negotiateProtocolVersion(r *http.Request) (int, error) {
+	if v := r.URL.Query().Get("v"); v != "" {
+		version, err := strconv.Atoi(strings.TrimPrefix(v, "v"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid protocol version: %s", v)
+		}
+		if _, ok := protocolDispatchers[version]; !ok {
+			return 0, fmt.Errorf("unsupported protocol version: %d", version)
+		}
+		return version, nil
+	}
+
+	requested := false
+	best := 0
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if !strings.HasPrefix(protocol, subprotocolPrefix) {
+				continue
+			}
+			requested = true
+			version, err := strconv.Atoi(strings.TrimPrefix(protocol, subprotocolPrefix))
+			if err != nil {
+				continue
+			}
+			if _, ok := protocolDispatchers[version]; ok && version > best {
+				best = version
+			}
+		}
+	}
+	if requested && best == 0 {
+		return 0, fmt.Errorf("no supported protocol version offered")
+	}
+	if best == 0 {
+		return DefaultProtocolVersion, nil
+	}
+	return best, nil
+}
+
+// negotiateProtocol 协商协议版本，失败时直接写入400响应
+func negotiateProtocol(c *gin.Context) (int, bool) {
+	version, err := negotiateProtocolVersion(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":              err.Error(),
+			"supported_versions": supportedSubprotocols(),
+		})
+		return 0, false
+	}
+	return version, true
+}
+
+// 处理消息，按客户端协商的协议版本分发
+func handleMessage(client *ClientInfo, message *WSMessage) {
+	dispatcher, ok := protocolDispatchers[client.ProtocolVersion]
+	if !ok {
+		dispatcher = protocolDispatchers[DefaultProtocolVersion]
+	}
+
+	handler, ok := dispatcher[message.Type]
+	if !ok {
+		logger.GetLogger().Infof("未知消息类型: %s (protocol v%d)", message.Type, client.ProtocolVersion)
+		return
+	}
+	handler(client, message)
+}
@@ -0,0 +1,38 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateProtocolVersion(t *testing.T) {
+	// 未声明版本的旧客户端使用默认版本
+	req := httptest.NewRequest("GET", "/ws", nil)
+	version, err := negotiateProtocolVersion(req)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultProtocolVersion, version)
+
+	// 查询参数
+	req = httptest.NewRequest("GET", "/ws?v=1", nil)
+	version, err = negotiateProtocolVersion(req)
+	assert.NoError(t, err)
+	assert.Equal(t, ProtocolV1, version)
+
+	req = httptest.NewRequest("GET", "/ws?v=99", nil)
+	_, err = negotiateProtocolVersion(req)
+	assert.Error(t, err)
+
+	// 子协议：选择服务端支持的最高版本，忽略无关的子协议
+	req = httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", "chat, gochat.v99, gochat.v1")
+	version, err = negotiateProtocolVersion(req)
+	assert.NoError(t, err)
+	assert.Equal(t, ProtocolV1, version)
+
+	req = httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", "gochat.v99")
+	_, err = negotiateProtocolVersion(req)
+	assert.Error(t, err)
+}
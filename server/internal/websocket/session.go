@@ -0,0 +1,21 @@
+package websocket
+
+import (
+	"strconv"
+
+	"gochat/internal/cache"
+	"gochat/internal/logger"
+)
+
+// RegisterSessionRevocation 订阅会话撤销通知，用户被强制下线时断开其在本实例上的WebSocket和SSE连接
+func RegisterSessionRevocation() {
+	cache.OnInvalidate(cache.ScopeSession, func(id string) {
+		userID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return
+		}
+		if n := Manager.DisconnectUser(userID, CloseSessionRevoked, "session revoked"); n > 0 {
+			logger.GetLogger().Infof("用户 %d 被强制下线，断开 %d 个连接", userID, n)
+		}
+	})
+}
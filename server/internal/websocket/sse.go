@@ -0,0 +1,252 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+	"gochat/internal/utils"
+)
+
+// errSSEClosed SSE连接已关闭
+var errSSEClosed = errors.New("sse connection closed")
+
+// sseTransport Server-Sent Events传输，供无法使用WebSocket的客户端（如代理拦截Upgrade）接收推送
+// 每条消息的id为投递序号，客户端重连时浏览器会自动携带Last-Event-ID用于补推
+type sseTransport struct {
+	mutex    sync.Mutex
+	w        http.ResponseWriter
+	rc       *http.ResponseController
+	closed   bool
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func newSSETransport(w http.ResponseWriter) *sseTransport {
+	return &sseTransport{
+		w:    w,
+		rc:   http.NewResponseController(w),
+		done: make(chan struct{}),
+	}
+}
+
+// write 写入一个事件并立即刷新
+func (t *sseTransport) write(event string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return errSSEClosed
+	}
+	if _, err := t.w.Write([]byte(event)); err != nil {
+		return err
+	}
+	return t.rc.Flush()
+}
+
+func (t *sseTransport) WriteMessage(data []byte, compress bool) error {
+	var header struct {
+		Seq int64 `json:"seq"`
+	}
+	json.Unmarshal(data, &header)
+
+	var b strings.Builder
+	if header.Seq > 0 {
+		fmt.Fprintf(&b, "id: %d\n", header.Seq)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", data)
+	return t.write(b.String())
+}
+
+// WritePing 以注释行作为心跳，防止代理因空闲断开连接
+func (t *sseTransport) WritePing(deadline time.Time) error {
+	t.SetWriteDeadline(deadline)
+	return t.write(": ping\n\n")
+}
+
+func (t *sseTransport) WriteClose(code int, reason string) error {
+	data, _ := json.Marshal(gin.H{"code": code, "reason": reason})
+	return t.write(fmt.Sprintf("event: close\ndata: %s\n\n", data))
+}
+
+func (t *sseTransport) SetWriteDeadline(deadline time.Time) error {
+	if err := t.rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// Close 标记连接关闭，处理函数随后返回并结束响应
+func (t *sseTransport) Close() error {
+	t.mutex.Lock()
+	t.closed = true
+	t.mutex.Unlock()
+	t.doneOnce.Do(func() { close(t.done) })
+	return nil
+}
+
+// EventsHandler SSE推送入口，推送内容与WebSocket一致
+// 优先使用Authorization头；EventSource无法设置请求头，改用POST /api/v1/events/ticket换取的?ticket=，
+// ?token=与WebSocket一样仅在websocket.allow_query_token开启时接受
+func EventsHandler(cfg *config.Config) gin.HandlerFunc {
+	Manager.Configure(&cfg.WebSocket)
+
+	return func(c *gin.Context) {
+		userID, username, ok := authenticateEvents(c, cfg)
+		if !ok {
+			return
+		}
+
+		// 浏览器自动重连时携带Last-Event-ID，优先于查询参数
+		lastSeqStr := c.Query("last_seq")
+		if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+			lastSeqStr = lastEventID
+		}
+		lastSeq, resume, ok := parseLastSeq(c, lastSeqStr)
+		if !ok {
+			return
+		}
+
+		protocolVersion, ok := negotiateProtocol(c)
+		if !ok {
+			return
+		}
+
+		transport := newSSETransport(c.Writer)
+		client := &ClientInfo{
+			ID:              generateClientID(),
+			UserID:          userID,
+			Username:        username,
+			IP:              c.ClientIP(),
+			Transport:       transport,
+			LastPing:        time.Now(),
+			ProtocolVersion: protocolVersion,
+			AckEnabled:      ackRequested(c),
+		}
+
+		if err := Manager.AddClient(client); err != nil {
+			logger.GetLogger().Warnf("拒绝用户 %d 的SSE连接 (ip=%s): %v", userID, client.IP, err)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		defer transport.Close()
+		defer Manager.RemoveClient(client)
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // 禁用nginx缓冲
+		c.Status(http.StatusOK)
+
+		// 告知浏览器断线后的重连间隔
+		if err := transport.write("retry: 3000\n\n"); err != nil {
+			return
+		}
+		if err := Manager.WriteToClient(client, connectedMessage(client)); err != nil {
+			logger.GetLogger().Warnf("发送连接成功消息失败: %v", err)
+			return
+		}
+
+		resumeDelivery(client, lastSeq, resume)
+
+		// 保持连接直到客户端断开或服务端主动关闭
+		select {
+		case <-c.Request.Context().Done():
+		case <-transport.done:
+		}
+	}
+}
+
+// authenticateEvents SSE连接鉴权，失败时直接写入401响应
+func authenticateEvents(c *gin.Context, cfg *config.Config) (int64, string, bool) {
+	if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		return authenticateStream(c, cfg, strings.TrimPrefix(authHeader, "Bearer "))
+	}
+
+	if ticket := c.Query("ticket"); ticket != "" {
+		userID, username, err := redeemStreamTicket(ticket)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return 0, "", false
+		}
+		return userID, username, true
+	}
+
+	tokenStr := c.Query("token")
+	if tokenStr != "" && !cfg.WebSocket.AllowQueryToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "query token authentication is disabled"})
+		return 0, "", false
+	}
+	return authenticateStream(c, cfg, tokenStr)
+}
+
+// EventsTicketHandler 用JWT换取建立SSE连接的短期票据，票据只能使用一次
+func EventsTicketHandler(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, username, err := parseStreamToken(c.GetString("token"), cfg)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+			return
+		}
+
+		ttl := streamTicketTTL(&cfg.WebSocket)
+		ticket, err := issueStreamTicket(userID, username, ttl)
+		if err != nil {
+			logger.GetLogger().Errorf("签发用户 %d 的SSE票据失败: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, utils.ErrorResponse(500, "Failed to issue ticket"))
+			return
+		}
+
+		c.JSON(http.StatusOK, utils.SuccessResponse(gin.H{
+			"ticket":     ticket,
+			"expires_in": int(ttl.Seconds()),
+		}))
+	}
+}
+
+// EventsAckRequest SSE客户端投递确认请求
+type EventsAckRequest struct {
+	ClientID string  `json:"client_id" binding:"required"` // 连接成功消息中的client_id
+	Seq      int64   `json:"seq"`
+	Seqs     []int64 `json:"seqs"`
+}
+
+// EventsAckHandler SSE是单向通道，客户端通过该接口确认收到的消息
+func EventsAckHandler(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.ErrorResponse(401, "User not authenticated"))
+		return
+	}
+
+	var req EventsAckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "Invalid request format"))
+		return
+	}
+
+	seqs := req.Seqs
+	if req.Seq > 0 {
+		seqs = append(seqs, req.Seq)
+	}
+	if len(seqs) == 0 {
+		c.JSON(http.StatusBadRequest, utils.ErrorResponse(400, "seq is required"))
+		return
+	}
+
+	for _, seq := range seqs {
+		if seq > 0 {
+			Manager.AckDelivery(userID.(int64), req.ClientID, seq)
+		}
+	}
+
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
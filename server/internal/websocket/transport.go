@@ -0,0 +1,52 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport 连接的底层传输，WebSocket和SSE共用同一套投递流程（缓冲、重试、补推、离线队列）
+type Transport interface {
+	// WriteMessage 写入一条消息，compress表示是否尝试压缩
+	WriteMessage(data []byte, compress bool) error
+	// WritePing 写入心跳
+	WritePing(deadline time.Time) error
+	// WriteClose 通知客户端关闭原因
+	WriteClose(code int, reason string) error
+	// SetWriteDeadline 设置写超时
+	SetWriteDeadline(t time.Time) error
+	// Close 关闭连接
+	Close() error
+}
+
+// wsTransport WebSocket传输
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func newWSTransport(conn *websocket.Conn) *wsTransport {
+	return &wsTransport{conn: conn}
+}
+
+func (t *wsTransport) WriteMessage(data []byte, compress bool) error {
+	t.conn.EnableWriteCompression(compress)
+	return t.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// WritePing WriteControl可与其他写操作并发调用，无需持有WriteMutex
+func (t *wsTransport) WritePing(deadline time.Time) error {
+	return t.conn.WriteControl(websocket.PingMessage, nil, deadline)
+}
+
+func (t *wsTransport) WriteClose(code int, reason string) error {
+	return t.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
+
+func (t *wsTransport) SetWriteDeadline(deadline time.Time) error {
+	return t.conn.SetWriteDeadline(deadline)
+}
+
+func (t *wsTransport) Close() error {
+	return t.conn.Close()
+}
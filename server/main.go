@@ -2,25 +2,55 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"gochat/internal/buildinfo"
 	"gochat/internal/cache"
 	"gochat/internal/config"
 	"gochat/internal/database"
+	"gochat/internal/errreport"
+	"gochat/internal/health"
+	"gochat/internal/idgen"
 	"gochat/internal/logger"
+	"gochat/internal/objectstore"
 	"gochat/internal/routes"
+	"gochat/internal/rpc"
+	"gochat/internal/seed"
+	"gochat/internal/services"
 	"gochat/internal/tasks"
+	"gochat/internal/utils"
 	"gochat/internal/websocket"
 )
 
 func main() {
+	seedFile := flag.String("seed", "", "从YAML文件写入演示数据后退出")
+	migrateStorage := flag.Bool("migrate-storage", false, "将本地存储的文件迁移到对象存储后退出，可重复运行以继续未完成的迁移")
+	migrateLimit := flag.Int("migrate-limit", 0, "本次最多迁移的文件数，0表示不限制")
+	migrateDeleteLocal := flag.Bool("migrate-delete-local", false, "迁移成功后删除本地原图")
+	createAPIKey := flag.String("create-api-key", "", "创建指定名称的API密钥并输出明文后退出，需同时指定-api-key-user和-api-key-scopes")
+	apiKeyUser := flag.Int64("api-key-user", 0, "API密钥绑定的用户ID（机器人或服务账号）")
+	apiKeyScopes := flag.String("api-key-scopes", "", "API密钥授权范围，逗号分隔，如messages:read,files:write")
+	apiKeyTTL := flag.Duration("api-key-ttl", 0, "API密钥有效期，如720h，0表示永不过期")
+	revokeAPIKey := flag.Int64("revoke-api-key", 0, "撤销指定ID的API密钥后退出")
+	listAPIKeys := flag.Bool("list-api-keys", false, "列出所有API密钥后退出")
+	showVersion := flag.Bool("version", false, "打印版本信息后退出")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(buildinfo.Get())
+		return
+	}
+
 	// 初始化配置
 	cfg, err := config.Init(config.GetConfigPath())
 	if err != nil {
@@ -34,6 +64,12 @@ func main() {
 		os.Exit(1)
 	}
 	log := logger.GetLogger()
+	log.Infof("GoChat %s", buildinfo.Get())
+
+	// 初始化错误上报，未配置dsn时不上报
+	if err := errreport.Init(&cfg.ErrorReporting, cfg.Server.Mode); err != nil {
+		log.Fatalf("Failed to initialize error reporting: %v", err)
+	}
 
 	// 设置Gin运行模式
 	gin.SetMode(cfg.Server.Mode)
@@ -46,6 +82,17 @@ func main() {
 	}
 	// 如果是console模式，Gin默认会输出到stdout
 
+	// 初始化消息ID生成器，未配置节点号时连接Redis后租用（种子数据等一次性命令使用保留的节点号）
+	if cfg.Server.NodeID != autoNodeID {
+		if cfg.Server.NodeID == idgen.CommandNodeID {
+			log.Fatalf("Invalid server.node_id: %d is reserved for one-off commands", idgen.CommandNodeID)
+		}
+		if err := idgen.Init(cfg.Server.NodeID); err != nil {
+			log.Fatalf("Invalid server.node_id: %v", err)
+		}
+		log.Infof("Message ID node id: %d (server.node_id)", cfg.Server.NodeID)
+	}
+
 	// 初始化数据库
 	if err := database.Init(&cfg.Database); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
@@ -57,6 +104,33 @@ func main() {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 	log.Info("Database migration completed")
+	health.SetMigrated()
+
+	// 写入种子数据后退出
+	if *seedFile != "" {
+		runSeed(*seedFile)
+		return
+	}
+
+	// 管理API密钥后退出
+	if *createAPIKey != "" || *revokeAPIKey > 0 || *listAPIKeys {
+		runAPIKeyCommand(*createAPIKey, *apiKeyUser, *apiKeyScopes, *apiKeyTTL, *revokeAPIKey)
+		return
+	}
+
+	// 初始化对象存储（未配置bucket时不启用）
+	if err := objectstore.Init(&cfg.Storage.S3); err != nil {
+		log.Fatalf("Failed to initialize object storage: %v", err)
+	}
+
+	// 返回给客户端的文件URL使用CDN或反向代理地址
+	services.SetPublicBaseURL(cfg.Upload.PublicBaseURL)
+
+	// 迁移文件到对象存储后退出
+	if *migrateStorage {
+		runStorageMigration(&cfg.Storage, *migrateLimit, *migrateDeleteLocal)
+		return
+	}
 
 	// 优化数据库性能
 	if err := database.OptimizeDatabase(database.GetDB()); err != nil {
@@ -66,25 +140,182 @@ func main() {
 	}
 
 	// 初始化Redis
+	cache.Configure(&cfg.Cache)
 	if err := cache.Init(&cfg.Redis); err != nil {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
 	log.Info("Redis connected successfully")
 
+	// 未配置节点号时从Redis租用空闲的节点号，避免多个实例使用相同的默认节点号生成重复的消息ID
+	stopNodeLease := leaseNodeID(cfg)
+
+	// 解析JWT密钥
+	if err := utils.LoadJWTKeys(&cfg.JWT); err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	// 加载敏感词库
+	if err := services.InitContentFilter(&cfg.Filter); err != nil {
+		log.Fatalf("Failed to load sensitive words: %v", err)
+	}
+
+	// 初始化邮件通知（未启用时不发送邮件）
+	if err := services.InitEmail(&cfg.Email); err != nil {
+		log.Fatalf("Failed to initialize email: %v", err)
+	}
+
+	// 初始化群机器人Outgoing Webhook投递
+	services.InitBots(&cfg.Bots)
+
+	// 设置消息钩子的执行超时和关闭的钩子（钩子由部署方的代码在init中注册）
+	services.InitMessageHooks(&cfg.MessageHooks)
+
+	// 初始化全局搜索（使用Elasticsearch时确保消息索引存在）
+	if err := services.InitSearch(&cfg.Search); err != nil {
+		log.Fatalf("Failed to initialize search: %v", err)
+	}
+
+	// 初始化事件总线（未配置时领域事件只投递给进程内订阅者）
+	if err := services.InitEventBus(&cfg.EventBus); err != nil {
+		log.Fatalf("Failed to initialize event bus: %v", err)
+	}
+
 	// 启动WebSocket清理协程
 	websocket.Manager.StartCleanup()
 	log.Info("WebSocket cleanup routine started")
 
 	// 启动文件清理定时任务
-	fileCleanupTask := tasks.NewFileCleanupTask()
+	fileCleanupTask := tasks.NewFileCleanupTask(&cfg.Upload)
 	fileCleanupTask.Start()
 	log.Info("File cleanup task started")
 
+	// 启动数据库状态采样任务
+	dbStatsTask := tasks.NewDBStatsTask(&cfg.Database)
+	dbStatsTask.Start()
+	log.Info("Database stats task started")
+
+	// 启动连接数采样任务（峰值连接数统计）
+	connectionStatsTask := tasks.NewConnectionStatsTask(cfg, websocket.Manager.GetConnectionCount)
+	connectionStatsTask.Start()
+	log.Info("Connection stats task started")
+
+	// 启动发件箱中继：补投未能即时投递的消息事件；拆分部署时由worker补投，网关只即时投递
+	websocket.RegisterOutboxHandlers()
+	outboxRelayTask := tasks.NewOutboxRelayTask(&cfg.Outbox)
+	relayOutbox := cfg.Cluster.Role != websocket.RoleGateway
+	if relayOutbox {
+		outboxRelayTask.Start()
+		log.Info("Outbox relay task started")
+	}
+
+	// 启动消息归档任务
+	var messageArchiveTask *tasks.MessageArchiveTask
+	if cfg.Archive.Enabled {
+		messageArchiveTask = tasks.NewMessageArchiveTask(&cfg.Archive)
+		messageArchiveTask.Start()
+		log.Info("Message archive task started")
+	}
+
+	// 启动审计日志清理任务（retention为0时永久保留）
+	var auditCleanupTask *tasks.AuditCleanupTask
+	if retention, _ := time.ParseDuration(cfg.Audit.Retention); retention > 0 {
+		auditCleanupTask = tasks.NewAuditCleanupTask(&cfg.Audit)
+		auditCleanupTask.Start()
+		log.Info("Audit cleanup task started")
+	}
+
+	// 启动离线消息摘要任务
+	var emailDigestTask *tasks.EmailDigestTask
+	if cfg.Email.Enabled && cfg.Email.Digest.Enabled {
+		emailDigestTask = tasks.NewEmailDigestTask(&cfg.Email.Digest)
+		emailDigestTask.Start()
+		log.Info("Email digest task started")
+	}
+
+	// 启动统计汇总任务
+	var analyticsRollupTask *tasks.AnalyticsRollupTask
+	if cfg.Analytics.Enabled {
+		analyticsRollupTask = tasks.NewAnalyticsRollupTask(cfg)
+		analyticsRollupTask.Start()
+		log.Info("Analytics rollup task started")
+	}
+
+	// 启动数据导出任务：生成用户申请的导出压缩包；拆分部署时由worker生成
+	var dataExportTask *tasks.DataExportTask
+	if cfg.DataExport.Enabled && cfg.Cluster.Role != websocket.RoleGateway {
+		dataExportTask = tasks.NewDataExportTask(&cfg.DataExport)
+		dataExportTask.Start()
+		log.Info("Data export task started")
+	}
+
+	// 启动定时公告任务：发布到达发布时间的公告；拆分部署时由worker发布
+	var announcementTask *tasks.AnnouncementTask
+	if cfg.Announcements.Enabled && cfg.Cluster.Role != websocket.RoleGateway {
+		announcementTask = tasks.NewAnnouncementTask(&cfg.Announcements)
+		announcementTask.Start()
+		log.Info("Announcement task started")
+	}
+
+	// 注册可在管理后台手动触发的维护任务
+	services.RegisterMaintenanceJob("file_cleanup", "按保留策略过期文件引用并清理孤儿文件", fileCleanupTask.RunNow)
+	services.RegisterMaintenanceJob("db_stats", "采样数据库连接池状态和各表行数", dbStatsTask.RunNow)
+	services.RegisterMaintenanceJob("outbox_relay", "补投未投递的发件箱事件", outboxRelayTask.RunNow)
+	if messageArchiveTask != nil {
+		services.RegisterMaintenanceJob("message_archive", "把过期消息移入归档表", messageArchiveTask.RunNow)
+	}
+	if auditCleanupTask != nil {
+		services.RegisterMaintenanceJob("audit_cleanup", "删除超过保留期的审计日志", auditCleanupTask.RunNow)
+	}
+	if emailDigestTask != nil {
+		services.RegisterMaintenanceJob("email_digest", "发送离线消息邮件摘要", emailDigestTask.RunNow)
+	}
+	if analyticsRollupTask != nil {
+		services.RegisterMaintenanceJob("analytics_rollup", "把消息数、活跃用户和群活跃度汇总到统计表", analyticsRollupTask.RunNow)
+	}
+	if dataExportTask != nil {
+		services.RegisterMaintenanceJob("data_export", "生成待处理的用户数据导出并清理过期导出", dataExportTask.RunNow)
+	}
+	if announcementTask != nil {
+		services.RegisterMaintenanceJob("announcements", "发布已到发布时间的定时公告", announcementTask.RunNow)
+	}
+	if cfg.Search.Backend == services.SearchBackendElasticsearch {
+		services.RegisterMaintenanceJob("search_reindex", "从数据库重建Elasticsearch消息索引", services.ReindexSearch)
+	}
+
+	// 用户被强制下线时断开本实例上的实时连接
+	websocket.RegisterSessionRevocation()
+
+	// 公告发布或撤回时推送给本实例上在线的目标用户
+	if cfg.Announcements.Enabled {
+		websocket.RegisterAnnouncementBroadcast(&cfg.Announcements)
+	}
+
+	// 拆分部署：gateway转发聊天消息并接收推送，worker消费转发的消息
+	stopCluster := websocket.StartCluster(cfg)
+
+	// 启动内部gRPC接口，供内部服务直接调用用户、群组和消息服务
+	var grpcServer *rpc.Server
+	if cfg.GRPC.Enabled {
+		grpcServer = rpc.NewServer(&cfg.GRPC)
+		if err := grpcServer.Start(); err != nil {
+			log.Fatalf("Failed to start gRPC server: %v", err)
+		}
+		log.Infof("gRPC server starting on %s", cfg.GRPC.Addr)
+	}
+
 	// 初始化Gin路由
 	r := gin.New()
 
-	// 初始化路由
-	routes.SetupAPIRoutes(r, cfg)
+	// 初始化路由，worker不对外提供接口
+	if cfg.Cluster.Role == websocket.RoleWorker {
+		routes.SetupWorkerRoutes(r, cfg)
+	} else {
+		routes.SetupAPIRoutes(r, cfg)
+	}
+
+	// 所有请求的上下文都派生自baseCtx，关闭超时后取消以中断仍在执行的数据库查询
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	// 设置服务器
 	srv := &http.Server{
@@ -92,6 +323,52 @@ func main() {
 		Handler:      r,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+	}
+
+	// 诊断接口单独监听，不受主端口的写超时限制，可采集较长的CPU profile和trace
+	var debugSrv *http.Server
+	if cfg.Debug.Pprof && cfg.Debug.Addr != "" {
+		debugSrv = &http.Server{
+			Addr:              cfg.Debug.Addr,
+			Handler:           routes.NewDebugHandler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			log.Infof("Debug server (pprof, expvar) starting on %s", cfg.Debug.Addr)
+			if err := debugSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf("Debug server error: %v", err)
+			}
+		}()
+	}
+
+	// 配置热加载：收到SIGHUP或（开启server.watch_config时）配置文件变化时重新加载，WebSocket连接不受影响
+	config.OnReload(func(next *config.Config) {
+		if err := logger.SetLevel(next.Log.Level); err != nil {
+			log.Warnf("Invalid log level %q: %v", next.Log.Level, err)
+		}
+	})
+	reportReload := func(restartRequired []string, err error) {
+		if err != nil {
+			log.Errorf("Config reload failed, keeping current config: %v", err)
+			return
+		}
+		log.Info("Config reloaded")
+		if len(restartRequired) > 0 {
+			log.Warnf("Config changes in %v require a restart to take effect", restartRequired)
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reportReload(config.Reload())
+		}
+	}()
+	if cfg.Server.WatchConfig {
+		config.Watch(reportReload)
 	}
 
 	// 启动服务器
@@ -102,23 +379,225 @@ func main() {
 		}
 	}()
 
+	// 预热缓存，完成前/readyz返回503，负载均衡不转发请求
+	if cfg.Cache.WarmupEnabled {
+		go func() {
+			tasks.NewCacheWarmupTask(&cfg.Cache).Run()
+			health.SetWarmedUp()
+			log.Info("Cache warmup finished, instance is ready")
+		}()
+	} else {
+		health.SetWarmedUp()
+	}
+
 	// 等待中断信号以优雅地关闭服务器
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Info("Shutdown Server ...")
 
+	// 先让/readyz返回503，等负载均衡摘除实例后再停止接收请求
+	health.SetDraining()
+	if drainDelay, _ := time.ParseDuration(cfg.Health.DrainDelay); drainDelay > 0 {
+		log.Infof("Draining for %s before shutdown", drainDelay)
+		time.Sleep(drainDelay)
+	}
+
 	// 设置5秒超时关闭服务器
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Errorf("Server Shutdown error: %v", err)
 	}
+	cancelRequests()
+	if debugSrv != nil {
+		debugSrv.Close()
+	}
+	if grpcServer != nil {
+		grpcServer.Stop(5 * time.Second)
+	}
+
+	dbStatsTask.Stop()
+	connectionStatsTask.Stop()
+
+	// 停止处理转发的聊天消息，未处理的消息留在队列中由其他worker处理
+	stopCluster()
+
+	// 停止发件箱中继，未投递的事件由下次启动或其他实例补投
+	if relayOutbox {
+		outboxRelayTask.Stop()
+	}
+
+	// 中断正在进行的消息归档
+	if messageArchiveTask != nil {
+		messageArchiveTask.Stop()
+	}
+
+	if auditCleanupTask != nil {
+		auditCleanupTask.Stop()
+	}
+
+	if emailDigestTask != nil {
+		emailDigestTask.Stop()
+	}
+
+	// 中断正在进行的统计汇总
+	if analyticsRollupTask != nil {
+		analyticsRollupTask.Stop()
+	}
+
+	// 中断正在生成的数据导出，租期过后由下次启动或其他实例重新生成
+	if dataExportTask != nil {
+		dataExportTask.Stop()
+	}
+
+	// 停止定时公告任务
+	if announcementTask != nil {
+		announcementTask.Stop()
+	}
+
+	// 关闭事件总线连接，中继已停止，不会再有发布
+	services.CloseEventBus()
+
+	// 释放节点号租约，之后不再写入消息
+	stopNodeLease()
 
 	// 关闭数据库和Redis连接
 	database.Close()
 	cache.Close()
 
+	// 发送队列中尚未上报的错误
+	errreport.Close(5 * time.Second)
+
 	log.Info("Server exited successfully")
 }
 
+// autoNodeID server.node_id未配置时的默认值，表示从Redis租用节点号
+const autoNodeID = -1
+
+// leaseNodeID 未配置server.node_id时从Redis租用节点号并保持续期，返回释放租约的函数
+// 租约被其他实例占用（续期中断超过有效期）时退出，避免两个实例使用相同的节点号
+func leaseNodeID(cfg *config.Config) (stop func()) {
+	log := logger.GetLogger()
+	if cfg.Server.NodeID != autoNodeID {
+		return func() {}
+	}
+
+	lease, err := idgen.LeaseNode(context.Background(), cache.GetRedisClient(), idgen.DefaultLeaseTTL)
+	if err != nil {
+		log.Fatalf("Failed to lease message ID node id, set server.node_id explicitly: %v", err)
+	}
+	if err := idgen.Init(lease.Node()); err != nil {
+		log.Fatalf("Invalid leased node id: %v", err)
+	}
+	// 连接数统计等按节点号区分实例的功能使用租用的节点号
+	cfg.Server.NodeID = lease.Node()
+	log.Infof("Message ID node id: %d (leased from Redis)", lease.Node())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lease.KeepAlive(ctx, func(err error) {
+			log.Fatalf("Message ID node id %d lost: %v", lease.Node(), err)
+		})
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		if err := lease.Release(context.Background()); err != nil {
+			log.Warnf("Failed to release node id lease: %v", err)
+		}
+	}
+}
+
+// runSeed 从种子数据文件写入用户、好友、群组和消息
+func runSeed(path string) {
+	log := logger.GetLogger()
+	defer database.Close()
+
+	// 服务可能正在运行，使用保留的节点号，避免与运行中的实例生成重复的消息ID
+	if err := idgen.Init(idgen.CommandNodeID); err != nil {
+		log.Fatalf("Invalid node id: %v", err)
+	}
+
+	fixture, err := seed.Load(path)
+	if err != nil {
+		log.Fatalf("Failed to load seed fixture: %v", err)
+	}
+	result, err := seed.Apply(database.GetDB(), fixture)
+	if err != nil {
+		log.Fatalf("Failed to seed database: %v", err)
+	}
+	log.Infof("Seed completed: %d users, %d friendships, %d groups, %d messages created",
+		result.Users, result.Friendships, result.Groups, result.Messages)
+}
+
+// runStorageMigration 将本地存储的文件迁移到对象存储，收到中断信号时停止，重新运行会从未迁移的文件继续
+func runStorageMigration(cfg *config.StorageConfig, limit int, deleteLocal bool) {
+	log := logger.GetLogger()
+	defer database.Close()
+
+	store := objectstore.Default()
+	if store == nil {
+		log.Fatal("Object storage is not configured, set storage.s3.bucket first")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	result, err := services.NewFileService().MigrateToObjectStore(ctx, store, services.StorageMigrationOptions{
+		Limit:       limit,
+		RateBytes:   int64(cfg.MigrateRateMB) << 20,
+		DeleteLocal: deleteLocal,
+	})
+	log.Infof("Storage migration finished: %d migrated, %d failed, %.2fMB uploaded",
+		result.Migrated, result.Failed, float64(result.Bytes)/1024/1024)
+	if err != nil {
+		log.Fatalf("Storage migration stopped: %v", err)
+	}
+}
+
+// runAPIKeyCommand 创建、撤销或列出API密钥，明文密钥只在创建时输出一次
+func runAPIKeyCommand(name string, userID int64, scopes string, ttl time.Duration, revokeID int64) {
+	log := logger.GetLogger()
+	defer database.Close()
+
+	ctx := context.Background()
+	keyService := services.NewAPIKeyService()
+	switch {
+	case name != "":
+		var scopeList []string
+		for _, scope := range strings.Split(scopes, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopeList = append(scopeList, scope)
+			}
+		}
+		plaintext, key, err := keyService.CreateAPIKey(ctx, name, userID, scopeList, ttl)
+		if err != nil {
+			log.Fatalf("Failed to create API key: %v (available scopes: %s)", err, strings.Join(services.APIKeyScopes, ","))
+		}
+		fmt.Printf("API key %d created for user %d, scopes: %s\n%s\n", key.ID, key.UserID, key.Scopes, plaintext)
+		fmt.Println("Store the key now, it cannot be shown again.")
+	case revokeID > 0:
+		if err := keyService.RevokeAPIKey(ctx, revokeID); err != nil {
+			log.Fatalf("Failed to revoke API key: %v", err)
+		}
+		fmt.Printf("API key %d revoked\n", revokeID)
+	default:
+		keys, err := keyService.ListAPIKeys(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list API keys: %v", err)
+		}
+		for _, key := range keys {
+			status := "active"
+			if key.RevokedAt != nil {
+				status = "revoked"
+			} else if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+				status = "expired"
+			}
+			fmt.Printf("%d\t%s\t%s...\tuser=%d\tscopes=%s\t%s\n", key.ID, key.Name, key.Prefix, key.UserID, key.Scopes, status)
+		}
+	}
+}
@@ -11,7 +11,7 @@ const ChatInterface = forwardRef(({ conversation, currentUser, inputValue, setIn
   const [loadingHistory, setLoadingHistory] = useState(false);
   const [loadingMore, setLoadingMore] = useState(false); // 加载更多历史消息状态
   const [hasMoreHistory, setHasMoreHistory] = useState(true); // 是否还有更多历史消息
-  const [currentPage, setCurrentPage] = useState(1); // 当前页数
+  const [oldestMessageId, setOldestMessageId] = useState(null); // 已加载的最早一条消息ID，作为向前翻页的游标
   const [showLoadTip, setShowLoadTip] = useState(false); // 是否显示加载提示
   const [hoveredMessageId, setHoveredMessageId] = useState(null); // 添加hover状态
   const messagesEndRef = useRef(null);
@@ -66,7 +66,7 @@ const ChatInterface = forwardRef(({ conversation, currentUser, inputValue, setIn
   }, []);
 
   // 加载历史消息
-  const loadMessageHistory = useCallback(async (page = 1, isInitialLoad = false) => {
+  const loadMessageHistory = useCallback(async (beforeId = null, isInitialLoad = false) => {
     if (!conversation) return;
 
     // 保存当前会话ID，用于后续验证（防止异步竞态条件）
@@ -78,7 +78,7 @@ const ChatInterface = forwardRef(({ conversation, currentUser, inputValue, setIn
     abortControllerRef.current = abortController;
 
     // 生成请求唯一标识
-    const requestKey = `${conversation.id}_${page}_${isInitialLoad}`;
+    const requestKey = `${conversation.id}_${beforeId}_${isInitialLoad}`;
 
     // 防止重复请求
     if (isInitialLoad && loadingHistory) return;
@@ -102,7 +102,7 @@ const ChatInterface = forwardRef(({ conversation, currentUser, inputValue, setIn
       const response = await messageAPI.getMessages({
         target_id: conversation.target_id,
         type: conversation.type,
-        page: page,
+        before_id: beforeId || undefined,
         page_size: 50
       }, {
         signal: abortController.signal // 传递signal，支持取消请求
@@ -192,8 +192,10 @@ const ChatInterface = forwardRef(({ conversation, currentUser, inputValue, setIn
 
         // 更新分页状态
         const pagination = response.data.pagination;
-        setCurrentPage(page);
-        setHasMoreHistory(page < pagination.total_page);
+        if (pagination.next_before_id) {
+          setOldestMessageId(pagination.next_before_id);
+        }
+        setHasMoreHistory(pagination.has_more);
       } else {
         if (isInitialLoad) {
           setMessages([]);
@@ -264,12 +266,12 @@ const ChatInterface = forwardRef(({ conversation, currentUser, inputValue, setIn
       // 先清空消息列表，避免显示上一个会话的消息
       setMessages([]);
       // 重置分页状态
-      setCurrentPage(1);
+      setOldestMessageId(null);
       setHasMoreHistory(true);
       setShowLoadTip(false); // 重置加载提示
 
       // 发起新请求（移除了loadingHistory检查）
-      loadMessageHistory(1, true);
+      loadMessageHistory(null, true);
     }
 
     // 清理函数：组件卸载时取消请求
@@ -363,10 +365,9 @@ const ChatInterface = forwardRef(({ conversation, currentUser, inputValue, setIn
   // 加载更多历史消息
   const loadMoreHistory = useCallback(() => {
     if (!loadingMore && hasMoreHistory) {
-      const nextPage = currentPage + 1;
-      loadMessageHistory(nextPage, false);
+      loadMessageHistory(oldestMessageId, false);
     }
-  }, [hasMoreHistory, currentPage, loadingMore]); // 移除loadMessageHistory依赖，避免循环依赖
+  }, [hasMoreHistory, oldestMessageId, loadingMore]); // 移除loadMessageHistory依赖，避免循环依赖
 
   // 滚动监听：检测是否滚动到顶部
   useEffect(() => {
@@ -157,8 +157,8 @@ export const messageAPI = {
   getMessages: (params, config = {}) => api.get('/message/history', { params, ...config }),
 
   // 获取历史消息（旧版本兼容）
-  getHistory: (conversationId, page = 1) =>
-    api.get('/message/history', { params: { conversation_id: conversationId, page } }),
+  getHistory: (conversationId, beforeId) =>
+    api.get('/message/history', { params: { conversation_id: conversationId, before_id: beforeId } }),
 };
 
 export default api;
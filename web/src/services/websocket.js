@@ -20,6 +20,8 @@ class WebSocketClient {
     this.reconnecting = false; // 是否正在重连中
     this.messageQueue = []; // 消息队列（用于断线重连后发送）
     this.isPageVisible = true; // 页面是否可见
+    this.lastSeq = null; // 已连续收到的最大投递序号，重连时通过last_seq补推断线期间的消息
+    this.receivedSeqs = new Set(); // 大于lastSeq的已收到序号，用于去重重试和补推的消息
 
     // 监听页面可见性变化
     this.setupVisibilityListener();
@@ -80,8 +82,8 @@ class WebSocketClient {
 
     return new Promise((resolve, reject) => {
       try {
-        const fullUrl = `${this.url}?token=${this.token}`;
-        this.ws = new WebSocket(fullUrl);
+        // 通过子协议传递Token，避免Token出现在URL和访问日志中
+        this.ws = new WebSocket(this.buildUrl(), ['gochat.v1', `access_token.${this.token}`]);
 
         this.ws.onopen = (event) => {
           console.log('[WebSocket] 连接成功');
@@ -140,6 +142,15 @@ class WebSocketClient {
     });
   }
 
+  // 构造连接地址：声明确认投递（ack=1），重连时携带last_seq补推断线期间的消息
+  buildUrl() {
+    const params = ['ack=1'];
+    if (this.lastSeq !== null) {
+      params.push(`last_seq=${this.lastSeq}`);
+    }
+    return `${this.url}${this.url.includes('?') ? '&' : '?'}${params.join('&')}`;
+  }
+
   // 断开连接
   disconnect() {
     this.manualClose = true; // 标记为手动关闭
@@ -289,6 +300,39 @@ class WebSocketClient {
     return this.send('chat', data);
   }
 
+  // 确认收到带投递序号的消息，未确认的消息服务端会重发
+  sendAck(seq) {
+    if (!this.connected) return;
+
+    try {
+      this.ws.send(JSON.stringify({ type: 'ack', action: 'send', seq: seq }));
+    } catch (error) {
+      console.error('[WebSocket] 发送确认失败:', error);
+    }
+  }
+
+  // 记录投递序号，返回false表示重复的消息（重试或断线补推）
+  recordSeq(seq) {
+    if (this.lastSeq === null) {
+      this.lastSeq = seq - 1;
+    }
+    if (seq <= this.lastSeq || this.receivedSeqs.has(seq)) {
+      return false;
+    }
+
+    this.receivedSeqs.add(seq);
+    while (this.receivedSeqs.has(this.lastSeq + 1)) {
+      this.lastSeq++;
+      this.receivedSeqs.delete(this.lastSeq);
+    }
+    // 缺失的序号长时间补不上时（如发送缓冲区溢出被丢弃）不再等待，避免集合无限增长
+    if (this.receivedSeqs.size > 200) {
+      this.lastSeq = Math.max(...this.receivedSeqs);
+      this.receivedSeqs.clear();
+    }
+    return true;
+  }
+
   // 处理接收到的消息
   handleMessage(message) {
     // 心跳消息不打印日志，减少console噪音
@@ -296,6 +340,13 @@ class WebSocketClient {
       console.log('[WebSocket] 收到消息:', message);
     }
 
+    if (message.seq) {
+      this.sendAck(message.seq);
+      if (!this.recordSeq(message.seq)) {
+        return;
+      }
+    }
+
     switch (message.type) {
       case 'system':
         this.handleSystemMessage(message);
@@ -324,6 +375,10 @@ class WebSocketClient {
   handleSystemMessage(message) {
     if (message.action === 'connected' && message.data) {
       this.userId = message.data.user_id;
+      // 首次连接从当前序号开始，之前的消息通过历史接口加载
+      if (this.lastSeq === null) {
+        this.lastSeq = message.data.last_seq || 0;
+      }
       console.log('[WebSocket] 用户连接确认:', this.userId);
     }
 